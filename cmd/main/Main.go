@@ -2,11 +2,14 @@ package main
 
 import (
 	"fmt"
-	"github.com/hyperjumptech/hansip/internal/server"
+	"os"
+
+	"github.com/hyperjumptech/hansip/internal/cli"
 )
 
 func main() {
-	fmt.Println(
+	// the banner goes to stderr, stdout is kept for the command output, eg. user export or token inspect json.
+	fmt.Fprintln(os.Stderr,
 		` __ __   ____  ____   _____ ____  ____  
 |  |  | /    ||    \ / ___/|    ||    \ 
 |  |  ||  o  ||  _  (   \_  |  | |  o  )
@@ -15,5 +18,8 @@ func main() {
 |  |  ||  |  ||  |  |\    | |  | |  |   
 |__|__||__|__||__|__| \___||____||__|   
 Access Authentication & Authorization (AAA) server.`)
-	server.Start()
+	if err := cli.Run(os.Args[1:]); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
 }
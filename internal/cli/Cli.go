@@ -0,0 +1,427 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/hyperjumptech/hansip/internal/config"
+	"github.com/hyperjumptech/hansip/internal/connector"
+	"github.com/hyperjumptech/hansip/internal/endpoint"
+	"github.com/hyperjumptech/hansip/internal/passphrase"
+	"github.com/hyperjumptech/hansip/internal/server"
+	"github.com/hyperjumptech/hansip/pkg/helper"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	// Out is where the command output is written to.
+	Out io.Writer = os.Stdout
+
+	// ErrUnknownCommand returned when the command line contains unrecognized command
+	ErrUnknownCommand = fmt.Errorf("unknown command")
+)
+
+// Usage of the hansip command line
+const Usage = `Usage: hansip <command> [arguments]
+
+Commands:
+  serve                                            start the hansip server (default)
+  user create -email <email> -passphrase <pass>    create an enabled user
+              [-tenant <domain>] [-admin]          in a tenant, optionally as the tenant admin
+  user reset -email <email> -passphrase <pass>     reset the user passphrase
+  user unlock -email <email>                       unsuspend the user and reset its fail count
+  user import -file <file> [-format csv|json]      import users, sending activation email to each of them
+              [-tenant <domain>] [-dry-run]        in a tenant, or only validate the rows
+  user export [-file <file>] [-format csv|json]    export users with their groups and roles
+              [-tenant <domain>]                   optionally only users of a tenant
+  tenant list                                      list all tenants
+  db init                                          create missing tables and built in records
+  db drop -yes                                     drop all hansip tables
+  token inspect <token>                            read and validate a JWT token
+  audit verify                                     verify the audit hash chain and its signed checkpoints
+  audit checkpoint                                 sign the current audit hash chain into a checkpoint
+  help                                             show this help
+`
+
+// Run executes the command line arguments. Arguments should not include the program name.
+func Run(args []string) error {
+	if len(args) == 0 {
+		server.Start()
+		return nil
+	}
+	switch args[0] {
+	case "serve":
+		server.Start()
+		return nil
+	case "user":
+		return runUser(args[1:])
+	case "tenant":
+		return runTenant(args[1:])
+	case "db":
+		return runDB(args[1:])
+	case "token":
+		return runToken(args[1:])
+	case "audit":
+		return runAudit(args[1:])
+	case "help", "-h", "--help":
+		fmt.Fprint(Out, Usage)
+		return nil
+	}
+	fmt.Fprint(Out, Usage)
+	return fmt.Errorf("%w %s", ErrUnknownCommand, args[0])
+}
+
+func runUser(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("%w user. expecting create, reset, unlock, import or export", ErrUnknownCommand)
+	}
+	switch args[0] {
+	case "create":
+		fs := flag.NewFlagSet("user create", flag.ContinueOnError)
+		email := fs.String("email", "", "user email")
+		pass := fs.String("passphrase", "", "user passphrase")
+		tenantDomain := fs.String("tenant", config.Get("hansip.domain"), "tenant domain the user belongs to")
+		admin := fs.Bool("admin", false, "make the user admin of the tenant")
+		if err := fs.Parse(args[1:]); err != nil {
+			return err
+		}
+		if len(*email) == 0 || len(*pass) == 0 {
+			return fmt.Errorf("-email and -passphrase are required")
+		}
+		server.InitializeRepositories()
+		return createUser(context.Background(), *email, *pass, *tenantDomain, *admin)
+	case "reset":
+		fs := flag.NewFlagSet("user reset", flag.ContinueOnError)
+		email := fs.String("email", "", "user email")
+		pass := fs.String("passphrase", "", "new user passphrase")
+		if err := fs.Parse(args[1:]); err != nil {
+			return err
+		}
+		if len(*email) == 0 || len(*pass) == 0 {
+			return fmt.Errorf("-email and -passphrase are required")
+		}
+		server.InitializeRepositories()
+		return resetUser(context.Background(), *email, *pass)
+	case "unlock":
+		fs := flag.NewFlagSet("user unlock", flag.ContinueOnError)
+		email := fs.String("email", "", "user email")
+		if err := fs.Parse(args[1:]); err != nil {
+			return err
+		}
+		if len(*email) == 0 {
+			return fmt.Errorf("-email is required")
+		}
+		server.InitializeRepositories()
+		return unlockUser(context.Background(), *email)
+	case "import":
+		fs := flag.NewFlagSet("user import", flag.ContinueOnError)
+		file := fs.String("file", "", "CSV or JSON file to import")
+		format := fs.String("format", "", "file format, csv or json. default to the file extension")
+		tenantDomain := fs.String("tenant", config.Get("hansip.domain"), "tenant domain the users belong to")
+		dryRun := fs.Bool("dry-run", false, "only validate the rows")
+		if err := fs.Parse(args[1:]); err != nil {
+			return err
+		}
+		if len(*file) == 0 {
+			return fmt.Errorf("-file is required")
+		}
+		if len(*format) == 0 {
+			*format = strings.TrimPrefix(strings.ToLower(filepath.Ext(*file)), ".")
+		}
+		server.InitializeRepositories()
+		return importUsers(context.Background(), *file, *format, *tenantDomain, *dryRun)
+	case "export":
+		fs := flag.NewFlagSet("user export", flag.ContinueOnError)
+		file := fs.String("file", "", "file to write into. default to standard output")
+		format := fs.String("format", endpoint.UserImportFormatCSV, "export format, csv or json")
+		tenantDomain := fs.String("tenant", "", "only export users of this tenant domain")
+		if err := fs.Parse(args[1:]); err != nil {
+			return err
+		}
+		server.InitializeRepositories()
+		return exportUsers(context.Background(), *file, *format, *tenantDomain)
+	}
+	return fmt.Errorf("%w user %s", ErrUnknownCommand, args[0])
+}
+
+func importUsers(ctx context.Context, file, format, tenantDomain string, dryRun bool) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	records, err := endpoint.ParseUserImport(f, format)
+	if err != nil {
+		return err
+	}
+	tenant, err := endpoint.TenantRepo.GetTenantByDomain(ctx, tenantDomain)
+	if err != nil {
+		return fmt.Errorf("tenant %s not found. got %s", tenantDomain, err.Error())
+	}
+	// the verification emails are stored in the outbox, the running hansip server sends them.
+	// command line user have access to all domains.
+	report := endpoint.ImportUsers(ctx, tenant, records, dryRun, func(*connector.Group) bool { return true }, func(*connector.Role) bool { return true })
+	for _, row := range report.Rows {
+		if len(row.Errors) > 0 {
+			fmt.Fprintf(Out, "row %d %s : %s\n", row.Row, row.Email, strings.Join(row.Errors, ", "))
+		}
+	}
+	if dryRun {
+		fmt.Fprintf(Out, "dry run, %d of %d users can be imported, %d failed\n", report.Imported, report.Total, report.Failed)
+	} else {
+		fmt.Fprintf(Out, "%d of %d users imported, %d failed\n", report.Imported, report.Total, report.Failed)
+	}
+	if report.Failed > 0 {
+		return fmt.Errorf("%d rows failed", report.Failed)
+	}
+	return nil
+}
+
+func exportUsers(ctx context.Context, file, format, tenantDomain string) error {
+	out := Out
+	if len(file) > 0 {
+		f, err := os.Create(file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		out = f
+	}
+	var domains []string
+	if len(tenantDomain) > 0 {
+		domains = []string{tenantDomain}
+	}
+	writer, err := endpoint.NewUserExportWriter(out, format)
+	if err != nil {
+		return err
+	}
+	_, err = endpoint.ExportUsers(ctx, domains, writer)
+	return err
+}
+
+func validatePassphrase(pass string) error {
+	minChars := config.GetInt("security.passphrase.minchars")
+	minWords := config.GetInt("security.passphrase.minwords")
+	minCharsInWord := config.GetInt("security.passphrase.mincharsinword")
+	if !passphrase.Validate(pass, minChars, minWords, minCharsInWord) {
+		return fmt.Errorf("invalid passphrase. passphrase must at least has %d characters and %d words and for each word have minimum %d characters", minChars, minWords, minCharsInWord)
+	}
+	return nil
+}
+
+func createUser(ctx context.Context, email, pass, tenantDomain string, admin bool) error {
+	if err := validatePassphrase(pass); err != nil {
+		return err
+	}
+	tenant, err := endpoint.TenantRepo.GetTenantByDomain(ctx, tenantDomain)
+	if err != nil {
+		return fmt.Errorf("tenant %s not found. got %s", tenantDomain, err.Error())
+	}
+	user, err := endpoint.UserRepo.CreateUserRecord(ctx, email, pass)
+	if err != nil {
+		return err
+	}
+	user.Enabled = true
+	err = endpoint.UserRepo.UpdateUser(ctx, user)
+	if err != nil {
+		return err
+	}
+	_, err = endpoint.UserTenantRepo.CreateUserTenant(ctx, user, tenant)
+	if err != nil {
+		return err
+	}
+	if admin {
+		role, err := endpoint.RoleRepo.GetRoleByName(ctx, config.Get("hansip.admin"), tenant.Domain)
+		if err != nil {
+			role, err = endpoint.RoleRepo.CreateRole(ctx, config.Get("hansip.admin"), tenant.Domain, fmt.Sprintf("%s admin role", tenant.Name))
+			if err != nil {
+				return err
+			}
+		}
+		_, err = endpoint.UserRoleRepo.CreateUserRole(ctx, user, role)
+		if err != nil {
+			return err
+		}
+	}
+	fmt.Fprintf(Out, "user %s created with rec_id %s in tenant %s\n", user.Email, user.RecID, tenant.Domain)
+	return nil
+}
+
+func resetUser(ctx context.Context, email, pass string) error {
+	if err := validatePassphrase(pass); err != nil {
+		return err
+	}
+	user, err := endpoint.UserRepo.GetUserByEmail(ctx, email)
+	if err != nil {
+		return fmt.Errorf("user %s not found. got %s", email, err.Error())
+	}
+	hashed, err := bcrypt.GenerateFromPassword([]byte(pass), 14)
+	if err != nil {
+		return err
+	}
+	user.HashedPassphrase = string(hashed)
+	err = endpoint.UserRepo.UpdateUser(ctx, user)
+	if err != nil {
+		return err
+	}
+	err = endpoint.RevocationRepo.Revoke(ctx, user.Email)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(Out, "user %s passphrase has been reset\n", user.Email)
+	return nil
+}
+
+func unlockUser(ctx context.Context, email string) error {
+	user, err := endpoint.UserRepo.GetUserByEmail(ctx, email)
+	if err != nil {
+		return fmt.Errorf("user %s not found. got %s", email, err.Error())
+	}
+	user.Suspended = false
+	user.FailCount = 0
+	err = endpoint.UserRepo.UpdateUser(ctx, user)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(Out, "user %s unlocked\n", user.Email)
+	return nil
+}
+
+func runTenant(args []string) error {
+	if len(args) == 0 || args[0] != "list" {
+		return fmt.Errorf("%w tenant. expecting list", ErrUnknownCommand)
+	}
+	server.InitializeRepositories()
+	ctx := context.Background()
+	tw := tabwriter.NewWriter(Out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "REC_ID\tNAME\tDOMAIN\tDESCRIPTION")
+	pageNo := uint(1)
+	for {
+		tenants, page, err := endpoint.TenantRepo.ListTenant(ctx, &helper.PageRequest{
+			No:       pageNo,
+			PageSize: 100,
+			OrderBy:  "TENANT_NAME",
+			Sort:     "ASC",
+		})
+		if err != nil {
+			return err
+		}
+		for _, t := range tenants {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", t.RecID, t.Name, t.Domain, t.Description)
+		}
+		if page.IsLast || len(tenants) == 0 {
+			break
+		}
+		pageNo++
+	}
+	return tw.Flush()
+}
+
+func runDB(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("%w db. expecting init or drop", ErrUnknownCommand)
+	}
+	switch args[0] {
+	case "init":
+		// obtaining the instance will create missing tables and built in records.
+		server.InitializeRepositories()
+		err := server.SetupAdmin(context.Background())
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(Out, "database initialized")
+		return nil
+	case "drop":
+		fs := flag.NewFlagSet("db drop", flag.ContinueOnError)
+		yes := fs.Bool("yes", false, "confirm dropping all tables")
+		if err := fs.Parse(args[1:]); err != nil {
+			return err
+		}
+		if !*yes {
+			return fmt.Errorf("this will drop all hansip tables and its data. use -yes to confirm")
+		}
+		var dbUtil connector.DBUtil = connector.GetMySQLDBInstance()
+		err := dbUtil.DropAllTables(context.Background())
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(Out, "all tables dropped")
+		return nil
+	}
+	return fmt.Errorf("%w db %s", ErrUnknownCommand, args[0])
+}
+
+func runToken(args []string) error {
+	if len(args) < 2 || args[0] != "inspect" {
+		return fmt.Errorf("%w token. expecting inspect <token>", ErrUnknownCommand)
+	}
+	token := strings.TrimSpace(args[1])
+	if strings.HasPrefix(strings.ToUpper(token), "BEARER ") {
+		token = strings.TrimSpace(token[7:])
+	}
+	ht, err := server.GetJwtTokenFactory().ReadToken(token)
+	if ht == nil {
+		return err
+	}
+	ret := make(map[string]interface{})
+	ret["issuer"] = ht.Issuer
+	ret["subject"] = ht.Subject
+	ret["audiences"] = ht.Audiences
+	ret["issued_at"] = ht.IssuedAt
+	ret["not_before"] = ht.NotBefore
+	ret["expire"] = ht.Expire
+	ret["additional"] = ht.Additional
+	ret["valid"] = err == nil
+	if err != nil {
+		ret["error"] = err.Error()
+	}
+	byt, jerr := json.MarshalIndent(ret, "", "  ")
+	if jerr != nil {
+		return jerr
+	}
+	fmt.Fprintln(Out, string(byt))
+	return nil
+}
+
+func runAudit(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("%w audit. expecting verify or checkpoint", ErrUnknownCommand)
+	}
+	switch args[0] {
+	case "verify":
+		server.InitializeRepositories()
+		report, err := endpoint.VerifyAuditChain(context.Background())
+		if err != nil {
+			return err
+		}
+		byt, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(Out, string(byt))
+		if !report.Verified {
+			return fmt.Errorf("audit chain broken at sequence %d, %s", report.BrokenSeq, report.Reason)
+		}
+		return nil
+	case "checkpoint":
+		server.InitializeRepositories()
+		checkpoint, err := endpoint.CreateAuditCheckpoint(context.Background())
+		if err != nil {
+			return err
+		}
+		if checkpoint == nil {
+			fmt.Fprintln(Out, "no event recorded since the last checkpoint")
+			return nil
+		}
+		fmt.Fprintf(Out, "checkpoint %s made at sequence %d\n", checkpoint.RecID, checkpoint.Seq)
+		return nil
+	}
+	return fmt.Errorf("%w audit %s", ErrUnknownCommand, args[0])
+}
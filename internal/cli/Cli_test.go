@@ -0,0 +1,71 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/hyperjumptech/hansip/internal/server"
+)
+
+func TestRunUnknownCommand(t *testing.T) {
+	buff := &bytes.Buffer{}
+	Out = buff
+	testData := [][]string{
+		{"foo"},
+		{"user"},
+		{"user", "delete"},
+		{"tenant"},
+		{"db", "migrate"},
+		{"token", "inspect"},
+	}
+	for _, args := range testData {
+		err := Run(args)
+		if !errors.Is(err, ErrUnknownCommand) {
+			t.Errorf("Run(%v) expect ErrUnknownCommand but got %v", args, err)
+		}
+	}
+}
+
+func TestRunHelp(t *testing.T) {
+	buff := &bytes.Buffer{}
+	Out = buff
+	if err := Run([]string{"help"}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buff.String(), "token inspect") {
+		t.Errorf("expect usage to be printed but got %s", buff.String())
+	}
+}
+
+func TestRunDBDropWithoutConfirmation(t *testing.T) {
+	if err := Run([]string{"db", "drop"}); err == nil {
+		t.Errorf("expect db drop without -yes to fail")
+	}
+}
+
+func TestRunTokenInspect(t *testing.T) {
+	access, _, err := server.GetJwtTokenFactory().CreateTokenPair("test@hansip", []string{"admin@hansip"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buff := &bytes.Buffer{}
+	Out = buff
+	err = Run([]string{"token", "inspect", "Bearer " + access})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ret := make(map[string]interface{})
+	err = json.Unmarshal(buff.Bytes(), &ret)
+	if err != nil {
+		t.Fatalf("output is not json. got %s", buff.String())
+	}
+	if ret["subject"] != "test@hansip" {
+		t.Errorf("expect subject test@hansip but %v", ret["subject"])
+	}
+	if ret["valid"] != true {
+		t.Errorf("expect token to be valid but %v", ret["error"])
+	}
+}
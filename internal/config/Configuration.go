@@ -20,6 +20,7 @@ func initialize() {
 	defCfg = make(map[string]string)
 
 	defCfg["api.path.prefix"] = "/api/v1"
+	defCfg["scim.path.prefix"] = "/scim/v2"
 
 	defCfg["server.host"] = "localhost"
 	defCfg["server.port"] = "3000"
@@ -31,11 +32,17 @@ func initialize() {
 	defCfg["server.http.cors.enable"] = "true"
 	defCfg["server.http.cors.allow.origins"] = "*"
 	defCfg["server.http.cors.allow.credential"] = "true"
-	defCfg["server.http.cors.allow.method"] = "GET,PUT,DELETE,POST,OPTIONS"
-	defCfg["server.http.cors.allow.headers"] = "Accept,Authorization,Content-Type,X-CSRF-TOKEN,Accept-Encoding,X-Forwarded-For,X-Real-IP,X-Request-ID"
+	defCfg["server.http.cors.allow.method"] = "GET,PUT,PATCH,DELETE,POST,OPTIONS"
+	defCfg["server.http.cors.allow.headers"] = "Accept,Authorization,Content-Type,X-CSRF-TOKEN,Accept-Encoding,X-Forwarded-For,X-Real-IP,X-Request-ID,If-Match"
 	defCfg["server.http.cors.exposed.headers"] = "*"
 	defCfg["server.http.cors.optionpassthrough"] = "true"
 	defCfg["server.http.cors.maxage"] = "300"
+	defCfg["server.devmode"] = "false"
+	defCfg["server.http.ifmatch.required"] = "false" // when true, updating or deleting management resources without If-Match is refused
+
+	defCfg["setup.admin.enable"] = "false"
+	defCfg["setup.admin.email"] = "admin@hansip"
+	defCfg["setup.admin.passphrase"] = "this must be change in the production"
 
 	defCfg["token.issuer"] = "aaa.domain.com"
 	defCfg["token.access.duration"] = "5 minutes"
@@ -59,6 +66,31 @@ func initialize() {
 	defCfg["security.passphrase.minchars"] = "8"
 	defCfg["security.passphrase.minwords"] = "3"
 	defCfg["security.passphrase.mincharsinword"] = "3"
+	defCfg["security.lockout.failcount"] = "3"
+	defCfg["security.2fa.email.expiry"] = "5 minutes"
+	defCfg["security.2fa.email.resend"] = "60 seconds"
+	defCfg["security.2fa.email.maxattempts"] = "5"
+	defCfg["webauthn.rp.id"] = "localhost"
+	defCfg["webauthn.rp.name"] = "Hansip"
+	defCfg["webauthn.rp.origins"] = "http://localhost:3000"
+	defCfg["webauthn.timeout"] = "2 minutes"
+	defCfg["webauthn.userverification"] = "preferred"
+
+	defCfg["invitation.expiry"] = "7 days"
+	defCfg["audit.checkpoint.interval"] = "1 hour"
+	defCfg["webhook.poll.interval"] = "10 seconds"
+	defCfg["webhook.timeout"] = "10 seconds"
+	defCfg["webhook.retry.max"] = "8"
+	defCfg["webhook.retry.backoff"] = "30 seconds"
+	defCfg["webhook.workers"] = "4"
+	defCfg["webhook.allow.private"] = "false"
+	defCfg["events.sink.type"] = "NONE"
+	defCfg["events.sink.jsonl.path"] = "hansip-events.jsonl"
+	defCfg["outbox.poll.interval"] = "2 seconds"
+	defCfg["outbox.workers"] = "4"
+	defCfg["outbox.timeout"] = "30 seconds"
+	defCfg["outbox.retry.max"] = "10"
+	defCfg["outbox.retry.backoff"] = "30 seconds"
 
 	defCfg["mailer.type"] = "SENDGRID" // DUMMY, SENDMAIL, SENDGRID
 	defCfg["mailer.from"] = "hansip@aaa.com"
@@ -67,12 +99,51 @@ func initialize() {
 	defCfg["mailer.sendmail.port"] = "25"
 	defCfg["mailer.sendmail.user"] = "sendmail"
 	defCfg["mailer.sendmail.password"] = "password"
+	defCfg["mailer.sendmail.auth"] = "PLAIN"        // PLAIN, LOGIN, CRAM-MD5, NONE
+	defCfg["mailer.sendmail.tls"] = "OPPORTUNISTIC" // NONE, OPPORTUNISTIC, STARTTLS, TLS
+	defCfg["mailer.sendmail.tls.ca"] = ""           // PEM bundle of the certificate authorities to trust on top of the system ones
+	defCfg["mailer.sendmail.tls.skipverify"] = "false"
+	defCfg["mailer.sendmail.helo"] = "localhost"
+	defCfg["mailer.sendmail.timeout"] = "30 seconds"
+	defCfg["mailer.sendmail.pool.size"] = "2"
+	defCfg["mailer.sendmail.pool.idle"] = "60 seconds" // 0 seconds opens a new connection for every email
 	defCfg["mailer.templates.emailveri.subject"] = "Please verify your new Hansip account's email"
 	defCfg["mailer.templates.emailveri.body"] = "<html><body>Dear New Hansip User<br><br>Your new account is ready!<br>please click this <a href=\"http://172.31.219.130:3001/activate?email={{.Email}}&code={{.ActivationCode}}\">link to activate</a> your account.<br><br>Cordially,<br>HANSIP team</body></html>"
+	defCfg["mailer.templates.emailveri.text"] = "Dear New Hansip User,\n\nYour new account is ready!\nPlease open this link to activate your account:\nhttp://172.31.219.130:3001/activate?email={{.Email}}&code={{.ActivationCode}}\n\nCordially,\nHANSIP team\n"
 	defCfg["mailer.templates.passrecover.subject"] = "Passphrase recovery instruction"
 	defCfg["mailer.templates.passrecover.body"] = "<html><body>Dear Hansip User<br><br>To recover your passphrase<br>please click this <a href=\"http://172.31.219.130:3001/recover?email={{.Email}}&code={{.RecoveryCode}}\">link to change your passphrase</a>.<br><br>Cordially,<br>HANSIP team</body></html>"
+	defCfg["mailer.templates.passrecover.text"] = "Dear Hansip User,\n\nTo recover your passphrase, please open this link to change your passphrase:\nhttp://172.31.219.130:3001/recover?email={{.Email}}&code={{.RecoveryCode}}\n\nCordially,\nHANSIP team\n"
+	defCfg["mailer.templates.invitation.subject"] = "You are invited to join {{.TenantName}}"
+	defCfg["mailer.templates.invitation.body"] = "<html><body>Dear Hansip User<br><br>You have been invited to join {{.TenantName}}.<br>please click this <a href=\"http://172.31.219.130:3001/invitation?email={{.Email}}&code={{.Token}}\">link to accept the invitation</a> and choose your passphrase.<br>The invitation expires at {{.ExpireAt.Format \"2006-01-02 15:04 MST\"}}.<br><br>Cordially,<br>HANSIP team</body></html>"
+	defCfg["mailer.templates.invitation.text"] = "Dear Hansip User,\n\nYou have been invited to join {{.TenantName}}.\nPlease open this link to accept the invitation and choose your passphrase:\nhttp://172.31.219.130:3001/invitation?email={{.Email}}&code={{.Token}}\nThe invitation expires at {{.ExpireAt.Format \"2006-01-02 15:04 MST\"}}.\n\nCordially,\nHANSIP team\n"
+	defCfg["mailer.templates.emailotp.subject"] = "Your Hansip verification code"
+	defCfg["mailer.templates.emailotp.body"] = "<html><body>Dear Hansip User<br><br>Your verification code is <b>{{.Code}}</b>.<br>It expires in {{.Minutes}} minutes. Never share it with anyone.<br>If you did not try to sign in, change your passphrase now.<br><br>Cordially,<br>HANSIP team</body></html>"
+	defCfg["mailer.templates.emailotp.text"] = "Dear Hansip User,\n\nYour verification code is {{.Code}}.\nIt expires in {{.Minutes}} minutes. Never share it with anyone.\nIf you did not try to sign in, change your passphrase now.\n\nCordially,\nHANSIP team\n"
+	defCfg["mailer.templates.locales"] = "id" // locales having email template variants, comma separated
+	defCfg["mailer.templates.emailveri.id.subject"] = "Silakan verifikasi email akun Hansip baru Anda"
+	defCfg["mailer.templates.emailveri.id.body"] = "<html><body>Pengguna Hansip yang terhormat<br><br>Akun baru Anda sudah siap!<br>silakan klik <a href=\"http://172.31.219.130:3001/activate?email={{.Email}}&code={{.ActivationCode}}\">tautan ini untuk mengaktifkan</a> akun Anda.<br><br>Salam hangat,<br>Tim HANSIP</body></html>"
+	defCfg["mailer.templates.emailveri.id.text"] = "Pengguna Hansip yang terhormat,\n\nAkun baru Anda sudah siap!\nSilakan buka tautan ini untuk mengaktifkan akun Anda:\nhttp://172.31.219.130:3001/activate?email={{.Email}}&code={{.ActivationCode}}\n\nSalam hangat,\nTim HANSIP\n"
+	defCfg["mailer.templates.passrecover.id.subject"] = "Petunjuk pemulihan passphrase"
+	defCfg["mailer.templates.passrecover.id.body"] = "<html><body>Pengguna Hansip yang terhormat<br><br>Untuk memulihkan passphrase Anda<br>silakan klik <a href=\"http://172.31.219.130:3001/recover?email={{.Email}}&code={{.RecoveryCode}}\">tautan ini untuk mengganti passphrase</a> Anda.<br><br>Salam hangat,<br>Tim HANSIP</body></html>"
+	defCfg["mailer.templates.passrecover.id.text"] = "Pengguna Hansip yang terhormat,\n\nUntuk memulihkan passphrase Anda, silakan buka tautan ini untuk mengganti passphrase Anda:\nhttp://172.31.219.130:3001/recover?email={{.Email}}&code={{.RecoveryCode}}\n\nSalam hangat,\nTim HANSIP\n"
+	defCfg["mailer.templates.invitation.id.subject"] = "Anda diundang untuk bergabung dengan {{.TenantName}}"
+	defCfg["mailer.templates.invitation.id.body"] = "<html><body>Pengguna Hansip yang terhormat<br><br>Anda diundang untuk bergabung dengan {{.TenantName}}.<br>silakan klik <a href=\"http://172.31.219.130:3001/invitation?email={{.Email}}&code={{.Token}}\">tautan ini untuk menerima undangan</a> dan memilih passphrase Anda.<br>Undangan ini berlaku hingga {{.ExpireAt.Format \"2006-01-02 15:04 MST\"}}.<br><br>Salam hangat,<br>Tim HANSIP</body></html>"
+	defCfg["mailer.templates.invitation.id.text"] = "Pengguna Hansip yang terhormat,\n\nAnda diundang untuk bergabung dengan {{.TenantName}}.\nSilakan buka tautan ini untuk menerima undangan dan memilih passphrase Anda:\nhttp://172.31.219.130:3001/invitation?email={{.Email}}&code={{.Token}}\nUndangan ini berlaku hingga {{.ExpireAt.Format \"2006-01-02 15:04 MST\"}}.\n\nSalam hangat,\nTim HANSIP\n"
+	defCfg["mailer.templates.emailotp.id.subject"] = "Kode verifikasi Hansip Anda"
+	defCfg["mailer.templates.emailotp.id.body"] = "<html><body>Pengguna Hansip yang terhormat<br><br>Kode verifikasi Anda adalah <b>{{.Code}}</b>.<br>Kode ini berlaku selama {{.Minutes}} menit. Jangan berikan kode ini kepada siapa pun.<br>Jika Anda tidak sedang masuk, segera ganti passphrase Anda.<br><br>Salam hangat,<br>Tim HANSIP</body></html>"
+	defCfg["mailer.templates.emailotp.id.text"] = "Pengguna Hansip yang terhormat,\n\nKode verifikasi Anda adalah {{.Code}}.\nKode ini berlaku selama {{.Minutes}} menit. Jangan berikan kode ini kepada siapa pun.\nJika Anda tidak sedang masuk, segera ganti passphrase Anda.\n\nSalam hangat,\nTim HANSIP\n"
 	defCfg["mailer.sendgrid.token"] = "SENDGRIDTOKEN"
 
+	defCfg["messenger.type"] = "DUMMY" // DUMMY, WEBHOOK
+	defCfg["messenger.webhook.url"] = "http://localhost:8080/messages"
+	defCfg["messenger.webhook.secret"] = ""
+	defCfg["messenger.webhook.timeout"] = "10 seconds"
+	defCfg["messenger.templates.otp.text"] = "Your Hansip verification code is {{.Code}}. It expires in {{.Minutes}} minutes. Never share it with anyone."
+	defCfg["messenger.templates.security.text"] = "Hansip security notice: {{.Event}}. If this was not you, change your passphrase now."
+	defCfg["messenger.templates.locales"] = "id"
+	defCfg["messenger.templates.otp.id.text"] = "Kode verifikasi Hansip Anda adalah {{.Code}}. Berlaku selama {{.Minutes}} menit. Jangan berikan kode ini kepada siapa pun."
+	defCfg["messenger.templates.security.id.text"] = "Pemberitahuan keamanan Hansip: {{.Event}}. Jika ini bukan Anda, segera ganti passphrase Anda."
+
 	for k := range defCfg {
 		err := viper.BindEnv(k)
 		if err != nil {
@@ -143,3 +214,30 @@ func GetFloat(key string) float64 {
 func Set(key, value string) {
 	defCfg[key] = value
 }
+
+// Settings holds configuration overrides, such as tenant specific settings.
+// Any key not found in the settings will be resolved from the global configuration.
+type Settings map[string]string
+
+// Get fetch configuration as string value, settings first then global configuration
+func (s Settings) Get(key string) string {
+	if s != nil {
+		if ret, ok := s[key]; ok && len(ret) > 0 {
+			return ret
+		}
+	}
+	return Get(key)
+}
+
+// GetInt fetch configuration as integer value, settings first then global configuration
+func (s Settings) GetInt(key string) int {
+	if len(s.Get(key)) == 0 {
+		return 0
+	}
+	i, err := strconv.ParseInt(s.Get(key), 10, 64)
+	if err != nil {
+		log.Errorf("Settings key %s is not an integer, using global configuration. Got %s", key, err)
+		return GetInt(key)
+	}
+	return int(i)
+}
@@ -0,0 +1,97 @@
+package connector
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// auditEventHash returns the hex SHA-256 of the event chained to prevHash. The values are hashed as they are stored,
+// that is the time in whole seconds and changes as the stored json, so the hash can be recomputed from the table.
+func auditEventHash(prevHash string, event *AuditEvent, changes string) string {
+	b, _ := json.Marshal([]string{
+		prevHash,
+		event.RecID,
+		event.Time.UTC().Format(time.RFC3339),
+		event.Event,
+		event.Outcome,
+		event.Actor,
+		event.TargetType,
+		event.Target,
+		event.TenantDomain,
+		event.ClientIP,
+		event.RequestID,
+		changes,
+	})
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+// auditChainChecker verifies the events of the hash chain one by one in sequence order
+type auditChainChecker struct {
+	report      *AuditChainReport
+	checkpoints map[int64]string
+	matched     map[int64]bool
+}
+
+func newAuditChainChecker(checkpoints map[int64]string) *auditChainChecker {
+	return &auditChainChecker{
+		report:      &AuditChainReport{Verified: true},
+		checkpoints: checkpoints,
+		matched:     make(map[int64]bool),
+	}
+}
+
+func (c *auditChainChecker) broken(seq int64, recID, reason string) {
+	c.report.Verified = false
+	c.report.BrokenSeq = seq
+	c.report.BrokenRecID = recID
+	c.report.Reason = reason
+}
+
+// check verifies the next event given its stored changes, it returns false once the chain is broken.
+func (c *auditChainChecker) check(event *AuditEvent, changes string) bool {
+	if event.PrevHash != c.report.HeadHash {
+		c.broken(event.Seq, event.RecID, "previous hash does not match, an event before it was removed, inserted or altered")
+		return false
+	}
+	if auditEventHash(event.PrevHash, event, changes) != event.Hash {
+		c.broken(event.Seq, event.RecID, "event content does not match its hash")
+		return false
+	}
+	if hash, ok := c.checkpoints[event.Seq]; ok {
+		if hash != event.Hash {
+			c.broken(event.Seq, event.RecID, "event does not match the signed checkpoint")
+			return false
+		}
+		c.matched[event.Seq] = true
+		c.report.Checkpoints++
+	}
+	c.report.Events++
+	c.report.HeadSeq = event.Seq
+	c.report.HeadHash = event.Hash
+	return true
+}
+
+// finish verifies the walked events reached the recorded chain head and every checkpoint, then returns the report.
+func (c *auditChainChecker) finish(headSeq int64, headHash string) *AuditChainReport {
+	if !c.report.Verified {
+		return c.report
+	}
+	if c.report.HeadSeq != headSeq || c.report.HeadHash != headHash {
+		c.broken(headSeq, "", fmt.Sprintf("chain head is at sequence %d but the last event is at %d, events were removed from the end", headSeq, c.report.HeadSeq))
+		return c.report
+	}
+	missing := int64(0)
+	for seq := range c.checkpoints {
+		if !c.matched[seq] && (missing == 0 || seq < missing) {
+			missing = seq
+		}
+	}
+	if missing != 0 {
+		c.broken(missing, "", "the event of the signed checkpoint is missing")
+	}
+	return c.report
+}
@@ -0,0 +1,118 @@
+package connector
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+// auditTestChain returns a valid chain of events with their stored changes
+func auditTestChain(n int) ([]*AuditEvent, []string) {
+	events := make([]*AuditEvent, n)
+	changes := make([]string, n)
+	prev := ""
+	for i := range events {
+		events[i] = &AuditEvent{
+			RecID:        fmt.Sprintf("rec%d", i),
+			Seq:          int64(i + 1),
+			Time:         time.Date(2021, 1, 2, 3, 4, i, 0, time.UTC),
+			Event:        "user.update",
+			Outcome:      "success",
+			Actor:        "admin@hansip",
+			TargetType:   "user",
+			Target:       "abc",
+			TenantDomain: "hansip",
+			PrevHash:     prev,
+		}
+		changes[i] = fmt.Sprintf(`{"enabled":{"before":false,"after":%v}}`, i%2 == 0)
+		events[i].Hash = auditEventHash(prev, events[i], changes[i])
+		prev = events[i].Hash
+	}
+	return events, changes
+}
+
+func checkAuditChain(events []*AuditEvent, changes []string, headSeq int64, headHash string, checkpoints map[int64]string) *AuditChainReport {
+	checker := newAuditChainChecker(checkpoints)
+	for i, event := range events {
+		if !checker.check(event, changes[i]) {
+			break
+		}
+	}
+	return checker.finish(headSeq, headHash)
+}
+
+func TestAuditEventHash(t *testing.T) {
+	events, changes := auditTestChain(1)
+	hash := auditEventHash("", events[0], changes[0])
+	if len(hash) != 64 || hash != events[0].Hash {
+		t.Errorf("expect a stable 64 hex hash but %s", hash)
+	}
+	local := *events[0]
+	local.Time = local.Time.In(time.FixedZone("WIB", 7*3600))
+	if auditEventHash("", &local, changes[0]) != hash {
+		t.Errorf("expect the hash not depending on the time zone")
+	}
+	if auditEventHash("x", events[0], changes[0]) == hash {
+		t.Errorf("expect the hash depending on the previous hash")
+	}
+	local = *events[0]
+	local.Actor = "someone@hansip"
+	if auditEventHash("", &local, changes[0]) == hash {
+		t.Errorf("expect the hash depending on the actor")
+	}
+}
+
+func TestAuditChainChecker(t *testing.T) {
+	events, changes := auditTestChain(5)
+	head := events[4]
+
+	report := checkAuditChain(events, changes, head.Seq, head.Hash, map[int64]string{2: events[1].Hash, 5: head.Hash})
+	if !report.Verified || report.Events != 5 || report.Checkpoints != 2 || report.HeadSeq != 5 {
+		t.Errorf("expect intact chain verified but %+v", report)
+	}
+
+	report = checkAuditChain(nil, nil, 0, "", nil)
+	if !report.Verified || report.Events != 0 {
+		t.Errorf("expect empty chain verified but %+v", report)
+	}
+
+	altered := *events[2]
+	altered.Actor = "intruder@hansip"
+	report = checkAuditChain([]*AuditEvent{events[0], events[1], &altered, events[3], events[4]}, changes, head.Seq, head.Hash, nil)
+	if report.Verified || report.BrokenSeq != 3 || report.Reason != "event content does not match its hash" {
+		t.Errorf("expect altered event 3 broken but %+v", report)
+	}
+
+	alteredChanges := append([]string{}, changes...)
+	alteredChanges[1] = `{}`
+	report = checkAuditChain(events, alteredChanges, head.Seq, head.Hash, nil)
+	if report.Verified || report.BrokenSeq != 2 {
+		t.Errorf("expect altered changes of event 2 broken but %+v", report)
+	}
+
+	report = checkAuditChain([]*AuditEvent{events[0], events[1], events[3], events[4]}, []string{changes[0], changes[1], changes[3], changes[4]}, head.Seq, head.Hash, nil)
+	if report.Verified || report.BrokenSeq != 4 || report.Events != 2 {
+		t.Errorf("expect removed event 3 break at event 4 but %+v", report)
+	}
+
+	report = checkAuditChain(events[1:], changes[1:], head.Seq, head.Hash, nil)
+	if report.Verified || report.BrokenSeq != 2 {
+		t.Errorf("expect removed first event break at event 2 but %+v", report)
+	}
+
+	report = checkAuditChain(events[:3], changes[:3], head.Seq, head.Hash, nil)
+	if report.Verified || report.BrokenSeq != 5 {
+		t.Errorf("expect removed tail break at the head but %+v", report)
+	}
+
+	// the whole chain rehashed after removing the tail and the head moved accordingly, only checkpoints tell.
+	report = checkAuditChain(events[:3], changes[:3], 3, events[2].Hash, map[int64]string{4: events[3].Hash})
+	if report.Verified || report.BrokenSeq != 4 || report.Reason != "the event of the signed checkpoint is missing" {
+		t.Errorf("expect missing checkpoint event 4 but %+v", report)
+	}
+
+	report = checkAuditChain(events, changes, head.Seq, head.Hash, map[int64]string{2: events[2].Hash})
+	if report.Verified || report.BrokenSeq != 2 || report.Reason != "event does not match the signed checkpoint" {
+		t.Errorf("expect checkpoint mismatch at event 2 but %+v", report)
+	}
+}
@@ -29,11 +29,20 @@ type TenantRepository interface {
 	// DeleteTenant removes a tenant entity from table
 	DeleteTenant(ctx context.Context, tenant *Tenant) error
 
-	// SaveOrUpdate a tenant entity into table tenant
+	// UpdateTenant a tenant entity into table tenant, it returns ErrDBConflict if the tenant version has changed since it was read
 	UpdateTenant(ctx context.Context, tenant *Tenant) error
 
 	// ListTenant from database with pagination
 	ListTenant(ctx context.Context, request *helper.PageRequest) ([]*Tenant, *helper.Page, error)
+
+	// GetTenantSettings returns all setting overrides of a tenant
+	GetTenantSettings(ctx context.Context, tenant *Tenant) (map[string]string, error)
+
+	// SetTenantSetting create or replace a setting override of a tenant
+	SetTenantSetting(ctx context.Context, tenant *Tenant, key, value string) error
+
+	// DeleteTenantSettings removes all setting overrides of a tenant
+	DeleteTenantSettings(ctx context.Context, tenant *Tenant) error
 }
 
 // UserRepository manage User table
@@ -56,7 +65,7 @@ type UserRepository interface {
 	// DeleteUser removes a user entity from table
 	DeleteUser(ctx context.Context, user *User) error
 
-	// SaveOrUpdate a user entity into table user
+	// UpdateUser a user entity into table user, it returns ErrDBConflict if the user version has changed since it was read
 	UpdateUser(ctx context.Context, user *User) error
 
 	// ListUser from database with pagination
@@ -95,7 +104,7 @@ type GroupRepository interface {
 	// DeleteGroup from Group table
 	DeleteGroup(ctx context.Context, group *Group) error
 
-	// CreateUserGroup into Group table
+	// UpdateGroup into Group table, it returns ErrDBConflict if the group version has changed since it was read
 	UpdateGroup(ctx context.Context, group *Group) error
 }
 
@@ -110,6 +119,9 @@ type UserGroupRepository interface {
 	// ListUserGroupByEmail from the UserGroup table
 	ListUserGroupByUser(ctx context.Context, user *User, request *helper.PageRequest) ([]*Group, *helper.Page, error)
 
+	// ListUserGroupByUsers returns the groups of the domain each of the users is member of, keyed by the user rec id
+	ListUserGroupByUsers(ctx context.Context, users []*User, domain string) (map[string][]*Group, error)
+
 	// ListUserGroupByGroupName from the UserGroup table
 	ListUserGroupByGroup(ctx context.Context, group *Group, request *helper.PageRequest) ([]*User, *helper.Page, error)
 
@@ -123,6 +135,27 @@ type UserGroupRepository interface {
 	DeleteUserGroupByGroup(ctx context.Context, group *Group) error
 }
 
+// UserTenantRepository manage UserTenant table
+type UserTenantRepository interface {
+	// GetUserTenant returns existing UserTenant
+	GetUserTenant(ctx context.Context, user *User, tenant *Tenant) (*UserTenant, error)
+
+	// CreateUserTenant into UserTenant table
+	CreateUserTenant(ctx context.Context, user *User, tenant *Tenant) (*UserTenant, error)
+
+	// ListUserTenantByUser list tenants the user is member of
+	ListUserTenantByUser(ctx context.Context, user *User, request *helper.PageRequest) ([]*Tenant, *helper.Page, error)
+
+	// ListUserTenantByDomains list users that are member of any of the tenant domains
+	ListUserTenantByDomains(ctx context.Context, domains []string, request *helper.PageRequest) ([]*User, *helper.Page, error)
+
+	// DeleteUserTenant from the UserTenant table
+	DeleteUserTenant(ctx context.Context, userTenant *UserTenant) error
+
+	// DeleteUserTenantByUser from the UserTenant table
+	DeleteUserTenantByUser(ctx context.Context, user *User) error
+}
+
 // UserRoleRepository manage UserRole table
 type UserRoleRepository interface {
 	// GetUserRole returns existing user role
@@ -189,10 +222,221 @@ type RoleRepository interface {
 	// DeleteRole from Role table
 	DeleteRole(ctx context.Context, role *Role) error
 
-	// SaveOrUpdateRole into Role table
+	// UpdateRole into Role table, it returns ErrDBConflict if the role version has changed since it was read
 	UpdateRole(ctx context.Context, role *Role) error
 }
 
+// AttributeRepository manage tenant defined user attribute schemas and the attribute values of users
+type AttributeRepository interface {
+	// GetAttributeSchemaByRecID return an attribute schema record
+	GetAttributeSchemaByRecID(ctx context.Context, recID string) (*AttributeSchema, error)
+
+	// GetAttributeSchemaByName return an attribute schema record of a tenant
+	GetAttributeSchemaByName(ctx context.Context, tenant *Tenant, name string) (*AttributeSchema, error)
+
+	// CreateAttributeSchema into the attribute schema table of a tenant
+	CreateAttributeSchema(ctx context.Context, tenant *Tenant, schema *AttributeSchema) (*AttributeSchema, error)
+
+	// ListAttributeSchemas list all attribute schemas of a tenant ordered by name
+	ListAttributeSchemas(ctx context.Context, tenant *Tenant) ([]*AttributeSchema, error)
+
+	// UpdateAttributeSchema into attribute schema table
+	UpdateAttributeSchema(ctx context.Context, schema *AttributeSchema) error
+
+	// DeleteAttributeSchema from attribute schema table, including the values of all users
+	DeleteAttributeSchema(ctx context.Context, schema *AttributeSchema) error
+
+	// ListUserAttributes list the attribute values of a user defined by a tenant
+	ListUserAttributes(ctx context.Context, user *User, tenant *Tenant) ([]*UserAttribute, error)
+
+	// SetUserAttribute create or replace an attribute value of a user
+	SetUserAttribute(ctx context.Context, user *User, schema *AttributeSchema, value string) error
+
+	// DeleteUserAttribute removes an attribute value of a user
+	DeleteUserAttribute(ctx context.Context, user *User, schema *AttributeSchema) error
+
+	// IsAttributeValueTaken check if another user already has the value of the attribute
+	IsAttributeValueTaken(ctx context.Context, schema *AttributeSchema, value string, user *User) (bool, error)
+}
+
+// Transactor runs repository calls in a database transaction
+type Transactor interface {
+	// Transaction calls fn with a context carrying a new transaction, the repository calls made with that context run in it.
+	// The transaction is committed if fn returns nil and rolled back otherwise.
+	// If the context already carries a transaction, fn runs in a savepoint of it, rolled back alone if fn fails,
+	// and the outermost call commits or rolls back.
+	Transaction(ctx context.Context, fn func(ctx context.Context) error) error
+}
+
+// EmailTemplateRepository manage the versioned email templates of tenants
+type EmailTemplateRepository interface {
+	// CreateEmailTemplateVersion into email template table as the next version of its tenant and key,
+	// its RecID, Version and CreatedAt are assigned
+	CreateEmailTemplateVersion(ctx context.Context, tmpl *EmailTemplate) error
+
+	// GetEmailTemplate return the latest version of the tenant template, ErrDBNoResult if the tenant has none
+	GetEmailTemplate(ctx context.Context, tenant *Tenant, key string) (*EmailTemplate, error)
+
+	// GetEmailTemplateVersion return a version of the tenant template, ErrDBNoResult if there is no such version
+	GetEmailTemplateVersion(ctx context.Context, tenant *Tenant, key string, version int) (*EmailTemplate, error)
+
+	// ListEmailTemplates list the latest version of every template of a tenant ordered by key
+	ListEmailTemplates(ctx context.Context, tenant *Tenant) ([]*EmailTemplate, error)
+
+	// ListEmailTemplateVersions list every version of the tenant template, the latest first
+	ListEmailTemplateVersions(ctx context.Context, tenant *Tenant, key string) ([]*EmailTemplate, error)
+
+	// DeleteEmailTemplate deletes every version of the tenant template
+	DeleteEmailTemplate(ctx context.Context, tenant *Tenant, key string) error
+}
+
+// EmailOTPRepository manage the one time codes mailed to users as their second authentication factor
+type EmailOTPRepository interface {
+	// SaveEmailOTP into email otp table, replacing the code of the user for the same purpose
+	SaveEmailOTP(ctx context.Context, otp *EmailOTP) error
+
+	// GetEmailOTP return the code of the user for the purpose, ErrDBNoResult if there is none
+	GetEmailOTP(ctx context.Context, user *User, purpose string) (*EmailOTP, error)
+
+	// ConsumeEmailOTPAttempt counts an attempt to verify the code. It returns false, without counting,
+	// if the code has no attempt left or was replaced or deleted meanwhile.
+	ConsumeEmailOTPAttempt(ctx context.Context, otp *EmailOTP, maxAttempts int) (bool, error)
+
+	// DeleteEmailOTP deletes the code of the user for the purpose
+	DeleteEmailOTP(ctx context.Context, user *User, purpose string) error
+}
+
+// WebAuthnRepository manage the WebAuthn credentials of users, security keys and passkeys, and the challenges of their ceremonies
+type WebAuthnRepository interface {
+	// SaveWebAuthnSession into webauthn session table, the expired sessions are deleted
+	SaveWebAuthnSession(ctx context.Context, session *WebAuthnSession) error
+
+	// ConsumeWebAuthnSession deletes and returns the session of the challenge, ErrDBNoResult if there is none
+	// or another request consumed it first
+	ConsumeWebAuthnSession(ctx context.Context, challenge string) (*WebAuthnSession, error)
+
+	// CreateWebAuthnCredential into webauthn credential table, its RecID and CreatedAt are assigned
+	CreateWebAuthnCredential(ctx context.Context, credential *WebAuthnCredential) error
+
+	// GetWebAuthnCredentialByRecID return a credential record, ErrDBNoResult if there is none
+	GetWebAuthnCredentialByRecID(ctx context.Context, recID string) (*WebAuthnCredential, error)
+
+	// GetWebAuthnCredentialByCredentialID return the credential of the base64url credential id, ErrDBNoResult if there is none
+	GetWebAuthnCredentialByCredentialID(ctx context.Context, credentialID string) (*WebAuthnCredential, error)
+
+	// ListWebAuthnCredentials list all credentials of a user ordered by creation time
+	ListWebAuthnCredentials(ctx context.Context, user *User) ([]*WebAuthnCredential, error)
+
+	// UpdateWebAuthnCredential updates the name, sign count and last use of the credential
+	UpdateWebAuthnCredential(ctx context.Context, credential *WebAuthnCredential) error
+
+	// DeleteWebAuthnCredential deletes the credential, it can not authenticate anymore
+	DeleteWebAuthnCredential(ctx context.Context, credential *WebAuthnCredential) error
+}
+
+// OutboxRepository manage the outbox of emails and events waiting to be delivered
+type OutboxRepository interface {
+	// CreateOutboxMessage into outbox table, its RecID and CreatedAt are assigned
+	CreateOutboxMessage(ctx context.Context, message *OutboxMessage) error
+
+	// GetOutboxMessageByRecID return an outbox message record
+	GetOutboxMessageByRecID(ctx context.Context, recID string) (*OutboxMessage, error)
+
+	// ListOutboxMessages list the outbox messages with pagination
+	ListOutboxMessages(ctx context.Context, request *helper.PageRequest) ([]*OutboxMessage, *helper.Page, error)
+
+	// ListDueOutboxMessages list up to limit pending messages whose next attempt is due, the oldest first
+	ListDueOutboxMessages(ctx context.Context, due time.Time, limit int) ([]*OutboxMessage, error)
+
+	// ClaimOutboxMessage postpones the next attempt of a pending message to until, so no other worker attempts it meanwhile.
+	// It returns false if the message was claimed or changed by another worker first.
+	ClaimOutboxMessage(ctx context.Context, message *OutboxMessage, until time.Time) (bool, error)
+
+	// UpdateOutboxMessage into outbox table
+	UpdateOutboxMessage(ctx context.Context, message *OutboxMessage) error
+}
+
+// WebhookRepository manage the webhook subscriptions of tenants and the deliveries of their events
+type WebhookRepository interface {
+	// CreateWebhook into webhook table, its RecID and CreatedAt are assigned
+	CreateWebhook(ctx context.Context, webhook *Webhook) error
+
+	// GetWebhookByRecID return a webhook record
+	GetWebhookByRecID(ctx context.Context, recID string) (*Webhook, error)
+
+	// ListWebhooks list all webhooks of a tenant ordered by creation time
+	ListWebhooks(ctx context.Context, tenant *Tenant) ([]*Webhook, error)
+
+	// UpdateWebhook into webhook table
+	UpdateWebhook(ctx context.Context, webhook *Webhook) error
+
+	// DeleteWebhook from webhook table, including its deliveries
+	DeleteWebhook(ctx context.Context, webhook *Webhook) error
+
+	// CreateWebhookDelivery into webhook delivery table, its RecID and CreatedAt are assigned
+	CreateWebhookDelivery(ctx context.Context, delivery *WebhookDelivery) error
+
+	// GetWebhookDeliveryByRecID return a webhook delivery record
+	GetWebhookDeliveryByRecID(ctx context.Context, recID string) (*WebhookDelivery, error)
+
+	// ListWebhookDeliveries list the deliveries of a webhook with pagination
+	ListWebhookDeliveries(ctx context.Context, webhook *Webhook, request *helper.PageRequest) ([]*WebhookDelivery, *helper.Page, error)
+
+	// ListDueWebhookDeliveries list up to limit pending deliveries whose next attempt is due, the oldest first
+	ListDueWebhookDeliveries(ctx context.Context, due time.Time, limit int) ([]*WebhookDelivery, error)
+
+	// ClaimWebhookDelivery postpones the next attempt of a pending delivery to until, so no other dispatcher attempts it meanwhile.
+	// It returns false if the delivery was claimed or changed by another dispatcher first.
+	ClaimWebhookDelivery(ctx context.Context, delivery *WebhookDelivery, until time.Time) (bool, error)
+
+	// UpdateWebhookDelivery into webhook delivery table
+	UpdateWebhookDelivery(ctx context.Context, delivery *WebhookDelivery) error
+}
+
+// InvitationRepository manage invitation table
+type InvitationRepository interface {
+	// GetInvitationByRecID return an invitation record
+	GetInvitationByRecID(ctx context.Context, recID string) (*Invitation, error)
+
+	// GetInvitationByTokenHash return an invitation record by the hash of its token
+	GetInvitationByTokenHash(ctx context.Context, tokenHash string) (*Invitation, error)
+
+	// CreateInvitation into the invitation table, storing the hash of its token
+	CreateInvitation(ctx context.Context, email string, tenant *Tenant, tokenHash string, groupRecIDs, roleRecIDs []string, invitedBy string, expireAt time.Time) (*Invitation, error)
+
+	// ListInvitations list all pending invitations of a tenant
+	ListInvitations(ctx context.Context, tenant *Tenant) ([]*Invitation, error)
+
+	// RenewInvitation replaces the token hash of an invitation and extends its expiry
+	RenewInvitation(ctx context.Context, invitation *Invitation, tokenHash string, expireAt time.Time) error
+
+	// DeleteInvitation removes an invitation, either revoked or accepted
+	DeleteInvitation(ctx context.Context, invitation *Invitation) error
+}
+
+// AuditRepository manage the append-only audit event table, events can never be changed nor removed
+type AuditRepository interface {
+	// AppendAuditEvent records a new audit event, its RecID and Seq are assigned
+	AppendAuditEvent(ctx context.Context, event *AuditEvent) error
+
+	// ListAuditEvents list audit events with pagination, limited to events of the tenant domains.
+	// nil domains list the events of all tenants.
+	ListAuditEvents(ctx context.Context, domains []string, request *helper.PageRequest) ([]*AuditEvent, *helper.Page, error)
+
+	// GetAuditChainHead returns the sequence and hash of the last event in the hash chain, 0 and empty if there is none.
+	GetAuditChainHead(ctx context.Context) (int64, string, error)
+
+	// VerifyAuditChain walks the hash chain from the first event and reports the first broken link.
+	// checkpoints maps sequence to the hash a signed checkpoint vouches for.
+	VerifyAuditChain(ctx context.Context, checkpoints map[int64]string) (*AuditChainReport, error)
+
+	// CreateAuditCheckpoint records a signed checkpoint of the hash chain, its RecID is assigned
+	CreateAuditCheckpoint(ctx context.Context, checkpoint *AuditCheckpoint) error
+
+	// ListAuditCheckpoints list all checkpoints ordered by sequence
+	ListAuditCheckpoints(ctx context.Context) ([]*AuditCheckpoint, error)
+}
+
 // RevocationRepository manage revocation table
 type RevocationRepository interface {
 	// Revoke a subject
@@ -227,6 +471,9 @@ type Tenant struct {
 
 	// TenantAdminRole role needed to manage users under this tenant
 	Domain string `json:"domain"`
+
+	// Version of the record, incremented on every update. Used for optimistic concurrency.
+	Version int `json:"version"`
 }
 
 // User record entity
@@ -267,14 +514,23 @@ type User struct {
 	// Enable2FactorAuth used for enabling 2 factor auth
 	Enable2FactorAuth bool `json:"enable_2_factor_auth"`
 
+	// Enable2FactorEmail is set when the user activated 2FA with codes mailed instead of an authenticator app
+	Enable2FactorEmail bool `json:"enable_2_factor_email"`
+
 	// Token2FA used to authenticate back using 2FA
 	Token2FA string `json:"token_2_fa"`
 
 	// RecoveryCode used to recover lost passphrase
 	RecoveryCode string `json:"recovery_code"`
 
+	// Locale the user reads emails in, eg. id or en-US, empty if unknown
+	Locale string `json:"locale"`
+
 	// The tenant owner
 	TenantRecId string `json:"tenant_rec_id"`
+
+	// Version of the record, incremented on every update. Used for optimistic concurrency.
+	Version int `json:"version"`
 }
 
 // TOTPRecoveryCode used to login the user if the user lost his TOTP code due to lost of 2FE token device.
@@ -308,6 +564,9 @@ type Group struct {
 
 	// The tenant owner
 	TenantRecId string `json:"tenant_rec_id"`
+
+	// Version of the record, incremented on every update. Used for optimistic concurrency.
+	Version int `json:"version"`
 }
 
 // UserGroup record entity
@@ -319,6 +578,15 @@ type UserGroup struct {
 	GroupRecID string `json:"group_rec_id"`
 }
 
+// UserTenant record entity
+type UserTenant struct {
+	// UserRecID composite key to User
+	UserRecID string `json:"user_rec_id"`
+
+	// TenantRecID composite key to Tenant
+	TenantRecID string `json:"tenant_rec_id"`
+}
+
 // UserRole record entity
 type UserRole struct {
 	// Email composite key to User
@@ -353,4 +621,420 @@ type Role struct {
 
 	// The tenant owner
 	TenantRecId string `json:"tenant_rec_id"`
+
+	// Version of the record, incremented on every update. Used for optimistic concurrency.
+	Version int `json:"version"`
+}
+
+// AttributeSchema record entity, a custom user attribute defined by a tenant
+type AttributeSchema struct {
+	// RecID. Primary key
+	RecID string `json:"rec_id"`
+
+	// TenantRecID the tenant owner
+	TenantRecID string `json:"tenant_rec_id"`
+
+	// Name of the attribute, unique within the tenant
+	Name string `json:"name"`
+
+	// Type of the attribute value, string, number, boolean or date
+	Type string `json:"type"`
+
+	// Required every user of the tenant must have the attribute
+	Required bool `json:"required"`
+
+	// Unique no two users may have the same value
+	Unique bool `json:"unique"`
+
+	// PII the value is personally identifiable information
+	PII bool `json:"pii"`
+
+	// Claim name of the token claim the value is copied into, empty if not copied
+	Claim string `json:"claim"`
+
+	// Description of the attribute
+	Description string `json:"description"`
+}
+
+// UserAttribute record entity, an attribute value of a user
+type UserAttribute struct {
+	// UserRecID composite key to User
+	UserRecID string `json:"user_rec_id"`
+
+	// AttributeRecID composite key to AttributeSchema
+	AttributeRecID string `json:"attribute_rec_id"`
+
+	// Value of the attribute in its text form
+	Value string `json:"value"`
+}
+
+// Invitation record entity, a pending invitation for a new user to join a tenant
+type Invitation struct {
+	// RecID. Primary key
+	RecID string `json:"rec_id"`
+
+	// Email address of the invitee
+	Email string `json:"email"`
+
+	// TenantRecID the tenant the invitee will join
+	TenantRecID string `json:"tenant_rec_id"`
+
+	// Token the secret the invitee uses to accept the invitation. It is only known when the invitation
+	// is created or renewed, to be mailed to the invitee, only its hash is stored.
+	Token string `json:"-"`
+
+	// TokenHash the hex SHA-256 of the token
+	TokenHash string `json:"-"`
+
+	// GroupRecIDs the groups the invitee will be member of
+	GroupRecIDs []string `json:"groups"`
+
+	// RoleRecIDs the roles the invitee will have
+	RoleRecIDs []string `json:"roles"`
+
+	// InvitedBy email of the admin who invited
+	InvitedBy string `json:"invited_by"`
+
+	// CreatedAt time of the invitation
+	CreatedAt time.Time `json:"created_at"`
+
+	// ExpireAt time the invitation can no longer be accepted
+	ExpireAt time.Time `json:"expire_at"`
+}
+
+// AuditChange the value of a field before and after an audited change
+type AuditChange struct {
+	// Before the value prior to the change, nil if the field did not exist
+	Before interface{} `json:"before"`
+
+	// After the value after the change, nil if the field was removed
+	After interface{} `json:"after"`
+}
+
+// AuditEvent record entity, an authentication or management event
+type AuditEvent struct {
+	// RecID. Primary key
+	RecID string `json:"rec_id"`
+
+	// Seq the order the event was recorded
+	Seq int64 `json:"seq"`
+
+	// Time the event happened
+	Time time.Time `json:"time"`
+
+	// Event type of the event, eg. user.create or auth.login
+	Event string `json:"event"`
+
+	// Outcome of the event, eg. success, failure or denied
+	Outcome string `json:"outcome"`
+
+	// Actor email of whoever caused the event
+	Actor string `json:"actor"`
+
+	// TargetType kind of the record the event is about, eg. user or role
+	TargetType string `json:"target_type"`
+
+	// Target the record id or the name of the record the event is about
+	Target string `json:"target"`
+
+	// TenantDomain the tenant domain the event belongs to
+	TenantDomain string `json:"tenant_domain"`
+
+	// ClientIP address of the client
+	ClientIP string `json:"client_ip"`
+
+	// RequestID of the request that caused the event
+	RequestID string `json:"request_id"`
+
+	// Changes the fields changed by the event
+	Changes map[string]*AuditChange `json:"changes,omitempty"`
+
+	// PrevHash the hash of the event recorded before this one, empty for the first event
+	PrevHash string `json:"prev_hash"`
+
+	// Hash of this event chained to PrevHash
+	Hash string `json:"hash"`
+}
+
+// AuditCheckpoint vouches for the hash chain up to a sequence, signed with the token signing key
+type AuditCheckpoint struct {
+	// RecID. Primary key
+	RecID string `json:"rec_id"`
+
+	// Seq of the last event covered by the checkpoint
+	Seq int64 `json:"seq"`
+
+	// Hash of the event at Seq
+	Hash string `json:"hash"`
+
+	// CreatedAt the time the checkpoint was made
+	CreatedAt time.Time `json:"created_at"`
+
+	// Signature JWT signed by the token signing key, carrying the seq and hash
+	Signature string `json:"signature"`
+}
+
+// AuditChainReport is the result of walking the audit hash chain
+type AuditChainReport struct {
+	// Verified true if no broken link was found
+	Verified bool `json:"verified"`
+
+	// Events number of events walked before the chain ended or broke
+	Events int64 `json:"events"`
+
+	// HeadSeq and HeadHash of the last event walked
+	HeadSeq  int64  `json:"head_seq"`
+	HeadHash string `json:"head_hash"`
+
+	// Checkpoints number of signed checkpoints matched
+	Checkpoints int `json:"checkpoints"`
+
+	// BrokenSeq and BrokenRecID of the first event found broken, zero if verified
+	BrokenSeq   int64  `json:"broken_seq,omitempty"`
+	BrokenRecID string `json:"broken_rec_id,omitempty"`
+
+	// Reason why the chain is broken
+	Reason string `json:"reason,omitempty"`
+}
+
+const (
+	// EmailOTPLogin codes are the second factor of an authentication
+	EmailOTPLogin = "login"
+	// EmailOTPActivation codes prove the user reads the mailbox before the email second factor is activated
+	EmailOTPActivation = "activation"
+)
+
+// EmailOTP is a one time code mailed to a user. Only the hash of the code is stored.
+type EmailOTP struct {
+	// UserRecID the user the code is mailed to
+	UserRecID string `json:"user_rec_id"`
+
+	// Purpose of the code, EmailOTPLogin or EmailOTPActivation
+	Purpose string `json:"purpose"`
+
+	// CodeHash the hex SHA-256 of the code
+	CodeHash string `json:"-"`
+
+	// Attempts made to verify the code
+	Attempts int `json:"attempts"`
+
+	// ExpireAt the code is no longer valid
+	ExpireAt time.Time `json:"expire_at"`
+
+	// SentAt the code was mailed, another code is not mailed before the resend interval passed
+	SentAt time.Time `json:"sent_at"`
+}
+
+const (
+	// WebAuthnRegistration ceremonies create a credential for the authenticated user
+	WebAuthnRegistration = "registration"
+	// WebAuthnSecondFactor ceremonies are the second factor of an authentication
+	WebAuthnSecondFactor = "2fa"
+	// WebAuthnLogin ceremonies authenticate a user without passphrase
+	WebAuthnLogin = "login"
+	// WebAuthnStepUp ceremonies prove the authenticated user holds a registered credential, before registering another
+	WebAuthnStepUp = "stepup"
+)
+
+// WebAuthnSession is a challenge waiting to be signed by an authenticator, it can be answered once
+type WebAuthnSession struct {
+	// Challenge the base64url challenge. Primary key
+	Challenge string `json:"challenge"`
+
+	// UserRecID the user the ceremony is for, empty for a passwordless login with a discoverable credential
+	UserRecID string `json:"user_rec_id"`
+
+	// Ceremony of the challenge, WebAuthnRegistration, WebAuthnSecondFactor, WebAuthnLogin or WebAuthnStepUp
+	Ceremony string `json:"ceremony"`
+
+	// ExpireAt the challenge can not be answered anymore
+	ExpireAt time.Time `json:"expire_at"`
+}
+
+// WebAuthnCredential record entity, a security key or a passkey of a user
+type WebAuthnCredential struct {
+	// RecID. Primary key
+	RecID string `json:"rec_id"`
+
+	// UserRecID the user the credential authenticates
+	UserRecID string `json:"user_rec_id"`
+
+	// Name given by the user, eg. YubiKey or Work laptop
+	Name string `json:"name"`
+
+	// CredentialID the base64url credential id, unique
+	CredentialID string `json:"credential_id"`
+
+	// PublicKey the COSE_Key of the credential
+	PublicKey []byte `json:"-"`
+
+	// Algorithm the COSE algorithm of the credential, eg. -7 for ES256
+	Algorithm int64 `json:"algorithm"`
+
+	// SignCount the last sign count of the authenticator
+	SignCount uint32 `json:"sign_count"`
+
+	// AAGUID the hex id of the authenticator model, zeros if unknown
+	AAGUID string `json:"aaguid"`
+
+	// Transports the authenticator is reached with, eg. usb or internal
+	Transports []string `json:"transports"`
+
+	// BackupEligible the credential may be synced to other devices, eg. a passkey
+	BackupEligible bool `json:"backup_eligible"`
+
+	// CreatedAt the credential was registered
+	CreatedAt time.Time `json:"created_at"`
+
+	// LastUsed the credential last authenticated the user, zero if it never did
+	LastUsed time.Time `json:"last_used"`
+}
+
+// EmailTemplate record entity, a version of the subject and body templates of an email of a tenant
+type EmailTemplate struct {
+	// RecID. Primary key
+	RecID string `json:"rec_id"`
+
+	// TenantRecID the tenant whose emails use the template
+	TenantRecID string `json:"tenant_rec_id"`
+
+	// TemplateKey the email the template is for, eg. EMAIL_VERIFY
+	TemplateKey string `json:"template_key"`
+
+	// Version of the template, starting at 1, the latest version is used
+	Version int `json:"version"`
+
+	// Subject template of the email
+	Subject string `json:"subject"`
+
+	// Body template of the email, in HTML
+	Body string `json:"body"`
+
+	// TextBody template of the plain text alternative of the body, empty if the email has none
+	TextBody string `json:"text_body"`
+
+	// CreatedBy the subject that saved this version
+	CreatedBy string `json:"created_by"`
+
+	// CreatedAt the time this version was saved
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// statuses of outbox messages
+const (
+	// OutboxPending is waiting for its next attempt
+	OutboxPending = "pending"
+	// OutboxSent was delivered
+	OutboxSent = "sent"
+	// OutboxDead ran out of attempts, it is kept until retried by an admin
+	OutboxDead = "dead"
+)
+
+// OutboxMessage record entity, an email or event stored with the change that caused it, waiting to be delivered
+type OutboxMessage struct {
+	// RecID. Primary key
+	RecID string `json:"rec_id"`
+
+	// Kind of the message, eg. email or event, it tells which deliverer delivers it
+	Kind string `json:"kind"`
+
+	// Payload the json content of the message
+	Payload string `json:"payload"`
+
+	// Status of the message, pending, sent or dead
+	Status string `json:"status"`
+
+	// Attempts made so far
+	Attempts int `json:"attempts"`
+
+	// NextAttemptAt the time of the next attempt while pending
+	NextAttemptAt time.Time `json:"next_attempt_at"`
+
+	// LastError of the last failed attempt
+	LastError string `json:"last_error"`
+
+	// RequestID of the request that caused the message
+	RequestID string `json:"request_id"`
+
+	// CreatedAt the time the message was created
+	CreatedAt time.Time `json:"created_at"`
+
+	// UpdatedAt the time the message was last attempted or changed
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// statuses of webhook deliveries
+const (
+	// WebhookDeliveryPending is waiting for its next attempt
+	WebhookDeliveryPending = "pending"
+	// WebhookDeliveryDelivered was accepted by the receiver
+	WebhookDeliveryDelivered = "delivered"
+	// WebhookDeliveryFailed ran out of attempts
+	WebhookDeliveryFailed = "failed"
+)
+
+// Webhook record entity, a tenant subscription to identity lifecycle events
+type Webhook struct {
+	// RecID. Primary key
+	RecID string `json:"rec_id"`
+
+	// TenantRecID the tenant whose events are delivered
+	TenantRecID string `json:"tenant_rec_id"`
+
+	// URL the events are posted to
+	URL string `json:"url"`
+
+	// Secret the payloads are signed with, shown only when the webhook is created
+	Secret string `json:"secret,omitempty"`
+
+	// Events the event types delivered, empty for every event type
+	Events []string `json:"events"`
+
+	// Enabled status of the webhook, disabled webhook receive no new delivery
+	Enabled bool `json:"enabled"`
+
+	// Description of the webhook
+	Description string `json:"description"`
+
+	// CreatedAt the time the webhook was created
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// WebhookDelivery record entity, an event posted or to be posted to a webhook
+type WebhookDelivery struct {
+	// RecID. Primary key
+	RecID string `json:"rec_id"`
+
+	// WebhookRecID the webhook the event is delivered to
+	WebhookRecID string `json:"webhook_rec_id"`
+
+	// EventID identifies the event, the same on every webhook and redelivery of the event
+	EventID string `json:"event_id"`
+
+	// EventType type of the event, eg. user.created
+	EventType string `json:"event_type"`
+
+	// Payload the json body posted
+	Payload string `json:"payload"`
+
+	// Status of the delivery, pending, delivered or failed
+	Status string `json:"status"`
+
+	// Attempts made so far
+	Attempts int `json:"attempts"`
+
+	// NextAttemptAt the time of the next attempt while pending
+	NextAttemptAt time.Time `json:"next_attempt_at"`
+
+	// ResponseStatus the http status of the last attempt, 0 if it got no response
+	ResponseStatus int `json:"response_status"`
+
+	// LastError of the last failed attempt
+	LastError string `json:"last_error"`
+
+	// CreatedAt the time the delivery was created
+	CreatedAt time.Time `json:"created_at"`
+
+	// UpdatedAt the time of the last attempt, or creation if none was made
+	UpdatedAt time.Time `json:"updated_at"`
 }
@@ -90,3 +90,22 @@ type ErrDBNoResult struct {
 func (err *ErrDBNoResult) Error() string {
 	return err.Message
 }
+
+// ErrDBInvalidFilter returned when a listing is requested with filter or order that is not allowed
+type ErrDBInvalidFilter struct {
+	Message string
+}
+
+func (err *ErrDBInvalidFilter) Error() string {
+	return err.Message
+}
+
+// ErrDBConflict returned when updating a record that has been changed by someone else since it was read
+type ErrDBConflict struct {
+	Message string
+	SQL     string
+}
+
+func (err *ErrDBConflict) Error() string {
+	return err.Message
+}
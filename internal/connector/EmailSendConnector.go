@@ -1,27 +1,23 @@
 package connector
 
 import (
-	"bytes"
 	"context"
-	"fmt"
+	"crypto/tls"
 	"github.com/sendgrid/sendgrid-go"
 	"github.com/sendgrid/sendgrid-go/helpers/mail"
 	"github.com/sirupsen/logrus"
-	"net/smtp"
 	"strings"
+	"sync"
+	"time"
 )
 
 var (
 	mailerLog = logrus.WithField("system", "mailer")
 )
 
-const (
-	mime = "MIME-version: 1.0;\nContent-Type: text/html; charset=\"UTF-8\";\n\n"
-)
-
-// EmailSender an email sender interface
+// EmailSender an email sender interface. The text body is the plain text alternative of the HTML body, it may be empty.
 type EmailSender interface {
-	SendEmail(ctx context.Context, to, cc, bcc []string, from, fromName, subject, body string) error
+	SendEmail(ctx context.Context, to, cc, bcc []string, from, fromName, subject, htmlBody, textBody string) error
 }
 
 // Recipients contains recipient map
@@ -52,20 +48,22 @@ type DummyMailSender struct {
 
 // DummyMail dummy email data structure
 type DummyMail struct {
-	From    string
-	To      string
-	Cc      string
-	Bcc     string
-	Subject string
-	Body    string
+	From     string
+	To       string
+	Cc       string
+	Bcc      string
+	Subject  string
+	Body     string
+	TextBody string
 }
 
 // SendEmail a dummy implementation, it just log out the email information.
-func (sender *DummyMailSender) SendEmail(ctx context.Context, to, cc, bcc []string, from, fromName, subject, body string) error {
+func (sender *DummyMailSender) SendEmail(ctx context.Context, to, cc, bcc []string, from, fromName, subject, htmlBody, textBody string) error {
 	sender.LastSentMail = &DummyMail{
-		From:    from,
-		Subject: subject,
-		Body:    body,
+		From:     from,
+		Subject:  subject,
+		Body:     htmlBody,
+		TextBody: textBody,
 	}
 	if to != nil {
 		sender.LastSentMail.To = strings.Join(to, ",")
@@ -79,49 +77,52 @@ func (sender *DummyMailSender) SendEmail(ctx context.Context, to, cc, bcc []stri
 	return nil
 }
 
-// SendMailSender send mail implementation using sendmail
+// SendMailSender send mail implementation using an SMTP server. The connections to the server are kept open
+// for the next emails, up to PoolSize of them, and closed once idle for IdleTimeout.
 type SendMailSender struct {
 	Host     string
 	Port     int
 	User     string
 	Password string
+	// TLS is NONE, OPPORTUNISTIC, STARTTLS or TLS, OPPORTUNISTIC if empty
+	TLS string
+	// CAFile is a PEM bundle of the certificate authorities trusted on top of the system ones
+	CAFile        string
+	TLSSkipVerify bool
+	// Auth is PLAIN, LOGIN, CRAM-MD5 or NONE, PLAIN if empty. The sender does not authenticate if User is empty.
+	Auth     string
+	HeloName string
+	// Timeout is the longest an email may take to be sent, the context deadline may be shorter
+	Timeout     time.Duration
+	PoolSize    int
+	IdleTimeout time.Duration
+
+	mutex   sync.Mutex
+	slots   chan struct{}
+	idle    []*smtpConn
+	tlsOnce sync.Once
+	tls     *tls.Config
+	tlsErr  error
 }
 
-// SendEmail implementation to send email using sendmail
-func (sender *SendMailSender) SendEmail(ctx context.Context, to, cc, bcc []string, from, fromName, subject, body string) error {
+// SendEmail implementation to send email using an SMTP server
+func (sender *SendMailSender) SendEmail(ctx context.Context, to, cc, bcc []string, from, fromName, subject, htmlBody, textBody string) error {
+	sendmailLog := mailerLog.WithField("mailer", "sendmail").WithField("mailto", strings.Join(to, ","))
 
-	auth := smtp.PlainAuth("", sender.User, sender.Password, sender.Host)
 	rec := &Recipients{
 		To: make(map[string]bool),
 	}
-	var bodyBuffer bytes.Buffer
-	if to != nil && len(to) > 0 {
-		rec.AddAll(to)
-		bodyBuffer.WriteString("To: ")
-		bodyBuffer.WriteString(strings.Join(to, ","))
-		bodyBuffer.WriteString("\r\n")
-	}
+	rec.AddAll(to)
+	rec.AddAll(cc)
+	rec.AddAll(bcc)
 
-	if cc != nil && len(cc) > 0 {
-		rec.AddAll(cc)
-		bodyBuffer.WriteString("Cc: ")
-		bodyBuffer.WriteString(strings.Join(cc, ","))
-		bodyBuffer.WriteString("\r\n")
-	}
-	if bcc != nil && len(bcc) > 0 {
-		rec.AddAll(bcc)
-		bodyBuffer.WriteString("\r\n")
+	message, err := buildMIMEMessage(from, fromName, to, cc, subject, htmlBody, textBody, time.Now())
+	if err != nil {
+		sendmailLog.Errorf("buildMIMEMessage got %s", err.Error())
+		return err
 	}
-	bodyBuffer.WriteString("Subject: ")
-	bodyBuffer.WriteString(subject)
-	bodyBuffer.WriteString("\r\n\r\n")
-	bodyBuffer.WriteString(mime)
-	bodyBuffer.WriteString("\r\n")
-	bodyBuffer.WriteString(body)
 
-	sendmailLog := mailerLog.WithField("mailer", "sendmail").WithField("mailto", strings.Join(to, ","))
-
-	err := smtp.SendMail(fmt.Sprintf("%s:%d", sender.Host, sender.Port), auth, from, rec.Recipients(), bodyBuffer.Bytes())
+	err = sender.send(ctx, from, rec.Recipients(), message)
 	if err != nil {
 		sendmailLog.Error(err)
 		return err
@@ -144,7 +145,7 @@ func getMailBoxName(email string) string {
 }
 
 // SendEmail email sending implementation using SendGrid
-func (sender *SendGridSender) SendEmail(ctx context.Context, to, cc, bcc []string, from, fromName, subject, body string) error {
+func (sender *SendGridSender) SendEmail(ctx context.Context, to, cc, bcc []string, from, fromName, subject, htmlBody, textBody string) error {
 	sendGridMail := mail.NewV3Mail()
 
 	persona := mail.NewPersonalization()
@@ -166,8 +167,11 @@ func (sender *SendGridSender) SendEmail(ctx context.Context, to, cc, bcc []strin
 	persona.Subject = subject
 	sendGridMail.AddPersonalizations(persona)
 
-	content := mail.NewContent("text/html", body)
-	sendGridMail.AddContent(content)
+	// sendgrid requires the plain text content before the html one
+	if len(textBody) > 0 {
+		sendGridMail.AddContent(mail.NewContent("text/plain", textBody))
+	}
+	sendGridMail.AddContent(mail.NewContent("text/html", htmlBody))
 
 	sendGridMail.SetFrom(mail.NewEmail(fromName, from))
 
@@ -0,0 +1,516 @@
+package connector
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hyperjumptech/hansip/pkg/helper"
+)
+
+// types of filterable column
+const (
+	columnString = iota
+	columnBool
+	columnInt
+	columnTime
+)
+
+// listColumn is a column that can be used to filter or order a listing
+type listColumn struct {
+	column   string
+	kind     int
+	sortable bool
+}
+
+var (
+	// tenantListColumns filterable and sortable columns of tenant listing
+	tenantListColumns = map[string]*listColumn{
+		"name":        {"TENANT_NAME", columnString, true},
+		"domain":      {"TENANT_DOMAIN", columnString, true},
+		"description": {"DESCRIPTION", columnString, false},
+	}
+
+	// userListColumns filterable and sortable columns of user listing
+	userListColumns = map[string]*listColumn{
+		"email":           {"EMAIL", columnString, true},
+		"enabled":         {"ENABLED", columnBool, true},
+		"suspended":       {"SUSPENDED", columnBool, true},
+		"enabled_2fa":     {"ENABLE_2FE", columnBool, true},
+		"fail_count":      {"FAIL_COUNT", columnInt, true},
+		"last_seen":       {"LAST_SEEN", columnTime, true},
+		"last_login":      {"LAST_LOGIN", columnTime, true},
+		"activation_date": {"ACTIVATION_DATE", columnTime, true},
+		"locale":          {"LOCALE", columnString, true},
+	}
+
+	// roleListColumns filterable and sortable columns of role listing
+	roleListColumns = map[string]*listColumn{
+		"role_name":   {"ROLE_NAME", columnString, true},
+		"role_domain": {"ROLE_DOMAIN", columnString, true},
+		"description": {"DESCRIPTION", columnString, false},
+	}
+
+	// groupListColumns filterable and sortable columns of group listing
+	groupListColumns = map[string]*listColumn{
+		"group_name":   {"GROUP_NAME", columnString, true},
+		"group_domain": {"GROUP_DOMAIN", columnString, true},
+		"description":  {"DESCRIPTION", columnString, false},
+	}
+
+	// auditListColumns filterable and sortable columns of audit event listing
+	auditListColumns = map[string]*listColumn{
+		"seq":           {"SEQ_NO", columnInt, true},
+		"time":          {"EVENT_TIME", columnTime, true},
+		"event":         {"EVENT_TYPE", columnString, true},
+		"outcome":       {"OUTCOME", columnString, true},
+		"actor":         {"ACTOR", columnString, true},
+		"target_type":   {"TARGET_TYPE", columnString, true},
+		"target":        {"TARGET_ID", columnString, true},
+		"tenant_domain": {"TENANT_DOMAIN", columnString, true},
+		"client_ip":     {"CLIENT_IP", columnString, true},
+		"request_id":    {"REQUEST_ID", columnString, true},
+	}
+
+	// webhookDeliveryListColumns filterable and sortable columns of webhook delivery listing
+	webhookDeliveryListColumns = map[string]*listColumn{
+		"created_at":      {"CREATED_AT", columnTime, true},
+		"event_type":      {"EVENT_TYPE", columnString, true},
+		"event_id":        {"EVENT_ID", columnString, true},
+		"status":          {"STATUS", columnString, true},
+		"attempts":        {"ATTEMPTS", columnInt, true},
+		"response_status": {"RESPONSE_STATUS", columnInt, true},
+		"next_attempt_at": {"NEXT_ATTEMPT_AT", columnTime, true},
+	}
+
+	// outboxListColumns filterable and sortable columns of outbox message listing
+	outboxListColumns = map[string]*listColumn{
+		"created_at":      {"CREATED_AT", columnTime, true},
+		"kind":            {"KIND", columnString, true},
+		"status":          {"STATUS", columnString, true},
+		"attempts":        {"ATTEMPTS", columnInt, true},
+		"next_attempt_at": {"NEXT_ATTEMPT_AT", columnTime, true},
+		"request_id":      {"REQUEST_ID", columnString, true},
+	}
+
+	likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+)
+
+// lookupListColumn finds the column by its field name or its column name
+func lookupListColumn(columns map[string]*listColumn, name string) (string, *listColumn) {
+	for field, col := range columns {
+		if strings.EqualFold(field, name) || strings.EqualFold(col.column, name) {
+			return field, col
+		}
+	}
+	return "", nil
+}
+
+func filterValue(col *listColumn, filter *helper.Filter) (interface{}, error) {
+	switch col.kind {
+	case columnBool:
+		b, err := strconv.ParseBool(filter.Value)
+		if err != nil {
+			return nil, err
+		}
+		if b {
+			return 1, nil
+		}
+		return 0, nil
+	case columnInt:
+		return strconv.Atoi(filter.Value)
+	case columnTime:
+		for _, layout := range []string{time.RFC3339, "2006-01-02 15:04:05", "2006-01-02"} {
+			if t, err := time.Parse(layout, filter.Value); err == nil {
+				return t.UTC().Format("2006-01-02 15:04:05"), nil
+			}
+		}
+		return nil, fmt.Errorf("expecting date in form of 2006-01-02 or RFC3339")
+	}
+	return filter.Value, nil
+}
+
+// listFilter builds additional WHERE conditions and their arguments from the filters of page request,
+// only allowing the whitelisted columns. The conditions are prefixed with " AND ".
+func listFilter(request *helper.PageRequest, columns map[string]*listColumn, prefix string) (string, []interface{}, error) {
+	where := &strings.Builder{}
+	args := make([]interface{}, 0)
+	for _, filter := range request.Filters {
+		field, col := lookupListColumn(columns, filter.Field)
+		if col == nil {
+			return "", nil, &ErrDBInvalidFilter{Message: fmt.Sprintf("field %s can not be filtered", filter.Field)}
+		}
+		value, err := filterValue(col, filter)
+		if err != nil {
+			return "", nil, &ErrDBInvalidFilter{Message: fmt.Sprintf("invalid value %s for field %s. %s", filter.Value, field, err.Error())}
+		}
+		operator := ""
+		switch filter.Operator {
+		case helper.FilterEqual:
+			operator = "="
+		case helper.FilterNotEqual:
+			operator = "<>"
+		case helper.FilterGreaterThan:
+			operator = ">"
+		case helper.FilterGreaterOrEqual:
+			operator = ">="
+		case helper.FilterLessThan:
+			operator = "<"
+		case helper.FilterLessOrEqual:
+			operator = "<="
+		case helper.FilterPrefix, helper.FilterContains:
+			if col.kind != columnString {
+				return "", nil, &ErrDBInvalidFilter{Message: fmt.Sprintf("operator %s is not applicable to field %s", filter.Operator, field)}
+			}
+			operator = "LIKE"
+			if filter.Operator == helper.FilterPrefix {
+				value = likeEscaper.Replace(filter.Value) + "%"
+			} else {
+				value = "%" + likeEscaper.Replace(filter.Value) + "%"
+			}
+		default:
+			return "", nil, &ErrDBInvalidFilter{Message: fmt.Sprintf("unknown filter operator %s", filter.Operator)}
+		}
+		if col.kind == columnBool && operator != "=" && operator != "<>" {
+			return "", nil, &ErrDBInvalidFilter{Message: fmt.Sprintf("operator %s is not applicable to field %s", filter.Operator, field)}
+		}
+		fmt.Fprintf(where, " AND %s%s %s ?", prefix, col.column, operator)
+		args = append(args, value)
+	}
+	return where.String(), args, nil
+}
+
+// listOrder resolves the column and direction the listing is ordered by, only allowing the whitelisted columns.
+func listOrder(orderBy, sort string, columns map[string]*listColumn, defaultOrder string) (string, string, error) {
+	orderColumn := defaultOrder
+	if len(orderBy) > 0 {
+		_, col := lookupListColumn(columns, orderBy)
+		if col == nil || !col.sortable {
+			return "", "", &ErrDBInvalidFilter{Message: fmt.Sprintf("field %s can not be sorted", orderBy)}
+		}
+		orderColumn = col.column
+	}
+	direction := strings.ToUpper(sort)
+	if len(direction) == 0 {
+		direction = "ASC"
+	}
+	if direction != "ASC" && direction != "DESC" {
+		return "", "", &ErrDBInvalidFilter{Message: fmt.Sprintf("invalid sort %s", sort)}
+	}
+	return orderColumn, direction, nil
+}
+
+// listItem is an entity that can be listed with keyset pagination
+type listItem interface {
+	// listKey returns the record id and the value of the column, formatted the same way filter values are.
+	listKey(column string) (string, string)
+}
+
+func (user *User) listKey(column string) (string, string) {
+	flag := func(b bool) string {
+		if b {
+			return "1"
+		}
+		return "0"
+	}
+	switch column {
+	case "ENABLED":
+		return user.RecID, flag(user.Enabled)
+	case "SUSPENDED":
+		return user.RecID, flag(user.Suspended)
+	case "ENABLE_2FE":
+		return user.RecID, flag(user.Enable2FactorAuth)
+	case "FAIL_COUNT":
+		return user.RecID, strconv.Itoa(user.FailCount)
+	case "LAST_SEEN":
+		return user.RecID, user.LastSeen.UTC().Format("2006-01-02 15:04:05")
+	case "LAST_LOGIN":
+		return user.RecID, user.LastLogin.UTC().Format("2006-01-02 15:04:05")
+	case "ACTIVATION_DATE":
+		return user.RecID, user.ActivationDate.UTC().Format("2006-01-02 15:04:05")
+	}
+	return user.RecID, user.Email
+}
+
+func (role *Role) listKey(column string) (string, string) {
+	switch column {
+	case "ROLE_DOMAIN":
+		return role.RecID, role.RoleDomain
+	case "DESCRIPTION":
+		return role.RecID, role.Description
+	}
+	return role.RecID, role.RoleName
+}
+
+func (group *Group) listKey(column string) (string, string) {
+	switch column {
+	case "GROUP_DOMAIN":
+		return group.RecID, group.GroupDomain
+	case "DESCRIPTION":
+		return group.RecID, group.Description
+	}
+	return group.RecID, group.GroupName
+}
+
+func (tenant *Tenant) listKey(column string) (string, string) {
+	switch column {
+	case "TENANT_DOMAIN":
+		return tenant.RecID, tenant.Domain
+	case "DESCRIPTION":
+		return tenant.RecID, tenant.Description
+	}
+	return tenant.RecID, tenant.Name
+}
+
+func (event *AuditEvent) listKey(column string) (string, string) {
+	switch column {
+	case "EVENT_TIME":
+		return event.RecID, event.Time.UTC().Format("2006-01-02 15:04:05")
+	case "EVENT_TYPE":
+		return event.RecID, event.Event
+	case "OUTCOME":
+		return event.RecID, event.Outcome
+	case "ACTOR":
+		return event.RecID, event.Actor
+	case "TARGET_TYPE":
+		return event.RecID, event.TargetType
+	case "TARGET_ID":
+		return event.RecID, event.Target
+	case "TENANT_DOMAIN":
+		return event.RecID, event.TenantDomain
+	case "CLIENT_IP":
+		return event.RecID, event.ClientIP
+	case "REQUEST_ID":
+		return event.RecID, event.RequestID
+	}
+	return event.RecID, strconv.FormatInt(event.Seq, 10)
+}
+
+func (delivery *WebhookDelivery) listKey(column string) (string, string) {
+	switch column {
+	case "EVENT_TYPE":
+		return delivery.RecID, delivery.EventType
+	case "EVENT_ID":
+		return delivery.RecID, delivery.EventID
+	case "STATUS":
+		return delivery.RecID, delivery.Status
+	case "ATTEMPTS":
+		return delivery.RecID, strconv.Itoa(delivery.Attempts)
+	case "RESPONSE_STATUS":
+		return delivery.RecID, strconv.Itoa(delivery.ResponseStatus)
+	case "NEXT_ATTEMPT_AT":
+		return delivery.RecID, delivery.NextAttemptAt.UTC().Format("2006-01-02 15:04:05")
+	}
+	return delivery.RecID, delivery.CreatedAt.UTC().Format("2006-01-02 15:04:05")
+}
+
+// listQuery holds the filter, ordering and pagination of a listing, either page number (offset) based
+// or keyset based when the page request use cursor.
+type listQuery struct {
+	request    *helper.PageRequest
+	prefix     string
+	column     string
+	sort       string
+	filter     string
+	filterArgs []interface{}
+	cursor     *helper.Cursor
+}
+
+// newListQuery validates the page request against the whitelisted columns.
+// alias is the table alias used in the query, it may be empty.
+func newListQuery(request *helper.PageRequest, columns map[string]*listColumn, alias, defaultOrder string) (*listQuery, error) {
+	q := &listQuery{request: request}
+	if len(alias) > 0 {
+		q.prefix = alias + "."
+	}
+	filter, args, err := listFilter(request, columns, q.prefix)
+	if err != nil {
+		return nil, err
+	}
+	q.filter, q.filterArgs = filter, args
+	orderBy, direction := request.OrderBy, request.Sort
+	if request.UseCursor {
+		if request.PageSize == 0 {
+			return nil, &ErrDBInvalidFilter{Message: "page size must be greater than zero"}
+		}
+		if len(request.Cursor) > 0 {
+			cursor, err := helper.DecodeCursor(request.Cursor)
+			if err != nil {
+				return nil, &ErrDBInvalidFilter{Message: err.Error()}
+			}
+			// the cursor carries the ordering it was made for
+			q.cursor = cursor
+			orderBy, direction = cursor.OrderBy, cursor.Sort
+		}
+	}
+	q.column, q.sort, err = listOrder(orderBy, direction, columns, defaultOrder)
+	if err != nil {
+		return nil, err
+	}
+	return q, nil
+}
+
+// backward true if the cursor goes toward previous items, the items are then fetched in reversed order.
+func (q *listQuery) backward() bool {
+	return q.cursor != nil && q.cursor.Backward
+}
+
+// ascending true if the items are fetched in ascending order
+func (q *listQuery) ascending() bool {
+	return (q.sort == "ASC") != q.backward()
+}
+
+// counted true if the listing need to count the total items.
+func (q *listQuery) counted() bool {
+	return !q.request.UseCursor || q.request.WithTotal
+}
+
+// where returns the filter conditions, followed by the keyset condition if there is a cursor.
+func (q *listQuery) where() string {
+	if q.cursor == nil {
+		return q.filter
+	}
+	operator := "<"
+	if q.ascending() {
+		operator = ">"
+	}
+	return fmt.Sprintf("%s AND (%s%s %s ? OR (%s%s = ? AND %sREC_ID %s ?))", q.filter, q.prefix, q.column, operator, q.prefix, q.column, q.prefix, operator)
+}
+
+// args returns the leading arguments followed by the arguments of where.
+func (q *listQuery) args(leading ...interface{}) []interface{} {
+	ret := append(append(make([]interface{}, 0), leading...), q.filterArgs...)
+	if q.cursor != nil {
+		ret = append(ret, q.cursor.Value, q.cursor.Value, q.cursor.RecID)
+	}
+	return ret
+}
+
+// countArgs returns the leading arguments followed by the arguments of filter, for counting the items.
+func (q *listQuery) countArgs(leading ...interface{}) []interface{} {
+	return append(append(make([]interface{}, 0), leading...), q.filterArgs...)
+}
+
+// orderBy returns the ORDER BY clause, REC_ID is always added to keep the order stable.
+func (q *listQuery) orderBy() string {
+	direction := "DESC"
+	if q.ascending() {
+		direction = "ASC"
+	}
+	return fmt.Sprintf("%s%s %s, %sREC_ID %s", q.prefix, q.column, direction, q.prefix, direction)
+}
+
+// page creates the page structure from the total items, count is ignored if not counted.
+func (q *listQuery) page(count int) *helper.Page {
+	if !q.request.UseCursor {
+		return helper.NewPage(q.request, uint(count))
+	}
+	if !q.counted() {
+		count = 0
+	}
+	return helper.NewCursorPage(q.request, uint(count))
+}
+
+// limit returns the LIMIT clause. keyset pagination fetch one more item to know if there is a next page.
+func (q *listQuery) limit(page *helper.Page) string {
+	if !q.request.UseCursor {
+		return fmt.Sprintf("%d, %d", page.OffsetStart, page.OffsetEnd-page.OffsetStart)
+	}
+	return strconv.Itoa(int(q.request.PageSize) + 1)
+}
+
+// paginate completes the page after the items are fetched. items is a slice of listItem fetched using limit,
+// it returns the number of items to keep. In keyset pagination the items are put back in their requested order
+// and the next and previous cursors are made.
+func (q *listQuery) paginate(page *helper.Page, items interface{}) int {
+	slice := reflect.ValueOf(items)
+	n := slice.Len()
+	if !q.request.UseCursor {
+		return n
+	}
+	more := n > int(q.request.PageSize)
+	if more {
+		n = int(q.request.PageSize)
+	}
+	if q.backward() {
+		swap := reflect.Swapper(slice.Slice(0, n).Interface())
+		for i, j := 0, n-1; i < j; i, j = i+1, j-1 {
+			swap(i, j)
+		}
+	}
+	hasNext, hasPrev := more, q.cursor != nil
+	if q.backward() {
+		hasNext, hasPrev = true, more
+	}
+	page.Items = uint(n)
+	if n > 0 && hasNext {
+		page.NextCursor = q.cursorOf(slice.Index(n-1).Interface().(listItem), false)
+	}
+	if n > 0 && hasPrev {
+		page.PrevCursor = q.cursorOf(slice.Index(0).Interface().(listItem), true)
+	}
+	page.HasNext = len(page.NextCursor) > 0
+	page.HasPrev = len(page.PrevCursor) > 0
+	page.IsFirst = !page.HasPrev
+	page.IsLast = !page.HasNext
+	return n
+}
+
+func (q *listQuery) cursorOf(item listItem, backward bool) string {
+	recID, value := item.listKey(q.column)
+	return (&helper.Cursor{
+		OrderBy:  q.column,
+		Sort:     q.sort,
+		Value:    value,
+		RecID:    recID,
+		Backward: backward,
+	}).Encode()
+}
+
+// window orders and paginates items that are listed in memory, the same way the database would.
+// Values are compared as strings. items is a slice of listItem and the returned slice is of the same type.
+func (q *listQuery) window(page *helper.Page, items interface{}) interface{} {
+	slice := reflect.ValueOf(items)
+	keys := make([][2]string, slice.Len())
+	less := func(a, b [2]string) bool {
+		if a[1] != b[1] {
+			return (a[1] < b[1]) == q.ascending()
+		}
+		if a[0] != b[0] {
+			return (a[0] < b[0]) == q.ascending()
+		}
+		return false
+	}
+	for i := 0; i < slice.Len(); i++ {
+		recID, value := slice.Index(i).Interface().(listItem).listKey(q.column)
+		keys[i] = [2]string{recID, value}
+	}
+	order := make([]int, slice.Len())
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return less(keys[order[i]], keys[order[j]])
+	})
+	sorted := reflect.MakeSlice(slice.Type(), slice.Len(), slice.Len())
+	start := 0
+	for i, idx := range order {
+		sorted.Index(i).Set(slice.Index(idx))
+		// skip items up to and including the cursor
+		if q.cursor != nil && !less([2]string{q.cursor.RecID, q.cursor.Value}, keys[idx]) {
+			start = i + 1
+		}
+	}
+	if !q.request.UseCursor {
+		return sorted.Slice(int(page.OffsetStart), int(page.OffsetEnd)).Interface()
+	}
+	end := start + int(q.request.PageSize) + 1
+	if end > sorted.Len() {
+		end = sorted.Len()
+	}
+	fetched := sorted.Slice(start, end)
+	return fetched.Slice(0, q.paginate(page, fetched.Interface())).Interface()
+}
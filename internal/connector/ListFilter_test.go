@@ -0,0 +1,152 @@
+package connector
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/hyperjumptech/hansip/pkg/helper"
+)
+
+func TestListQuery(t *testing.T) {
+	request := &helper.PageRequest{
+		No:       1,
+		PageSize: 10,
+		OrderBy:  "last_login",
+		Sort:     "desc",
+		Filters: []*helper.Filter{
+			{Field: "email", Operator: helper.FilterContains, Value: "50%_off"},
+			{Field: "enabled", Operator: helper.FilterEqual, Value: "true"},
+			{Field: "LAST_LOGIN", Operator: helper.FilterGreaterOrEqual, Value: "2020-01-02"},
+		},
+	}
+	query, err := newListQuery(request, userListColumns, "R", "EMAIL")
+	if err != nil {
+		t.Fatalf("error got %s", err.Error())
+	}
+	if query.where() != " AND R.EMAIL LIKE ? AND R.ENABLED = ? AND R.LAST_LOGIN >= ?" {
+		t.Errorf("unexpected where %s", query.where())
+	}
+	args := query.args("user")
+	if len(args) != 4 || args[0] != "user" || args[1] != `%50\%\_off%` || args[2] != 1 || args[3] != "2020-01-02 00:00:00" {
+		t.Errorf("unexpected args %v", args)
+	}
+	if query.orderBy() != "R.LAST_LOGIN DESC, R.REC_ID DESC" {
+		t.Errorf("unexpected order by %s", query.orderBy())
+	}
+	if !query.counted() {
+		t.Errorf("expect page number listing to be counted")
+	}
+	page := query.page(25)
+	if query.limit(page) != "0, 10" {
+		t.Errorf("unexpected limit %s", query.limit(page))
+	}
+
+	query, err = newListQuery(&helper.PageRequest{}, roleListColumns, "", "ROLE_NAME")
+	if err != nil {
+		t.Fatalf("error got %s", err.Error())
+	}
+	if query.where() != "" || len(query.args()) != 0 || query.orderBy() != "ROLE_NAME ASC, REC_ID ASC" {
+		t.Errorf("unexpected clause %s %v %s", query.where(), query.args(), query.orderBy())
+	}
+}
+
+func TestListQueryRejects(t *testing.T) {
+	requests := []*helper.PageRequest{
+		{Filters: []*helper.Filter{{Field: "hashed_passphrase", Operator: helper.FilterEqual, Value: "x"}}},
+		{Filters: []*helper.Filter{{Field: "enabled", Operator: helper.FilterGreaterThan, Value: "true"}}},
+		{Filters: []*helper.Filter{{Field: "enabled", Operator: helper.FilterEqual, Value: "maybe"}}},
+		{Filters: []*helper.Filter{{Field: "fail_count", Operator: helper.FilterContains, Value: "1"}}},
+		{Filters: []*helper.Filter{{Field: "email", Operator: "regex", Value: ".*"}}},
+		{OrderBy: "EMAIL; DROP TABLE HANSIP_USER"},
+		{Sort: "ASC, 1"},
+		{UseCursor: true, PageSize: 10, Cursor: "not a cursor"},
+		{UseCursor: true, PageSize: 10, Cursor: (&helper.Cursor{OrderBy: "HASHED_PASSPHRASE", Sort: "ASC", RecID: "x"}).Encode()},
+		{UseCursor: true, PageSize: 0},
+	}
+	for i, request := range requests {
+		_, err := newListQuery(request, userListColumns, "", "EMAIL")
+		var invalid *ErrDBInvalidFilter
+		if !errors.As(err, &invalid) {
+			t.Errorf("request %d expect ErrDBInvalidFilter but %v", i, err)
+		}
+	}
+}
+
+func TestListQueryCursor(t *testing.T) {
+	request := &helper.PageRequest{PageSize: 2, Sort: "ASC", UseCursor: true}
+	query, err := newListQuery(request, roleListColumns, "R", "ROLE_NAME")
+	if err != nil {
+		t.Fatalf("error got %s", err.Error())
+	}
+	if query.counted() {
+		t.Errorf("expect cursor listing not to be counted")
+	}
+	page := query.page(100)
+	if page.TotalItems != 0 || query.limit(page) != "3" {
+		t.Errorf("unexpected page %v limit %s", page, query.limit(page))
+	}
+	fetched := []*Role{{RecID: "1", RoleName: "a"}, {RecID: "2", RoleName: "b"}, {RecID: "3", RoleName: "c"}}
+	n := query.paginate(page, fetched)
+	if n != 2 || !page.HasNext || page.HasPrev || len(page.NextCursor) == 0 || len(page.PrevCursor) > 0 {
+		t.Fatalf("unexpected first page %d %v", n, page)
+	}
+
+	request.Cursor = page.NextCursor
+	query, err = newListQuery(request, roleListColumns, "R", "ROLE_NAME")
+	if err != nil {
+		t.Fatalf("error got %s", err.Error())
+	}
+	if query.where() != " AND (R.ROLE_NAME > ? OR (R.ROLE_NAME = ? AND R.REC_ID > ?))" {
+		t.Errorf("unexpected where %s", query.where())
+	}
+	if args := query.args(); !reflect.DeepEqual(args, []interface{}{"b", "b", "2"}) {
+		t.Errorf("unexpected args %v", args)
+	}
+	page = query.page(0)
+	fetched = []*Role{{RecID: "3", RoleName: "c"}}
+	n = query.paginate(page, fetched)
+	if n != 1 || page.HasNext || !page.HasPrev {
+		t.Fatalf("unexpected last page %d %v", n, page)
+	}
+
+	request.Cursor = page.PrevCursor
+	query, err = newListQuery(request, roleListColumns, "R", "ROLE_NAME")
+	if err != nil {
+		t.Fatalf("error got %s", err.Error())
+	}
+	if query.where() != " AND (R.ROLE_NAME < ? OR (R.ROLE_NAME = ? AND R.REC_ID < ?))" || query.orderBy() != "R.ROLE_NAME DESC, R.REC_ID DESC" {
+		t.Errorf("unexpected backward clause %s %s", query.where(), query.orderBy())
+	}
+	page = query.page(0)
+	fetched = []*Role{{RecID: "2", RoleName: "b"}, {RecID: "1", RoleName: "a"}}
+	n = query.paginate(page, fetched)
+	if n != 2 || fetched[0].RecID != "1" || !page.HasNext || page.HasPrev {
+		t.Fatalf("unexpected previous page %d %v %v", n, fetched, page)
+	}
+}
+
+func TestListQueryWindow(t *testing.T) {
+	roles := []*Role{{RecID: "3", RoleName: "c"}, {RecID: "1", RoleName: "a"}, {RecID: "4", RoleName: "b"}, {RecID: "2", RoleName: "b"}}
+	request := &helper.PageRequest{No: 2, PageSize: 2, Sort: "ASC"}
+	query, _ := newListQuery(request, roleListColumns, "R", "ROLE_NAME")
+	page := query.page(len(roles))
+	if got := query.window(page, roles).([]*Role); len(got) != 2 || got[0].RecID != "4" || got[1].RecID != "3" {
+		t.Errorf("unexpected page number window %v", got)
+	}
+
+	request = &helper.PageRequest{PageSize: 2, Sort: "ASC", UseCursor: true}
+	query, _ = newListQuery(request, roleListColumns, "R", "ROLE_NAME")
+	page = query.page(len(roles))
+	got := query.window(page, roles).([]*Role)
+	if len(got) != 2 || got[0].RecID != "1" || got[1].RecID != "2" || !page.HasNext {
+		t.Fatalf("unexpected first window %v %v", got, page)
+	}
+	request.Cursor = page.NextCursor
+	query, _ = newListQuery(request, roleListColumns, "R", "ROLE_NAME")
+	page = query.page(len(roles))
+	got = query.window(page, roles).([]*Role)
+	if len(got) != 2 || got[0].RecID != "4" || got[1].RecID != "3" || page.HasNext || !page.HasPrev {
+		t.Errorf("unexpected second window %v %v", got, page)
+	}
+}
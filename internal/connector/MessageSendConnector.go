@@ -0,0 +1,104 @@
+package connector
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	messageLog = logrus.WithField("system", "messenger")
+)
+
+const (
+	// MessageChannelSMS messages sent as SMS to a phone number
+	MessageChannelSMS = "sms"
+	// MessageChannelChat messages sent to a chat account, eg. a WhatsApp number or a Telegram chat id
+	MessageChannelChat = "chat"
+)
+
+// MessageSender a short message sender interface, for SMS and chat messages.
+// The recipient is a phone number or a chat account, depending on the channel.
+type MessageSender interface {
+	SendMessage(ctx context.Context, channel, to, text string) error
+}
+
+// DummyMessageSender a dummy message sender. It does not send any message, it keeps them in memory.
+type DummyMessageSender struct {
+	mutex    sync.Mutex
+	messages []*DummyMessage
+}
+
+// DummyMessage dummy message data structure
+type DummyMessage struct {
+	Channel string
+	To      string
+	Text    string
+}
+
+// SendMessage a dummy implementation, it just keeps the message.
+func (sender *DummyMessageSender) SendMessage(ctx context.Context, channel, to, text string) error {
+	sender.mutex.Lock()
+	defer sender.mutex.Unlock()
+	sender.messages = append(sender.messages, &DummyMessage{
+		Channel: channel,
+		To:      to,
+		Text:    text,
+	})
+	messageLog.WithField("messenger", "dummy").WithField("channel", channel).Debugf("message to %s kept", to)
+	return nil
+}
+
+// SentMessages returns the messages sent so far, the oldest first
+func (sender *DummyMessageSender) SentMessages() []*DummyMessage {
+	sender.mutex.Lock()
+	defer sender.mutex.Unlock()
+	ret := make([]*DummyMessage, len(sender.messages))
+	copy(ret, sender.messages)
+	return ret
+}
+
+// LastSentMessage returns the last message sent, nil if none was
+func (sender *DummyMessageSender) LastSentMessage() *DummyMessage {
+	sender.mutex.Lock()
+	defer sender.mutex.Unlock()
+	if len(sender.messages) == 0 {
+		return nil
+	}
+	return sender.messages[len(sender.messages)-1]
+}
+
+// WebhookMessage is the json body posted by WebhookMessageSender
+type WebhookMessage struct {
+	Channel string `json:"channel"`
+	To      string `json:"to"`
+	Text    string `json:"text"`
+}
+
+// WebhookMessageSender sends messages by posting them to an HTTP endpoint, eg. a small service relaying them
+// to an SMS gateway or a chat bot. The body is signed with SignedPost, like the tenant webhooks.
+type WebhookMessageSender struct {
+	URL    string
+	Secret string
+	// Client posts the messages, one with DefaultPostTimeout if nil. The context deadline limits every post as well.
+	Client *http.Client
+}
+
+// SendMessage posts the message, it fails unless the endpoint responds with 2xx
+func (sender *WebhookMessageSender) SendMessage(ctx context.Context, channel, to, text string) error {
+	webhookLog := messageLog.WithField("messenger", "webhook").WithField("channel", channel)
+	body, err := json.Marshal(&WebhookMessage{Channel: channel, To: to, Text: text})
+	if err != nil {
+		return err
+	}
+	_, err = SignedPost(ctx, sender.Client, sender.URL, "Hansip-Messenger", sender.Secret, nil, body)
+	if err != nil {
+		webhookLog.Errorf("error while sending message. got %s", err.Error())
+		return err
+	}
+	webhookLog.Debug("send message success")
+	return nil
+}
@@ -0,0 +1,65 @@
+package connector
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestDummyMessageSender(t *testing.T) {
+	sender := &DummyMessageSender{}
+	if sender.LastSentMessage() != nil {
+		t.Error("expected no message yet")
+	}
+	sender.SendMessage(context.Background(), MessageChannelSMS, "+6281234567890", "first")
+	sender.SendMessage(context.Background(), MessageChannelChat, "12345", "second")
+	if last := sender.LastSentMessage(); last.Channel != MessageChannelChat || last.To != "12345" || last.Text != "second" {
+		t.Errorf("unexpected last message %+v", last)
+	}
+	if sent := sender.SentMessages(); len(sent) != 2 || sent[0].Text != "first" {
+		t.Errorf("unexpected messages %v", sent)
+	}
+}
+
+func TestWebhookMessageSender(t *testing.T) {
+	var received *WebhookMessage
+	var header http.Header
+	var body []byte
+	status := http.StatusAccepted
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header
+		body, _ = ioutil.ReadAll(r.Body)
+		received = &WebhookMessage{}
+		json.Unmarshal(body, received)
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	sender := &WebhookMessageSender{URL: server.URL, Secret: "s3cret"}
+	if err := sender.SendMessage(context.Background(), MessageChannelSMS, "+6281234567890", "Your code is 123456"); err != nil {
+		t.Fatal(err)
+	}
+	if received.Channel != MessageChannelSMS || received.To != "+6281234567890" || received.Text != "Your code is 123456" {
+		t.Errorf("unexpected message %+v", received)
+	}
+	if header.Get("X-Hansip-Signature") != "sha256="+PayloadSignature("s3cret", header.Get("X-Hansip-Timestamp"), body) {
+		t.Errorf("unexpected signature %s", header.Get("X-Hansip-Signature"))
+	}
+
+	status = http.StatusBadGateway
+	if err := sender.SendMessage(context.Background(), MessageChannelSMS, "+6281234567890", "again"); err == nil {
+		t.Error("expected a failing endpoint to fail the message")
+	}
+
+	sender.Secret = ""
+	status = http.StatusOK
+	if err := sender.SendMessage(context.Background(), MessageChannelChat, "12345", "unsigned"); err != nil {
+		t.Fatal(err)
+	}
+	if len(header.Get("X-Hansip-Signature")) > 0 {
+		t.Error("expected no signature without secret")
+	}
+}
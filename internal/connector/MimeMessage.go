@@ -0,0 +1,107 @@
+package connector
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hyperjumptech/hansip/pkg/helper"
+)
+
+// headerSanitizer removes the line breaks that would let a value inject headers
+var headerSanitizer = strings.NewReplacer("\r", "", "\n", "")
+
+// writeHeader writes a header line
+func writeHeader(buf *bytes.Buffer, key, value string) {
+	buf.WriteString(key)
+	buf.WriteString(": ")
+	buf.WriteString(headerSanitizer.Replace(value))
+	buf.WriteString("\r\n")
+}
+
+// formatAddresses returns the addresses joined for an address list header
+func formatAddresses(addresses []string) string {
+	formatted := make([]string, len(addresses))
+	for i, address := range addresses {
+		formatted[i] = (&mail.Address{Address: address}).String()
+	}
+	return strings.Join(formatted, ", ")
+}
+
+// messageID returns an unique Message-ID in the domain of the sender
+func messageID(from string, date time.Time) string {
+	domain := "hansip"
+	if i := strings.LastIndex(from, "@"); i >= 0 && i < len(from)-1 {
+		domain = from[i+1:]
+	}
+	return fmt.Sprintf("<%s.%s@%s>", strconv.FormatInt(date.UnixNano(), 36), helper.MakeRandomString(16, true, true, true, false), domain)
+}
+
+// writeQuotedPrintable writes the text quoted-printable encoded, keeping lines short and 8 bit characters safe
+func writeQuotedPrintable(w io.Writer, text string) error {
+	qp := quotedprintable.NewWriter(w)
+	if _, err := qp.Write([]byte(text)); err != nil {
+		return err
+	}
+	return qp.Close()
+}
+
+// buildMIMEMessage builds the RFC 5322 message of an email. The HTML body comes with its plain text alternative
+// in a multipart/alternative message if the text body is not empty. The subject and the sender name are RFC 2047 encoded.
+// The blind carbon copy recipients are not part of the message, they only go to the SMTP envelope.
+func buildMIMEMessage(from, fromName string, to, cc []string, subject, htmlBody, textBody string, date time.Time) ([]byte, error) {
+	var buf bytes.Buffer
+	writeHeader(&buf, "From", (&mail.Address{Name: fromName, Address: from}).String())
+	if len(to) > 0 {
+		writeHeader(&buf, "To", formatAddresses(to))
+	}
+	if len(cc) > 0 {
+		writeHeader(&buf, "Cc", formatAddresses(cc))
+	}
+	writeHeader(&buf, "Subject", mime.QEncoding.Encode("utf-8", subject))
+	writeHeader(&buf, "Date", date.Format(time.RFC1123Z))
+	writeHeader(&buf, "Message-ID", messageID(from, date))
+	writeHeader(&buf, "MIME-Version", "1.0")
+
+	if len(textBody) == 0 {
+		writeHeader(&buf, "Content-Type", mime.FormatMediaType("text/html", map[string]string{"charset": "UTF-8"}))
+		writeHeader(&buf, "Content-Transfer-Encoding", "quoted-printable")
+		buf.WriteString("\r\n")
+		if err := writeQuotedPrintable(&buf, htmlBody); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+
+	parts := multipart.NewWriter(&buf)
+	writeHeader(&buf, "Content-Type", mime.FormatMediaType("multipart/alternative", map[string]string{"boundary": parts.Boundary()}))
+	buf.WriteString("\r\n")
+	// the last part is the preferred one
+	for _, part := range []struct {
+		mediaType string
+		body      string
+	}{{"text/plain", textBody}, {"text/html", htmlBody}} {
+		w, err := parts.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {mime.FormatMediaType(part.mediaType, map[string]string{"charset": "UTF-8"})},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		if err := writeQuotedPrintable(w, part.body); err != nil {
+			return nil, err
+		}
+	}
+	if err := parts.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
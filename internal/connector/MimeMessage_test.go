@@ -0,0 +1,99 @@
+package connector
+
+import (
+	"bytes"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBuildMIMEMessageMultipart(t *testing.T) {
+	date := time.Date(2021, 3, 4, 5, 6, 7, 0, time.UTC)
+	raw, err := buildMIMEMessage("hansip@example.com", "Hansip Ünïcode", []string{"a@example.com"}, []string{"b@example.com"},
+		"Selamat datang – welcome", "<html><body>Hello</body></html>", "Hello", date)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(raw, []byte("Bcc")) {
+		t.Error("message must not carry a Bcc header")
+	}
+	msg, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	from, err := msg.Header.AddressList("From")
+	if err != nil || len(from) != 1 || from[0].Name != "Hansip Ünïcode" || from[0].Address != "hansip@example.com" {
+		t.Errorf("unexpected From %v, %v", from, err)
+	}
+	subject, err := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	if err != nil || subject != "Selamat datang – welcome" {
+		t.Errorf("unexpected Subject %q, %v", subject, err)
+	}
+	if d, err := msg.Header.Date(); err != nil || !d.Equal(date) {
+		t.Errorf("unexpected Date %v, %v", d, err)
+	}
+	if id := msg.Header.Get("Message-ID"); !strings.HasPrefix(id, "<") || !strings.HasSuffix(id, "@example.com>") {
+		t.Errorf("unexpected Message-ID %s", id)
+	}
+	if cc := msg.Header.Get("Cc"); cc != "<b@example.com>" {
+		t.Errorf("unexpected Cc %s", cc)
+	}
+
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/alternative" {
+		t.Fatalf("unexpected Content-Type %s, %v", mediaType, err)
+	}
+	reader := multipart.NewReader(msg.Body, params["boundary"])
+	expected := []struct {
+		mediaType string
+		body      string
+	}{{"text/plain", "Hello"}, {"text/html", "<html><body>Hello</body></html>"}}
+	for _, exp := range expected {
+		part, err := reader.NextRawPart()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if mt, _, _ := mime.ParseMediaType(part.Header.Get("Content-Type")); mt != exp.mediaType {
+			t.Errorf("expected part %s but %s", exp.mediaType, mt)
+		}
+		body, err := ioutil.ReadAll(quotedprintable.NewReader(part))
+		if err != nil || string(body) != exp.body {
+			t.Errorf("expected part body %q but %q, %v", exp.body, body, err)
+		}
+	}
+	if _, err := reader.NextPart(); err == nil {
+		t.Error("expected only two parts")
+	}
+}
+
+func TestBuildMIMEMessageHTMLOnly(t *testing.T) {
+	html := "<html><body>" + strings.Repeat("a very long line ", 20) + "é</body></html>"
+	raw, err := buildMIMEMessage("hansip@example.com", "", []string{"a@example.com"}, nil, "Hi\r\nBcc: evil@example.com", html, "", time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msg.Header.Get("Bcc")) > 0 {
+		t.Error("subject must not inject headers")
+	}
+	if mt, _, _ := mime.ParseMediaType(msg.Header.Get("Content-Type")); mt != "text/html" {
+		t.Errorf("unexpected Content-Type %s", mt)
+	}
+	for _, line := range strings.Split(string(raw), "\r\n") {
+		if len(line) > 78 {
+			t.Errorf("line longer than 78 characters: %s", line)
+		}
+	}
+	body, err := ioutil.ReadAll(quotedprintable.NewReader(msg.Body))
+	if err != nil || string(body) != html {
+		t.Errorf("expected body %q but %q, %v", html, body, err)
+	}
+}
@@ -2,14 +2,19 @@ package connector
 
 import (
 	"context"
+	"crypto/sha256"
 	"database/sql"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
+	"math"
 	"regexp"
 
 	"github.com/hyperjumptech/hansip/pkg/store/cache"
 
 	// Initializes mysql driver
-	"sort"
+	"strings"
+	"sync/atomic"
 	"time"
 
 	_ "github.com/go-sql-driver/mysql"
@@ -23,7 +28,7 @@ import (
 
 const (
 	// DropAllSQL contains SQL to drop all existing table for hansip
-	DropAllSQL = `DROP TABLE IF EXISTS HANSIP_REVOCATION, HANSIP_TOTP_RECOVERY_CODES, HANSIP_USER_GROUP, HANSIP_USER_ROLE, HANSIP_GROUP_ROLE, HANSIP_USER, HANSIP_GROUP, HANSIP_ROLE, HANSIP_TENANT;`
+	DropAllSQL = `DROP TABLE IF EXISTS HANSIP_WEBAUTHN_SESSION, HANSIP_WEBAUTHN_CREDENTIAL, HANSIP_EMAIL_OTP, HANSIP_EMAIL_TEMPLATE, HANSIP_OUTBOX, HANSIP_AUDIT_CHECKPOINT, HANSIP_AUDIT_HEAD, HANSIP_AUDIT_EVENT, HANSIP_WEBHOOK_DELIVERY, HANSIP_WEBHOOK, HANSIP_INVITATION, HANSIP_USER_ATTRIBUTE, HANSIP_ATTRIBUTE_SCHEMA, HANSIP_REVOCATION, HANSIP_TOTP_RECOVERY_CODES, HANSIP_USER_TENANT, HANSIP_USER_GROUP, HANSIP_USER_ROLE, HANSIP_GROUP_ROLE, HANSIP_USER, HANSIP_GROUP, HANSIP_ROLE, HANSIP_TENANT_SETTING, HANSIP_TENANT;`
 
 	// CreateTenantSQL contains SQL to create HANSIP_ROLE table
 	CreateTenantSQL = `CREATE TABLE IF NOT EXISTS HANSIP_TENANT (
@@ -31,10 +36,20 @@ const (
     TENANT_NAME VARCHAR(128) NOT NULL UNIQUE,
     TENANT_DOMAIN VARCHAR(255),
     DESCRIPTION VARCHAR(255),
+    VERSION INT NOT NULL DEFAULT 0,
     INDEX (REC_ID, TENANT_NAME),
     PRIMARY KEY (REC_ID)
 ) ENGINE=INNODB;`
 
+	// CreateTenantSettingSQL contains SQL to create HANSIP_TENANT_SETTING table
+	CreateTenantSettingSQL = `CREATE TABLE IF NOT EXISTS HANSIP_TENANT_SETTING (
+    TENANT_REC_ID VARCHAR(32) NOT NULL,
+    SETTING_KEY VARCHAR(128) NOT NULL,
+    SETTING_VALUE TEXT,
+    PRIMARY KEY (TENANT_REC_ID, SETTING_KEY),
+    FOREIGN KEY (TENANT_REC_ID) REFERENCES HANSIP_TENANT(REC_ID) ON DELETE CASCADE
+) ENGINE=INNODB;`
+
 	// CreateUserSQL will create HANSIP_USER table
 	CreateUserSQL = `CREATE TABLE IF NOT EXISTS HANSIP_USER (
     REC_ID VARCHAR(32) NOT NULL UNIQUE,
@@ -49,8 +64,11 @@ const (
     ACTIVATION_DATE DATETIME,
     TOTP_KEY VARCHAR(64),
     ENABLE_2FE TINYINT(1) UNSIGNED DEFAULT 0,
+    EMAIL_2FE TINYINT(1) UNSIGNED DEFAULT 0,
     TOKEN_2FE VARCHAR(10),
     RECOVERY_CODE VARCHAR (20),
+    LOCALE VARCHAR(16) NOT NULL DEFAULT '',
+    VERSION INT NOT NULL DEFAULT 0,
     INDEX (REC_ID, EMAIL),
     PRIMARY KEY (REC_ID)
 ) ENGINE=INNODB;`
@@ -60,6 +78,7 @@ const (
     GROUP_NAME VARCHAR(128) NOT NULL,
     GROUP_DOMAIN VARCHAR(128) NOT NULL,
     DESCRIPTION VARCHAR(255),
+    VERSION INT NOT NULL DEFAULT 0,
     INDEX (REC_ID, GROUP_NAME, GROUP_DOMAIN),
     UNIQUE (GROUP_NAME, GROUP_DOMAIN),
     PRIMARY KEY (REC_ID)
@@ -70,6 +89,7 @@ const (
     ROLE_NAME VARCHAR(128) NOT NULL,
     ROLE_DOMAIN VARCHAR(128) NOT NULL,
     DESCRIPTION VARCHAR(255),
+    VERSION INT NOT NULL DEFAULT 0,
     INDEX (REC_ID, ROLE_NAME),
     UNIQUE (ROLE_NAME, ROLE_DOMAIN),
     PRIMARY KEY (REC_ID)
@@ -89,6 +109,14 @@ const (
     PRIMARY KEY (USER_REC_ID,GROUP_REC_ID),
     FOREIGN KEY (USER_REC_ID) REFERENCES HANSIP_USER(REC_ID) ON DELETE CASCADE,
     FOREIGN KEY (GROUP_REC_ID) REFERENCES HANSIP_GROUP(REC_ID) ON DELETE CASCADE
+) ENGINE=INNODB;`
+	// CreateUserTenantSQL contains SQL to create HANSIP_USER_TENANT table
+	CreateUserTenantSQL = `CREATE TABLE IF NOT EXISTS HANSIP_USER_TENANT (
+    USER_REC_ID VARCHAR(32) NOT NULL,
+    TENANT_REC_ID VARCHAR(32) NOT NULL,
+    PRIMARY KEY (USER_REC_ID,TENANT_REC_ID),
+    FOREIGN KEY (USER_REC_ID) REFERENCES HANSIP_USER(REC_ID) ON DELETE CASCADE,
+    FOREIGN KEY (TENANT_REC_ID) REFERENCES HANSIP_TENANT(REC_ID) ON DELETE CASCADE
 ) ENGINE=INNODB;`
 	// CreateGroupRoleSQL contains SQL to create HANSIP_GROUP_ROLE table
 	CreateGroupRoleSQL = `CREATE TABLE IF NOT EXISTS HANSIP_GROUP_ROLE (
@@ -106,6 +134,185 @@ const (
     USER_REC_ID VARCHAR(32) NOT NULL,
     PRIMARY KEY (REC_ID),
     FOREIGN KEY (USER_REC_ID) REFERENCES HANSIP_USER(REC_ID) ON DELETE CASCADE
+) ENGINE=INNODB;`
+	// CreateAttributeSchemaSQL contains SQL to create HANSIP_ATTRIBUTE_SCHEMA table
+	CreateAttributeSchemaSQL = `CREATE TABLE IF NOT EXISTS HANSIP_ATTRIBUTE_SCHEMA (
+    REC_ID VARCHAR(32) NOT NULL UNIQUE,
+    TENANT_REC_ID VARCHAR(32) NOT NULL,
+    ATTRIBUTE_NAME VARCHAR(128) NOT NULL,
+    ATTRIBUTE_TYPE VARCHAR(16) NOT NULL,
+    REQUIRED_FLAG TINYINT(1) UNSIGNED DEFAULT 0,
+    UNIQUE_FLAG TINYINT(1) UNSIGNED DEFAULT 0,
+    PII_FLAG TINYINT(1) UNSIGNED DEFAULT 0,
+    CLAIM_NAME VARCHAR(128),
+    DESCRIPTION VARCHAR(255),
+    UNIQUE (TENANT_REC_ID, ATTRIBUTE_NAME),
+    PRIMARY KEY (REC_ID),
+    FOREIGN KEY (TENANT_REC_ID) REFERENCES HANSIP_TENANT(REC_ID) ON DELETE CASCADE
+) ENGINE=INNODB;`
+	// CreateUserAttributeSQL contains SQL to create HANSIP_USER_ATTRIBUTE table
+	CreateUserAttributeSQL = `CREATE TABLE IF NOT EXISTS HANSIP_USER_ATTRIBUTE (
+    USER_REC_ID VARCHAR(32) NOT NULL,
+    ATTRIBUTE_REC_ID VARCHAR(32) NOT NULL,
+    ATTRIBUTE_VALUE TEXT,
+    PRIMARY KEY (USER_REC_ID, ATTRIBUTE_REC_ID),
+    FOREIGN KEY (USER_REC_ID) REFERENCES HANSIP_USER(REC_ID) ON DELETE CASCADE,
+    FOREIGN KEY (ATTRIBUTE_REC_ID) REFERENCES HANSIP_ATTRIBUTE_SCHEMA(REC_ID) ON DELETE CASCADE
+) ENGINE=INNODB;`
+	// CreateInvitationSQL contains SQL to create HANSIP_INVITATION table
+	CreateInvitationSQL = `CREATE TABLE IF NOT EXISTS HANSIP_INVITATION (
+    REC_ID VARCHAR(32) NOT NULL UNIQUE,
+    EMAIL VARCHAR(128) NOT NULL,
+    TENANT_REC_ID VARCHAR(32) NOT NULL,
+    TOKEN VARCHAR(64) NOT NULL UNIQUE,
+    GROUP_REC_IDS TEXT,
+    ROLE_REC_IDS TEXT,
+    INVITED_BY VARCHAR(128),
+    CREATED_AT DATETIME,
+    EXPIRE_AT DATETIME,
+    UNIQUE (EMAIL, TENANT_REC_ID),
+    PRIMARY KEY (REC_ID),
+    FOREIGN KEY (TENANT_REC_ID) REFERENCES HANSIP_TENANT(REC_ID) ON DELETE CASCADE
+) ENGINE=INNODB;`
+	// CreateWebhookSQL contains SQL to create HANSIP_WEBHOOK table
+	CreateWebhookSQL = `CREATE TABLE IF NOT EXISTS HANSIP_WEBHOOK (
+    REC_ID VARCHAR(32) NOT NULL UNIQUE,
+    TENANT_REC_ID VARCHAR(32) NOT NULL,
+    URL VARCHAR(2048) NOT NULL,
+    SECRET VARCHAR(128) NOT NULL,
+    EVENT_TYPES TEXT,
+    ENABLED TINYINT(1) NOT NULL DEFAULT 1,
+    DESCRIPTION VARCHAR(255),
+    CREATED_AT DATETIME,
+    PRIMARY KEY (REC_ID),
+    FOREIGN KEY (TENANT_REC_ID) REFERENCES HANSIP_TENANT(REC_ID) ON DELETE CASCADE
+) ENGINE=INNODB;`
+	// CreateWebhookDeliverySQL contains SQL to create HANSIP_WEBHOOK_DELIVERY table
+	CreateWebhookDeliverySQL = `CREATE TABLE IF NOT EXISTS HANSIP_WEBHOOK_DELIVERY (
+    REC_ID VARCHAR(32) NOT NULL UNIQUE,
+    WEBHOOK_REC_ID VARCHAR(32) NOT NULL,
+    EVENT_ID VARCHAR(32) NOT NULL,
+    EVENT_TYPE VARCHAR(64) NOT NULL,
+    PAYLOAD TEXT,
+    STATUS VARCHAR(16) NOT NULL,
+    ATTEMPTS INT NOT NULL DEFAULT 0,
+    NEXT_ATTEMPT_AT DATETIME NOT NULL,
+    RESPONSE_STATUS INT NOT NULL DEFAULT 0,
+    LAST_ERROR TEXT,
+    CREATED_AT DATETIME NOT NULL,
+    UPDATED_AT DATETIME NOT NULL,
+    PRIMARY KEY (REC_ID),
+    INDEX (STATUS, NEXT_ATTEMPT_AT),
+    FOREIGN KEY (WEBHOOK_REC_ID) REFERENCES HANSIP_WEBHOOK(REC_ID) ON DELETE CASCADE
+) ENGINE=INNODB;`
+	// CreateAuditEventSQL contains SQL to create HANSIP_AUDIT_EVENT table
+	CreateAuditEventSQL = `CREATE TABLE IF NOT EXISTS HANSIP_AUDIT_EVENT (
+    REC_ID VARCHAR(32) NOT NULL UNIQUE,
+    SEQ_NO BIGINT NOT NULL AUTO_INCREMENT UNIQUE,
+    EVENT_TIME DATETIME NOT NULL,
+    EVENT_TYPE VARCHAR(64) NOT NULL,
+    OUTCOME VARCHAR(16) NOT NULL,
+    ACTOR VARCHAR(128),
+    TARGET_TYPE VARCHAR(32),
+    TARGET_ID VARCHAR(255),
+    TENANT_DOMAIN VARCHAR(255),
+    CLIENT_IP VARCHAR(64),
+    REQUEST_ID VARCHAR(64),
+    CHANGES TEXT,
+    PREV_HASH CHAR(64) NOT NULL DEFAULT '',
+    HASH CHAR(64) NOT NULL DEFAULT '',
+    PRIMARY KEY (REC_ID),
+    INDEX (EVENT_TIME),
+    INDEX (TENANT_DOMAIN)
+) ENGINE=INNODB;`
+	// CreateAuditHeadSQL contains SQL to create HANSIP_AUDIT_HEAD table, its single row is the last event of the hash chain
+	CreateAuditHeadSQL = `CREATE TABLE IF NOT EXISTS HANSIP_AUDIT_HEAD (
+    ID INT NOT NULL,
+    SEQ_NO BIGINT NOT NULL,
+    HASH CHAR(64) NOT NULL,
+    PRIMARY KEY (ID)
+) ENGINE=INNODB;`
+	// InitAuditHeadSQL contains SQL to insert the empty chain head if there is none
+	InitAuditHeadSQL = `INSERT IGNORE INTO HANSIP_AUDIT_HEAD(ID, SEQ_NO, HASH) VALUES (1, 0, '')`
+	// CreateAuditCheckpointSQL contains SQL to create HANSIP_AUDIT_CHECKPOINT table
+	CreateAuditCheckpointSQL = `CREATE TABLE IF NOT EXISTS HANSIP_AUDIT_CHECKPOINT (
+    REC_ID VARCHAR(32) NOT NULL UNIQUE,
+    SEQ_NO BIGINT NOT NULL,
+    HASH CHAR(64) NOT NULL,
+    CREATED_AT DATETIME,
+    SIGNATURE TEXT,
+    PRIMARY KEY (REC_ID),
+    INDEX (SEQ_NO)
+) ENGINE=INNODB;`
+	// CreateOutboxSQL contains SQL to create HANSIP_OUTBOX table
+	CreateOutboxSQL = `CREATE TABLE IF NOT EXISTS HANSIP_OUTBOX (
+    REC_ID VARCHAR(32) NOT NULL UNIQUE,
+    KIND VARCHAR(32) NOT NULL,
+    PAYLOAD MEDIUMTEXT,
+    STATUS VARCHAR(16) NOT NULL,
+    ATTEMPTS INT NOT NULL DEFAULT 0,
+    NEXT_ATTEMPT_AT DATETIME NOT NULL,
+    LAST_ERROR TEXT,
+    REQUEST_ID VARCHAR(64),
+    CREATED_AT DATETIME NOT NULL,
+    UPDATED_AT DATETIME NOT NULL,
+    PRIMARY KEY (REC_ID),
+    INDEX (STATUS, NEXT_ATTEMPT_AT)
+) ENGINE=INNODB;`
+	// CreateEmailTemplateSQL contains SQL to create HANSIP_EMAIL_TEMPLATE table
+	CreateEmailTemplateSQL = `CREATE TABLE IF NOT EXISTS HANSIP_EMAIL_TEMPLATE (
+    REC_ID VARCHAR(32) NOT NULL UNIQUE,
+    TENANT_REC_ID VARCHAR(32) NOT NULL,
+    TEMPLATE_KEY VARCHAR(64) NOT NULL,
+    VERSION INT NOT NULL,
+    SUBJECT TEXT,
+    BODY MEDIUMTEXT,
+    TEXT_BODY MEDIUMTEXT,
+    CREATED_BY VARCHAR(128),
+    CREATED_AT DATETIME NOT NULL,
+    PRIMARY KEY (REC_ID),
+    UNIQUE (TENANT_REC_ID, TEMPLATE_KEY, VERSION),
+    FOREIGN KEY (TENANT_REC_ID) REFERENCES HANSIP_TENANT(REC_ID) ON DELETE CASCADE
+) ENGINE=INNODB;`
+	// CreateEmailOTPSQL contains SQL to create HANSIP_EMAIL_OTP table
+	CreateEmailOTPSQL = `CREATE TABLE IF NOT EXISTS HANSIP_EMAIL_OTP (
+    USER_REC_ID VARCHAR(32) NOT NULL,
+    PURPOSE VARCHAR(16) NOT NULL,
+    CODE_HASH CHAR(64) NOT NULL,
+    ATTEMPTS INT NOT NULL DEFAULT 0,
+    EXPIRE_AT DATETIME NOT NULL,
+    SENT_AT DATETIME NOT NULL,
+    PRIMARY KEY (USER_REC_ID, PURPOSE),
+    FOREIGN KEY (USER_REC_ID) REFERENCES HANSIP_USER(REC_ID) ON DELETE CASCADE
+) ENGINE=INNODB;`
+	// CreateWebAuthnCredentialSQL contains SQL to create HANSIP_WEBAUTHN_CREDENTIAL table
+	CreateWebAuthnCredentialSQL = `CREATE TABLE IF NOT EXISTS HANSIP_WEBAUTHN_CREDENTIAL (
+    REC_ID VARCHAR(32) NOT NULL UNIQUE,
+    USER_REC_ID VARCHAR(32) NOT NULL,
+    NAME VARCHAR(64) NOT NULL,
+    CREDENTIAL_ID TEXT NOT NULL,
+    CREDENTIAL_HASH CHAR(64) NOT NULL,
+    PUBLIC_KEY BLOB NOT NULL,
+    ALGORITHM INT NOT NULL,
+    SIGN_COUNT BIGINT NOT NULL DEFAULT 0,
+    AAGUID CHAR(32) NOT NULL,
+    TRANSPORTS VARCHAR(128),
+    BACKUP_ELIGIBLE BOOLEAN NOT NULL DEFAULT FALSE,
+    CREATED_AT DATETIME NOT NULL,
+    LAST_USED DATETIME,
+    PRIMARY KEY (REC_ID),
+    UNIQUE (CREDENTIAL_HASH),
+    FOREIGN KEY (USER_REC_ID) REFERENCES HANSIP_USER(REC_ID) ON DELETE CASCADE
+) ENGINE=INNODB;`
+	// CreateWebAuthnSessionSQL contains SQL to create HANSIP_WEBAUTHN_SESSION table
+	CreateWebAuthnSessionSQL = `CREATE TABLE IF NOT EXISTS HANSIP_WEBAUTHN_SESSION (
+    CHALLENGE VARCHAR(64) NOT NULL,
+    USER_REC_ID VARCHAR(32),
+    CEREMONY VARCHAR(16) NOT NULL,
+    EXPIRE_AT DATETIME NOT NULL,
+    PRIMARY KEY (CHALLENGE),
+    INDEX (EXPIRE_AT),
+    FOREIGN KEY (USER_REC_ID) REFERENCES HANSIP_USER(REC_ID) ON DELETE CASCADE
 ) ENGINE=INNODB;`
 	// CreateRevocationSQL contains SQL to create HANSIP_REVOCATION table
 	CreateRevocationSQL = `CREATE TABLE IF NOT EXISTS HANSIP_REVOCATION (
@@ -120,6 +327,9 @@ var (
 	mySQLDBInstance *MySQLDB
 	oCache          cache.ObjectCache
 	ErrNotFound     = fmt.Errorf("data not found error")
+
+	// savepoints numbers the savepoints of the nested transactions
+	savepoints uint64
 )
 
 // GetMySQLDBInstance will obtain the singleton instance to MySQLDB
@@ -154,6 +364,61 @@ type MySQLDB struct {
 	instance *sql.DB
 }
 
+// sqlConn is what sql.DB and sql.Tx have in common to run queries
+type sqlConn interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// conn returns the transaction carried by the context, or the database if there is none
+func (db *MySQLDB) conn(ctx context.Context) sqlConn {
+	if tx, ok := ctx.Value(constants.Transaction).(*sql.Tx); ok {
+		return tx
+	}
+	return db.instance
+}
+
+// Transaction calls fn with a context carrying a new transaction, the repository calls made with that context run in it.
+// The transaction is committed if fn returns nil and rolled back otherwise.
+// If the context already carries a transaction, fn runs in a savepoint of it, rolled back alone if fn fails,
+// and the outermost call commits or rolls back.
+// Audit events are appended in their own transaction, so the chain head is not locked for the whole request.
+func (db *MySQLDB) Transaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	fLog := mysqlLog.WithField("func", "Transaction").WithField("RequestID", ctx.Value(constants.RequestID))
+	if tx, ok := ctx.Value(constants.Transaction).(*sql.Tx); ok {
+		savepoint := fmt.Sprintf("HANSIP_SP_%d", atomic.AddUint64(&savepoints, 1))
+		if _, err := tx.ExecContext(ctx, "SAVEPOINT "+savepoint); err != nil {
+			fLog.Errorf("tx.ExecContext SAVEPOINT got %s", err.Error())
+			return err
+		}
+		if err := fn(ctx); err != nil {
+			if _, rbErr := tx.ExecContext(ctx, "ROLLBACK TO SAVEPOINT "+savepoint); rbErr != nil {
+				fLog.Errorf("tx.ExecContext ROLLBACK TO SAVEPOINT got %s", rbErr.Error())
+			}
+			return err
+		}
+		_, err := tx.ExecContext(ctx, "RELEASE SAVEPOINT "+savepoint)
+		return err
+	}
+	tx, err := db.instance.BeginTx(ctx, nil)
+	if err != nil {
+		fLog.Errorf("db.instance.BeginTx got %s", err.Error())
+		return err
+	}
+	defer tx.Rollback()
+	err = fn(context.WithValue(ctx, constants.Transaction, tx))
+	if err != nil {
+		return err
+	}
+	err = tx.Commit()
+	if err != nil {
+		fLog.Errorf("tx.Commit got %s", err.Error())
+		return err
+	}
+	return nil
+}
+
 // InitDB will initialize this connector.
 func (db *MySQLDB) InitDB(ctx context.Context) error {
 	fLog := mysqlLog.WithField("func", "InitDB")
@@ -168,12 +433,25 @@ func (db *MySQLDB) InitDB(ctx context.Context) error {
 	}
 	if !exist {
 		fLog.Infof("Create table HANSIP_TENANT")
-		_, err := db.instance.ExecContext(ctx, CreateTenantSQL)
+		_, err := db.conn(ctx).ExecContext(ctx, CreateTenantSQL)
 		if err != nil {
 			fLog.Errorf("db.instance.ExecContext HANSIP_TENANT Got %s. SQL = %s", err.Error(), CreateTenantSQL)
 		}
 	}
 
+	fLog.Infof("Checking table HANSIP_TENANT_SETTING")
+	exist, err = db.isTableExist(ctx, "HANSIP_TENANT_SETTING")
+	if err != nil {
+		return err
+	}
+	if !exist {
+		fLog.Infof("Create table HANSIP_TENANT_SETTING")
+		_, err := db.conn(ctx).ExecContext(ctx, CreateTenantSettingSQL)
+		if err != nil {
+			fLog.Errorf("db.instance.ExecContext HANSIP_TENANT_SETTING Got %s. SQL = %s", err.Error(), CreateTenantSettingSQL)
+		}
+	}
+
 	fLog.Infof("Checking table HANSIP_USER")
 	exist, err = db.isTableExist(ctx, "HANSIP_USER")
 	if err != nil {
@@ -181,7 +459,7 @@ func (db *MySQLDB) InitDB(ctx context.Context) error {
 	}
 	if !exist {
 		fLog.Infof("Create table HANSIP_USER")
-		_, err := db.instance.ExecContext(ctx, CreateUserSQL)
+		_, err := db.conn(ctx).ExecContext(ctx, CreateUserSQL)
 		if err != nil {
 			fLog.Errorf("db.instance.ExecContext HANSIP_USER Got %s. SQL = %s", err.Error(), CreateUserSQL)
 		}
@@ -194,7 +472,7 @@ func (db *MySQLDB) InitDB(ctx context.Context) error {
 	}
 	if !exist {
 		fLog.Infof("Create table HANSIP_GROUP")
-		_, err := db.instance.ExecContext(ctx, CreateGroupSQL)
+		_, err := db.conn(ctx).ExecContext(ctx, CreateGroupSQL)
 		if err != nil {
 			fLog.Errorf("db.instance.ExecContext HANSIP_GROUP Got %s. SQL = %s", err.Error(), CreateGroupSQL)
 		}
@@ -207,7 +485,7 @@ func (db *MySQLDB) InitDB(ctx context.Context) error {
 	}
 	if !exist {
 		fLog.Infof("Create table HANSIP_ROLE")
-		_, err := db.instance.ExecContext(ctx, CreateRoleSQL)
+		_, err := db.conn(ctx).ExecContext(ctx, CreateRoleSQL)
 		if err != nil {
 			fLog.Errorf("db.instance.ExecContext HANSIP_ROLE Got %s. SQL = %s", err.Error(), CreateRoleSQL)
 		}
@@ -220,7 +498,7 @@ func (db *MySQLDB) InitDB(ctx context.Context) error {
 	}
 	if !exist {
 		fLog.Infof("Create table HANSIP_USER_ROLE")
-		_, err := db.instance.ExecContext(ctx, CreateUserRoleSQL)
+		_, err := db.conn(ctx).ExecContext(ctx, CreateUserRoleSQL)
 		if err != nil {
 			fLog.Errorf("db.instance.ExecContext HANSIP_USER_ROLE Got %s. SQL = %s", err.Error(), CreateUserRoleSQL)
 		}
@@ -233,12 +511,25 @@ func (db *MySQLDB) InitDB(ctx context.Context) error {
 	}
 	if !exist {
 		fLog.Infof("Create table HANSIP_USER_GROUP")
-		_, err := db.instance.ExecContext(ctx, CreateUserGroupSQL)
+		_, err := db.conn(ctx).ExecContext(ctx, CreateUserGroupSQL)
 		if err != nil {
 			fLog.Errorf("db.instance.ExecContext HANSIP_USER_GROUP Got %s. SQL = %s", err.Error(), CreateUserGroupSQL)
 		}
 	}
 
+	fLog.Infof("Checking table HANSIP_USER_TENANT")
+	exist, err = db.isTableExist(ctx, "HANSIP_USER_TENANT")
+	if err != nil {
+		return err
+	}
+	if !exist {
+		fLog.Infof("Create table HANSIP_USER_TENANT")
+		_, err := db.conn(ctx).ExecContext(ctx, CreateUserTenantSQL)
+		if err != nil {
+			fLog.Errorf("db.instance.ExecContext HANSIP_USER_TENANT Got %s. SQL = %s", err.Error(), CreateUserTenantSQL)
+		}
+	}
+
 	fLog.Infof("Checking table HANSIP_GROUP_ROLE")
 	exist, err = db.isTableExist(ctx, "HANSIP_GROUP_ROLE")
 	if err != nil {
@@ -246,7 +537,7 @@ func (db *MySQLDB) InitDB(ctx context.Context) error {
 	}
 	if !exist {
 		fLog.Infof("Create table HANSIP_GROUP_ROLE")
-		_, err := db.instance.ExecContext(ctx, CreateGroupRoleSQL)
+		_, err := db.conn(ctx).ExecContext(ctx, CreateGroupRoleSQL)
 		if err != nil {
 			fLog.Errorf("db.instance.ExecContext HANSIP_GROUP_ROLE Got %s. SQL = %s", err.Error(), CreateGroupRoleSQL)
 		}
@@ -259,7 +550,7 @@ func (db *MySQLDB) InitDB(ctx context.Context) error {
 	}
 	if !exist {
 		fLog.Infof("Create table HANSIP_TOTP_RECOVERY_CODES")
-		_, err := db.instance.ExecContext(ctx, CreateTOTPRecoveryCodeSQL)
+		_, err := db.conn(ctx).ExecContext(ctx, CreateTOTPRecoveryCodeSQL)
 		if err != nil {
 			fLog.Errorf("db.instance.ExecContext HANSIP_TOTP_RECOVERY_CODES Got %s. SQL = %s", err.Error(), CreateTOTPRecoveryCodeSQL)
 		}
@@ -272,19 +563,277 @@ func (db *MySQLDB) InitDB(ctx context.Context) error {
 	}
 	if !exist {
 		fLog.Infof("Create table HANSIP_REVOCATION")
-		_, err := db.instance.ExecContext(ctx, CreateRevocationSQL)
+		_, err := db.conn(ctx).ExecContext(ctx, CreateRevocationSQL)
 		if err != nil {
 			fLog.Errorf("db.instance.ExecContext HANSIP_REVOCATION Got %s. SQL = %s", err.Error(), CreateRevocationSQL)
 		}
 	}
 
+	fLog.Infof("Checking table HANSIP_ATTRIBUTE_SCHEMA")
+	exist, err = db.isTableExist(ctx, "HANSIP_ATTRIBUTE_SCHEMA")
+	if err != nil {
+		return err
+	}
+	if !exist {
+		fLog.Infof("Create table HANSIP_ATTRIBUTE_SCHEMA")
+		_, err := db.conn(ctx).ExecContext(ctx, CreateAttributeSchemaSQL)
+		if err != nil {
+			fLog.Errorf("db.instance.ExecContext HANSIP_ATTRIBUTE_SCHEMA Got %s. SQL = %s", err.Error(), CreateAttributeSchemaSQL)
+		}
+	}
+
+	fLog.Infof("Checking table HANSIP_USER_ATTRIBUTE")
+	exist, err = db.isTableExist(ctx, "HANSIP_USER_ATTRIBUTE")
+	if err != nil {
+		return err
+	}
+	if !exist {
+		fLog.Infof("Create table HANSIP_USER_ATTRIBUTE")
+		_, err := db.conn(ctx).ExecContext(ctx, CreateUserAttributeSQL)
+		if err != nil {
+			fLog.Errorf("db.instance.ExecContext HANSIP_USER_ATTRIBUTE Got %s. SQL = %s", err.Error(), CreateUserAttributeSQL)
+		}
+	}
+
+	fLog.Infof("Checking table HANSIP_INVITATION")
+	exist, err = db.isTableExist(ctx, "HANSIP_INVITATION")
+	if err != nil {
+		return err
+	}
+	if !exist {
+		fLog.Infof("Create table HANSIP_INVITATION")
+		_, err := db.conn(ctx).ExecContext(ctx, CreateInvitationSQL)
+		if err != nil {
+			fLog.Errorf("db.instance.ExecContext HANSIP_INVITATION Got %s. SQL = %s", err.Error(), CreateInvitationSQL)
+		}
+	}
+
+	fLog.Infof("Checking table HANSIP_WEBHOOK")
+	exist, err = db.isTableExist(ctx, "HANSIP_WEBHOOK")
+	if err != nil {
+		return err
+	}
+	if !exist {
+		fLog.Infof("Create table HANSIP_WEBHOOK")
+		_, err := db.conn(ctx).ExecContext(ctx, CreateWebhookSQL)
+		if err != nil {
+			fLog.Errorf("db.instance.ExecContext HANSIP_WEBHOOK Got %s. SQL = %s", err.Error(), CreateWebhookSQL)
+		}
+	}
+
+	fLog.Infof("Checking table HANSIP_WEBHOOK_DELIVERY")
+	exist, err = db.isTableExist(ctx, "HANSIP_WEBHOOK_DELIVERY")
+	if err != nil {
+		return err
+	}
+	if !exist {
+		fLog.Infof("Create table HANSIP_WEBHOOK_DELIVERY")
+		_, err := db.conn(ctx).ExecContext(ctx, CreateWebhookDeliverySQL)
+		if err != nil {
+			fLog.Errorf("db.instance.ExecContext HANSIP_WEBHOOK_DELIVERY Got %s. SQL = %s", err.Error(), CreateWebhookDeliverySQL)
+		}
+	}
+
+	fLog.Infof("Checking table HANSIP_AUDIT_EVENT")
+	exist, err = db.isTableExist(ctx, "HANSIP_AUDIT_EVENT")
+	if err != nil {
+		return err
+	}
+	if !exist {
+		fLog.Infof("Create table HANSIP_AUDIT_EVENT")
+		_, err := db.conn(ctx).ExecContext(ctx, CreateAuditEventSQL)
+		if err != nil {
+			fLog.Errorf("db.instance.ExecContext HANSIP_AUDIT_EVENT Got %s. SQL = %s", err.Error(), CreateAuditEventSQL)
+		}
+	}
+
+	fLog.Infof("Checking table HANSIP_AUDIT_HEAD")
+	exist, err = db.isTableExist(ctx, "HANSIP_AUDIT_HEAD")
+	if err != nil {
+		return err
+	}
+	if !exist {
+		fLog.Infof("Create table HANSIP_AUDIT_HEAD")
+		_, err := db.conn(ctx).ExecContext(ctx, CreateAuditHeadSQL)
+		if err != nil {
+			fLog.Errorf("db.instance.ExecContext HANSIP_AUDIT_HEAD Got %s. SQL = %s", err.Error(), CreateAuditHeadSQL)
+		}
+	}
+	_, err = db.conn(ctx).ExecContext(ctx, InitAuditHeadSQL)
+	if err != nil {
+		fLog.Errorf("db.instance.ExecContext HANSIP_AUDIT_HEAD Got %s. SQL = %s", err.Error(), InitAuditHeadSQL)
+	}
+
+	fLog.Infof("Checking table HANSIP_AUDIT_CHECKPOINT")
+	exist, err = db.isTableExist(ctx, "HANSIP_AUDIT_CHECKPOINT")
+	if err != nil {
+		return err
+	}
+	if !exist {
+		fLog.Infof("Create table HANSIP_AUDIT_CHECKPOINT")
+		_, err := db.conn(ctx).ExecContext(ctx, CreateAuditCheckpointSQL)
+		if err != nil {
+			fLog.Errorf("db.instance.ExecContext HANSIP_AUDIT_CHECKPOINT Got %s. SQL = %s", err.Error(), CreateAuditCheckpointSQL)
+		}
+	}
+
+	fLog.Infof("Checking table HANSIP_OUTBOX")
+	exist, err = db.isTableExist(ctx, "HANSIP_OUTBOX")
+	if err != nil {
+		return err
+	}
+	if !exist {
+		fLog.Infof("Create table HANSIP_OUTBOX")
+		_, err := db.instance.ExecContext(ctx, CreateOutboxSQL)
+		if err != nil {
+			fLog.Errorf("db.instance.ExecContext HANSIP_OUTBOX Got %s. SQL = %s", err.Error(), CreateOutboxSQL)
+		}
+	}
+
+	fLog.Infof("Checking table HANSIP_EMAIL_TEMPLATE")
+	exist, err = db.isTableExist(ctx, "HANSIP_EMAIL_TEMPLATE")
+	if err != nil {
+		return err
+	}
+	if !exist {
+		fLog.Infof("Create table HANSIP_EMAIL_TEMPLATE")
+		_, err := db.instance.ExecContext(ctx, CreateEmailTemplateSQL)
+		if err != nil {
+			fLog.Errorf("db.instance.ExecContext HANSIP_EMAIL_TEMPLATE Got %s. SQL = %s", err.Error(), CreateEmailTemplateSQL)
+		}
+	}
+
+	fLog.Infof("Checking table HANSIP_EMAIL_OTP")
+	exist, err = db.isTableExist(ctx, "HANSIP_EMAIL_OTP")
+	if err != nil {
+		return err
+	}
+	if !exist {
+		fLog.Infof("Create table HANSIP_EMAIL_OTP")
+		_, err := db.instance.ExecContext(ctx, CreateEmailOTPSQL)
+		if err != nil {
+			fLog.Errorf("db.instance.ExecContext HANSIP_EMAIL_OTP Got %s. SQL = %s", err.Error(), CreateEmailOTPSQL)
+		}
+	}
+
+	fLog.Infof("Checking table HANSIP_WEBAUTHN_CREDENTIAL")
+	exist, err = db.isTableExist(ctx, "HANSIP_WEBAUTHN_CREDENTIAL")
+	if err != nil {
+		return err
+	}
+	if !exist {
+		fLog.Infof("Create table HANSIP_WEBAUTHN_CREDENTIAL")
+		_, err := db.instance.ExecContext(ctx, CreateWebAuthnCredentialSQL)
+		if err != nil {
+			fLog.Errorf("db.instance.ExecContext HANSIP_WEBAUTHN_CREDENTIAL Got %s. SQL = %s", err.Error(), CreateWebAuthnCredentialSQL)
+		}
+	}
+
+	fLog.Infof("Checking table HANSIP_WEBAUTHN_SESSION")
+	exist, err = db.isTableExist(ctx, "HANSIP_WEBAUTHN_SESSION")
+	if err != nil {
+		return err
+	}
+	if !exist {
+		fLog.Infof("Create table HANSIP_WEBAUTHN_SESSION")
+		_, err := db.instance.ExecContext(ctx, CreateWebAuthnSessionSQL)
+		if err != nil {
+			fLog.Errorf("db.instance.ExecContext HANSIP_WEBAUTHN_SESSION Got %s. SQL = %s", err.Error(), CreateWebAuthnSessionSQL)
+		}
+	}
+
+	// Audit events recorded before hash chaining are chained in their recorded order
+	fLog.Infof("Checking column HANSIP_AUDIT_EVENT.HASH")
+	exist, err = db.isColumnExist(ctx, "HANSIP_AUDIT_EVENT", "HASH")
+	if err != nil {
+		return err
+	}
+	if !exist {
+		fLog.Infof("Add column HANSIP_AUDIT_EVENT.PREV_HASH and HASH")
+		q := "ALTER TABLE HANSIP_AUDIT_EVENT ADD COLUMN PREV_HASH CHAR(64) NOT NULL DEFAULT '', ADD COLUMN HASH CHAR(64) NOT NULL DEFAULT ''"
+		_, err := db.conn(ctx).ExecContext(ctx, q)
+		if err != nil {
+			fLog.Errorf("db.instance.ExecContext HANSIP_AUDIT_EVENT Got %s. SQL = %s", err.Error(), q)
+		} else if err := db.chainAuditEvents(ctx); err != nil {
+			fLog.Errorf("db.chainAuditEvents Got %s", err.Error())
+		}
+	}
+
+	// Tables created before record versioning need the VERSION column
+	for _, table := range []string{"HANSIP_TENANT", "HANSIP_USER", "HANSIP_GROUP", "HANSIP_ROLE"} {
+		fLog.Infof("Checking column %s.VERSION", table)
+		exist, err = db.isColumnExist(ctx, table, "VERSION")
+		if err != nil {
+			return err
+		}
+		if !exist {
+			fLog.Infof("Add column %s.VERSION", table)
+			q := fmt.Sprintf("ALTER TABLE %s ADD COLUMN VERSION INT NOT NULL DEFAULT 0", table)
+			_, err := db.conn(ctx).ExecContext(ctx, q)
+			if err != nil {
+				fLog.Errorf("db.instance.ExecContext %s Got %s. SQL = %s", table, err.Error(), q)
+			}
+		}
+	}
+
+	// Email templates stored before multipart emails need the TEXT_BODY column
+	fLog.Infof("Checking column HANSIP_EMAIL_TEMPLATE.TEXT_BODY")
+	exist, err = db.isColumnExist(ctx, "HANSIP_EMAIL_TEMPLATE", "TEXT_BODY")
+	if err != nil {
+		return err
+	}
+	if !exist {
+		fLog.Infof("Add column HANSIP_EMAIL_TEMPLATE.TEXT_BODY")
+		q := "ALTER TABLE HANSIP_EMAIL_TEMPLATE ADD COLUMN TEXT_BODY MEDIUMTEXT AFTER BODY"
+		_, err := db.conn(ctx).ExecContext(ctx, q)
+		if err != nil {
+			fLog.Errorf("db.instance.ExecContext HANSIP_EMAIL_TEMPLATE Got %s. SQL = %s", err.Error(), q)
+		}
+	}
+
+	// Users created before localized emails need the LOCALE column
+	fLog.Infof("Checking column HANSIP_USER.LOCALE")
+	exist, err = db.isColumnExist(ctx, "HANSIP_USER", "LOCALE")
+	if err != nil {
+		return err
+	}
+	if !exist {
+		fLog.Infof("Add column HANSIP_USER.LOCALE")
+		q := "ALTER TABLE HANSIP_USER ADD COLUMN LOCALE VARCHAR(16) NOT NULL DEFAULT '' AFTER RECOVERY_CODE"
+		_, err := db.conn(ctx).ExecContext(ctx, q)
+		if err != nil {
+			fLog.Errorf("db.instance.ExecContext HANSIP_USER Got %s. SQL = %s", err.Error(), q)
+		}
+	}
+
+	// Users activating 2FA before the email factor was a choice of its own keep using their authenticator app
+	fLog.Infof("Checking column HANSIP_USER.EMAIL_2FE")
+	exist, err = db.isColumnExist(ctx, "HANSIP_USER", "EMAIL_2FE")
+	if err != nil {
+		return err
+	}
+	if !exist {
+		fLog.Infof("Add column HANSIP_USER.EMAIL_2FE")
+		q := "ALTER TABLE HANSIP_USER ADD COLUMN EMAIL_2FE TINYINT(1) UNSIGNED DEFAULT 0 AFTER ENABLE_2FE"
+		_, err := db.conn(ctx).ExecContext(ctx, q)
+		if err != nil {
+			fLog.Errorf("db.instance.ExecContext HANSIP_USER Got %s. SQL = %s", err.Error(), q)
+		}
+	}
+
+	// Invitations created before token hashing stored the token itself, SHA2 makes the same hash as the endpoint does
+	fLog.Infof("Hashing plain HANSIP_INVITATION.TOKEN")
+	q := "UPDATE HANSIP_INVITATION SET TOKEN=SHA2(TOKEN, 256) WHERE LENGTH(TOKEN) < 64"
+	if _, err := db.conn(ctx).ExecContext(ctx, q); err != nil {
+		fLog.Errorf("db.instance.ExecContext HANSIP_INVITATION Got %s. SQL = %s", err.Error(), q)
+	}
+
 	hansipDomain := config.Get("hansip.domain")
 	handipAdmin := config.Get("hansip.admin")
 
 	// Create built-in tenant.
 	fLog.Infof("Checking built-in tenant")
-	_, err = db.GetTenantByDomain(ctx, hansipDomain)
-	if err != nil {
+	if _, err := db.GetTenantByDomain(ctx, hansipDomain); err != nil {
 		fLog.Infof("Creating built-in tenant")
 		_, err = db.CreateTenantRecord(ctx, "Hansip System", "hansip", "Hansip built in tenant")
 		if err != nil {
@@ -325,44 +874,33 @@ func (db *MySQLDB) InitDB(ctx context.Context) error {
 		}
 	}
 
-	// Create setup user
-	fLog.Infof("Checking setup user")
-	user, err := db.GetUserByEmail(ctx, "setup@hansip")
-	if err != nil {
-		fLog.Warnf("Creating setup user. This setup user must be disabled in production. Setup user passphrase is `this user must be disabled on production`")
-		user, err = db.CreateUserRecord(ctx, "setup@hansip", "this user must be disabled on production")
-		if err != nil {
-			fLog.Errorf("db.CreateRole Got %s", err.Error())
-		} else {
-			if !user.Enabled {
-				fLog.Infof("Enabling setup user")
-				user.Enabled = true
-				err = db.UpdateUser(ctx, user)
-				if err != nil {
-					fLog.Errorf("db.UpdateUser Got %s", err.Error())
-				}
-			}
-		}
-	}
+	// The built in admin, joining the hansip tenant and the admin role, is created by server.SetupAdmin
+	// from the setup.admin settings, which refuses the default passphrase outside dev mode.
 
-	// Create setup user
-	fLog.Infof("Make sure that setup user is in built-in group")
-	ug, err := db.GetUserGroup(ctx, user, group)
-	if err != nil || ug == nil {
-		fLog.Infof("Adding steup user to built-in group")
-		_, err = db.CreateUserGroup(ctx, user, group)
-		if err != nil {
-			fLog.Errorf("db.CreateUserGroup Got %s", err.Error())
+	return nil
+}
+
+func (db *MySQLDB) isColumnExist(ctx context.Context, tableName, columnName string) (bool, error) {
+	fLog := mysqlLog.WithField("func", "isColumnExist")
+	q := "select COUNT(*) AS CNT from INFORMATION_SCHEMA.COLUMNS where TABLE_SCHEMA=DATABASE() AND TABLE_NAME=? AND COLUMN_NAME=?"
+	row := db.conn(ctx).QueryRowContext(ctx, q, tableName, columnName)
+	count := 0
+	err := row.Scan(&count)
+	if err != nil {
+		fLog.Errorf("row.Scan got %s. SQL = %s", err.Error(), q)
+		return false, &ErrDBScanError{
+			Wrapped: err,
+			Message: "rows.Scan returns error",
+			SQL:     q,
 		}
 	}
-
-	return nil
+	return count > 0, nil
 }
 
 func (db *MySQLDB) isTableExist(ctx context.Context, tableName string) (bool, error) {
 	fLog := mysqlLog.WithField("func", "isTableExist")
 	q := "select COUNT(*) AS CNT from INFORMATION_SCHEMA.TABLES where TABLE_NAME=?"
-	rows, err := db.instance.QueryContext(ctx, q, tableName)
+	rows, err := db.conn(ctx).QueryContext(ctx, q, tableName)
 	if err != nil {
 		fLog.Errorf("db.instance.ExecContext got %s. SQL = %s", err.Error(), q)
 		return false, &ErrDBQueryError{
@@ -388,7 +926,7 @@ func (db *MySQLDB) isTableExist(ctx context.Context, tableName string) (bool, er
 
 // DropAllTables will drop all tables used by Hansip
 func (db *MySQLDB) DropAllTables(ctx context.Context) error {
-	_, err := db.instance.ExecContext(ctx, DropAllSQL)
+	_, err := db.conn(ctx).ExecContext(ctx, DropAllSQL)
 	if err != nil {
 		mysqlLog.WithField("func", "DropAllTables").WithField("RequestID", ctx.Value(constants.RequestID)).Errorf("got %s, SQL = %s", err.Error(), DropAllSQL)
 		return &ErrDBExecuteError{
@@ -407,7 +945,7 @@ func (db *MySQLDB) CreateAllTable(ctx context.Context) error {
 	hansipDomain := config.Get("hansip.domain")
 	hansipAdmin := config.Get("hansip.admin")
 
-	_, err := db.instance.ExecContext(ctx, CreateTenantSQL)
+	_, err := db.conn(ctx).ExecContext(ctx, CreateTenantSQL)
 	if err != nil {
 		fLog.Errorf("db.instance.ExecContext HANSIP_TENANT Got %s. SQL = %s", err.Error(), CreateTenantSQL)
 		return &ErrDBExecuteError{
@@ -421,7 +959,16 @@ func (db *MySQLDB) CreateAllTable(ctx context.Context) error {
 		fLog.Errorf("db.CreateTenantRecord Got %s", err.Error())
 		return err
 	}
-	_, err = db.instance.ExecContext(ctx, CreateUserSQL)
+	_, err = db.conn(ctx).ExecContext(ctx, CreateTenantSettingSQL)
+	if err != nil {
+		fLog.Errorf("db.instance.ExecContext HANSIP_TENANT_SETTING Got %s. SQL = %s", err.Error(), CreateTenantSettingSQL)
+		return &ErrDBExecuteError{
+			Wrapped: err,
+			Message: "Error while trying to create table HANSIP_TENANT_SETTING",
+			SQL:     CreateTenantSettingSQL,
+		}
+	}
+	_, err = db.conn(ctx).ExecContext(ctx, CreateUserSQL)
 	if err != nil {
 		fLog.Errorf("db.instance.ExecContext HANSIP_USER Got %s. SQL = %s", err.Error(), CreateUserSQL)
 		return &ErrDBExecuteError{
@@ -430,7 +977,7 @@ func (db *MySQLDB) CreateAllTable(ctx context.Context) error {
 			SQL:     CreateUserSQL,
 		}
 	}
-	_, err = db.instance.ExecContext(ctx, CreateGroupSQL)
+	_, err = db.conn(ctx).ExecContext(ctx, CreateGroupSQL)
 	if err != nil {
 		fLog.Errorf("db.instance.ExecContext HANSIP_GROUP Got %s. SQL = %s", err.Error(), CreateGroupSQL)
 		return &ErrDBExecuteError{
@@ -439,7 +986,7 @@ func (db *MySQLDB) CreateAllTable(ctx context.Context) error {
 			SQL:     CreateGroupSQL,
 		}
 	}
-	_, err = db.instance.ExecContext(ctx, CreateRoleSQL)
+	_, err = db.conn(ctx).ExecContext(ctx, CreateRoleSQL)
 	if err != nil {
 		fLog.Errorf("db.instance.ExecContext HANSIP_ROLE Got %s. SQL = %s", err.Error(), CreateRoleSQL)
 		return &ErrDBExecuteError{
@@ -448,7 +995,7 @@ func (db *MySQLDB) CreateAllTable(ctx context.Context) error {
 			SQL:     CreateRoleSQL,
 		}
 	}
-	_, err = db.instance.ExecContext(ctx, CreateUserRoleSQL)
+	_, err = db.conn(ctx).ExecContext(ctx, CreateUserRoleSQL)
 	if err != nil {
 		fLog.Errorf("db.instance.ExecContext HANSIP_USER_ROLE Got %s. SQL = %s", err.Error(), CreateUserRoleSQL)
 		return &ErrDBExecuteError{
@@ -457,7 +1004,7 @@ func (db *MySQLDB) CreateAllTable(ctx context.Context) error {
 			SQL:     CreateUserRoleSQL,
 		}
 	}
-	_, err = db.instance.ExecContext(ctx, CreateUserGroupSQL)
+	_, err = db.conn(ctx).ExecContext(ctx, CreateUserGroupSQL)
 	if err != nil {
 		fLog.Errorf("db.instance.ExecContext HANSIP_USER_GROUP Got %s. SQL = %s", err.Error(), CreateUserGroupSQL)
 		return &ErrDBExecuteError{
@@ -466,16 +1013,25 @@ func (db *MySQLDB) CreateAllTable(ctx context.Context) error {
 			SQL:     CreateUserGroupSQL,
 		}
 	}
-	_, err = db.instance.ExecContext(ctx, CreateGroupRoleSQL)
+	_, err = db.conn(ctx).ExecContext(ctx, CreateUserTenantSQL)
 	if err != nil {
-		fLog.Errorf("db.instance.ExecContext HANSIP_GROUP_ROLE Got %s. SQL = %s", err.Error(), CreateGroupRoleSQL)
+		fLog.Errorf("db.instance.ExecContext HANSIP_USER_TENANT Got %s. SQL = %s", err.Error(), CreateUserTenantSQL)
+		return &ErrDBExecuteError{
+			Wrapped: err,
+			Message: "Error while trying to create table HANSIP_USER_TENANT",
+			SQL:     CreateUserTenantSQL,
+		}
+	}
+	_, err = db.conn(ctx).ExecContext(ctx, CreateGroupRoleSQL)
+	if err != nil {
+		fLog.Errorf("db.instance.ExecContext HANSIP_GROUP_ROLE Got %s. SQL = %s", err.Error(), CreateGroupRoleSQL)
 		return &ErrDBExecuteError{
 			Wrapped: err,
 			Message: "Error while trying to create table HANSIP_GROUP_ROLE",
 			SQL:     CreateGroupRoleSQL,
 		}
 	}
-	_, err = db.instance.ExecContext(ctx, CreateTOTPRecoveryCodeSQL)
+	_, err = db.conn(ctx).ExecContext(ctx, CreateTOTPRecoveryCodeSQL)
 	if err != nil {
 		fLog.Errorf("db.instance.ExecContext HANSIP_TOTP_RECOVERY_CODES Got %s. SQL = %s", err.Error(), CreateTOTPRecoveryCodeSQL)
 		return &ErrDBExecuteError{
@@ -484,7 +1040,7 @@ func (db *MySQLDB) CreateAllTable(ctx context.Context) error {
 			SQL:     CreateTOTPRecoveryCodeSQL,
 		}
 	}
-	_, err = db.instance.ExecContext(ctx, CreateRevocationSQL)
+	_, err = db.conn(ctx).ExecContext(ctx, CreateRevocationSQL)
 	if err != nil {
 		fLog.Errorf("db.instance.ExecContext HANSIP_REVOCATION Got %s. SQL = %s", err.Error(), CreateRevocationSQL)
 		return &ErrDBExecuteError{
@@ -493,6 +1049,89 @@ func (db *MySQLDB) CreateAllTable(ctx context.Context) error {
 			SQL:     CreateRevocationSQL,
 		}
 	}
+	_, err = db.conn(ctx).ExecContext(ctx, CreateAttributeSchemaSQL)
+	if err != nil {
+		fLog.Errorf("db.instance.ExecContext HANSIP_ATTRIBUTE_SCHEMA Got %s. SQL = %s", err.Error(), CreateAttributeSchemaSQL)
+		return &ErrDBExecuteError{
+			Wrapped: err,
+			Message: "Error while trying to create table HANSIP_ATTRIBUTE_SCHEMA",
+			SQL:     CreateAttributeSchemaSQL,
+		}
+	}
+	_, err = db.conn(ctx).ExecContext(ctx, CreateUserAttributeSQL)
+	if err != nil {
+		fLog.Errorf("db.instance.ExecContext HANSIP_USER_ATTRIBUTE Got %s. SQL = %s", err.Error(), CreateUserAttributeSQL)
+		return &ErrDBExecuteError{
+			Wrapped: err,
+			Message: "Error while trying to create table HANSIP_USER_ATTRIBUTE",
+			SQL:     CreateUserAttributeSQL,
+		}
+	}
+	_, err = db.conn(ctx).ExecContext(ctx, CreateInvitationSQL)
+	if err != nil {
+		fLog.Errorf("db.instance.ExecContext HANSIP_INVITATION Got %s. SQL = %s", err.Error(), CreateInvitationSQL)
+		return &ErrDBExecuteError{
+			Wrapped: err,
+			Message: "Error while trying to create table HANSIP_INVITATION",
+			SQL:     CreateInvitationSQL,
+		}
+	}
+	_, err = db.conn(ctx).ExecContext(ctx, CreateWebhookSQL)
+	if err != nil {
+		fLog.Errorf("db.instance.ExecContext HANSIP_WEBHOOK Got %s. SQL = %s", err.Error(), CreateWebhookSQL)
+		return &ErrDBExecuteError{
+			Wrapped: err,
+			Message: "Error while trying to create table HANSIP_WEBHOOK",
+			SQL:     CreateWebhookSQL,
+		}
+	}
+	_, err = db.conn(ctx).ExecContext(ctx, CreateWebhookDeliverySQL)
+	if err != nil {
+		fLog.Errorf("db.instance.ExecContext HANSIP_WEBHOOK_DELIVERY Got %s. SQL = %s", err.Error(), CreateWebhookDeliverySQL)
+		return &ErrDBExecuteError{
+			Wrapped: err,
+			Message: "Error while trying to create table HANSIP_WEBHOOK_DELIVERY",
+			SQL:     CreateWebhookDeliverySQL,
+		}
+	}
+	_, err = db.conn(ctx).ExecContext(ctx, CreateAuditEventSQL)
+	if err != nil {
+		fLog.Errorf("db.instance.ExecContext HANSIP_AUDIT_EVENT Got %s. SQL = %s", err.Error(), CreateAuditEventSQL)
+		return &ErrDBExecuteError{
+			Wrapped: err,
+			Message: "Error while trying to create table HANSIP_AUDIT_EVENT",
+			SQL:     CreateAuditEventSQL,
+		}
+	}
+	for _, q := range []string{CreateAuditHeadSQL, InitAuditHeadSQL, CreateAuditCheckpointSQL} {
+		_, err = db.conn(ctx).ExecContext(ctx, q)
+		if err != nil {
+			fLog.Errorf("db.instance.ExecContext Got %s. SQL = %s", err.Error(), q)
+			return &ErrDBExecuteError{
+				Wrapped: err,
+				Message: "Error while trying to create audit chain tables",
+				SQL:     q,
+			}
+		}
+	}
+	_, err = db.instance.ExecContext(ctx, CreateOutboxSQL)
+	if err != nil {
+		fLog.Errorf("db.instance.ExecContext HANSIP_OUTBOX Got %s. SQL = %s", err.Error(), CreateOutboxSQL)
+		return &ErrDBExecuteError{
+			Wrapped: err,
+			Message: "Error while trying to create table HANSIP_OUTBOX",
+			SQL:     CreateOutboxSQL,
+		}
+	}
+	_, err = db.instance.ExecContext(ctx, CreateEmailTemplateSQL)
+	if err != nil {
+		fLog.Errorf("db.instance.ExecContext HANSIP_EMAIL_TEMPLATE Got %s. SQL = %s", err.Error(), CreateEmailTemplateSQL)
+		return &ErrDBExecuteError{
+			Wrapped: err,
+			Message: "Error while trying to create table HANSIP_EMAIL_TEMPLATE",
+			SQL:     CreateEmailTemplateSQL,
+		}
+	}
 	_, err = db.CreateRole(ctx, hansipAdmin, hansipDomain, "Administrator role")
 	if err != nil {
 		fLog.Errorf("db.CreateRole Got %s", err.Error())
@@ -505,9 +1144,9 @@ func (db *MySQLDB) CreateAllTable(ctx context.Context) error {
 func (db *MySQLDB) GetTenantByDomain(ctx context.Context, tenantDomain string) (*Tenant, error) {
 	fLog := mysqlLog.WithField("func", "GetTenantByDomain").WithField("RequestID", ctx.Value(constants.RequestID))
 	tenant := &Tenant{}
-	q := "SELECT REC_ID, TENANT_NAME,TENANT_DOMAIN,DESCRIPTION FROM HANSIP_TENANT WHERE TENANT_DOMAIN = ?"
-	row := db.instance.QueryRowContext(ctx, q, tenantDomain)
-	err := row.Scan(&tenant.RecID, &tenant.Name, &tenant.Domain, &tenant.Description)
+	q := "SELECT REC_ID, TENANT_NAME,TENANT_DOMAIN,DESCRIPTION, VERSION FROM HANSIP_TENANT WHERE TENANT_DOMAIN = ?"
+	row := db.conn(ctx).QueryRowContext(ctx, q, tenantDomain)
+	err := row.Scan(&tenant.RecID, &tenant.Name, &tenant.Domain, &tenant.Description, &tenant.Version)
 	if err != nil {
 		if err.Error() == "sql: no rows in result set" {
 			return nil, &ErrDBNoResult{
@@ -529,9 +1168,9 @@ func (db *MySQLDB) GetTenantByDomain(ctx context.Context, tenantDomain string) (
 func (db *MySQLDB) GetTenantByRecID(ctx context.Context, recID string) (*Tenant, error) {
 	fLog := mysqlLog.WithField("func", "GetTenantByRecID").WithField("RequestID", ctx.Value(constants.RequestID))
 	tenant := &Tenant{}
-	q := "SELECT REC_ID, TENANT_NAME,TENANT_DOMAIN,DESCRIPTION FROM HANSIP_TENANT WHERE REC_ID = ?"
-	row := db.instance.QueryRowContext(ctx, q, recID)
-	err := row.Scan(&tenant.RecID, &tenant.Name, &tenant.Domain, &tenant.Description)
+	q := "SELECT REC_ID, TENANT_NAME,TENANT_DOMAIN,DESCRIPTION, VERSION FROM HANSIP_TENANT WHERE REC_ID = ?"
+	row := db.conn(ctx).QueryRowContext(ctx, q, recID)
+	err := row.Scan(&tenant.RecID, &tenant.Name, &tenant.Domain, &tenant.Description, &tenant.Version)
 	if err != nil {
 		fLog.Errorf("row.Scan got %s", err.Error())
 		return nil, &ErrDBScanError{
@@ -555,7 +1194,7 @@ func (db *MySQLDB) CreateTenantRecord(ctx context.Context, tenantName, tenantDom
 
 	q := "INSERT INTO HANSIP_TENANT(REC_ID,TENANT_NAME, TENANT_DOMAIN, DESCRIPTION) VALUES(?,?,?,?)"
 
-	_, err := db.instance.ExecContext(ctx, q,
+	_, err := db.conn(ctx).ExecContext(ctx, q,
 		tenant.RecID, tenant.Name, tenant.Domain, tenant.Description)
 
 	if err != nil {
@@ -574,7 +1213,7 @@ func (db *MySQLDB) CreateTenantRecord(ctx context.Context, tenantName, tenantDom
 func (db *MySQLDB) DeleteTenant(ctx context.Context, tenant *Tenant) error {
 	fLog := mysqlLog.WithField("func", "DeleteTenant").WithField("RequestID", ctx.Value(constants.RequestID))
 	q := "DELETE FROM HANSIP_TENANT WHERE REC_ID=?"
-	_, err := db.instance.ExecContext(ctx, q, tenant.RecID)
+	_, err := db.conn(ctx).ExecContext(ctx, q, tenant.RecID)
 	if err != nil {
 		fLog.Errorf("db.instance.ExecContext got %s. SQL = %s", err.Error(), q)
 		return &ErrDBExecuteError{
@@ -588,7 +1227,7 @@ func (db *MySQLDB) DeleteTenant(ctx context.Context, tenant *Tenant) error {
 
 	// delete all user-roles ...
 	q = "DELETE FROM HANSIP_USER_ROLE WHERE HANSIP_USER_ROLE.ROLE_REC_ID = HANSIP_ROLE.REC_ID AND HANSIP_ROLE.ROLE_DOMAIN = ?"
-	_, err = db.instance.ExecContext(ctx, q, domainToDelete)
+	_, err = db.conn(ctx).ExecContext(ctx, q, domainToDelete)
 	if err != nil {
 		fLog.Errorf("db.instance.ExecContext got %s. SQL = %s", err.Error(), q)
 		return &ErrDBExecuteError{
@@ -600,7 +1239,7 @@ func (db *MySQLDB) DeleteTenant(ctx context.Context, tenant *Tenant) error {
 
 	// delete all group-roles ...
 	q = "DELETE FROM HANSIP_GROUP_ROLE WHERE HANSIP_GROUP_ROLE.GROUP_REC_ID = HANSIP_GROUP.REC_ID AND HANSIP_GROUP.GROUP_DOMAIN = ?"
-	_, err = db.instance.ExecContext(ctx, q, domainToDelete)
+	_, err = db.conn(ctx).ExecContext(ctx, q, domainToDelete)
 	if err != nil {
 		fLog.Errorf("db.instance.ExecContext got %s. SQL = %s", err.Error(), q)
 		return &ErrDBExecuteError{
@@ -612,7 +1251,7 @@ func (db *MySQLDB) DeleteTenant(ctx context.Context, tenant *Tenant) error {
 
 	// delete all user-groups ...
 	q = "DELETE FROM HANSIP_USER_GROUP WHERE HANSIP_USER_GROUP.GROUP_REC_ID = HANSIP_GROUP.REC_ID AND HANSIP_GROUP.GROUP_DOMAIN = ?"
-	_, err = db.instance.ExecContext(ctx, q, domainToDelete)
+	_, err = db.conn(ctx).ExecContext(ctx, q, domainToDelete)
 	if err != nil {
 		fLog.Errorf("db.instance.ExecContext got %s. SQL = %s", err.Error(), q)
 		return &ErrDBExecuteError{
@@ -624,7 +1263,7 @@ func (db *MySQLDB) DeleteTenant(ctx context.Context, tenant *Tenant) error {
 
 	// delete all groups ...
 	q = "DELETE FROM HANSIP_GROUP WHERE HANSIP_GROUP.GROUP_DOMAIN = ?"
-	_, err = db.instance.ExecContext(ctx, q, domainToDelete)
+	_, err = db.conn(ctx).ExecContext(ctx, q, domainToDelete)
 	if err != nil {
 		fLog.Errorf("db.instance.ExecContext got %s. SQL = %s", err.Error(), q)
 		return &ErrDBExecuteError{
@@ -636,7 +1275,7 @@ func (db *MySQLDB) DeleteTenant(ctx context.Context, tenant *Tenant) error {
 
 	// delete all roles ...
 	q = "DELETE FROM HANSIP_ROLE WHERE HANSIP_ROLE.ROLE_DOMAIN = ?"
-	_, err = db.instance.ExecContext(ctx, q, domainToDelete)
+	_, err = db.conn(ctx).ExecContext(ctx, q, domainToDelete)
 	if err != nil {
 		fLog.Errorf("db.instance.ExecContext got %s. SQL = %s", err.Error(), q)
 		return &ErrDBExecuteError{
@@ -667,9 +1306,9 @@ func (db *MySQLDB) UpdateTenant(ctx context.Context, tenant *Tenant) error {
 	}
 	domainChanged := origin.Domain != tenant.Domain
 
-	q := "UPDATE HANSIP_TENANT SET TENANT_NAME=?, TENANT_DOMAIN=?, DESCRIPTION=? WHERE REC_ID=?"
-	_, err = db.instance.ExecContext(ctx, q,
-		tenant.Name, tenant.Domain, tenant.Description, tenant.RecID)
+	q := "UPDATE HANSIP_TENANT SET TENANT_NAME=?, TENANT_DOMAIN=?, DESCRIPTION=?, VERSION=VERSION+1 WHERE REC_ID=? AND VERSION=?"
+	result, err := db.conn(ctx).ExecContext(ctx, q,
+		tenant.Name, tenant.Domain, tenant.Description, tenant.RecID, tenant.Version)
 	if err != nil {
 		fLog.Errorf("db.instance.ExecContext got  %s. SQL = %s", err.Error(), q)
 		return &ErrDBExecuteError{
@@ -678,10 +1317,17 @@ func (db *MySQLDB) UpdateTenant(ctx context.Context, tenant *Tenant) error {
 			SQL:     q,
 		}
 	}
+	if affected, err := result.RowsAffected(); err == nil && affected == 0 {
+		return &ErrDBConflict{
+			Message: fmt.Sprintf("tenant %s has been changed since it was read", tenant.RecID),
+			SQL:     q,
+		}
+	}
+	tenant.Version++
 
 	if domainChanged {
-		q = "UPDATE HANSIP_ROLE SET ROLE_DOMAIN=? WHERE ROLE_DOMAIN=?"
-		_, err = db.instance.ExecContext(ctx, q,
+		q = "UPDATE HANSIP_ROLE SET ROLE_DOMAIN=?, VERSION=VERSION+1 WHERE ROLE_DOMAIN=?"
+		_, err = db.conn(ctx).ExecContext(ctx, q,
 			tenant.Domain, origin.Domain)
 		if err != nil {
 			fLog.Errorf("db.instance.ExecContext got  %s. SQL = %s", err.Error(), q)
@@ -692,8 +1338,8 @@ func (db *MySQLDB) UpdateTenant(ctx context.Context, tenant *Tenant) error {
 			}
 		}
 
-		q = "UPDATE HANSIP_GROUP SET GROUP_DOMAIN=? WHERE GROUP_DOMAIN=?"
-		_, err = db.instance.ExecContext(ctx, q,
+		q = "UPDATE HANSIP_GROUP SET GROUP_DOMAIN=?, VERSION=VERSION+1 WHERE GROUP_DOMAIN=?"
+		_, err = db.conn(ctx).ExecContext(ctx, q,
 			tenant.Domain, origin.Domain)
 		if err != nil {
 			fLog.Errorf("db.instance.ExecContext got  %s. SQL = %s", err.Error(), q)
@@ -714,7 +1360,7 @@ func (db *MySQLDB) IsTenantRecIDExist(ctx context.Context, recID string) (bool,
 
 	q := "SELECT COUNT(*) AS CNT FROM HANSIP_TENANT WHERE REC_ID=?"
 
-	rows, err := db.instance.QueryContext(ctx, q, recID)
+	rows, err := db.conn(ctx).QueryContext(ctx, q, recID)
 	if err != nil {
 		fLog.Errorf("db.instance.ExecContext got %s. SQL = %s", err.Error(), q)
 		return false, &ErrDBQueryError{
@@ -741,23 +1387,29 @@ func (db *MySQLDB) IsTenantRecIDExist(ctx context.Context, recID string) (bool,
 
 // ListTenant from database with pagination
 func (db *MySQLDB) ListTenant(ctx context.Context, request *helper.PageRequest) ([]*Tenant, *helper.Page, error) {
-	fLog := mysqlLog.WithField("func", "GetUserByRecID").WithField("RequestID", ctx.Value(constants.RequestID))
-	q := "SELECT COUNT(*) AS CNT FROM HANSIP_TENANT"
-	row := db.instance.QueryRowContext(ctx, q)
-	count := 0
-	err := row.Scan(&count)
+	fLog := mysqlLog.WithField("func", "ListTenant").WithField("RequestID", ctx.Value(constants.RequestID))
+	query, err := newListQuery(request, tenantListColumns, "", "TENANT_NAME")
 	if err != nil {
-		fLog.Errorf("db.instance.QueryRowContext got  %s", err.Error())
-		return nil, nil, &ErrDBQueryError{
-			Wrapped: err,
-			Message: "Error ListTenant",
-			SQL:     q,
+		return nil, nil, err
+	}
+	count := 0
+	q := "SELECT COUNT(*) AS CNT FROM HANSIP_TENANT WHERE 1=1" + query.filter
+	if query.counted() {
+		row := db.conn(ctx).QueryRowContext(ctx, q, query.countArgs()...)
+		err = row.Scan(&count)
+		if err != nil {
+			fLog.Errorf("db.instance.QueryRowContext got  %s", err.Error())
+			return nil, nil, &ErrDBQueryError{
+				Wrapped: err,
+				Message: "Error ListTenant",
+				SQL:     q,
+			}
 		}
 	}
-	page := helper.NewPage(request, uint(count))
-	q = fmt.Sprintf("SELECT REC_ID, TENANT_NAME, TENANT_DOMAIN, DESCRIPTION FROM HANSIP_TENANT ORDER BY TENANT_NAME %s LIMIT %d, %d", request.Sort, page.OffsetStart, page.OffsetEnd-page.OffsetStart)
+	page := query.page(count)
+	q = fmt.Sprintf("SELECT REC_ID, TENANT_NAME, TENANT_DOMAIN, DESCRIPTION, VERSION FROM HANSIP_TENANT WHERE 1=1%s ORDER BY %s LIMIT %s", query.where(), query.orderBy(), query.limit(page))
 	ret := make([]*Tenant, 0)
-	rows, err := db.instance.QueryContext(ctx, q)
+	rows, err := db.conn(ctx).QueryContext(ctx, q, query.args()...)
 	if err != nil {
 		fLog.Errorf("db.instance.QueryContext got  %s. SQL = %s", err.Error(), q)
 		return nil, nil, &ErrDBQueryError{
@@ -768,7 +1420,7 @@ func (db *MySQLDB) ListTenant(ctx context.Context, request *helper.PageRequest)
 	}
 	for rows.Next() {
 		t := &Tenant{}
-		err := rows.Scan(&t.RecID, &t.Name, &t.Domain, &t.Description)
+		err := rows.Scan(&t.RecID, &t.Name, &t.Domain, &t.Description, &t.Version)
 		if err != nil {
 			fLog.Warnf("row.Scan got  %s", err.Error())
 			return nil, nil, &ErrDBScanError{
@@ -780,18 +1432,81 @@ func (db *MySQLDB) ListTenant(ctx context.Context, request *helper.PageRequest)
 			ret = append(ret, t)
 		}
 	}
-	return ret, page, nil
+	return ret[:query.paginate(page, ret)], page, nil
+}
+
+// GetTenantSettings returns all setting overrides of a tenant
+func (db *MySQLDB) GetTenantSettings(ctx context.Context, tenant *Tenant) (map[string]string, error) {
+	fLog := mysqlLog.WithField("func", "GetTenantSettings").WithField("RequestID", ctx.Value(constants.RequestID))
+	q := "SELECT SETTING_KEY, SETTING_VALUE FROM HANSIP_TENANT_SETTING WHERE TENANT_REC_ID = ?"
+	rows, err := db.conn(ctx).QueryContext(ctx, q, tenant.RecID)
+	if err != nil {
+		fLog.Errorf("db.instance.QueryContext got  %s. SQL = %s", err.Error(), q)
+		return nil, &ErrDBQueryError{
+			Wrapped: err,
+			Message: "Error GetTenantSettings",
+			SQL:     q,
+		}
+	}
+	defer rows.Close()
+	ret := make(map[string]string)
+	for rows.Next() {
+		var key, value string
+		err := rows.Scan(&key, &value)
+		if err != nil {
+			fLog.Warnf("rows.Scan got  %s", err.Error())
+			return nil, &ErrDBScanError{
+				Wrapped: err,
+				Message: "Error GetTenantSettings",
+				SQL:     q,
+			}
+		}
+		ret[key] = value
+	}
+	return ret, nil
+}
+
+// SetTenantSetting create or replace a setting override of a tenant
+func (db *MySQLDB) SetTenantSetting(ctx context.Context, tenant *Tenant, key, value string) error {
+	fLog := mysqlLog.WithField("func", "SetTenantSetting").WithField("RequestID", ctx.Value(constants.RequestID))
+	q := "REPLACE INTO HANSIP_TENANT_SETTING(TENANT_REC_ID, SETTING_KEY, SETTING_VALUE) VALUES (?,?,?)"
+	_, err := db.conn(ctx).ExecContext(ctx, q, tenant.RecID, key, value)
+	if err != nil {
+		fLog.Errorf("db.instance.ExecContext got %s. SQL = %s", err.Error(), q)
+		return &ErrDBExecuteError{
+			Wrapped: err,
+			Message: "Error SetTenantSetting",
+			SQL:     q,
+		}
+	}
+	return nil
+}
+
+// DeleteTenantSettings removes all setting overrides of a tenant
+func (db *MySQLDB) DeleteTenantSettings(ctx context.Context, tenant *Tenant) error {
+	fLog := mysqlLog.WithField("func", "DeleteTenantSettings").WithField("RequestID", ctx.Value(constants.RequestID))
+	q := "DELETE FROM HANSIP_TENANT_SETTING WHERE TENANT_REC_ID=?"
+	_, err := db.conn(ctx).ExecContext(ctx, q, tenant.RecID)
+	if err != nil {
+		fLog.Errorf("db.instance.ExecContext got %s. SQL = %s", err.Error(), q)
+		return &ErrDBExecuteError{
+			Wrapped: err,
+			Message: "Error DeleteTenantSettings",
+			SQL:     q,
+		}
+	}
+	return nil
 }
 
 // GetUserByRecID get user data by its RecID
 func (db *MySQLDB) GetUserByRecID(ctx context.Context, recID string) (*User, error) {
 	fLog := mysqlLog.WithField("func", "GetUserByRecID").WithField("RequestID", ctx.Value(constants.RequestID))
 	user := &User{}
-	var enabled, suspended, enable2fa int
-	q := "SELECT REC_ID, EMAIL,HASHED_PASSPHRASE,ENABLED, SUSPENDED,LAST_SEEN,LAST_LOGIN,FAIL_COUNT,ACTIVATION_CODE,ACTIVATION_DATE,TOTP_KEY,ENABLE_2FE,TOKEN_2FE,RECOVERY_CODE FROM HANSIP_USER WHERE REC_ID = ?"
-	row := db.instance.QueryRowContext(ctx, q, recID)
+	var enabled, suspended, enable2fa, email2fa int
+	q := "SELECT REC_ID, EMAIL,HASHED_PASSPHRASE,ENABLED, SUSPENDED,LAST_SEEN,LAST_LOGIN,FAIL_COUNT,ACTIVATION_CODE,ACTIVATION_DATE,TOTP_KEY,ENABLE_2FE,TOKEN_2FE,RECOVERY_CODE,LOCALE,EMAIL_2FE,VERSION FROM HANSIP_USER WHERE REC_ID = ?"
+	row := db.conn(ctx).QueryRowContext(ctx, q, recID)
 	err := row.Scan(&user.RecID, &user.Email, &user.HashedPassphrase, &enabled, &suspended, &user.LastSeen, &user.LastLogin, &user.FailCount, &user.ActivationCode,
-		&user.ActivationDate, &user.UserTotpSecretKey, &enable2fa, &user.Token2FA, &user.RecoveryCode)
+		&user.ActivationDate, &user.UserTotpSecretKey, &enable2fa, &user.Token2FA, &user.RecoveryCode, &user.Locale, &email2fa, &user.Version)
 	if err != nil {
 		fLog.Errorf("row.Scan got %s", err.Error())
 		return nil, &ErrDBScanError{
@@ -809,6 +1524,9 @@ func (db *MySQLDB) GetUserByRecID(ctx context.Context, recID string) (*User, err
 	if enable2fa == 1 {
 		user.Enable2FactorAuth = true
 	}
+	if email2fa == 1 {
+		user.Enable2FactorEmail = true
+	}
 	return user, nil
 }
 
@@ -843,7 +1561,7 @@ func (db *MySQLDB) CreateUserRecord(ctx context.Context, email, passphrase strin
 
 	q := "INSERT INTO HANSIP_USER(REC_ID,EMAIL,HASHED_PASSPHRASE,ENABLED, SUSPENDED,LAST_SEEN,LAST_LOGIN,FAIL_COUNT,ACTIVATION_CODE,ACTIVATION_DATE,TOTP_KEY,ENABLE_2FE,TOKEN_2FE,RECOVERY_CODE) VALUES(?,?,?,?,?,?,?,?,?,?,?,?,?,?)"
 
-	_, err = db.instance.ExecContext(ctx, q,
+	_, err = db.conn(ctx).ExecContext(ctx, q,
 		user.RecID, user.Email, user.HashedPassphrase, 0, 0, user.LastSeen, user.LastLogin, user.FailCount, user.ActivationCode,
 		user.ActivationDate, user.UserTotpSecretKey, user.Enable2FactorAuth, user.Token2FA, user.RecoveryCode)
 
@@ -865,7 +1583,7 @@ func (db *MySQLDB) GetTOTPRecoveryCodes(ctx context.Context, user *User) ([]stri
 
 	ret := make([]string, 0)
 	q := "SELECT RECOVERY_CODE FROM HANSIP_TOTP_RECOVERY_CODES WHERE USER_REC_ID = ? && USED_FLAG = ?"
-	rows, err := db.instance.QueryContext(ctx, q, user.RecID, 0)
+	rows, err := db.conn(ctx).QueryContext(ctx, q, user.RecID, 0)
 	if err != nil {
 		fLog.Errorf("db.instance.QueryContext got %s. SQL = %s", err.Error(), q)
 		return nil, &ErrDBQueryError{
@@ -897,7 +1615,7 @@ func (db *MySQLDB) RecreateTOTPRecoveryCodes(ctx context.Context, user *User) ([
 
 	// first we clear out all existing codes.
 	q := "DELETE FROM HANSIP_TOTP_RECOVERY_CODES WHERE USER_REC_ID = ?"
-	_, err := db.instance.ExecContext(ctx, q, user.RecID)
+	_, err := db.conn(ctx).ExecContext(ctx, q, user.RecID)
 	if err != nil {
 		fLog.Errorf("db.instance.ExecContext got %s. SQL = %s", err.Error(), q)
 		return nil, &ErrDBExecuteError{
@@ -913,7 +1631,7 @@ func (db *MySQLDB) RecreateTOTPRecoveryCodes(ctx context.Context, user *User) ([
 		recID := helper.MakeRandomString(10, true, true, true, false)
 		code := helper.MakeRandomString(8, true, false, true, false)
 		q = "INSERT INTO HANSIP_TOTP_RECOVERY_CODES(REC_ID, RECOVERY_CODE, USED_FLAG, USER_REC_ID) VALUES (?,?,?,?)"
-		_, err := db.instance.ExecContext(ctx, q, recID, code, 0, user.RecID)
+		_, err := db.conn(ctx).ExecContext(ctx, q, recID, code, 0, user.RecID)
 		if err != nil {
 			fLog.Errorf("db.instance.ExecContext got %s. SQL = %s", err.Error(), q)
 			return nil, &ErrDBExecuteError{
@@ -935,7 +1653,7 @@ func (db *MySQLDB) MarkTOTPRecoveryCodeUsed(ctx context.Context, user *User, cod
 	rexp := regexp.MustCompile(`^[A-Z0-9]{8}$`)
 	if rexp.Match([]byte(code)) {
 		q := "UPDATE HANSIP_TOTP_RECOVERY_CODES SET USED_FLAG = ? WHERE USER_REC_ID = ? AND RECOVERY_CODE=?"
-		_, err := db.instance.ExecContext(ctx, q, 1, user.RecID, code)
+		_, err := db.conn(ctx).ExecContext(ctx, q, 1, user.RecID, code)
 		if err != nil {
 			fLog.Errorf("db.instance.ExecContext got %s. SQL = %s", err.Error(), q)
 			return &ErrDBExecuteError{
@@ -954,11 +1672,11 @@ func (db *MySQLDB) MarkTOTPRecoveryCodeUsed(ctx context.Context, user *User, cod
 func (db *MySQLDB) GetUserByEmail(ctx context.Context, email string) (*User, error) {
 	fLog := mysqlLog.WithField("func", "GetUserByEmail").WithField("RequestID", ctx.Value(constants.RequestID))
 	user := &User{}
-	var enabled, suspended, enable2fa int
-	q := "SELECT REC_ID, EMAIL,HASHED_PASSPHRASE,ENABLED, SUSPENDED,LAST_SEEN,LAST_LOGIN,FAIL_COUNT,ACTIVATION_CODE,ACTIVATION_DATE,TOTP_KEY,ENABLE_2FE,TOKEN_2FE,RECOVERY_CODE FROM HANSIP_USER WHERE EMAIL = ?"
-	row := db.instance.QueryRowContext(ctx, q, email)
+	var enabled, suspended, enable2fa, email2fa int
+	q := "SELECT REC_ID, EMAIL,HASHED_PASSPHRASE,ENABLED, SUSPENDED,LAST_SEEN,LAST_LOGIN,FAIL_COUNT,ACTIVATION_CODE,ACTIVATION_DATE,TOTP_KEY,ENABLE_2FE,TOKEN_2FE,RECOVERY_CODE,LOCALE,EMAIL_2FE,VERSION FROM HANSIP_USER WHERE EMAIL = ?"
+	row := db.conn(ctx).QueryRowContext(ctx, q, email)
 	err := row.Scan(&user.RecID, &user.Email, &user.HashedPassphrase, &enabled, &suspended, &user.LastSeen, &user.LastLogin, &user.FailCount, &user.ActivationCode,
-		&user.ActivationDate, &user.UserTotpSecretKey, &enable2fa, &user.Token2FA, &user.RecoveryCode)
+		&user.ActivationDate, &user.UserTotpSecretKey, &enable2fa, &user.Token2FA, &user.RecoveryCode, &user.Locale, &email2fa, &user.Version)
 	if err != nil {
 		fLog.Errorf("row.Scan got %s", err.Error())
 		return nil, &ErrDBScanError{
@@ -976,6 +1694,9 @@ func (db *MySQLDB) GetUserByEmail(ctx context.Context, email string) (*User, err
 	if enable2fa == 1 {
 		user.Enable2FactorAuth = true
 	}
+	if email2fa == 1 {
+		user.Enable2FactorEmail = true
+	}
 	return user, nil
 }
 
@@ -983,11 +1704,11 @@ func (db *MySQLDB) GetUserByEmail(ctx context.Context, email string) (*User, err
 func (db *MySQLDB) GetUserBy2FAToken(ctx context.Context, token string) (*User, error) {
 	fLog := mysqlLog.WithField("func", "GetUserBy2FAToken").WithField("RequestID", ctx.Value(constants.RequestID))
 	user := &User{}
-	var enabled, suspended, enable2fa int
-	q := "SELECT REC_ID, EMAIL,HASHED_PASSPHRASE,ENABLED, SUSPENDED,LAST_SEEN,LAST_LOGIN,FAIL_COUNT,ACTIVATION_CODE,ACTIVATION_DATE,TOTP_KEY,ENABLE_2FE,TOKEN_2FE,RECOVERY_CODE FROM HANSIP_USER WHERE TOKEN_2FE = ?"
-	row := db.instance.QueryRowContext(ctx, q, token)
+	var enabled, suspended, enable2fa, email2fa int
+	q := "SELECT REC_ID, EMAIL,HASHED_PASSPHRASE,ENABLED, SUSPENDED,LAST_SEEN,LAST_LOGIN,FAIL_COUNT,ACTIVATION_CODE,ACTIVATION_DATE,TOTP_KEY,ENABLE_2FE,TOKEN_2FE,RECOVERY_CODE,LOCALE,EMAIL_2FE,VERSION FROM HANSIP_USER WHERE TOKEN_2FE = ?"
+	row := db.conn(ctx).QueryRowContext(ctx, q, token)
 	err := row.Scan(&user.RecID, &user.Email, &user.HashedPassphrase, &enabled, &suspended, &user.LastSeen, &user.LastLogin, &user.FailCount, &user.ActivationCode,
-		&user.ActivationDate, &user.UserTotpSecretKey, &enable2fa, &user.Token2FA, &user.RecoveryCode)
+		&user.ActivationDate, &user.UserTotpSecretKey, &enable2fa, &user.Token2FA, &user.RecoveryCode, &user.Locale, &email2fa, &user.Version)
 	if err != nil {
 		fLog.Errorf("row.Scan got %s", err.Error())
 		return nil, &ErrDBScanError{
@@ -1005,6 +1726,9 @@ func (db *MySQLDB) GetUserBy2FAToken(ctx context.Context, token string) (*User,
 	if enable2fa == 1 {
 		user.Enable2FactorAuth = true
 	}
+	if email2fa == 1 {
+		user.Enable2FactorEmail = true
+	}
 	return user, nil
 }
 
@@ -1012,11 +1736,11 @@ func (db *MySQLDB) GetUserBy2FAToken(ctx context.Context, token string) (*User,
 func (db *MySQLDB) GetUserByRecoveryToken(ctx context.Context, token string) (*User, error) {
 	fLog := mysqlLog.WithField("func", "GetUserByRecoveryToken").WithField("RequestID", ctx.Value(constants.RequestID))
 	user := &User{}
-	var enabled, suspended, enable2fa int
-	q := "SELECT REC_ID, EMAIL,HASHED_PASSPHRASE,ENABLED, SUSPENDED,LAST_SEEN,LAST_LOGIN,FAIL_COUNT,ACTIVATION_CODE,ACTIVATION_DATE,TOTP_KEY,ENABLE_2FE,TOKEN_2FE,RECOVERY_CODE FROM HANSIP_USER WHERE RECOVERY_CODE = ?"
-	row := db.instance.QueryRowContext(ctx, q, token)
+	var enabled, suspended, enable2fa, email2fa int
+	q := "SELECT REC_ID, EMAIL,HASHED_PASSPHRASE,ENABLED, SUSPENDED,LAST_SEEN,LAST_LOGIN,FAIL_COUNT,ACTIVATION_CODE,ACTIVATION_DATE,TOTP_KEY,ENABLE_2FE,TOKEN_2FE,RECOVERY_CODE,LOCALE,EMAIL_2FE,VERSION FROM HANSIP_USER WHERE RECOVERY_CODE = ?"
+	row := db.conn(ctx).QueryRowContext(ctx, q, token)
 	err := row.Scan(&user.RecID, &user.Email, &user.HashedPassphrase, &enabled, &suspended, &user.LastSeen, &user.LastLogin, &user.FailCount, &user.ActivationCode,
-		&user.ActivationDate, &user.UserTotpSecretKey, &enable2fa, &user.Token2FA, &user.RecoveryCode)
+		&user.ActivationDate, &user.UserTotpSecretKey, &enable2fa, &user.Token2FA, &user.RecoveryCode, &user.Locale, &email2fa, &user.Version)
 	if err != nil {
 		fLog.Errorf("row.Scan got %s", err.Error())
 		return nil, &ErrDBScanError{
@@ -1034,6 +1758,9 @@ func (db *MySQLDB) GetUserByRecoveryToken(ctx context.Context, token string) (*U
 	if enable2fa == 1 {
 		user.Enable2FactorAuth = true
 	}
+	if email2fa == 1 {
+		user.Enable2FactorEmail = true
+	}
 	return user, nil
 }
 
@@ -1041,7 +1768,7 @@ func (db *MySQLDB) GetUserByRecoveryToken(ctx context.Context, token string) (*U
 func (db *MySQLDB) DeleteUser(ctx context.Context, user *User) error {
 	fLog := mysqlLog.WithField("func", "DeleteUser").WithField("RequestID", ctx.Value(constants.RequestID))
 	q := "DELETE FROM HANSIP_USER WHERE REC_ID=?"
-	_, err := db.instance.ExecContext(ctx, q, user.RecID)
+	_, err := db.conn(ctx).ExecContext(ctx, q, user.RecID)
 	if err != nil {
 		fLog.Errorf("db.instance.ExecContext got %s. SQL = %s", err.Error(), q)
 		return &ErrDBExecuteError{
@@ -1059,7 +1786,7 @@ func (db *MySQLDB) IsUserRecIDExist(ctx context.Context, recID string) (bool, er
 
 	q := "SELECT COUNT(*) AS CNT FROM HANSIP_USER WHERE REC_ID=?"
 
-	rows, err := db.instance.QueryContext(ctx, q, recID)
+	rows, err := db.conn(ctx).QueryContext(ctx, q, recID)
 	if err != nil {
 		fLog.Errorf("db.instance.ExecContext got %s. SQL = %s", err.Error(), q)
 		return false, &ErrDBQueryError{
@@ -1107,21 +1834,19 @@ func (db *MySQLDB) UpdateUser(ctx context.Context, user *User) error {
 	if user.Enable2FactorAuth {
 		enable2fa = 1
 	}
+	email2fa := 0
+	if user.Enable2FactorEmail {
+		email2fa = 1
+	}
 
-	// q := "UPDATE HANSIP_USER SET EMAIL=?,HASHED_PASSPHRASE=?,ENABLED=?, SUSPENDED=?,LAST_SEEN=?,LAST_LOGIN=?,FAIL_COUNT=?,ACTIVATION_CODE=?,ACTIVATION_DATE=?,TOTP_KEY=?,ENABLE_2FE=?,TOKEN_2FE=?,RECOVERY_CODE=? WHERE REC_ID=?"
-
-	q := fmt.Sprintf("UPDATE HANSIP_USER SET EMAIL='%s',HASHED_PASSPHRASE='%s',ENABLED=%d, SUSPENDED=%d,LAST_SEEN='%s',LAST_LOGIN='%s',FAIL_COUNT='%d',ACTIVATION_CODE='%s',ACTIVATION_DATE='%s',TOTP_KEY='%s',ENABLE_2FE=%d,TOKEN_2FE='%s',RECOVERY_CODE='%s' WHERE REC_ID='%s';", user.Email, user.HashedPassphrase, enabled, suspended, user.LastSeen.Format("2006-01-02 15:04:05"), user.LastLogin.Format("2006-01-02 15:04:05"), user.FailCount, user.ActivationCode,
-		user.ActivationDate.Format("2006-01-02 15:04:05"), user.UserTotpSecretKey, enable2fa, user.Token2FA, user.RecoveryCode, user.RecID)
+	// every value is a parameter, the email and locale come from the requests. Times are sent in the same
+	// format they used to be written in, so zero times are stored the way they have always been.
+	q := "UPDATE HANSIP_USER SET EMAIL=?,HASHED_PASSPHRASE=?,ENABLED=?, SUSPENDED=?,LAST_SEEN=?,LAST_LOGIN=?,FAIL_COUNT=?,ACTIVATION_CODE=?,ACTIVATION_DATE=?,TOTP_KEY=?,ENABLE_2FE=?,TOKEN_2FE=?,RECOVERY_CODE=?,LOCALE=?,EMAIL_2FE=?,VERSION=VERSION+1 WHERE REC_ID=? AND VERSION=?"
 
 	fLog.Infof("Updating user %s", user.Email)
-	//_, err = db.instance.ExecContext(ctx, q,
-	//	user.Email, user.HashedPassphrase, enabled, suspended, user.LastSeen, user.LastLogin, user.FailCount, user.ActivationCode,
-	//	user.ActivationDate, user.UserTotpSecretKey, enable2fa, user.Token2FA, user.RecoveryCode, user.RecID)
-	_, err = db.instance.ExecContext(ctx, q)
-	//_, err = db.instance.Exec(q)
-	//sParams := fmt.Sprintln(user.Email, user.HashedPassphrase, enabled, suspended, user.LastSeen, user.LastLogin, user.FailCount, user.ActivationCode,
-	//	user.ActivationDate, user.UserTotpSecretKey, enable2fa, user.Token2FA, user.RecoveryCode, user.RecID)
-	//fLog.Warn(sParams)
+	result, err := db.conn(ctx).ExecContext(ctx, q,
+		user.Email, user.HashedPassphrase, enabled, suspended, user.LastSeen.Format("2006-01-02 15:04:05"), user.LastLogin.Format("2006-01-02 15:04:05"), user.FailCount, user.ActivationCode,
+		user.ActivationDate.Format("2006-01-02 15:04:05"), user.UserTotpSecretKey, enable2fa, user.Token2FA, user.RecoveryCode, user.Locale, email2fa, user.RecID, user.Version)
 	if err != nil {
 		fLog.Errorf("db.instance.ExecContext got %s. SQL = %s", err.Error(), q)
 		return &ErrDBExecuteError{
@@ -1130,21 +1855,41 @@ func (db *MySQLDB) UpdateUser(ctx context.Context, user *User) error {
 			SQL:     q,
 		}
 	}
+	if affected, err := result.RowsAffected(); err == nil && affected == 0 {
+		return &ErrDBConflict{
+			Message: fmt.Sprintf("user %s has been changed since it was read", user.RecID),
+			SQL:     q,
+		}
+	}
+	user.Version++
 	return nil
 }
 
 // ListUser list all user paginated
 func (db *MySQLDB) ListUser(ctx context.Context, request *helper.PageRequest) ([]*User, *helper.Page, error) {
 	fLog := mysqlLog.WithField("func", "ListUser").WithField("RequestID", ctx.Value(constants.RequestID))
-	count, err := db.Count(ctx)
+	query, err := newListQuery(request, userListColumns, "", "EMAIL")
 	if err != nil {
-		fLog.Errorf("db.Count got  %s", err.Error())
 		return nil, nil, err
 	}
-	page := helper.NewPage(request, uint(count))
+	count := 0
+	q := "SELECT COUNT(*) AS CNT FROM HANSIP_USER WHERE 1=1" + query.filter
+	if query.counted() {
+		row := db.conn(ctx).QueryRowContext(ctx, q, query.countArgs()...)
+		err = row.Scan(&count)
+		if err != nil {
+			fLog.Errorf("row.Scan got  %s", err.Error())
+			return nil, nil, &ErrDBScanError{
+				Wrapped: err,
+				Message: "Error ListUser",
+				SQL:     q,
+			}
+		}
+	}
+	page := query.page(count)
 	userList := make([]*User, 0)
-	q := fmt.Sprintf("SELECT REC_ID, EMAIL,HASHED_PASSPHRASE,ENABLED, SUSPENDED,LAST_SEEN,LAST_LOGIN,FAIL_COUNT,ACTIVATION_CODE,ACTIVATION_DATE,TOTP_KEY,ENABLE_2FE,TOKEN_2FE,RECOVERY_CODE FROM HANSIP_USER ORDER BY EMAIL %s LIMIT %d, %d", request.Sort, page.OffsetStart, page.OffsetEnd-page.OffsetStart)
-	rows, err := db.instance.QueryContext(ctx, q)
+	q = fmt.Sprintf("SELECT REC_ID, EMAIL,HASHED_PASSPHRASE,ENABLED, SUSPENDED,LAST_SEEN,LAST_LOGIN,FAIL_COUNT,ACTIVATION_CODE,ACTIVATION_DATE,TOTP_KEY,ENABLE_2FE,TOKEN_2FE,RECOVERY_CODE,LOCALE,EMAIL_2FE,VERSION FROM HANSIP_USER WHERE 1=1%s ORDER BY %s LIMIT %s", query.where(), query.orderBy(), query.limit(page))
+	rows, err := db.conn(ctx).QueryContext(ctx, q, query.args()...)
 	if err != nil {
 		fLog.Errorf("db.instance.QueryContext got %s. SQL = %s", err.Error(), q)
 		return nil, nil, &ErrDBQueryError{
@@ -1155,9 +1900,9 @@ func (db *MySQLDB) ListUser(ctx context.Context, request *helper.PageRequest) ([
 	}
 	for rows.Next() {
 		user := &User{}
-		var enabled, suspended, enable2fa int
+		var enabled, suspended, enable2fa, email2fa int
 		err := rows.Scan(&user.RecID, &user.Email, &user.HashedPassphrase, &enabled, &suspended, &user.LastSeen, &user.LastLogin, &user.FailCount, &user.ActivationCode,
-			&user.ActivationDate, &user.UserTotpSecretKey, &enable2fa, &user.Token2FA, &user.RecoveryCode)
+			&user.ActivationDate, &user.UserTotpSecretKey, &enable2fa, &user.Token2FA, &user.RecoveryCode, &user.Locale, &email2fa, &user.Version)
 		if err != nil {
 			fLog.Warnf("rows.Scan got %s", err.Error())
 			return nil, nil, &ErrDBScanError{
@@ -1175,10 +1920,13 @@ func (db *MySQLDB) ListUser(ctx context.Context, request *helper.PageRequest) ([
 			if enable2fa == 1 {
 				user.Enable2FactorAuth = true
 			}
+			if email2fa == 1 {
+				user.Enable2FactorEmail = true
+			}
 			userList = append(userList, user)
 		}
 	}
-	return userList, page, nil
+	return userList[:query.paginate(page, userList)], page, nil
 }
 
 // Count all user
@@ -1186,7 +1934,7 @@ func (db *MySQLDB) Count(ctx context.Context) (int, error) {
 	fLog := mysqlLog.WithField("func", "Count").WithField("RequestID", ctx.Value(constants.RequestID))
 	count := 0
 	q := "SELECT COUNT(*) as CNT FROM HANSIP_USER"
-	err := db.instance.QueryRowContext(ctx, q).Scan(&count)
+	err := db.conn(ctx).QueryRowContext(ctx, q).Scan(&count)
 	if err != nil {
 		fLog.Errorf("db.instance.QueryRowContext got %s", err.Error())
 		return 0, &ErrDBQueryError{
@@ -1201,9 +1949,13 @@ func (db *MySQLDB) Count(ctx context.Context) (int, error) {
 // ListAllUserRoles list all user's roles direct and indirect
 func (db *MySQLDB) ListAllUserRoles(ctx context.Context, user *User, request *helper.PageRequest) ([]*Role, *helper.Page, error) {
 	fLog := mysqlLog.WithField("func", "ListAllUserRoles").WithField("RequestID", ctx.Value(constants.RequestID))
+	query, err := newListQuery(request, roleListColumns, "R", "ROLE_NAME")
+	if err != nil {
+		return nil, nil, err
+	}
 	roleMap := make(map[string]*Role)
-	q := "SELECT R.REC_ID, R.ROLE_NAME, R.ROLE_DOMAIN, R.DESCRIPTION FROM HANSIP_ROLE R, HANSIP_USER_ROLE UR WHERE R.REC_ID = UR.ROLE_REC_ID AND UR.USER_REC_ID = ?"
-	rows, err := db.instance.QueryContext(ctx, q, user.RecID)
+	q := "SELECT R.REC_ID, R.ROLE_NAME, R.ROLE_DOMAIN, R.DESCRIPTION, R.VERSION FROM HANSIP_ROLE R, HANSIP_USER_ROLE UR WHERE R.REC_ID = UR.ROLE_REC_ID AND UR.USER_REC_ID = ?" + query.filter
+	rows, err := db.conn(ctx).QueryContext(ctx, q, query.countArgs(user.RecID)...)
 	if err != nil {
 		fLog.Errorf("db.instance.QueryContext got  %s. SQL = %s", err.Error(), q)
 		return nil, nil, &ErrDBQueryError{
@@ -1214,7 +1966,7 @@ func (db *MySQLDB) ListAllUserRoles(ctx context.Context, user *User, request *he
 	}
 	for rows.Next() {
 		r := &Role{}
-		err = rows.Scan(&r.RecID, &r.RoleName, &r.RoleDomain, &r.Description)
+		err = rows.Scan(&r.RecID, &r.RoleName, &r.RoleDomain, &r.Description, &r.Version)
 		if err != nil {
 			fLog.Warnf("rows.Scan got  %s", err.Error())
 			return nil, nil, &ErrDBScanError{
@@ -1226,8 +1978,8 @@ func (db *MySQLDB) ListAllUserRoles(ctx context.Context, user *User, request *he
 			roleMap[r.RecID] = r
 		}
 	}
-	q = "SELECT DISTINCT R.REC_ID, R.ROLE_NAME, R.ROLE_DOMAIN, R.DESCRIPTION FROM HANSIP_ROLE R, HANSIP_GROUP_ROLE GR, HANSIP_USER_GROUP UG WHERE R.REC_ID = GR.ROLE_REC_ID AND GR.GROUP_REC_ID = UG.GROUP_REC_ID AND UG.USER_REC_ID = ?"
-	rows, err = db.instance.QueryContext(ctx, q, user.RecID)
+	q = "SELECT DISTINCT R.REC_ID, R.ROLE_NAME, R.ROLE_DOMAIN, R.DESCRIPTION, R.VERSION FROM HANSIP_ROLE R, HANSIP_GROUP_ROLE GR, HANSIP_USER_GROUP UG WHERE R.REC_ID = GR.ROLE_REC_ID AND GR.GROUP_REC_ID = UG.GROUP_REC_ID AND UG.USER_REC_ID = ?" + query.filter
+	rows, err = db.conn(ctx).QueryContext(ctx, q, query.countArgs(user.RecID)...)
 	if err != nil {
 		fLog.Errorf("db.instance.QueryContext got  %s. SQL = %s", err.Error(), q)
 		return nil, nil, &ErrDBQueryError{
@@ -1238,7 +1990,7 @@ func (db *MySQLDB) ListAllUserRoles(ctx context.Context, user *User, request *he
 	}
 	for rows.Next() {
 		r := &Role{}
-		err = rows.Scan(&r.RecID, &r.RoleName, &r.RoleDomain, &r.Description)
+		err = rows.Scan(&r.RecID, &r.RoleName, &r.RoleDomain, &r.Description, &r.Version)
 		if err != nil {
 			fLog.Warnf("rows.Scan got  %s", err.Error())
 			return nil, nil, &ErrDBScanError{
@@ -1251,30 +2003,19 @@ func (db *MySQLDB) ListAllUserRoles(ctx context.Context, user *User, request *he
 		}
 	}
 
-	page := helper.NewPage(request, uint(len(roleMap)))
-	roles := make([]*Role, 0)
+	roles := make([]*Role, 0, len(roleMap))
 	for _, v := range roleMap {
 		roles = append(roles, v)
 	}
-	if request.OrderBy == "ROLE_NAME" {
-		if request.Sort == "ASC" {
-			sort.SliceStable(roles, func(i, j int) bool {
-				return roles[i].RoleName < roles[j].RoleName
-			})
-		} else {
-			sort.SliceStable(roles, func(i, j int) bool {
-				return roles[i].RoleName > roles[j].RoleName
-			})
-		}
-	}
-	return roles[page.OffsetStart:page.OffsetEnd], page, nil
+	page := query.page(len(roles))
+	return query.window(page, roles).([]*Role), page, nil
 }
 
 // GetUserRole return user's assigned roles
 func (db *MySQLDB) GetUserRole(ctx context.Context, user *User, role *Role) (*UserRole, error) {
 	fLog := mysqlLog.WithField("func", "GetUserRole").WithField("RequestID", ctx.Value(constants.RequestID))
 	q := "SELECT COUNT(*) CNT FROM HANSIP_USER_ROLE WHERE USER_REC_ID=? AND ROLE_REC_ID=?"
-	row := db.instance.QueryRowContext(ctx, q, user.RecID, role.RecID)
+	row := db.conn(ctx).QueryRowContext(ctx, q, user.RecID, role.RecID)
 	count := 0
 	err := row.Scan(&count)
 	if err != nil {
@@ -1301,7 +2042,7 @@ func (db *MySQLDB) GetUserRole(ctx context.Context, user *User, role *Role) (*Us
 func (db *MySQLDB) CreateUserRole(ctx context.Context, user *User, role *Role) (*UserRole, error) {
 	fLog := mysqlLog.WithField("func", "CreateUserRole").WithField("RequestID", ctx.Value(constants.RequestID))
 	q := "INSERT INTO HANSIP_USER_ROLE(USER_REC_ID, ROLE_REC_ID) VALUES (?,?)"
-	_, err := db.instance.ExecContext(ctx, q, user.RecID, role.RecID)
+	_, err := db.conn(ctx).ExecContext(ctx, q, user.RecID, role.RecID)
 	if err != nil {
 		fLog.Errorf("db.instance.ExecContext got %s. SQL = %s", err.Error(), q)
 		return nil, &ErrDBExecuteError{
@@ -1319,22 +2060,28 @@ func (db *MySQLDB) CreateUserRole(ctx context.Context, user *User, role *Role) (
 // ListUserRoleByUser get all roles assigned to a user, paginated
 func (db *MySQLDB) ListUserRoleByUser(ctx context.Context, user *User, request *helper.PageRequest) ([]*Role, *helper.Page, error) {
 	fLog := mysqlLog.WithField("func", "ListUserRoleByUser").WithField("RequestID", ctx.Value(constants.RequestID))
-	q := "SELECT COUNT(*) FROM HANSIP_USER_ROLE WHERE USER_REC_ID=?"
-	row := db.instance.QueryRowContext(ctx, q, user.RecID)
-	count := 0
-	err := row.Scan(&count)
+	query, err := newListQuery(request, roleListColumns, "R", "ROLE_NAME")
 	if err != nil {
-		fLog.Errorf("row.Scan got  %s", err.Error())
-		return nil, nil, &ErrDBScanError{
-			Wrapped: err,
-			Message: "Error ListUserRoleByUser",
-			SQL:     q,
+		return nil, nil, err
+	}
+	count := 0
+	q := "SELECT COUNT(*) FROM HANSIP_USER_ROLE UR, HANSIP_ROLE R WHERE UR.ROLE_REC_ID = R.REC_ID AND UR.USER_REC_ID = ?" + query.filter
+	if query.counted() {
+		row := db.conn(ctx).QueryRowContext(ctx, q, query.countArgs(user.RecID)...)
+		err = row.Scan(&count)
+		if err != nil {
+			fLog.Errorf("row.Scan got  %s", err.Error())
+			return nil, nil, &ErrDBScanError{
+				Wrapped: err,
+				Message: "Error ListUserRoleByUser",
+				SQL:     q,
+			}
 		}
 	}
-	page := helper.NewPage(request, uint(count))
-	q = fmt.Sprintf("SELECT R.REC_ID, R.ROLE_NAME, R.ROLE_DOMAIN, R.DESCRIPTION FROM HANSIP_USER_ROLE UR, HANSIP_ROLE R WHERE UR.ROLE_REC_ID = R.REC_ID AND UR.USER_REC_ID = ? ORDER BY R.ROLE_NAME %s LIMIT %d, %d", request.Sort, page.OffsetStart, page.OffsetEnd-page.OffsetStart)
+	page := query.page(count)
+	q = fmt.Sprintf("SELECT R.REC_ID, R.ROLE_NAME, R.ROLE_DOMAIN, R.DESCRIPTION, R.VERSION FROM HANSIP_USER_ROLE UR, HANSIP_ROLE R WHERE UR.ROLE_REC_ID = R.REC_ID AND UR.USER_REC_ID = ? %s ORDER BY %s LIMIT %s", query.where(), query.orderBy(), query.limit(page))
 	ret := make([]*Role, 0)
-	rows, err := db.instance.QueryContext(ctx, q, user.RecID)
+	rows, err := db.conn(ctx).QueryContext(ctx, q, query.args(user.RecID)...)
 	if err != nil {
 		fLog.Errorf("db.instance.QueryContext got  %s. SQL = %s", err.Error(), q)
 		return nil, nil, &ErrDBQueryError{
@@ -1345,7 +2092,7 @@ func (db *MySQLDB) ListUserRoleByUser(ctx context.Context, user *User, request *
 	}
 	for rows.Next() {
 		r := &Role{}
-		err := rows.Scan(&r.RecID, &r.RoleName, &r.RoleDomain, &r.Description)
+		err := rows.Scan(&r.RecID, &r.RoleName, &r.RoleDomain, &r.Description, &r.Version)
 		if err != nil {
 			fLog.Warnf("rows.Scan got  %s", err.Error())
 			return nil, nil, &ErrDBScanError{
@@ -1357,28 +2104,34 @@ func (db *MySQLDB) ListUserRoleByUser(ctx context.Context, user *User, request *
 			ret = append(ret, r)
 		}
 	}
-	return ret, page, nil
+	return ret[:query.paginate(page, ret)], page, nil
 }
 
 // ListUserRoleByRole list all user that related to a role
 func (db *MySQLDB) ListUserRoleByRole(ctx context.Context, role *Role, request *helper.PageRequest) ([]*User, *helper.Page, error) {
 	fLog := mysqlLog.WithField("func", "ListUserRoleByRole").WithField("RequestID", ctx.Value(constants.RequestID))
-	q := "SELECT COUNT(*) FROM HANSIP_USER_ROLE WHERE ROLE_REC_ID=?"
-	row := db.instance.QueryRowContext(ctx, q, role.RecID)
-	count := 0
-	err := row.Scan(&count)
+	query, err := newListQuery(request, userListColumns, "R", "EMAIL")
 	if err != nil {
-		fLog.Errorf("row.Scan got  %s", err.Error())
-		return nil, nil, &ErrDBScanError{
-			Wrapped: err,
-			Message: "Error ListUserRoleByRole",
-			SQL:     q,
+		return nil, nil, err
+	}
+	count := 0
+	q := "SELECT COUNT(*) FROM HANSIP_USER_ROLE UR, HANSIP_USER R WHERE UR.USER_REC_ID = R.REC_ID AND UR.ROLE_REC_ID = ?" + query.filter
+	if query.counted() {
+		row := db.conn(ctx).QueryRowContext(ctx, q, query.countArgs(role.RecID)...)
+		err = row.Scan(&count)
+		if err != nil {
+			fLog.Errorf("row.Scan got  %s", err.Error())
+			return nil, nil, &ErrDBScanError{
+				Wrapped: err,
+				Message: "Error ListUserRoleByRole",
+				SQL:     q,
+			}
 		}
 	}
-	page := helper.NewPage(request, uint(count))
-	q = fmt.Sprintf("SELECT R.REC_ID,R.EMAIL,R.HASHED_PASSPHRASE,R.ENABLED, R.SUSPENDED,R.LAST_SEEN,R.LAST_LOGIN,R.FAIL_COUNT,R.ACTIVATION_CODE,R.ACTIVATION_DATE,R.TOTP_KEY,R.ENABLE_2FE,R.TOKEN_2FE,R.RECOVERY_CODE FROM HANSIP_USER_ROLE UR, HANSIP_USER R WHERE UR.USER_REC_ID = R.REC_ID AND UR.ROLE_REC_ID = ? ORDER BY R.EMAIL %s LIMIT %d, %d", request.Sort, page.OffsetStart, page.OffsetEnd-page.OffsetStart)
+	page := query.page(count)
+	q = fmt.Sprintf("SELECT R.REC_ID,R.EMAIL,R.HASHED_PASSPHRASE,R.ENABLED, R.SUSPENDED,R.LAST_SEEN,R.LAST_LOGIN,R.FAIL_COUNT,R.ACTIVATION_CODE,R.ACTIVATION_DATE,R.TOTP_KEY,R.ENABLE_2FE,R.TOKEN_2FE,R.RECOVERY_CODE,R.LOCALE,R.EMAIL_2FE,R.VERSION FROM HANSIP_USER_ROLE UR, HANSIP_USER R WHERE UR.USER_REC_ID = R.REC_ID AND UR.ROLE_REC_ID = ? %s ORDER BY %s LIMIT %s", query.where(), query.orderBy(), query.limit(page))
 	ret := make([]*User, 0)
-	rows, err := db.instance.QueryContext(ctx, q, role.RecID)
+	rows, err := db.conn(ctx).QueryContext(ctx, q, query.args(role.RecID)...)
 	if err != nil {
 		fLog.Errorf("db.instance.QueryContext got  %s. SQL = %s", err.Error(), q)
 		return nil, nil, &ErrDBQueryError{
@@ -1389,9 +2142,9 @@ func (db *MySQLDB) ListUserRoleByRole(ctx context.Context, role *Role, request *
 	}
 	for rows.Next() {
 		user := &User{}
-		var enabled, suspended, enable2fa int
+		var enabled, suspended, enable2fa, email2fa int
 		err := rows.Scan(&user.RecID, &user.Email, &user.HashedPassphrase, &enabled, &suspended, &user.LastSeen, &user.LastLogin, &user.FailCount, &user.ActivationCode,
-			&user.ActivationDate, &user.UserTotpSecretKey, &enable2fa, &user.Token2FA, &user.RecoveryCode)
+			&user.ActivationDate, &user.UserTotpSecretKey, &enable2fa, &user.Token2FA, &user.RecoveryCode, &user.Locale, &email2fa, &user.Version)
 		if err != nil {
 			fLog.Warnf("rows.Scan got  %s", err.Error())
 			return nil, nil, &ErrDBScanError{
@@ -1409,17 +2162,20 @@ func (db *MySQLDB) ListUserRoleByRole(ctx context.Context, role *Role, request *
 			if enable2fa == 1 {
 				user.Enable2FactorAuth = true
 			}
+			if email2fa == 1 {
+				user.Enable2FactorEmail = true
+			}
 			ret = append(ret, user)
 		}
 	}
-	return ret, page, nil
+	return ret[:query.paginate(page, ret)], page, nil
 }
 
 // DeleteUserRole remove a role from user's assigment
 func (db *MySQLDB) DeleteUserRole(ctx context.Context, userRole *UserRole) error {
 	fLog := mysqlLog.WithField("func", "DeleteUserRole").WithField("RequestID", ctx.Value(constants.RequestID))
 	q := "DELETE FROM HANSIP_USER_ROLE WHERE USER_REC_ID=? AND ROLE_REC_ID=?"
-	_, err := db.instance.ExecContext(ctx, q, userRole.UserRecID, userRole.RoleRecID)
+	_, err := db.conn(ctx).ExecContext(ctx, q, userRole.UserRecID, userRole.RoleRecID)
 	if err != nil {
 		fLog.Errorf("db.instance.ExecContext got  %s. SQL = %s", err.Error(), q)
 		return &ErrDBExecuteError{
@@ -1435,7 +2191,7 @@ func (db *MySQLDB) DeleteUserRole(ctx context.Context, userRole *UserRole) error
 func (db *MySQLDB) DeleteUserRoleByUser(ctx context.Context, user *User) error {
 	fLog := mysqlLog.WithField("func", "DeleteUserRoleByUser").WithField("RequestID", ctx.Value(constants.RequestID))
 	q := "DELETE FROM HANSIP_USER_ROLE WHERE USER_REC_ID=?"
-	_, err := db.instance.ExecContext(ctx, q, user.RecID)
+	_, err := db.conn(ctx).ExecContext(ctx, q, user.RecID)
 	if err != nil {
 		fLog.Errorf("db.instance.ExecContext got  %s. SQL = %s", err.Error(), q)
 		return &ErrDBExecuteError{
@@ -1451,7 +2207,7 @@ func (db *MySQLDB) DeleteUserRoleByUser(ctx context.Context, user *User) error {
 func (db *MySQLDB) DeleteUserRoleByRole(ctx context.Context, role *Role) error {
 	fLog := mysqlLog.WithField("func", "DeleteUserRoleByRole").WithField("RequestID", ctx.Value(constants.RequestID))
 	q := "DELETE FROM HANSIP_USER_ROLE WHERE ROLE_REC_ID=?"
-	_, err := db.instance.ExecContext(ctx, q, role.RecID)
+	_, err := db.conn(ctx).ExecContext(ctx, q, role.RecID)
 	if err != nil {
 		fLog.Errorf("db.instance.ExecContext got  %s. SQL = %s", err.Error(), q)
 		return &ErrDBExecuteError{
@@ -1466,10 +2222,10 @@ func (db *MySQLDB) DeleteUserRoleByRole(ctx context.Context, role *Role) error {
 // GetRoleByRecID return a role with speciffic recID
 func (db *MySQLDB) GetRoleByRecID(ctx context.Context, recID string) (*Role, error) {
 	fLog := mysqlLog.WithField("func", "GetRoleByRecID").WithField("RequestID", ctx.Value(constants.RequestID))
-	q := "SELECT REC_ID, ROLE_NAME, ROLE_DOMAIN, DESCRIPTION FROM HANSIP_ROLE WHERE REC_ID=?"
-	row := db.instance.QueryRowContext(ctx, q, recID)
+	q := "SELECT REC_ID, ROLE_NAME, ROLE_DOMAIN, DESCRIPTION, VERSION FROM HANSIP_ROLE WHERE REC_ID=?"
+	row := db.conn(ctx).QueryRowContext(ctx, q, recID)
 	r := &Role{}
-	err := row.Scan(&r.RecID, &r.RoleName, &r.RoleDomain, &r.Description)
+	err := row.Scan(&r.RecID, &r.RoleName, &r.RoleDomain, &r.Description, &r.Version)
 	if err != nil {
 		fLog.Errorf("db.instance.QueryRowContext got  %s", err.Error())
 		return nil, &ErrDBScanError{
@@ -1484,10 +2240,10 @@ func (db *MySQLDB) GetRoleByRecID(ctx context.Context, recID string) (*Role, err
 // GetRoleByName return a role record
 func (db *MySQLDB) GetRoleByName(ctx context.Context, roleName, roleDomain string) (*Role, error) {
 	fLog := mysqlLog.WithField("func", "GetRoleByName").WithField("RequestID", ctx.Value(constants.RequestID))
-	q := "SELECT REC_ID, ROLE_NAME, ROLE_DOMAIN, DESCRIPTION FROM HANSIP_ROLE WHERE ROLE_NAME=? AND ROLE_DOMAIN=?"
-	row := db.instance.QueryRowContext(ctx, q, roleName, roleDomain)
+	q := "SELECT REC_ID, ROLE_NAME, ROLE_DOMAIN, DESCRIPTION, VERSION FROM HANSIP_ROLE WHERE ROLE_NAME=? AND ROLE_DOMAIN=?"
+	row := db.conn(ctx).QueryRowContext(ctx, q, roleName, roleDomain)
 	r := &Role{}
-	err := row.Scan(&r.RecID, &r.RoleName, &r.RoleDomain, &r.Description)
+	err := row.Scan(&r.RecID, &r.RoleName, &r.RoleDomain, &r.Description, &r.Version)
 	if err != nil {
 		fLog.Errorf("db.instance.QueryRowContext got  %s", err.Error())
 		return nil, &ErrDBScanError{
@@ -1509,7 +2265,7 @@ func (db *MySQLDB) CreateRole(ctx context.Context, roleName, roleDomain, descrip
 		Description: description,
 	}
 	q := "INSERT INTO HANSIP_ROLE(REC_ID, ROLE_NAME,ROLE_DOMAIN, DESCRIPTION) VALUES (?,?,?,?)"
-	_, err := db.instance.ExecContext(ctx, q, r.RecID, roleName, roleDomain, description)
+	_, err := db.conn(ctx).ExecContext(ctx, q, r.RecID, roleName, roleDomain, description)
 	if err != nil {
 		fLog.Errorf("db.instance.ExecContext got  %s. SQL = %s", err.Error(), q)
 		return nil, &ErrDBExecuteError{
@@ -1524,22 +2280,28 @@ func (db *MySQLDB) CreateRole(ctx context.Context, roleName, roleDomain, descrip
 // ListRoles list all roles in this server
 func (db *MySQLDB) ListRoles(ctx context.Context, tenant *Tenant, request *helper.PageRequest) ([]*Role, *helper.Page, error) {
 	fLog := mysqlLog.WithField("func", "ListRoles").WithField("RequestID", ctx.Value(constants.RequestID))
-	q := "SELECT COUNT(*) AS CNT FROM HANSIP_ROLE"
-	row := db.instance.QueryRowContext(ctx, q)
-	count := 0
-	err := row.Scan(&count)
+	query, err := newListQuery(request, roleListColumns, "", "ROLE_NAME")
 	if err != nil {
-		fLog.Errorf("db.instance.QueryRowContext got  %s", err.Error())
-		return nil, nil, &ErrDBScanError{
-			Wrapped: err,
-			Message: "Error ListRoles",
-			SQL:     q,
+		return nil, nil, err
+	}
+	count := 0
+	q := "SELECT COUNT(*) AS CNT FROM HANSIP_ROLE WHERE ROLE_DOMAIN=?" + query.filter
+	if query.counted() {
+		row := db.conn(ctx).QueryRowContext(ctx, q, query.countArgs(tenant.Domain)...)
+		err = row.Scan(&count)
+		if err != nil {
+			fLog.Errorf("db.instance.QueryRowContext got  %s", err.Error())
+			return nil, nil, &ErrDBScanError{
+				Wrapped: err,
+				Message: "Error ListRoles",
+				SQL:     q,
+			}
 		}
 	}
-	page := helper.NewPage(request, uint(count))
-	q = fmt.Sprintf("SELECT REC_ID, ROLE_NAME,ROLE_DOMAIN, DESCRIPTION FROM HANSIP_ROLE WHERE ROLE_DOMAIN=? ORDER BY ROLE_NAME %s LIMIT %d, %d", request.Sort, page.OffsetStart, page.OffsetEnd-page.OffsetStart)
+	page := query.page(count)
+	q = fmt.Sprintf("SELECT REC_ID, ROLE_NAME,ROLE_DOMAIN, DESCRIPTION, VERSION FROM HANSIP_ROLE WHERE ROLE_DOMAIN=? %s ORDER BY %s LIMIT %s", query.where(), query.orderBy(), query.limit(page))
 	ret := make([]*Role, 0)
-	rows, err := db.instance.QueryContext(ctx, q, tenant.Domain)
+	rows, err := db.conn(ctx).QueryContext(ctx, q, query.args(tenant.Domain)...)
 	if err != nil {
 		fLog.Errorf("db.instance.QueryContext got  %s. SQL = %s", err.Error(), q)
 		return nil, nil, &ErrDBQueryError{
@@ -1550,7 +2312,7 @@ func (db *MySQLDB) ListRoles(ctx context.Context, tenant *Tenant, request *helpe
 	}
 	for rows.Next() {
 		r := &Role{}
-		err := rows.Scan(&r.RecID, &r.RoleName, &r.RoleDomain, &r.Description)
+		err := rows.Scan(&r.RecID, &r.RoleName, &r.RoleDomain, &r.Description, &r.Version)
 		if err != nil {
 			fLog.Warnf("row.Scan got  %s", err.Error())
 			return nil, nil, &ErrDBScanError{
@@ -1562,14 +2324,14 @@ func (db *MySQLDB) ListRoles(ctx context.Context, tenant *Tenant, request *helpe
 			ret = append(ret, r)
 		}
 	}
-	return ret, page, nil
+	return ret[:query.paginate(page, ret)], page, nil
 }
 
 // DeleteRole delete a specific role from this server
 func (db *MySQLDB) DeleteRole(ctx context.Context, role *Role) error {
 	fLog := mysqlLog.WithField("func", "DeleteRole").WithField("RequestID", ctx.Value(constants.RequestID))
 	q := "DELETE FROM HANSIP_ROLE WHERE REC_ID=?"
-	_, err := db.instance.ExecContext(ctx, q, role.RecID)
+	_, err := db.conn(ctx).ExecContext(ctx, q, role.RecID)
 	if err != nil {
 		fLog.Errorf("db.instance.ExecContext got  %s. SQL = %s", err.Error(), q)
 		return &ErrDBExecuteError{
@@ -1585,7 +2347,7 @@ func (db *MySQLDB) DeleteRole(ctx context.Context, role *Role) error {
 func (db *MySQLDB) IsRoleRecIDExist(ctx context.Context, recID string) (bool, error) {
 	fLog := mysqlLog.WithField("func", "IsUserRecIDExist").WithField("RequestID", ctx.Value(constants.RequestID))
 	q := "SELECT COUNT(*) AS CNT FROM HANSIP_ROLE WHERE REC_ID=?"
-	rows, err := db.instance.QueryContext(ctx, q, recID)
+	rows, err := db.conn(ctx).QueryContext(ctx, q, recID)
 	if err != nil {
 		fLog.Errorf("db.instance.ExecContext got %s. SQL = %s", err.Error(), q)
 		return false, &ErrDBQueryError{
@@ -1620,9 +2382,9 @@ func (db *MySQLDB) UpdateRole(ctx context.Context, role *Role) error {
 	if !exist {
 		return ErrNotFound
 	}
-	q := "UPDATE HANSIP_ROLE SET ROLE_NAME=?, ROLE_DOMAIN=?, DESCRIPTION=? WHERE REC_ID=?"
-	_, err = db.instance.ExecContext(ctx, q,
-		role.RoleName, role.RoleDomain, role.Description, role.RecID)
+	q := "UPDATE HANSIP_ROLE SET ROLE_NAME=?, ROLE_DOMAIN=?, DESCRIPTION=?, VERSION=VERSION+1 WHERE REC_ID=? AND VERSION=?"
+	result, err := db.conn(ctx).ExecContext(ctx, q,
+		role.RoleName, role.RoleDomain, role.Description, role.RecID, role.Version)
 	if err != nil {
 		fLog.Errorf("db.instance.ExecContext got  %s. SQL = %s", err.Error(), q)
 		return &ErrDBExecuteError{
@@ -1631,16 +2393,23 @@ func (db *MySQLDB) UpdateRole(ctx context.Context, role *Role) error {
 			SQL:     q,
 		}
 	}
+	if affected, err := result.RowsAffected(); err == nil && affected == 0 {
+		return &ErrDBConflict{
+			Message: fmt.Sprintf("role %s has been changed since it was read", role.RecID),
+			SQL:     q,
+		}
+	}
+	role.Version++
 	return nil
 }
 
 // GetGroupByRecID return a Group data by its RedID
 func (db *MySQLDB) GetGroupByRecID(ctx context.Context, recID string) (*Group, error) {
 	fLog := mysqlLog.WithField("func", "GetGroupByRecID").WithField("RequestID", ctx.Value(constants.RequestID))
-	q := "SELECT REC_ID, GROUP_NAME, GROUP_DOMAIN, DESCRIPTION FROM HANSIP_GROUP WHERE REC_ID=?"
-	row := db.instance.QueryRowContext(ctx, q, recID)
+	q := "SELECT REC_ID, GROUP_NAME, GROUP_DOMAIN, DESCRIPTION, VERSION FROM HANSIP_GROUP WHERE REC_ID=?"
+	row := db.conn(ctx).QueryRowContext(ctx, q, recID)
 	r := &Group{}
-	err := row.Scan(&r.RecID, &r.GroupName, &r.GroupDomain, &r.Description)
+	err := row.Scan(&r.RecID, &r.GroupName, &r.GroupDomain, &r.Description, &r.Version)
 	if err != nil {
 		fLog.Errorf("db.instance.QueryRowContext got %s", err.Error())
 		return nil, &ErrDBScanError{
@@ -1654,10 +2423,10 @@ func (db *MySQLDB) GetGroupByRecID(ctx context.Context, recID string) (*Group, e
 
 func (db *MySQLDB) GetGroupByName(ctx context.Context, groupName, groupDomain string) (*Group, error) {
 	fLog := mysqlLog.WithField("func", "GetGroupByName").WithField("RequestID", ctx.Value(constants.RequestID))
-	q := "SELECT REC_ID, GROUP_NAME, GROUP_DOMAIN, DESCRIPTION FROM HANSIP_GROUP WHERE GROUP_NAME=? AND GROUP_DOMAIN=?"
-	row := db.instance.QueryRowContext(ctx, q, groupName, groupDomain)
+	q := "SELECT REC_ID, GROUP_NAME, GROUP_DOMAIN, DESCRIPTION, VERSION FROM HANSIP_GROUP WHERE GROUP_NAME=? AND GROUP_DOMAIN=?"
+	row := db.conn(ctx).QueryRowContext(ctx, q, groupName, groupDomain)
 	r := &Group{}
-	err := row.Scan(&r.RecID, &r.GroupName, &r.GroupDomain, &r.Description)
+	err := row.Scan(&r.RecID, &r.GroupName, &r.GroupDomain, &r.Description, &r.Version)
 	if err != nil {
 		fLog.Errorf("db.instance.QueryRowContext got %s", err.Error())
 		return nil, &ErrDBExecuteError{
@@ -1679,7 +2448,7 @@ func (db *MySQLDB) CreateGroup(ctx context.Context, groupName, groupDomain, desc
 		Description: description,
 	}
 	q := "INSERT INTO HANSIP_GROUP(REC_ID, GROUP_NAME, GROUP_DOMAIN, DESCRIPTION) VALUES (?,?,?,?)"
-	_, err := db.instance.ExecContext(ctx, q, r.RecID, groupName, groupDomain, description)
+	_, err := db.conn(ctx).ExecContext(ctx, q, r.RecID, groupName, groupDomain, description)
 	if err != nil {
 		fLog.Errorf("db.instance.ExecContext got %s. SQL = %s", err.Error(), q)
 		return nil, &ErrDBExecuteError{
@@ -1694,22 +2463,28 @@ func (db *MySQLDB) CreateGroup(ctx context.Context, groupName, groupDomain, desc
 // ListGroups list all groups in this server
 func (db *MySQLDB) ListGroups(ctx context.Context, tenant *Tenant, request *helper.PageRequest) ([]*Group, *helper.Page, error) {
 	fLog := mysqlLog.WithField("func", "ListGroups").WithField("RequestID", ctx.Value(constants.RequestID))
-	q := "SELECT COUNT(*) AS CNT FROM HANSIP_GROUP"
-	row := db.instance.QueryRowContext(ctx, q)
-	count := 0
-	err := row.Scan(&count)
+	query, err := newListQuery(request, groupListColumns, "", "GROUP_NAME")
 	if err != nil {
-		fLog.Errorf("row.Scan got  %s", err.Error())
-		return nil, nil, &ErrDBScanError{
-			Wrapped: err,
-			Message: "Error ListGroups",
-			SQL:     q,
+		return nil, nil, err
+	}
+	count := 0
+	q := "SELECT COUNT(*) AS CNT FROM HANSIP_GROUP WHERE GROUP_DOMAIN=?" + query.filter
+	if query.counted() {
+		row := db.conn(ctx).QueryRowContext(ctx, q, query.countArgs(tenant.Domain)...)
+		err = row.Scan(&count)
+		if err != nil {
+			fLog.Errorf("row.Scan got  %s", err.Error())
+			return nil, nil, &ErrDBScanError{
+				Wrapped: err,
+				Message: "Error ListGroups",
+				SQL:     q,
+			}
 		}
 	}
-	page := helper.NewPage(request, uint(count))
-	q = fmt.Sprintf("SELECT REC_ID, GROUP_NAME, GROUP_DOMAIN, DESCRIPTION FROM HANSIP_GROUP WHERE GROUP_DOMAIN=? ORDER BY GROUP_NAME %s LIMIT %d, %d", request.Sort, page.OffsetStart, page.OffsetEnd-page.OffsetStart)
+	page := query.page(count)
+	q = fmt.Sprintf("SELECT REC_ID, GROUP_NAME, GROUP_DOMAIN, DESCRIPTION, VERSION FROM HANSIP_GROUP WHERE GROUP_DOMAIN=? %s ORDER BY %s LIMIT %s", query.where(), query.orderBy(), query.limit(page))
 	ret := make([]*Group, 0)
-	rows, err := db.instance.QueryContext(ctx, q, tenant.Domain)
+	rows, err := db.conn(ctx).QueryContext(ctx, q, query.args(tenant.Domain)...)
 	if err != nil {
 		fLog.Errorf("db.instance.QueryContext got  %s. SQL = %s", err.Error(), q)
 		return nil, nil, &ErrDBQueryError{
@@ -1720,7 +2495,7 @@ func (db *MySQLDB) ListGroups(ctx context.Context, tenant *Tenant, request *help
 	}
 	for rows.Next() {
 		r := &Group{}
-		err := rows.Scan(&r.RecID, &r.GroupName, &r.GroupDomain, &r.Description)
+		err := rows.Scan(&r.RecID, &r.GroupName, &r.GroupDomain, &r.Description, &r.Version)
 		if err != nil {
 			fLog.Warnf("row.Scan got  %s", err.Error())
 			return nil, nil, &ErrDBScanError{
@@ -1732,14 +2507,14 @@ func (db *MySQLDB) ListGroups(ctx context.Context, tenant *Tenant, request *help
 			ret = append(ret, r)
 		}
 	}
-	return ret, page, nil
+	return ret[:query.paginate(page, ret)], page, nil
 }
 
 // DeleteGroup delete one speciffic group
 func (db *MySQLDB) DeleteGroup(ctx context.Context, group *Group) error {
 	fLog := mysqlLog.WithField("func", "DeleteGroup").WithField("RequestID", ctx.Value(constants.RequestID))
 	q := "DELETE FROM HANSIP_GROUP WHERE REC_ID=?"
-	_, err := db.instance.ExecContext(ctx, q, group.RecID)
+	_, err := db.conn(ctx).ExecContext(ctx, q, group.RecID)
 	if err != nil {
 		fLog.Errorf("db.instance.ExecContext got %s. SQL = %s", err.Error(), q)
 		return &ErrDBExecuteError{
@@ -1755,7 +2530,7 @@ func (db *MySQLDB) DeleteGroup(ctx context.Context, group *Group) error {
 func (db *MySQLDB) IsGroupRecIDExist(ctx context.Context, recID string) (bool, error) {
 	fLog := mysqlLog.WithField("func", "IsGroupRecIDExist").WithField("RequestID", ctx.Value(constants.RequestID))
 	q := "SELECT COUNT(*) AS CNT FROM HANSIP_GROUP WHERE REC_ID=?"
-	rows, err := db.instance.QueryContext(ctx, q, recID)
+	rows, err := db.conn(ctx).QueryContext(ctx, q, recID)
 	if err != nil {
 		fLog.Errorf("db.instance.ExecContext got %s. SQL = %s", err.Error(), q)
 		return false, &ErrDBQueryError{
@@ -1790,9 +2565,9 @@ func (db *MySQLDB) UpdateGroup(ctx context.Context, group *Group) error {
 	if !exist {
 		return ErrNotFound
 	}
-	q := "UPDATE HANSIP_GROUP SET GROUP_NAME=?, GROUP_DOMAIN=?, DESCRIPTION=? WHERE REC_ID=?"
-	_, err = db.instance.ExecContext(ctx, q,
-		group.GroupName, group.GroupDomain, group.Description, group.RecID)
+	q := "UPDATE HANSIP_GROUP SET GROUP_NAME=?, GROUP_DOMAIN=?, DESCRIPTION=?, VERSION=VERSION+1 WHERE REC_ID=? AND VERSION=?"
+	result, err := db.conn(ctx).ExecContext(ctx, q,
+		group.GroupName, group.GroupDomain, group.Description, group.RecID, group.Version)
 	if err != nil {
 		fLog.Errorf("db.instance.ExecContext got  %s. SQL = %s", err.Error(), q)
 		return &ErrDBExecuteError{
@@ -1801,6 +2576,13 @@ func (db *MySQLDB) UpdateGroup(ctx context.Context, group *Group) error {
 			SQL:     q,
 		}
 	}
+	if affected, err := result.RowsAffected(); err == nil && affected == 0 {
+		return &ErrDBConflict{
+			Message: fmt.Sprintf("group %s has been changed since it was read", group.RecID),
+			SQL:     q,
+		}
+	}
+	group.Version++
 	return nil
 }
 
@@ -1808,7 +2590,7 @@ func (db *MySQLDB) UpdateGroup(ctx context.Context, group *Group) error {
 func (db *MySQLDB) GetGroupRole(ctx context.Context, group *Group, role *Role) (*GroupRole, error) {
 	fLog := mysqlLog.WithField("func", "GetGroupRole").WithField("RequestID", ctx.Value(constants.RequestID))
 	q := "SELECT COUNT(*) CNT FROM HANSIP_GROUP_ROLE WHERE GROUP_REC_ID=? AND ROLE_REC_ID=?"
-	row := db.instance.QueryRowContext(ctx, q, group.RecID, role.RecID)
+	row := db.conn(ctx).QueryRowContext(ctx, q, group.RecID, role.RecID)
 	count := 0
 	err := row.Scan(&count)
 	if err != nil {
@@ -1846,7 +2628,7 @@ func (db *MySQLDB) CreateGroupRole(ctx context.Context, group *Group, role *Role
 	q := "INSERT INTO HANSIP_GROUP_ROLE(GROUP_REC_ID, ROLE_REC_ID) VALUES (?,?)"
 	stmt, err := db.instance.Prepare(q)
 	_, err = stmt.ExecContext(ctx, group.RecID, role.RecID)
-	//_, err := db.instance.ExecContext(ctx, q, group.RecID, role.RecID)
+	//_, err := db.conn(ctx).ExecContext(ctx, q, group.RecID, role.RecID)
 	if err != nil {
 		fLog.Errorf("db.instance.ExecContext got %s. SQL = %s", err.Error(), q)
 		return nil, &ErrDBExecuteError{
@@ -1864,22 +2646,28 @@ func (db *MySQLDB) CreateGroupRole(ctx context.Context, group *Group, role *Role
 // ListGroupRoleByGroup list all role related to a group
 func (db *MySQLDB) ListGroupRoleByGroup(ctx context.Context, group *Group, request *helper.PageRequest) ([]*Role, *helper.Page, error) {
 	fLog := mysqlLog.WithField("func", "ListGroupRoleByGroup").WithField("RequestID", ctx.Value(constants.RequestID))
-	q := "SELECT COUNT(*) FROM HANSIP_GROUP_ROLE WHERE GROUP_REC_ID=?"
-	row := db.instance.QueryRowContext(ctx, q, group.RecID)
-	count := 0
-	err := row.Scan(&count)
+	query, err := newListQuery(request, roleListColumns, "R", "ROLE_NAME")
 	if err != nil {
-		fLog.Errorf("row.Scan got  %s", err.Error())
-		return nil, nil, &ErrDBScanError{
-			Wrapped: err,
-			Message: "Error ListGroupRoleByGroup",
-			SQL:     q,
+		return nil, nil, err
+	}
+	count := 0
+	q := "SELECT COUNT(*) FROM HANSIP_GROUP_ROLE UR, HANSIP_ROLE R WHERE UR.ROLE_REC_ID = R.REC_ID AND UR.GROUP_REC_ID = ?" + query.filter
+	if query.counted() {
+		row := db.conn(ctx).QueryRowContext(ctx, q, query.countArgs(group.RecID)...)
+		err = row.Scan(&count)
+		if err != nil {
+			fLog.Errorf("row.Scan got  %s", err.Error())
+			return nil, nil, &ErrDBScanError{
+				Wrapped: err,
+				Message: "Error ListGroupRoleByGroup",
+				SQL:     q,
+			}
 		}
 	}
-	page := helper.NewPage(request, uint(count))
-	q = fmt.Sprintf("SELECT R.REC_ID, R.ROLE_NAME, R.ROLE_DOMAIN, R.DESCRIPTION FROM HANSIP_GROUP_ROLE UR, HANSIP_ROLE R WHERE UR.ROLE_REC_ID = R.REC_ID AND UR.GROUP_REC_ID = ? ORDER BY R.ROLE_NAME %s LIMIT %d, %d", request.Sort, page.OffsetStart, page.OffsetEnd-page.OffsetStart)
+	page := query.page(count)
+	q = fmt.Sprintf("SELECT R.REC_ID, R.ROLE_NAME, R.ROLE_DOMAIN, R.DESCRIPTION, R.VERSION FROM HANSIP_GROUP_ROLE UR, HANSIP_ROLE R WHERE UR.ROLE_REC_ID = R.REC_ID AND UR.GROUP_REC_ID = ? %s ORDER BY %s LIMIT %s", query.where(), query.orderBy(), query.limit(page))
 	ret := make([]*Role, 0)
-	rows, err := db.instance.QueryContext(ctx, q, group.RecID)
+	rows, err := db.conn(ctx).QueryContext(ctx, q, query.args(group.RecID)...)
 	if err != nil {
 		fLog.Errorf("db.instance.QueryContext got %s. SQL = %s", err.Error(), q)
 		return nil, nil, &ErrDBQueryError{
@@ -1890,7 +2678,7 @@ func (db *MySQLDB) ListGroupRoleByGroup(ctx context.Context, group *Group, reque
 	}
 	for rows.Next() {
 		role := &Role{}
-		err := rows.Scan(&role.RecID, &role.RoleName, &role.RoleDomain, &role.Description)
+		err := rows.Scan(&role.RecID, &role.RoleName, &role.RoleDomain, &role.Description, &role.Version)
 		if err != nil {
 			fLog.Warnf("rows.Scan got  %s", err.Error())
 			return nil, nil, &ErrDBScanError{
@@ -1902,28 +2690,34 @@ func (db *MySQLDB) ListGroupRoleByGroup(ctx context.Context, group *Group, reque
 			ret = append(ret, role)
 		}
 	}
-	return ret, page, nil
+	return ret[:query.paginate(page, ret)], page, nil
 }
 
 // ListGroupRoleByRole will list all group- related to a role
 func (db *MySQLDB) ListGroupRoleByRole(ctx context.Context, role *Role, request *helper.PageRequest) ([]*Group, *helper.Page, error) {
 	fLog := mysqlLog.WithField("func", "ListGroupRoleByRole").WithField("RequestID", ctx.Value(constants.RequestID))
-	q := "SELECT COUNT(*) FROM HANSIP_GROUP_ROLE WHERE ROLE_REC_ID=?"
-	row := db.instance.QueryRowContext(ctx, q, role.RecID)
-	count := 0
-	err := row.Scan(&count)
+	query, err := newListQuery(request, groupListColumns, "R", "GROUP_NAME")
 	if err != nil {
-		fLog.Errorf("row.Scan got  %s", err.Error())
-		return nil, nil, &ErrDBScanError{
-			Wrapped: err,
-			Message: "Error ListGroupRoleByRole",
-			SQL:     q,
+		return nil, nil, err
+	}
+	count := 0
+	q := "SELECT COUNT(*) FROM HANSIP_GROUP_ROLE UR, HANSIP_GROUP R WHERE UR.GROUP_REC_ID = R.REC_ID AND UR.ROLE_REC_ID = ?" + query.filter
+	if query.counted() {
+		row := db.conn(ctx).QueryRowContext(ctx, q, query.countArgs(role.RecID)...)
+		err = row.Scan(&count)
+		if err != nil {
+			fLog.Errorf("row.Scan got  %s", err.Error())
+			return nil, nil, &ErrDBScanError{
+				Wrapped: err,
+				Message: "Error ListGroupRoleByRole",
+				SQL:     q,
+			}
 		}
 	}
-	page := helper.NewPage(request, uint(count))
-	q = fmt.Sprintf("SELECT R.REC_ID, R.GROUP_NAME, R.GROUP_DOMAIN, R.DESCRIPTION FROM HANSIP_GROUP_ROLE UR, HANSIP_GROUP R WHERE UR.GROUP_REC_ID = R.REC_ID AND UR.ROLE_REC_ID = ? ORDER BY R.GROUP_NAME %s LIMIT %d, %d", request.Sort, page.OffsetStart, page.OffsetEnd-page.OffsetStart)
+	page := query.page(count)
+	q = fmt.Sprintf("SELECT R.REC_ID, R.GROUP_NAME, R.GROUP_DOMAIN, R.DESCRIPTION, R.VERSION FROM HANSIP_GROUP_ROLE UR, HANSIP_GROUP R WHERE UR.GROUP_REC_ID = R.REC_ID AND UR.ROLE_REC_ID = ? %s ORDER BY %s LIMIT %s", query.where(), query.orderBy(), query.limit(page))
 	ret := make([]*Group, 0)
-	rows, err := db.instance.QueryContext(ctx, q, role.RecID)
+	rows, err := db.conn(ctx).QueryContext(ctx, q, query.args(role.RecID)...)
 	if err != nil {
 		fLog.Errorf("db.instance.QueryContext got  %s. SQL = %s", err.Error(), q)
 		return nil, nil, &ErrDBQueryError{
@@ -1934,7 +2728,7 @@ func (db *MySQLDB) ListGroupRoleByRole(ctx context.Context, role *Role, request
 	}
 	for rows.Next() {
 		group := &Group{}
-		err := rows.Scan(&group.RecID, &group.GroupName, &group.GroupDomain, &group.Description)
+		err := rows.Scan(&group.RecID, &group.GroupName, &group.GroupDomain, &group.Description, &group.Version)
 		if err != nil {
 			fLog.Warnf("rows.Scan got  %s", err.Error())
 			return nil, nil, &ErrDBScanError{
@@ -1946,14 +2740,14 @@ func (db *MySQLDB) ListGroupRoleByRole(ctx context.Context, role *Role, request
 			ret = append(ret, group)
 		}
 	}
-	return ret, page, nil
+	return ret[:query.paginate(page, ret)], page, nil
 }
 
 // DeleteGroupRole delete a group-role relation
 func (db *MySQLDB) DeleteGroupRole(ctx context.Context, groupRole *GroupRole) error {
 	fLog := mysqlLog.WithField("func", "DeleteGroupRole").WithField("RequestID", ctx.Value(constants.RequestID))
 	q := "DELETE FROM HANSIP_GROUP_ROLE WHERE GROUP_REC_ID=? AND ROLE_REC_ID=?"
-	_, err := db.instance.ExecContext(ctx, q, groupRole.GroupRecID, groupRole.RoleRecID)
+	_, err := db.conn(ctx).ExecContext(ctx, q, groupRole.GroupRecID, groupRole.RoleRecID)
 	if err != nil {
 		fLog.Errorf("db.instance.ExecContext got  %s. SQL = %s", err.Error(), q)
 		return &ErrDBExecuteError{
@@ -1969,7 +2763,7 @@ func (db *MySQLDB) DeleteGroupRole(ctx context.Context, groupRole *GroupRole) er
 func (db *MySQLDB) DeleteGroupRoleByGroup(ctx context.Context, group *Group) error {
 	fLog := mysqlLog.WithField("func", "DeleteGroupRoleByGroup").WithField("RequestID", ctx.Value(constants.RequestID))
 	q := "DELETE FROM HANSIP_GROUP_ROLE WHERE GROUP_REC_ID=?"
-	_, err := db.instance.ExecContext(ctx, q, group.RecID)
+	_, err := db.conn(ctx).ExecContext(ctx, q, group.RecID)
 	if err != nil {
 		fLog.Errorf("db.instance.ExecContext got  %s. SQL = %s", err.Error(), q)
 		return &ErrDBExecuteError{
@@ -1985,7 +2779,7 @@ func (db *MySQLDB) DeleteGroupRoleByGroup(ctx context.Context, group *Group) err
 func (db *MySQLDB) DeleteGroupRoleByRole(ctx context.Context, role *Role) error {
 	fLog := mysqlLog.WithField("func", "DeleteGroupRoleByRole").WithField("RequestID", ctx.Value(constants.RequestID))
 	q := "DELETE FROM HANSIP_GROUP_ROLE WHERE ROLE_REC_ID=?"
-	_, err := db.instance.ExecContext(ctx, q, role.RecID)
+	_, err := db.conn(ctx).ExecContext(ctx, q, role.RecID)
 	if err != nil {
 		fLog.Errorf("db.instance.ExecContext got  %s", err.Error())
 		return &ErrDBExecuteError{
@@ -2001,7 +2795,7 @@ func (db *MySQLDB) DeleteGroupRoleByRole(ctx context.Context, role *Role) error
 func (db *MySQLDB) GetUserGroup(ctx context.Context, user *User, group *Group) (*UserGroup, error) {
 	fLog := mysqlLog.WithField("func", "GetUserGroup").WithField("RequestID", ctx.Value(constants.RequestID))
 	q := "SELECT COUNT(*) CNT FROM HANSIP_USER_GROUP WHERE USER_REC_ID=? AND GROUP_REC_ID=?"
-	row := db.instance.QueryRowContext(ctx, q, user.RecID, group.RecID)
+	row := db.conn(ctx).QueryRowContext(ctx, q, user.RecID, group.RecID)
 	count := 0
 	err := row.Scan(&count)
 	if err != nil {
@@ -2028,7 +2822,7 @@ func (db *MySQLDB) GetUserGroup(ctx context.Context, user *User, group *Group) (
 func (db *MySQLDB) CreateUserGroup(ctx context.Context, user *User, group *Group) (*UserGroup, error) {
 	fLog := mysqlLog.WithField("func", "CreateUserGroup").WithField("RequestID", ctx.Value(constants.RequestID))
 	q := "INSERT INTO HANSIP_USER_GROUP(USER_REC_ID, GROUP_REC_ID) VALUES (?,?)"
-	_, err := db.instance.ExecContext(ctx, q, user.RecID, group.RecID)
+	_, err := db.conn(ctx).ExecContext(ctx, q, user.RecID, group.RecID)
 	if err != nil {
 		fLog.Errorf("db.instance.ExecContext got %s. SQL = %s", err.Error(), q)
 		return nil, &ErrDBExecuteError{
@@ -2046,22 +2840,28 @@ func (db *MySQLDB) CreateUserGroup(ctx context.Context, user *User, group *Group
 // ListUserGroupByUser will list groups that related to a user
 func (db *MySQLDB) ListUserGroupByUser(ctx context.Context, user *User, request *helper.PageRequest) ([]*Group, *helper.Page, error) {
 	fLog := mysqlLog.WithField("func", "ListUserGroupByUser").WithField("RequestID", ctx.Value(constants.RequestID))
-	q := "SELECT COUNT(*) FROM HANSIP_USER_GROUP WHERE USER_REC_ID=?"
-	row := db.instance.QueryRowContext(ctx, q, user.RecID)
-	count := 0
-	err := row.Scan(&count)
+	query, err := newListQuery(request, groupListColumns, "R", "GROUP_NAME")
 	if err != nil {
-		fLog.Errorf("row.Scan got  %s", err.Error())
-		return nil, nil, &ErrDBScanError{
-			Wrapped: err,
-			Message: "Error ListUserGroupByUser",
-			SQL:     q,
+		return nil, nil, err
+	}
+	count := 0
+	q := "SELECT COUNT(*) FROM HANSIP_USER_GROUP UR, HANSIP_GROUP R WHERE UR.GROUP_REC_ID = R.REC_ID AND UR.USER_REC_ID = ?" + query.filter
+	if query.counted() {
+		row := db.conn(ctx).QueryRowContext(ctx, q, query.countArgs(user.RecID)...)
+		err = row.Scan(&count)
+		if err != nil {
+			fLog.Errorf("row.Scan got  %s", err.Error())
+			return nil, nil, &ErrDBScanError{
+				Wrapped: err,
+				Message: "Error ListUserGroupByUser",
+				SQL:     q,
+			}
 		}
 	}
-	page := helper.NewPage(request, uint(count))
-	q = fmt.Sprintf("SELECT R.REC_ID, R.GROUP_NAME, R.GROUP_DOMAIN, R.DESCRIPTION FROM HANSIP_USER_GROUP UR, HANSIP_GROUP R WHERE UR.GROUP_REC_ID = R.REC_ID AND UR.USER_REC_ID = ? ORDER BY R.GROUP_NAME %s LIMIT %d, %d", request.Sort, page.OffsetStart, page.OffsetEnd-page.OffsetStart)
+	page := query.page(count)
+	q = fmt.Sprintf("SELECT R.REC_ID, R.GROUP_NAME, R.GROUP_DOMAIN, R.DESCRIPTION, R.VERSION FROM HANSIP_USER_GROUP UR, HANSIP_GROUP R WHERE UR.GROUP_REC_ID = R.REC_ID AND UR.USER_REC_ID = ? %s ORDER BY %s LIMIT %s", query.where(), query.orderBy(), query.limit(page))
 	ret := make([]*Group, 0)
-	rows, err := db.instance.QueryContext(ctx, q, user.RecID)
+	rows, err := db.conn(ctx).QueryContext(ctx, q, query.args(user.RecID)...)
 	if err != nil {
 		fLog.Errorf("db.instance.QueryContext got  %s. SQL = %s", err.Error(), q)
 		return nil, nil, &ErrDBQueryError{
@@ -2072,7 +2872,7 @@ func (db *MySQLDB) ListUserGroupByUser(ctx context.Context, user *User, request
 	}
 	for rows.Next() {
 		group := &Group{}
-		err := rows.Scan(&group.RecID, &group.GroupName, &group.GroupDomain, &group.Description)
+		err := rows.Scan(&group.RecID, &group.GroupName, &group.GroupDomain, &group.Description, &group.Version)
 		if err != nil {
 			fLog.Warnf("rows.Scan got  %s", err.Error())
 			return nil, nil, &ErrDBScanError{
@@ -2084,41 +2884,89 @@ func (db *MySQLDB) ListUserGroupByUser(ctx context.Context, user *User, request
 			ret = append(ret, group)
 		}
 	}
-	return ret, page, nil
+	return ret[:query.paginate(page, ret)], page, nil
 }
 
-// ListUserGroupByGroup will list all users that related to a group
-func (db *MySQLDB) ListUserGroupByGroup(ctx context.Context, group *Group, request *helper.PageRequest) ([]*User, *helper.Page, error) {
-	fLog := mysqlLog.WithField("func", "ListUserGroupByGroup").WithField("RequestID", ctx.Value(constants.RequestID))
-	q := "SELECT COUNT(*) FROM HANSIP_USER_GROUP WHERE GROUP_REC_ID=?"
-	row := db.instance.QueryRowContext(ctx, q, group.RecID)
-	count := 0
-	err := row.Scan(&count)
+// ListUserGroupByUsers will list the groups of a domain that related to each of the users, in one query
+func (db *MySQLDB) ListUserGroupByUsers(ctx context.Context, users []*User, domain string) (map[string][]*Group, error) {
+	fLog := mysqlLog.WithField("func", "ListUserGroupByUsers").WithField("RequestID", ctx.Value(constants.RequestID))
+	ret := make(map[string][]*Group)
+	if len(users) == 0 {
+		return ret, nil
+	}
+	args := make([]interface{}, 0, len(users)+1)
+	marks := make([]string, len(users))
+	for i, user := range users {
+		args = append(args, user.RecID)
+		marks[i] = "?"
+	}
+	args = append(args, domain)
+	q := fmt.Sprintf("SELECT UR.USER_REC_ID, R.REC_ID, R.GROUP_NAME, R.GROUP_DOMAIN, R.DESCRIPTION, R.VERSION FROM HANSIP_USER_GROUP UR, HANSIP_GROUP R WHERE UR.GROUP_REC_ID = R.REC_ID AND UR.USER_REC_ID IN (%s) AND R.GROUP_DOMAIN = ? ORDER BY R.GROUP_NAME ASC, R.REC_ID ASC", strings.Join(marks, ","))
+	rows, err := db.conn(ctx).QueryContext(ctx, q, args...)
 	if err != nil {
-		fLog.Errorf("rows.Scan got  %s", err.Error())
-		return nil, nil, &ErrDBScanError{
+		fLog.Errorf("db.instance.QueryContext got  %s. SQL = %s", err.Error(), q)
+		return nil, &ErrDBQueryError{
 			Wrapped: err,
-			Message: "Error ListUserGroupByGroup",
+			Message: "Error ListUserGroupByUsers",
 			SQL:     q,
 		}
 	}
-	page := helper.NewPage(request, uint(count))
-	q = fmt.Sprintf("SELECT R.REC_ID,R.EMAIL,R.HASHED_PASSPHRASE,R.ENABLED, R.SUSPENDED,R.LAST_SEEN,R.LAST_LOGIN,R.FAIL_COUNT,R.ACTIVATION_CODE,R.ACTIVATION_DATE,R.TOTP_KEY,R.ENABLE_2FE,R.TOKEN_2FE,R.RECOVERY_CODE FROM HANSIP_USER_GROUP UR, HANSIP_USER R WHERE UR.USER_REC_ID = R.REC_ID AND UR.GROUP_REC_ID = ? ORDER BY R.EMAIL %s LIMIT %d, %d", request.Sort, page.OffsetStart, page.OffsetEnd-page.OffsetStart)
-	ret := make([]*User, 0)
-	rows, err := db.instance.QueryContext(ctx, q, group.RecID)
-	if err != nil {
-		fLog.Errorf("db.instance.QueryContext got  %s. SQL = %s", err.Error(), q)
-		return nil, nil, &ErrDBQueryError{
-			Wrapped: err,
-			Message: "Error ListUserGroupByGroup",
+	defer rows.Close()
+	for rows.Next() {
+		var userRecID string
+		group := &Group{}
+		err := rows.Scan(&userRecID, &group.RecID, &group.GroupName, &group.GroupDomain, &group.Description, &group.Version)
+		if err != nil {
+			fLog.Warnf("rows.Scan got  %s", err.Error())
+			return nil, &ErrDBScanError{
+				Wrapped: err,
+				Message: "Error ListUserGroupByUsers",
+				SQL:     q,
+			}
+		}
+		ret[userRecID] = append(ret[userRecID], group)
+	}
+	return ret, nil
+}
+
+// ListUserGroupByGroup will list all users that related to a group
+func (db *MySQLDB) ListUserGroupByGroup(ctx context.Context, group *Group, request *helper.PageRequest) ([]*User, *helper.Page, error) {
+	fLog := mysqlLog.WithField("func", "ListUserGroupByGroup").WithField("RequestID", ctx.Value(constants.RequestID))
+	query, err := newListQuery(request, userListColumns, "R", "EMAIL")
+	if err != nil {
+		return nil, nil, err
+	}
+	count := 0
+	q := "SELECT COUNT(*) FROM HANSIP_USER_GROUP UR, HANSIP_USER R WHERE UR.USER_REC_ID = R.REC_ID AND UR.GROUP_REC_ID = ?" + query.filter
+	if query.counted() {
+		row := db.conn(ctx).QueryRowContext(ctx, q, query.countArgs(group.RecID)...)
+		err = row.Scan(&count)
+		if err != nil {
+			fLog.Errorf("rows.Scan got  %s", err.Error())
+			return nil, nil, &ErrDBScanError{
+				Wrapped: err,
+				Message: "Error ListUserGroupByGroup",
+				SQL:     q,
+			}
+		}
+	}
+	page := query.page(count)
+	q = fmt.Sprintf("SELECT R.REC_ID,R.EMAIL,R.HASHED_PASSPHRASE,R.ENABLED, R.SUSPENDED,R.LAST_SEEN,R.LAST_LOGIN,R.FAIL_COUNT,R.ACTIVATION_CODE,R.ACTIVATION_DATE,R.TOTP_KEY,R.ENABLE_2FE,R.TOKEN_2FE,R.RECOVERY_CODE,R.LOCALE,R.EMAIL_2FE,R.VERSION FROM HANSIP_USER_GROUP UR, HANSIP_USER R WHERE UR.USER_REC_ID = R.REC_ID AND UR.GROUP_REC_ID = ? %s ORDER BY %s LIMIT %s", query.where(), query.orderBy(), query.limit(page))
+	ret := make([]*User, 0)
+	rows, err := db.conn(ctx).QueryContext(ctx, q, query.args(group.RecID)...)
+	if err != nil {
+		fLog.Errorf("db.instance.QueryContext got  %s. SQL = %s", err.Error(), q)
+		return nil, nil, &ErrDBQueryError{
+			Wrapped: err,
+			Message: "Error ListUserGroupByGroup",
 			SQL:     q,
 		}
 	}
 	for rows.Next() {
 		user := &User{}
-		var enabled, suspended, enable2fa int
+		var enabled, suspended, enable2fa, email2fa int
 		err := rows.Scan(&user.RecID, &user.Email, &user.HashedPassphrase, &enabled, &suspended, &user.LastSeen, &user.LastLogin, &user.FailCount, &user.ActivationCode,
-			&user.ActivationDate, &user.UserTotpSecretKey, &enable2fa, &user.Token2FA, &user.RecoveryCode)
+			&user.ActivationDate, &user.UserTotpSecretKey, &enable2fa, &user.Token2FA, &user.RecoveryCode, &user.Locale, &email2fa, &user.Version)
 		if err != nil {
 			fLog.Warnf("rows.Scan got  %s", err.Error())
 			return nil, nil, &ErrDBScanError{
@@ -2136,17 +2984,20 @@ func (db *MySQLDB) ListUserGroupByGroup(ctx context.Context, group *Group, reque
 			if enable2fa == 1 {
 				user.Enable2FactorAuth = true
 			}
+			if email2fa == 1 {
+				user.Enable2FactorEmail = true
+			}
 			ret = append(ret, user)
 		}
 	}
-	return ret, page, nil
+	return ret[:query.paginate(page, ret)], page, nil
 }
 
 // DeleteUserGroup will delete a user-group
 func (db *MySQLDB) DeleteUserGroup(ctx context.Context, userGroup *UserGroup) error {
 	fLog := mysqlLog.WithField("func", "DeleteUserGroup").WithField("RequestID", ctx.Value(constants.RequestID))
 	q := "DELETE FROM HANSIP_USER_GROUP WHERE GROUP_REC_ID=? AND USER_REC_ID=?"
-	_, err := db.instance.ExecContext(ctx, q, userGroup.GroupRecID, userGroup.UserRecID)
+	_, err := db.conn(ctx).ExecContext(ctx, q, userGroup.GroupRecID, userGroup.UserRecID)
 	if err != nil {
 		fLog.Errorf("db.instance.ExecContext got %s. SQL = %s", err.Error(), q)
 		return &ErrDBExecuteError{
@@ -2162,7 +3013,7 @@ func (db *MySQLDB) DeleteUserGroup(ctx context.Context, userGroup *UserGroup) er
 func (db *MySQLDB) DeleteUserGroupByUser(ctx context.Context, user *User) error {
 	fLog := mysqlLog.WithField("func", "DeleteUserGroupByUser").WithField("RequestID", ctx.Value(constants.RequestID))
 	q := "DELETE FROM HANSIP_USER_GROUP WHERE USER_REC_ID=?"
-	_, err := db.instance.ExecContext(ctx, q, user.RecID)
+	_, err := db.conn(ctx).ExecContext(ctx, q, user.RecID)
 	if err != nil {
 		fLog.Errorf("db.instance.ExecContext got %s. SQL = %s", err.Error(), q)
 		return &ErrDBExecuteError{
@@ -2178,7 +3029,7 @@ func (db *MySQLDB) DeleteUserGroupByUser(ctx context.Context, user *User) error
 func (db *MySQLDB) DeleteUserGroupByGroup(ctx context.Context, group *Group) error {
 	fLog := mysqlLog.WithField("func", "DeleteUserGroupByGroup").WithField("RequestID", ctx.Value(constants.RequestID))
 	q := "DELETE FROM HANSIP_USER_GROUP WHERE GROUP_REC_ID=?"
-	_, err := db.instance.ExecContext(ctx, q, group.RecID)
+	_, err := db.conn(ctx).ExecContext(ctx, q, group.RecID)
 	if err != nil {
 		fLog.Errorf("db.instance.ExecContext got %s. SQL = %s", err.Error(), q)
 		return &ErrDBExecuteError{
@@ -2190,6 +3041,208 @@ func (db *MySQLDB) DeleteUserGroupByGroup(ctx context.Context, group *Group) err
 	return nil
 }
 
+// GetUserTenant returns existing user-tenant relation
+func (db *MySQLDB) GetUserTenant(ctx context.Context, user *User, tenant *Tenant) (*UserTenant, error) {
+	fLog := mysqlLog.WithField("func", "GetUserTenant").WithField("RequestID", ctx.Value(constants.RequestID))
+	q := "SELECT COUNT(*) CNT FROM HANSIP_USER_TENANT WHERE USER_REC_ID=? AND TENANT_REC_ID=?"
+	row := db.conn(ctx).QueryRowContext(ctx, q, user.RecID, tenant.RecID)
+	count := 0
+	err := row.Scan(&count)
+	if err != nil {
+		fLog.Errorf("row.Scan got  %s. SQL = %s", err.Error(), q)
+		return nil, &ErrDBScanError{
+			Wrapped: err,
+			Message: "Error GetUserTenant",
+			SQL:     q,
+		}
+	}
+	if count == 0 {
+		return nil, &ErrDBNoResult{
+			Message: fmt.Sprintf("user %s is not in tenant %s", user.Email, tenant.Name),
+			SQL:     q,
+		}
+	}
+	return &UserTenant{
+		UserRecID:   user.RecID,
+		TenantRecID: tenant.RecID,
+	}, nil
+}
+
+// CreateUserTenant create new relation between user and tenant
+func (db *MySQLDB) CreateUserTenant(ctx context.Context, user *User, tenant *Tenant) (*UserTenant, error) {
+	fLog := mysqlLog.WithField("func", "CreateUserTenant").WithField("RequestID", ctx.Value(constants.RequestID))
+	q := "INSERT INTO HANSIP_USER_TENANT(USER_REC_ID, TENANT_REC_ID) VALUES (?,?)"
+	_, err := db.conn(ctx).ExecContext(ctx, q, user.RecID, tenant.RecID)
+	if err != nil {
+		fLog.Errorf("db.instance.ExecContext got %s. SQL = %s", err.Error(), q)
+		return nil, &ErrDBExecuteError{
+			Wrapped: err,
+			Message: "Error CreateUserTenant",
+			SQL:     q,
+		}
+	}
+	return &UserTenant{
+		UserRecID:   user.RecID,
+		TenantRecID: tenant.RecID,
+	}, nil
+}
+
+// ListUserTenantByUser will list tenants that a user is member of
+func (db *MySQLDB) ListUserTenantByUser(ctx context.Context, user *User, request *helper.PageRequest) ([]*Tenant, *helper.Page, error) {
+	fLog := mysqlLog.WithField("func", "ListUserTenantByUser").WithField("RequestID", ctx.Value(constants.RequestID))
+	query, err := newListQuery(request, tenantListColumns, "T", "TENANT_NAME")
+	if err != nil {
+		return nil, nil, err
+	}
+	count := 0
+	q := "SELECT COUNT(*) FROM HANSIP_USER_TENANT UT, HANSIP_TENANT T WHERE UT.TENANT_REC_ID = T.REC_ID AND UT.USER_REC_ID = ?" + query.filter
+	if query.counted() {
+		row := db.conn(ctx).QueryRowContext(ctx, q, query.countArgs(user.RecID)...)
+		err = row.Scan(&count)
+		if err != nil {
+			fLog.Errorf("row.Scan got  %s", err.Error())
+			return nil, nil, &ErrDBScanError{
+				Wrapped: err,
+				Message: "Error ListUserTenantByUser",
+				SQL:     q,
+			}
+		}
+	}
+	page := query.page(count)
+	q = fmt.Sprintf("SELECT T.REC_ID, T.TENANT_NAME, T.TENANT_DOMAIN, T.DESCRIPTION, T.VERSION FROM HANSIP_USER_TENANT UT, HANSIP_TENANT T WHERE UT.TENANT_REC_ID = T.REC_ID AND UT.USER_REC_ID = ? %s ORDER BY %s LIMIT %s", query.where(), query.orderBy(), query.limit(page))
+	ret := make([]*Tenant, 0)
+	rows, err := db.conn(ctx).QueryContext(ctx, q, query.args(user.RecID)...)
+	if err != nil {
+		fLog.Errorf("db.instance.QueryContext got  %s. SQL = %s", err.Error(), q)
+		return nil, nil, &ErrDBQueryError{
+			Wrapped: err,
+			Message: "Error ListUserTenantByUser",
+			SQL:     q,
+		}
+	}
+	for rows.Next() {
+		t := &Tenant{}
+		err := rows.Scan(&t.RecID, &t.Name, &t.Domain, &t.Description, &t.Version)
+		if err != nil {
+			fLog.Warnf("rows.Scan got  %s", err.Error())
+			return nil, nil, &ErrDBScanError{
+				Wrapped: err,
+				Message: "Error ListUserTenantByUser",
+				SQL:     q,
+			}
+		} else {
+			ret = append(ret, t)
+		}
+	}
+	return ret[:query.paginate(page, ret)], page, nil
+}
+
+// ListUserTenantByDomains will list all users that are member of any tenant with the specified domains
+func (db *MySQLDB) ListUserTenantByDomains(ctx context.Context, domains []string, request *helper.PageRequest) ([]*User, *helper.Page, error) {
+	fLog := mysqlLog.WithField("func", "ListUserTenantByDomains").WithField("RequestID", ctx.Value(constants.RequestID))
+	if len(domains) == 0 {
+		return make([]*User, 0), helper.NewPage(request, 0), nil
+	}
+	query, err := newListQuery(request, userListColumns, "R", "EMAIL")
+	if err != nil {
+		return nil, nil, err
+	}
+	domainArgs := make([]interface{}, len(domains))
+	marks := make([]string, len(domains))
+	for i, d := range domains {
+		domainArgs[i] = d
+		marks[i] = "?"
+	}
+	in := strings.Join(marks, ",")
+	count := 0
+	q := fmt.Sprintf("SELECT COUNT(DISTINCT UT.USER_REC_ID) FROM HANSIP_USER_TENANT UT, HANSIP_TENANT T, HANSIP_USER R WHERE UT.USER_REC_ID = R.REC_ID AND UT.TENANT_REC_ID = T.REC_ID AND T.TENANT_DOMAIN IN (%s)%s", in, query.filter)
+	if query.counted() {
+		row := db.conn(ctx).QueryRowContext(ctx, q, query.countArgs(domainArgs...)...)
+		err = row.Scan(&count)
+		if err != nil {
+			fLog.Errorf("row.Scan got  %s", err.Error())
+			return nil, nil, &ErrDBScanError{
+				Wrapped: err,
+				Message: "Error ListUserTenantByDomains",
+				SQL:     q,
+			}
+		}
+	}
+	page := query.page(count)
+	q = fmt.Sprintf("SELECT DISTINCT R.REC_ID,R.EMAIL,R.HASHED_PASSPHRASE,R.ENABLED, R.SUSPENDED,R.LAST_SEEN,R.LAST_LOGIN,R.FAIL_COUNT,R.ACTIVATION_CODE,R.ACTIVATION_DATE,R.TOTP_KEY,R.ENABLE_2FE,R.TOKEN_2FE,R.RECOVERY_CODE,R.LOCALE,R.EMAIL_2FE,R.VERSION FROM HANSIP_USER_TENANT UT, HANSIP_TENANT T, HANSIP_USER R WHERE UT.USER_REC_ID = R.REC_ID AND UT.TENANT_REC_ID = T.REC_ID AND T.TENANT_DOMAIN IN (%s)%s ORDER BY %s LIMIT %s", in, query.where(), query.orderBy(), query.limit(page))
+	ret := make([]*User, 0)
+	rows, err := db.conn(ctx).QueryContext(ctx, q, query.args(domainArgs...)...)
+	if err != nil {
+		fLog.Errorf("db.instance.QueryContext got  %s. SQL = %s", err.Error(), q)
+		return nil, nil, &ErrDBQueryError{
+			Wrapped: err,
+			Message: "Error ListUserTenantByDomains",
+			SQL:     q,
+		}
+	}
+	for rows.Next() {
+		user := &User{}
+		var enabled, suspended, enable2fa, email2fa int
+		err := rows.Scan(&user.RecID, &user.Email, &user.HashedPassphrase, &enabled, &suspended, &user.LastSeen, &user.LastLogin, &user.FailCount, &user.ActivationCode,
+			&user.ActivationDate, &user.UserTotpSecretKey, &enable2fa, &user.Token2FA, &user.RecoveryCode, &user.Locale, &email2fa, &user.Version)
+		if err != nil {
+			fLog.Warnf("rows.Scan got  %s", err.Error())
+			return nil, nil, &ErrDBScanError{
+				Wrapped: err,
+				Message: "Error ListUserTenantByDomains",
+				SQL:     q,
+			}
+		} else {
+			if enabled == 1 {
+				user.Enabled = true
+			}
+			if suspended == 1 {
+				user.Suspended = true
+			}
+			if enable2fa == 1 {
+				user.Enable2FactorAuth = true
+			}
+			if email2fa == 1 {
+				user.Enable2FactorEmail = true
+			}
+			ret = append(ret, user)
+		}
+	}
+	return ret[:query.paginate(page, ret)], page, nil
+}
+
+// DeleteUserTenant will delete a user-tenant relation
+func (db *MySQLDB) DeleteUserTenant(ctx context.Context, userTenant *UserTenant) error {
+	fLog := mysqlLog.WithField("func", "DeleteUserTenant").WithField("RequestID", ctx.Value(constants.RequestID))
+	q := "DELETE FROM HANSIP_USER_TENANT WHERE TENANT_REC_ID=? AND USER_REC_ID=?"
+	_, err := db.conn(ctx).ExecContext(ctx, q, userTenant.TenantRecID, userTenant.UserRecID)
+	if err != nil {
+		fLog.Errorf("db.instance.ExecContext got %s. SQL = %s", err.Error(), q)
+		return &ErrDBExecuteError{
+			Wrapped: err,
+			Message: "Error DeleteUserTenant",
+			SQL:     q,
+		}
+	}
+	return nil
+}
+
+// DeleteUserTenantByUser will delete all user-tenant relation of a user
+func (db *MySQLDB) DeleteUserTenantByUser(ctx context.Context, user *User) error {
+	fLog := mysqlLog.WithField("func", "DeleteUserTenantByUser").WithField("RequestID", ctx.Value(constants.RequestID))
+	q := "DELETE FROM HANSIP_USER_TENANT WHERE USER_REC_ID=?"
+	_, err := db.conn(ctx).ExecContext(ctx, q, user.RecID)
+	if err != nil {
+		fLog.Errorf("db.instance.ExecContext got %s. SQL = %s", err.Error(), q)
+		return &ErrDBExecuteError{
+			Wrapped: err,
+			Message: "Error DeleteUserTenantByUser",
+			SQL:     q,
+		}
+	}
+	return nil
+}
+
 // Revoke a subject
 func (db *MySQLDB) Revoke(ctx context.Context, subject string) error {
 	fLog := mysqlLog.WithField("func", "Revoke").WithField("RequestID", ctx.Value(constants.RequestID))
@@ -2201,7 +3254,7 @@ func (db *MySQLDB) Revoke(ctx context.Context, subject string) error {
 		return nil
 	}
 	q := "INSERT INTO HANSIP_REVOCATION(SUBJECT, ACTIVATION_DATE) VALUES (?,?)"
-	_, err = db.instance.ExecContext(ctx, q, subject, time.Now())
+	_, err = db.conn(ctx).ExecContext(ctx, q, subject, time.Now())
 	if err != nil {
 		fLog.Errorf("db.instance.ExecContext got %s. SQL = %s", err.Error(), q)
 		return &ErrDBExecuteError{
@@ -2224,7 +3277,7 @@ func (db *MySQLDB) UnRevoke(ctx context.Context, subject string) error {
 		return nil
 	}
 	q := "DELETE FROM HANSIP_REVOCATION WHERE SUBJECT=?"
-	_, err = db.instance.ExecContext(ctx, q, subject)
+	_, err = db.conn(ctx).ExecContext(ctx, q, subject)
 	if err != nil {
 		fLog.Errorf("db.instance.ExecContext got %s. SQL = %s", err.Error(), q)
 		return &ErrDBExecuteError{
@@ -2241,7 +3294,7 @@ func (db *MySQLDB) IsRevoked(ctx context.Context, subject string) (bool, error)
 	fLog := mysqlLog.WithField("func", "IsRevoked").WithField("RequestID", ctx.Value(constants.RequestID))
 	q := "SELECT COUNT(*) AS CNT FROM HANSIP_REVOCATION WHERE SUBJECT=?"
 
-	rows, err := db.instance.QueryContext(ctx, q, subject)
+	rows, err := db.conn(ctx).QueryContext(ctx, q, subject)
 	if err != nil {
 		fLog.Errorf("db.instance.QueryContext got %s. SQL = %s", err.Error(), q)
 		return false, &ErrDBQueryError{
@@ -2265,3 +3318,1549 @@ func (db *MySQLDB) IsRevoked(ctx context.Context, subject string) (bool, error)
 	}
 	return false, nil
 }
+
+// GetAttributeSchemaByRecID return an attribute schema record
+func (db *MySQLDB) GetAttributeSchemaByRecID(ctx context.Context, recID string) (*AttributeSchema, error) {
+	fLog := mysqlLog.WithField("func", "GetAttributeSchemaByRecID").WithField("RequestID", ctx.Value(constants.RequestID))
+	q := "SELECT REC_ID, TENANT_REC_ID, ATTRIBUTE_NAME, ATTRIBUTE_TYPE, REQUIRED_FLAG, UNIQUE_FLAG, PII_FLAG, CLAIM_NAME, DESCRIPTION FROM HANSIP_ATTRIBUTE_SCHEMA WHERE REC_ID=?"
+	row := db.conn(ctx).QueryRowContext(ctx, q, recID)
+	a := &AttributeSchema{}
+	err := row.Scan(&a.RecID, &a.TenantRecID, &a.Name, &a.Type, &a.Required, &a.Unique, &a.PII, &a.Claim, &a.Description)
+	if err != nil {
+		fLog.Errorf("row.Scan got %s", err.Error())
+		return nil, &ErrDBScanError{
+			Wrapped: err,
+			Message: "Error GetAttributeSchemaByRecID",
+			SQL:     q,
+		}
+	}
+	return a, nil
+}
+
+// GetAttributeSchemaByName return an attribute schema record of a tenant
+func (db *MySQLDB) GetAttributeSchemaByName(ctx context.Context, tenant *Tenant, name string) (*AttributeSchema, error) {
+	fLog := mysqlLog.WithField("func", "GetAttributeSchemaByName").WithField("RequestID", ctx.Value(constants.RequestID))
+	q := "SELECT REC_ID, TENANT_REC_ID, ATTRIBUTE_NAME, ATTRIBUTE_TYPE, REQUIRED_FLAG, UNIQUE_FLAG, PII_FLAG, CLAIM_NAME, DESCRIPTION FROM HANSIP_ATTRIBUTE_SCHEMA WHERE TENANT_REC_ID=? AND ATTRIBUTE_NAME=?"
+	row := db.conn(ctx).QueryRowContext(ctx, q, tenant.RecID, name)
+	a := &AttributeSchema{}
+	err := row.Scan(&a.RecID, &a.TenantRecID, &a.Name, &a.Type, &a.Required, &a.Unique, &a.PII, &a.Claim, &a.Description)
+	if err != nil {
+		fLog.Errorf("row.Scan got %s", err.Error())
+		return nil, &ErrDBScanError{
+			Wrapped: err,
+			Message: "Error GetAttributeSchemaByName",
+			SQL:     q,
+		}
+	}
+	return a, nil
+}
+
+// CreateAttributeSchema into the attribute schema table of a tenant
+func (db *MySQLDB) CreateAttributeSchema(ctx context.Context, tenant *Tenant, schema *AttributeSchema) (*AttributeSchema, error) {
+	fLog := mysqlLog.WithField("func", "CreateAttributeSchema").WithField("RequestID", ctx.Value(constants.RequestID))
+	a := &AttributeSchema{
+		RecID:       helper.MakeRandomString(10, true, true, true, false),
+		TenantRecID: tenant.RecID,
+		Name:        schema.Name,
+		Type:        schema.Type,
+		Required:    schema.Required,
+		Unique:      schema.Unique,
+		PII:         schema.PII,
+		Claim:       schema.Claim,
+		Description: schema.Description,
+	}
+	q := "INSERT INTO HANSIP_ATTRIBUTE_SCHEMA(REC_ID, TENANT_REC_ID, ATTRIBUTE_NAME, ATTRIBUTE_TYPE, REQUIRED_FLAG, UNIQUE_FLAG, PII_FLAG, CLAIM_NAME, DESCRIPTION) VALUES (?,?,?,?,?,?,?,?,?)"
+	_, err := db.conn(ctx).ExecContext(ctx, q, a.RecID, a.TenantRecID, a.Name, a.Type, a.Required, a.Unique, a.PII, a.Claim, a.Description)
+	if err != nil {
+		fLog.Errorf("db.instance.ExecContext got %s. SQL = %s", err.Error(), q)
+		return nil, &ErrDBExecuteError{
+			Wrapped: err,
+			Message: "Error CreateAttributeSchema",
+			SQL:     q,
+		}
+	}
+	return a, nil
+}
+
+// ListAttributeSchemas list all attribute schemas of a tenant ordered by name
+func (db *MySQLDB) ListAttributeSchemas(ctx context.Context, tenant *Tenant) ([]*AttributeSchema, error) {
+	fLog := mysqlLog.WithField("func", "ListAttributeSchemas").WithField("RequestID", ctx.Value(constants.RequestID))
+	q := "SELECT REC_ID, TENANT_REC_ID, ATTRIBUTE_NAME, ATTRIBUTE_TYPE, REQUIRED_FLAG, UNIQUE_FLAG, PII_FLAG, CLAIM_NAME, DESCRIPTION FROM HANSIP_ATTRIBUTE_SCHEMA WHERE TENANT_REC_ID=? ORDER BY ATTRIBUTE_NAME ASC"
+	rows, err := db.conn(ctx).QueryContext(ctx, q, tenant.RecID)
+	if err != nil {
+		fLog.Errorf("db.instance.QueryContext got %s. SQL = %s", err.Error(), q)
+		return nil, &ErrDBQueryError{
+			Wrapped: err,
+			Message: "Error ListAttributeSchemas",
+			SQL:     q,
+		}
+	}
+	defer rows.Close()
+	ret := make([]*AttributeSchema, 0)
+	for rows.Next() {
+		a := &AttributeSchema{}
+		err := rows.Scan(&a.RecID, &a.TenantRecID, &a.Name, &a.Type, &a.Required, &a.Unique, &a.PII, &a.Claim, &a.Description)
+		if err != nil {
+			fLog.Warnf("rows.Scan got %s", err.Error())
+			return nil, &ErrDBScanError{
+				Wrapped: err,
+				Message: "Error ListAttributeSchemas",
+				SQL:     q,
+			}
+		}
+		ret = append(ret, a)
+	}
+	return ret, nil
+}
+
+// UpdateAttributeSchema into attribute schema table
+func (db *MySQLDB) UpdateAttributeSchema(ctx context.Context, schema *AttributeSchema) error {
+	fLog := mysqlLog.WithField("func", "UpdateAttributeSchema").WithField("RequestID", ctx.Value(constants.RequestID))
+	q := "UPDATE HANSIP_ATTRIBUTE_SCHEMA SET ATTRIBUTE_NAME=?, ATTRIBUTE_TYPE=?, REQUIRED_FLAG=?, UNIQUE_FLAG=?, PII_FLAG=?, CLAIM_NAME=?, DESCRIPTION=? WHERE REC_ID=?"
+	_, err := db.conn(ctx).ExecContext(ctx, q, schema.Name, schema.Type, schema.Required, schema.Unique, schema.PII, schema.Claim, schema.Description, schema.RecID)
+	if err != nil {
+		fLog.Errorf("db.instance.ExecContext got %s. SQL = %s", err.Error(), q)
+		return &ErrDBExecuteError{
+			Wrapped: err,
+			Message: "Error UpdateAttributeSchema",
+			SQL:     q,
+		}
+	}
+	return nil
+}
+
+// DeleteAttributeSchema from attribute schema table, the values of all users are removed by the cascading foreign key
+func (db *MySQLDB) DeleteAttributeSchema(ctx context.Context, schema *AttributeSchema) error {
+	fLog := mysqlLog.WithField("func", "DeleteAttributeSchema").WithField("RequestID", ctx.Value(constants.RequestID))
+	q := "DELETE FROM HANSIP_ATTRIBUTE_SCHEMA WHERE REC_ID=?"
+	_, err := db.conn(ctx).ExecContext(ctx, q, schema.RecID)
+	if err != nil {
+		fLog.Errorf("db.instance.ExecContext got %s. SQL = %s", err.Error(), q)
+		return &ErrDBExecuteError{
+			Wrapped: err,
+			Message: "Error DeleteAttributeSchema",
+			SQL:     q,
+		}
+	}
+	return nil
+}
+
+// ListUserAttributes list the attribute values of a user defined by a tenant
+func (db *MySQLDB) ListUserAttributes(ctx context.Context, user *User, tenant *Tenant) ([]*UserAttribute, error) {
+	fLog := mysqlLog.WithField("func", "ListUserAttributes").WithField("RequestID", ctx.Value(constants.RequestID))
+	q := "SELECT UA.USER_REC_ID, UA.ATTRIBUTE_REC_ID, UA.ATTRIBUTE_VALUE FROM HANSIP_USER_ATTRIBUTE UA, HANSIP_ATTRIBUTE_SCHEMA A WHERE UA.ATTRIBUTE_REC_ID=A.REC_ID AND UA.USER_REC_ID=? AND A.TENANT_REC_ID=?"
+	rows, err := db.conn(ctx).QueryContext(ctx, q, user.RecID, tenant.RecID)
+	if err != nil {
+		fLog.Errorf("db.instance.QueryContext got %s. SQL = %s", err.Error(), q)
+		return nil, &ErrDBQueryError{
+			Wrapped: err,
+			Message: "Error ListUserAttributes",
+			SQL:     q,
+		}
+	}
+	defer rows.Close()
+	ret := make([]*UserAttribute, 0)
+	for rows.Next() {
+		ua := &UserAttribute{}
+		err := rows.Scan(&ua.UserRecID, &ua.AttributeRecID, &ua.Value)
+		if err != nil {
+			fLog.Warnf("rows.Scan got %s", err.Error())
+			return nil, &ErrDBScanError{
+				Wrapped: err,
+				Message: "Error ListUserAttributes",
+				SQL:     q,
+			}
+		}
+		ret = append(ret, ua)
+	}
+	return ret, nil
+}
+
+// SetUserAttribute create or replace an attribute value of a user
+func (db *MySQLDB) SetUserAttribute(ctx context.Context, user *User, schema *AttributeSchema, value string) error {
+	fLog := mysqlLog.WithField("func", "SetUserAttribute").WithField("RequestID", ctx.Value(constants.RequestID))
+	q := "REPLACE INTO HANSIP_USER_ATTRIBUTE(USER_REC_ID, ATTRIBUTE_REC_ID, ATTRIBUTE_VALUE) VALUES (?,?,?)"
+	_, err := db.conn(ctx).ExecContext(ctx, q, user.RecID, schema.RecID, value)
+	if err != nil {
+		fLog.Errorf("db.instance.ExecContext got %s. SQL = %s", err.Error(), q)
+		return &ErrDBExecuteError{
+			Wrapped: err,
+			Message: "Error SetUserAttribute",
+			SQL:     q,
+		}
+	}
+	return nil
+}
+
+// DeleteUserAttribute removes an attribute value of a user
+func (db *MySQLDB) DeleteUserAttribute(ctx context.Context, user *User, schema *AttributeSchema) error {
+	fLog := mysqlLog.WithField("func", "DeleteUserAttribute").WithField("RequestID", ctx.Value(constants.RequestID))
+	q := "DELETE FROM HANSIP_USER_ATTRIBUTE WHERE USER_REC_ID=? AND ATTRIBUTE_REC_ID=?"
+	_, err := db.conn(ctx).ExecContext(ctx, q, user.RecID, schema.RecID)
+	if err != nil {
+		fLog.Errorf("db.instance.ExecContext got %s. SQL = %s", err.Error(), q)
+		return &ErrDBExecuteError{
+			Wrapped: err,
+			Message: "Error DeleteUserAttribute",
+			SQL:     q,
+		}
+	}
+	return nil
+}
+
+// IsAttributeValueTaken check if another user already has the value of the attribute
+func (db *MySQLDB) IsAttributeValueTaken(ctx context.Context, schema *AttributeSchema, value string, user *User) (bool, error) {
+	fLog := mysqlLog.WithField("func", "IsAttributeValueTaken").WithField("RequestID", ctx.Value(constants.RequestID))
+	q := "SELECT COUNT(*) AS CNT FROM HANSIP_USER_ATTRIBUTE WHERE ATTRIBUTE_REC_ID=? AND ATTRIBUTE_VALUE=? AND USER_REC_ID<>?"
+	row := db.conn(ctx).QueryRowContext(ctx, q, schema.RecID, value, user.RecID)
+	count := 0
+	err := row.Scan(&count)
+	if err != nil {
+		fLog.Errorf("row.Scan got %s", err.Error())
+		return false, &ErrDBScanError{
+			Wrapped: err,
+			Message: "Error IsAttributeValueTaken",
+			SQL:     q,
+		}
+	}
+	return count > 0, nil
+}
+
+// splitRecIDs splits comma separated record ids
+func splitRecIDs(recIDs string) []string {
+	ret := make([]string, 0)
+	for _, recID := range strings.Split(recIDs, ",") {
+		if len(recID) > 0 {
+			ret = append(ret, recID)
+		}
+	}
+	return ret
+}
+
+// rowScanner is either *sql.Row or *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanInvitation scans a row of HANSIP_INVITATION
+func scanInvitation(row rowScanner) (*Invitation, error) {
+	inv := &Invitation{}
+	var groups, roles string
+	err := row.Scan(&inv.RecID, &inv.Email, &inv.TenantRecID, &inv.TokenHash, &groups, &roles, &inv.InvitedBy, &inv.CreatedAt, &inv.ExpireAt)
+	if err != nil {
+		return nil, err
+	}
+	inv.GroupRecIDs = splitRecIDs(groups)
+	inv.RoleRecIDs = splitRecIDs(roles)
+	return inv, nil
+}
+
+// GetInvitationByRecID return an invitation record
+func (db *MySQLDB) GetInvitationByRecID(ctx context.Context, recID string) (*Invitation, error) {
+	fLog := mysqlLog.WithField("func", "GetInvitationByRecID").WithField("RequestID", ctx.Value(constants.RequestID))
+	q := "SELECT REC_ID, EMAIL, TENANT_REC_ID, TOKEN, GROUP_REC_IDS, ROLE_REC_IDS, INVITED_BY, CREATED_AT, EXPIRE_AT FROM HANSIP_INVITATION WHERE REC_ID=?"
+	inv, err := scanInvitation(db.conn(ctx).QueryRowContext(ctx, q, recID))
+	if err != nil {
+		fLog.Errorf("row.Scan got %s", err.Error())
+		return nil, &ErrDBScanError{
+			Wrapped: err,
+			Message: "Error GetInvitationByRecID",
+			SQL:     q,
+		}
+	}
+	return inv, nil
+}
+
+// GetInvitationByTokenHash return an invitation record by the hash of its token
+func (db *MySQLDB) GetInvitationByTokenHash(ctx context.Context, tokenHash string) (*Invitation, error) {
+	fLog := mysqlLog.WithField("func", "GetInvitationByTokenHash").WithField("RequestID", ctx.Value(constants.RequestID))
+	q := "SELECT REC_ID, EMAIL, TENANT_REC_ID, TOKEN, GROUP_REC_IDS, ROLE_REC_IDS, INVITED_BY, CREATED_AT, EXPIRE_AT FROM HANSIP_INVITATION WHERE TOKEN=?"
+	inv, err := scanInvitation(db.conn(ctx).QueryRowContext(ctx, q, tokenHash))
+	if err != nil {
+		fLog.Errorf("row.Scan got %s", err.Error())
+		return nil, &ErrDBScanError{
+			Wrapped: err,
+			Message: "Error GetInvitationByTokenHash",
+			SQL:     q,
+		}
+	}
+	return inv, nil
+}
+
+// CreateInvitation into the invitation table, storing the hash of its token
+func (db *MySQLDB) CreateInvitation(ctx context.Context, email string, tenant *Tenant, tokenHash string, groupRecIDs, roleRecIDs []string, invitedBy string, expireAt time.Time) (*Invitation, error) {
+	fLog := mysqlLog.WithField("func", "CreateInvitation").WithField("RequestID", ctx.Value(constants.RequestID))
+	inv := &Invitation{
+		RecID:       helper.MakeRandomString(10, true, true, true, false),
+		Email:       email,
+		TenantRecID: tenant.RecID,
+		TokenHash:   tokenHash,
+		GroupRecIDs: groupRecIDs,
+		RoleRecIDs:  roleRecIDs,
+		InvitedBy:   invitedBy,
+		CreatedAt:   time.Now(),
+		ExpireAt:    expireAt,
+	}
+	q := "INSERT INTO HANSIP_INVITATION(REC_ID, EMAIL, TENANT_REC_ID, TOKEN, GROUP_REC_IDS, ROLE_REC_IDS, INVITED_BY, CREATED_AT, EXPIRE_AT) VALUES (?,?,?,?,?,?,?,?,?)"
+	_, err := db.conn(ctx).ExecContext(ctx, q, inv.RecID, inv.Email, inv.TenantRecID, inv.TokenHash, strings.Join(groupRecIDs, ","), strings.Join(roleRecIDs, ","), inv.InvitedBy, inv.CreatedAt, inv.ExpireAt)
+	if err != nil {
+		fLog.Errorf("db.instance.ExecContext got %s. SQL = %s", err.Error(), q)
+		return nil, &ErrDBExecuteError{
+			Wrapped: err,
+			Message: "Error CreateInvitation",
+			SQL:     q,
+		}
+	}
+	return inv, nil
+}
+
+// ListInvitations list all pending invitations of a tenant ordered by email
+func (db *MySQLDB) ListInvitations(ctx context.Context, tenant *Tenant) ([]*Invitation, error) {
+	fLog := mysqlLog.WithField("func", "ListInvitations").WithField("RequestID", ctx.Value(constants.RequestID))
+	q := "SELECT REC_ID, EMAIL, TENANT_REC_ID, TOKEN, GROUP_REC_IDS, ROLE_REC_IDS, INVITED_BY, CREATED_AT, EXPIRE_AT FROM HANSIP_INVITATION WHERE TENANT_REC_ID=? ORDER BY EMAIL ASC"
+	rows, err := db.conn(ctx).QueryContext(ctx, q, tenant.RecID)
+	if err != nil {
+		fLog.Errorf("db.instance.QueryContext got %s. SQL = %s", err.Error(), q)
+		return nil, &ErrDBQueryError{
+			Wrapped: err,
+			Message: "Error ListInvitations",
+			SQL:     q,
+		}
+	}
+	defer rows.Close()
+	ret := make([]*Invitation, 0)
+	for rows.Next() {
+		inv, err := scanInvitation(rows)
+		if err != nil {
+			fLog.Warnf("rows.Scan got %s", err.Error())
+			return nil, &ErrDBScanError{
+				Wrapped: err,
+				Message: "Error ListInvitations",
+				SQL:     q,
+			}
+		}
+		ret = append(ret, inv)
+	}
+	return ret, nil
+}
+
+// RenewInvitation replaces the token hash of an invitation and extends its expiry
+func (db *MySQLDB) RenewInvitation(ctx context.Context, invitation *Invitation, tokenHash string, expireAt time.Time) error {
+	fLog := mysqlLog.WithField("func", "RenewInvitation").WithField("RequestID", ctx.Value(constants.RequestID))
+	q := "UPDATE HANSIP_INVITATION SET TOKEN=?, EXPIRE_AT=? WHERE REC_ID=?"
+	_, err := db.conn(ctx).ExecContext(ctx, q, tokenHash, expireAt, invitation.RecID)
+	if err != nil {
+		fLog.Errorf("db.instance.ExecContext got %s. SQL = %s", err.Error(), q)
+		return &ErrDBExecuteError{
+			Wrapped: err,
+			Message: "Error RenewInvitation",
+			SQL:     q,
+		}
+	}
+	invitation.TokenHash = tokenHash
+	invitation.ExpireAt = expireAt
+	return nil
+}
+
+// DeleteInvitation removes an invitation, either revoked or accepted
+func (db *MySQLDB) DeleteInvitation(ctx context.Context, invitation *Invitation) error {
+	fLog := mysqlLog.WithField("func", "DeleteInvitation").WithField("RequestID", ctx.Value(constants.RequestID))
+	q := "DELETE FROM HANSIP_INVITATION WHERE REC_ID=?"
+	_, err := db.conn(ctx).ExecContext(ctx, q, invitation.RecID)
+	if err != nil {
+		fLog.Errorf("db.instance.ExecContext got %s. SQL = %s", err.Error(), q)
+		return &ErrDBExecuteError{
+			Wrapped: err,
+			Message: "Error DeleteInvitation",
+			SQL:     q,
+		}
+	}
+	return nil
+}
+
+// AppendAuditEvent records a new audit event, its RecID, Seq and hashes are assigned.
+// The chain head is locked while appending so concurrent events are chained one after another.
+func (db *MySQLDB) AppendAuditEvent(ctx context.Context, event *AuditEvent) error {
+	fLog := mysqlLog.WithField("func", "AppendAuditEvent").WithField("RequestID", ctx.Value(constants.RequestID))
+	changes := ""
+	if len(event.Changes) > 0 {
+		b, err := json.Marshal(event.Changes)
+		if err != nil {
+			fLog.Errorf("json.Marshal got %s", err.Error())
+			return err
+		}
+		changes = string(b)
+	}
+	event.RecID = helper.MakeRandomString(10, true, true, true, false)
+	// DATETIME keeps whole seconds, the hash is made of the stored value.
+	event.Time = event.Time.UTC().Truncate(time.Second)
+	tx, err := db.instance.BeginTx(ctx, nil)
+	if err != nil {
+		fLog.Errorf("db.instance.BeginTx got %s", err.Error())
+		return err
+	}
+	defer tx.Rollback()
+	q := "SELECT HASH FROM HANSIP_AUDIT_HEAD WHERE ID = 1 FOR UPDATE"
+	err = tx.QueryRowContext(ctx, q).Scan(&event.PrevHash)
+	if err != nil {
+		fLog.Errorf("tx.QueryRowContext got %s. SQL = %s", err.Error(), q)
+		return &ErrDBQueryError{
+			Wrapped: err,
+			Message: "Error AppendAuditEvent",
+			SQL:     q,
+		}
+	}
+	event.Hash = auditEventHash(event.PrevHash, event, changes)
+	q = "INSERT INTO HANSIP_AUDIT_EVENT(REC_ID, EVENT_TIME, EVENT_TYPE, OUTCOME, ACTOR, TARGET_TYPE, TARGET_ID, TENANT_DOMAIN, CLIENT_IP, REQUEST_ID, CHANGES, PREV_HASH, HASH) VALUES (?,?,?,?,?,?,?,?,?,?,?,?,?)"
+	res, err := tx.ExecContext(ctx, q, event.RecID, event.Time, event.Event, event.Outcome, event.Actor, event.TargetType, event.Target, event.TenantDomain, event.ClientIP, event.RequestID, changes, event.PrevHash, event.Hash)
+	if err != nil {
+		fLog.Errorf("tx.ExecContext got %s. SQL = %s", err.Error(), q)
+		return &ErrDBExecuteError{
+			Wrapped: err,
+			Message: "Error AppendAuditEvent",
+			SQL:     q,
+		}
+	}
+	event.Seq, err = res.LastInsertId()
+	if err != nil {
+		fLog.Errorf("res.LastInsertId got %s", err.Error())
+		return err
+	}
+	q = "UPDATE HANSIP_AUDIT_HEAD SET SEQ_NO = ?, HASH = ? WHERE ID = 1"
+	_, err = tx.ExecContext(ctx, q, event.Seq, event.Hash)
+	if err != nil {
+		fLog.Errorf("tx.ExecContext got %s. SQL = %s", err.Error(), q)
+		return &ErrDBExecuteError{
+			Wrapped: err,
+			Message: "Error AppendAuditEvent",
+			SQL:     q,
+		}
+	}
+	return tx.Commit()
+}
+
+// walkAuditEvents calls fn with every audit event up to the sequence and its stored changes, in sequence order,
+// until fn returns false.
+func (db *MySQLDB) walkAuditEvents(ctx context.Context, upTo int64, fn func(event *AuditEvent, changes string) (bool, error)) error {
+	fLog := mysqlLog.WithField("func", "walkAuditEvents").WithField("RequestID", ctx.Value(constants.RequestID))
+	q := "SELECT REC_ID, SEQ_NO, EVENT_TIME, EVENT_TYPE, OUTCOME, ACTOR, TARGET_TYPE, TARGET_ID, TENANT_DOMAIN, CLIENT_IP, REQUEST_ID, CHANGES, PREV_HASH, HASH FROM HANSIP_AUDIT_EVENT WHERE SEQ_NO > ? AND SEQ_NO <= ? ORDER BY SEQ_NO ASC LIMIT 500"
+	after := int64(0)
+	for {
+		rows, err := db.conn(ctx).QueryContext(ctx, q, after, upTo)
+		if err != nil {
+			fLog.Errorf("db.instance.QueryContext got  %s. SQL = %s", err.Error(), q)
+			return &ErrDBQueryError{
+				Wrapped: err,
+				Message: "Error walkAuditEvents",
+				SQL:     q,
+			}
+		}
+		events := make([]*AuditEvent, 0)
+		changes := make([]string, 0)
+		for rows.Next() {
+			e := &AuditEvent{}
+			var c string
+			err := rows.Scan(&e.RecID, &e.Seq, &e.Time, &e.Event, &e.Outcome, &e.Actor, &e.TargetType, &e.Target, &e.TenantDomain, &e.ClientIP, &e.RequestID, &c, &e.PrevHash, &e.Hash)
+			if err != nil {
+				rows.Close()
+				fLog.Warnf("rows.Scan got  %s", err.Error())
+				return &ErrDBScanError{
+					Wrapped: err,
+					Message: "Error walkAuditEvents",
+					SQL:     q,
+				}
+			}
+			events = append(events, e)
+			changes = append(changes, c)
+		}
+		rows.Close()
+		for i, e := range events {
+			next, err := fn(e, changes[i])
+			if err != nil || !next {
+				return err
+			}
+			after = e.Seq
+		}
+		if len(events) == 0 {
+			return nil
+		}
+	}
+}
+
+// chainAuditEvents computes the hash chain of all audit events in their recorded order and moves the chain head
+// to the last of them. It is used once, to chain events recorded before hash chaining existed.
+func (db *MySQLDB) chainAuditEvents(ctx context.Context) error {
+	fLog := mysqlLog.WithField("func", "chainAuditEvents").WithField("RequestID", ctx.Value(constants.RequestID))
+	seq, hash := int64(0), ""
+	q := "UPDATE HANSIP_AUDIT_EVENT SET PREV_HASH = ?, HASH = ? WHERE REC_ID = ?"
+	err := db.walkAuditEvents(ctx, math.MaxInt64, func(event *AuditEvent, changes string) (bool, error) {
+		event.PrevHash = hash
+		event.Hash = auditEventHash(event.PrevHash, event, changes)
+		_, err := db.conn(ctx).ExecContext(ctx, q, event.PrevHash, event.Hash, event.RecID)
+		if err != nil {
+			fLog.Errorf("db.instance.ExecContext got %s. SQL = %s", err.Error(), q)
+			return false, &ErrDBExecuteError{
+				Wrapped: err,
+				Message: "Error chainAuditEvents",
+				SQL:     q,
+			}
+		}
+		seq, hash = event.Seq, event.Hash
+		return true, nil
+	})
+	if err != nil {
+		return err
+	}
+	q = "UPDATE HANSIP_AUDIT_HEAD SET SEQ_NO = ?, HASH = ? WHERE ID = 1"
+	_, err = db.conn(ctx).ExecContext(ctx, q, seq, hash)
+	if err != nil {
+		fLog.Errorf("db.instance.ExecContext got %s. SQL = %s", err.Error(), q)
+		return &ErrDBExecuteError{
+			Wrapped: err,
+			Message: "Error chainAuditEvents",
+			SQL:     q,
+		}
+	}
+	return nil
+}
+
+// GetAuditChainHead returns the sequence and hash of the last event in the hash chain, 0 and empty if there is none.
+func (db *MySQLDB) GetAuditChainHead(ctx context.Context) (int64, string, error) {
+	fLog := mysqlLog.WithField("func", "GetAuditChainHead").WithField("RequestID", ctx.Value(constants.RequestID))
+	seq, hash := int64(0), ""
+	q := "SELECT SEQ_NO, HASH FROM HANSIP_AUDIT_HEAD WHERE ID = 1"
+	err := db.conn(ctx).QueryRowContext(ctx, q).Scan(&seq, &hash)
+	if err != nil {
+		fLog.Errorf("row.Scan got %s", err.Error())
+		return 0, "", &ErrDBScanError{
+			Wrapped: err,
+			Message: "Error GetAuditChainHead",
+			SQL:     q,
+		}
+	}
+	return seq, hash, nil
+}
+
+// VerifyAuditChain walks the hash chain from the first event and reports the first broken link.
+// checkpoints maps sequence to the hash a signed checkpoint vouches for.
+func (db *MySQLDB) VerifyAuditChain(ctx context.Context, checkpoints map[int64]string) (*AuditChainReport, error) {
+	headSeq, headHash, err := db.GetAuditChainHead(ctx)
+	if err != nil {
+		return nil, err
+	}
+	checker := newAuditChainChecker(checkpoints)
+	err = db.walkAuditEvents(ctx, headSeq, func(event *AuditEvent, changes string) (bool, error) {
+		return checker.check(event, changes), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return checker.finish(headSeq, headHash), nil
+}
+
+// CreateAuditCheckpoint records a signed checkpoint of the hash chain, its RecID is assigned
+func (db *MySQLDB) CreateAuditCheckpoint(ctx context.Context, checkpoint *AuditCheckpoint) error {
+	fLog := mysqlLog.WithField("func", "CreateAuditCheckpoint").WithField("RequestID", ctx.Value(constants.RequestID))
+	checkpoint.RecID = helper.MakeRandomString(10, true, true, true, false)
+	q := "INSERT INTO HANSIP_AUDIT_CHECKPOINT(REC_ID, SEQ_NO, HASH, CREATED_AT, SIGNATURE) VALUES (?,?,?,?,?)"
+	_, err := db.conn(ctx).ExecContext(ctx, q, checkpoint.RecID, checkpoint.Seq, checkpoint.Hash, checkpoint.CreatedAt.UTC(), checkpoint.Signature)
+	if err != nil {
+		fLog.Errorf("db.instance.ExecContext got %s. SQL = %s", err.Error(), q)
+		return &ErrDBExecuteError{
+			Wrapped: err,
+			Message: "Error CreateAuditCheckpoint",
+			SQL:     q,
+		}
+	}
+	return nil
+}
+
+// ListAuditCheckpoints list all checkpoints ordered by sequence
+func (db *MySQLDB) ListAuditCheckpoints(ctx context.Context) ([]*AuditCheckpoint, error) {
+	fLog := mysqlLog.WithField("func", "ListAuditCheckpoints").WithField("RequestID", ctx.Value(constants.RequestID))
+	q := "SELECT REC_ID, SEQ_NO, HASH, CREATED_AT, SIGNATURE FROM HANSIP_AUDIT_CHECKPOINT ORDER BY SEQ_NO ASC, CREATED_AT ASC"
+	rows, err := db.conn(ctx).QueryContext(ctx, q)
+	if err != nil {
+		fLog.Errorf("db.instance.QueryContext got  %s. SQL = %s", err.Error(), q)
+		return nil, &ErrDBQueryError{
+			Wrapped: err,
+			Message: "Error ListAuditCheckpoints",
+			SQL:     q,
+		}
+	}
+	defer rows.Close()
+	ret := make([]*AuditCheckpoint, 0)
+	for rows.Next() {
+		c := &AuditCheckpoint{}
+		err := rows.Scan(&c.RecID, &c.Seq, &c.Hash, &c.CreatedAt, &c.Signature)
+		if err != nil {
+			fLog.Warnf("rows.Scan got  %s", err.Error())
+			return nil, &ErrDBScanError{
+				Wrapped: err,
+				Message: "Error ListAuditCheckpoints",
+				SQL:     q,
+			}
+		}
+		ret = append(ret, c)
+	}
+	return ret, nil
+}
+
+// auditDomainFilter builds the condition limiting audit events to the tenant domains, nil domains is not limited.
+func auditDomainFilter(domains []string) (string, []interface{}) {
+	args := make([]interface{}, len(domains))
+	if domains == nil {
+		return "", args
+	}
+	if len(domains) == 0 {
+		return " AND 1=0", args
+	}
+	for i, domain := range domains {
+		args[i] = domain
+	}
+	return fmt.Sprintf(" AND TENANT_DOMAIN IN (%s)", strings.TrimSuffix(strings.Repeat("?,", len(domains)), ",")), args
+}
+
+// ListAuditEvents list audit events with pagination, limited to events of the tenant domains.
+func (db *MySQLDB) ListAuditEvents(ctx context.Context, domains []string, request *helper.PageRequest) ([]*AuditEvent, *helper.Page, error) {
+	fLog := mysqlLog.WithField("func", "ListAuditEvents").WithField("RequestID", ctx.Value(constants.RequestID))
+	query, err := newListQuery(request, auditListColumns, "", "SEQ_NO")
+	if err != nil {
+		return nil, nil, err
+	}
+	domainFilter, domainArgs := auditDomainFilter(domains)
+	count := 0
+	q := "SELECT COUNT(*) AS CNT FROM HANSIP_AUDIT_EVENT WHERE 1=1" + domainFilter + query.filter
+	if query.counted() {
+		row := db.conn(ctx).QueryRowContext(ctx, q, query.countArgs(domainArgs...)...)
+		err = row.Scan(&count)
+		if err != nil {
+			fLog.Errorf("db.instance.QueryRowContext got  %s", err.Error())
+			return nil, nil, &ErrDBQueryError{
+				Wrapped: err,
+				Message: "Error ListAuditEvents",
+				SQL:     q,
+			}
+		}
+	}
+	page := query.page(count)
+	q = fmt.Sprintf("SELECT REC_ID, SEQ_NO, EVENT_TIME, EVENT_TYPE, OUTCOME, ACTOR, TARGET_TYPE, TARGET_ID, TENANT_DOMAIN, CLIENT_IP, REQUEST_ID, CHANGES, PREV_HASH, HASH FROM HANSIP_AUDIT_EVENT WHERE 1=1%s%s ORDER BY %s LIMIT %s", domainFilter, query.where(), query.orderBy(), query.limit(page))
+	rows, err := db.conn(ctx).QueryContext(ctx, q, query.args(domainArgs...)...)
+	if err != nil {
+		fLog.Errorf("db.instance.QueryContext got  %s. SQL = %s", err.Error(), q)
+		return nil, nil, &ErrDBQueryError{
+			Wrapped: err,
+			Message: "Error ListAuditEvents",
+			SQL:     q,
+		}
+	}
+	defer rows.Close()
+	ret := make([]*AuditEvent, 0)
+	for rows.Next() {
+		e := &AuditEvent{}
+		var changes string
+		err := rows.Scan(&e.RecID, &e.Seq, &e.Time, &e.Event, &e.Outcome, &e.Actor, &e.TargetType, &e.Target, &e.TenantDomain, &e.ClientIP, &e.RequestID, &changes, &e.PrevHash, &e.Hash)
+		if err != nil {
+			fLog.Warnf("rows.Scan got  %s", err.Error())
+			return nil, nil, &ErrDBScanError{
+				Wrapped: err,
+				Message: "Error ListAuditEvents",
+				SQL:     q,
+			}
+		}
+		if len(changes) > 0 {
+			if err := json.Unmarshal([]byte(changes), &e.Changes); err != nil {
+				fLog.Warnf("json.Unmarshal changes of %s got %s", e.RecID, err.Error())
+			}
+		}
+		ret = append(ret, e)
+	}
+	return ret[:query.paginate(page, ret)], page, nil
+}
+
+// scanWebhook scans a row of HANSIP_WEBHOOK
+func scanWebhook(row rowScanner) (*Webhook, error) {
+	webhook := &Webhook{}
+	var events string
+	err := row.Scan(&webhook.RecID, &webhook.TenantRecID, &webhook.URL, &webhook.Secret, &events, &webhook.Enabled, &webhook.Description, &webhook.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	webhook.Events = splitRecIDs(events)
+	return webhook, nil
+}
+
+// CreateWebhook into webhook table, its RecID and CreatedAt are assigned
+func (db *MySQLDB) CreateWebhook(ctx context.Context, webhook *Webhook) error {
+	fLog := mysqlLog.WithField("func", "CreateWebhook").WithField("RequestID", ctx.Value(constants.RequestID))
+	webhook.RecID = helper.MakeRandomString(10, true, true, true, false)
+	webhook.CreatedAt = time.Now()
+	q := "INSERT INTO HANSIP_WEBHOOK(REC_ID, TENANT_REC_ID, URL, SECRET, EVENT_TYPES, ENABLED, DESCRIPTION, CREATED_AT) VALUES (?,?,?,?,?,?,?,?)"
+	_, err := db.conn(ctx).ExecContext(ctx, q, webhook.RecID, webhook.TenantRecID, webhook.URL, webhook.Secret, strings.Join(webhook.Events, ","), webhook.Enabled, webhook.Description, webhook.CreatedAt)
+	if err != nil {
+		fLog.Errorf("db.instance.ExecContext got %s. SQL = %s", err.Error(), q)
+		return &ErrDBExecuteError{
+			Wrapped: err,
+			Message: "Error CreateWebhook",
+			SQL:     q,
+		}
+	}
+	return nil
+}
+
+// GetWebhookByRecID return a webhook record
+func (db *MySQLDB) GetWebhookByRecID(ctx context.Context, recID string) (*Webhook, error) {
+	fLog := mysqlLog.WithField("func", "GetWebhookByRecID").WithField("RequestID", ctx.Value(constants.RequestID))
+	q := "SELECT REC_ID, TENANT_REC_ID, URL, SECRET, EVENT_TYPES, ENABLED, DESCRIPTION, CREATED_AT FROM HANSIP_WEBHOOK WHERE REC_ID=?"
+	webhook, err := scanWebhook(db.conn(ctx).QueryRowContext(ctx, q, recID))
+	if err != nil {
+		fLog.Errorf("row.Scan got %s", err.Error())
+		return nil, &ErrDBScanError{
+			Wrapped: err,
+			Message: "Error GetWebhookByRecID",
+			SQL:     q,
+		}
+	}
+	return webhook, nil
+}
+
+// ListWebhooks list all webhooks of a tenant ordered by creation time
+func (db *MySQLDB) ListWebhooks(ctx context.Context, tenant *Tenant) ([]*Webhook, error) {
+	fLog := mysqlLog.WithField("func", "ListWebhooks").WithField("RequestID", ctx.Value(constants.RequestID))
+	q := "SELECT REC_ID, TENANT_REC_ID, URL, SECRET, EVENT_TYPES, ENABLED, DESCRIPTION, CREATED_AT FROM HANSIP_WEBHOOK WHERE TENANT_REC_ID=? ORDER BY CREATED_AT ASC, REC_ID ASC"
+	rows, err := db.conn(ctx).QueryContext(ctx, q, tenant.RecID)
+	if err != nil {
+		fLog.Errorf("db.instance.QueryContext got %s. SQL = %s", err.Error(), q)
+		return nil, &ErrDBQueryError{
+			Wrapped: err,
+			Message: "Error ListWebhooks",
+			SQL:     q,
+		}
+	}
+	defer rows.Close()
+	ret := make([]*Webhook, 0)
+	for rows.Next() {
+		webhook, err := scanWebhook(rows)
+		if err != nil {
+			fLog.Warnf("rows.Scan got %s", err.Error())
+			return nil, &ErrDBScanError{
+				Wrapped: err,
+				Message: "Error ListWebhooks",
+				SQL:     q,
+			}
+		}
+		ret = append(ret, webhook)
+	}
+	return ret, nil
+}
+
+// UpdateWebhook into webhook table
+func (db *MySQLDB) UpdateWebhook(ctx context.Context, webhook *Webhook) error {
+	fLog := mysqlLog.WithField("func", "UpdateWebhook").WithField("RequestID", ctx.Value(constants.RequestID))
+	q := "UPDATE HANSIP_WEBHOOK SET URL=?, SECRET=?, EVENT_TYPES=?, ENABLED=?, DESCRIPTION=? WHERE REC_ID=?"
+	_, err := db.conn(ctx).ExecContext(ctx, q, webhook.URL, webhook.Secret, strings.Join(webhook.Events, ","), webhook.Enabled, webhook.Description, webhook.RecID)
+	if err != nil {
+		fLog.Errorf("db.instance.ExecContext got %s. SQL = %s", err.Error(), q)
+		return &ErrDBExecuteError{
+			Wrapped: err,
+			Message: "Error UpdateWebhook",
+			SQL:     q,
+		}
+	}
+	return nil
+}
+
+// DeleteWebhook from webhook table, its deliveries are removed by the cascading foreign key
+func (db *MySQLDB) DeleteWebhook(ctx context.Context, webhook *Webhook) error {
+	fLog := mysqlLog.WithField("func", "DeleteWebhook").WithField("RequestID", ctx.Value(constants.RequestID))
+	q := "DELETE FROM HANSIP_WEBHOOK WHERE REC_ID=?"
+	_, err := db.conn(ctx).ExecContext(ctx, q, webhook.RecID)
+	if err != nil {
+		fLog.Errorf("db.instance.ExecContext got %s. SQL = %s", err.Error(), q)
+		return &ErrDBExecuteError{
+			Wrapped: err,
+			Message: "Error DeleteWebhook",
+			SQL:     q,
+		}
+	}
+	return nil
+}
+
+// scanWebhookDelivery scans a row of HANSIP_WEBHOOK_DELIVERY
+func scanWebhookDelivery(row rowScanner) (*WebhookDelivery, error) {
+	d := &WebhookDelivery{}
+	err := row.Scan(&d.RecID, &d.WebhookRecID, &d.EventID, &d.EventType, &d.Payload, &d.Status, &d.Attempts, &d.NextAttemptAt, &d.ResponseStatus, &d.LastError, &d.CreatedAt, &d.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// CreateWebhookDelivery into webhook delivery table, its RecID and CreatedAt are assigned
+func (db *MySQLDB) CreateWebhookDelivery(ctx context.Context, delivery *WebhookDelivery) error {
+	fLog := mysqlLog.WithField("func", "CreateWebhookDelivery").WithField("RequestID", ctx.Value(constants.RequestID))
+	delivery.RecID = helper.MakeRandomString(10, true, true, true, false)
+	// DATETIME keeps whole seconds, the next attempt is compared with the stored value when claimed.
+	delivery.CreatedAt = time.Now().UTC().Truncate(time.Second)
+	delivery.UpdatedAt = delivery.CreatedAt
+	delivery.NextAttemptAt = delivery.NextAttemptAt.UTC().Truncate(time.Second)
+	q := "INSERT INTO HANSIP_WEBHOOK_DELIVERY(REC_ID, WEBHOOK_REC_ID, EVENT_ID, EVENT_TYPE, PAYLOAD, STATUS, ATTEMPTS, NEXT_ATTEMPT_AT, RESPONSE_STATUS, LAST_ERROR, CREATED_AT, UPDATED_AT) VALUES (?,?,?,?,?,?,?,?,?,?,?,?)"
+	_, err := db.conn(ctx).ExecContext(ctx, q, delivery.RecID, delivery.WebhookRecID, delivery.EventID, delivery.EventType, delivery.Payload, delivery.Status, delivery.Attempts, delivery.NextAttemptAt, delivery.ResponseStatus, delivery.LastError, delivery.CreatedAt, delivery.UpdatedAt)
+	if err != nil {
+		fLog.Errorf("db.instance.ExecContext got %s. SQL = %s", err.Error(), q)
+		return &ErrDBExecuteError{
+			Wrapped: err,
+			Message: "Error CreateWebhookDelivery",
+			SQL:     q,
+		}
+	}
+	return nil
+}
+
+// GetWebhookDeliveryByRecID return a webhook delivery record
+func (db *MySQLDB) GetWebhookDeliveryByRecID(ctx context.Context, recID string) (*WebhookDelivery, error) {
+	fLog := mysqlLog.WithField("func", "GetWebhookDeliveryByRecID").WithField("RequestID", ctx.Value(constants.RequestID))
+	q := "SELECT REC_ID, WEBHOOK_REC_ID, EVENT_ID, EVENT_TYPE, PAYLOAD, STATUS, ATTEMPTS, NEXT_ATTEMPT_AT, RESPONSE_STATUS, LAST_ERROR, CREATED_AT, UPDATED_AT FROM HANSIP_WEBHOOK_DELIVERY WHERE REC_ID=?"
+	delivery, err := scanWebhookDelivery(db.conn(ctx).QueryRowContext(ctx, q, recID))
+	if err != nil {
+		fLog.Errorf("row.Scan got %s", err.Error())
+		return nil, &ErrDBScanError{
+			Wrapped: err,
+			Message: "Error GetWebhookDeliveryByRecID",
+			SQL:     q,
+		}
+	}
+	return delivery, nil
+}
+
+// ListWebhookDeliveries list the deliveries of a webhook with pagination
+func (db *MySQLDB) ListWebhookDeliveries(ctx context.Context, webhook *Webhook, request *helper.PageRequest) ([]*WebhookDelivery, *helper.Page, error) {
+	fLog := mysqlLog.WithField("func", "ListWebhookDeliveries").WithField("RequestID", ctx.Value(constants.RequestID))
+	query, err := newListQuery(request, webhookDeliveryListColumns, "", "CREATED_AT")
+	if err != nil {
+		return nil, nil, err
+	}
+	count := 0
+	q := "SELECT COUNT(*) AS CNT FROM HANSIP_WEBHOOK_DELIVERY WHERE WEBHOOK_REC_ID=?" + query.filter
+	if query.counted() {
+		row := db.conn(ctx).QueryRowContext(ctx, q, query.countArgs(webhook.RecID)...)
+		err = row.Scan(&count)
+		if err != nil {
+			fLog.Errorf("db.instance.QueryRowContext got  %s", err.Error())
+			return nil, nil, &ErrDBQueryError{
+				Wrapped: err,
+				Message: "Error ListWebhookDeliveries",
+				SQL:     q,
+			}
+		}
+	}
+	page := query.page(count)
+	q = fmt.Sprintf("SELECT REC_ID, WEBHOOK_REC_ID, EVENT_ID, EVENT_TYPE, PAYLOAD, STATUS, ATTEMPTS, NEXT_ATTEMPT_AT, RESPONSE_STATUS, LAST_ERROR, CREATED_AT, UPDATED_AT FROM HANSIP_WEBHOOK_DELIVERY WHERE WEBHOOK_REC_ID=?%s ORDER BY %s LIMIT %s", query.where(), query.orderBy(), query.limit(page))
+	rows, err := db.conn(ctx).QueryContext(ctx, q, query.args(webhook.RecID)...)
+	if err != nil {
+		fLog.Errorf("db.instance.QueryContext got  %s. SQL = %s", err.Error(), q)
+		return nil, nil, &ErrDBQueryError{
+			Wrapped: err,
+			Message: "Error ListWebhookDeliveries",
+			SQL:     q,
+		}
+	}
+	defer rows.Close()
+	ret := make([]*WebhookDelivery, 0)
+	for rows.Next() {
+		delivery, err := scanWebhookDelivery(rows)
+		if err != nil {
+			fLog.Warnf("rows.Scan got  %s", err.Error())
+			return nil, nil, &ErrDBScanError{
+				Wrapped: err,
+				Message: "Error ListWebhookDeliveries",
+				SQL:     q,
+			}
+		}
+		ret = append(ret, delivery)
+	}
+	return ret[:query.paginate(page, ret)], page, nil
+}
+
+// ListDueWebhookDeliveries list up to limit pending deliveries whose next attempt is due, the oldest first
+func (db *MySQLDB) ListDueWebhookDeliveries(ctx context.Context, due time.Time, limit int) ([]*WebhookDelivery, error) {
+	fLog := mysqlLog.WithField("func", "ListDueWebhookDeliveries").WithField("RequestID", ctx.Value(constants.RequestID))
+	q := "SELECT REC_ID, WEBHOOK_REC_ID, EVENT_ID, EVENT_TYPE, PAYLOAD, STATUS, ATTEMPTS, NEXT_ATTEMPT_AT, RESPONSE_STATUS, LAST_ERROR, CREATED_AT, UPDATED_AT FROM HANSIP_WEBHOOK_DELIVERY WHERE STATUS=? AND NEXT_ATTEMPT_AT <= ? ORDER BY NEXT_ATTEMPT_AT ASC LIMIT ?"
+	rows, err := db.conn(ctx).QueryContext(ctx, q, WebhookDeliveryPending, due.UTC(), limit)
+	if err != nil {
+		fLog.Errorf("db.instance.QueryContext got %s. SQL = %s", err.Error(), q)
+		return nil, &ErrDBQueryError{
+			Wrapped: err,
+			Message: "Error ListDueWebhookDeliveries",
+			SQL:     q,
+		}
+	}
+	defer rows.Close()
+	ret := make([]*WebhookDelivery, 0)
+	for rows.Next() {
+		delivery, err := scanWebhookDelivery(rows)
+		if err != nil {
+			fLog.Warnf("rows.Scan got %s", err.Error())
+			return nil, &ErrDBScanError{
+				Wrapped: err,
+				Message: "Error ListDueWebhookDeliveries",
+				SQL:     q,
+			}
+		}
+		ret = append(ret, delivery)
+	}
+	return ret, nil
+}
+
+// ClaimWebhookDelivery postpones the next attempt of a pending delivery to until, so no other dispatcher attempts it meanwhile.
+// It returns false if the delivery was claimed or changed by another dispatcher first.
+func (db *MySQLDB) ClaimWebhookDelivery(ctx context.Context, delivery *WebhookDelivery, until time.Time) (bool, error) {
+	fLog := mysqlLog.WithField("func", "ClaimWebhookDelivery").WithField("RequestID", ctx.Value(constants.RequestID))
+	until = until.UTC().Truncate(time.Second)
+	q := "UPDATE HANSIP_WEBHOOK_DELIVERY SET NEXT_ATTEMPT_AT=? WHERE REC_ID=? AND STATUS=? AND NEXT_ATTEMPT_AT=?"
+	res, err := db.conn(ctx).ExecContext(ctx, q, until, delivery.RecID, WebhookDeliveryPending, delivery.NextAttemptAt.UTC())
+	if err != nil {
+		fLog.Errorf("db.instance.ExecContext got %s. SQL = %s", err.Error(), q)
+		return false, &ErrDBExecuteError{
+			Wrapped: err,
+			Message: "Error ClaimWebhookDelivery",
+			SQL:     q,
+		}
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		fLog.Errorf("res.RowsAffected got %s", err.Error())
+		return false, err
+	}
+	if affected == 0 {
+		return false, nil
+	}
+	delivery.NextAttemptAt = until
+	return true, nil
+}
+
+// UpdateWebhookDelivery into webhook delivery table
+func (db *MySQLDB) UpdateWebhookDelivery(ctx context.Context, delivery *WebhookDelivery) error {
+	fLog := mysqlLog.WithField("func", "UpdateWebhookDelivery").WithField("RequestID", ctx.Value(constants.RequestID))
+	delivery.UpdatedAt = time.Now().UTC().Truncate(time.Second)
+	delivery.NextAttemptAt = delivery.NextAttemptAt.UTC().Truncate(time.Second)
+	q := "UPDATE HANSIP_WEBHOOK_DELIVERY SET STATUS=?, ATTEMPTS=?, NEXT_ATTEMPT_AT=?, RESPONSE_STATUS=?, LAST_ERROR=?, UPDATED_AT=? WHERE REC_ID=?"
+	_, err := db.conn(ctx).ExecContext(ctx, q, delivery.Status, delivery.Attempts, delivery.NextAttemptAt, delivery.ResponseStatus, delivery.LastError, delivery.UpdatedAt, delivery.RecID)
+	if err != nil {
+		fLog.Errorf("db.instance.ExecContext got %s. SQL = %s", err.Error(), q)
+		return &ErrDBExecuteError{
+			Wrapped: err,
+			Message: "Error UpdateWebhookDelivery",
+			SQL:     q,
+		}
+	}
+	return nil
+}
+
+// scanOutboxMessage scans a row of HANSIP_OUTBOX
+func scanOutboxMessage(row rowScanner) (*OutboxMessage, error) {
+	m := &OutboxMessage{}
+	err := row.Scan(&m.RecID, &m.Kind, &m.Payload, &m.Status, &m.Attempts, &m.NextAttemptAt, &m.LastError, &m.RequestID, &m.CreatedAt, &m.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// CreateOutboxMessage into outbox table, its RecID and CreatedAt are assigned
+func (db *MySQLDB) CreateOutboxMessage(ctx context.Context, message *OutboxMessage) error {
+	fLog := mysqlLog.WithField("func", "CreateOutboxMessage").WithField("RequestID", ctx.Value(constants.RequestID))
+	message.RecID = helper.MakeRandomString(10, true, true, true, false)
+	// DATETIME keeps whole seconds, the next attempt is compared with the stored value when claimed.
+	message.CreatedAt = time.Now().UTC().Truncate(time.Second)
+	message.UpdatedAt = message.CreatedAt
+	message.NextAttemptAt = message.NextAttemptAt.UTC().Truncate(time.Second)
+	q := "INSERT INTO HANSIP_OUTBOX(REC_ID, KIND, PAYLOAD, STATUS, ATTEMPTS, NEXT_ATTEMPT_AT, LAST_ERROR, REQUEST_ID, CREATED_AT, UPDATED_AT) VALUES (?,?,?,?,?,?,?,?,?,?)"
+	_, err := db.conn(ctx).ExecContext(ctx, q, message.RecID, message.Kind, message.Payload, message.Status, message.Attempts, message.NextAttemptAt, message.LastError, message.RequestID, message.CreatedAt, message.UpdatedAt)
+	if err != nil {
+		fLog.Errorf("db.instance.ExecContext got %s. SQL = %s", err.Error(), q)
+		return &ErrDBExecuteError{
+			Wrapped: err,
+			Message: "Error CreateOutboxMessage",
+			SQL:     q,
+		}
+	}
+	return nil
+}
+
+// GetOutboxMessageByRecID return an outbox message record
+func (db *MySQLDB) GetOutboxMessageByRecID(ctx context.Context, recID string) (*OutboxMessage, error) {
+	fLog := mysqlLog.WithField("func", "GetOutboxMessageByRecID").WithField("RequestID", ctx.Value(constants.RequestID))
+	q := "SELECT REC_ID, KIND, PAYLOAD, STATUS, ATTEMPTS, NEXT_ATTEMPT_AT, LAST_ERROR, REQUEST_ID, CREATED_AT, UPDATED_AT FROM HANSIP_OUTBOX WHERE REC_ID=?"
+	message, err := scanOutboxMessage(db.conn(ctx).QueryRowContext(ctx, q, recID))
+	if err != nil {
+		fLog.Errorf("row.Scan got %s", err.Error())
+		return nil, &ErrDBScanError{
+			Wrapped: err,
+			Message: "Error GetOutboxMessageByRecID",
+			SQL:     q,
+		}
+	}
+	return message, nil
+}
+
+// ListOutboxMessages list the outbox messages with pagination
+func (db *MySQLDB) ListOutboxMessages(ctx context.Context, request *helper.PageRequest) ([]*OutboxMessage, *helper.Page, error) {
+	fLog := mysqlLog.WithField("func", "ListOutboxMessages").WithField("RequestID", ctx.Value(constants.RequestID))
+	query, err := newListQuery(request, outboxListColumns, "", "CREATED_AT")
+	if err != nil {
+		return nil, nil, err
+	}
+	count := 0
+	q := "SELECT COUNT(*) AS CNT FROM HANSIP_OUTBOX WHERE 1=1" + query.filter
+	if query.counted() {
+		row := db.conn(ctx).QueryRowContext(ctx, q, query.countArgs()...)
+		err = row.Scan(&count)
+		if err != nil {
+			fLog.Errorf("db.instance.QueryRowContext got  %s", err.Error())
+			return nil, nil, &ErrDBQueryError{
+				Wrapped: err,
+				Message: "Error ListOutboxMessages",
+				SQL:     q,
+			}
+		}
+	}
+	page := query.page(count)
+	q = fmt.Sprintf("SELECT REC_ID, KIND, PAYLOAD, STATUS, ATTEMPTS, NEXT_ATTEMPT_AT, LAST_ERROR, REQUEST_ID, CREATED_AT, UPDATED_AT FROM HANSIP_OUTBOX WHERE 1=1%s ORDER BY %s LIMIT %s", query.where(), query.orderBy(), query.limit(page))
+	rows, err := db.conn(ctx).QueryContext(ctx, q, query.args()...)
+	if err != nil {
+		fLog.Errorf("db.instance.QueryContext got  %s. SQL = %s", err.Error(), q)
+		return nil, nil, &ErrDBQueryError{
+			Wrapped: err,
+			Message: "Error ListOutboxMessages",
+			SQL:     q,
+		}
+	}
+	defer rows.Close()
+	ret := make([]*OutboxMessage, 0)
+	for rows.Next() {
+		message, err := scanOutboxMessage(rows)
+		if err != nil {
+			fLog.Warnf("rows.Scan got  %s", err.Error())
+			return nil, nil, &ErrDBScanError{
+				Wrapped: err,
+				Message: "Error ListOutboxMessages",
+				SQL:     q,
+			}
+		}
+		ret = append(ret, message)
+	}
+	return ret[:query.paginate(page, ret)], page, nil
+}
+
+// ListDueOutboxMessages list up to limit pending messages whose next attempt is due, the oldest first
+func (db *MySQLDB) ListDueOutboxMessages(ctx context.Context, due time.Time, limit int) ([]*OutboxMessage, error) {
+	fLog := mysqlLog.WithField("func", "ListDueOutboxMessages").WithField("RequestID", ctx.Value(constants.RequestID))
+	q := "SELECT REC_ID, KIND, PAYLOAD, STATUS, ATTEMPTS, NEXT_ATTEMPT_AT, LAST_ERROR, REQUEST_ID, CREATED_AT, UPDATED_AT FROM HANSIP_OUTBOX WHERE STATUS=? AND NEXT_ATTEMPT_AT <= ? ORDER BY NEXT_ATTEMPT_AT ASC LIMIT ?"
+	rows, err := db.conn(ctx).QueryContext(ctx, q, OutboxPending, due.UTC(), limit)
+	if err != nil {
+		fLog.Errorf("db.instance.QueryContext got %s. SQL = %s", err.Error(), q)
+		return nil, &ErrDBQueryError{
+			Wrapped: err,
+			Message: "Error ListDueOutboxMessages",
+			SQL:     q,
+		}
+	}
+	defer rows.Close()
+	ret := make([]*OutboxMessage, 0)
+	for rows.Next() {
+		message, err := scanOutboxMessage(rows)
+		if err != nil {
+			fLog.Warnf("rows.Scan got %s", err.Error())
+			return nil, &ErrDBScanError{
+				Wrapped: err,
+				Message: "Error ListDueOutboxMessages",
+				SQL:     q,
+			}
+		}
+		ret = append(ret, message)
+	}
+	return ret, nil
+}
+
+// ClaimOutboxMessage postpones the next attempt of a pending message to until, so no other worker attempts it meanwhile.
+// It returns false if the message was claimed or changed by another worker first.
+func (db *MySQLDB) ClaimOutboxMessage(ctx context.Context, message *OutboxMessage, until time.Time) (bool, error) {
+	fLog := mysqlLog.WithField("func", "ClaimOutboxMessage").WithField("RequestID", ctx.Value(constants.RequestID))
+	until = until.UTC().Truncate(time.Second)
+	q := "UPDATE HANSIP_OUTBOX SET NEXT_ATTEMPT_AT=? WHERE REC_ID=? AND STATUS=? AND NEXT_ATTEMPT_AT=?"
+	res, err := db.conn(ctx).ExecContext(ctx, q, until, message.RecID, OutboxPending, message.NextAttemptAt.UTC())
+	if err != nil {
+		fLog.Errorf("db.instance.ExecContext got %s. SQL = %s", err.Error(), q)
+		return false, &ErrDBExecuteError{
+			Wrapped: err,
+			Message: "Error ClaimOutboxMessage",
+			SQL:     q,
+		}
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		fLog.Errorf("res.RowsAffected got %s", err.Error())
+		return false, err
+	}
+	if affected == 0 {
+		return false, nil
+	}
+	message.NextAttemptAt = until
+	return true, nil
+}
+
+// UpdateOutboxMessage into outbox table
+func (db *MySQLDB) UpdateOutboxMessage(ctx context.Context, message *OutboxMessage) error {
+	fLog := mysqlLog.WithField("func", "UpdateOutboxMessage").WithField("RequestID", ctx.Value(constants.RequestID))
+	message.UpdatedAt = time.Now().UTC().Truncate(time.Second)
+	message.NextAttemptAt = message.NextAttemptAt.UTC().Truncate(time.Second)
+	q := "UPDATE HANSIP_OUTBOX SET STATUS=?, ATTEMPTS=?, NEXT_ATTEMPT_AT=?, LAST_ERROR=?, UPDATED_AT=? WHERE REC_ID=?"
+	_, err := db.conn(ctx).ExecContext(ctx, q, message.Status, message.Attempts, message.NextAttemptAt, message.LastError, message.UpdatedAt, message.RecID)
+	if err != nil {
+		fLog.Errorf("db.instance.ExecContext got %s. SQL = %s", err.Error(), q)
+		return &ErrDBExecuteError{
+			Wrapped: err,
+			Message: "Error UpdateOutboxMessage",
+			SQL:     q,
+		}
+	}
+	return nil
+}
+
+// scanEmailTemplate scans a row of HANSIP_EMAIL_TEMPLATE
+func scanEmailTemplate(row rowScanner) (*EmailTemplate, error) {
+	t := &EmailTemplate{}
+	err := row.Scan(&t.RecID, &t.TenantRecID, &t.TemplateKey, &t.Version, &t.Subject, &t.Body, &t.TextBody, &t.CreatedBy, &t.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// CreateEmailTemplateVersion into email template table as the next version of its tenant and key,
+// its RecID, Version and CreatedAt are assigned
+func (db *MySQLDB) CreateEmailTemplateVersion(ctx context.Context, tmpl *EmailTemplate) error {
+	fLog := mysqlLog.WithField("func", "CreateEmailTemplateVersion").WithField("RequestID", ctx.Value(constants.RequestID))
+	// two versions saved at once can not get the same number, the second one fails the unique key.
+	q := "SELECT COALESCE(MAX(VERSION), 0) FROM HANSIP_EMAIL_TEMPLATE WHERE TENANT_REC_ID=? AND TEMPLATE_KEY=? FOR UPDATE"
+	latest := 0
+	err := db.conn(ctx).QueryRowContext(ctx, q, tmpl.TenantRecID, tmpl.TemplateKey).Scan(&latest)
+	if err != nil {
+		fLog.Errorf("db.instance.QueryRowContext got %s. SQL = %s", err.Error(), q)
+		return &ErrDBQueryError{
+			Wrapped: err,
+			Message: "Error CreateEmailTemplateVersion",
+			SQL:     q,
+		}
+	}
+	tmpl.RecID = helper.MakeRandomString(10, true, true, true, false)
+	tmpl.Version = latest + 1
+	tmpl.CreatedAt = time.Now().UTC().Truncate(time.Second)
+	q = "INSERT INTO HANSIP_EMAIL_TEMPLATE(REC_ID, TENANT_REC_ID, TEMPLATE_KEY, VERSION, SUBJECT, BODY, TEXT_BODY, CREATED_BY, CREATED_AT) VALUES (?,?,?,?,?,?,?,?,?)"
+	_, err = db.conn(ctx).ExecContext(ctx, q, tmpl.RecID, tmpl.TenantRecID, tmpl.TemplateKey, tmpl.Version, tmpl.Subject, tmpl.Body, tmpl.TextBody, tmpl.CreatedBy, tmpl.CreatedAt)
+	if err != nil {
+		fLog.Errorf("db.instance.ExecContext got %s. SQL = %s", err.Error(), q)
+		return &ErrDBExecuteError{
+			Wrapped: err,
+			Message: "Error CreateEmailTemplateVersion",
+			SQL:     q,
+		}
+	}
+	return nil
+}
+
+// getEmailTemplate return the email template of the query, ErrDBNoResult if there is none
+func (db *MySQLDB) getEmailTemplate(ctx context.Context, funcName, q string, args ...interface{}) (*EmailTemplate, error) {
+	fLog := mysqlLog.WithField("func", funcName).WithField("RequestID", ctx.Value(constants.RequestID))
+	tmpl, err := scanEmailTemplate(db.conn(ctx).QueryRowContext(ctx, q, args...))
+	if err == sql.ErrNoRows {
+		return nil, &ErrDBNoResult{
+			Message: fmt.Sprintf("Error %s, no template", funcName),
+			SQL:     q,
+		}
+	}
+	if err != nil {
+		fLog.Errorf("row.Scan got %s", err.Error())
+		return nil, &ErrDBScanError{
+			Wrapped: err,
+			Message: fmt.Sprintf("Error %s", funcName),
+			SQL:     q,
+		}
+	}
+	return tmpl, nil
+}
+
+// GetEmailTemplate return the latest version of the tenant template, ErrDBNoResult if the tenant has none
+func (db *MySQLDB) GetEmailTemplate(ctx context.Context, tenant *Tenant, key string) (*EmailTemplate, error) {
+	q := "SELECT REC_ID, TENANT_REC_ID, TEMPLATE_KEY, VERSION, SUBJECT, BODY, COALESCE(TEXT_BODY, ''), CREATED_BY, CREATED_AT FROM HANSIP_EMAIL_TEMPLATE WHERE TENANT_REC_ID=? AND TEMPLATE_KEY=? ORDER BY VERSION DESC LIMIT 1"
+	return db.getEmailTemplate(ctx, "GetEmailTemplate", q, tenant.RecID, key)
+}
+
+// GetEmailTemplateVersion return a version of the tenant template, ErrDBNoResult if there is no such version
+func (db *MySQLDB) GetEmailTemplateVersion(ctx context.Context, tenant *Tenant, key string, version int) (*EmailTemplate, error) {
+	q := "SELECT REC_ID, TENANT_REC_ID, TEMPLATE_KEY, VERSION, SUBJECT, BODY, COALESCE(TEXT_BODY, ''), CREATED_BY, CREATED_AT FROM HANSIP_EMAIL_TEMPLATE WHERE TENANT_REC_ID=? AND TEMPLATE_KEY=? AND VERSION=?"
+	return db.getEmailTemplate(ctx, "GetEmailTemplateVersion", q, tenant.RecID, key, version)
+}
+
+// listEmailTemplates list the email templates of the query
+func (db *MySQLDB) listEmailTemplates(ctx context.Context, funcName, q string, args ...interface{}) ([]*EmailTemplate, error) {
+	fLog := mysqlLog.WithField("func", funcName).WithField("RequestID", ctx.Value(constants.RequestID))
+	rows, err := db.conn(ctx).QueryContext(ctx, q, args...)
+	if err != nil {
+		fLog.Errorf("db.instance.QueryContext got %s. SQL = %s", err.Error(), q)
+		return nil, &ErrDBQueryError{
+			Wrapped: err,
+			Message: fmt.Sprintf("Error %s", funcName),
+			SQL:     q,
+		}
+	}
+	defer rows.Close()
+	ret := make([]*EmailTemplate, 0)
+	for rows.Next() {
+		tmpl, err := scanEmailTemplate(rows)
+		if err != nil {
+			fLog.Warnf("rows.Scan got %s", err.Error())
+			return nil, &ErrDBScanError{
+				Wrapped: err,
+				Message: fmt.Sprintf("Error %s", funcName),
+				SQL:     q,
+			}
+		}
+		ret = append(ret, tmpl)
+	}
+	return ret, nil
+}
+
+// ListEmailTemplates list the latest version of every template of a tenant ordered by key
+func (db *MySQLDB) ListEmailTemplates(ctx context.Context, tenant *Tenant) ([]*EmailTemplate, error) {
+	q := "SELECT T.REC_ID, T.TENANT_REC_ID, T.TEMPLATE_KEY, T.VERSION, T.SUBJECT, T.BODY, COALESCE(T.TEXT_BODY, ''), T.CREATED_BY, T.CREATED_AT FROM HANSIP_EMAIL_TEMPLATE T WHERE T.TENANT_REC_ID=? AND T.VERSION = (SELECT MAX(L.VERSION) FROM HANSIP_EMAIL_TEMPLATE L WHERE L.TENANT_REC_ID = T.TENANT_REC_ID AND L.TEMPLATE_KEY = T.TEMPLATE_KEY) ORDER BY T.TEMPLATE_KEY ASC"
+	return db.listEmailTemplates(ctx, "ListEmailTemplates", q, tenant.RecID)
+}
+
+// ListEmailTemplateVersions list every version of the tenant template, the latest first
+func (db *MySQLDB) ListEmailTemplateVersions(ctx context.Context, tenant *Tenant, key string) ([]*EmailTemplate, error) {
+	q := "SELECT REC_ID, TENANT_REC_ID, TEMPLATE_KEY, VERSION, SUBJECT, BODY, COALESCE(TEXT_BODY, ''), CREATED_BY, CREATED_AT FROM HANSIP_EMAIL_TEMPLATE WHERE TENANT_REC_ID=? AND TEMPLATE_KEY=? ORDER BY VERSION DESC"
+	return db.listEmailTemplates(ctx, "ListEmailTemplateVersions", q, tenant.RecID, key)
+}
+
+// DeleteEmailTemplate deletes every version of the tenant template
+func (db *MySQLDB) DeleteEmailTemplate(ctx context.Context, tenant *Tenant, key string) error {
+	fLog := mysqlLog.WithField("func", "DeleteEmailTemplate").WithField("RequestID", ctx.Value(constants.RequestID))
+	q := "DELETE FROM HANSIP_EMAIL_TEMPLATE WHERE TENANT_REC_ID=? AND TEMPLATE_KEY=?"
+	_, err := db.conn(ctx).ExecContext(ctx, q, tenant.RecID, key)
+	if err != nil {
+		fLog.Errorf("db.instance.ExecContext got %s. SQL = %s", err.Error(), q)
+		return &ErrDBExecuteError{
+			Wrapped: err,
+			Message: "Error DeleteEmailTemplate",
+			SQL:     q,
+		}
+	}
+	return nil
+}
+
+// SaveEmailOTP into email otp table, replacing the code of the user for the same purpose
+func (db *MySQLDB) SaveEmailOTP(ctx context.Context, otp *EmailOTP) error {
+	fLog := mysqlLog.WithField("func", "SaveEmailOTP").WithField("RequestID", ctx.Value(constants.RequestID))
+	// DATETIME keeps whole seconds
+	otp.ExpireAt = otp.ExpireAt.UTC().Truncate(time.Second)
+	otp.SentAt = otp.SentAt.UTC().Truncate(time.Second)
+	q := "INSERT INTO HANSIP_EMAIL_OTP(USER_REC_ID, PURPOSE, CODE_HASH, ATTEMPTS, EXPIRE_AT, SENT_AT) VALUES (?,?,?,?,?,?) " +
+		"ON DUPLICATE KEY UPDATE CODE_HASH=VALUES(CODE_HASH), ATTEMPTS=VALUES(ATTEMPTS), EXPIRE_AT=VALUES(EXPIRE_AT), SENT_AT=VALUES(SENT_AT)"
+	_, err := db.conn(ctx).ExecContext(ctx, q, otp.UserRecID, otp.Purpose, otp.CodeHash, otp.Attempts, otp.ExpireAt, otp.SentAt)
+	if err != nil {
+		fLog.Errorf("db.instance.ExecContext got %s. SQL = %s", err.Error(), q)
+		return &ErrDBExecuteError{
+			Wrapped: err,
+			Message: "Error SaveEmailOTP",
+			SQL:     q,
+		}
+	}
+	return nil
+}
+
+// GetEmailOTP return the code of the user for the purpose, ErrDBNoResult if there is none
+func (db *MySQLDB) GetEmailOTP(ctx context.Context, user *User, purpose string) (*EmailOTP, error) {
+	fLog := mysqlLog.WithField("func", "GetEmailOTP").WithField("RequestID", ctx.Value(constants.RequestID))
+	q := "SELECT USER_REC_ID, PURPOSE, CODE_HASH, ATTEMPTS, EXPIRE_AT, SENT_AT FROM HANSIP_EMAIL_OTP WHERE USER_REC_ID=? AND PURPOSE=?"
+	otp := &EmailOTP{}
+	err := db.conn(ctx).QueryRowContext(ctx, q, user.RecID, purpose).Scan(&otp.UserRecID, &otp.Purpose, &otp.CodeHash, &otp.Attempts, &otp.ExpireAt, &otp.SentAt)
+	if err == sql.ErrNoRows {
+		return nil, &ErrDBNoResult{
+			Message: "Error GetEmailOTP, no code",
+			SQL:     q,
+		}
+	}
+	if err != nil {
+		fLog.Errorf("row.Scan got %s", err.Error())
+		return nil, &ErrDBScanError{
+			Wrapped: err,
+			Message: "Error GetEmailOTP",
+			SQL:     q,
+		}
+	}
+	return otp, nil
+}
+
+// ConsumeEmailOTPAttempt counts an attempt to verify the code. It returns false, without counting,
+// if the code has no attempt left or was replaced or deleted meanwhile.
+func (db *MySQLDB) ConsumeEmailOTPAttempt(ctx context.Context, otp *EmailOTP, maxAttempts int) (bool, error) {
+	fLog := mysqlLog.WithField("func", "ConsumeEmailOTPAttempt").WithField("RequestID", ctx.Value(constants.RequestID))
+	q := "UPDATE HANSIP_EMAIL_OTP SET ATTEMPTS=ATTEMPTS+1 WHERE USER_REC_ID=? AND PURPOSE=? AND CODE_HASH=? AND ATTEMPTS<?"
+	res, err := db.conn(ctx).ExecContext(ctx, q, otp.UserRecID, otp.Purpose, otp.CodeHash, maxAttempts)
+	if err != nil {
+		fLog.Errorf("db.instance.ExecContext got %s. SQL = %s", err.Error(), q)
+		return false, &ErrDBExecuteError{
+			Wrapped: err,
+			Message: "Error ConsumeEmailOTPAttempt",
+			SQL:     q,
+		}
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		fLog.Errorf("res.RowsAffected got %s", err.Error())
+		return false, err
+	}
+	if affected == 0 {
+		return false, nil
+	}
+	otp.Attempts++
+	return true, nil
+}
+
+// DeleteEmailOTP deletes the code of the user for the purpose
+func (db *MySQLDB) DeleteEmailOTP(ctx context.Context, user *User, purpose string) error {
+	fLog := mysqlLog.WithField("func", "DeleteEmailOTP").WithField("RequestID", ctx.Value(constants.RequestID))
+	q := "DELETE FROM HANSIP_EMAIL_OTP WHERE USER_REC_ID=? AND PURPOSE=?"
+	_, err := db.conn(ctx).ExecContext(ctx, q, user.RecID, purpose)
+	if err != nil {
+		fLog.Errorf("db.instance.ExecContext got %s. SQL = %s", err.Error(), q)
+		return &ErrDBExecuteError{
+			Wrapped: err,
+			Message: "Error DeleteEmailOTP",
+			SQL:     q,
+		}
+	}
+	return nil
+}
+
+// SaveWebAuthnSession into webauthn session table, the expired sessions are deleted
+func (db *MySQLDB) SaveWebAuthnSession(ctx context.Context, session *WebAuthnSession) error {
+	fLog := mysqlLog.WithField("func", "SaveWebAuthnSession").WithField("RequestID", ctx.Value(constants.RequestID))
+	q := "DELETE FROM HANSIP_WEBAUTHN_SESSION WHERE EXPIRE_AT < ?"
+	_, err := db.conn(ctx).ExecContext(ctx, q, time.Now().UTC())
+	if err != nil {
+		fLog.Errorf("db.instance.ExecContext got %s. SQL = %s", err.Error(), q)
+		return &ErrDBExecuteError{
+			Wrapped: err,
+			Message: "Error SaveWebAuthnSession",
+			SQL:     q,
+		}
+	}
+	// DATETIME keeps whole seconds
+	session.ExpireAt = session.ExpireAt.UTC().Truncate(time.Second)
+	var userRecID interface{}
+	if len(session.UserRecID) > 0 {
+		userRecID = session.UserRecID
+	}
+	q = "INSERT INTO HANSIP_WEBAUTHN_SESSION(CHALLENGE, USER_REC_ID, CEREMONY, EXPIRE_AT) VALUES (?,?,?,?)"
+	_, err = db.conn(ctx).ExecContext(ctx, q, session.Challenge, userRecID, session.Ceremony, session.ExpireAt)
+	if err != nil {
+		fLog.Errorf("db.instance.ExecContext got %s. SQL = %s", err.Error(), q)
+		return &ErrDBExecuteError{
+			Wrapped: err,
+			Message: "Error SaveWebAuthnSession",
+			SQL:     q,
+		}
+	}
+	return nil
+}
+
+// ConsumeWebAuthnSession deletes and returns the session of the challenge, ErrDBNoResult if there is none
+// or another request consumed it first
+func (db *MySQLDB) ConsumeWebAuthnSession(ctx context.Context, challenge string) (*WebAuthnSession, error) {
+	fLog := mysqlLog.WithField("func", "ConsumeWebAuthnSession").WithField("RequestID", ctx.Value(constants.RequestID))
+	q := "SELECT CHALLENGE, USER_REC_ID, CEREMONY, EXPIRE_AT FROM HANSIP_WEBAUTHN_SESSION WHERE CHALLENGE=?"
+	session := &WebAuthnSession{}
+	var userRecID sql.NullString
+	err := db.conn(ctx).QueryRowContext(ctx, q, challenge).Scan(&session.Challenge, &userRecID, &session.Ceremony, &session.ExpireAt)
+	if err == sql.ErrNoRows {
+		return nil, &ErrDBNoResult{
+			Message: "Error ConsumeWebAuthnSession, no session",
+			SQL:     q,
+		}
+	}
+	if err != nil {
+		fLog.Errorf("row.Scan got %s", err.Error())
+		return nil, &ErrDBScanError{
+			Wrapped: err,
+			Message: "Error ConsumeWebAuthnSession",
+			SQL:     q,
+		}
+	}
+	session.UserRecID = userRecID.String
+	q = "DELETE FROM HANSIP_WEBAUTHN_SESSION WHERE CHALLENGE=?"
+	res, err := db.conn(ctx).ExecContext(ctx, q, challenge)
+	if err != nil {
+		fLog.Errorf("db.instance.ExecContext got %s. SQL = %s", err.Error(), q)
+		return nil, &ErrDBExecuteError{
+			Wrapped: err,
+			Message: "Error ConsumeWebAuthnSession",
+			SQL:     q,
+		}
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		fLog.Errorf("res.RowsAffected got %s", err.Error())
+		return nil, err
+	}
+	if affected == 0 {
+		return nil, &ErrDBNoResult{
+			Message: "Error ConsumeWebAuthnSession, session consumed",
+			SQL:     q,
+		}
+	}
+	return session, nil
+}
+
+// webAuthnCredentialHash returns the hex SHA-256 of the credential id, its unique index
+func webAuthnCredentialHash(credentialID string) string {
+	sum := sha256.Sum256([]byte(credentialID))
+	return hex.EncodeToString(sum[:])
+}
+
+// scanWebAuthnCredential scans a credential selected with its columns in table order
+func scanWebAuthnCredential(row rowScanner) (*WebAuthnCredential, error) {
+	cred := &WebAuthnCredential{}
+	var transports sql.NullString
+	var lastUsed sql.NullTime
+	err := row.Scan(&cred.RecID, &cred.UserRecID, &cred.Name, &cred.CredentialID, &cred.PublicKey, &cred.Algorithm, &cred.SignCount, &cred.AAGUID, &transports, &cred.BackupEligible, &cred.CreatedAt, &lastUsed)
+	if err != nil {
+		return nil, err
+	}
+	cred.Transports = splitRecIDs(transports.String)
+	if lastUsed.Valid {
+		cred.LastUsed = lastUsed.Time
+	}
+	return cred, nil
+}
+
+// CreateWebAuthnCredential into webauthn credential table, its RecID and CreatedAt are assigned
+func (db *MySQLDB) CreateWebAuthnCredential(ctx context.Context, credential *WebAuthnCredential) error {
+	fLog := mysqlLog.WithField("func", "CreateWebAuthnCredential").WithField("RequestID", ctx.Value(constants.RequestID))
+	credential.RecID = helper.MakeRandomString(10, true, true, true, false)
+	credential.CreatedAt = time.Now().UTC().Truncate(time.Second)
+	q := "INSERT INTO HANSIP_WEBAUTHN_CREDENTIAL(REC_ID, USER_REC_ID, NAME, CREDENTIAL_ID, CREDENTIAL_HASH, PUBLIC_KEY, ALGORITHM, SIGN_COUNT, AAGUID, TRANSPORTS, BACKUP_ELIGIBLE, CREATED_AT) VALUES (?,?,?,?,?,?,?,?,?,?,?,?)"
+	_, err := db.conn(ctx).ExecContext(ctx, q, credential.RecID, credential.UserRecID, credential.Name, credential.CredentialID, webAuthnCredentialHash(credential.CredentialID), credential.PublicKey,
+		credential.Algorithm, credential.SignCount, credential.AAGUID, strings.Join(credential.Transports, ","), credential.BackupEligible, credential.CreatedAt)
+	if err != nil {
+		fLog.Errorf("db.instance.ExecContext got %s. SQL = %s", err.Error(), q)
+		return &ErrDBExecuteError{
+			Wrapped: err,
+			Message: "Error CreateWebAuthnCredential",
+			SQL:     q,
+		}
+	}
+	return nil
+}
+
+// getWebAuthnCredential return the credential of the query, ErrDBNoResult if there is none
+func (db *MySQLDB) getWebAuthnCredential(ctx context.Context, funcName, q string, args ...interface{}) (*WebAuthnCredential, error) {
+	fLog := mysqlLog.WithField("func", funcName).WithField("RequestID", ctx.Value(constants.RequestID))
+	cred, err := scanWebAuthnCredential(db.conn(ctx).QueryRowContext(ctx, q, args...))
+	if err == sql.ErrNoRows {
+		return nil, &ErrDBNoResult{
+			Message: fmt.Sprintf("Error %s, no credential", funcName),
+			SQL:     q,
+		}
+	}
+	if err != nil {
+		fLog.Errorf("row.Scan got %s", err.Error())
+		return nil, &ErrDBScanError{
+			Wrapped: err,
+			Message: fmt.Sprintf("Error %s", funcName),
+			SQL:     q,
+		}
+	}
+	return cred, nil
+}
+
+// GetWebAuthnCredentialByRecID return a credential record, ErrDBNoResult if there is none
+func (db *MySQLDB) GetWebAuthnCredentialByRecID(ctx context.Context, recID string) (*WebAuthnCredential, error) {
+	q := "SELECT REC_ID, USER_REC_ID, NAME, CREDENTIAL_ID, PUBLIC_KEY, ALGORITHM, SIGN_COUNT, AAGUID, TRANSPORTS, BACKUP_ELIGIBLE, CREATED_AT, LAST_USED FROM HANSIP_WEBAUTHN_CREDENTIAL WHERE REC_ID=?"
+	return db.getWebAuthnCredential(ctx, "GetWebAuthnCredentialByRecID", q, recID)
+}
+
+// GetWebAuthnCredentialByCredentialID return the credential of the base64url credential id, ErrDBNoResult if there is none
+func (db *MySQLDB) GetWebAuthnCredentialByCredentialID(ctx context.Context, credentialID string) (*WebAuthnCredential, error) {
+	q := "SELECT REC_ID, USER_REC_ID, NAME, CREDENTIAL_ID, PUBLIC_KEY, ALGORITHM, SIGN_COUNT, AAGUID, TRANSPORTS, BACKUP_ELIGIBLE, CREATED_AT, LAST_USED FROM HANSIP_WEBAUTHN_CREDENTIAL WHERE CREDENTIAL_HASH=?"
+	return db.getWebAuthnCredential(ctx, "GetWebAuthnCredentialByCredentialID", q, webAuthnCredentialHash(credentialID))
+}
+
+// ListWebAuthnCredentials list all credentials of a user ordered by creation time
+func (db *MySQLDB) ListWebAuthnCredentials(ctx context.Context, user *User) ([]*WebAuthnCredential, error) {
+	fLog := mysqlLog.WithField("func", "ListWebAuthnCredentials").WithField("RequestID", ctx.Value(constants.RequestID))
+	q := "SELECT REC_ID, USER_REC_ID, NAME, CREDENTIAL_ID, PUBLIC_KEY, ALGORITHM, SIGN_COUNT, AAGUID, TRANSPORTS, BACKUP_ELIGIBLE, CREATED_AT, LAST_USED FROM HANSIP_WEBAUTHN_CREDENTIAL WHERE USER_REC_ID=? ORDER BY CREATED_AT ASC, REC_ID ASC"
+	rows, err := db.conn(ctx).QueryContext(ctx, q, user.RecID)
+	if err != nil {
+		fLog.Errorf("db.instance.QueryContext got %s. SQL = %s", err.Error(), q)
+		return nil, &ErrDBQueryError{
+			Wrapped: err,
+			Message: "Error ListWebAuthnCredentials",
+			SQL:     q,
+		}
+	}
+	defer rows.Close()
+	ret := make([]*WebAuthnCredential, 0)
+	for rows.Next() {
+		cred, err := scanWebAuthnCredential(rows)
+		if err != nil {
+			fLog.Warnf("rows.Scan got %s", err.Error())
+			return nil, &ErrDBScanError{
+				Wrapped: err,
+				Message: "Error ListWebAuthnCredentials",
+				SQL:     q,
+			}
+		}
+		ret = append(ret, cred)
+	}
+	return ret, nil
+}
+
+// UpdateWebAuthnCredential updates the name, sign count and last use of the credential
+func (db *MySQLDB) UpdateWebAuthnCredential(ctx context.Context, credential *WebAuthnCredential) error {
+	fLog := mysqlLog.WithField("func", "UpdateWebAuthnCredential").WithField("RequestID", ctx.Value(constants.RequestID))
+	var lastUsed interface{}
+	if !credential.LastUsed.IsZero() {
+		credential.LastUsed = credential.LastUsed.UTC().Truncate(time.Second)
+		lastUsed = credential.LastUsed
+	}
+	q := "UPDATE HANSIP_WEBAUTHN_CREDENTIAL SET NAME=?, SIGN_COUNT=?, LAST_USED=? WHERE REC_ID=?"
+	_, err := db.conn(ctx).ExecContext(ctx, q, credential.Name, credential.SignCount, lastUsed, credential.RecID)
+	if err != nil {
+		fLog.Errorf("db.instance.ExecContext got %s. SQL = %s", err.Error(), q)
+		return &ErrDBExecuteError{
+			Wrapped: err,
+			Message: "Error UpdateWebAuthnCredential",
+			SQL:     q,
+		}
+	}
+	return nil
+}
+
+// DeleteWebAuthnCredential deletes the credential, it can not authenticate anymore
+func (db *MySQLDB) DeleteWebAuthnCredential(ctx context.Context, credential *WebAuthnCredential) error {
+	fLog := mysqlLog.WithField("func", "DeleteWebAuthnCredential").WithField("RequestID", ctx.Value(constants.RequestID))
+	q := "DELETE FROM HANSIP_WEBAUTHN_CREDENTIAL WHERE REC_ID=?"
+	_, err := db.conn(ctx).ExecContext(ctx, q, credential.RecID)
+	if err != nil {
+		fLog.Errorf("db.instance.ExecContext got %s. SQL = %s", err.Error(), q)
+		return &ErrDBExecuteError{
+			Wrapped: err,
+			Message: "Error DeleteWebAuthnCredential",
+			SQL:     q,
+		}
+	}
+	return nil
+}
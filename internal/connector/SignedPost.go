@@ -0,0 +1,67 @@
+package connector
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	// DefaultPostTimeout limits a signed post made without a client
+	DefaultPostTimeout = 30 * time.Second
+)
+
+var (
+	defaultPostClient = &http.Client{Timeout: DefaultPostTimeout}
+)
+
+// PayloadSignature returns the hex HMAC-SHA256 of the timestamp and body joined by a dot, keyed by the secret
+func PayloadSignature(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// SignedPost posts the json body to a receiver, such as a tenant webhook or a message relay, along with the headers,
+// the X-Hansip-Timestamp header and, if there is a secret, the X-Hansip-Signature header of PayloadSignature.
+// The client is one with DefaultPostTimeout if nil. It returns the response status, 0 if there was no response,
+// and an error unless the receiver responded with 2xx.
+func SignedPost(ctx context.Context, client *http.Client, url, userAgent, secret string, headers map[string]string, body []byte) (int, error) {
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", userAgent)
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	req.Header.Set("X-Hansip-Timestamp", timestamp)
+	if len(secret) > 0 {
+		req.Header.Set("X-Hansip-Signature", "sha256="+PayloadSignature(secret, timestamp, body))
+	}
+	if client == nil {
+		client = defaultPostClient
+	}
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 64*1024))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("receiver responded with %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
@@ -0,0 +1,48 @@
+package connector
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestPayloadSignature(t *testing.T) {
+	body := []byte(`{"id":"abc","type":"user.created"}`)
+	signature := PayloadSignature("secret", "1600000000", body)
+	if len(signature) != 64 || signature != PayloadSignature("secret", "1600000000", body) {
+		t.Errorf("expect a stable 64 hex signature but %s", signature)
+	}
+	if PayloadSignature("other", "1600000000", body) == signature {
+		t.Errorf("expect the signature depending on the secret")
+	}
+	if PayloadSignature("secret", "1600000001", body) == signature {
+		t.Errorf("expect the signature depending on the timestamp")
+	}
+}
+
+func TestSignedPost(t *testing.T) {
+	var header http.Header
+	var body []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header
+		body, _ = ioutil.ReadAll(r.Body)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	if defaultPostClient.Timeout != DefaultPostTimeout {
+		t.Errorf("expect the default client limited to %s but %s", DefaultPostTimeout, defaultPostClient.Timeout)
+	}
+	status, err := SignedPost(context.Background(), nil, server.URL, "Hansip-Test", "secret", map[string]string{"X-Hansip-Event": "test"}, []byte(`{}`))
+	if err != nil || status != http.StatusNoContent {
+		t.Fatalf("expect posted but %d %v", status, err)
+	}
+	if string(body) != `{}` || header.Get("User-Agent") != "Hansip-Test" || header.Get("X-Hansip-Event") != "test" {
+		t.Errorf("expect body and headers posted but %s %v", body, header)
+	}
+	if header.Get("X-Hansip-Signature") != "sha256="+PayloadSignature("secret", header.Get("X-Hansip-Timestamp"), body) {
+		t.Errorf("unexpected signature %s", header.Get("X-Hansip-Signature"))
+	}
+}
@@ -0,0 +1,368 @@
+package connector
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"strings"
+	"time"
+)
+
+const (
+	// SMTPTLSNone never encrypts the connection to the mail server
+	SMTPTLSNone = "NONE"
+	// SMTPTLSOpportunistic upgrades the connection with STARTTLS when the mail server offers it
+	SMTPTLSOpportunistic = "OPPORTUNISTIC"
+	// SMTPTLSStartTLS requires the connection to be upgraded with STARTTLS
+	SMTPTLSStartTLS = "STARTTLS"
+	// SMTPTLSImplicit connects with TLS from the start, usually on port 465
+	SMTPTLSImplicit = "TLS"
+
+	// SMTPAuthNone sends emails without authenticating
+	SMTPAuthNone = "NONE"
+	// SMTPAuthPlain authenticates with the PLAIN mechanism
+	SMTPAuthPlain = "PLAIN"
+	// SMTPAuthLogin authenticates with the LOGIN mechanism
+	SMTPAuthLogin = "LOGIN"
+	// SMTPAuthCRAMMD5 authenticates with the CRAM-MD5 mechanism
+	SMTPAuthCRAMMD5 = "CRAM-MD5"
+)
+
+var (
+	// ErrSMTPStartTLSNotSupported the mail server does not offer STARTTLS while it is required
+	ErrSMTPStartTLSNotSupported = errors.New("mail server does not support STARTTLS")
+)
+
+// isLocalhost check if the mail server is this host, credentials may be sent to it unencrypted
+func isLocalhost(host string) bool {
+	return host == "localhost" || host == "127.0.0.1" || host == "::1"
+}
+
+// loginAuth implements the LOGIN authentication mechanism, not provided by net/smtp
+type loginAuth struct {
+	username, password, host string
+}
+
+// Start begins the LOGIN authentication, refusing to send the credentials unencrypted to another host like smtp.PlainAuth does
+func (a *loginAuth) Start(server *smtp.ServerInfo) (string, []byte, error) {
+	if !server.TLS && !isLocalhost(server.Name) {
+		return "", nil, errors.New("unencrypted connection")
+	}
+	if server.Name != a.host {
+		return "", nil, errors.New("wrong host name")
+	}
+	return "LOGIN", nil, nil
+}
+
+// Next answers the username and password prompts of the server
+func (a *loginAuth) Next(fromServer []byte, more bool) ([]byte, error) {
+	if !more {
+		return nil, nil
+	}
+	prompt := strings.ToLower(strings.TrimSpace(string(fromServer)))
+	switch {
+	case strings.HasPrefix(prompt, "username"):
+		return []byte(a.username), nil
+	case strings.HasPrefix(prompt, "password"):
+		return []byte(a.password), nil
+	}
+	return nil, fmt.Errorf("unexpected server challenge %s", fromServer)
+}
+
+// smtpConn a connection to the mail server, kept open between emails
+type smtpConn struct {
+	conn     net.Conn
+	client   *smtp.Client
+	lastUsed time.Time
+}
+
+// close says goodbye to the server, the connection is closed even if the server does not answer
+func (c *smtpConn) close() {
+	c.conn.SetDeadline(time.Now().Add(time.Second))
+	if err := c.client.Quit(); err != nil {
+		c.client.Close()
+	}
+}
+
+// watch interrupts the connection when the context is done, until the returned function is called
+func (c *smtpConn) watch(ctx context.Context) func() {
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			c.conn.SetDeadline(time.Unix(1, 0))
+		case <-done:
+		}
+	}()
+	return func() {
+		close(done)
+	}
+}
+
+// tlsConfig returns the TLS configuration to connect to the mail server with,
+// trusting the CA bundle of the sender on top of the system ones.
+func (sender *SendMailSender) tlsConfig() (*tls.Config, error) {
+	sender.tlsOnce.Do(func() {
+		cfg := &tls.Config{
+			ServerName:         sender.Host,
+			InsecureSkipVerify: sender.TLSSkipVerify,
+		}
+		if len(sender.CAFile) > 0 {
+			pem, err := ioutil.ReadFile(sender.CAFile)
+			if err != nil {
+				sender.tlsErr = fmt.Errorf("can not read CA bundle %s. got %s", sender.CAFile, err.Error())
+				return
+			}
+			pool, err := x509.SystemCertPool()
+			if err != nil || pool == nil {
+				pool = x509.NewCertPool()
+			}
+			if !pool.AppendCertsFromPEM(pem) {
+				sender.tlsErr = fmt.Errorf("no certificate found in CA bundle %s", sender.CAFile)
+				return
+			}
+			cfg.RootCAs = pool
+		}
+		sender.tls = cfg
+	})
+	return sender.tls, sender.tlsErr
+}
+
+// auth returns the authentication of the configured mechanism, nil if the sender does not authenticate
+func (sender *SendMailSender) auth() (smtp.Auth, error) {
+	if len(sender.User) == 0 {
+		return nil, nil
+	}
+	switch strings.ToUpper(sender.Auth) {
+	case "", SMTPAuthPlain:
+		return smtp.PlainAuth("", sender.User, sender.Password, sender.Host), nil
+	case SMTPAuthLogin:
+		return &loginAuth{username: sender.User, password: sender.Password, host: sender.Host}, nil
+	case SMTPAuthCRAMMD5:
+		return smtp.CRAMMD5Auth(sender.User, sender.Password), nil
+	case SMTPAuthNone:
+		return nil, nil
+	}
+	return nil, fmt.Errorf("unknown SMTP authentication %s. allowed values are PLAIN, LOGIN, CRAM-MD5 or NONE", sender.Auth)
+}
+
+// deadline returns when a send must be done by, the earliest of the sender timeout and the context deadline
+func (sender *SendMailSender) deadline(ctx context.Context) time.Time {
+	var deadline time.Time
+	if sender.Timeout > 0 {
+		deadline = time.Now().Add(sender.Timeout)
+	}
+	if d, ok := ctx.Deadline(); ok && (deadline.IsZero() || d.Before(deadline)) {
+		deadline = d
+	}
+	return deadline
+}
+
+// dial opens a new connection to the mail server, encrypted and authenticated as configured
+func (sender *SendMailSender) dial(ctx context.Context) (*smtpConn, error) {
+	mode := strings.ToUpper(sender.TLS)
+	if len(mode) == 0 {
+		mode = SMTPTLSOpportunistic
+	}
+	switch mode {
+	case SMTPTLSNone, SMTPTLSOpportunistic, SMTPTLSStartTLS, SMTPTLSImplicit:
+	default:
+		return nil, fmt.Errorf("unknown SMTP TLS mode %s. allowed values are NONE, OPPORTUNISTIC, STARTTLS or TLS", sender.TLS)
+	}
+	auth, err := sender.auth()
+	if err != nil {
+		return nil, err
+	}
+	var tlsConfig *tls.Config
+	if mode != SMTPTLSNone {
+		if tlsConfig, err = sender.tlsConfig(); err != nil {
+			return nil, err
+		}
+	}
+
+	dialer := &net.Dialer{Deadline: sender.deadline(ctx)}
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(sender.Host, fmt.Sprintf("%d", sender.Port)))
+	if err != nil {
+		return nil, err
+	}
+	conn.SetDeadline(sender.deadline(ctx))
+	if mode == SMTPTLSImplicit {
+		conn = tls.Client(conn, tlsConfig)
+	}
+	c := &smtpConn{conn: conn}
+	stop := c.watch(ctx)
+	defer stop()
+
+	c.client, err = smtp.NewClient(conn, sender.Host)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if err = c.client.Hello(sender.helo()); err != nil {
+		c.client.Close()
+		return nil, err
+	}
+	if mode == SMTPTLSOpportunistic || mode == SMTPTLSStartTLS {
+		if ok, _ := c.client.Extension("STARTTLS"); ok {
+			if err = c.client.StartTLS(tlsConfig); err != nil {
+				c.client.Close()
+				return nil, err
+			}
+		} else if mode == SMTPTLSStartTLS {
+			c.client.Close()
+			return nil, ErrSMTPStartTLSNotSupported
+		}
+	}
+	if auth != nil {
+		if ok, _ := c.client.Extension("AUTH"); ok {
+			if err = c.client.Auth(auth); err != nil {
+				c.client.Close()
+				return nil, err
+			}
+		}
+	}
+	return c, nil
+}
+
+// helo returns the host name hansip greets the mail server with
+func (sender *SendMailSender) helo() string {
+	if len(sender.HeloName) > 0 {
+		return sender.HeloName
+	}
+	return "localhost"
+}
+
+// acquire takes a connection slot and returns an idle connection still alive or a new one.
+// An idle connection is checked with RSET before it is used again.
+func (sender *SendMailSender) acquire(ctx context.Context) (*smtpConn, error) {
+	sender.mutex.Lock()
+	if sender.slots == nil {
+		size := sender.PoolSize
+		if size < 1 {
+			size = 1
+		}
+		sender.slots = make(chan struct{}, size)
+	}
+	slots := sender.slots
+	sender.mutex.Unlock()
+
+	select {
+	case slots <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	for {
+		c := sender.popIdle()
+		if c == nil {
+			break
+		}
+		if time.Since(c.lastUsed) > sender.IdleTimeout {
+			c.close()
+			continue
+		}
+		c.conn.SetDeadline(sender.deadline(ctx))
+		stop := c.watch(ctx)
+		err := c.client.Reset()
+		stop()
+		if err == nil {
+			return c, nil
+		}
+		c.client.Close()
+		if ctx.Err() != nil {
+			<-slots
+			return nil, ctx.Err()
+		}
+	}
+	c, err := sender.dial(ctx)
+	if err != nil {
+		<-slots
+		return nil, err
+	}
+	return c, nil
+}
+
+// popIdle returns the most recently used idle connection, nil if there is none
+func (sender *SendMailSender) popIdle() *smtpConn {
+	sender.mutex.Lock()
+	defer sender.mutex.Unlock()
+	if len(sender.idle) == 0 {
+		return nil
+	}
+	c := sender.idle[len(sender.idle)-1]
+	sender.idle = sender.idle[:len(sender.idle)-1]
+	return c
+}
+
+// release gives the slot back and keeps the connection for the next email if it is still usable
+func (sender *SendMailSender) release(c *smtpConn, reusable bool) {
+	defer func() {
+		<-sender.slots
+	}()
+	if !reusable {
+		// the server may not answer anymore, there is no point in saying goodbye
+		c.client.Close()
+		return
+	}
+	if sender.IdleTimeout <= 0 {
+		c.close()
+		return
+	}
+	c.conn.SetDeadline(time.Time{})
+	c.lastUsed = time.Now()
+	sender.mutex.Lock()
+	sender.idle = append(sender.idle, c)
+	sender.mutex.Unlock()
+}
+
+// send hands the message over to the mail server on a pooled connection. The send is abandoned when the context is done.
+func (sender *SendMailSender) send(ctx context.Context, from string, recipients []string, message []byte) error {
+	c, err := sender.acquire(ctx)
+	if err != nil {
+		return err
+	}
+	c.conn.SetDeadline(sender.deadline(ctx))
+	stop := c.watch(ctx)
+	err = func() error {
+		if err := c.client.Mail(from); err != nil {
+			return err
+		}
+		for _, recipient := range recipients {
+			if err := c.client.Rcpt(recipient); err != nil {
+				return err
+			}
+		}
+		w, err := c.client.Data()
+		if err != nil {
+			return err
+		}
+		if _, err := w.Write(message); err != nil {
+			return err
+		}
+		return w.Close()
+	}()
+	stop()
+	if err == nil && ctx.Err() != nil {
+		err = ctx.Err()
+	}
+	// a rejected recipient leaves the connection usable, a broken or interrupted one does not
+	_, rejected := err.(*textproto.Error)
+	sender.release(c, err == nil || (rejected && ctx.Err() == nil))
+	return err
+}
+
+// Close closes the idle connections to the mail server
+func (sender *SendMailSender) Close() {
+	sender.mutex.Lock()
+	idle := sender.idle
+	sender.idle = nil
+	sender.mutex.Unlock()
+	for _, c := range idle {
+		c.close()
+	}
+}
@@ -0,0 +1,452 @@
+package connector
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeSMTPMessage an email received by the fake SMTP server
+type fakeSMTPMessage struct {
+	from          string
+	to            []string
+	data          string
+	tls           bool
+	authenticated bool
+}
+
+// fakeSMTPServer a local SMTP server speaking just enough of the protocol to test the sender
+type fakeSMTPServer struct {
+	listener  net.Listener
+	tlsConfig *tls.Config
+	implicit  bool
+	startTLS  bool
+	auth      string
+	user      string
+	password  string
+	stall     bool
+
+	mutex       sync.Mutex
+	connections int
+	messages    []*fakeSMTPMessage
+}
+
+// newFakeSMTPServer starts a fake SMTP server with a self signed certificate, written in a CA bundle file for the sender
+func newFakeSMTPServer(t *testing.T, configure func(server *fakeSMTPServer)) (*fakeSMTPServer, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "fake smtp"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := ioutil.TempDir("", "smtp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		os.RemoveAll(dir)
+	})
+	caFile := filepath.Join(dir, "ca.pem")
+	if err := ioutil.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &fakeSMTPServer{
+		listener:  listener,
+		tlsConfig: &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}}},
+	}
+	configure(server)
+	t.Cleanup(func() {
+		listener.Close()
+	})
+	go server.serve()
+	return server, caFile
+}
+
+// sender returns a sender to the fake server
+func (s *fakeSMTPServer) sender(configure func(sender *SendMailSender)) *SendMailSender {
+	sender := &SendMailSender{
+		Host:        "127.0.0.1",
+		Port:        s.listener.Addr().(*net.TCPAddr).Port,
+		TLS:         SMTPTLSNone,
+		Timeout:     5 * time.Second,
+		PoolSize:    1,
+		IdleTimeout: time.Minute,
+	}
+	configure(sender)
+	return sender
+}
+
+func (s *fakeSMTPServer) received() (int, []*fakeSMTPMessage) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.connections, s.messages
+}
+
+func (s *fakeSMTPServer) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		s.mutex.Lock()
+		s.connections++
+		s.mutex.Unlock()
+		go s.handle(conn)
+	}
+}
+
+// handle speaks SMTP on a connection until the client quits
+func (s *fakeSMTPServer) handle(conn net.Conn) {
+	defer conn.Close()
+	secure := false
+	if s.implicit {
+		conn = tls.Server(conn, s.tlsConfig)
+		secure = true
+	}
+	tp := textproto.NewConn(conn)
+	authenticated := false
+	var message *fakeSMTPMessage
+	tp.PrintfLine("220 fake ESMTP")
+	for {
+		line, err := tp.ReadLine()
+		if err != nil {
+			return
+		}
+		verb := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+		arg := strings.TrimSpace(strings.TrimPrefix(line, strings.SplitN(line, " ", 2)[0]))
+		switch verb {
+		case "EHLO", "HELO":
+			lines := []string{"fake"}
+			if s.startTLS && !secure {
+				lines = append(lines, "STARTTLS")
+			}
+			if len(s.auth) > 0 {
+				lines = append(lines, "AUTH "+s.auth)
+			}
+			lines = append(lines, "8BITMIME")
+			for i, l := range lines {
+				if i < len(lines)-1 {
+					tp.PrintfLine("250-%s", l)
+				} else {
+					tp.PrintfLine("250 %s", l)
+				}
+			}
+		case "STARTTLS":
+			tp.PrintfLine("220 ready to start TLS")
+			tlsConn := tls.Server(conn, s.tlsConfig)
+			if err := tlsConn.Handshake(); err != nil {
+				return
+			}
+			conn = tlsConn
+			tp = textproto.NewConn(conn)
+			secure = true
+		case "AUTH":
+			authenticated = s.authenticate(tp, arg)
+			if authenticated {
+				tp.PrintfLine("235 authenticated")
+			} else {
+				tp.PrintfLine("535 authentication failed")
+			}
+		case "MAIL":
+			message = &fakeSMTPMessage{from: fakeSMTPAddress(strings.TrimPrefix(arg, "FROM:")), tls: secure, authenticated: authenticated}
+			tp.PrintfLine("250 ok")
+		case "RCPT":
+			to := fakeSMTPAddress(strings.TrimPrefix(arg, "TO:"))
+			if strings.HasPrefix(to, "reject") {
+				tp.PrintfLine("550 no such user")
+				continue
+			}
+			message.to = append(message.to, to)
+			tp.PrintfLine("250 ok")
+		case "DATA":
+			if s.stall {
+				// never answers, the client has to give up
+				ioutil.ReadAll(conn)
+				return
+			}
+			tp.PrintfLine("354 go ahead")
+			data, err := tp.ReadDotBytes()
+			if err != nil {
+				return
+			}
+			message.data = string(data)
+			s.mutex.Lock()
+			s.messages = append(s.messages, message)
+			s.mutex.Unlock()
+			tp.PrintfLine("250 queued")
+		case "RSET", "NOOP":
+			message = nil
+			tp.PrintfLine("250 ok")
+		case "QUIT":
+			tp.PrintfLine("221 bye")
+			return
+		default:
+			tp.PrintfLine("502 unknown command")
+		}
+	}
+}
+
+// fakeSMTPAddress returns the address of a MAIL or RCPT argument without its parameters, eg. <a@b.c> BODY=8BITMIME
+func fakeSMTPAddress(arg string) string {
+	if i := strings.Index(arg, ">"); i >= 0 {
+		arg = arg[:i]
+	}
+	return strings.TrimPrefix(strings.TrimSpace(arg), "<")
+}
+
+// authenticate runs the exchange of the authentication mechanism
+func (s *fakeSMTPServer) authenticate(tp *textproto.Conn, arg string) bool {
+	fields := strings.Fields(arg)
+	if len(fields) == 0 || strings.ToUpper(fields[0]) != s.auth {
+		return false
+	}
+	readAnswer := func(challenge string) string {
+		tp.PrintfLine("334 %s", base64.StdEncoding.EncodeToString([]byte(challenge)))
+		line, _ := tp.ReadLine()
+		answer, _ := base64.StdEncoding.DecodeString(line)
+		return string(answer)
+	}
+	switch s.auth {
+	case SMTPAuthPlain:
+		if len(fields) < 2 {
+			return false
+		}
+		response, _ := base64.StdEncoding.DecodeString(fields[1])
+		return string(response) == "\x00"+s.user+"\x00"+s.password
+	case SMTPAuthLogin:
+		return readAnswer("Username:") == s.user && readAnswer("Password:") == s.password
+	case SMTPAuthCRAMMD5:
+		challenge := "<1234.5678@fake>"
+		mac := hmac.New(md5.New, []byte(s.password))
+		mac.Write([]byte(challenge))
+		return readAnswer(challenge) == s.user+" "+hex.EncodeToString(mac.Sum(nil))
+	}
+	return false
+}
+
+func TestSendMailSenderReusesConnection(t *testing.T) {
+	server, _ := newFakeSMTPServer(t, func(server *fakeSMTPServer) {})
+	sender := server.sender(func(sender *SendMailSender) {})
+	defer sender.Close()
+
+	for i := 0; i < 2; i++ {
+		err := sender.SendEmail(context.Background(), []string{"a@example.com"}, nil, []string{"hidden@example.com"}, "hansip@example.com", "Hansip", "Hello", "<b>Hello</b>", "Hello")
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	connections, messages := server.received()
+	if connections != 1 {
+		t.Errorf("expected the connection to be reused but %d connections", connections)
+	}
+	if len(messages) != 2 {
+		t.Fatalf("expected 2 messages but %d", len(messages))
+	}
+	if messages[0].from != "hansip@example.com" || len(messages[0].to) != 2 {
+		t.Errorf("unexpected envelope %s %v", messages[0].from, messages[0].to)
+	}
+	if strings.Contains(messages[0].data, "hidden@example.com") {
+		t.Error("blind carbon copy recipient must not be in the message")
+	}
+	if messages[0].tls || messages[0].authenticated {
+		t.Error("expected an unencrypted and unauthenticated connection")
+	}
+}
+
+func TestSendMailSenderRejectedRecipient(t *testing.T) {
+	server, _ := newFakeSMTPServer(t, func(server *fakeSMTPServer) {})
+	sender := server.sender(func(sender *SendMailSender) {})
+	defer sender.Close()
+
+	err := sender.SendEmail(context.Background(), []string{"reject@example.com"}, nil, nil, "hansip@example.com", "", "Hello", "Hello", "")
+	if err == nil {
+		t.Fatal("expected the rejected recipient to fail the email")
+	}
+	err = sender.SendEmail(context.Background(), []string{"a@example.com"}, nil, nil, "hansip@example.com", "", "Hello", "Hello", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	connections, messages := server.received()
+	if connections != 1 || len(messages) != 1 {
+		t.Errorf("expected the connection to be reset and reused, got %d connections and %d messages", connections, len(messages))
+	}
+}
+
+func TestSendMailSenderNoIdleConnection(t *testing.T) {
+	server, _ := newFakeSMTPServer(t, func(server *fakeSMTPServer) {})
+	sender := server.sender(func(sender *SendMailSender) {
+		sender.IdleTimeout = 0
+	})
+	for i := 0; i < 2; i++ {
+		if err := sender.SendEmail(context.Background(), []string{"a@example.com"}, nil, nil, "hansip@example.com", "", "Hello", "Hello", ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if connections, _ := server.received(); connections != 2 {
+		t.Errorf("expected a connection per email but %d connections", connections)
+	}
+}
+
+func TestSendMailSenderStartTLS(t *testing.T) {
+	server, caFile := newFakeSMTPServer(t, func(server *fakeSMTPServer) {
+		server.startTLS = true
+		server.auth = SMTPAuthLogin
+		server.user = "hansip"
+		server.password = "secret"
+	})
+	sender := server.sender(func(sender *SendMailSender) {
+		sender.TLS = SMTPTLSStartTLS
+		sender.CAFile = caFile
+		sender.Auth = SMTPAuthLogin
+		sender.User = "hansip"
+		sender.Password = "secret"
+	})
+	defer sender.Close()
+
+	if err := sender.SendEmail(context.Background(), []string{"a@example.com"}, nil, nil, "hansip@example.com", "", "Hello", "Hello", ""); err != nil {
+		t.Fatal(err)
+	}
+	_, messages := server.received()
+	if len(messages) != 1 || !messages[0].tls || !messages[0].authenticated {
+		t.Errorf("expected an encrypted and authenticated email, got %v", messages)
+	}
+}
+
+func TestSendMailSenderStartTLSUntrusted(t *testing.T) {
+	server, _ := newFakeSMTPServer(t, func(server *fakeSMTPServer) {
+		server.startTLS = true
+	})
+	sender := server.sender(func(sender *SendMailSender) {
+		sender.TLS = SMTPTLSStartTLS
+	})
+	if err := sender.SendEmail(context.Background(), []string{"a@example.com"}, nil, nil, "hansip@example.com", "", "Hello", "Hello", ""); err == nil {
+		t.Error("expected the self signed certificate not to be trusted without the CA bundle")
+	}
+}
+
+func TestSendMailSenderStartTLSRequired(t *testing.T) {
+	server, caFile := newFakeSMTPServer(t, func(server *fakeSMTPServer) {})
+	sender := server.sender(func(sender *SendMailSender) {
+		sender.TLS = SMTPTLSStartTLS
+		sender.CAFile = caFile
+	})
+	err := sender.SendEmail(context.Background(), []string{"a@example.com"}, nil, nil, "hansip@example.com", "", "Hello", "Hello", "")
+	if err != ErrSMTPStartTLSNotSupported {
+		t.Errorf("expected %v but %v", ErrSMTPStartTLSNotSupported, err)
+	}
+
+	sender = server.sender(func(sender *SendMailSender) {
+		sender.TLS = SMTPTLSOpportunistic
+		sender.CAFile = caFile
+	})
+	defer sender.Close()
+	if err := sender.SendEmail(context.Background(), []string{"a@example.com"}, nil, nil, "hansip@example.com", "", "Hello", "Hello", ""); err != nil {
+		t.Errorf("expected opportunistic TLS to send unencrypted, got %v", err)
+	}
+}
+
+func TestSendMailSenderImplicitTLS(t *testing.T) {
+	for _, auth := range []string{SMTPAuthPlain, SMTPAuthCRAMMD5} {
+		server, caFile := newFakeSMTPServer(t, func(server *fakeSMTPServer) {
+			server.implicit = true
+			server.auth = auth
+			server.user = "hansip"
+			server.password = "secret"
+		})
+		sender := server.sender(func(sender *SendMailSender) {
+			sender.TLS = SMTPTLSImplicit
+			sender.CAFile = caFile
+			sender.Auth = auth
+			sender.User = "hansip"
+			sender.Password = "secret"
+		})
+		if err := sender.SendEmail(context.Background(), []string{"a@example.com"}, nil, nil, "hansip@example.com", "", "Hello", "Hello", ""); err != nil {
+			t.Fatalf("%s got %v", auth, err)
+		}
+		sender.Close()
+		_, messages := server.received()
+		if len(messages) != 1 || !messages[0].tls || !messages[0].authenticated {
+			t.Errorf("%s expected an encrypted and authenticated email, got %v", auth, messages)
+		}
+
+		sender = server.sender(func(sender *SendMailSender) {
+			sender.TLS = SMTPTLSImplicit
+			sender.CAFile = caFile
+			sender.Auth = auth
+			sender.User = "hansip"
+			sender.Password = "wrong"
+		})
+		if err := sender.SendEmail(context.Background(), []string{"a@example.com"}, nil, nil, "hansip@example.com", "", "Hello", "Hello", ""); err == nil {
+			t.Errorf("%s expected a wrong password to fail", auth)
+		}
+	}
+}
+
+func TestSendMailSenderContextDeadline(t *testing.T) {
+	server, _ := newFakeSMTPServer(t, func(server *fakeSMTPServer) {
+		server.stall = true
+	})
+	sender := server.sender(func(sender *SendMailSender) {})
+	defer sender.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err := sender.SendEmail(ctx, []string{"a@example.com"}, nil, nil, "hansip@example.com", "", "Hello", "Hello", "")
+	if err == nil {
+		t.Fatal("expected the stalled send to fail")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("expected the send to give up at the context deadline but took %s", elapsed)
+	}
+	if len(sender.idle) != 0 {
+		t.Error("expected the interrupted connection not to be kept")
+	}
+
+	// the slot of the interrupted connection is given back
+	ctx, cancel = context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	if err := sender.SendEmail(ctx, []string{"a@example.com"}, nil, nil, "hansip@example.com", "", "Hello", "Hello", ""); err == context.Canceled {
+		t.Error("expected a new connection to be tried")
+	}
+	if connections, _ := server.received(); connections != 2 {
+		t.Errorf("expected 2 connections but %d", connections)
+	}
+}
@@ -10,6 +10,15 @@ const (
 	// HansipAuthentication is context key for hansip authentication information
 	HansipAuthentication ContextKey = 2
 
+	// ClientIP is context key for the IP address of the caller
+	ClientIP ContextKey = 3
+
+	// Transaction is context key for the database transaction the repository calls run in
+	Transaction ContextKey = 4
+
+	// AcceptLanguage is context key for the Accept-Language header of the request, the languages the caller reads
+	AcceptLanguage ContextKey = 5
+
 	// RequestIDHeader is context key for tracking request
 	RequestIDHeader = "X-Request-ID"
 )
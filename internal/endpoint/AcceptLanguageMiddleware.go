@@ -0,0 +1,21 @@
+package endpoint
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/hyperjumptech/hansip/internal/constants"
+)
+
+// AcceptLanguageMiddleware keeps the Accept-Language header of the request in its context,
+// so the emails it causes are in the language of the caller when the recipient has no locale
+func AcceptLanguageMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		acceptLanguage := r.Header.Get("Accept-Language")
+		if len(acceptLanguage) == 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), constants.AcceptLanguage, acceptLanguage)))
+	})
+}
@@ -0,0 +1,517 @@
+package endpoint
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/hyperjumptech/hansip/internal/connector"
+	"github.com/hyperjumptech/hansip/internal/constants"
+	"github.com/hyperjumptech/hansip/internal/hansipcontext"
+	"github.com/hyperjumptech/hansip/pkg/helper"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// AttributeTypeString attribute holding a text
+	AttributeTypeString = "string"
+	// AttributeTypeNumber attribute holding a number
+	AttributeTypeNumber = "number"
+	// AttributeTypeBoolean attribute holding true or false
+	AttributeTypeBoolean = "boolean"
+	// AttributeTypeDate attribute holding a date in form of 2006-01-02
+	AttributeTypeDate = "date"
+)
+
+var (
+	attributeMgmtLog = log.WithField("go", "AttributeManagement")
+
+	attributeTypes       = []string{AttributeTypeString, AttributeTypeNumber, AttributeTypeBoolean, AttributeTypeDate}
+	attributeNamePattern = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_]{0,127}$`)
+	claimNamePattern     = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.:\-]{0,127}$`)
+
+	// reservedClaims are set by the token factory and can not be mapped from attributes
+	reservedClaims = []string{"iss", "sub", "aud", "exp", "nbf", "iat", "jti", "type", "access_age"}
+)
+
+// AttributeSchemaRequest hold model for creating or updating an attribute schema
+type AttributeSchemaRequest struct {
+	Name        string `json:"name"`
+	Type        string `json:"type"`
+	Required    bool   `json:"required"`
+	Unique      bool   `json:"unique"`
+	PII         bool   `json:"pii"`
+	Claim       string `json:"claim"`
+	Description string `json:"description"`
+}
+
+// validateAttributeSchemaRequest validates the attribute schema definition
+func validateAttributeSchemaRequest(req *AttributeSchemaRequest) error {
+	if !attributeNamePattern.MatchString(req.Name) {
+		return fmt.Errorf("invalid attribute name %s, it must start with a letter followed by letters, digits or underscores", req.Name)
+	}
+	if !helper.StringArrayContainString(attributeTypes, req.Type) {
+		return fmt.Errorf("invalid attribute type %s, expecting one of %v", req.Type, attributeTypes)
+	}
+	if len(req.Claim) > 0 {
+		if !claimNamePattern.MatchString(req.Claim) {
+			return fmt.Errorf("invalid claim name %s", req.Claim)
+		}
+		if helper.StringArrayContainString(reservedClaims, req.Claim) {
+			return fmt.Errorf("claim %s is reserved", req.Claim)
+		}
+		// tokens can be read by anyone holding them
+		if req.PII {
+			return fmt.Errorf("PII attribute %s can not be mapped into token claim", req.Name)
+		}
+	}
+	return nil
+}
+
+// encodeAttributeValue validates the json value against the attribute type and returns its text form for storing
+func encodeAttributeValue(schema *connector.AttributeSchema, value interface{}) (string, error) {
+	switch schema.Type {
+	case AttributeTypeNumber:
+		if n, ok := value.(float64); ok {
+			return strconv.FormatFloat(n, 'f', -1, 64), nil
+		}
+	case AttributeTypeBoolean:
+		if b, ok := value.(bool); ok {
+			return strconv.FormatBool(b), nil
+		}
+	case AttributeTypeDate:
+		if s, ok := value.(string); ok {
+			if _, err := time.Parse("2006-01-02", s); err == nil {
+				return s, nil
+			}
+		}
+	default:
+		if s, ok := value.(string); ok {
+			return s, nil
+		}
+	}
+	return "", fmt.Errorf("invalid value for attribute %s, expecting %s", schema.Name, schema.Type)
+}
+
+// decodeAttributeValue returns the json value of a stored attribute
+func decodeAttributeValue(schema *connector.AttributeSchema, value string) interface{} {
+	switch schema.Type {
+	case AttributeTypeNumber:
+		if n, err := strconv.ParseFloat(value, 64); err == nil {
+			return n
+		}
+	case AttributeTypeBoolean:
+		if b, err := strconv.ParseBool(value); err == nil {
+			return b
+		}
+	}
+	return value
+}
+
+// userAttributeValues returns the attribute values of a user defined by the tenant, keyed by attribute name
+func userAttributeValues(ctx context.Context, user *connector.User, tenant *connector.Tenant) (map[string]interface{}, []*connector.AttributeSchema, error) {
+	schemas, err := AttributeRepo.ListAttributeSchemas(ctx, tenant)
+	if err != nil {
+		return nil, nil, err
+	}
+	values, err := AttributeRepo.ListUserAttributes(ctx, user, tenant)
+	if err != nil {
+		return nil, nil, err
+	}
+	byRecID := make(map[string]string, len(values))
+	for _, v := range values {
+		byRecID[v.AttributeRecID] = v.Value
+	}
+	ret := make(map[string]interface{})
+	for _, schema := range schemas {
+		if value, ok := byRecID[schema.RecID]; ok {
+			ret[schema.Name] = decodeAttributeValue(schema, value)
+		}
+	}
+	return ret, schemas, nil
+}
+
+// userAttributeClaims returns the additional token claims mapped from the attributes of a user in all of the user's tenants.
+// Each claim is namespaced by the tenant domain, eg. "acme.com:employee_id", so a tenant can not shadow or forge
+// the claims of another tenant the user is member of.
+func userAttributeClaims(ctx context.Context, user *connector.User) map[string]interface{} {
+	if user == nil || AttributeRepo == nil || UserTenantRepo == nil {
+		return nil
+	}
+	fLog := attributeMgmtLog.WithField("func", "userAttributeClaims").WithField("RequestID", ctx.Value(constants.RequestID))
+	tenants, err := listUserTenants(ctx, user)
+	if err != nil {
+		fLog.Errorf("UserTenantRepo.ListUserTenantByUser got %s", err.Error())
+		return nil
+	}
+	claims := make(map[string]interface{})
+	for _, tenant := range tenants {
+		values, schemas, err := userAttributeValues(ctx, user, tenant)
+		if err != nil {
+			fLog.Errorf("userAttributeValues got %s", err.Error())
+			continue
+		}
+		for _, schema := range schemas {
+			value, ok := values[schema.Name]
+			if !ok || len(schema.Claim) == 0 || schema.PII {
+				continue
+			}
+			claims[attributeClaimName(tenant, schema)] = value
+		}
+	}
+	return claims
+}
+
+// attributeClaimName returns the token claim an attribute of the tenant is copied into
+func attributeClaimName(tenant *connector.Tenant, schema *connector.AttributeSchema) string {
+	return fmt.Sprintf("%s:%s", tenant.Domain, schema.Claim)
+}
+
+// tenantAttributeSchema loads the attribute schema of the request path which must belong to the tenant.
+// If it fails, it writes the error response and returns nil.
+func tenantAttributeSchema(w http.ResponseWriter, r *http.Request, tenant *connector.Tenant, recID string) *connector.AttributeSchema {
+	schema, err := AttributeRepo.GetAttributeSchemaByRecID(r.Context(), recID)
+	if err != nil || schema.TenantRecID != tenant.RecID {
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusNotFound, fmt.Sprintf("attribute %s not found in tenant %s", recID, tenant.Domain), nil, nil)
+		return nil
+	}
+	return schema
+}
+
+// readAttributeSchemaRequest reads and validates the attribute schema definition in the request body,
+// making sure its name and claim are not used by other attribute of the tenant.
+// If it fails, it writes the error response and returns nil.
+func readAttributeSchemaRequest(w http.ResponseWriter, r *http.Request, tenant *connector.Tenant, recID string) *AttributeSchemaRequest {
+	fLog := attributeMgmtLog.WithField("func", "readAttributeSchemaRequest").WithField("RequestID", r.Context().Value(constants.RequestID)).WithField("path", r.URL.Path).WithField("method", r.Method)
+	req := &AttributeSchemaRequest{}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		fLog.Errorf("ioutil.ReadAll got %s", err.Error())
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusInternalServerError, err.Error(), nil, nil)
+		return nil
+	}
+	err = json.Unmarshal(body, req)
+	if err != nil {
+		fLog.Errorf("json.Unmarshal got %s", err.Error())
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusBadRequest, err.Error(), nil, nil)
+		return nil
+	}
+	if err := validateAttributeSchemaRequest(req); err != nil {
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusBadRequest, err.Error(), nil, nil)
+		return nil
+	}
+	schemas, err := AttributeRepo.ListAttributeSchemas(r.Context(), tenant)
+	if err != nil {
+		fLog.Errorf("AttributeRepo.ListAttributeSchemas got %s", err.Error())
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusInternalServerError, err.Error(), nil, nil)
+		return nil
+	}
+	for _, schema := range schemas {
+		if schema.RecID == recID {
+			continue
+		}
+		if schema.Name == req.Name {
+			helper.WriteHTTPResponse(r.Context(), w, http.StatusBadRequest, fmt.Sprintf("attribute %s already exist", req.Name), nil, nil)
+			return nil
+		}
+		if len(req.Claim) > 0 && schema.Claim == req.Claim {
+			helper.WriteHTTPResponse(r.Context(), w, http.StatusBadRequest, fmt.Sprintf("claim %s is already mapped from attribute %s", req.Claim, schema.Name), nil, nil)
+			return nil
+		}
+	}
+	return req
+}
+
+// ListAttributeSchemas serving request to list attribute schemas of a tenant
+func ListAttributeSchemas(w http.ResponseWriter, r *http.Request) {
+	fLog := attributeMgmtLog.WithField("func", "ListAttributeSchemas").WithField("RequestID", r.Context().Value(constants.RequestID)).WithField("path", r.URL.Path).WithField("method", r.Method)
+	tenant, _ := scopedTenant(w, r, "/management/tenant/{tenantRecId}/attributes", readScopes...)
+	if tenant == nil {
+		return
+	}
+	schemas, err := AttributeRepo.ListAttributeSchemas(r.Context(), tenant)
+	if err != nil {
+		fLog.Errorf("AttributeRepo.ListAttributeSchemas got %s", err.Error())
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusInternalServerError, err.Error(), nil, nil)
+		return
+	}
+	helper.WriteHTTPResponse(r.Context(), w, http.StatusOK, "List of tenant attributes", nil, schemas)
+}
+
+// CreateAttributeSchema serving request to define new attribute of a tenant
+func CreateAttributeSchema(w http.ResponseWriter, r *http.Request) {
+	fLog := attributeMgmtLog.WithField("func", "CreateAttributeSchema").WithField("RequestID", r.Context().Value(constants.RequestID)).WithField("path", r.URL.Path).WithField("method", r.Method)
+	tenant, _ := adminTenant(w, r, "/management/tenant/{tenantRecId}/attribute")
+	if tenant == nil {
+		return
+	}
+	req := readAttributeSchemaRequest(w, r, tenant, "")
+	if req == nil {
+		return
+	}
+	schema, err := AttributeRepo.CreateAttributeSchema(r.Context(), tenant, &connector.AttributeSchema{
+		Name:        req.Name,
+		Type:        req.Type,
+		Required:    req.Required,
+		Unique:      req.Unique,
+		PII:         req.PII,
+		Claim:       req.Claim,
+		Description: req.Description,
+	})
+	if err != nil {
+		fLog.Errorf("AttributeRepo.CreateAttributeSchema got %s", err.Error())
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusInternalServerError, err.Error(), nil, nil)
+		return
+	}
+	audit(r, &connector.AuditEvent{
+		Event:        "attribute.create",
+		TargetType:   AuditTargetAttribute,
+		Target:       schema.RecID,
+		TenantDomain: tenant.Domain,
+	}, nil, schema)
+	helper.WriteHTTPResponse(r.Context(), w, http.StatusOK, "Success creating attribute", nil, schema)
+}
+
+// GetAttributeSchema serving request to fetch an attribute schema of a tenant
+func GetAttributeSchema(w http.ResponseWriter, r *http.Request) {
+	tenant, params := scopedTenant(w, r, "/management/tenant/{tenantRecId}/attribute/{attributeRecId}", readScopes...)
+	if tenant == nil {
+		return
+	}
+	schema := tenantAttributeSchema(w, r, tenant, params["attributeRecId"])
+	if schema == nil {
+		return
+	}
+	helper.WriteHTTPResponse(r.Context(), w, http.StatusOK, "Attribute retrieved", nil, schema)
+}
+
+// UpdateAttributeSchema serving request to update an attribute schema of a tenant. The attribute type can not be changed.
+func UpdateAttributeSchema(w http.ResponseWriter, r *http.Request) {
+	fLog := attributeMgmtLog.WithField("func", "UpdateAttributeSchema").WithField("RequestID", r.Context().Value(constants.RequestID)).WithField("path", r.URL.Path).WithField("method", r.Method)
+	tenant, params := adminTenant(w, r, "/management/tenant/{tenantRecId}/attribute/{attributeRecId}")
+	if tenant == nil {
+		return
+	}
+	schema := tenantAttributeSchema(w, r, tenant, params["attributeRecId"])
+	if schema == nil {
+		return
+	}
+	req := readAttributeSchemaRequest(w, r, tenant, schema.RecID)
+	if req == nil {
+		return
+	}
+	if req.Type != schema.Type {
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusBadRequest, fmt.Sprintf("type of attribute %s can not be changed from %s", schema.Name, schema.Type), nil, nil)
+		return
+	}
+	before := *schema
+	schema.Name = req.Name
+	schema.Required = req.Required
+	schema.Unique = req.Unique
+	schema.PII = req.PII
+	schema.Claim = req.Claim
+	schema.Description = req.Description
+	err := AttributeRepo.UpdateAttributeSchema(r.Context(), schema)
+	if err != nil {
+		fLog.Errorf("AttributeRepo.UpdateAttributeSchema got %s", err.Error())
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusInternalServerError, err.Error(), nil, nil)
+		return
+	}
+	audit(r, &connector.AuditEvent{
+		Event:        "attribute.update",
+		TargetType:   AuditTargetAttribute,
+		Target:       schema.RecID,
+		TenantDomain: tenant.Domain,
+	}, &before, schema)
+	helper.WriteHTTPResponse(r.Context(), w, http.StatusOK, "Attribute updated", nil, schema)
+}
+
+// DeleteAttributeSchema serving request to delete an attribute schema of a tenant together with its values
+func DeleteAttributeSchema(w http.ResponseWriter, r *http.Request) {
+	fLog := attributeMgmtLog.WithField("func", "DeleteAttributeSchema").WithField("RequestID", r.Context().Value(constants.RequestID)).WithField("path", r.URL.Path).WithField("method", r.Method)
+	tenant, params := adminTenant(w, r, "/management/tenant/{tenantRecId}/attribute/{attributeRecId}")
+	if tenant == nil {
+		return
+	}
+	schema := tenantAttributeSchema(w, r, tenant, params["attributeRecId"])
+	if schema == nil {
+		return
+	}
+	err := AttributeRepo.DeleteAttributeSchema(r.Context(), schema)
+	if err != nil {
+		fLog.Errorf("AttributeRepo.DeleteAttributeSchema got %s", err.Error())
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusInternalServerError, err.Error(), nil, nil)
+		return
+	}
+	audit(r, &connector.AuditEvent{
+		Event:        "attribute.delete",
+		TargetType:   AuditTargetAttribute,
+		Target:       schema.RecID,
+		TenantDomain: tenant.Domain,
+	}, schema, nil)
+	helper.WriteHTTPResponse(r.Context(), w, http.StatusOK, "Attribute deleted", nil, nil)
+}
+
+// attributeUser loads the user of the request path which must be a member of the tenant.
+// If it fails, it writes the error response and returns nil.
+func attributeUser(w http.ResponseWriter, r *http.Request, tenant *connector.Tenant, recID string) *connector.User {
+	user, err := UserRepo.GetUserByRecID(r.Context(), recID)
+	if err != nil {
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusNotFound, err.Error(), nil, nil)
+		return nil
+	}
+	if ut, err := UserTenantRepo.GetUserTenant(r.Context(), user, tenant); err != nil || ut == nil {
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusNotFound, fmt.Sprintf("user %s is not a member of tenant %s", recID, tenant.Domain), nil, nil)
+		return nil
+	}
+	return user
+}
+
+// GetUserAttributes serving request to fetch the attribute values of a user in a tenant
+func GetUserAttributes(w http.ResponseWriter, r *http.Request) {
+	fLog := attributeMgmtLog.WithField("func", "GetUserAttributes").WithField("RequestID", r.Context().Value(constants.RequestID)).WithField("path", r.URL.Path).WithField("method", r.Method)
+	tenant, params := scopedTenant(w, r, "/management/tenant/{tenantRecId}/user/{userRecId}/attributes", readScopes...)
+	if tenant == nil {
+		return
+	}
+	user := attributeUser(w, r, tenant, params["userRecId"])
+	if user == nil {
+		return
+	}
+	values, _, err := userAttributeValues(r.Context(), user, tenant)
+	if err != nil {
+		fLog.Errorf("userAttributeValues got %s", err.Error())
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusInternalServerError, err.Error(), nil, nil)
+		return
+	}
+	helper.WriteHTTPResponse(r.Context(), w, http.StatusOK, "User attributes retrieved", nil, values)
+}
+
+// SetUserAttributes serving request to replace all attribute values of a user in a tenant.
+// The body is an object of attribute name to value, attributes not in the body are removed.
+func SetUserAttributes(w http.ResponseWriter, r *http.Request) {
+	fLog := attributeMgmtLog.WithField("func", "SetUserAttributes").WithField("RequestID", r.Context().Value(constants.RequestID)).WithField("path", r.URL.Path).WithField("method", r.Method)
+	tenant, params := scopedTenant(w, r, "/management/tenant/{tenantRecId}/user/{userRecId}/attributes", hansipcontext.ScopeUserManager)
+	if tenant == nil {
+		return
+	}
+	user := attributeUser(w, r, tenant, params["userRecId"])
+	if user == nil {
+		return
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		fLog.Errorf("ioutil.ReadAll got %s", err.Error())
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusInternalServerError, err.Error(), nil, nil)
+		return
+	}
+	req := make(map[string]interface{})
+	err = json.Unmarshal(body, &req)
+	if err != nil {
+		fLog.Errorf("json.Unmarshal got %s", err.Error())
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusBadRequest, err.Error(), nil, nil)
+		return
+	}
+	schemas, err := AttributeRepo.ListAttributeSchemas(r.Context(), tenant)
+	if err != nil {
+		fLog.Errorf("AttributeRepo.ListAttributeSchemas got %s", err.Error())
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusInternalServerError, err.Error(), nil, nil)
+		return
+	}
+	encoded, err := encodeUserAttributes(schemas, req)
+	if err != nil {
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusBadRequest, err.Error(), nil, nil)
+		return
+	}
+	for _, schema := range schemas {
+		value, ok := encoded[schema.RecID]
+		if !ok || !schema.Unique {
+			continue
+		}
+		taken, err := AttributeRepo.IsAttributeValueTaken(r.Context(), schema, value, user)
+		if err != nil {
+			fLog.Errorf("AttributeRepo.IsAttributeValueTaken got %s", err.Error())
+			helper.WriteHTTPResponse(r.Context(), w, http.StatusInternalServerError, err.Error(), nil, nil)
+			return
+		}
+		if taken {
+			helper.WriteHTTPResponse(r.Context(), w, http.StatusConflict, fmt.Sprintf("value of attribute %s is already used by another user", schema.Name), nil, nil)
+			return
+		}
+	}
+	before, _, _ := userAttributeValues(r.Context(), user, tenant)
+	for _, schema := range schemas {
+		if value, ok := encoded[schema.RecID]; ok {
+			err = AttributeRepo.SetUserAttribute(r.Context(), user, schema, value)
+		} else {
+			err = AttributeRepo.DeleteUserAttribute(r.Context(), user, schema)
+		}
+		if err != nil {
+			fLog.Errorf("AttributeRepo.SetUserAttribute got %s", err.Error())
+			helper.WriteHTTPResponse(r.Context(), w, http.StatusInternalServerError, err.Error(), nil, nil)
+			return
+		}
+	}
+	values, _, err := userAttributeValues(r.Context(), user, tenant)
+	if err != nil {
+		fLog.Errorf("userAttributeValues got %s", err.Error())
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusInternalServerError, err.Error(), nil, nil)
+		return
+	}
+	audit(r, &connector.AuditEvent{
+		Event:        "user.attributes.set",
+		TargetType:   AuditTargetUser,
+		Target:       user.RecID,
+		TenantDomain: tenant.Domain,
+	}, auditAttributeValues(before, schemas), auditAttributeValues(values, schemas))
+	helper.WriteHTTPResponse(r.Context(), w, http.StatusOK, "User attributes updated", nil, values)
+}
+
+// auditAttributeValues returns the attribute values to record in the audit log, PII values are masked.
+func auditAttributeValues(values map[string]interface{}, schemas []*connector.AttributeSchema) map[string]interface{} {
+	ret := make(map[string]interface{}, len(values))
+	for name, value := range values {
+		ret[name] = value
+	}
+	for _, schema := range schemas {
+		if _, ok := ret[schema.Name]; ok && schema.PII {
+			ret[schema.Name] = "***"
+		}
+	}
+	return ret
+}
+
+// encodeUserAttributes validates the attribute values against the tenant schemas and returns their text form keyed by attribute RecID.
+// Null values are treated as absent.
+func encodeUserAttributes(schemas []*connector.AttributeSchema, values map[string]interface{}) (map[string]string, error) {
+	byName := make(map[string]*connector.AttributeSchema, len(schemas))
+	for _, schema := range schemas {
+		byName[schema.Name] = schema
+	}
+	ret := make(map[string]string)
+	for name, value := range values {
+		schema, ok := byName[name]
+		if !ok {
+			return nil, fmt.Errorf("attribute %s is not defined", name)
+		}
+		if value == nil {
+			continue
+		}
+		text, err := encodeAttributeValue(schema, value)
+		if err != nil {
+			return nil, err
+		}
+		ret[schema.RecID] = text
+	}
+	for _, schema := range schemas {
+		if _, ok := ret[schema.RecID]; schema.Required && !ok {
+			return nil, fmt.Errorf("attribute %s is required", schema.Name)
+		}
+	}
+	return ret, nil
+}
@@ -0,0 +1,129 @@
+package endpoint
+
+import (
+	"context"
+	"testing"
+
+	"github.com/hyperjumptech/hansip/internal/connector"
+)
+
+func TestValidateAttributeSchemaRequest(t *testing.T) {
+	testData := []struct {
+		req   AttributeSchemaRequest
+		valid bool
+	}{
+		{AttributeSchemaRequest{Name: "employee_id", Type: AttributeTypeString, Unique: true, Claim: "employee_id"}, true},
+		{AttributeSchemaRequest{Name: "birth_date", Type: AttributeTypeDate, PII: true}, true},
+		{AttributeSchemaRequest{Name: "level", Type: AttributeTypeNumber, Claim: "https://example.com/level"}, false},
+		{AttributeSchemaRequest{Name: "level", Type: AttributeTypeNumber, Claim: "ex:level"}, true},
+		{AttributeSchemaRequest{Name: "1st", Type: AttributeTypeString}, false},
+		{AttributeSchemaRequest{Name: "nick name", Type: AttributeTypeString}, false},
+		{AttributeSchemaRequest{Name: "nick", Type: "text"}, false},
+		{AttributeSchemaRequest{Name: "nick", Type: AttributeTypeString, Claim: "sub"}, false},
+		{AttributeSchemaRequest{Name: "phone", Type: AttributeTypeString, PII: true, Claim: "phone"}, false},
+	}
+	for i, td := range testData {
+		err := validateAttributeSchemaRequest(&td.req)
+		if td.valid && err != nil {
+			t.Errorf("#%d expect valid but got %s", i, err.Error())
+		}
+		if !td.valid && err == nil {
+			t.Errorf("#%d expect invalid", i)
+		}
+	}
+}
+
+func TestAttributeValue(t *testing.T) {
+	testData := []struct {
+		typ     string
+		value   interface{}
+		text    string
+		decoded interface{}
+	}{
+		{AttributeTypeString, "abc", "abc", "abc"},
+		{AttributeTypeNumber, float64(12.5), "12.5", float64(12.5)},
+		{AttributeTypeNumber, float64(1e21), "1000000000000000000000", float64(1e21)},
+		{AttributeTypeBoolean, true, "true", true},
+		{AttributeTypeDate, "2020-02-29", "2020-02-29", "2020-02-29"},
+		{AttributeTypeString, float64(1), "", nil},
+		{AttributeTypeNumber, "12", "", nil},
+		{AttributeTypeBoolean, "true", "", nil},
+		{AttributeTypeDate, "2021-02-29", "", nil},
+	}
+	for i, td := range testData {
+		schema := &connector.AttributeSchema{Name: "attr", Type: td.typ}
+		text, err := encodeAttributeValue(schema, td.value)
+		if td.decoded == nil {
+			if err == nil {
+				t.Errorf("#%d expect %v rejected as %s", i, td.value, td.typ)
+			}
+			continue
+		}
+		if err != nil || text != td.text {
+			t.Errorf("#%d expect %s but %s (%v)", i, td.text, text, err)
+			continue
+		}
+		if decoded := decodeAttributeValue(schema, text); decoded != td.decoded {
+			t.Errorf("#%d expect decoded %v but %v", i, td.decoded, decoded)
+		}
+	}
+}
+
+func TestEncodeUserAttributes(t *testing.T) {
+	schemas := []*connector.AttributeSchema{
+		{RecID: "a1", Name: "employee_id", Type: AttributeTypeString, Required: true},
+		{RecID: "a2", Name: "level", Type: AttributeTypeNumber},
+	}
+	encoded, err := encodeUserAttributes(schemas, map[string]interface{}{"employee_id": "E-1", "level": nil})
+	if err != nil {
+		t.Fatalf("got %s", err.Error())
+	}
+	if len(encoded) != 1 || encoded["a1"] != "E-1" {
+		t.Errorf("unexpected %v", encoded)
+	}
+	if _, err := encodeUserAttributes(schemas, map[string]interface{}{"level": float64(3)}); err == nil {
+		t.Errorf("missing required attribute should be rejected")
+	}
+	if _, err := encodeUserAttributes(schemas, map[string]interface{}{"employee_id": "E-1", "team": "x"}); err == nil {
+		t.Errorf("undefined attribute should be rejected")
+	}
+}
+
+// memoryAttributes keeps the attribute schemas and values of the tenants in memory, keyed by the tenant rec id
+type memoryAttributes struct {
+	connector.AttributeRepository
+	schemas map[string][]*connector.AttributeSchema
+	values  map[string][]*connector.UserAttribute
+}
+
+func (m *memoryAttributes) ListAttributeSchemas(ctx context.Context, tenant *connector.Tenant) ([]*connector.AttributeSchema, error) {
+	return m.schemas[tenant.RecID], nil
+}
+
+func (m *memoryAttributes) ListUserAttributes(ctx context.Context, user *connector.User, tenant *connector.Tenant) ([]*connector.UserAttribute, error) {
+	return m.values[tenant.RecID], nil
+}
+
+func TestUserAttributeClaims(t *testing.T) {
+	defer func() { AttributeRepo, UserTenantRepo = nil, nil }()
+	acme := &connector.Tenant{RecID: "acme", Domain: "acme.com"}
+	evil := &connector.Tenant{RecID: "evil", Domain: "evil.com"}
+	UserTenantRepo = &memoryMembership{tenants: map[string][]*connector.Tenant{"john": {acme, evil}}}
+	AttributeRepo = &memoryAttributes{
+		schemas: map[string][]*connector.AttributeSchema{
+			"acme": {
+				{RecID: "a1", Name: "employee_id", Type: AttributeTypeString, Claim: "employee_id"},
+				{RecID: "a2", Name: "phone", Type: AttributeTypeString, PII: true, Claim: "phone"},
+			},
+			"evil": {{RecID: "e1", Name: "employee_id", Type: AttributeTypeString, Claim: "employee_id"}},
+		},
+		values: map[string][]*connector.UserAttribute{
+			"acme": {{AttributeRecID: "a1", Value: "E-1"}, {AttributeRecID: "a2", Value: "555"}},
+			"evil": {{AttributeRecID: "e1", Value: "E-666"}},
+		},
+	}
+	claims := userAttributeClaims(context.Background(), &connector.User{RecID: "john"})
+	if len(claims) != 2 || claims["acme.com:employee_id"] != "E-1" || claims["evil.com:employee_id"] != "E-666" {
+		t.Errorf("expect the claims of each tenant in its own namespace but got %v", claims)
+	}
+}
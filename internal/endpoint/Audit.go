@@ -0,0 +1,481 @@
+package endpoint
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hyperjumptech/hansip/internal/config"
+	"github.com/hyperjumptech/hansip/internal/connector"
+	"github.com/hyperjumptech/hansip/internal/constants"
+	"github.com/hyperjumptech/hansip/internal/events"
+	"github.com/hyperjumptech/hansip/internal/hansipcontext"
+	"github.com/hyperjumptech/hansip/pkg/helper"
+	log "github.com/sirupsen/logrus"
+)
+
+// outcomes of audit events
+const (
+	AuditSuccess    = "success"
+	AuditFailure    = "failure"
+	AuditDenied     = "denied"
+	AuditChallenged = "challenged"
+)
+
+// target types of audit events
+const (
+	AuditTargetUser       = "user"
+	AuditTargetGroup      = "group"
+	AuditTargetRole       = "role"
+	AuditTargetTenant     = "tenant"
+	AuditTargetAttribute  = "attribute"
+	AuditTargetInvitation = "invitation"
+)
+
+var (
+	auditLog = log.WithField("go", "Audit")
+
+	// auditMaskedFields are the words of field names whose values are never recorded, only that they changed
+	auditMaskedFields = []string{"passphrase", "secret", "token", "code"}
+)
+
+// clientIP returns the caller address as resolved by ClientIPResolverMiddleware, without the port.
+func clientIP(r *http.Request) string {
+	addr := strings.TrimSpace(strings.Split(r.RemoteAddr, ",")[0])
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return addr
+}
+
+// auditMasked check if the value of the field must not be recorded, that is one of the underscore
+// separated words of the field is masked. Setting keys such as token.access.duration are not masked.
+func auditMasked(field string) bool {
+	for _, word := range strings.Split(strings.ToLower(field), "_") {
+		for _, masked := range auditMaskedFields {
+			if word == masked {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// auditFields converts a record into its json fields, a value that is not a json object is put under "value".
+func auditFields(record interface{}) map[string]interface{} {
+	fields := make(map[string]interface{})
+	if record == nil {
+		return fields
+	}
+	switch v := reflect.ValueOf(record); v.Kind() {
+	case reflect.Ptr, reflect.Map, reflect.Slice:
+		if v.IsNil() {
+			return fields
+		}
+	}
+	b, err := json.Marshal(record)
+	if err != nil {
+		return fields
+	}
+	var doc interface{}
+	if err := json.Unmarshal(b, &doc); err != nil {
+		return fields
+	}
+	if obj, ok := doc.(map[string]interface{}); ok {
+		return obj
+	}
+	fields["value"] = doc
+	return fields
+}
+
+// auditDiff returns the fields that differ between the record before and after a change.
+// Either may be nil for creation or deletion. Secret fields are masked.
+func auditDiff(before, after interface{}) map[string]*connector.AuditChange {
+	beforeFields, afterFields := auditFields(before), auditFields(after)
+	changes := make(map[string]*connector.AuditChange)
+	diff := func(field string) {
+		b, bok := beforeFields[field]
+		a, aok := afterFields[field]
+		if bok == aok && reflect.DeepEqual(a, b) {
+			return
+		}
+		if auditMasked(field) {
+			if bok && b != nil {
+				b = "***"
+			}
+			if aok && a != nil {
+				a = "***"
+			}
+		}
+		changes[field] = &connector.AuditChange{Before: b, After: a}
+	}
+	for field := range beforeFields {
+		diff(field)
+	}
+	for field := range afterFields {
+		if _, ok := beforeFields[field]; !ok {
+			diff(field)
+		}
+	}
+	return changes
+}
+
+// userAuditDomain returns the tenant domain the events of the user are recorded under,
+// that is the first tenant the user is member of or the hansip domain if none.
+func userAuditDomain(ctx context.Context, user *connector.User) string {
+	if AuditRepo == nil {
+		return ""
+	}
+	tenants, _, err := UserTenantRepo.ListUserTenantByUser(ctx, user, &helper.PageRequest{
+		No:       1,
+		PageSize: 1,
+		OrderBy:  "TENANT_NAME",
+		Sort:     "ASC",
+	})
+	if err != nil || len(tenants) == 0 {
+		return config.Get("hansip.domain")
+	}
+	return tenants[0].Domain
+}
+
+// audit records an event of the request into the audit log. The time, client IP, request ID and,
+// unless already set, the actor and outcome are filled in. before and after are the record prior and
+// after the change, only the differing fields are recorded. Failing to record is logged, not returned,
+// so the request is served regardless.
+func audit(r *http.Request, event *connector.AuditEvent, before, after interface{}) {
+	auditContext(context.WithValue(r.Context(), constants.ClientIP, clientIP(r)), event, before, after)
+}
+
+// auditContext records an event into the audit log like audit, taking the request details from the context,
+// for event subscribers that do not see the request.
+func auditContext(ctx context.Context, event *connector.AuditEvent, before, after interface{}) {
+	if AuditRepo == nil {
+		return
+	}
+	fLog := auditLog.WithField("func", "auditContext").WithField("RequestID", ctx.Value(constants.RequestID))
+	event.Time = time.Now()
+	if ip, ok := ctx.Value(constants.ClientIP).(string); ok {
+		event.ClientIP = ip
+	}
+	if requestID, ok := ctx.Value(constants.RequestID).(string); ok {
+		event.RequestID = requestID
+	}
+	if len(event.Actor) == 0 {
+		if authCtx, ok := ctx.Value(constants.HansipAuthentication).(*hansipcontext.AuthenticationContext); ok {
+			event.Actor = authCtx.Subject
+		}
+	}
+	if len(event.Outcome) == 0 {
+		event.Outcome = AuditSuccess
+	}
+	if before != nil || after != nil {
+		event.Changes = auditDiff(before, after)
+	}
+	if err := AuditRepo.AppendAuditEvent(ctx, event); err != nil {
+		fLog.Errorf("AuditRepo.AppendAuditEvent %s got %s", event.Event, err.Error())
+	}
+}
+
+// auditDomains returns the tenant domains whose events the caller may read, nil for all.
+// The second value is false if the caller may not read the audit log at all.
+func auditDomains(authCtx *hansipcontext.AuthenticationContext) ([]string, bool) {
+	if authCtx.HasScopeOfDomain(config.Get("hansip.domain"), hansipcontext.ScopeAuditor) {
+		return nil, true
+	}
+	if !authCtx.HasAnyScope(hansipcontext.ScopeAuditor) {
+		return nil, false
+	}
+	return authCtx.ScopedDomains(hansipcontext.ScopeAuditor), true
+}
+
+// ListAuditEvents serve the paginated and filterable listing of audit events
+func ListAuditEvents(w http.ResponseWriter, r *http.Request) {
+	fLog := auditLog.WithField("func", "ListAuditEvents").WithField("RequestID", r.Context().Value(constants.RequestID)).WithField("path", r.URL.Path).WithField("method", r.Method)
+	iauthctx := r.Context().Value(constants.HansipAuthentication)
+	if iauthctx == nil {
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusUnauthorized, "You are not authorized to access this resource", nil, nil)
+		return
+	}
+	authCtx := iauthctx.(*hansipcontext.AuthenticationContext)
+	domains, ok := auditDomains(authCtx)
+	if !ok {
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusForbidden, "You don't have the right to access this resource", nil, nil)
+		return
+	}
+	pageRequest, err := helper.NewPageRequestFromRequest(r)
+	if err != nil {
+		fLog.Errorf("helper.NewPageRequestFromRequest got %s", err.Error())
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusBadRequest, err.Error(), nil, nil)
+		return
+	}
+	events, page, err := AuditRepo.ListAuditEvents(r.Context(), domains, pageRequest)
+	if err != nil {
+		fLog.Errorf("AuditRepo.ListAuditEvents got %s", err.Error())
+		helper.WriteHTTPResponse(r.Context(), w, listErrorStatus(err), err.Error(), nil, nil)
+		return
+	}
+	ret := make(map[string]interface{})
+	ret["events"] = events
+	ret["page"] = page
+	helper.WriteHTTPResponse(r.Context(), w, http.StatusOK, "List of audit events paginated", nil, ret)
+}
+
+// ExportAuditEvents serve the export of audit events as JSON Lines, one event per line.
+// The events can be filtered and ordered the same way as the listing, all pages are exported.
+func ExportAuditEvents(w http.ResponseWriter, r *http.Request) {
+	fLog := auditLog.WithField("func", "ExportAuditEvents").WithField("RequestID", r.Context().Value(constants.RequestID)).WithField("path", r.URL.Path).WithField("method", r.Method)
+	iauthctx := r.Context().Value(constants.HansipAuthentication)
+	if iauthctx == nil {
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusUnauthorized, "You are not authorized to access this resource", nil, nil)
+		return
+	}
+	authCtx := iauthctx.(*hansipcontext.AuthenticationContext)
+	domains, ok := auditDomains(authCtx)
+	if !ok {
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusForbidden, "You don't have the right to access this resource", nil, nil)
+		return
+	}
+	pageRequest, err := helper.NewPageRequestFromRequest(r)
+	if err != nil {
+		fLog.Errorf("helper.NewPageRequestFromRequest got %s", err.Error())
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusBadRequest, err.Error(), nil, nil)
+		return
+	}
+	// the export walks the pages by cursor so events appended meanwhile do not shift the pages
+	request := &helper.PageRequest{
+		PageSize:  100,
+		OrderBy:   pageRequest.OrderBy,
+		Sort:      pageRequest.Sort,
+		Filters:   pageRequest.Filters,
+		UseCursor: true,
+	}
+	events, page, err := AuditRepo.ListAuditEvents(r.Context(), domains, request)
+	if err != nil {
+		fLog.Errorf("AuditRepo.ListAuditEvents got %s", err.Error())
+		helper.WriteHTTPResponse(r.Context(), w, listErrorStatus(err), err.Error(), nil, nil)
+		return
+	}
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("Content-Disposition", "attachment; filename=\"audit.jsonl\"")
+	encoder := json.NewEncoder(w)
+	count := 0
+	for {
+		for _, event := range events {
+			if err := encoder.Encode(event); err != nil {
+				fLog.Errorf("encoder.Encode got %s after %d events", err.Error(), count)
+				return
+			}
+			count++
+		}
+		if !page.HasNext {
+			break
+		}
+		request.Cursor = page.NextCursor
+		events, page, err = AuditRepo.ListAuditEvents(r.Context(), domains, request)
+		if err != nil {
+			// header is already sent, nothing else we can do but logging.
+			fLog.Errorf("AuditRepo.ListAuditEvents got %s after %d events", err.Error(), count)
+			return
+		}
+	}
+	fLog.Tracef("%d audit events exported", count)
+}
+
+// auditAuthentication records an authentication attempt, the actor is whoever the attempt claims to be.
+// user is nil if no such user exists.
+func auditAuthentication(r *http.Request, event, outcome, email string, user *connector.User) {
+	auditAuthenticationContext(context.WithValue(r.Context(), constants.ClientIP, clientIP(r)), event, outcome, email, user)
+}
+
+// auditAuthenticationContext records an authentication attempt like auditAuthentication, for event subscribers
+func auditAuthenticationContext(ctx context.Context, event, outcome, email string, user *connector.User) {
+	if AuditRepo == nil {
+		return
+	}
+	tenantDomain := config.Get("hansip.domain")
+	if user != nil {
+		tenantDomain = userAuditDomain(ctx, user)
+	}
+	auditContext(ctx, &connector.AuditEvent{
+		Event:        event,
+		Outcome:      outcome,
+		Actor:        email,
+		TargetType:   AuditTargetUser,
+		Target:       email,
+		TenantDomain: tenantDomain,
+	}, nil, nil)
+}
+
+// subscribeAudit records the authentication attempts and lockouts published on the bus
+func subscribeAudit(bus *events.Bus) {
+	bus.Subscribe(events.TypeLoginSucceeded, func(ctx context.Context, event events.Event) {
+		e := event.(*events.LoginSucceeded)
+		auditAuthenticationContext(ctx, e.Method, AuditSuccess, e.Email, e.User)
+	})
+	bus.Subscribe(events.TypeLoginChallenged, func(ctx context.Context, event events.Event) {
+		e := event.(*events.LoginChallenged)
+		auditAuthenticationContext(ctx, e.Method, AuditChallenged, e.Email, e.User)
+	})
+	bus.Subscribe(events.TypeLoginFailed, func(ctx context.Context, event events.Event) {
+		e := event.(*events.LoginFailed)
+		auditAuthenticationContext(ctx, e.Method, e.Outcome, e.Email, e.User)
+	})
+	bus.Subscribe(events.TypeUserSuspended, func(ctx context.Context, event events.Event) {
+		e := event.(*events.UserSuspended)
+		if e.Reason != events.SuspendedByLockout || AuditRepo == nil {
+			return
+		}
+		auditContext(ctx, &connector.AuditEvent{
+			Event:        "auth.lockout",
+			Actor:        e.User.Email,
+			TargetType:   AuditTargetUser,
+			Target:       e.User.RecID,
+			TenantDomain: userAuditDomain(ctx, e.User),
+		}, map[string]interface{}{"suspended": false, "fail_count": e.User.FailCount - 1}, map[string]interface{}{"suspended": true, "fail_count": e.User.FailCount})
+	})
+}
+
+// auditUser records a management event on the user
+func auditUser(r *http.Request, event string, user *connector.User, before, after interface{}) {
+	if AuditRepo == nil {
+		return
+	}
+	audit(r, &connector.AuditEvent{
+		Event:        event,
+		TargetType:   AuditTargetUser,
+		Target:       user.RecID,
+		TenantDomain: userAuditDomain(r.Context(), user),
+	}, before, after)
+}
+
+// auditGroup records a management event on the group
+func auditGroup(r *http.Request, event string, group *connector.Group, before, after interface{}) {
+	audit(r, &connector.AuditEvent{
+		Event:        event,
+		TargetType:   AuditTargetGroup,
+		Target:       group.RecID,
+		TenantDomain: group.GroupDomain,
+	}, before, after)
+}
+
+// auditRole records a management event on the role
+func auditRole(r *http.Request, event string, role *connector.Role, before, after interface{}) {
+	audit(r, &connector.AuditEvent{
+		Event:        event,
+		TargetType:   AuditTargetRole,
+		Target:       role.RecID,
+		TenantDomain: role.RoleDomain,
+	}, before, after)
+}
+
+// auditTenant records a management event on the tenant
+func auditTenant(r *http.Request, event string, tenant *connector.Tenant, before, after interface{}) {
+	audit(r, &connector.AuditEvent{
+		Event:        event,
+		TargetType:   AuditTargetTenant,
+		Target:       tenant.RecID,
+		TenantDomain: tenant.Domain,
+	}, before, after)
+}
+
+// auditMembers pages through a membership listing and returns the members formatted by name, to record
+// the membership before and after a change. Nothing is fetched if there is no audit log.
+func auditMembers(ctx context.Context, field string, list func(request *helper.PageRequest) ([]string, *helper.Page, error)) map[string]interface{} {
+	if AuditRepo == nil {
+		return nil
+	}
+	members := make([]string, 0)
+	err := allPages(func(request *helper.PageRequest) (int, *helper.Page, error) {
+		names, page, err := list(request)
+		members = append(members, names...)
+		return len(names), page, err
+	})
+	if err != nil {
+		auditLog.WithField("func", "auditMembers").WithField("RequestID", ctx.Value(constants.RequestID)).Errorf("listing %s got %s", field, err.Error())
+	}
+	sort.Strings(members)
+	return map[string]interface{}{field: members}
+}
+
+func roleNames(roles []*connector.Role) []string {
+	ret := make([]string, len(roles))
+	for i, role := range roles {
+		ret[i] = fmt.Sprintf("%s@%s", role.RoleName, role.RoleDomain)
+	}
+	return ret
+}
+
+func groupNames(groups []*connector.Group) []string {
+	ret := make([]string, len(groups))
+	for i, group := range groups {
+		ret[i] = fmt.Sprintf("%s@%s", group.GroupName, group.GroupDomain)
+	}
+	return ret
+}
+
+func userEmails(users []*connector.User) []string {
+	ret := make([]string, len(users))
+	for i, user := range users {
+		ret[i] = user.Email
+	}
+	return ret
+}
+
+// auditUserRoles returns the roles directly assigned to the user
+func auditUserRoles(ctx context.Context, user *connector.User) map[string]interface{} {
+	return auditMembers(ctx, "roles", func(request *helper.PageRequest) ([]string, *helper.Page, error) {
+		roles, page, err := UserRoleRepo.ListUserRoleByUser(ctx, user, request)
+		return roleNames(roles), page, err
+	})
+}
+
+// auditUserGroups returns the groups the user is member of
+func auditUserGroups(ctx context.Context, user *connector.User) map[string]interface{} {
+	return auditMembers(ctx, "groups", func(request *helper.PageRequest) ([]string, *helper.Page, error) {
+		groups, page, err := UserGroupRepo.ListUserGroupByUser(ctx, user, request)
+		return groupNames(groups), page, err
+	})
+}
+
+// auditGroupUsers returns the members of the group
+func auditGroupUsers(ctx context.Context, group *connector.Group) map[string]interface{} {
+	return auditMembers(ctx, "users", func(request *helper.PageRequest) ([]string, *helper.Page, error) {
+		users, page, err := UserGroupRepo.ListUserGroupByGroup(ctx, group, request)
+		return userEmails(users), page, err
+	})
+}
+
+// auditGroupRoles returns the roles assigned to the group
+func auditGroupRoles(ctx context.Context, group *connector.Group) map[string]interface{} {
+	return auditMembers(ctx, "roles", func(request *helper.PageRequest) ([]string, *helper.Page, error) {
+		roles, page, err := GroupRoleRepo.ListGroupRoleByGroup(ctx, group, request)
+		return roleNames(roles), page, err
+	})
+}
+
+// auditRoleUsers returns the users the role is directly assigned to
+func auditRoleUsers(ctx context.Context, role *connector.Role) map[string]interface{} {
+	return auditMembers(ctx, "users", func(request *helper.PageRequest) ([]string, *helper.Page, error) {
+		users, page, err := UserRoleRepo.ListUserRoleByRole(ctx, role, request)
+		return userEmails(users), page, err
+	})
+}
+
+// auditRoleGroups returns the groups the role is assigned to
+func auditRoleGroups(ctx context.Context, role *connector.Role) map[string]interface{} {
+	return auditMembers(ctx, "groups", func(request *helper.PageRequest) ([]string, *helper.Page, error) {
+		groups, page, err := GroupRoleRepo.ListGroupRoleByRole(ctx, role, request)
+		return groupNames(groups), page, err
+	})
+}
+
+// auditLink returns the change of a single membership, the member is recorded under the field
+func auditLink(field, member string) map[string]interface{} {
+	return map[string]interface{}{field: member}
+}
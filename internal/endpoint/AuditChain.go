@@ -0,0 +1,162 @@
+package endpoint
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/hyperjumptech/hansip/internal/config"
+	"github.com/hyperjumptech/hansip/internal/connector"
+	"github.com/hyperjumptech/hansip/internal/constants"
+	"github.com/hyperjumptech/hansip/internal/hansipcontext"
+	"github.com/hyperjumptech/hansip/pkg/helper"
+	"github.com/hyperjumptech/jiffy"
+)
+
+// auditCheckpointSubject is the subject of checkpoint signatures, so they can never pass as access tokens
+const auditCheckpointSubject = "hansip-audit-checkpoint"
+
+var (
+	// auditCheckpointStop stops StartAuditCheckpoints once closed
+	auditCheckpointStop = make(chan bool)
+)
+
+// signAuditCheckpoint signs the sequence and hash of the audit hash chain with the token signing key
+func signAuditCheckpoint(seq int64, hash string, at time.Time) (string, error) {
+	return helper.CreateJWTStringToken(config.Get("token.crypt.key"), config.Get("token.crypt.method"), config.Get("token.issuer"),
+		auditCheckpointSubject, []string{auditCheckpointSubject}, at, at, at.AddDate(100, 0, 0),
+		map[string]interface{}{"seq": seq, "hash": hash})
+}
+
+// verifyAuditCheckpoint check the checkpoint signature was made with the token signing key for the checkpoint sequence and hash
+func verifyAuditCheckpoint(checkpoint *connector.AuditCheckpoint) error {
+	issuer, subject, _, _, _, _, additional, err := helper.ReadJWTStringToken(true, config.Get("token.crypt.key"), config.Get("token.crypt.method"), checkpoint.Signature)
+	if err != nil {
+		return err
+	}
+	if issuer != config.Get("token.issuer") || subject != auditCheckpointSubject {
+		return fmt.Errorf("not an audit checkpoint signature")
+	}
+	seq, _ := additional["seq"].(float64)
+	hash, _ := additional["hash"].(string)
+	if int64(seq) != checkpoint.Seq || hash != checkpoint.Hash {
+		return fmt.Errorf("signature is not of sequence %d and hash %s", checkpoint.Seq, checkpoint.Hash)
+	}
+	return nil
+}
+
+// CreateAuditCheckpoint signs the current head of the audit hash chain into a checkpoint.
+// Nothing is made, and nil returned, if no event was recorded since the last checkpoint.
+func CreateAuditCheckpoint(ctx context.Context) (*connector.AuditCheckpoint, error) {
+	seq, hash, err := AuditRepo.GetAuditChainHead(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if seq == 0 {
+		return nil, nil
+	}
+	checkpoints, err := AuditRepo.ListAuditCheckpoints(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if len(checkpoints) > 0 && checkpoints[len(checkpoints)-1].Seq == seq {
+		return nil, nil
+	}
+	now := time.Now()
+	signature, err := signAuditCheckpoint(seq, hash, now)
+	if err != nil {
+		return nil, err
+	}
+	checkpoint := &connector.AuditCheckpoint{
+		Seq:       seq,
+		Hash:      hash,
+		CreatedAt: now,
+		Signature: signature,
+	}
+	if err := AuditRepo.CreateAuditCheckpoint(ctx, checkpoint); err != nil {
+		return nil, err
+	}
+	return checkpoint, nil
+}
+
+// VerifyAuditChain checks the signature of every checkpoint then walks the audit hash chain,
+// reporting the first broken link. Checkpoints made with another signing key are reported as broken.
+func VerifyAuditChain(ctx context.Context) (*connector.AuditChainReport, error) {
+	checkpoints, err := AuditRepo.ListAuditCheckpoints(ctx)
+	if err != nil {
+		return nil, err
+	}
+	signed := make(map[int64]string)
+	for _, checkpoint := range checkpoints {
+		if err := verifyAuditCheckpoint(checkpoint); err != nil {
+			return &connector.AuditChainReport{
+				BrokenSeq: checkpoint.Seq,
+				Reason:    fmt.Sprintf("signature of checkpoint %s is invalid, %s", checkpoint.RecID, err.Error()),
+			}, nil
+		}
+		signed[checkpoint.Seq] = checkpoint.Hash
+	}
+	return AuditRepo.VerifyAuditChain(ctx, signed)
+}
+
+// StartAuditCheckpoints makes a checkpoint of the audit hash chain every audit.checkpoint.interval
+// until StopAuditCheckpoints is called. It returns right away if the interval is 0.
+func StartAuditCheckpoints() {
+	fLog := auditLog.WithField("func", "StartAuditCheckpoints")
+	interval, err := jiffy.DurationOf(config.Get("audit.checkpoint.interval"))
+	if err != nil || interval <= 0 {
+		fLog.Warnf("Audit checkpoints are disabled, audit.checkpoint.interval is %s", config.Get("audit.checkpoint.interval"))
+		return
+	}
+	fLog.Infof("Audit checkpoint every %s", interval.String())
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			checkpoint, err := CreateAuditCheckpoint(context.Background())
+			if err != nil {
+				fLog.Errorf("CreateAuditCheckpoint got %s", err.Error())
+			} else if checkpoint != nil {
+				fLog.Infof("Audit checkpoint made at sequence %d", checkpoint.Seq)
+			}
+		case <-auditCheckpointStop:
+			fLog.Info("Audit checkpoint stopped")
+			return
+		}
+	}
+}
+
+// StopAuditCheckpoints stops StartAuditCheckpoints
+func StopAuditCheckpoints() {
+	close(auditCheckpointStop)
+}
+
+// VerifyAuditLog serving request to verify the audit hash chain. The chain covers all tenants,
+// so only auditors of the hansip domain may verify it.
+func VerifyAuditLog(w http.ResponseWriter, r *http.Request) {
+	fLog := auditLog.WithField("func", "VerifyAuditLog").WithField("RequestID", r.Context().Value(constants.RequestID)).WithField("path", r.URL.Path).WithField("method", r.Method)
+	iauthctx := r.Context().Value(constants.HansipAuthentication)
+	if iauthctx == nil {
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusUnauthorized, "You are not authorized to access this resource", nil, nil)
+		return
+	}
+	authCtx := iauthctx.(*hansipcontext.AuthenticationContext)
+	if domains, ok := auditDomains(authCtx); !ok || domains != nil {
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusForbidden, "You don't have the right to access this resource", nil, nil)
+		return
+	}
+	report, err := VerifyAuditChain(r.Context())
+	if err != nil {
+		fLog.Errorf("VerifyAuditChain got %s", err.Error())
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusInternalServerError, err.Error(), nil, nil)
+		return
+	}
+	if !report.Verified {
+		fLog.Warnf("Audit chain broken at sequence %d, %s", report.BrokenSeq, report.Reason)
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusOK, fmt.Sprintf("Audit chain broken at sequence %d", report.BrokenSeq), nil, report)
+		return
+	}
+	helper.WriteHTTPResponse(r.Context(), w, http.StatusOK, "Audit chain verified", nil, report)
+}
@@ -0,0 +1,44 @@
+package endpoint
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hyperjumptech/hansip/internal/config"
+	"github.com/hyperjumptech/hansip/internal/connector"
+	"github.com/hyperjumptech/hansip/pkg/helper"
+)
+
+func TestAuditCheckpointSignature(t *testing.T) {
+	hash := "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"
+	signature, err := signAuditCheckpoint(42, hash, time.Now())
+	if err != nil {
+		t.Fatalf("signAuditCheckpoint got %s", err.Error())
+	}
+	checkpoint := &connector.AuditCheckpoint{Seq: 42, Hash: hash, Signature: signature}
+	if err := verifyAuditCheckpoint(checkpoint); err != nil {
+		t.Errorf("expect valid signature but %s", err.Error())
+	}
+
+	moved := &connector.AuditCheckpoint{Seq: 41, Hash: hash, Signature: signature}
+	if err := verifyAuditCheckpoint(moved); err == nil {
+		t.Errorf("expect signature of another sequence invalid")
+	}
+
+	rehashed := &connector.AuditCheckpoint{Seq: 42, Hash: "0" + hash[1:], Signature: signature}
+	if err := verifyAuditCheckpoint(rehashed); err == nil {
+		t.Errorf("expect signature of another hash invalid")
+	}
+
+	forged, _ := helper.CreateJWTStringToken("another key", config.Get("token.crypt.method"), config.Get("token.issuer"),
+		auditCheckpointSubject, nil, time.Now(), time.Now(), time.Now().Add(time.Hour), map[string]interface{}{"seq": 42, "hash": hash})
+	if err := verifyAuditCheckpoint(&connector.AuditCheckpoint{Seq: 42, Hash: hash, Signature: forged}); err == nil {
+		t.Errorf("expect signature of another key invalid")
+	}
+
+	access, _ := helper.CreateJWTStringToken(config.Get("token.crypt.key"), config.Get("token.crypt.method"), config.Get("token.issuer"),
+		"admin@hansip", nil, time.Now(), time.Now(), time.Now().Add(time.Hour), map[string]interface{}{"seq": 42, "hash": hash})
+	if err := verifyAuditCheckpoint(&connector.AuditCheckpoint{Seq: 42, Hash: hash, Signature: access}); err == nil {
+		t.Errorf("expect token of another subject invalid")
+	}
+}
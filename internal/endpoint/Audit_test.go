@@ -0,0 +1,76 @@
+package endpoint
+
+import (
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/hyperjumptech/hansip/internal/connector"
+)
+
+func TestClientIP(t *testing.T) {
+	testData := []struct {
+		remoteAddr string
+		expect     string
+	}{
+		{"10.0.0.1:5678", "10.0.0.1"},
+		{"10.0.0.1", "10.0.0.1"},
+		{"203.0.113.7, 10.0.0.1", "203.0.113.7"},
+		{"[2001:db8::1]:443", "2001:db8::1"},
+	}
+	for i, td := range testData {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.RemoteAddr = td.remoteAddr
+		if got := clientIP(r); got != td.expect {
+			t.Errorf("#%d expect %s but %s", i, td.expect, got)
+		}
+	}
+}
+
+func TestAuditMasked(t *testing.T) {
+	testData := []struct {
+		field  string
+		expect bool
+	}{
+		{"passphrase", true},
+		{"user_2fa_secret", true},
+		{"recovery_code", true},
+		{"token", true},
+		{"email", false},
+		{"token.access.duration", false},
+		{"enabled_2fa", false},
+	}
+	for _, td := range testData {
+		if got := auditMasked(td.field); got != td.expect {
+			t.Errorf("%s expect %v but %v", td.field, td.expect, got)
+		}
+	}
+}
+
+func TestAuditDiff(t *testing.T) {
+	before := &connector.User{RecID: "abc", Email: "john@example.com", HashedPassphrase: "old", Enabled: false}
+	after := &connector.User{RecID: "abc", Email: "john@example.com", HashedPassphrase: "new", Enabled: true}
+	changes := auditDiff(before, after)
+	expect := map[string]*connector.AuditChange{
+		"enabled":           {Before: false, After: true},
+		"hashed_passphrase": {Before: "***", After: "***"},
+	}
+	if !reflect.DeepEqual(changes, expect) {
+		t.Errorf("expect %v but %v", expect, changes)
+	}
+
+	changes = auditDiff(nil, map[string]interface{}{"name": "admin"})
+	if len(changes) != 1 || changes["name"].Before != nil || changes["name"].After != "admin" {
+		t.Errorf("creation expect name nil to admin but %v", changes)
+	}
+
+	var nilMap map[string]interface{}
+	changes = auditDiff(nilMap, "value")
+	if len(changes) != 1 || changes["value"].After != "value" {
+		t.Errorf("non object expect value but %v", changes)
+	}
+
+	if changes = auditDiff(after, after); len(changes) != 0 {
+		t.Errorf("unchanged record expect no changes but %v", changes)
+	}
+}
@@ -1,15 +1,20 @@
 package endpoint
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
-	"github.com/hyperjumptech/hansip/pkg/helper"
-	"github.com/hyperjumptech/hansip/pkg/totp"
-	"golang.org/x/crypto/bcrypt"
 	"io/ioutil"
 	"net/http"
 	"strings"
 	"time"
+
+	"github.com/hyperjumptech/hansip/internal/config"
+	"github.com/hyperjumptech/hansip/internal/connector"
+	"github.com/hyperjumptech/hansip/internal/events"
+	"github.com/hyperjumptech/hansip/pkg/helper"
+	"github.com/hyperjumptech/hansip/pkg/totp"
+	"golang.org/x/crypto/bcrypt"
 )
 
 var (
@@ -89,6 +94,20 @@ func TwoFATest(w http.ResponseWriter, r *http.Request) {
 	return
 }
 
+// verify2FACode check the code against the second factor the user activated, the code mailed to users
+// who activated 2FA by email, otherwise the authenticator app. It returns the method to publish the sign in with.
+func verify2FACode(ctx context.Context, user *connector.User, code string, now time.Time) (bool, string, error) {
+	if user.Enable2FactorEmail {
+		valid, err := verifyEmailOTP(ctx, user, connector.EmailOTPLogin, code, now)
+		return valid, "auth.2fa_email", err
+	}
+	if len(user.UserTotpSecretKey) == 0 {
+		return false, "auth.2fa", nil
+	}
+	valid, err := totp.Authenticate(totp.SecretFromBase32(user.UserTotpSecretKey), code, true)
+	return valid, "auth.2fa", err
+}
+
 // TwoFA validate 2FA token and authenticate the user
 func TwoFA(w http.ResponseWriter, r *http.Request) {
 	body, err := ioutil.ReadAll(r.Body)
@@ -108,8 +127,9 @@ func TwoFA(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	secret := totp.SecretFromBase32(user.UserTotpSecretKey)
-	valid, err := totp.Authenticate(secret, authReq.Otp, true)
+	settings := userSettings(r.Context(), user)
+
+	valid, method, err := verify2FACode(r.Context(), user, authReq.Otp, time.Now())
 	if err != nil {
 		helper.WriteHTTPResponse(r.Context(), w, http.StatusInternalServerError, err.Error(), nil, nil)
 		return
@@ -118,10 +138,7 @@ func TwoFA(w http.ResponseWriter, r *http.Request) {
 	defer UserRepo.UpdateUser(r.Context(), user)
 
 	if !valid {
-		user.FailCount = user.FailCount + 1
-		if user.FailCount > 3 {
-			user.Suspended = true
-		}
+		registerAuthenticationFailure(r, "auth.2fa", settings, user)
 		helper.WriteHTTPResponse(r.Context(), w, http.StatusUnauthorized, "OTP not valid", nil, nil)
 		return
 	}
@@ -157,13 +174,14 @@ func TwoFA(w http.ResponseWriter, r *http.Request) {
 	// Set the audience
 	audience := roles
 
-	access, refresh, err := TokenFactory.CreateTokenPair(subject, audience, nil)
+	access, refresh, err := createTokenPair(settings, subject, audience, userAttributeClaims(r.Context(), user))
 
 	resp := &Response{
 		AccessToken:  access,
 		RefreshToken: refresh,
 	}
 
+	events.Publish(r.Context(), &events.LoginSucceeded{User: user, Email: user.Email, Method: method})
 	helper.WriteHTTPResponse(r.Context(), w, http.StatusOK, "Successful", nil, resp)
 }
 
@@ -194,9 +212,12 @@ func Authentication2FA(w http.ResponseWriter, r *http.Request) {
 	// Get user by said email
 	user, err := UserRepo.GetUserByEmail(r.Context(), authReq.Email)
 	if err != nil || user == nil {
+		events.Publish(r.Context(), &events.LoginFailed{Email: authReq.Email, Method: "auth.recovery_login", Outcome: events.LoginFailure})
 		helper.WriteHTTPResponse(r.Context(), w, http.StatusUnauthorized, http.StatusText(http.StatusUnauthorized), nil, nil)
 		return
 	}
+
+	settings := userSettings(r.Context(), user)
 	user.LastLogin = time.Now()
 
 	// Make sure chages to this user are saved.
@@ -204,12 +225,14 @@ func Authentication2FA(w http.ResponseWriter, r *http.Request) {
 
 	// Make sure the user is enabled
 	if !user.Enabled {
+		events.Publish(r.Context(), &events.LoginFailed{User: user, Email: user.Email, Method: "auth.recovery_login", Outcome: events.LoginDenied})
 		helper.WriteHTTPResponse(r.Context(), w, http.StatusForbidden, "account disabled", nil, nil)
 		return
 	}
 
 	// Make sure the user is not suspended
 	if user.Suspended {
+		events.Publish(r.Context(), &events.LoginFailed{User: user, Email: user.Email, Method: "auth.recovery_login", Outcome: events.LoginDenied})
 		helper.WriteHTTPResponse(r.Context(), w, http.StatusForbidden, "account suspended", nil, nil)
 		return
 	}
@@ -217,10 +240,7 @@ func Authentication2FA(w http.ResponseWriter, r *http.Request) {
 	// Validate the user's password
 	err = bcrypt.CompareHashAndPassword([]byte(user.HashedPassphrase), []byte(authReq.Passphrase))
 	if err != nil {
-		user.FailCount++
-		if user.FailCount > 3 {
-			user.Suspended = true
-		}
+		registerAuthenticationFailure(r, "auth.recovery_login", settings, user)
 		helper.WriteHTTPResponse(r.Context(), w, http.StatusUnauthorized, "email or passphrase not match", nil, nil)
 		return
 	}
@@ -238,10 +258,7 @@ func Authentication2FA(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 	if !codeCorrect {
-		user.FailCount++
-		if user.FailCount > 3 {
-			user.Suspended = true
-		}
+		registerAuthenticationFailure(r, "auth.recovery_login", settings, user)
 		helper.WriteHTTPResponse(r.Context(), w, http.StatusUnauthorized, "invalid secret key", nil, nil)
 		return
 	}
@@ -279,16 +296,40 @@ func Authentication2FA(w http.ResponseWriter, r *http.Request) {
 	// Set the audience
 	audience := roles
 
-	access, refresh, err := TokenFactory.CreateTokenPair(subject, audience, nil)
+	access, refresh, err := createTokenPair(settings, subject, audience, userAttributeClaims(r.Context(), user))
 
 	resp := &Response{
 		AccessToken:  access,
 		RefreshToken: refresh,
 	}
 
+	events.Publish(r.Context(), &events.LoginSucceeded{User: user, Email: user.Email, Method: "auth.recovery_login"})
 	helper.WriteHTTPResponse(r.Context(), w, http.StatusOK, "Successful", nil, resp)
 }
 
+// registerAuthenticationFailure publishes the failed authentication attempt of the user,
+// the lockout subscriber counts it and suspends the user once the attempts exceed the lockout threshold.
+func registerAuthenticationFailure(r *http.Request, method string, settings config.Settings, user *connector.User) {
+	events.Publish(r.Context(), &events.LoginFailed{User: user, Email: user.Email, Method: method, Outcome: events.LoginFailure, Settings: settings})
+}
+
+// lockOut counts the failed authentication attempt of a known user and suspends the user once the attempts
+// exceed the lockout threshold, publishing the suspension on the bus. The publisher of the failure saves the user.
+func lockOut(ctx context.Context, bus *events.Bus, e *events.LoginFailed) {
+	if e.User == nil || e.Outcome != events.LoginFailure {
+		return
+	}
+	settings := e.Settings
+	if settings == nil {
+		settings = userSettings(ctx, e.User)
+	}
+	e.User.FailCount++
+	if e.User.FailCount > settings.GetInt("security.lockout.failcount") && !e.User.Suspended {
+		e.User.Suspended = true
+		bus.Publish(ctx, &events.UserSuspended{User: e.User, Reason: events.SuspendedByLockout})
+	}
+}
+
 // Authentication serve normal authentication
 func Authentication(w http.ResponseWriter, r *http.Request) {
 	// Check content-type, make sure its application/json
@@ -316,10 +357,13 @@ func Authentication(w http.ResponseWriter, r *http.Request) {
 	// Get user by said email
 	user, err := UserRepo.GetUserByEmail(r.Context(), authReq.Email)
 	if err != nil || user == nil {
+		events.Publish(r.Context(), &events.LoginFailed{Email: authReq.Email, Method: "auth.login", Outcome: events.LoginFailure})
 		helper.WriteHTTPResponse(r.Context(), w, http.StatusUnauthorized, http.StatusText(http.StatusUnauthorized), nil, nil)
 		return
 	}
 
+	settings := userSettings(r.Context(), user)
+
 	user.LastLogin = time.Unix(time.Now().Unix(), 0)
 
 	// Make sure chages to this user are saved.
@@ -332,6 +376,7 @@ func Authentication(w http.ResponseWriter, r *http.Request) {
 
 	// Make sure the user is enabled
 	if !user.Enabled {
+		events.Publish(r.Context(), &events.LoginFailed{User: user, Email: user.Email, Method: "auth.login", Outcome: events.LoginDenied})
 		helper.WriteHTTPResponse(r.Context(), w, http.StatusForbidden, "account disabled", nil, nil)
 		err = UserRepo.UpdateUser(r.Context(), user)
 		if err != nil {
@@ -342,6 +387,7 @@ func Authentication(w http.ResponseWriter, r *http.Request) {
 
 	// Make sure the user is not suspended
 	if user.Suspended {
+		events.Publish(r.Context(), &events.LoginFailed{User: user, Email: user.Email, Method: "auth.login", Outcome: events.LoginDenied})
 		helper.WriteHTTPResponse(r.Context(), w, http.StatusForbidden, "account suspended", nil, nil)
 		err = UserRepo.UpdateUser(r.Context(), user)
 		if err != nil {
@@ -353,10 +399,7 @@ func Authentication(w http.ResponseWriter, r *http.Request) {
 	// Validate the user's password
 	err = bcrypt.CompareHashAndPassword([]byte(user.HashedPassphrase), []byte(authReq.Passphrase))
 	if err != nil {
-		user.FailCount++
-		if user.FailCount > 3 {
-			user.Suspended = true
-		}
+		registerAuthenticationFailure(r, "auth.login", settings, user)
 		helper.WriteHTTPResponse(r.Context(), w, http.StatusUnauthorized, "email or passphrase not match", nil, nil)
 		err = UserRepo.UpdateUser(r.Context(), user)
 		if err != nil {
@@ -369,6 +412,7 @@ func Authentication(w http.ResponseWriter, r *http.Request) {
 		user.Token2FA = helper.MakeRandomString(16, true, true, true, false)
 		ret := make(map[string]string)
 		ret["2FA_token"] = user.Token2FA
+		events.Publish(r.Context(), &events.LoginChallenged{User: user, Email: user.Email, Method: "auth.2fa_challenge"})
 		helper.WriteHTTPResponse(r.Context(), w, http.StatusAccepted, "2FA needed", nil, ret)
 		err = UserRepo.UpdateUser(r.Context(), user)
 		if err != nil {
@@ -415,13 +459,14 @@ func Authentication(w http.ResponseWriter, r *http.Request) {
 	// Set the audience
 	audience := roles
 
-	access, refresh, err := TokenFactory.CreateTokenPair(subject, audience, nil)
+	access, refresh, err := createTokenPair(settings, subject, audience, userAttributeClaims(r.Context(), user))
 
 	resp := &Response{
 		AccessToken:  access,
 		RefreshToken: refresh,
 	}
 
+	events.Publish(r.Context(), &events.LoginSucceeded{User: user, Email: user.Email, Method: "auth.login"})
 	helper.WriteHTTPResponse(r.Context(), w, http.StatusOK, "Successful", nil, resp)
 	err = UserRepo.UpdateUser(r.Context(), user)
 	if err != nil {
@@ -447,19 +492,26 @@ func Refresh(w http.ResponseWriter, r *http.Request) {
 	token := strings.TrimSpace(auth[7:])
 
 	ht, err := TokenFactory.ReadToken(token)
+	if err != nil {
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusUnauthorized, err.Error(), nil, nil)
+		return
+	}
 	revoked, err := RevocationRepo.IsRevoked(r.Context(), ht.Subject)
 	if err != nil || revoked {
+		events.Publish(r.Context(), &events.LoginFailed{Email: ht.Subject, Method: "auth.refresh", Outcome: events.LoginDenied})
 		helper.WriteHTTPResponse(r.Context(), w, http.StatusForbidden, "your access been revoked, please authenticate again", nil, nil)
 		return
 	}
 
 	access, err := TokenFactory.RefreshToken(token)
 	if err != nil {
+		events.Publish(r.Context(), &events.LoginFailed{Email: ht.Subject, Method: "auth.refresh", Outcome: events.LoginFailure})
 		helper.WriteHTTPResponse(r.Context(), w, http.StatusForbidden, err.Error(), nil, nil)
 		return
 	}
 
 	resp := &RefreshResponse{AccessToken: access}
+	events.Publish(r.Context(), &events.LoginSucceeded{Email: ht.Subject, Method: "auth.refresh"})
 
 	helper.WriteHTTPResponse(r.Context(), w, 200, "access Token refreshed", nil, resp)
 }
@@ -0,0 +1,61 @@
+package endpoint
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/hyperjumptech/hansip/internal/connector"
+	"github.com/hyperjumptech/hansip/internal/events"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// emailUserRepo finds the users it is given by their email and accepts their updates
+type emailUserRepo struct {
+	connector.UserRepository
+	users map[string]*connector.User
+}
+
+func (r *emailUserRepo) GetUserByEmail(ctx context.Context, email string) (*connector.User, error) {
+	if user, ok := r.users[email]; ok {
+		return user, nil
+	}
+	return nil, &connector.ErrDBNoResult{Message: "no user"}
+}
+
+func (r *emailUserRepo) UpdateUser(ctx context.Context, user *connector.User) error {
+	return nil
+}
+
+func TestAuthentication2FAChallenge(t *testing.T) {
+	defer func(bus *events.Bus) {
+		events.Default = bus
+		UserRepo = nil
+	}(events.Default)
+	hashed, err := bcrypt.GenerateFromPassword([]byte("open sesame"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	john := &connector.User{RecID: "john", Email: "john@acme.com", HashedPassphrase: string(hashed), Enabled: true, Enable2FactorAuth: true}
+	UserRepo = &emailUserRepo{users: map[string]*connector.User{john.Email: john}}
+	published := make([]string, 0)
+	events.Default = events.NewBus()
+	for _, eventType := range []string{events.TypeLoginSucceeded, events.TypeLoginChallenged, events.TypeLoginFailed} {
+		events.Subscribe(eventType, func(ctx context.Context, event events.Event) {
+			published = append(published, event.EventType())
+		})
+	}
+
+	r := httptest.NewRequest(http.MethodPost, "/api/v1/auth/authenticate", strings.NewReader(`{"email":"john@acme.com","passphrase":"open sesame"}`))
+	r.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	Authentication(w, r)
+	if w.Code != http.StatusAccepted || john.Token2FA == "" {
+		t.Fatalf("expect 2FA needed but got %d %s", w.Code, w.Body.String())
+	}
+	if strings.Join(published, ",") != events.TypeLoginChallenged {
+		t.Errorf("expect only %s before the second factor but got %v", events.TypeLoginChallenged, published)
+	}
+}
@@ -1,8 +1,11 @@
 package endpoint
 
 import (
+	"context"
 	"net/http"
 	"strings"
+
+	"github.com/hyperjumptech/hansip/internal/constants"
 )
 
 var (
@@ -17,7 +20,7 @@ var (
 func ClientIPResolverMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		ForwardedHeader := r.Header.Get(ForwardedForHeader)
-		if len(ForwardedForHeader) > 0 {
+		if len(ForwardedHeader) > 0 {
 			r.RemoteAddr = ForwardedHeader
 		} else {
 			RealHeader := r.Header.Get(RealIPHeader)
@@ -29,6 +32,6 @@ func ClientIPResolverMiddleware(next http.Handler) http.Handler {
 				r.RemoteAddr = RealHeader[:i]
 			}
 		}
-		next.ServeHTTP(w, r)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), constants.ClientIP, clientIP(r))))
 	})
 }
@@ -0,0 +1,141 @@
+package endpoint
+
+import (
+	"context"
+
+	"github.com/hyperjumptech/hansip/internal/config"
+	"github.com/hyperjumptech/hansip/internal/connector"
+	"github.com/hyperjumptech/hansip/internal/constants"
+	"github.com/hyperjumptech/hansip/internal/hansipcontext"
+	"github.com/hyperjumptech/hansip/pkg/helper"
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	scopeLog = log.WithField("go", "DelegatedScope")
+
+	// readScopes are the scopes allowed to read management records, every delegated scope may look up
+	// the records it works with and the auditor reads everything.
+	readScopes = hansipcontext.Scopes
+)
+
+// isPrivilegedRole returns true if holding the role grants management rights, that is the admin role
+// or one of the delegated scopes. Only admins may grant such roles, so delegation can not escalate itself.
+func isPrivilegedRole(roleName string) bool {
+	return roleName == config.Get("hansip.admin") || hansipcontext.IsScope(roleName)
+}
+
+// canAssignRole check if the caller may create, change or assign the role to users and groups
+func canAssignRole(authCtx *hansipcontext.AuthenticationContext, roleName, roleDomain string) bool {
+	if isPrivilegedRole(roleName) {
+		return authCtx.IsAdminOfDomain(roleDomain)
+	}
+	return authCtx.HasScopeOfDomain(roleDomain, hansipcontext.ScopeRoleManager)
+}
+
+// canJoinGroup check if the caller may change the group or its members.
+// Joining a group that carries a privileged role grants that role, so such group is left to the admins.
+func canJoinGroup(ctx context.Context, authCtx *hansipcontext.AuthenticationContext, group *connector.Group) bool {
+	if authCtx.IsAdminOfDomain(group.GroupDomain) {
+		return true
+	}
+	if !authCtx.HasScopeOfDomain(group.GroupDomain, hansipcontext.ScopeGroupManager) {
+		return false
+	}
+	privileged := false
+	err := allPages(func(request *helper.PageRequest) (int, *helper.Page, error) {
+		roles, page, err := GroupRoleRepo.ListGroupRoleByGroup(ctx, group, request)
+		for _, role := range roles {
+			if isPrivilegedRole(role.RoleName) && !authCtx.IsAdminOfDomain(role.RoleDomain) {
+				privileged = true
+			}
+		}
+		return len(roles), page, err
+	})
+	if err != nil {
+		scopeLog.WithField("func", "canJoinGroup").WithField("RequestID", ctx.Value(constants.RequestID)).Errorf("GroupRoleRepo.ListGroupRoleByGroup got %s", err.Error())
+		return false
+	}
+	return !privileged
+}
+
+// canAssignUserRoles check if the caller may assign every role the user directly holds, which is required
+// before replacing or removing all of them.
+func canAssignUserRoles(ctx context.Context, authCtx *hansipcontext.AuthenticationContext, user *connector.User) bool {
+	allowed := true
+	err := allPages(func(request *helper.PageRequest) (int, *helper.Page, error) {
+		roles, page, err := UserRoleRepo.ListUserRoleByUser(ctx, user, request)
+		for _, role := range roles {
+			if !canAssignRole(authCtx, role.RoleName, role.RoleDomain) {
+				allowed = false
+			}
+		}
+		return len(roles), page, err
+	})
+	if err != nil {
+		scopeLog.WithField("func", "canAssignUserRoles").WithField("RequestID", ctx.Value(constants.RequestID)).Errorf("UserRoleRepo.ListUserRoleByUser got %s", err.Error())
+		return false
+	}
+	return allowed
+}
+
+// canJoinUserGroups check if the caller may change every group the user is member of, which is required
+// before replacing or leaving all of them.
+func canJoinUserGroups(ctx context.Context, authCtx *hansipcontext.AuthenticationContext, user *connector.User) bool {
+	groups := make([]*connector.Group, 0)
+	err := allPages(func(request *helper.PageRequest) (int, *helper.Page, error) {
+		page, pageInfo, err := UserGroupRepo.ListUserGroupByUser(ctx, user, request)
+		groups = append(groups, page...)
+		return len(page), pageInfo, err
+	})
+	if err != nil {
+		scopeLog.WithField("func", "canJoinUserGroups").WithField("RequestID", ctx.Value(constants.RequestID)).Errorf("UserGroupRepo.ListUserGroupByUser got %s", err.Error())
+		return false
+	}
+	for _, group := range groups {
+		if !canJoinGroup(ctx, authCtx, group) {
+			return false
+		}
+	}
+	return true
+}
+
+// isPrivilegedUserOutOf returns true if the user holds, directly or through groups, a privileged role
+// on a domain the caller is not an admin of. Such user may only be changed by those admins.
+func isPrivilegedUserOutOf(ctx context.Context, authCtx *hansipcontext.AuthenticationContext, user *connector.User) bool {
+	privileged := false
+	err := allPages(func(request *helper.PageRequest) (int, *helper.Page, error) {
+		roles, page, err := UserRepo.ListAllUserRoles(ctx, user, request)
+		for _, role := range roles {
+			if isPrivilegedRole(role.RoleName) && !authCtx.IsAdminOfDomain(role.RoleDomain) {
+				privileged = true
+			}
+		}
+		return len(roles), page, err
+	})
+	if err != nil {
+		scopeLog.WithField("func", "isPrivilegedUserOutOf").WithField("RequestID", ctx.Value(constants.RequestID)).Errorf("UserRepo.ListAllUserRoles got %s", err.Error())
+		return true
+	}
+	return privileged
+}
+
+// canAssignGroupRoles check if the caller may assign every role the group holds, which is required
+// before replacing or removing all of them.
+func canAssignGroupRoles(ctx context.Context, authCtx *hansipcontext.AuthenticationContext, group *connector.Group) bool {
+	allowed := true
+	err := allPages(func(request *helper.PageRequest) (int, *helper.Page, error) {
+		roles, page, err := GroupRoleRepo.ListGroupRoleByGroup(ctx, group, request)
+		for _, role := range roles {
+			if !canAssignRole(authCtx, role.RoleName, role.RoleDomain) {
+				allowed = false
+			}
+		}
+		return len(roles), page, err
+	})
+	if err != nil {
+		scopeLog.WithField("func", "canAssignGroupRoles").WithField("RequestID", ctx.Value(constants.RequestID)).Errorf("GroupRoleRepo.ListGroupRoleByGroup got %s", err.Error())
+		return false
+	}
+	return allowed
+}
@@ -0,0 +1,63 @@
+package endpoint
+
+import (
+	"testing"
+
+	"github.com/hyperjumptech/hansip/internal/hansipcontext"
+)
+
+func TestHasScopeOfDomain(t *testing.T) {
+	authCtx := &hansipcontext.AuthenticationContext{
+		Audience: []string{"user-manager@acme.com", "auditor@hansip", "admin@other.com", "developer@acme.com"},
+	}
+	testData := []struct {
+		domain string
+		scopes []string
+		expect bool
+	}{
+		{"acme.com", []string{hansipcontext.ScopeUserManager}, true},
+		{"acme.com", []string{hansipcontext.ScopeGroupManager}, false},
+		{"acme.com", []string{hansipcontext.ScopeGroupManager, hansipcontext.ScopeUserManager}, true},
+		{"other.com", []string{hansipcontext.ScopeRoleManager}, true},
+		{"other.com", nil, true},
+		{"acme.com", nil, false},
+		{"third.com", []string{hansipcontext.ScopeAuditor}, true},
+		{"third.com", []string{hansipcontext.ScopeUserManager}, false},
+	}
+	for i, td := range testData {
+		if got := authCtx.HasScopeOfDomain(td.domain, td.scopes...); got != td.expect {
+			t.Errorf("#%d expect %v but %v", i, td.expect, got)
+		}
+	}
+	if !authCtx.HasAnyScope(hansipcontext.ScopeGroupManager) {
+		t.Errorf("admin of other.com should count as having any scope")
+	}
+	if (&hansipcontext.AuthenticationContext{Audience: []string{"developer@acme.com"}}).HasAnyScope(readScopes...) {
+		t.Errorf("plain role should not count as a scope")
+	}
+}
+
+func TestCanAssignRole(t *testing.T) {
+	roleManager := &hansipcontext.AuthenticationContext{Audience: []string{"role-manager@acme.com"}}
+	admin := &hansipcontext.AuthenticationContext{Audience: []string{"admin@acme.com"}}
+	testData := []struct {
+		authCtx *hansipcontext.AuthenticationContext
+		role    string
+		domain  string
+		expect  bool
+	}{
+		{roleManager, "developer", "acme.com", true},
+		{roleManager, "developer", "other.com", false},
+		{roleManager, "admin", "acme.com", false},
+		{roleManager, "user-manager", "acme.com", false},
+		{roleManager, "role-manager", "acme.com", false},
+		{admin, "developer", "acme.com", true},
+		{admin, "auditor", "acme.com", true},
+		{admin, "admin", "other.com", false},
+	}
+	for i, td := range testData {
+		if got := canAssignRole(td.authCtx, td.role, td.domain); got != td.expect {
+			t.Errorf("#%d expect %v but %v", i, td.expect, got)
+		}
+	}
+}
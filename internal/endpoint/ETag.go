@@ -0,0 +1,54 @@
+package endpoint
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/hyperjumptech/hansip/internal/config"
+	"github.com/hyperjumptech/hansip/internal/connector"
+	"github.com/hyperjumptech/hansip/pkg/helper"
+)
+
+// entityTag returns the strong ETag of a record at the given version
+func entityTag(recID string, version int) string {
+	return fmt.Sprintf(`"%s-%d"`, recID, version)
+}
+
+// etagHeader returns the response header carrying the ETag of a record
+func etagHeader(recID string, version int) map[string]string {
+	return map[string]string{"ETag": entityTag(recID, version)}
+}
+
+// checkIfMatch verifies the If-Match precondition of the request against the current version of the record.
+// If the precondition fails, it writes the error response and returns false.
+func checkIfMatch(w http.ResponseWriter, r *http.Request, recID string, version int) bool {
+	ifMatch := strings.TrimSpace(r.Header.Get("If-Match"))
+	if len(ifMatch) == 0 {
+		if config.GetBoolean("server.http.ifmatch.required") {
+			helper.WriteHTTPResponse(r.Context(), w, http.StatusPreconditionRequired, "If-Match header is required", nil, nil)
+			return false
+		}
+		return true
+	}
+	current := entityTag(recID, version)
+	for _, tag := range strings.Split(ifMatch, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" || tag == current {
+			return true
+		}
+	}
+	helper.WriteHTTPResponse(r.Context(), w, http.StatusPreconditionFailed, "The resource has been modified, fetch it again before changing", etagHeader(recID, version), nil)
+	return false
+}
+
+// updateErrorStatus returns the http status to respond when updating a record failed.
+// a record changed by someone else in the mean time fails the precondition.
+func updateErrorStatus(err error) int {
+	var conflict *connector.ErrDBConflict
+	if errors.As(err, &conflict) {
+		return http.StatusPreconditionFailed
+	}
+	return http.StatusInternalServerError
+}
@@ -0,0 +1,56 @@
+package endpoint
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/hyperjumptech/hansip/internal/config"
+	"github.com/hyperjumptech/hansip/internal/connector"
+)
+
+func TestCheckIfMatch(t *testing.T) {
+	testData := []struct {
+		ifMatch  string
+		required string
+		pass     bool
+		status   int
+	}{
+		{"", "false", true, 0},
+		{"", "true", false, http.StatusPreconditionRequired},
+		{`"abc-3"`, "false", true, 0},
+		{`"abc-2", "abc-3"`, "true", true, 0},
+		{"*", "true", true, 0},
+		{`"abc-2"`, "false", false, http.StatusPreconditionFailed},
+		{`W/"abc-3"`, "false", false, http.StatusPreconditionFailed},
+	}
+	defer config.Set("server.http.ifmatch.required", "false")
+	for i, td := range testData {
+		config.Set("server.http.ifmatch.required", td.required)
+		r := httptest.NewRequest(http.MethodPut, "/api/v1/management/user/abc", nil)
+		if len(td.ifMatch) > 0 {
+			r.Header.Set("If-Match", td.ifMatch)
+		}
+		w := httptest.NewRecorder()
+		if pass := checkIfMatch(w, r, "abc", 3); pass != td.pass {
+			t.Errorf("#%d expect pass %v but %v", i, td.pass, pass)
+		}
+		if !td.pass && w.Code != td.status {
+			t.Errorf("#%d expect status %d but %d", i, td.status, w.Code)
+		}
+		if w.Code == http.StatusPreconditionFailed && w.Header().Get("ETag") != `"abc-3"` {
+			t.Errorf("#%d expect current ETag but %s", i, w.Header().Get("ETag"))
+		}
+	}
+}
+
+func TestUpdateErrorStatus(t *testing.T) {
+	conflict := fmt.Errorf("wrapped %w", &connector.ErrDBConflict{Message: "changed"})
+	if updateErrorStatus(conflict) != http.StatusPreconditionFailed {
+		t.Errorf("expect conflict to fail the precondition")
+	}
+	if updateErrorStatus(fmt.Errorf("db down")) != http.StatusInternalServerError {
+		t.Errorf("expect other error to be server error")
+	}
+}
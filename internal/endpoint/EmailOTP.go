@@ -0,0 +1,330 @@
+package endpoint
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hyperjumptech/hansip/internal/config"
+	"github.com/hyperjumptech/hansip/internal/connector"
+	"github.com/hyperjumptech/hansip/internal/constants"
+	"github.com/hyperjumptech/hansip/internal/hansipcontext"
+	"github.com/hyperjumptech/hansip/internal/mailer"
+	"github.com/hyperjumptech/hansip/pkg/helper"
+	"github.com/hyperjumptech/jiffy"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// EmailOTPTemplate is the template of the email carrying a one time code
+	EmailOTPTemplate = "EMAIL_OTP"
+
+	// emailOTPDigits is the length of the one time codes
+	emailOTPDigits = 6
+)
+
+var (
+	emailOTPLog = log.WithField("go", "EmailOTP")
+)
+
+// emailOTPMail is the data of the email carrying a one time code
+type emailOTPMail struct {
+	Email   string
+	Code    string
+	Minutes int
+}
+
+// EmailOTPRequest model for requesting a one time code by email to complete a 2FA authentication
+type EmailOTPRequest struct {
+	Token string `json:"2FA_token"`
+}
+
+// EmailOTPResponse tells when the code mailed expires and when another one may be requested
+type EmailOTPResponse struct {
+	ExpireAt    time.Time `json:"expire_at"`
+	ResendAfter time.Time `json:"resend_after"`
+}
+
+// emailOTPPolicy is how long a code is valid, how often it may be mailed and how many attempts it allows
+type emailOTPPolicy struct {
+	expiry      time.Duration
+	resend      time.Duration
+	maxAttempts int
+}
+
+// emailOTPPolicyOf returns the policy of the codes in the settings, the durations failing to parse fall back to the configured ones
+func emailOTPPolicyOf(settings config.Settings) *emailOTPPolicy {
+	duration := func(key string) time.Duration {
+		d, err := jiffy.DurationOf(settings.Get(key))
+		if err != nil || d <= 0 {
+			d, _ = jiffy.DurationOf(config.Get(key))
+		}
+		return d
+	}
+	policy := &emailOTPPolicy{
+		expiry:      duration("security.2fa.email.expiry"),
+		resend:      duration("security.2fa.email.resend"),
+		maxAttempts: settings.GetInt("security.2fa.email.maxattempts"),
+	}
+	if policy.maxAttempts < 1 {
+		policy.maxAttempts = 1
+	}
+	return policy
+}
+
+// makeEmailOTPCode returns a random code of emailOTPDigits digits
+func makeEmailOTPCode() (string, error) {
+	max := big.NewInt(1)
+	for i := 0; i < emailOTPDigits; i++ {
+		max.Mul(max, big.NewInt(10))
+	}
+	n, err := rand.Int(rand.Reader, max)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%0*d", emailOTPDigits, n), nil
+}
+
+// emailOTPHash returns the hex SHA-256 of the code, bound to the user and the purpose of the code
+func emailOTPHash(userRecID, purpose, code string) string {
+	sum := sha256.Sum256([]byte(userRecID + ":" + purpose + ":" + strings.TrimSpace(code)))
+	return hex.EncodeToString(sum[:])
+}
+
+// emailOTPRetryAfter returns how long to wait before another code may be mailed, zero if it may be now
+func emailOTPRetryAfter(otp *connector.EmailOTP, policy *emailOTPPolicy, now time.Time) time.Duration {
+	if otp == nil {
+		return 0
+	}
+	next := otp.SentAt.Add(policy.resend)
+	if !now.Before(next) {
+		return 0
+	}
+	return next.Sub(now)
+}
+
+// emailOTPUsable check if the code may still be verified
+func emailOTPUsable(otp *connector.EmailOTP, policy *emailOTPPolicy, now time.Time) bool {
+	return now.Before(otp.ExpireAt) && otp.Attempts < policy.maxAttempts
+}
+
+// issueEmailOTP stores a new code for the purpose and mails it to the user, in the transaction of the context if any.
+// The code is not mailed and the time to wait is returned if the previous one was mailed less than the resend interval ago.
+func issueEmailOTP(ctx context.Context, user *connector.User, purpose string, now time.Time) (*EmailOTPResponse, time.Duration, error) {
+	tenant := userTenant(ctx, user)
+	settings := userSettings(ctx, user)
+	policy := emailOTPPolicyOf(settings)
+
+	previous, err := EmailOTPRepo.GetEmailOTP(ctx, user, purpose)
+	if _, none := err.(*connector.ErrDBNoResult); err != nil && !none {
+		return nil, 0, err
+	}
+	if wait := emailOTPRetryAfter(previous, policy, now); wait > 0 {
+		return nil, wait, nil
+	}
+
+	code, err := makeEmailOTPCode()
+	if err != nil {
+		return nil, 0, err
+	}
+	otp := &connector.EmailOTP{
+		UserRecID: user.RecID,
+		Purpose:   purpose,
+		CodeHash:  emailOTPHash(user.RecID, purpose, code),
+		ExpireAt:  now.Add(policy.expiry),
+		SentAt:    now,
+	}
+	if err := EmailOTPRepo.SaveEmailOTP(ctx, otp); err != nil {
+		return nil, 0, err
+	}
+	err = mailer.Send(ctx, &mailer.Email{
+		From:     settings.Get("mailer.from"),
+		FromName: settings.Get("mailer.from.name"),
+		To:       []string{user.Email},
+		Template: EmailOTPTemplate,
+		Data: &emailOTPMail{
+			Email:   user.Email,
+			Code:    code,
+			Minutes: int(policy.expiry.Round(time.Minute) / time.Minute),
+		},
+		Settings: settings,
+		Tenant:   tenant,
+		Locale:   user.Locale,
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	return &EmailOTPResponse{
+		ExpireAt:    otp.ExpireAt,
+		ResendAfter: otp.SentAt.Add(policy.resend),
+	}, 0, nil
+}
+
+// verifyEmailOTP check the code mailed to the user for the purpose. Every check counts as an attempt.
+// The code is deleted once verified, so it is used only once, or once expired or out of attempts.
+func verifyEmailOTP(ctx context.Context, user *connector.User, purpose, code string, now time.Time) (bool, error) {
+	otp, err := EmailOTPRepo.GetEmailOTP(ctx, user, purpose)
+	if _, none := err.(*connector.ErrDBNoResult); none {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	policy := emailOTPPolicyOf(userSettings(ctx, user))
+	if !emailOTPUsable(otp, policy, now) {
+		return false, EmailOTPRepo.DeleteEmailOTP(ctx, user, purpose)
+	}
+	// the attempt is counted before the code is compared, so concurrent guesses can not exceed the limit
+	ok, err := EmailOTPRepo.ConsumeEmailOTPAttempt(ctx, otp, policy.maxAttempts)
+	if err != nil || !ok {
+		return false, err
+	}
+	if subtle.ConstantTimeCompare([]byte(otp.CodeHash), []byte(emailOTPHash(user.RecID, purpose, code))) != 1 {
+		if otp.Attempts >= policy.maxAttempts {
+			return false, EmailOTPRepo.DeleteEmailOTP(ctx, user, purpose)
+		}
+		return false, nil
+	}
+	return true, EmailOTPRepo.DeleteEmailOTP(ctx, user, purpose)
+}
+
+// writeEmailOTPResponse responds the expiry of the code mailed, or 429 with Retry-After if another may not be mailed yet
+func writeEmailOTPResponse(w http.ResponseWriter, r *http.Request, resp *EmailOTPResponse, wait time.Duration) {
+	if wait > 0 {
+		seconds := int((wait + time.Second - 1) / time.Second)
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusTooManyRequests, fmt.Sprintf("a code was sent recently, retry in %d seconds", seconds), map[string]string{"Retry-After": strconv.Itoa(seconds)}, nil)
+		return
+	}
+	helper.WriteHTTPResponse(r.Context(), w, http.StatusOK, "Check your email", nil, resp)
+}
+
+// RequestEmailOTP serving request to mail a one time code to the user authenticating with 2FA by email,
+// the code is then sent as the 2FA_otp of the TwoFA request
+func RequestEmailOTP(w http.ResponseWriter, r *http.Request) {
+	fLog := emailOTPLog.WithField("func", "RequestEmailOTP").WithField("RequestID", r.Context().Value(constants.RequestID)).WithField("path", r.URL.Path).WithField("method", r.Method)
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusInternalServerError, err.Error(), nil, nil)
+		return
+	}
+	req := &EmailOTPRequest{}
+	if err := json.Unmarshal(body, req); err != nil {
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusBadRequest, err.Error(), nil, nil)
+		return
+	}
+	if len(req.Token) == 0 {
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusBadRequest, "2FA_token is required", nil, nil)
+		return
+	}
+	user, err := UserRepo.GetUserBy2FAToken(r.Context(), req.Token)
+	if err != nil || user == nil || !user.Enable2FactorAuth {
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusNotFound, "2FA token not found", nil, nil)
+		return
+	}
+	if !user.Enabled || user.Suspended {
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusForbidden, "account disabled or suspended", nil, nil)
+		return
+	}
+	if !user.Enable2FactorEmail {
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusForbidden, "2FA by email is not activated", nil, nil)
+		return
+	}
+	resp, wait, err := issueEmailOTP(r.Context(), user, connector.EmailOTPLogin, time.Now())
+	if err != nil {
+		fLog.Errorf("issueEmailOTP got %s", err.Error())
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusInternalServerError, err.Error(), nil, nil)
+		return
+	}
+	writeEmailOTPResponse(w, r, resp, wait)
+}
+
+// Send2FAEmailActivation serving request to mail a one time code to the authenticated user,
+// proving the user reads the mailbox before activating the email second factor
+func Send2FAEmailActivation(w http.ResponseWriter, r *http.Request) {
+	fLog := emailOTPLog.WithField("func", "Send2FAEmailActivation").WithField("RequestID", r.Context().Value(constants.RequestID)).WithField("path", r.URL.Path).WithField("method", r.Method)
+	authCtx := r.Context().Value(constants.HansipAuthentication).(*hansipcontext.AuthenticationContext)
+	user, err := UserRepo.GetUserByEmail(r.Context(), authCtx.Subject)
+	if err != nil {
+		fLog.Errorf("UserRepo.GetUserByEmail got %s", err.Error())
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusNotFound, err.Error(), nil, fmt.Sprintf("subject not found : %s. got %s", authCtx.Subject, err.Error()))
+		return
+	}
+	resp, wait, err := issueEmailOTP(r.Context(), user, connector.EmailOTPActivation, time.Now())
+	if err != nil {
+		fLog.Errorf("issueEmailOTP got %s", err.Error())
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusInternalServerError, err.Error(), nil, nil)
+		return
+	}
+	writeEmailOTPResponse(w, r, resp, wait)
+}
+
+// Activate2FAEmail handle the activation of 2FA with the code mailed by Send2FAEmailActivation,
+// for users having no authenticator app. It responds the recovery codes like Activate2FA.
+// The TwoFA codes of the user are then the mailed ones, until the authenticator app is activated again.
+func Activate2FAEmail(w http.ResponseWriter, r *http.Request) {
+	fLog := emailOTPLog.WithField("func", "Activate2FAEmail").WithField("RequestID", r.Context().Value(constants.RequestID)).WithField("path", r.URL.Path).WithField("method", r.Method)
+	authCtx := r.Context().Value(constants.HansipAuthentication).(*hansipcontext.AuthenticationContext)
+	user, err := UserRepo.GetUserByEmail(r.Context(), authCtx.Subject)
+	if err != nil {
+		fLog.Errorf("UserRepo.GetUserByEmail got %s", err.Error())
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusNotFound, err.Error(), nil, fmt.Sprintf("subject not found : %s. got %s", authCtx.Subject, err.Error()))
+		return
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		fLog.Errorf("ioutil.ReadAll got %s", err.Error())
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusInternalServerError, err.Error(), nil, nil)
+		return
+	}
+	c := &Activate2FARequest{}
+	err = json.Unmarshal(body, c)
+	if err != nil {
+		fLog.Errorf("json.Unmarshal got %s", err.Error())
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusBadRequest, "Malformed json body", nil, nil)
+		return
+	}
+	valid, err := verifyEmailOTP(r.Context(), user, connector.EmailOTPActivation, c.Token, time.Now())
+	if err != nil {
+		fLog.Errorf("verifyEmailOTP got %s", err.Error())
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusInternalServerError, err.Error(), nil, nil)
+		return
+	}
+	if !valid {
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusUnauthorized, "Invalid OTP", nil, nil)
+		return
+	}
+	// the code is verified outside of any transaction, so a wrong guess counts even though the request fails
+	var codes []string
+	err = inTransaction(r.Context(), func(ctx context.Context) error {
+		codes, err = UserRepo.RecreateTOTPRecoveryCodes(ctx, user)
+		if err != nil {
+			fLog.Errorf("UserRepo.RecreateTOTPRecoveryCodes got %s", err.Error())
+			return err
+		}
+		before := *user
+		user.Enable2FactorAuth = true
+		user.Enable2FactorEmail = true
+		err = UserRepo.UpdateUser(ctx, user)
+		if err != nil {
+			fLog.Errorf("UserRepo.UpdateUser got %s", err.Error())
+			return err
+		}
+		auditUser(r.WithContext(ctx), "user.2fa.email.activate", user, &before, user)
+		return nil
+	})
+	if err != nil {
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusInternalServerError, err.Error(), nil, nil)
+		return
+	}
+	helper.WriteHTTPResponse(r.Context(), w, http.StatusOK, "2FA Activated", nil, &Activate2FAResponse{Codes: codes})
+}
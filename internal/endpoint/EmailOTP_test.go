@@ -0,0 +1,233 @@
+package endpoint
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hyperjumptech/hansip/internal/config"
+	"github.com/hyperjumptech/hansip/internal/connector"
+	"github.com/hyperjumptech/hansip/internal/constants"
+	"github.com/hyperjumptech/hansip/internal/hansipcontext"
+	"github.com/hyperjumptech/hansip/internal/mailer"
+	"github.com/hyperjumptech/hansip/pkg/totp"
+)
+
+// memoryEmailOTPs keeps the codes in memory by user and purpose
+type memoryEmailOTPs struct {
+	connector.EmailOTPRepository
+	codes map[string]*connector.EmailOTP
+}
+
+func (r *memoryEmailOTPs) GetEmailOTP(ctx context.Context, user *connector.User, purpose string) (*connector.EmailOTP, error) {
+	if otp, ok := r.codes[user.RecID+":"+purpose]; ok {
+		return otp, nil
+	}
+	return nil, &connector.ErrDBNoResult{Message: "no code"}
+}
+
+func (r *memoryEmailOTPs) ConsumeEmailOTPAttempt(ctx context.Context, otp *connector.EmailOTP, maxAttempts int) (bool, error) {
+	if otp.Attempts >= maxAttempts {
+		return false, nil
+	}
+	otp.Attempts++
+	return true, nil
+}
+
+func (r *memoryEmailOTPs) DeleteEmailOTP(ctx context.Context, user *connector.User, purpose string) error {
+	delete(r.codes, user.RecID+":"+purpose)
+	return nil
+}
+
+func TestMakeEmailOTPCode(t *testing.T) {
+	seen := make(map[string]bool)
+	for i := 0; i < 20; i++ {
+		code, err := makeEmailOTPCode()
+		if err != nil {
+			t.Fatalf("got %s", err.Error())
+		}
+		if len(code) != emailOTPDigits || strings.Trim(code, "0123456789") != "" {
+			t.Fatalf("expect %d digits but got %s", emailOTPDigits, code)
+		}
+		seen[code] = true
+	}
+	if len(seen) < 2 {
+		t.Errorf("codes should be random")
+	}
+}
+
+func TestEmailOTPHash(t *testing.T) {
+	hash := emailOTPHash("user-1", connector.EmailOTPLogin, "123456")
+	if hash != emailOTPHash("user-1", connector.EmailOTPLogin, " 123456 ") {
+		t.Errorf("spaces around the code should be ignored")
+	}
+	if hash == emailOTPHash("user-2", connector.EmailOTPLogin, "123456") {
+		t.Errorf("hash should be bound to the user")
+	}
+	if hash == emailOTPHash("user-1", connector.EmailOTPActivation, "123456") {
+		t.Errorf("hash should be bound to the purpose")
+	}
+	if hash == emailOTPHash("user-1", connector.EmailOTPLogin, "123457") {
+		t.Errorf("hash should differ for another code")
+	}
+}
+
+func TestEmailOTPPolicyOf(t *testing.T) {
+	policy := emailOTPPolicyOf(config.Settings{
+		"security.2fa.email.expiry":      "10 minutes",
+		"security.2fa.email.resend":      "soon",
+		"security.2fa.email.maxattempts": "0",
+	})
+	if policy.expiry != 10*time.Minute {
+		t.Errorf("expect expiry of 10 minutes but %s", policy.expiry)
+	}
+	if policy.resend != time.Minute {
+		t.Errorf("invalid resend should fall back to the configured 60 seconds but %s", policy.resend)
+	}
+	if policy.maxAttempts != 1 {
+		t.Errorf("expect at least 1 attempt but %d", policy.maxAttempts)
+	}
+}
+
+func TestEmailOTPRetryAfter(t *testing.T) {
+	policy := &emailOTPPolicy{expiry: 5 * time.Minute, resend: time.Minute, maxAttempts: 3}
+	now := time.Date(2020, 3, 1, 10, 0, 0, 0, time.UTC)
+	if wait := emailOTPRetryAfter(nil, policy, now); wait != 0 {
+		t.Errorf("first code should be sent now but wait %s", wait)
+	}
+	otp := &connector.EmailOTP{SentAt: now.Add(-20 * time.Second)}
+	if wait := emailOTPRetryAfter(otp, policy, now); wait != 40*time.Second {
+		t.Errorf("expect to wait 40s but %s", wait)
+	}
+	otp.SentAt = now.Add(-time.Minute)
+	if wait := emailOTPRetryAfter(otp, policy, now); wait != 0 {
+		t.Errorf("code should be sent again now but wait %s", wait)
+	}
+}
+
+func TestEmailOTPUsable(t *testing.T) {
+	policy := &emailOTPPolicy{expiry: 5 * time.Minute, resend: time.Minute, maxAttempts: 3}
+	now := time.Date(2020, 3, 1, 10, 0, 0, 0, time.UTC)
+	otp := &connector.EmailOTP{ExpireAt: now.Add(time.Minute), Attempts: 2}
+	if !emailOTPUsable(otp, policy, now) {
+		t.Errorf("code should be usable")
+	}
+	otp.Attempts = 3
+	if emailOTPUsable(otp, policy, now) {
+		t.Errorf("code out of attempts should not be usable")
+	}
+	otp.Attempts = 0
+	otp.ExpireAt = now
+	if emailOTPUsable(otp, policy, now) {
+		t.Errorf("expired code should not be usable")
+	}
+}
+
+func TestEmailOTPTemplate(t *testing.T) {
+	templates := mailer.Templates[EmailOTPTemplate]
+	if templates == nil {
+		t.Fatalf("%s template not loaded", EmailOTPTemplate)
+	}
+	data := &emailOTPMail{Email: "john@example.com", Code: "042137", Minutes: 5}
+	body := &bytes.Buffer{}
+	if err := templates.BodyTemplate.Execute(body, data); err != nil {
+		t.Fatalf("body got %s", err.Error())
+	}
+	if !strings.Contains(body.String(), "042137") || !strings.Contains(body.String(), "5 minutes") {
+		t.Errorf("body should contain the code and its validity, got %s", body.String())
+	}
+}
+
+func TestVerify2FACode(t *testing.T) {
+	defer func() { EmailOTPRepo = nil }()
+	repo := &memoryEmailOTPs{codes: make(map[string]*connector.EmailOTP)}
+	EmailOTPRepo = repo
+	ctx := context.Background()
+	now := time.Now()
+	mail := func(user *connector.User) {
+		repo.codes[user.RecID+":"+connector.EmailOTPLogin] = &connector.EmailOTP{
+			UserRecID: user.RecID,
+			Purpose:   connector.EmailOTPLogin,
+			CodeHash:  emailOTPHash(user.RecID, connector.EmailOTPLogin, "123456"),
+			ExpireAt:  now.Add(time.Minute),
+			SentAt:    now,
+		}
+	}
+
+	john := &connector.User{RecID: "john", Enable2FactorAuth: true, UserTotpSecretKey: totp.MakeSecret().Base32()}
+	mail(john)
+	if valid, method, err := verify2FACode(ctx, john, "123456", now); err != nil || valid || method != "auth.2fa" {
+		t.Errorf("a user of the authenticator app should not sign in by a mailed code, got %v %s %v", valid, method, err)
+	}
+
+	jane := &connector.User{RecID: "jane", Enable2FactorAuth: true, Enable2FactorEmail: true, UserTotpSecretKey: totp.MakeSecret().Base32()}
+	mail(jane)
+	if valid, _, err := verify2FACode(ctx, jane, "654321", now); err != nil || valid {
+		t.Errorf("a wrong code should be rejected, got %v %v", valid, err)
+	}
+	if valid, method, err := verify2FACode(ctx, jane, "123456", now); err != nil || !valid || method != "auth.2fa_email" {
+		t.Errorf("expect jane signed in by the mailed code but got %v %s %v", valid, method, err)
+	}
+	if valid, _, err := verify2FACode(ctx, jane, "123456", now); err != nil || valid {
+		t.Errorf("a mailed code should be used once, got %v %v", valid, err)
+	}
+}
+
+// rollbackEmailOTPs undoes the changes made to the codes of its repository by a rolled back transaction
+type rollbackEmailOTPs struct {
+	repo *memoryEmailOTPs
+}
+
+func (tx *rollbackEmailOTPs) Transaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	codes := make(map[string]connector.EmailOTP)
+	for key, otp := range tx.repo.codes {
+		codes[key] = *otp
+	}
+	err := fn(context.WithValue(ctx, constants.Transaction, tx))
+	if err != nil {
+		tx.repo.codes = make(map[string]*connector.EmailOTP)
+		for key, otp := range codes {
+			otp := otp
+			tx.repo.codes[key] = &otp
+		}
+	}
+	return err
+}
+
+func TestActivate2FAEmailAttempts(t *testing.T) {
+	defer func() { EmailOTPRepo, UserRepo, TxRepo = nil, nil, nil }()
+	repo := &memoryEmailOTPs{codes: make(map[string]*connector.EmailOTP)}
+	EmailOTPRepo = repo
+	TxRepo = &rollbackEmailOTPs{repo: repo}
+	john := &connector.User{RecID: "john", Email: "john@acme.com"}
+	UserRepo = &emailUserRepo{users: map[string]*connector.User{john.Email: john}}
+	key := john.RecID + ":" + connector.EmailOTPActivation
+	repo.codes[key] = &connector.EmailOTP{
+		UserRecID: john.RecID,
+		Purpose:   connector.EmailOTPActivation,
+		CodeHash:  emailOTPHash(john.RecID, connector.EmailOTPActivation, "123456"),
+		ExpireAt:  time.Now().Add(time.Minute),
+		SentAt:    time.Now(),
+	}
+	var activate func(http.ResponseWriter, *http.Request)
+	for _, endpoint := range Endpoints {
+		if strings.HasSuffix(endpoint.PathPattern, "/management/user/activate2FAEmail") {
+			activate = endpoint.HandleFunction
+		}
+	}
+	authCtx := &hansipcontext.AuthenticationContext{Subject: john.Email}
+	r := httptest.NewRequest(http.MethodPost, "/api/v1/management/user/activate2FAEmail", strings.NewReader(`{"2FA_token":"654321"}`))
+	r = r.WithContext(context.WithValue(r.Context(), constants.HansipAuthentication, authCtx))
+	w := httptest.NewRecorder()
+	activate(w, r)
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("expect a wrong code unauthorized but got %d %s", w.Code, w.Body.String())
+	}
+	if otp, ok := repo.codes[key]; !ok || otp.Attempts != 1 {
+		t.Errorf("expect the failed attempt counted after the request failed, got %v", repo.codes[key])
+	}
+}
@@ -0,0 +1,403 @@
+package endpoint
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hyperjumptech/hansip/internal/connector"
+	"github.com/hyperjumptech/hansip/internal/constants"
+	"github.com/hyperjumptech/hansip/internal/hansipcontext"
+	"github.com/hyperjumptech/hansip/internal/mailer"
+	"github.com/hyperjumptech/hansip/pkg/helper"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// AuditTargetEmailTemplate audit events on the email templates of tenants
+	AuditTargetEmailTemplate = "email_template"
+)
+
+var (
+	emailTemplateLog = log.WithField("go", "EmailTemplate")
+)
+
+// EmailTemplateRequest hold model for changing or previewing an email template
+type EmailTemplateRequest struct {
+	Subject  string `json:"subject"`
+	Body     string `json:"body"`
+	TextBody string `json:"text_body"`
+}
+
+// EmailTemplateView is the template an email of a tenant is sent with.
+// Version 0 is the default template, from the tenant settings or the configuration.
+type EmailTemplateView struct {
+	TemplateKey string    `json:"template_key"`
+	Version     int       `json:"version"`
+	Subject     string    `json:"subject"`
+	Body        string    `json:"body"`
+	TextBody    string    `json:"text_body"`
+	CreatedBy   string    `json:"created_by,omitempty"`
+	CreatedAt   time.Time `json:"created_at,omitempty"`
+}
+
+// EmailPreview is an email rendered with sample data
+type EmailPreview struct {
+	TemplateKey string `json:"template_key"`
+	Subject     string `json:"subject"`
+	Body        string `json:"body"`
+	TextBody    string `json:"text_body"`
+}
+
+// emailTemplateView returns the view of a stored template version
+func emailTemplateView(tmpl *connector.EmailTemplate) *EmailTemplateView {
+	return &EmailTemplateView{
+		TemplateKey: tmpl.TemplateKey,
+		Version:     tmpl.Version,
+		Subject:     tmpl.Subject,
+		Body:        tmpl.Body,
+		TextBody:    tmpl.TextBody,
+		CreatedBy:   tmpl.CreatedBy,
+		CreatedAt:   tmpl.CreatedAt,
+	}
+}
+
+// sampleEmailData returns the data to preview the email of the key with, shaped like the data the email is sent with
+func sampleEmailData(key string, tenant *connector.Tenant) interface{} {
+	now := time.Now()
+	user := &connector.User{
+		RecID:          "sample-user-rec-id",
+		Email:          "jane.doe@example.com",
+		Enabled:        false,
+		ActivationCode: "SAMPLEACTIVATIONCODE",
+		RecoveryCode:   "SAMPLERECOVER",
+		TenantRecId:    tenant.RecID,
+	}
+	switch key {
+	case "INVITATION":
+		return &invitationMail{
+			Invitation: &connector.Invitation{
+				RecID:       "sample-invitation-rec-id",
+				Email:       user.Email,
+				TenantRecID: tenant.RecID,
+				Token:       "SAMPLEINVITATIONTOKEN",
+				GroupRecIDs: []string{},
+				RoleRecIDs:  []string{},
+				InvitedBy:   "admin@example.com",
+				CreatedAt:   now,
+				ExpireAt:    now.Add(72 * time.Hour),
+			},
+			TenantName:   tenant.Name,
+			TenantDomain: tenant.Domain,
+		}
+	case EmailOTPTemplate:
+		return &emailOTPMail{
+			Email:   user.Email,
+			Code:    "123456",
+			Minutes: 5,
+		}
+	default:
+		return user
+	}
+}
+
+// validateEmailTemplate parses the subject, body and text templates of the email of the key and executes them with sample data,
+// so a template referring to data the email does not have is rejected too
+func validateEmailTemplate(key string, req *EmailTemplateRequest, tenant *connector.Tenant) (*EmailPreview, error) {
+	if len(strings.TrimSpace(req.Subject)) == 0 {
+		return nil, fmt.Errorf("subject template is required")
+	}
+	if len(strings.TrimSpace(req.Body)) == 0 {
+		return nil, fmt.Errorf("body template is required")
+	}
+	templates, err := mailer.ParseTemplates(key, req.Subject, req.Body, req.TextBody)
+	if err != nil {
+		return nil, err
+	}
+	subject, body, text, err := templates.Execute(sampleEmailData(key, tenant))
+	if err != nil {
+		return nil, err
+	}
+	return &EmailPreview{TemplateKey: key, Subject: subject, Body: body, TextBody: text}, nil
+}
+
+// effectiveEmailTemplate returns the template the email of the key is sent with for the tenant,
+// the latest stored version or the default one
+func effectiveEmailTemplate(r *http.Request, tenant *connector.Tenant, key string) (*EmailTemplateView, error) {
+	tmpl, err := EmailTemplateRepo.GetEmailTemplate(r.Context(), tenant, key)
+	if err == nil {
+		return emailTemplateView(tmpl), nil
+	}
+	if _, none := err.(*connector.ErrDBNoResult); !none {
+		return nil, err
+	}
+	subject, body, text := mailer.ConfiguredTemplates(key, tenantSettings(r.Context(), tenant))
+	return &EmailTemplateView{TemplateKey: key, Subject: subject, Body: body, TextBody: text}, nil
+}
+
+// emailTemplateOfTenant loads the tenant of the request path the caller is admin of, and the template key of the path.
+// If it fails, it writes the error response and returns nil.
+func emailTemplateOfTenant(w http.ResponseWriter, r *http.Request, pathTemplate string) (*connector.Tenant, map[string]string) {
+	tenant, params := adminTenant(w, r, pathTemplate)
+	if tenant == nil {
+		return nil, nil
+	}
+	if !mailer.IsTemplateKey(params["templateKey"]) {
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusNotFound, fmt.Sprintf("email template %s not found, the templates are %v", params["templateKey"], mailer.TemplateKeys()), nil, nil)
+		return nil, nil
+	}
+	return tenant, params
+}
+
+// readEmailTemplateRequest reads the template in the request body, an empty body reads as an empty template.
+// If it fails, it writes the error response and returns nil.
+func readEmailTemplateRequest(w http.ResponseWriter, r *http.Request) *EmailTemplateRequest {
+	fLog := emailTemplateLog.WithField("func", "readEmailTemplateRequest").WithField("RequestID", r.Context().Value(constants.RequestID)).WithField("path", r.URL.Path).WithField("method", r.Method)
+	req := &EmailTemplateRequest{}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		fLog.Errorf("ioutil.ReadAll got %s", err.Error())
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusInternalServerError, err.Error(), nil, nil)
+		return nil
+	}
+	if len(strings.TrimSpace(string(body))) == 0 {
+		return req
+	}
+	err = json.Unmarshal(body, req)
+	if err != nil {
+		fLog.Errorf("json.Unmarshal got %s", err.Error())
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusBadRequest, err.Error(), nil, nil)
+		return nil
+	}
+	return req
+}
+
+// createEmailTemplateVersion validates and stores the template as the next version of the tenant template, then responds it.
+// before is the template replaced.
+func createEmailTemplateVersion(w http.ResponseWriter, r *http.Request, event string, tenant *connector.Tenant, key string, req *EmailTemplateRequest, before *EmailTemplateView) {
+	fLog := emailTemplateLog.WithField("func", "createEmailTemplateVersion").WithField("RequestID", r.Context().Value(constants.RequestID)).WithField("path", r.URL.Path).WithField("method", r.Method)
+	if _, err := validateEmailTemplate(key, req, tenant); err != nil {
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusBadRequest, err.Error(), nil, nil)
+		return
+	}
+	tmpl := &connector.EmailTemplate{
+		TenantRecID: tenant.RecID,
+		TemplateKey: key,
+		Subject:     req.Subject,
+		Body:        req.Body,
+		TextBody:    req.TextBody,
+	}
+	if authCtx, ok := r.Context().Value(constants.HansipAuthentication).(*hansipcontext.AuthenticationContext); ok {
+		tmpl.CreatedBy = authCtx.Subject
+	}
+	err := EmailTemplateRepo.CreateEmailTemplateVersion(r.Context(), tmpl)
+	if err != nil {
+		fLog.Errorf("EmailTemplateRepo.CreateEmailTemplateVersion got %s", err.Error())
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusInternalServerError, err.Error(), nil, nil)
+		return
+	}
+	after := emailTemplateView(tmpl)
+	auditEmailTemplate(r, event, tenant, key, before, after)
+	helper.WriteHTTPResponse(r.Context(), w, http.StatusOK, fmt.Sprintf("Email template %s version %d saved", key, tmpl.Version), etagHeader(key, tmpl.Version), after)
+}
+
+func auditEmailTemplate(r *http.Request, event string, tenant *connector.Tenant, key string, before, after interface{}) {
+	audit(r, &connector.AuditEvent{
+		Event:        event,
+		TargetType:   AuditTargetEmailTemplate,
+		Target:       key,
+		TenantDomain: tenant.Domain,
+	}, before, after)
+}
+
+// ListEmailTemplates serving request to list the templates every email of a tenant is sent with
+func ListEmailTemplates(w http.ResponseWriter, r *http.Request) {
+	fLog := emailTemplateLog.WithField("func", "ListEmailTemplates").WithField("RequestID", r.Context().Value(constants.RequestID)).WithField("path", r.URL.Path).WithField("method", r.Method)
+	tenant, _ := adminTenant(w, r, "/management/tenant/{tenantRecId}/email-templates")
+	if tenant == nil {
+		return
+	}
+	stored, err := EmailTemplateRepo.ListEmailTemplates(r.Context(), tenant)
+	if err != nil {
+		fLog.Errorf("EmailTemplateRepo.ListEmailTemplates got %s", err.Error())
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusInternalServerError, err.Error(), nil, nil)
+		return
+	}
+	latest := make(map[string]*connector.EmailTemplate)
+	for _, tmpl := range stored {
+		latest[tmpl.TemplateKey] = tmpl
+	}
+	settings := tenantSettings(r.Context(), tenant)
+	views := make([]*EmailTemplateView, 0)
+	for _, key := range mailer.TemplateKeys() {
+		if tmpl, ok := latest[key]; ok {
+			views = append(views, emailTemplateView(tmpl))
+			continue
+		}
+		subject, body, text := mailer.ConfiguredTemplates(key, settings)
+		views = append(views, &EmailTemplateView{TemplateKey: key, Subject: subject, Body: body, TextBody: text})
+	}
+	helper.WriteHTTPResponse(r.Context(), w, http.StatusOK, "List of email templates", nil, views)
+}
+
+// GetEmailTemplate serving request to get the template an email of a tenant is sent with
+func GetEmailTemplate(w http.ResponseWriter, r *http.Request) {
+	fLog := emailTemplateLog.WithField("func", "GetEmailTemplate").WithField("RequestID", r.Context().Value(constants.RequestID)).WithField("path", r.URL.Path).WithField("method", r.Method)
+	tenant, params := emailTemplateOfTenant(w, r, "/management/tenant/{tenantRecId}/email-template/{templateKey}")
+	if tenant == nil {
+		return
+	}
+	view, err := effectiveEmailTemplate(r, tenant, params["templateKey"])
+	if err != nil {
+		fLog.Errorf("EmailTemplateRepo.GetEmailTemplate got %s", err.Error())
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusInternalServerError, err.Error(), nil, nil)
+		return
+	}
+	helper.WriteHTTPResponse(r.Context(), w, http.StatusOK, "Email template retrieved", etagHeader(view.TemplateKey, view.Version), view)
+}
+
+// SetEmailTemplate serving request to save a new version of an email template of a tenant.
+// The templates must parse and execute with the data of the email.
+func SetEmailTemplate(w http.ResponseWriter, r *http.Request) {
+	fLog := emailTemplateLog.WithField("func", "SetEmailTemplate").WithField("RequestID", r.Context().Value(constants.RequestID)).WithField("path", r.URL.Path).WithField("method", r.Method)
+	tenant, params := emailTemplateOfTenant(w, r, "/management/tenant/{tenantRecId}/email-template/{templateKey}")
+	if tenant == nil {
+		return
+	}
+	key := params["templateKey"]
+	before, err := effectiveEmailTemplate(r, tenant, key)
+	if err != nil {
+		fLog.Errorf("EmailTemplateRepo.GetEmailTemplate got %s", err.Error())
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusInternalServerError, err.Error(), nil, nil)
+		return
+	}
+	if !checkIfMatch(w, r, key, before.Version) {
+		return
+	}
+	req := readEmailTemplateRequest(w, r)
+	if req == nil {
+		return
+	}
+	createEmailTemplateVersion(w, r, "email_template.update", tenant, key, req, before)
+}
+
+// DeleteEmailTemplate serving request to delete every version of an email template of a tenant,
+// the email is sent with the default template again
+func DeleteEmailTemplate(w http.ResponseWriter, r *http.Request) {
+	fLog := emailTemplateLog.WithField("func", "DeleteEmailTemplate").WithField("RequestID", r.Context().Value(constants.RequestID)).WithField("path", r.URL.Path).WithField("method", r.Method)
+	tenant, params := emailTemplateOfTenant(w, r, "/management/tenant/{tenantRecId}/email-template/{templateKey}")
+	if tenant == nil {
+		return
+	}
+	key := params["templateKey"]
+	before, err := EmailTemplateRepo.GetEmailTemplate(r.Context(), tenant, key)
+	if err != nil {
+		if _, none := err.(*connector.ErrDBNoResult); none {
+			helper.WriteHTTPResponse(r.Context(), w, http.StatusNotFound, fmt.Sprintf("tenant has no %s email template, the default one is used", key), nil, nil)
+			return
+		}
+		fLog.Errorf("EmailTemplateRepo.GetEmailTemplate got %s", err.Error())
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusInternalServerError, err.Error(), nil, nil)
+		return
+	}
+	if !checkIfMatch(w, r, key, before.Version) {
+		return
+	}
+	err = EmailTemplateRepo.DeleteEmailTemplate(r.Context(), tenant, key)
+	if err != nil {
+		fLog.Errorf("EmailTemplateRepo.DeleteEmailTemplate got %s", err.Error())
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusInternalServerError, err.Error(), nil, nil)
+		return
+	}
+	auditEmailTemplate(r, "email_template.delete", tenant, key, emailTemplateView(before), nil)
+	helper.WriteHTTPResponse(r.Context(), w, http.StatusOK, "Email template deleted, the default template is used", nil, nil)
+}
+
+// ListEmailTemplateVersions serving request to list every stored version of an email template of a tenant, the latest first
+func ListEmailTemplateVersions(w http.ResponseWriter, r *http.Request) {
+	fLog := emailTemplateLog.WithField("func", "ListEmailTemplateVersions").WithField("RequestID", r.Context().Value(constants.RequestID)).WithField("path", r.URL.Path).WithField("method", r.Method)
+	tenant, params := emailTemplateOfTenant(w, r, "/management/tenant/{tenantRecId}/email-template/{templateKey}/versions")
+	if tenant == nil {
+		return
+	}
+	versions, err := EmailTemplateRepo.ListEmailTemplateVersions(r.Context(), tenant, params["templateKey"])
+	if err != nil {
+		fLog.Errorf("EmailTemplateRepo.ListEmailTemplateVersions got %s", err.Error())
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusInternalServerError, err.Error(), nil, nil)
+		return
+	}
+	views := make([]*EmailTemplateView, len(versions))
+	for i, tmpl := range versions {
+		views[i] = emailTemplateView(tmpl)
+	}
+	helper.WriteHTTPResponse(r.Context(), w, http.StatusOK, "List of email template versions", nil, views)
+}
+
+// RestoreEmailTemplateVersion serving request to save an older version of an email template of a tenant as its latest version
+func RestoreEmailTemplateVersion(w http.ResponseWriter, r *http.Request) {
+	fLog := emailTemplateLog.WithField("func", "RestoreEmailTemplateVersion").WithField("RequestID", r.Context().Value(constants.RequestID)).WithField("path", r.URL.Path).WithField("method", r.Method)
+	tenant, params := emailTemplateOfTenant(w, r, "/management/tenant/{tenantRecId}/email-template/{templateKey}/version/{version}/restore")
+	if tenant == nil {
+		return
+	}
+	key := params["templateKey"]
+	version, err := strconv.Atoi(params["version"])
+	if err != nil || version < 1 {
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusBadRequest, fmt.Sprintf("invalid version %s", params["version"]), nil, nil)
+		return
+	}
+	restored, err := EmailTemplateRepo.GetEmailTemplateVersion(r.Context(), tenant, key, version)
+	if err != nil {
+		if _, none := err.(*connector.ErrDBNoResult); none {
+			helper.WriteHTTPResponse(r.Context(), w, http.StatusNotFound, fmt.Sprintf("email template %s version %d not found", key, version), nil, nil)
+			return
+		}
+		fLog.Errorf("EmailTemplateRepo.GetEmailTemplateVersion got %s", err.Error())
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusInternalServerError, err.Error(), nil, nil)
+		return
+	}
+	before, err := effectiveEmailTemplate(r, tenant, key)
+	if err != nil {
+		fLog.Errorf("EmailTemplateRepo.GetEmailTemplate got %s", err.Error())
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusInternalServerError, err.Error(), nil, nil)
+		return
+	}
+	if !checkIfMatch(w, r, key, before.Version) {
+		return
+	}
+	createEmailTemplateVersion(w, r, "email_template.restore", tenant, key, &EmailTemplateRequest{Subject: restored.Subject, Body: restored.Body, TextBody: restored.TextBody}, before)
+}
+
+// PreviewEmailTemplate serving request to render an email of a tenant with sample data.
+// The template in the request body is rendered if any, otherwise the template the email is sent with.
+func PreviewEmailTemplate(w http.ResponseWriter, r *http.Request) {
+	fLog := emailTemplateLog.WithField("func", "PreviewEmailTemplate").WithField("RequestID", r.Context().Value(constants.RequestID)).WithField("path", r.URL.Path).WithField("method", r.Method)
+	tenant, params := emailTemplateOfTenant(w, r, "/management/tenant/{tenantRecId}/email-template/{templateKey}/preview")
+	if tenant == nil {
+		return
+	}
+	key := params["templateKey"]
+	req := readEmailTemplateRequest(w, r)
+	if req == nil {
+		return
+	}
+	if len(req.Subject) == 0 && len(req.Body) == 0 && len(req.TextBody) == 0 {
+		view, err := effectiveEmailTemplate(r, tenant, key)
+		if err != nil {
+			fLog.Errorf("EmailTemplateRepo.GetEmailTemplate got %s", err.Error())
+			helper.WriteHTTPResponse(r.Context(), w, http.StatusInternalServerError, err.Error(), nil, nil)
+			return
+		}
+		req.Subject, req.Body, req.TextBody = view.Subject, view.Body, view.TextBody
+	}
+	preview, err := validateEmailTemplate(key, req, tenant)
+	if err != nil {
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusBadRequest, err.Error(), nil, nil)
+		return
+	}
+	helper.WriteHTTPResponse(r.Context(), w, http.StatusOK, "Email template rendered with sample data", nil, preview)
+}
@@ -0,0 +1,45 @@
+package endpoint
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/hyperjumptech/hansip/internal/connector"
+)
+
+func TestValidateEmailTemplate(t *testing.T) {
+	tenant := &connector.Tenant{RecID: "abc", Name: "Acme", Domain: "acme.com"}
+	testData := []struct {
+		key     string
+		subject string
+		body    string
+		valid   bool
+	}{
+		{"EMAIL_VERIFY", "Verify {{.Email}}", "Code {{.ActivationCode}}", true},
+		{"PASSPHRASE_RECOVERY", "Recover", "Code {{.RecoveryCode}}", true},
+		{"INVITATION", "Join {{.TenantName}}", "{{.Email}} {{.Token}} {{.ExpireAt.Format \"2006-01-02\"}}", true},
+		{"EMAIL_VERIFY", "", "Body", false},
+		{"EMAIL_VERIFY", "Subject", " ", false},
+		{"EMAIL_VERIFY", "Verify {{.Email}", "Body", false},
+		{"EMAIL_VERIFY", "Verify", "{{range .Email}}", false},
+		// parses but the email has no such data
+		{"EMAIL_VERIFY", "Verify", "{{.TenantName}}", false},
+	}
+	for i, td := range testData {
+		preview, err := validateEmailTemplate(td.key, &EmailTemplateRequest{Subject: td.subject, Body: td.body}, tenant)
+		if td.valid && err != nil {
+			t.Errorf("#%d expect valid but %s", i, err.Error())
+		}
+		if !td.valid && err == nil {
+			t.Errorf("#%d expect invalid but rendered %+v", i, preview)
+		}
+	}
+
+	preview, err := validateEmailTemplate("INVITATION", &EmailTemplateRequest{Subject: "Join {{.TenantName}}", Body: "at {{.TenantDomain}}"}, tenant)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if preview.Subject != "Join Acme" || !strings.Contains(preview.Body, "acme.com") {
+		t.Errorf("unexpected preview %+v", preview)
+	}
+}
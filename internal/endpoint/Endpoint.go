@@ -1,6 +1,7 @@
 package endpoint
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 	"regexp"
@@ -8,6 +9,7 @@ import (
 	"time"
 
 	"github.com/hyperjumptech/hansip/internal/config"
+	"github.com/hyperjumptech/hansip/internal/connector"
 	"github.com/hyperjumptech/hansip/internal/hansiperrors"
 	"github.com/hyperjumptech/hansip/pkg/helper"
 )
@@ -206,3 +208,32 @@ func isRoleMatch(needs, supplies []string) bool {
 	}
 	return false
 }
+
+// listErrorStatus returns the http status to respond when a listing failed.
+// invalid filter or order given by the client is a bad request, anything else is a server error.
+func listErrorStatus(err error) int {
+	var invalid *connector.ErrDBInvalidFilter
+	if errors.As(err, &invalid) {
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+// allPages calls fetch with the requests of the pages one after the other, until the last page or an error
+func allPages(fetch func(request *helper.PageRequest) (int, *helper.Page, error)) error {
+	pageNo := uint(1)
+	for {
+		count, page, err := fetch(&helper.PageRequest{
+			No:       pageNo,
+			PageSize: 100,
+			Sort:     "ASC",
+		})
+		if err != nil {
+			return err
+		}
+		if page.IsLast || count == 0 {
+			return nil
+		}
+		pageNo++
+	}
+}
@@ -0,0 +1,110 @@
+package endpoint
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/hyperjumptech/hansip/internal/connector"
+	"github.com/hyperjumptech/hansip/internal/constants"
+	"github.com/hyperjumptech/hansip/internal/events"
+	"github.com/hyperjumptech/hansip/pkg/helper"
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	eventsLog = log.WithField("go", "Events")
+)
+
+// SubscribeEvents subscribes the side effects of the endpoints to the bus, in order: the audit log,
+// the lockout policy and the webhooks. The audit of a failed login is thus recorded before its lockout.
+func SubscribeEvents(bus *events.Bus) {
+	subscribeAudit(bus)
+	bus.Subscribe(events.TypeLoginFailed, func(ctx context.Context, event events.Event) {
+		lockOut(ctx, bus, event.(*events.LoginFailed))
+	})
+	subscribeWebhooks(bus)
+}
+
+// userTenants returns the tenants the user is member of
+func userTenants(ctx context.Context, user *connector.User) []*connector.Tenant {
+	tenants, err := listUserTenants(ctx, user)
+	if err != nil {
+		eventsLog.WithField("func", "userTenants").WithField("RequestID", ctx.Value(constants.RequestID)).Errorf("UserTenantRepo.ListUserTenantByUser got %s", err.Error())
+	}
+	return tenants
+}
+
+// deletedUserTenants returns the tenants of the user about to be deleted, for its user.deleted event.
+// Nothing is fetched if no one subscribes to the event.
+func deletedUserTenants(ctx context.Context, user *connector.User) []*connector.Tenant {
+	if !events.Subscribed(events.TypeUserDeleted) {
+		return nil
+	}
+	return userTenants(ctx, user)
+}
+
+// roleUsers returns the users the role is directly assigned to, for the user.roles_changed events of
+// replacing the role users. Nothing is fetched if no one subscribes to the event.
+func roleUsers(ctx context.Context, role *connector.Role) []*connector.User {
+	if !events.Subscribed(events.TypeUserRolesChanged) {
+		return nil
+	}
+	users := make([]*connector.User, 0)
+	err := allPages(func(request *helper.PageRequest) (int, *helper.Page, error) {
+		page, p, err := UserRoleRepo.ListUserRoleByRole(ctx, role, request)
+		users = append(users, page...)
+		return len(page), p, err
+	})
+	if err != nil {
+		eventsLog.WithField("func", "roleUsers").WithField("RequestID", ctx.Value(constants.RequestID)).Errorf("UserRoleRepo.ListUserRoleByRole got %s", err.Error())
+	}
+	return users
+}
+
+// publishUserStatusEvents publishes user.activated and user.suspended if the update enabled or suspended the user
+func publishUserStatusEvents(ctx context.Context, before, after *connector.User) {
+	if !before.Enabled && after.Enabled {
+		events.Publish(ctx, &events.UserActivated{User: after})
+	}
+	if !before.Suspended && after.Suspended {
+		events.Publish(ctx, &events.UserSuspended{User: after, Reason: events.SuspendedByManagement})
+	}
+}
+
+// publishRoleUsersChanged publishes user.roles_changed of the users the role was assigned to or taken from,
+// given the users of the role before and after the change
+func publishRoleUsersChanged(ctx context.Context, before, after []*connector.User) {
+	for _, user := range changedUsers(before, after) {
+		events.Publish(ctx, &events.UserRolesChanged{User: user})
+	}
+}
+
+// changedUsers returns the users in either before or after but not both
+func changedUsers(before, after []*connector.User) []*connector.User {
+	count := make(map[string]int)
+	for _, user := range before {
+		count[user.RecID]++
+	}
+	for _, user := range after {
+		count[user.RecID]--
+	}
+	changed := make([]*connector.User, 0)
+	for _, users := range [][]*connector.User{before, after} {
+		for _, user := range users {
+			if count[user.RecID] != 0 {
+				changed = append(changed, user)
+				count[user.RecID] = 0
+			}
+		}
+	}
+	return changed
+}
+
+// EventMetrics serving request to count the events published since the server started, by event type
+func EventMetrics(w http.ResponseWriter, r *http.Request) {
+	if r.Context().Value(constants.HansipAuthentication) == nil {
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusUnauthorized, "You are not authorized to access this resource", nil, nil)
+		return
+	}
+	helper.WriteHTTPResponse(r.Context(), w, http.StatusOK, "Event counts", nil, events.DefaultMetrics.Counts())
+}
@@ -7,6 +7,7 @@ import (
 	"net/http"
 	"strings"
 
+	"github.com/hyperjumptech/hansip/internal/connector"
 	"github.com/hyperjumptech/hansip/internal/constants"
 	"github.com/hyperjumptech/hansip/internal/hansipcontext"
 	"github.com/hyperjumptech/hansip/pkg/helper"
@@ -44,7 +45,7 @@ func SetGroupUsers(w http.ResponseWriter, r *http.Request) {
 	}
 
 	authCtx := iauthctx.(*hansipcontext.AuthenticationContext)
-	if !authCtx.IsAdminOfDomain(group.GroupDomain) {
+	if !canJoinGroup(r.Context(), authCtx, group) {
 		helper.WriteHTTPResponse(r.Context(), w, http.StatusForbidden, "You don't have the right to access group with the specified domain", nil, nil)
 		return
 	}
@@ -63,6 +64,7 @@ func SetGroupUsers(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	before := auditGroupUsers(r.Context(), group)
 	err = UserGroupRepo.DeleteUserGroupByGroup(r.Context(), group)
 	if err != nil {
 		fLog.Errorf("UserGroupRepo.DeleteUserGroupByGroup got %s", err.Error())
@@ -85,6 +87,7 @@ func SetGroupUsers(w http.ResponseWriter, r *http.Request) {
 			RevocationRepo.Revoke(r.Context(), user.Email)
 		}
 	}
+	auditGroup(r, "group.users.set", group, before, auditGroupUsers(r.Context(), group))
 	helper.WriteHTTPResponse(r.Context(), w, http.StatusOK, fmt.Sprintf("%d users added the group", counter), nil, nil)
 }
 
@@ -109,17 +112,19 @@ func DeleteGroupUsers(w http.ResponseWriter, r *http.Request) {
 	}
 
 	authCtx := iauthctx.(*hansipcontext.AuthenticationContext)
-	if !authCtx.IsAdminOfDomain(group.GroupDomain) {
+	if !canJoinGroup(r.Context(), authCtx, group) {
 		helper.WriteHTTPResponse(r.Context(), w, http.StatusForbidden, "You don't have the right to access group with the specified domain", nil, nil)
 		return
 	}
 
+	before := auditGroupUsers(r.Context(), group)
 	err = UserGroupRepo.DeleteUserGroupByGroup(r.Context(), group)
 	if err != nil {
 		fLog.Errorf("UserGroupRepo.DeleteUserGroupByGroup got %s", err.Error())
 		helper.WriteHTTPResponse(r.Context(), w, http.StatusInternalServerError, err.Error(), nil, nil)
 		return
 	}
+	auditGroup(r, "group.users.delete", group, before, auditGroupUsers(r.Context(), group))
 	helper.WriteHTTPResponse(r.Context(), w, http.StatusOK, "successfuly cleared group member", nil, nil)
 }
 
@@ -144,10 +149,14 @@ func SetGroupRoles(w http.ResponseWriter, r *http.Request) {
 	}
 
 	authCtx := iauthctx.(*hansipcontext.AuthenticationContext)
-	if !authCtx.IsAdminOfDomain(group.GroupDomain) {
+	if !authCtx.HasScopeOfDomain(group.GroupDomain, hansipcontext.ScopeRoleManager) {
 		helper.WriteHTTPResponse(r.Context(), w, http.StatusForbidden, "You don't have the right to access group with the specified domain", nil, nil)
 		return
 	}
+	if !canAssignGroupRoles(r.Context(), authCtx, group) {
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusForbidden, "You don't have the right to remove roles the group currently have", nil, nil)
+		return
+	}
 
 	body, err := ioutil.ReadAll(r.Body)
 	if err != nil {
@@ -163,6 +172,21 @@ func SetGroupRoles(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	rolesToAdd := make([]*connector.Role, 0)
+	for _, roleID := range roleIds {
+		role, err := RoleRepo.GetRoleByRecID(r.Context(), roleID)
+		if err != nil {
+			fLog.Warnf("RoleRepo.GetRoleByRecID got %s, this role %s will not be added to group %s role", err.Error(), roleID, group.RecID)
+			continue
+		}
+		if !canAssignRole(authCtx, role.RoleName, role.RoleDomain) {
+			helper.WriteHTTPResponse(r.Context(), w, http.StatusForbidden, "You don't have the right to access role with the specified domain", nil, nil)
+			return
+		}
+		rolesToAdd = append(rolesToAdd, role)
+	}
+
+	before := auditGroupRoles(r.Context(), group)
 	err = GroupRoleRepo.DeleteGroupRoleByGroup(r.Context(), group)
 	if err != nil {
 		fLog.Errorf("GroupRoleRepo.DeleteGroupRoleByGroup got %s", err.Error())
@@ -171,19 +195,15 @@ func SetGroupRoles(w http.ResponseWriter, r *http.Request) {
 	}
 
 	counter := 0
-	for _, roleID := range roleIds {
-		role, err := RoleRepo.GetRoleByRecID(r.Context(), roleID)
+	for _, role := range rolesToAdd {
+		_, err := GroupRoleRepo.CreateGroupRole(r.Context(), group, role)
 		if err != nil {
-			fLog.Warnf("RoleRepo.GetRoleByRecID got %s, this role %s will not be added to group %s role", err.Error(), roleID, group.RecID)
+			fLog.Warnf("GroupRoleRepo.CreateGroupRole got %s, this role %s will not be added to group %s role", err.Error(), role.RecID, group.RecID)
 		} else {
-			_, err := GroupRoleRepo.CreateGroupRole(r.Context(), group, role)
-			if err != nil {
-				fLog.Warnf("GroupRoleRepo.CreateGroupRole got %s, this role %s will not be added to group %s role", err.Error(), roleID, group.RecID)
-			} else {
-				counter++
-			}
+			counter++
 		}
 	}
+	auditGroup(r, "group.roles.set", group, before, auditGroupRoles(r.Context(), group))
 	helper.WriteHTTPResponse(r.Context(), w, http.StatusOK, fmt.Sprintf("%d roles added the group", counter), nil, nil)
 }
 
@@ -208,17 +228,23 @@ func DeleteGroupRoles(w http.ResponseWriter, r *http.Request) {
 	}
 
 	authCtx := iauthctx.(*hansipcontext.AuthenticationContext)
-	if !authCtx.IsAdminOfDomain(group.GroupDomain) {
+	if !authCtx.HasScopeOfDomain(group.GroupDomain, hansipcontext.ScopeRoleManager) {
 		helper.WriteHTTPResponse(r.Context(), w, http.StatusForbidden, "You don't have the right to access group with the specified domain", nil, nil)
 		return
 	}
+	if !canAssignGroupRoles(r.Context(), authCtx, group) {
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusForbidden, "You don't have the right to remove roles the group currently have", nil, nil)
+		return
+	}
 
+	before := auditGroupRoles(r.Context(), group)
 	err = GroupRoleRepo.DeleteGroupRoleByGroup(r.Context(), group)
 	if err != nil {
 		fLog.Errorf("GroupRoleRepo.DeleteGroupRoleByGroup got %s", err.Error())
 		helper.WriteHTTPResponse(r.Context(), w, http.StatusInternalServerError, err.Error(), nil, nil)
 		return
 	}
+	auditGroup(r, "group.roles.delete", group, before, auditGroupRoles(r.Context(), group))
 	helper.WriteHTTPResponse(r.Context(), w, http.StatusOK, "successfuly cleared all roles of group", nil, nil)
 }
 
@@ -245,7 +271,7 @@ func ListAllGroup(w http.ResponseWriter, r *http.Request) {
 	}
 
 	authCtx := iauthctx.(*hansipcontext.AuthenticationContext)
-	if !authCtx.IsAdminOfDomain(tenant.Domain) {
+	if !authCtx.HasScopeOfDomain(tenant.Domain, readScopes...) {
 		helper.WriteHTTPResponse(r.Context(), w, http.StatusForbidden, "You don't have the right to access group with the specified domain", nil, nil)
 		return
 	}
@@ -259,7 +285,7 @@ func ListAllGroup(w http.ResponseWriter, r *http.Request) {
 	groups, page, err := GroupRepo.ListGroups(r.Context(), tenant, pageRequest)
 	if err != nil {
 		fLog.Errorf("GroupRepo.ListGroups got %s", err.Error())
-		helper.WriteHTTPResponse(r.Context(), w, http.StatusInternalServerError, err.Error(), nil, nil)
+		helper.WriteHTTPResponse(r.Context(), w, listErrorStatus(err), err.Error(), nil, nil)
 		return
 	}
 	ret := make(map[string]interface{})
@@ -312,7 +338,7 @@ func CreateNewGroup(w http.ResponseWriter, r *http.Request) {
 	}
 
 	authCtx := iauthctx.(*hansipcontext.AuthenticationContext)
-	if !authCtx.IsAdminOfDomain(req.GroupDomain) {
+	if !authCtx.HasScopeOfDomain(req.GroupDomain, hansipcontext.ScopeGroupManager) {
 		helper.WriteHTTPResponse(r.Context(), w, http.StatusForbidden, "You don't have the right to create group with the specified domain", nil, nil)
 		return
 	}
@@ -323,6 +349,7 @@ func CreateNewGroup(w http.ResponseWriter, r *http.Request) {
 		helper.WriteHTTPResponse(r.Context(), w, http.StatusBadRequest, err.Error(), nil, nil)
 		return
 	}
+	auditGroup(r, "group.create", group, nil, group)
 	helper.WriteHTTPResponse(r.Context(), w, http.StatusOK, "Success creating group", nil, group)
 	return
 }
@@ -349,15 +376,15 @@ func GetGroupDetail(w http.ResponseWriter, r *http.Request) {
 	}
 
 	authCtx := iauthctx.(*hansipcontext.AuthenticationContext)
-	if !authCtx.IsAdminOfDomain(group.GroupDomain) {
+	if !authCtx.HasScopeOfDomain(group.GroupDomain, readScopes...) {
 		helper.WriteHTTPResponse(r.Context(), w, http.StatusForbidden, "You don't have the right to access group with the specified domain", nil, nil)
 		return
 	}
 
-	helper.WriteHTTPResponse(r.Context(), w, http.StatusOK, "Group retrieved", nil, group)
+	helper.WriteHTTPResponse(r.Context(), w, http.StatusOK, "Group retrieved", etagHeader(group.RecID, group.Version), group)
 }
 
-// UpdateGroup serving request to update group detail
+// UpdateGroup serving request to update group detail, entirely with PUT or partially with PATCH merge patch
 func UpdateGroup(w http.ResponseWriter, r *http.Request) {
 	fLog := groupMgmtLog.WithField("func", "UpdateGroup").WithField("RequestID", r.Context().Value(constants.RequestID)).WithField("path", r.URL.Path).WithField("method", r.Method)
 
@@ -372,33 +399,41 @@ func UpdateGroup(w http.ResponseWriter, r *http.Request) {
 		panic(err)
 	}
 
-	req := &CreateGroupRequest{}
-	body, err := ioutil.ReadAll(r.Body)
+	group, err := GroupRepo.GetGroupByRecID(r.Context(), params["groupRecId"])
 	if err != nil {
-		fLog.Errorf("ioutil.ReadAll got %s", err.Error())
-		helper.WriteHTTPResponse(r.Context(), w, http.StatusInternalServerError, err.Error(), nil, nil)
+		fLog.Errorf("GroupRepo.GetGroupByRecID got %s", err.Error())
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusNotFound, err.Error(), nil, nil)
 		return
 	}
-	err = json.Unmarshal(body, req)
+
+	req := &CreateGroupRequest{}
+	current := &CreateGroupRequest{
+		GroupName:   group.GroupName,
+		GroupDomain: group.GroupDomain,
+		Description: group.Description,
+	}
+	status, err := readUpdateRequest(r, req, current)
 	if err != nil {
-		fLog.Errorf("json.Unmarshal got %s", err.Error())
-		helper.WriteHTTPResponse(r.Context(), w, http.StatusBadRequest, err.Error(), nil, nil)
+		fLog.Errorf("readUpdateRequest got %s", err.Error())
+		helper.WriteHTTPResponse(r.Context(), w, status, err.Error(), nil, nil)
 		return
 	}
-
-	group, err := GroupRepo.GetGroupByRecID(r.Context(), params["groupRecId"])
-	if err != nil {
-		fLog.Errorf("GroupRepo.GetGroupByRecID got %s", err.Error())
-		helper.WriteHTTPResponse(r.Context(), w, http.StatusNotFound, err.Error(), nil, nil)
+	if err := validateGroupRequest(req); err != nil {
+		fLog.Errorf("validateGroupRequest got %s", err.Error())
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusBadRequest, err.Error(), nil, nil)
 		return
 	}
 
 	authCtx := iauthctx.(*hansipcontext.AuthenticationContext)
-	if !(authCtx.IsAdminOfDomain(group.GroupDomain) && authCtx.IsAdminOfDomain(req.GroupDomain)) {
+	if !(canJoinGroup(r.Context(), authCtx, group) && authCtx.HasScopeOfDomain(req.GroupDomain, hansipcontext.ScopeGroupManager)) {
 		helper.WriteHTTPResponse(r.Context(), w, http.StatusForbidden, fmt.Sprintf("forbidden. you are not admin of %s and %s domain", group.GroupDomain, req.GroupDomain), nil, nil)
 		return
 	}
+	if !checkIfMatch(w, r, group.RecID, group.Version) {
+		return
+	}
 
+	before := *group
 	group.GroupName = req.GroupName
 	group.GroupDomain = req.GroupDomain
 	group.Description = req.Description
@@ -413,10 +448,11 @@ func UpdateGroup(w http.ResponseWriter, r *http.Request) {
 	err = GroupRepo.UpdateGroup(r.Context(), group)
 	if err != nil {
 		fLog.Errorf("GroupRepo.SaveOrUpdateGroupe got %s", err.Error())
-		helper.WriteHTTPResponse(r.Context(), w, http.StatusInternalServerError, err.Error(), nil, nil)
+		helper.WriteHTTPResponse(r.Context(), w, updateErrorStatus(err), err.Error(), nil, nil)
 		return
 	}
-	helper.WriteHTTPResponse(r.Context(), w, http.StatusOK, "Group updated", nil, group)
+	auditGroup(r, "group.update", group, &before, group)
+	helper.WriteHTTPResponse(r.Context(), w, http.StatusOK, "Group updated", etagHeader(group.RecID, group.Version), group)
 
 }
 
@@ -442,12 +478,16 @@ func DeleteGroup(w http.ResponseWriter, r *http.Request) {
 	}
 
 	authCtx := iauthctx.(*hansipcontext.AuthenticationContext)
-	if !authCtx.IsAdminOfDomain(group.GroupDomain) {
+	if !canJoinGroup(r.Context(), authCtx, group) {
 		helper.WriteHTTPResponse(r.Context(), w, http.StatusForbidden, "You don't have the right to access group with the specified domain", nil, nil)
 		return
 	}
+	if !checkIfMatch(w, r, group.RecID, group.Version) {
+		return
+	}
 
 	GroupRepo.DeleteGroup(r.Context(), group)
+	auditGroup(r, "group.delete", group, group, nil)
 	helper.WriteHTTPResponse(r.Context(), w, http.StatusOK, "Group deleted", nil, nil)
 }
 
@@ -473,7 +513,7 @@ func ListGroupUser(w http.ResponseWriter, r *http.Request) {
 	}
 
 	authCtx := iauthctx.(*hansipcontext.AuthenticationContext)
-	if !authCtx.IsAdminOfDomain(group.GroupDomain) {
+	if !authCtx.HasScopeOfDomain(group.GroupDomain, readScopes...) {
 		helper.WriteHTTPResponse(r.Context(), w, http.StatusForbidden, "You don't have the right to access group with the specified domain", nil, nil)
 		return
 	}
@@ -487,6 +527,8 @@ func ListGroupUser(w http.ResponseWriter, r *http.Request) {
 	users, page, err := UserGroupRepo.ListUserGroupByGroup(r.Context(), group, pageRequest)
 	if err != nil {
 		fLog.Errorf("UserGroupRepo.ListUserGroupByGroup got %s", err.Error())
+		helper.WriteHTTPResponse(r.Context(), w, listErrorStatus(err), err.Error(), nil, nil)
+		return
 	}
 	susers := make([]*SimpleUser, len(users))
 	for k, v := range users {
@@ -525,7 +567,7 @@ func CreateGroupUser(w http.ResponseWriter, r *http.Request) {
 	}
 
 	authCtx := iauthctx.(*hansipcontext.AuthenticationContext)
-	if !authCtx.IsAdminOfDomain(group.GroupDomain) {
+	if !canJoinGroup(r.Context(), authCtx, group) {
 		helper.WriteHTTPResponse(r.Context(), w, http.StatusForbidden, "You don't have the right to access group with the specified domain", nil, nil)
 		return
 	}
@@ -543,6 +585,7 @@ func CreateGroupUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	RevocationRepo.Revoke(r.Context(), user.Email)
+	auditGroup(r, "group.user.add", group, nil, auditLink("user", user.Email))
 	helper.WriteHTTPResponse(r.Context(), w, http.StatusOK, "User-Group created", nil, nil)
 }
 
@@ -568,7 +611,7 @@ func DeleteGroupUser(w http.ResponseWriter, r *http.Request) {
 	}
 
 	authCtx := iauthctx.(*hansipcontext.AuthenticationContext)
-	if !authCtx.IsAdminOfDomain(group.GroupDomain) {
+	if !canJoinGroup(r.Context(), authCtx, group) {
 		helper.WriteHTTPResponse(r.Context(), w, http.StatusForbidden, "You don't have the right to access group with the specified domain", nil, nil)
 		return
 	}
@@ -592,6 +635,7 @@ func DeleteGroupUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	RevocationRepo.Revoke(r.Context(), user.Email)
+	auditGroup(r, "group.user.remove", group, auditLink("user", user.Email), nil)
 	helper.WriteHTTPResponse(r.Context(), w, http.StatusOK, "User-Group deleted", nil, nil)
 }
 
@@ -617,7 +661,7 @@ func ListGroupRole(w http.ResponseWriter, r *http.Request) {
 	}
 
 	authCtx := iauthctx.(*hansipcontext.AuthenticationContext)
-	if !authCtx.IsAdminOfDomain(group.GroupDomain) {
+	if !authCtx.HasScopeOfDomain(group.GroupDomain, readScopes...) {
 		helper.WriteHTTPResponse(r.Context(), w, http.StatusForbidden, "You don't have the right to access group with the specified domain", nil, nil)
 		return
 	}
@@ -631,6 +675,8 @@ func ListGroupRole(w http.ResponseWriter, r *http.Request) {
 	roles, page, err := GroupRoleRepo.ListGroupRoleByGroup(r.Context(), group, pageRequest)
 	if err != nil {
 		fLog.Errorf("GroupRoleRepo.ListGroupRoleByGroup got %s", err.Error())
+		helper.WriteHTTPResponse(r.Context(), w, listErrorStatus(err), err.Error(), nil, nil)
+		return
 	}
 	sroles := make([]*SimpleRole, len(roles))
 	for k, v := range roles {
@@ -667,7 +713,7 @@ func CreateGroupRole(w http.ResponseWriter, r *http.Request) {
 	}
 
 	authCtx := iauthctx.(*hansipcontext.AuthenticationContext)
-	if !authCtx.IsAdminOfDomain(group.GroupDomain) {
+	if !authCtx.HasScopeOfDomain(group.GroupDomain, hansipcontext.ScopeRoleManager) {
 		helper.WriteHTTPResponse(r.Context(), w, http.StatusForbidden, "You don't have the right to access group with the specified domain", nil, nil)
 		return
 	}
@@ -678,6 +724,10 @@ func CreateGroupRole(w http.ResponseWriter, r *http.Request) {
 		helper.WriteHTTPResponse(r.Context(), w, http.StatusNotFound, err.Error(), nil, nil)
 		return
 	}
+	if !canAssignRole(authCtx, role.RoleName, role.RoleDomain) {
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusForbidden, "You don't have the right to access role with the specified domain", nil, nil)
+		return
+	}
 
 	if group.GroupDomain != role.RoleDomain {
 		helper.WriteHTTPResponse(r.Context(), w, http.StatusForbidden, "Role can not be added into group with different domain", nil, nil)
@@ -690,6 +740,7 @@ func CreateGroupRole(w http.ResponseWriter, r *http.Request) {
 		helper.WriteHTTPResponse(r.Context(), w, http.StatusBadRequest, err.Error(), nil, nil)
 		return
 	}
+	auditGroup(r, "group.role.add", group, nil, auditLink("role", fmt.Sprintf("%s@%s", role.RoleName, role.RoleDomain)))
 	helper.WriteHTTPResponse(r.Context(), w, http.StatusOK, "Group-Role created", nil, nil)
 }
 
@@ -715,7 +766,7 @@ func DeleteGroupRole(w http.ResponseWriter, r *http.Request) {
 	}
 
 	authCtx := iauthctx.(*hansipcontext.AuthenticationContext)
-	if !authCtx.IsAdminOfDomain(group.GroupDomain) {
+	if !authCtx.HasScopeOfDomain(group.GroupDomain, hansipcontext.ScopeRoleManager) {
 		helper.WriteHTTPResponse(r.Context(), w, http.StatusForbidden, "You don't have the right to access group with the specified domain", nil, nil)
 		return
 	}
@@ -726,6 +777,10 @@ func DeleteGroupRole(w http.ResponseWriter, r *http.Request) {
 		helper.WriteHTTPResponse(r.Context(), w, http.StatusNotFound, err.Error(), nil, nil)
 		return
 	}
+	if !canAssignRole(authCtx, role.RoleName, role.RoleDomain) {
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusForbidden, "You don't have the right to access role with the specified domain", nil, nil)
+		return
+	}
 	gr, err := GroupRoleRepo.GetGroupRole(r.Context(), group, role)
 	if err != nil {
 		fLog.Errorf("GroupRoleRepo.GetGroupRole got %s", err.Error())
@@ -738,5 +793,6 @@ func DeleteGroupRole(w http.ResponseWriter, r *http.Request) {
 		helper.WriteHTTPResponse(r.Context(), w, http.StatusNotFound, err.Error(), nil, nil)
 		return
 	}
+	auditGroup(r, "group.role.remove", group, auditLink("role", fmt.Sprintf("%s@%s", role.RoleName, role.RoleDomain)), nil)
 	helper.WriteHTTPResponse(r.Context(), w, http.StatusOK, "User-Group deleted", nil, nil)
 }
@@ -0,0 +1,432 @@
+package endpoint
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/hyperjumptech/hansip/internal/config"
+	"github.com/hyperjumptech/hansip/internal/connector"
+	"github.com/hyperjumptech/hansip/internal/constants"
+	"github.com/hyperjumptech/hansip/internal/events"
+	"github.com/hyperjumptech/hansip/internal/hansipcontext"
+	"github.com/hyperjumptech/hansip/internal/mailer"
+	"github.com/hyperjumptech/hansip/pkg/helper"
+	"github.com/hyperjumptech/jiffy"
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	invitationLog = log.WithField("go", "Invitation")
+)
+
+// CreateInvitationRequest hold model for inviting a new user into a tenant
+type CreateInvitationRequest struct {
+	Email        string   `json:"email"`
+	TenantDomain string   `json:"tenant_domain"`
+	Groups       []string `json:"groups"`
+	Roles        []string `json:"roles"`
+}
+
+// AcceptInvitationRequest hold model for accepting an invitation
+type AcceptInvitationRequest struct {
+	Email      string `json:"email"`
+	Token      string `json:"token"`
+	Passphrase string `json:"passphrase"`
+}
+
+// invitationMail is the data of INVITATION email template
+type invitationMail struct {
+	*connector.Invitation
+	TenantName   string
+	TenantDomain string
+}
+
+// invitationExpiry returns the expiry time of an invitation created now
+func invitationExpiry(settings config.Settings) (time.Time, error) {
+	age, err := jiffy.DurationOf(settings.Get("invitation.expiry"))
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Now().Add(age), nil
+}
+
+// newInvitationToken returns a new secret invitation token and its hash, only the hash is stored
+func newInvitationToken() (string, string, error) {
+	token, err := helper.MakeSecretString(32)
+	if err != nil {
+		return "", "", err
+	}
+	return token, invitationTokenHash(token), nil
+}
+
+// invitationTokenHash returns the hex SHA-256 of the invitation token
+func invitationTokenHash(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// sendInvitation queues the INVITATION email to the invitee
+func sendInvitation(ctx context.Context, settings config.Settings, invitation *connector.Invitation, tenant *connector.Tenant) error {
+	return mailer.Send(ctx, &mailer.Email{
+		From:     settings.Get("mailer.from"),
+		FromName: settings.Get("mailer.from.name"),
+		To:       []string{invitation.Email},
+		Cc:       nil,
+		Bcc:      nil,
+		Template: "INVITATION",
+		Data: &invitationMail{
+			Invitation:   invitation,
+			TenantName:   tenant.Name,
+			TenantDomain: tenant.Domain,
+		},
+		Settings: settings,
+		Tenant:   tenant,
+	})
+}
+
+// invitationOfManager loads the invitation of the request path whose tenant the caller is admin or user manager of.
+// If it fails, it writes the error response and returns nil.
+func invitationOfManager(w http.ResponseWriter, r *http.Request, pathTemplate string) (*connector.Invitation, *connector.Tenant) {
+	fLog := invitationLog.WithField("func", "invitationOfManager").WithField("RequestID", r.Context().Value(constants.RequestID)).WithField("path", r.URL.Path).WithField("method", r.Method)
+	iauthctx := r.Context().Value(constants.HansipAuthentication)
+	if iauthctx == nil {
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusUnauthorized, "You are not authorized to access this resource", nil, nil)
+		return nil, nil
+	}
+	params, err := helper.ParsePathParams(fmt.Sprintf("%s%s", apiPrefix, pathTemplate), r.URL.Path)
+	if err != nil {
+		panic(err)
+	}
+	invitation, err := InvitationRepo.GetInvitationByRecID(r.Context(), params["invitationRecId"])
+	if err != nil {
+		fLog.Errorf("InvitationRepo.GetInvitationByRecID got %s", err.Error())
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusNotFound, err.Error(), nil, nil)
+		return nil, nil
+	}
+	tenant, err := TenantRepo.GetTenantByRecID(r.Context(), invitation.TenantRecID)
+	if err != nil {
+		fLog.Errorf("TenantRepo.GetTenantByRecID got %s", err.Error())
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusNotFound, err.Error(), nil, nil)
+		return nil, nil
+	}
+	authCtx := iauthctx.(*hansipcontext.AuthenticationContext)
+	if !authCtx.HasScopeOfDomain(tenant.Domain, hansipcontext.ScopeUserManager) {
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusForbidden, "You don't have the right to access invitation of the specified tenant", nil, nil)
+		return nil, nil
+	}
+	return invitation, tenant
+}
+
+// CreateInvitation serving request to invite a new user into a tenant with pre-assigned groups and roles
+func CreateInvitation(w http.ResponseWriter, r *http.Request) {
+	fLog := invitationLog.WithField("func", "CreateInvitation").WithField("RequestID", r.Context().Value(constants.RequestID)).WithField("path", r.URL.Path).WithField("method", r.Method)
+	iauthctx := r.Context().Value(constants.HansipAuthentication)
+	if iauthctx == nil {
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusUnauthorized, "You are not authorized to access this resource", nil, nil)
+		return
+	}
+	req := &CreateInvitationRequest{}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		fLog.Errorf("ioutil.ReadAll got %s", err.Error())
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusInternalServerError, err.Error(), nil, nil)
+		return
+	}
+	err = json.Unmarshal(body, req)
+	if err != nil {
+		fLog.Errorf("json.Unmarshal got %s", err.Error())
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusBadRequest, err.Error(), nil, nil)
+		return
+	}
+	if err := validateEmail(req.Email); err != nil {
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusBadRequest, err.Error(), nil, nil)
+		return
+	}
+	if len(req.TenantDomain) == 0 {
+		req.TenantDomain = config.Get("hansip.domain")
+	}
+	authCtx := iauthctx.(*hansipcontext.AuthenticationContext)
+	if !authCtx.HasScopeOfDomain(req.TenantDomain, hansipcontext.ScopeUserManager) {
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusForbidden, "You don't have the right to invite user into the specified tenant", nil, nil)
+		return
+	}
+	tenant, err := TenantRepo.GetTenantByDomain(r.Context(), req.TenantDomain)
+	if err != nil {
+		fLog.Errorf("TenantRepo.GetTenantByDomain got %s", err.Error())
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusNotFound, err.Error(), nil, nil)
+		return
+	}
+	if _, err := UserRepo.GetUserByEmail(r.Context(), req.Email); err == nil {
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusConflict, fmt.Sprintf("user %s already exist", req.Email), nil, nil)
+		return
+	}
+	for _, groupID := range req.Groups {
+		group, err := GroupRepo.GetGroupByRecID(r.Context(), groupID)
+		if err != nil || group.GroupDomain != tenant.Domain {
+			helper.WriteHTTPResponse(r.Context(), w, http.StatusBadRequest, fmt.Sprintf("group %s not found in tenant %s", groupID, tenant.Domain), nil, nil)
+			return
+		}
+		if !canJoinGroup(r.Context(), authCtx, group) {
+			helper.WriteHTTPResponse(r.Context(), w, http.StatusForbidden, fmt.Sprintf("You don't have the right to add user into group %s", groupID), nil, nil)
+			return
+		}
+	}
+	for _, roleID := range req.Roles {
+		role, err := RoleRepo.GetRoleByRecID(r.Context(), roleID)
+		if err != nil || role.RoleDomain != tenant.Domain {
+			helper.WriteHTTPResponse(r.Context(), w, http.StatusBadRequest, fmt.Sprintf("role %s not found in tenant %s", roleID, tenant.Domain), nil, nil)
+			return
+		}
+		if !canAssignRole(authCtx, role.RoleName, role.RoleDomain) {
+			helper.WriteHTTPResponse(r.Context(), w, http.StatusForbidden, fmt.Sprintf("You don't have the right to assign role %s", roleID), nil, nil)
+			return
+		}
+	}
+	pending, err := InvitationRepo.ListInvitations(r.Context(), tenant)
+	if err != nil {
+		fLog.Errorf("InvitationRepo.ListInvitations got %s", err.Error())
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusInternalServerError, err.Error(), nil, nil)
+		return
+	}
+	for _, invitation := range pending {
+		if strings.EqualFold(invitation.Email, req.Email) {
+			helper.WriteHTTPResponse(r.Context(), w, http.StatusConflict, fmt.Sprintf("%s is already invited, resend or revoke the invitation %s instead", req.Email, invitation.RecID), nil, nil)
+			return
+		}
+	}
+	settings := tenantSettings(r.Context(), tenant)
+	expireAt, err := invitationExpiry(settings)
+	if err != nil {
+		fLog.Errorf("invitationExpiry got %s", err.Error())
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusInternalServerError, err.Error(), nil, nil)
+		return
+	}
+	if req.Groups == nil {
+		req.Groups = make([]string, 0)
+	}
+	if req.Roles == nil {
+		req.Roles = make([]string, 0)
+	}
+	token, tokenHash, err := newInvitationToken()
+	if err != nil {
+		fLog.Errorf("newInvitationToken got %s", err.Error())
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusInternalServerError, err.Error(), nil, nil)
+		return
+	}
+	invitation, err := InvitationRepo.CreateInvitation(r.Context(), req.Email, tenant, tokenHash, req.Groups, req.Roles, authCtx.Subject, expireAt)
+	if err != nil {
+		fLog.Errorf("InvitationRepo.CreateInvitation got %s", err.Error())
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusInternalServerError, err.Error(), nil, nil)
+		return
+	}
+	invitation.Token = token
+	fLog.Warnf("Sending email")
+	err = sendInvitation(r.Context(), settings, invitation, tenant)
+	if err != nil {
+		fLog.Errorf("sendInvitation got %s", err.Error())
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusInternalServerError, err.Error(), nil, nil)
+		return
+	}
+	audit(r, &connector.AuditEvent{
+		Event:        "invitation.create",
+		TargetType:   AuditTargetInvitation,
+		Target:       invitation.RecID,
+		TenantDomain: tenant.Domain,
+	}, nil, invitation)
+	helper.WriteHTTPResponse(r.Context(), w, http.StatusOK, "Invitation sent", nil, invitation)
+}
+
+// ListInvitations serving request to list pending invitations of a tenant
+func ListInvitations(w http.ResponseWriter, r *http.Request) {
+	fLog := invitationLog.WithField("func", "ListInvitations").WithField("RequestID", r.Context().Value(constants.RequestID)).WithField("path", r.URL.Path).WithField("method", r.Method)
+	tenant, _ := scopedTenant(w, r, "/management/tenant/{tenantRecId}/invitations", hansipcontext.ScopeUserManager, hansipcontext.ScopeAuditor)
+	if tenant == nil {
+		return
+	}
+	invitations, err := InvitationRepo.ListInvitations(r.Context(), tenant)
+	if err != nil {
+		fLog.Errorf("InvitationRepo.ListInvitations got %s", err.Error())
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusInternalServerError, err.Error(), nil, nil)
+		return
+	}
+	helper.WriteHTTPResponse(r.Context(), w, http.StatusOK, "List of pending invitations", nil, invitations)
+}
+
+// ResendInvitation serving request to send the invitation again with a new token and renewed expiry
+func ResendInvitation(w http.ResponseWriter, r *http.Request) {
+	fLog := invitationLog.WithField("func", "ResendInvitation").WithField("RequestID", r.Context().Value(constants.RequestID)).WithField("path", r.URL.Path).WithField("method", r.Method)
+	invitation, tenant := invitationOfManager(w, r, "/management/invitation/{invitationRecId}/resend")
+	if invitation == nil {
+		return
+	}
+	settings := tenantSettings(r.Context(), tenant)
+	expireAt, err := invitationExpiry(settings)
+	if err != nil {
+		fLog.Errorf("invitationExpiry got %s", err.Error())
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusInternalServerError, err.Error(), nil, nil)
+		return
+	}
+	token, tokenHash, err := newInvitationToken()
+	if err != nil {
+		fLog.Errorf("newInvitationToken got %s", err.Error())
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusInternalServerError, err.Error(), nil, nil)
+		return
+	}
+	err = InvitationRepo.RenewInvitation(r.Context(), invitation, tokenHash, expireAt)
+	if err != nil {
+		fLog.Errorf("InvitationRepo.RenewInvitation got %s", err.Error())
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusInternalServerError, err.Error(), nil, nil)
+		return
+	}
+	invitation.Token = token
+	fLog.Warnf("Sending email")
+	err = sendInvitation(r.Context(), settings, invitation, tenant)
+	if err != nil {
+		fLog.Errorf("sendInvitation got %s", err.Error())
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusInternalServerError, err.Error(), nil, nil)
+		return
+	}
+	audit(r, &connector.AuditEvent{
+		Event:        "invitation.resend",
+		TargetType:   AuditTargetInvitation,
+		Target:       invitation.RecID,
+		TenantDomain: tenant.Domain,
+	}, nil, nil)
+	helper.WriteHTTPResponse(r.Context(), w, http.StatusOK, "Invitation sent", nil, invitation)
+}
+
+// RevokeInvitation serving request to cancel a pending invitation
+func RevokeInvitation(w http.ResponseWriter, r *http.Request) {
+	fLog := invitationLog.WithField("func", "RevokeInvitation").WithField("RequestID", r.Context().Value(constants.RequestID)).WithField("path", r.URL.Path).WithField("method", r.Method)
+	invitation, tenant := invitationOfManager(w, r, "/management/invitation/{invitationRecId}")
+	if invitation == nil {
+		return
+	}
+	err := InvitationRepo.DeleteInvitation(r.Context(), invitation)
+	if err != nil {
+		fLog.Errorf("InvitationRepo.DeleteInvitation got %s", err.Error())
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusInternalServerError, err.Error(), nil, nil)
+		return
+	}
+	audit(r, &connector.AuditEvent{
+		Event:        "invitation.revoke",
+		TargetType:   AuditTargetInvitation,
+		Target:       invitation.RecID,
+		TenantDomain: tenant.Domain,
+	}, invitation, nil)
+	helper.WriteHTTPResponse(r.Context(), w, http.StatusOK, "Invitation revoked", nil, nil)
+}
+
+// AcceptInvitation serving the invitee accepting the invitation. The user is created with the chosen passphrase,
+// already activated since the invitation proves the email, and joins the tenant, groups and roles of the invitation.
+func AcceptInvitation(w http.ResponseWriter, r *http.Request) {
+	fLog := invitationLog.WithField("func", "AcceptInvitation").WithField("RequestID", r.Context().Value(constants.RequestID)).WithField("path", r.URL.Path).WithField("method", r.Method)
+	req := &AcceptInvitationRequest{}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		fLog.Errorf("ioutil.ReadAll got %s", err.Error())
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusInternalServerError, err.Error(), nil, nil)
+		return
+	}
+	err = json.Unmarshal(body, req)
+	if err != nil {
+		fLog.Errorf("json.Unmarshal got %s", err.Error())
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusBadRequest, "Malformed json body", nil, nil)
+		return
+	}
+	tokenHash := invitationTokenHash(req.Token)
+	invitation, err := InvitationRepo.GetInvitationByTokenHash(r.Context(), tokenHash)
+	if err != nil || len(req.Token) == 0 || subtle.ConstantTimeCompare([]byte(invitation.TokenHash), []byte(tokenHash)) != 1 || !strings.EqualFold(invitation.Email, req.Email) {
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusNotFound, "Invitation token and email not match", nil, nil)
+		return
+	}
+	if time.Now().After(invitation.ExpireAt) {
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusGone, "Invitation has expired, ask for the invitation to be resent", nil, nil)
+		return
+	}
+	tenant, err := TenantRepo.GetTenantByRecID(r.Context(), invitation.TenantRecID)
+	if err != nil {
+		fLog.Errorf("TenantRepo.GetTenantByRecID got %s", err.Error())
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusNotFound, err.Error(), nil, nil)
+		return
+	}
+	isValidPassphrase, invalidMsg := validatePassphrase(tenantSettings(r.Context(), tenant), req.Passphrase)
+	if !isValidPassphrase {
+		fLog.Errorf("Passphrase invalid")
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusBadRequest, "invalid passphrase", nil, fmt.Sprintf("Invalid passphrase. %s", invalidMsg))
+		return
+	}
+	if _, err := UserRepo.GetUserByEmail(r.Context(), invitation.Email); err == nil {
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusConflict, fmt.Sprintf("user %s already exist", invitation.Email), nil, nil)
+		return
+	}
+	user, err := UserRepo.CreateUserRecord(r.Context(), invitation.Email, req.Passphrase)
+	if err != nil {
+		fLog.Errorf("UserRepo.CreateUserRecord got %s", err.Error())
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusInternalServerError, err.Error(), nil, nil)
+		return
+	}
+	user.Enabled = true
+	user.ActivationDate = time.Now()
+	err = UserRepo.UpdateUser(r.Context(), user)
+	if err != nil {
+		fLog.Errorf("UserRepo.UpdateUser got %s", err.Error())
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusInternalServerError, err.Error(), nil, nil)
+		return
+	}
+	_, err = UserTenantRepo.CreateUserTenant(r.Context(), user, tenant)
+	if err != nil {
+		fLog.Errorf("UserTenantRepo.CreateUserTenant got %s", err.Error())
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusInternalServerError, err.Error(), nil, nil)
+		return
+	}
+	for _, groupID := range invitation.GroupRecIDs {
+		group, err := GroupRepo.GetGroupByRecID(r.Context(), groupID)
+		if err != nil {
+			fLog.Warnf("GroupRepo.GetGroupByRecID got %s, this group %s will not be joined by user %s", err.Error(), groupID, user.RecID)
+			continue
+		}
+		if _, err := UserGroupRepo.CreateUserGroup(r.Context(), user, group); err != nil {
+			fLog.Warnf("UserGroupRepo.CreateUserGroup got %s, this group %s will not be joined by user %s", err.Error(), groupID, user.RecID)
+		}
+	}
+	for _, roleID := range invitation.RoleRecIDs {
+		role, err := RoleRepo.GetRoleByRecID(r.Context(), roleID)
+		if err != nil {
+			fLog.Warnf("RoleRepo.GetRoleByRecID got %s, this role %s will not be assigned to user %s", err.Error(), roleID, user.RecID)
+			continue
+		}
+		if _, err := UserRoleRepo.CreateUserRole(r.Context(), user, role); err != nil {
+			fLog.Warnf("UserRoleRepo.CreateUserRole got %s, this role %s will not be assigned to user %s", err.Error(), roleID, user.RecID)
+		}
+	}
+	err = InvitationRepo.DeleteInvitation(r.Context(), invitation)
+	if err != nil {
+		fLog.Errorf("InvitationRepo.DeleteInvitation got %s", err.Error())
+	}
+	ret := make(map[string]interface{})
+	ret["rec_id"] = user.RecID
+	ret["email"] = user.Email
+	ret["enabled"] = user.Enabled
+	ret["suspended"] = user.Suspended
+	ret["last_seen"] = user.LastSeen
+	ret["last_login"] = user.LastLogin
+	ret["enabled_2fa"] = user.Enable2FactorAuth
+	audit(r, &connector.AuditEvent{
+		Event:        "invitation.accept",
+		Actor:        user.Email,
+		TargetType:   AuditTargetInvitation,
+		Target:       invitation.RecID,
+		TenantDomain: tenant.Domain,
+	}, nil, ret)
+	events.Publish(r.Context(), &events.UserCreated{User: user, Tenant: tenant, Source: events.SourceInvitation})
+	helper.WriteHTTPResponse(r.Context(), w, http.StatusOK, "Invitation accepted", nil, ret)
+}
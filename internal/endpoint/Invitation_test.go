@@ -0,0 +1,66 @@
+package endpoint
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hyperjumptech/hansip/internal/config"
+	"github.com/hyperjumptech/hansip/internal/connector"
+	"github.com/hyperjumptech/hansip/internal/mailer"
+)
+
+func TestInvitationExpiry(t *testing.T) {
+	expireAt, err := invitationExpiry(config.Settings{"invitation.expiry": "2 days"})
+	if err != nil {
+		t.Fatalf("got %s", err.Error())
+	}
+	if d := time.Until(expireAt); d < 47*time.Hour || d > 48*time.Hour {
+		t.Errorf("expect expiry in 2 days but in %s", d)
+	}
+	if _, err := invitationExpiry(config.Settings{"invitation.expiry": "soon"}); err == nil {
+		t.Errorf("invalid duration should be rejected")
+	}
+}
+
+func TestInvitationTemplate(t *testing.T) {
+	data := &invitationMail{
+		Invitation: &connector.Invitation{
+			Email:    "john@example.com",
+			Token:    "ABCDEF",
+			ExpireAt: time.Date(2020, 3, 1, 10, 0, 0, 0, time.UTC),
+		},
+		TenantName:   "Example",
+		TenantDomain: "example.com",
+	}
+	templates := mailer.Templates["INVITATION"]
+	subject := &bytes.Buffer{}
+	if err := templates.SubjectTemplate.Execute(subject, data); err != nil {
+		t.Fatalf("subject got %s", err.Error())
+	}
+	if !strings.Contains(subject.String(), "Example") {
+		t.Errorf("subject missing tenant name. got %s", subject.String())
+	}
+	body := &bytes.Buffer{}
+	if err := templates.BodyTemplate.Execute(body, data); err != nil {
+		t.Fatalf("body got %s", err.Error())
+	}
+	if !strings.Contains(body.String(), "ABCDEF") || !strings.Contains(body.String(), "john@example.com") {
+		t.Errorf("body missing token or email. got %s", body.String())
+	}
+}
+
+func TestNewInvitationToken(t *testing.T) {
+	token, hash, err := newInvitationToken()
+	if err != nil {
+		t.Fatalf("got %s", err.Error())
+	}
+	other, otherHash, _ := newInvitationToken()
+	if len(token) != 32 || token == other || hash == otherHash {
+		t.Errorf("expect distinct tokens of 32 characters but got %s and %s", token, other)
+	}
+	if len(hash) != 64 || hash == token || invitationTokenHash(token) != hash {
+		t.Errorf("expect the hex SHA-256 of the token but got %s", hash)
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"github.com/hyperjumptech/hansip/api"
 	"github.com/hyperjumptech/hansip/internal/config"
 	"github.com/hyperjumptech/hansip/internal/connector"
+	"github.com/hyperjumptech/hansip/internal/hansipcontext"
 )
 
 var (
@@ -20,12 +21,33 @@ var (
 	RoleRepo connector.RoleRepository
 	// UserGroupRepo is a user group repository instance
 	UserGroupRepo connector.UserGroupRepository
+	// UserTenantRepo is a user tenant repository instance
+	UserTenantRepo connector.UserTenantRepository
 	// UserRoleRepo is a user role repository instance
 	UserRoleRepo connector.UserRoleRepository
 	// GroupRoleRepo is a group role repository instance
 	GroupRoleRepo connector.GroupRoleRepository
 	// RevocationRepo is a revocation repository instance
 	RevocationRepo connector.RevocationRepository
+	// AttributeRepo is a user attribute repository instance
+	AttributeRepo connector.AttributeRepository
+	// InvitationRepo is an invitation repository instance
+	InvitationRepo connector.InvitationRepository
+	// AuditRepo is an audit event repository instance
+	AuditRepo connector.AuditRepository
+	// WebhookRepo is a webhook repository instance
+	WebhookRepo connector.WebhookRepository
+	// OutboxRepo is an outbox repository instance
+	OutboxRepo connector.OutboxRepository
+	// EmailTemplateRepo is an email template repository instance
+	EmailTemplateRepo connector.EmailTemplateRepository
+
+	// EmailOTPRepo is an email one time code repository instance
+	EmailOTPRepo connector.EmailOTPRepository
+	// WebAuthnRepo is a security key and passkey repository instance
+	WebAuthnRepo connector.WebAuthnRepository
+	// TxRepo runs the transactional endpoints in a database transaction
+	TxRepo connector.Transactor
 	// EmailSender is email sender instance
 	EmailSender connector.EmailSender
 
@@ -43,6 +65,15 @@ func init() {
 	hansipAdmin := fmt.Sprintf("%s@%s", config.Get("hansip.admin"), config.Get("hansip.domain"))
 	anyUser := "*@*"
 	adminUser := fmt.Sprintf("%s@*", config.Get("hansip.admin"))
+	userManagers := []string{adminUser, fmt.Sprintf("%s@*", hansipcontext.ScopeUserManager)}
+	groupManagers := []string{adminUser, fmt.Sprintf("%s@*", hansipcontext.ScopeGroupManager)}
+	roleManagers := []string{adminUser, fmt.Sprintf("%s@*", hansipcontext.ScopeRoleManager)}
+	userAuditors := []string{adminUser, fmt.Sprintf("%s@*", hansipcontext.ScopeUserManager), fmt.Sprintf("%s@*", hansipcontext.ScopeAuditor)}
+	auditors := []string{adminUser, fmt.Sprintf("%s@*", hansipcontext.ScopeAuditor)}
+	readers := []string{adminUser}
+	for _, scope := range hansipcontext.Scopes {
+		readers = append(readers, fmt.Sprintf("%s@*", scope))
+	}
 
 	Endpoints = []*Endpoint{
 		{"/docs/**/*", GetMethod, true, nil, api.ServeStatic},
@@ -50,71 +81,150 @@ func init() {
 		{fmt.Sprintf("%s/auth/authenticate", apiPrefix), OptionMethod | PostMethod, true, nil, Authentication},
 		{fmt.Sprintf("%s/auth/refresh", apiPrefix), OptionMethod | PostMethod, false, []string{anyUser}, Refresh},
 		{fmt.Sprintf("%s/auth/2fa", apiPrefix), OptionMethod | PostMethod, true, nil, TwoFA},
+		{fmt.Sprintf("%s/auth/2fa/email", apiPrefix), OptionMethod | PostMethod, true, nil, transactional(RequestEmailOTP)},
+		{fmt.Sprintf("%s/auth/2fa/webauthn", apiPrefix), OptionMethod | PostMethod, true, nil, Begin2FAWebAuthn},
+		{fmt.Sprintf("%s/auth/2fa/webauthn/finish", apiPrefix), OptionMethod | PostMethod, true, nil, Finish2FAWebAuthn},
+		{fmt.Sprintf("%s/auth/webauthn", apiPrefix), OptionMethod | PostMethod, true, nil, BeginWebAuthnLogin},
+		{fmt.Sprintf("%s/auth/webauthn/finish", apiPrefix), OptionMethod | PostMethod, true, nil, FinishWebAuthnLogin},
 		{fmt.Sprintf("%s/auth/2fatest", apiPrefix), OptionMethod | PostMethod, false, []string{anyUser}, TwoFATest},
 		{fmt.Sprintf("%s/auth/authenticate2fa", apiPrefix), OptionMethod | PostMethod, false, nil, Authentication2FA},
 
-		{fmt.Sprintf("%s/management/tenants", apiPrefix), OptionMethod | GetMethod, false, []string{adminUser}, ListAllTenants},
+		{fmt.Sprintf("%s/management/tenants", apiPrefix), OptionMethod | GetMethod, false, readers, ListAllTenants},
 		{fmt.Sprintf("%s/management/tenant", apiPrefix), OptionMethod | PostMethod, false, []string{hansipAdmin}, CreateNewTenant},
-		{fmt.Sprintf("%s/management/tenant/{tenantRecId}", apiPrefix), OptionMethod | GetMethod, false, []string{adminUser}, GetTenantDetail},
+		{fmt.Sprintf("%s/management/tenant/{tenantRecId}", apiPrefix), OptionMethod | GetMethod, false, readers, GetTenantDetail},
 		{fmt.Sprintf("%s/management/tenant/{tenantRecId}", apiPrefix), OptionMethod | PutMethod, false, []string{hansipAdmin}, UpdateTenantDetail},
+		{fmt.Sprintf("%s/management/tenant/{tenantRecId}", apiPrefix), OptionMethod | PatchMethod, false, []string{hansipAdmin}, UpdateTenantDetail},
 		{fmt.Sprintf("%s/management/tenant/{tenantRecId}", apiPrefix), OptionMethod | DeleteMethod, false, []string{hansipAdmin}, DeleteTenant},
+		{fmt.Sprintf("%s/management/tenant/{tenantRecId}/settings", apiPrefix), OptionMethod | GetMethod, false, []string{adminUser}, GetTenantSettings},
+		{fmt.Sprintf("%s/management/tenant/{tenantRecId}/settings", apiPrefix), OptionMethod | PutMethod, false, []string{adminUser}, transactional(SetTenantSettings)},
+		{fmt.Sprintf("%s/management/tenant/{tenantRecId}/settings", apiPrefix), OptionMethod | DeleteMethod, false, []string{adminUser}, DeleteTenantSettings},
+		{fmt.Sprintf("%s/management/tenant/{tenantRecId}/invitations", apiPrefix), OptionMethod | GetMethod, false, userAuditors, ListInvitations},
+		{fmt.Sprintf("%s/management/tenant/{tenantRecId}/attributes", apiPrefix), OptionMethod | GetMethod, false, readers, ListAttributeSchemas},
+		{fmt.Sprintf("%s/management/tenant/{tenantRecId}/attribute", apiPrefix), OptionMethod | PostMethod, false, []string{adminUser}, CreateAttributeSchema},
+		{fmt.Sprintf("%s/management/tenant/{tenantRecId}/attribute/{attributeRecId}", apiPrefix), OptionMethod | GetMethod, false, readers, GetAttributeSchema},
+		{fmt.Sprintf("%s/management/tenant/{tenantRecId}/attribute/{attributeRecId}", apiPrefix), OptionMethod | PutMethod, false, []string{adminUser}, UpdateAttributeSchema},
+		{fmt.Sprintf("%s/management/tenant/{tenantRecId}/attribute/{attributeRecId}", apiPrefix), OptionMethod | DeleteMethod, false, []string{adminUser}, DeleteAttributeSchema},
+		{fmt.Sprintf("%s/management/tenant/{tenantRecId}/user/{userRecId}/attributes", apiPrefix), OptionMethod | GetMethod, false, readers, GetUserAttributes},
+		{fmt.Sprintf("%s/management/tenant/{tenantRecId}/user/{userRecId}/attributes", apiPrefix), OptionMethod | PutMethod, false, userManagers, SetUserAttributes},
+		{fmt.Sprintf("%s/management/tenant/{tenantRecId}/email-templates", apiPrefix), OptionMethod | GetMethod, false, []string{adminUser}, ListEmailTemplates},
+		{fmt.Sprintf("%s/management/tenant/{tenantRecId}/email-template/{templateKey}", apiPrefix), OptionMethod | GetMethod, false, []string{adminUser}, GetEmailTemplate},
+		{fmt.Sprintf("%s/management/tenant/{tenantRecId}/email-template/{templateKey}", apiPrefix), OptionMethod | PutMethod, false, []string{adminUser}, transactional(SetEmailTemplate)},
+		{fmt.Sprintf("%s/management/tenant/{tenantRecId}/email-template/{templateKey}", apiPrefix), OptionMethod | DeleteMethod, false, []string{adminUser}, transactional(DeleteEmailTemplate)},
+		{fmt.Sprintf("%s/management/tenant/{tenantRecId}/email-template/{templateKey}/versions", apiPrefix), OptionMethod | GetMethod, false, []string{adminUser}, ListEmailTemplateVersions},
+		{fmt.Sprintf("%s/management/tenant/{tenantRecId}/email-template/{templateKey}/version/{version}/restore", apiPrefix), OptionMethod | PostMethod, false, []string{adminUser}, transactional(RestoreEmailTemplateVersion)},
+		{fmt.Sprintf("%s/management/tenant/{tenantRecId}/email-template/{templateKey}/preview", apiPrefix), OptionMethod | PostMethod, false, []string{adminUser}, PreviewEmailTemplate},
+		{fmt.Sprintf("%s/management/tenant/{tenantRecId}/webhooks", apiPrefix), OptionMethod | GetMethod, false, []string{adminUser}, ListWebhooks},
+		{fmt.Sprintf("%s/management/tenant/{tenantRecId}/webhook", apiPrefix), OptionMethod | PostMethod, false, []string{adminUser}, CreateWebhook},
+		{fmt.Sprintf("%s/management/tenant/{tenantRecId}/webhook/{webhookRecId}", apiPrefix), OptionMethod | GetMethod, false, []string{adminUser}, GetWebhook},
+		{fmt.Sprintf("%s/management/tenant/{tenantRecId}/webhook/{webhookRecId}", apiPrefix), OptionMethod | PutMethod, false, []string{adminUser}, UpdateWebhook},
+		{fmt.Sprintf("%s/management/tenant/{tenantRecId}/webhook/{webhookRecId}", apiPrefix), OptionMethod | DeleteMethod, false, []string{adminUser}, DeleteWebhook},
+		{fmt.Sprintf("%s/management/tenant/{tenantRecId}/webhook/{webhookRecId}/deliveries", apiPrefix), OptionMethod | GetMethod, false, []string{adminUser}, ListWebhookDeliveries},
+		{fmt.Sprintf("%s/management/tenant/{tenantRecId}/webhook/{webhookRecId}/delivery/{deliveryRecId}/redeliver", apiPrefix), OptionMethod | PostMethod, false, []string{adminUser}, RedeliverWebhook},
 
-		{fmt.Sprintf("%s/management/users", apiPrefix), OptionMethod | GetMethod, false, []string{adminUser}, ListAllUsers},
-		{fmt.Sprintf("%s/management/user", apiPrefix), OptionMethod | PostMethod, false, []string{adminUser}, CreateNewUser},
+		{fmt.Sprintf("%s/management/users", apiPrefix), OptionMethod | GetMethod, false, readers, ListAllUsers},
+		{fmt.Sprintf("%s/management/users/import", apiPrefix), OptionMethod | PostMethod, false, userManagers, transactional(ImportUsersHandler)},
+		{fmt.Sprintf("%s/management/users/export", apiPrefix), OptionMethod | GetMethod, false, userAuditors, ExportUsersHandler},
+		{fmt.Sprintf("%s/management/user", apiPrefix), OptionMethod | PostMethod, false, userManagers, transactional(CreateNewUser)},
 		{fmt.Sprintf("%s/management/user/{userRecId}/passwd", apiPrefix), OptionMethod | PostMethod, false, nil, ChangePassphrase},
 		{fmt.Sprintf("%s/management/user/activate", apiPrefix), OptionMethod | PostMethod, true, []string{adminUser}, ActivateUser},
+		{fmt.Sprintf("%s/management/invitation", apiPrefix), OptionMethod | PostMethod, false, userManagers, transactional(CreateInvitation)},
+		{fmt.Sprintf("%s/management/invitation/accept", apiPrefix), OptionMethod | PostMethod, true, nil, transactional(AcceptInvitation)},
+		{fmt.Sprintf("%s/management/invitation/{invitationRecId}/resend", apiPrefix), OptionMethod | PostMethod, false, userManagers, transactional(ResendInvitation)},
+		{fmt.Sprintf("%s/management/invitation/{invitationRecId}", apiPrefix), OptionMethod | DeleteMethod, false, userManagers, RevokeInvitation},
 		{fmt.Sprintf("%s/management/user/whoami", apiPrefix), OptionMethod | GetMethod, false, []string{anyUser}, WhoAmI},
 		{fmt.Sprintf("%s/management/user/2FAQR", apiPrefix), OptionMethod | GetMethod, false, nil, Show2FAQrCode},
 		{fmt.Sprintf("%s/management/user/activate2FA", apiPrefix), OptionMethod | PostMethod, false, nil, Activate2FA},
-		{fmt.Sprintf("%s/management/user/{userRecId}", apiPrefix), OptionMethod | GetMethod, false, []string{adminUser}, GetUserDetail},
-		{fmt.Sprintf("%s/management/user/{userRecId}", apiPrefix), OptionMethod | PutMethod, false, []string{adminUser}, UpdateUserDetail},
-		{fmt.Sprintf("%s/management/user/{userRecId}", apiPrefix), OptionMethod | DeleteMethod, false, []string{adminUser}, DeleteUser},
-		{fmt.Sprintf("%s/management/user/{userRecId}/roles", apiPrefix), OptionMethod | GetMethod, false, []string{adminUser}, ListUserRole},
-		{fmt.Sprintf("%s/management/user/{userRecId}/roles", apiPrefix), OptionMethod | PutMethod, false, []string{adminUser}, SetUserRoles},
-		{fmt.Sprintf("%s/management/user/{userRecId}/roles", apiPrefix), OptionMethod | DeleteMethod, false, []string{adminUser}, DeleteUserRoles},
-		{fmt.Sprintf("%s/management/user/{userRecId}/all-roles", apiPrefix), OptionMethod | GetMethod, false, []string{adminUser}, ListAllUserRole},
-		{fmt.Sprintf("%s/management/user/{userRecId}/role/{roleRecId}", apiPrefix), OptionMethod | PutMethod, false, []string{adminUser}, CreateUserRole},
-		{fmt.Sprintf("%s/management/user/{userRecId}/role/{roleRecId}", apiPrefix), OptionMethod | DeleteMethod, false, []string{adminUser}, DeleteUserRole},
-		{fmt.Sprintf("%s/management/user/{userRecId}/groups", apiPrefix), OptionMethod | GetMethod, false, []string{adminUser}, ListUserGroup},
-		{fmt.Sprintf("%s/management/user/{userRecId}/groups", apiPrefix), OptionMethod | PutMethod, false, []string{adminUser}, SetUserGroups},
-		{fmt.Sprintf("%s/management/user/{userRecId}/groups", apiPrefix), OptionMethod | DeleteMethod, false, []string{adminUser}, DeleteUserGroups},
-		{fmt.Sprintf("%s/management/user/{userRecId}/group/{groupRecId}", apiPrefix), OptionMethod | PutMethod, false, []string{adminUser}, CreateUserGroup},
-		{fmt.Sprintf("%s/management/user/{userRecId}/group/{groupRecId}", apiPrefix), OptionMethod | DeleteMethod, false, []string{adminUser}, DeleteUserGroup},
-
-		{fmt.Sprintf("%s/management/tenant/{tenantRecId}/groups", apiPrefix), OptionMethod | GetMethod, false, []string{adminUser}, ListAllGroup},
-		{fmt.Sprintf("%s/management/group", apiPrefix), OptionMethod | PostMethod, false, []string{adminUser}, CreateNewGroup},
-		{fmt.Sprintf("%s/management/group/{groupRecId}", apiPrefix), OptionMethod | GetMethod, false, []string{adminUser}, GetGroupDetail},
-		{fmt.Sprintf("%s/management/group/{groupRecId}", apiPrefix), OptionMethod | DeleteMethod, false, []string{adminUser}, DeleteGroup},
-		{fmt.Sprintf("%s/management/group/{groupRecId}", apiPrefix), OptionMethod | PutMethod, false, []string{adminUser}, UpdateGroup},
-		{fmt.Sprintf("%s/management/group/{groupRecId}/users", apiPrefix), OptionMethod | GetMethod, false, []string{adminUser}, ListGroupUser},
-		{fmt.Sprintf("%s/management/group/{groupRecId}/users", apiPrefix), OptionMethod | PutMethod, false, []string{adminUser}, SetGroupUsers},
-		{fmt.Sprintf("%s/management/group/{groupRecId}/users", apiPrefix), OptionMethod | DeleteMethod, false, []string{adminUser}, DeleteGroupUsers},
-		{fmt.Sprintf("%s/management/group/{groupRecId}/user/{userRecId}", apiPrefix), OptionMethod | PutMethod, false, []string{adminUser}, CreateGroupUser},
-		{fmt.Sprintf("%s/management/group/{groupRecId}/user/{userRecId}", apiPrefix), OptionMethod | DeleteMethod, false, []string{adminUser}, DeleteGroupUser},
-		{fmt.Sprintf("%s/management/group/{groupRecId}/roles", apiPrefix), OptionMethod | GetMethod, false, []string{adminUser}, ListGroupRole},
-		{fmt.Sprintf("%s/management/group/{groupRecId}/roles", apiPrefix), OptionMethod | PutMethod, false, []string{adminUser}, SetGroupRoles},
-		{fmt.Sprintf("%s/management/group/{groupRecId}/roles", apiPrefix), OptionMethod | DeleteMethod, false, []string{adminUser}, DeleteGroupRoles},
-		{fmt.Sprintf("%s/management/group/{groupRecId}/role/{roleRecId}", apiPrefix), OptionMethod | PutMethod, false, []string{adminUser}, CreateGroupRole},
-		{fmt.Sprintf("%s/management/group/{groupRecId}/role/{roleRecId}", apiPrefix), OptionMethod | DeleteMethod, false, []string{adminUser}, DeleteGroupRole},
-
-		{fmt.Sprintf("%s/management/tenant/{tenantRecId}/roles", apiPrefix), OptionMethod | GetMethod, false, []string{adminUser}, ListAllRole},
-		{fmt.Sprintf("%s/management/role", apiPrefix), OptionMethod | PostMethod, false, []string{adminUser}, CreateRole},
-		{fmt.Sprintf("%s/management/role/{roleRecId}", apiPrefix), OptionMethod | GetMethod, false, []string{adminUser}, GetRoleDetail},
-		{fmt.Sprintf("%s/management/role/{roleRecId}", apiPrefix), OptionMethod | DeleteMethod, false, []string{adminUser}, DeleteRole},
-		{fmt.Sprintf("%s/management/role/{roleRecId}", apiPrefix), OptionMethod | PutMethod, false, []string{adminUser}, UpdateRole},
-		{fmt.Sprintf("%s/management/role/{roleRecId}/users", apiPrefix), OptionMethod | GetMethod, false, []string{adminUser}, ListRoleUser},
-		{fmt.Sprintf("%s/management/role/{roleRecId}/users", apiPrefix), OptionMethod | PutMethod, false, []string{adminUser}, SetRoleUsers},
-		{fmt.Sprintf("%s/management/role/{roleRecId}/users", apiPrefix), OptionMethod | DeleteMethod, false, []string{adminUser}, DeleteRoleUsers},
-		{fmt.Sprintf("%s/management/role/{roleRecId}/user/{userRecId}", apiPrefix), OptionMethod | PutMethod, false, []string{adminUser}, CreateRoleUser},
-		{fmt.Sprintf("%s/management/role/{roleRecId}/user/{userRecId}", apiPrefix), OptionMethod | DeleteMethod, false, []string{adminUser}, DeleteRoleUser},
-		{fmt.Sprintf("%s/management/role/{roleRecId}/groups", apiPrefix), OptionMethod | GetMethod, false, []string{adminUser}, ListRoleGroup},
-		{fmt.Sprintf("%s/management/role/{roleRecId}/groups", apiPrefix), OptionMethod | PutMethod, false, []string{adminUser}, SetRoleGroups},
-		{fmt.Sprintf("%s/management/role/{roleRecId}/groups", apiPrefix), OptionMethod | DeleteMethod, false, []string{adminUser}, DeleteRoleGroups},
-		{fmt.Sprintf("%s/management/role/{roleRecId}/group/{groupRecId}", apiPrefix), OptionMethod | PutMethod, false, []string{adminUser}, CreateRoleGroup},
-		{fmt.Sprintf("%s/management/role/{roleRecId}/group/{GroupRecID}", apiPrefix), OptionMethod | DeleteMethod, false, []string{adminUser}, DeleteRoleGroup},
-
-		{fmt.Sprintf("%s/recovery/recoverPassphrase", apiPrefix), OptionMethod | PostMethod, true, nil, RecoverPassphrase},
+		{fmt.Sprintf("%s/management/user/2FAEmail", apiPrefix), OptionMethod | PostMethod, false, nil, transactional(Send2FAEmailActivation)},
+		{fmt.Sprintf("%s/management/user/activate2FAEmail", apiPrefix), OptionMethod | PostMethod, false, nil, Activate2FAEmail},
+		{fmt.Sprintf("%s/management/user/webauthn/stepup", apiPrefix), OptionMethod | PostMethod, false, nil, BeginWebAuthnStepUp},
+		{fmt.Sprintf("%s/management/user/webauthn/register", apiPrefix), OptionMethod | PostMethod, false, nil, BeginWebAuthnRegistration},
+		{fmt.Sprintf("%s/management/user/webauthn/register/finish", apiPrefix), OptionMethod | PostMethod, false, nil, transactional(FinishWebAuthnRegistration)},
+		{fmt.Sprintf("%s/management/user/webauthn/credentials", apiPrefix), OptionMethod | GetMethod, false, nil, ListWebAuthnCredentials},
+		{fmt.Sprintf("%s/management/user/webauthn/credential/{credentialRecId}", apiPrefix), OptionMethod | PutMethod, false, nil, transactional(RenameWebAuthnCredential)},
+		{fmt.Sprintf("%s/management/user/webauthn/credential/{credentialRecId}", apiPrefix), OptionMethod | DeleteMethod, false, nil, transactional(DeleteWebAuthnCredential)},
+		{fmt.Sprintf("%s/management/user/{userRecId}", apiPrefix), OptionMethod | GetMethod, false, readers, GetUserDetail},
+		{fmt.Sprintf("%s/management/user/{userRecId}", apiPrefix), OptionMethod | PutMethod, false, userManagers, transactional(UpdateUserDetail)},
+		{fmt.Sprintf("%s/management/user/{userRecId}", apiPrefix), OptionMethod | PatchMethod, false, userManagers, transactional(UpdateUserDetail)},
+		{fmt.Sprintf("%s/management/user/{userRecId}", apiPrefix), OptionMethod | DeleteMethod, false, userManagers, transactional(DeleteUser)},
+		{fmt.Sprintf("%s/management/user/{userRecId}/roles", apiPrefix), OptionMethod | GetMethod, false, readers, ListUserRole},
+		{fmt.Sprintf("%s/management/user/{userRecId}/roles", apiPrefix), OptionMethod | PutMethod, false, roleManagers, transactional(SetUserRoles)},
+		{fmt.Sprintf("%s/management/user/{userRecId}/roles", apiPrefix), OptionMethod | DeleteMethod, false, roleManagers, transactional(DeleteUserRoles)},
+		{fmt.Sprintf("%s/management/user/{userRecId}/all-roles", apiPrefix), OptionMethod | GetMethod, false, readers, ListAllUserRole},
+		{fmt.Sprintf("%s/management/user/{userRecId}/role/{roleRecId}", apiPrefix), OptionMethod | PutMethod, false, roleManagers, transactional(CreateUserRole)},
+		{fmt.Sprintf("%s/management/user/{userRecId}/role/{roleRecId}", apiPrefix), OptionMethod | DeleteMethod, false, roleManagers, transactional(DeleteUserRole)},
+		{fmt.Sprintf("%s/management/user/{userRecId}/groups", apiPrefix), OptionMethod | GetMethod, false, readers, ListUserGroup},
+		{fmt.Sprintf("%s/management/user/{userRecId}/groups", apiPrefix), OptionMethod | PutMethod, false, groupManagers, SetUserGroups},
+		{fmt.Sprintf("%s/management/user/{userRecId}/groups", apiPrefix), OptionMethod | DeleteMethod, false, groupManagers, DeleteUserGroups},
+		{fmt.Sprintf("%s/management/user/{userRecId}/group/{groupRecId}", apiPrefix), OptionMethod | PutMethod, false, groupManagers, CreateUserGroup},
+		{fmt.Sprintf("%s/management/user/{userRecId}/group/{groupRecId}", apiPrefix), OptionMethod | DeleteMethod, false, groupManagers, DeleteUserGroup},
+		{fmt.Sprintf("%s/management/user/{userRecId}/tenants", apiPrefix), OptionMethod | GetMethod, false, readers, ListUserTenant},
+		{fmt.Sprintf("%s/management/user/{userRecId}/tenant/{tenantRecId}", apiPrefix), OptionMethod | PutMethod, false, userManagers, CreateUserTenant},
+		{fmt.Sprintf("%s/management/user/{userRecId}/tenant/{tenantRecId}", apiPrefix), OptionMethod | DeleteMethod, false, userManagers, DeleteUserTenant},
+		{fmt.Sprintf("%s/management/user/{userRecId}/webauthn/credentials", apiPrefix), OptionMethod | GetMethod, false, readers, ListUserWebAuthnCredentials},
+		{fmt.Sprintf("%s/management/user/{userRecId}/webauthn/credential/{credentialRecId}", apiPrefix), OptionMethod | DeleteMethod, false, userManagers, transactional(DeleteUserWebAuthnCredential)},
+
+		{fmt.Sprintf("%s/management/tenant/{tenantRecId}/groups", apiPrefix), OptionMethod | GetMethod, false, readers, ListAllGroup},
+		{fmt.Sprintf("%s/management/group", apiPrefix), OptionMethod | PostMethod, false, groupManagers, CreateNewGroup},
+		{fmt.Sprintf("%s/management/group/{groupRecId}", apiPrefix), OptionMethod | GetMethod, false, readers, GetGroupDetail},
+		{fmt.Sprintf("%s/management/group/{groupRecId}", apiPrefix), OptionMethod | DeleteMethod, false, groupManagers, DeleteGroup},
+		{fmt.Sprintf("%s/management/group/{groupRecId}", apiPrefix), OptionMethod | PutMethod, false, groupManagers, UpdateGroup},
+		{fmt.Sprintf("%s/management/group/{groupRecId}", apiPrefix), OptionMethod | PatchMethod, false, groupManagers, UpdateGroup},
+		{fmt.Sprintf("%s/management/group/{groupRecId}/users", apiPrefix), OptionMethod | GetMethod, false, readers, ListGroupUser},
+		{fmt.Sprintf("%s/management/group/{groupRecId}/users", apiPrefix), OptionMethod | PutMethod, false, groupManagers, SetGroupUsers},
+		{fmt.Sprintf("%s/management/group/{groupRecId}/users", apiPrefix), OptionMethod | DeleteMethod, false, groupManagers, DeleteGroupUsers},
+		{fmt.Sprintf("%s/management/group/{groupRecId}/user/{userRecId}", apiPrefix), OptionMethod | PutMethod, false, groupManagers, CreateGroupUser},
+		{fmt.Sprintf("%s/management/group/{groupRecId}/user/{userRecId}", apiPrefix), OptionMethod | DeleteMethod, false, groupManagers, DeleteGroupUser},
+		{fmt.Sprintf("%s/management/group/{groupRecId}/roles", apiPrefix), OptionMethod | GetMethod, false, readers, ListGroupRole},
+		{fmt.Sprintf("%s/management/group/{groupRecId}/roles", apiPrefix), OptionMethod | PutMethod, false, roleManagers, SetGroupRoles},
+		{fmt.Sprintf("%s/management/group/{groupRecId}/roles", apiPrefix), OptionMethod | DeleteMethod, false, roleManagers, DeleteGroupRoles},
+		{fmt.Sprintf("%s/management/group/{groupRecId}/role/{roleRecId}", apiPrefix), OptionMethod | PutMethod, false, roleManagers, CreateGroupRole},
+		{fmt.Sprintf("%s/management/group/{groupRecId}/role/{roleRecId}", apiPrefix), OptionMethod | DeleteMethod, false, roleManagers, DeleteGroupRole},
+
+		{fmt.Sprintf("%s/management/tenant/{tenantRecId}/roles", apiPrefix), OptionMethod | GetMethod, false, readers, ListAllRole},
+		{fmt.Sprintf("%s/management/role", apiPrefix), OptionMethod | PostMethod, false, roleManagers, CreateRole},
+		{fmt.Sprintf("%s/management/role/{roleRecId}", apiPrefix), OptionMethod | GetMethod, false, readers, GetRoleDetail},
+		{fmt.Sprintf("%s/management/role/{roleRecId}", apiPrefix), OptionMethod | DeleteMethod, false, roleManagers, DeleteRole},
+		{fmt.Sprintf("%s/management/role/{roleRecId}", apiPrefix), OptionMethod | PutMethod, false, roleManagers, UpdateRole},
+		{fmt.Sprintf("%s/management/role/{roleRecId}", apiPrefix), OptionMethod | PatchMethod, false, roleManagers, UpdateRole},
+		{fmt.Sprintf("%s/management/role/{roleRecId}/users", apiPrefix), OptionMethod | GetMethod, false, readers, ListRoleUser},
+		{fmt.Sprintf("%s/management/role/{roleRecId}/users", apiPrefix), OptionMethod | PutMethod, false, roleManagers, transactional(SetRoleUsers)},
+		{fmt.Sprintf("%s/management/role/{roleRecId}/users", apiPrefix), OptionMethod | DeleteMethod, false, roleManagers, transactional(DeleteRoleUsers)},
+		{fmt.Sprintf("%s/management/role/{roleRecId}/user/{userRecId}", apiPrefix), OptionMethod | PutMethod, false, roleManagers, transactional(CreateRoleUser)},
+		{fmt.Sprintf("%s/management/role/{roleRecId}/user/{userRecId}", apiPrefix), OptionMethod | DeleteMethod, false, roleManagers, transactional(DeleteRoleUser)},
+		{fmt.Sprintf("%s/management/role/{roleRecId}/groups", apiPrefix), OptionMethod | GetMethod, false, readers, ListRoleGroup},
+		{fmt.Sprintf("%s/management/role/{roleRecId}/groups", apiPrefix), OptionMethod | PutMethod, false, roleManagers, SetRoleGroups},
+		{fmt.Sprintf("%s/management/role/{roleRecId}/groups", apiPrefix), OptionMethod | DeleteMethod, false, roleManagers, DeleteRoleGroups},
+		{fmt.Sprintf("%s/management/role/{roleRecId}/group/{groupRecId}", apiPrefix), OptionMethod | PutMethod, false, roleManagers, CreateRoleGroup},
+		{fmt.Sprintf("%s/management/role/{roleRecId}/group/{GroupRecID}", apiPrefix), OptionMethod | DeleteMethod, false, roleManagers, DeleteRoleGroup},
+
+		{fmt.Sprintf("%s/management/audit", apiPrefix), OptionMethod | GetMethod, false, auditors, ListAuditEvents},
+		{fmt.Sprintf("%s/management/audit/export", apiPrefix), OptionMethod | GetMethod, false, auditors, ExportAuditEvents},
+		{fmt.Sprintf("%s/management/audit/verify", apiPrefix), OptionMethod | GetMethod, false, auditors, VerifyAuditLog},
+		{fmt.Sprintf("%s/management/events/metrics", apiPrefix), OptionMethod | GetMethod, false, []string{hansipAdmin}, EventMetrics},
+		{fmt.Sprintf("%s/management/outbox", apiPrefix), OptionMethod | GetMethod, false, []string{hansipAdmin}, ListOutboxMessages},
+		{fmt.Sprintf("%s/management/outbox/retry", apiPrefix), OptionMethod | PostMethod, false, []string{hansipAdmin}, RetryDeadOutboxMessages},
+		{fmt.Sprintf("%s/management/outbox/{messageRecId}", apiPrefix), OptionMethod | GetMethod, false, []string{hansipAdmin}, GetOutboxMessage},
+		{fmt.Sprintf("%s/management/outbox/{messageRecId}/retry", apiPrefix), OptionMethod | PostMethod, false, []string{hansipAdmin}, RetryOutboxMessage},
+
+		{fmt.Sprintf("%s/recovery/recoverPassphrase", apiPrefix), OptionMethod | PostMethod, true, nil, transactional(RecoverPassphrase)},
 		{fmt.Sprintf("%s/recovery/resetPassphrase", apiPrefix), OptionMethod | PostMethod, true, nil, ResetPassphrase},
+
+		{fmt.Sprintf("%s/ServiceProviderConfig", scimPrefix), OptionMethod | GetMethod, true, nil, ScimServiceProviderConfig},
+		{fmt.Sprintf("%s/Schemas", scimPrefix), OptionMethod | GetMethod, true, nil, ScimSchemas},
+		{fmt.Sprintf("%s/Schemas/{schemaId}", scimPrefix), OptionMethod | GetMethod, true, nil, ScimSchema},
+		{fmt.Sprintf("%s/ResourceTypes", scimPrefix), OptionMethod | GetMethod, true, nil, ScimResourceTypes},
+		{fmt.Sprintf("%s/Users", scimPrefix), OptionMethod | GetMethod, false, []string{adminUser}, ScimListUsers},
+		{fmt.Sprintf("%s/Users", scimPrefix), OptionMethod | PostMethod, false, []string{adminUser}, transactional(ScimCreateUser)},
+		{fmt.Sprintf("%s/Users/{userRecId}", scimPrefix), OptionMethod | GetMethod, false, []string{adminUser}, ScimGetUser},
+		{fmt.Sprintf("%s/Users/{userRecId}", scimPrefix), OptionMethod | PutMethod, false, []string{adminUser}, transactional(ScimReplaceUser)},
+		{fmt.Sprintf("%s/Users/{userRecId}", scimPrefix), OptionMethod | PatchMethod, false, []string{adminUser}, transactional(ScimPatchUser)},
+		{fmt.Sprintf("%s/Users/{userRecId}", scimPrefix), OptionMethod | DeleteMethod, false, []string{adminUser}, transactional(ScimDeleteUser)},
+		{fmt.Sprintf("%s/Groups", scimPrefix), OptionMethod | GetMethod, false, []string{adminUser}, ScimListGroups},
+		{fmt.Sprintf("%s/Groups", scimPrefix), OptionMethod | PostMethod, false, []string{adminUser}, transactional(ScimCreateGroup)},
+		{fmt.Sprintf("%s/Groups/{groupRecId}", scimPrefix), OptionMethod | GetMethod, false, []string{adminUser}, ScimGetGroup},
+		{fmt.Sprintf("%s/Groups/{groupRecId}", scimPrefix), OptionMethod | PutMethod, false, []string{adminUser}, transactional(ScimReplaceGroup)},
+		{fmt.Sprintf("%s/Groups/{groupRecId}", scimPrefix), OptionMethod | PatchMethod, false, []string{adminUser}, transactional(ScimPatchGroup)},
+		{fmt.Sprintf("%s/Groups/{groupRecId}", scimPrefix), OptionMethod | DeleteMethod, false, []string{adminUser}, transactional(ScimDeleteGroup)},
 	}
 }
 
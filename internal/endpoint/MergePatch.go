@@ -0,0 +1,152 @@
+package endpoint
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/hyperjumptech/hansip/internal/mailer"
+)
+
+// mergePatch applies JSON merge patch (RFC 7396) onto the target document.
+// Members of the patch replace the members of the target, nested objects are merged recursively
+// and null removes the member. A patch that is not an object replaces the whole target.
+func mergePatch(target, patch interface{}) interface{} {
+	patchObj, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	targetObj, ok := target.(map[string]interface{})
+	if !ok {
+		targetObj = make(map[string]interface{})
+	}
+	for key, value := range patchObj {
+		if value == nil {
+			delete(targetObj, key)
+		} else {
+			targetObj[key] = mergePatch(targetObj[key], value)
+		}
+	}
+	return targetObj
+}
+
+// applyMergePatch applies the merge patch document onto the current values of the record and decodes the result into req.
+// Members req does not know are rejected, members removed by the patch are left to their zero value.
+func applyMergePatch(req, current interface{}, patch []byte) error {
+	var patchDoc interface{}
+	if err := json.Unmarshal(patch, &patchDoc); err != nil {
+		return err
+	}
+	if _, ok := patchDoc.(map[string]interface{}); !ok {
+		return fmt.Errorf("merge patch must be a json object")
+	}
+	currentJSON, err := json.Marshal(current)
+	if err != nil {
+		return err
+	}
+	var targetDoc interface{}
+	if err := json.Unmarshal(currentJSON, &targetDoc); err != nil {
+		return err
+	}
+	merged, err := json.Marshal(mergePatch(targetDoc, patchDoc))
+	if err != nil {
+		return err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(merged))
+	decoder.DisallowUnknownFields()
+	return decoder.Decode(req)
+}
+
+// readUpdateRequest reads the body of update request into req and returns the http status to respond if it fails.
+// PUT body is the whole new record while PATCH body is a merge patch applied over the current values of the record.
+func readUpdateRequest(r *http.Request, req, current interface{}) (int, error) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	if r.Method == http.MethodPatch {
+		err = applyMergePatch(req, current, body)
+	} else {
+		err = json.Unmarshal(body, req)
+	}
+	if err != nil {
+		return http.StatusBadRequest, err
+	}
+	return http.StatusOK, nil
+}
+
+// validateUpdateUserRequest validates the fields of user update
+func validateUpdateUserRequest(req *UpdateUserRequest) error {
+	if err := validateEmail(req.Email); err != nil {
+		return err
+	}
+	return validateLocale(req.Locale)
+}
+
+// validateLocale checks the locale is empty or a language tag, eg. id or en-US
+func validateLocale(locale string) error {
+	if len(locale) == 0 {
+		return nil
+	}
+	if _, ok := mailer.NormalizeLocale(locale); !ok {
+		return fmt.Errorf("invalid locale %s", locale)
+	}
+	return nil
+}
+
+// validateEmail checks the email is present and looks like an email address
+func validateEmail(email string) error {
+	trimmed := strings.TrimSpace(email)
+	if len(trimmed) == 0 {
+		return fmt.Errorf("email is required")
+	}
+	if !strings.Contains(trimmed, "@") || strings.ContainsAny(trimmed, " \t\r\n") {
+		return fmt.Errorf("invalid email %s", email)
+	}
+	return nil
+}
+
+// validateGroupRequest validates the fields of group creation or update
+func validateGroupRequest(req *CreateGroupRequest) error {
+	if len(strings.TrimSpace(req.GroupName)) == 0 {
+		return fmt.Errorf("group_name is required")
+	}
+	if len(strings.TrimSpace(req.GroupDomain)) == 0 {
+		return fmt.Errorf("group_domain is required")
+	}
+	if strings.Contains(req.GroupName, "@") || strings.Contains(req.GroupDomain, "@") {
+		return fmt.Errorf("group_name or group_domain contains @")
+	}
+	return nil
+}
+
+// validateRoleRequest validates the fields of role creation or update
+func validateRoleRequest(req *CreateRoleRequest) error {
+	if len(strings.TrimSpace(req.RoleName)) == 0 {
+		return fmt.Errorf("role_name is required")
+	}
+	if len(strings.TrimSpace(req.RoleDomain)) == 0 {
+		return fmt.Errorf("role_domain is required")
+	}
+	if strings.Contains(req.RoleName, "@") || strings.Contains(req.RoleDomain, "@") {
+		return fmt.Errorf("role_name or role_domain contains @")
+	}
+	return nil
+}
+
+// validateTenantRequest validates the fields of tenant creation or update
+func validateTenantRequest(req *CreateTenantRequest) error {
+	if len(strings.TrimSpace(req.TenantName)) == 0 {
+		return fmt.Errorf("name is required")
+	}
+	if len(strings.TrimSpace(req.TenantDomain)) == 0 {
+		return fmt.Errorf("domain is required")
+	}
+	if strings.Contains(req.TenantDomain, "@") {
+		return fmt.Errorf("domain contains @")
+	}
+	return nil
+}
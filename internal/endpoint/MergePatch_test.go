@@ -0,0 +1,107 @@
+package endpoint
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMergePatch(t *testing.T) {
+	// examples from RFC 7396 appendix A
+	testData := []struct {
+		target string
+		patch  string
+		expect string
+	}{
+		{`{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"b"}`, `{"b":"c"}`, `{"a":"b","b":"c"}`},
+		{`{"a":"b"}`, `{"a":null}`, `{}`},
+		{`{"a":"b","b":"c"}`, `{"a":null}`, `{"b":"c"}`},
+		{`{"a":["b"]}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"c"}`, `{"a":["b"]}`, `{"a":["b"]}`},
+		{`{"a":{"b":"c"}}`, `{"a":{"b":"d","c":null}}`, `{"a":{"b":"d"}}`},
+		{`{"a":[{"b":"c"}]}`, `{"a":[1]}`, `{"a":[1]}`},
+		{`["a","b"]`, `["c","d"]`, `["c","d"]`},
+		{`{"a":"b"}`, `["c"]`, `["c"]`},
+		{`{"a":"foo"}`, `null`, `null`},
+		{`{"a":"foo"}`, `"bar"`, `"bar"`},
+		{`{"e":null}`, `{"a":1}`, `{"a":1,"e":null}`},
+		{`[1,2]`, `{"a":"b","c":null}`, `{"a":"b"}`},
+		{`{}`, `{"a":{"bb":{"ccc":null}}}`, `{"a":{"bb":{}}}`},
+	}
+	for i, td := range testData {
+		var target, patch, expect interface{}
+		_ = json.Unmarshal([]byte(td.target), &target)
+		_ = json.Unmarshal([]byte(td.patch), &patch)
+		_ = json.Unmarshal([]byte(td.expect), &expect)
+		if got := mergePatch(target, patch); !reflect.DeepEqual(got, expect) {
+			t.Errorf("#%d expect %v but %v", i, expect, got)
+		}
+	}
+}
+
+func TestReadUpdateRequest(t *testing.T) {
+	current := &UpdateUserRequest{Email: "john@example.com", Enabled: false, Suspended: true, Enable2FA: true}
+	testData := []struct {
+		method string
+		body   string
+		status int
+		expect UpdateUserRequest
+	}{
+		{http.MethodPatch, `{"enabled":true}`, http.StatusOK, UpdateUserRequest{Email: "john@example.com", Enabled: true, Suspended: true, Enable2FA: true}},
+		{http.MethodPatch, `{"suspended":null,"email":"jane@example.com"}`, http.StatusOK, UpdateUserRequest{Email: "jane@example.com", Enable2FA: true}},
+		{http.MethodPatch, `{}`, http.StatusOK, *current},
+		{http.MethodPatch, `{"emial":"jane@example.com"}`, http.StatusBadRequest, UpdateUserRequest{}},
+		{http.MethodPatch, `{"enabled":"yes"}`, http.StatusBadRequest, UpdateUserRequest{}},
+		{http.MethodPatch, `[{"op":"replace","path":"/enabled","value":true}]`, http.StatusBadRequest, UpdateUserRequest{}},
+		{http.MethodPut, `{"enabled":true}`, http.StatusOK, UpdateUserRequest{Enabled: true}},
+	}
+	for i, td := range testData {
+		r := httptest.NewRequest(td.method, "/api/v1/management/user/abc", strings.NewReader(td.body))
+		req := &UpdateUserRequest{}
+		status, err := readUpdateRequest(r, req, current)
+		if status != td.status {
+			t.Errorf("#%d expect status %d but %d (%v)", i, td.status, status, err)
+			continue
+		}
+		if status == http.StatusOK && *req != td.expect {
+			t.Errorf("#%d expect %+v but %+v", i, td.expect, *req)
+		}
+	}
+}
+
+func TestValidateUpdateRequest(t *testing.T) {
+	if err := validateUpdateUserRequest(&UpdateUserRequest{Email: "john@example.com"}); err != nil {
+		t.Errorf("valid email rejected. got %s", err.Error())
+	}
+	for _, email := range []string{"", "  ", "john", "john doe@example.com"} {
+		if err := validateUpdateUserRequest(&UpdateUserRequest{Email: email}); err == nil {
+			t.Errorf("email %q should be rejected", email)
+		}
+	}
+	for _, locale := range []string{"", "id", "en-US", "en_us"} {
+		if err := validateUpdateUserRequest(&UpdateUserRequest{Email: "john@example.com", Locale: locale}); err != nil {
+			t.Errorf("locale %q rejected. got %s", locale, err.Error())
+		}
+	}
+	for _, locale := range []string{"indonesian", "e", "en-", "id';--"} {
+		if err := validateUpdateUserRequest(&UpdateUserRequest{Email: "john@example.com", Locale: locale}); err == nil {
+			t.Errorf("locale %q should be rejected", locale)
+		}
+	}
+	if err := validateGroupRequest(&CreateGroupRequest{GroupName: "admins", GroupDomain: "example.com"}); err != nil {
+		t.Errorf("valid group rejected. got %s", err.Error())
+	}
+	if err := validateGroupRequest(&CreateGroupRequest{GroupDomain: "example.com"}); err == nil {
+		t.Errorf("group without name should be rejected")
+	}
+	if err := validateRoleRequest(&CreateRoleRequest{RoleName: "admin@x", RoleDomain: "example.com"}); err == nil {
+		t.Errorf("role name with @ should be rejected")
+	}
+	if err := validateTenantRequest(&CreateTenantRequest{TenantName: "Example"}); err == nil {
+		t.Errorf("tenant without domain should be rejected")
+	}
+}
@@ -0,0 +1,151 @@
+package endpoint
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/hyperjumptech/hansip/internal/config"
+	"github.com/hyperjumptech/hansip/internal/connector"
+	"github.com/hyperjumptech/hansip/internal/constants"
+	"github.com/hyperjumptech/hansip/internal/outbox"
+	"github.com/hyperjumptech/hansip/pkg/helper"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// AuditTargetOutbox audit events on outbox messages
+	AuditTargetOutbox = "outbox"
+)
+
+var (
+	outboxLog = log.WithField("go", "Outbox")
+)
+
+// outboxView returns the message without its payload, which may carry secrets such as activation codes
+func outboxView(message *connector.OutboxMessage) *connector.OutboxMessage {
+	ret := *message
+	ret.Payload = ""
+	return &ret
+}
+
+// auditOutbox records the retry of outbox messages
+func auditOutbox(r *http.Request, event string, target string, before, after interface{}) {
+	audit(r, &connector.AuditEvent{
+		Event:        event,
+		TargetType:   AuditTargetOutbox,
+		Target:       target,
+		TenantDomain: config.Get("hansip.domain"),
+	}, before, after)
+}
+
+// ListOutboxMessages serving request to list the emails and events of the outbox, without their payload.
+// eg. ?filter=status:dead lists the messages that ran out of attempts.
+func ListOutboxMessages(w http.ResponseWriter, r *http.Request) {
+	fLog := outboxLog.WithField("func", "ListOutboxMessages").WithField("RequestID", r.Context().Value(constants.RequestID)).WithField("path", r.URL.Path).WithField("method", r.Method)
+	if r.Context().Value(constants.HansipAuthentication) == nil {
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusUnauthorized, "You are not authorized to access this resource", nil, nil)
+		return
+	}
+	pageRequest, err := helper.NewPageRequestFromRequest(r)
+	if err != nil {
+		fLog.Errorf("helper.NewPageRequestFromRequest got %s", err.Error())
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusBadRequest, err.Error(), nil, nil)
+		return
+	}
+	messages, page, err := OutboxRepo.ListOutboxMessages(r.Context(), pageRequest)
+	if err != nil {
+		fLog.Errorf("OutboxRepo.ListOutboxMessages got %s", err.Error())
+		helper.WriteHTTPResponse(r.Context(), w, listErrorStatus(err), err.Error(), nil, nil)
+		return
+	}
+	views := make([]*connector.OutboxMessage, len(messages))
+	for i, message := range messages {
+		views[i] = outboxView(message)
+	}
+	ret := make(map[string]interface{})
+	ret["messages"] = views
+	ret["page"] = page
+	helper.WriteHTTPResponse(r.Context(), w, http.StatusOK, "List of outbox messages paginated", nil, ret)
+}
+
+// GetOutboxMessage serving request to inspect an outbox message, including its payload
+func GetOutboxMessage(w http.ResponseWriter, r *http.Request) {
+	if r.Context().Value(constants.HansipAuthentication) == nil {
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusUnauthorized, "You are not authorized to access this resource", nil, nil)
+		return
+	}
+	params, err := helper.ParsePathParams(fmt.Sprintf("%s/management/outbox/{messageRecId}", apiPrefix), r.URL.Path)
+	if err != nil {
+		panic(err)
+	}
+	message, err := OutboxRepo.GetOutboxMessageByRecID(r.Context(), params["messageRecId"])
+	if err != nil {
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusNotFound, fmt.Sprintf("outbox message %s not found", params["messageRecId"]), nil, nil)
+		return
+	}
+	helper.WriteHTTPResponse(r.Context(), w, http.StatusOK, "Outbox message retrieved", nil, message)
+}
+
+// RetryOutboxMessage serving request to deliver a dead or pending outbox message now, with all its attempts again
+func RetryOutboxMessage(w http.ResponseWriter, r *http.Request) {
+	fLog := outboxLog.WithField("func", "RetryOutboxMessage").WithField("RequestID", r.Context().Value(constants.RequestID)).WithField("path", r.URL.Path).WithField("method", r.Method)
+	if r.Context().Value(constants.HansipAuthentication) == nil {
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusUnauthorized, "You are not authorized to access this resource", nil, nil)
+		return
+	}
+	params, err := helper.ParsePathParams(fmt.Sprintf("%s/management/outbox/{messageRecId}/retry", apiPrefix), r.URL.Path)
+	if err != nil {
+		panic(err)
+	}
+	message, err := OutboxRepo.GetOutboxMessageByRecID(r.Context(), params["messageRecId"])
+	if err != nil {
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusNotFound, fmt.Sprintf("outbox message %s not found", params["messageRecId"]), nil, nil)
+		return
+	}
+	if message.Status == connector.OutboxSent {
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusConflict, fmt.Sprintf("outbox message %s is already sent", message.RecID), nil, nil)
+		return
+	}
+	before := outboxView(message)
+	err = outbox.Retry(r.Context(), message)
+	if err != nil {
+		fLog.Errorf("outbox.Retry got %s", err.Error())
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusInternalServerError, err.Error(), nil, nil)
+		return
+	}
+	auditOutbox(r, "outbox.retry", message.RecID, before, outboxView(message))
+	helper.WriteHTTPResponse(r.Context(), w, http.StatusOK, "Outbox message queued again", nil, outboxView(message))
+}
+
+// RetryDeadOutboxMessages serving request to deliver every dead outbox message again
+func RetryDeadOutboxMessages(w http.ResponseWriter, r *http.Request) {
+	fLog := outboxLog.WithField("func", "RetryDeadOutboxMessages").WithField("RequestID", r.Context().Value(constants.RequestID)).WithField("path", r.URL.Path).WithField("method", r.Method)
+	if r.Context().Value(constants.HansipAuthentication) == nil {
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusUnauthorized, "You are not authorized to access this resource", nil, nil)
+		return
+	}
+	dead := make([]*connector.OutboxMessage, 0)
+	err := allPages(func(request *helper.PageRequest) (int, *helper.Page, error) {
+		request.Filters = []*helper.Filter{{Field: "status", Operator: helper.FilterEqual, Value: connector.OutboxDead}}
+		page, p, err := OutboxRepo.ListOutboxMessages(r.Context(), request)
+		dead = append(dead, page...)
+		return len(page), p, err
+	})
+	if err != nil {
+		fLog.Errorf("OutboxRepo.ListOutboxMessages got %s", err.Error())
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusInternalServerError, err.Error(), nil, nil)
+		return
+	}
+	retried := make([]string, 0, len(dead))
+	for _, message := range dead {
+		if err := outbox.Retry(r.Context(), message); err != nil {
+			fLog.Errorf("outbox.Retry got %s", err.Error())
+			continue
+		}
+		retried = append(retried, message.RecID)
+	}
+	if len(retried) > 0 {
+		auditOutbox(r, "outbox.retry", "", nil, map[string]interface{}{"messages": retried})
+	}
+	helper.WriteHTTPResponse(r.Context(), w, http.StatusOK, fmt.Sprintf("%d of %d dead outbox messages queued again", len(retried), len(dead)), nil, map[string]interface{}{"retried": retried})
+}
@@ -3,10 +3,9 @@ package endpoint
 import (
 	"encoding/json"
 	"fmt"
-	"github.com/hyperjumptech/hansip/internal/config"
+	"github.com/hyperjumptech/hansip/internal/connector"
 	"github.com/hyperjumptech/hansip/internal/constants"
 	"github.com/hyperjumptech/hansip/internal/mailer"
-	"github.com/hyperjumptech/hansip/internal/passphrase"
 	"github.com/hyperjumptech/hansip/pkg/helper"
 	log "github.com/sirupsen/logrus"
 	"golang.org/x/crypto/bcrypt"
@@ -42,27 +41,42 @@ func RecoverPassphrase(w http.ResponseWriter, r *http.Request) {
 	user, err := UserRepo.GetUserByEmail(r.Context(), req.Email)
 	if err != nil {
 		fLog.Errorf("UserRepo.GetUserByEmail got %s", err.Error())
+		auditAuthentication(r, "recovery.request", AuditFailure, req.Email, nil)
 		// send fake success
 		helper.WriteHTTPResponse(r.Context(), w, http.StatusOK, "Check your email", nil, nil)
 		return
 	}
 	if user == nil {
+		auditAuthentication(r, "recovery.request", AuditFailure, req.Email, nil)
 		// send fake success
 		helper.WriteHTTPResponse(r.Context(), w, http.StatusOK, "Check your email", nil, nil)
 		return
 	}
+	before := *user
 	user.RecoveryCode = helper.MakeRandomString(10, true, true, true, false)
 	UserRepo.UpdateUser(r.Context(), user)
+	audit(r, &connector.AuditEvent{
+		Event:        "recovery.request",
+		Actor:        user.Email,
+		TargetType:   AuditTargetUser,
+		Target:       user.RecID,
+		TenantDomain: userAuditDomain(r.Context(), user),
+	}, &before, user)
 
 	fLog.Warnf("Sending email")
+	tenant := userTenant(r.Context(), user)
+	settings := userSettings(r.Context(), user)
 	mailer.Send(r.Context(), &mailer.Email{
-		From:     config.Get("mailer.from"),
-		FromName: config.Get("mailer.from.name"),
+		From:     settings.Get("mailer.from"),
+		FromName: settings.Get("mailer.from.name"),
 		To:       []string{user.Email},
 		Cc:       nil,
 		Bcc:      nil,
 		Template: "PASSPHRASE_RECOVERY",
 		Data:     user,
+		Settings: settings,
+		Tenant:   tenant,
+		Locale:   user.Locale,
 	})
 
 	helper.WriteHTTPResponse(r.Context(), w, http.StatusOK, "Check your email", nil, nil)
@@ -90,33 +104,41 @@ func ResetPassphrase(w http.ResponseWriter, r *http.Request) {
 		helper.WriteHTTPResponse(r.Context(), w, http.StatusBadRequest, err.Error(), nil, nil)
 		return
 	}
-	isValidPassphrase := passphrase.Validate(req.NewPassphrase, config.GetInt("security.passphrase.minchars"), config.GetInt("security.passphrase.minwords"), config.GetInt("security.passphrase.mincharsinword"))
-	if !isValidPassphrase {
-		fLog.Errorf("Passphrase invalid")
-		invalidMsg := fmt.Sprintf("Invalid passphrase. Passphrase must at least has %d characters and %d words and for each word have minimum %d characters", config.GetInt("security.passphrase.minchars"), config.GetInt("security.passphrase.minwords"), config.GetInt("security.passphrase.mincharsinword"))
-		helper.WriteHTTPResponse(r.Context(), w, http.StatusBadRequest, "invalid passphrase", nil, invalidMsg)
-		return
-	}
-
 	user, err := UserRepo.GetUserByRecoveryToken(r.Context(), req.ResetToken)
 	if err != nil {
 		fLog.Errorf("UserRepo.GetUserByRecoveryToken got %s", err.Error())
+		auditAuthentication(r, "recovery.reset", AuditFailure, "", nil)
 		// send fake response
 		helper.WriteHTTPResponse(r.Context(), w, http.StatusOK, "Check your email", nil, nil)
 		return
 	}
 	if user == nil {
+		auditAuthentication(r, "recovery.reset", AuditFailure, "", nil)
 		// send fake response
 		helper.WriteHTTPResponse(r.Context(), w, http.StatusOK, "Check your email", nil, nil)
 		return
 	}
+	isValidPassphrase, invalidMsg := validatePassphrase(userSettings(r.Context(), user), req.NewPassphrase)
+	if !isValidPassphrase {
+		fLog.Errorf("Passphrase invalid")
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusBadRequest, "invalid passphrase", nil, fmt.Sprintf("Invalid passphrase. %s", invalidMsg))
+		return
+	}
 	pass, err := bcrypt.GenerateFromPassword([]byte(req.NewPassphrase), 14)
 	if err != nil {
 		fLog.Errorf("bcrypt.GenerateFromPassword got %s", err.Error())
 		helper.WriteHTTPResponse(r.Context(), w, http.StatusInternalServerError, err.Error(), nil, nil)
 		return
 	}
+	before := *user
 	user.HashedPassphrase = string(pass)
 	UserRepo.UpdateUser(r.Context(), user)
+	audit(r, &connector.AuditEvent{
+		Event:        "recovery.reset",
+		Actor:        user.Email,
+		TargetType:   AuditTargetUser,
+		Target:       user.RecID,
+		TenantDomain: userAuditDomain(r.Context(), user),
+	}, &before, user)
 	helper.WriteHTTPResponse(r.Context(), w, http.StatusOK, "Passphrase changed", nil, nil)
 }
@@ -8,6 +8,7 @@ import (
 	"strings"
 
 	"github.com/hyperjumptech/hansip/internal/constants"
+	"github.com/hyperjumptech/hansip/internal/events"
 	"github.com/hyperjumptech/hansip/internal/hansipcontext"
 	"github.com/hyperjumptech/hansip/pkg/helper"
 	log "github.com/sirupsen/logrus"
@@ -38,7 +39,7 @@ func SetRoleUsers(w http.ResponseWriter, r *http.Request) {
 	}
 
 	authCtx := iauthctx.(*hansipcontext.AuthenticationContext)
-	if !authCtx.IsAdminOfDomain(role.RoleDomain) {
+	if !canAssignRole(authCtx, role.RoleName, role.RoleDomain) {
 		helper.WriteHTTPResponse(r.Context(), w, http.StatusForbidden, "You don't have the right to access this resource", nil, nil)
 		return
 	}
@@ -57,6 +58,8 @@ func SetRoleUsers(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	before := auditRoleUsers(r.Context(), role)
+	users := roleUsers(r.Context(), role)
 	err = UserRoleRepo.DeleteUserRoleByRole(r.Context(), role)
 	if err != nil {
 		fLog.Errorf("UserRoleRepo.DeleteUserRoleByRole got %s", err.Error())
@@ -79,6 +82,8 @@ func SetRoleUsers(w http.ResponseWriter, r *http.Request) {
 			RevocationRepo.Revoke(r.Context(), user.Email)
 		}
 	}
+	auditRole(r, "role.users.set", role, before, auditRoleUsers(r.Context(), role))
+	publishRoleUsersChanged(r.Context(), users, roleUsers(r.Context(), role))
 	helper.WriteHTTPResponse(r.Context(), w, http.StatusOK, fmt.Sprintf("%d users added the role", counter), nil, nil)
 }
 
@@ -103,17 +108,21 @@ func DeleteRoleUsers(w http.ResponseWriter, r *http.Request) {
 	}
 
 	authCtx := iauthctx.(*hansipcontext.AuthenticationContext)
-	if !authCtx.IsAdminOfDomain(role.RoleDomain) {
+	if !canAssignRole(authCtx, role.RoleName, role.RoleDomain) {
 		helper.WriteHTTPResponse(r.Context(), w, http.StatusForbidden, "You don't have the right to access this resource", nil, nil)
 		return
 	}
 
+	before := auditRoleUsers(r.Context(), role)
+	users := roleUsers(r.Context(), role)
 	err = UserRoleRepo.DeleteUserRoleByRole(r.Context(), role)
 	if err != nil {
 		fLog.Errorf("UserRoleRepo.DeleteUserRoleByRole got %s", err.Error())
 		helper.WriteHTTPResponse(r.Context(), w, http.StatusInternalServerError, err.Error(), nil, nil)
 		return
 	}
+	auditRole(r, "role.users.delete", role, before, auditRoleUsers(r.Context(), role))
+	publishRoleUsersChanged(r.Context(), users, nil)
 	helper.WriteHTTPResponse(r.Context(), w, http.StatusOK, "successfuly removed role from all user", nil, nil)
 }
 
@@ -137,7 +146,7 @@ func SetRoleGroups(w http.ResponseWriter, r *http.Request) {
 	}
 
 	authCtx := iauthctx.(*hansipcontext.AuthenticationContext)
-	if !authCtx.IsAdminOfDomain(role.RoleDomain) {
+	if !canAssignRole(authCtx, role.RoleName, role.RoleDomain) {
 		helper.WriteHTTPResponse(r.Context(), w, http.StatusForbidden, "You don't have the right to access this resource", nil, nil)
 		return
 	}
@@ -156,6 +165,7 @@ func SetRoleGroups(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	before := auditRoleGroups(r.Context(), role)
 	err = GroupRoleRepo.DeleteGroupRoleByRole(r.Context(), role)
 	if err != nil {
 		fLog.Errorf("GroupRoleRepo.DeleteGroupRoleByRole got %s", err.Error())
@@ -177,6 +187,7 @@ func SetRoleGroups(w http.ResponseWriter, r *http.Request) {
 			}
 		}
 	}
+	auditRole(r, "role.groups.set", role, before, auditRoleGroups(r.Context(), role))
 	helper.WriteHTTPResponse(r.Context(), w, http.StatusOK, fmt.Sprintf("%d groups added the role", counter), nil, nil)
 }
 
@@ -201,17 +212,19 @@ func DeleteRoleGroups(w http.ResponseWriter, r *http.Request) {
 	}
 
 	authCtx := iauthctx.(*hansipcontext.AuthenticationContext)
-	if !authCtx.IsAdminOfDomain(role.RoleDomain) {
+	if !canAssignRole(authCtx, role.RoleName, role.RoleDomain) {
 		helper.WriteHTTPResponse(r.Context(), w, http.StatusForbidden, "You don't have the right to access this resource", nil, nil)
 		return
 	}
 
+	before := auditRoleGroups(r.Context(), role)
 	err = GroupRoleRepo.DeleteGroupRoleByRole(r.Context(), role)
 	if err != nil {
 		fLog.Errorf("GroupRoleRepo.DeleteGroupRoleByRole got %s", err.Error())
 		helper.WriteHTTPResponse(r.Context(), w, http.StatusInternalServerError, err.Error(), nil, nil)
 		return
 	}
+	auditRole(r, "role.groups.delete", role, before, auditRoleGroups(r.Context(), role))
 	helper.WriteHTTPResponse(r.Context(), w, http.StatusOK, "successfuly removed role from all group", nil, nil)
 }
 
@@ -237,6 +250,12 @@ func ListAllRole(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	authCtx := iauthctx.(*hansipcontext.AuthenticationContext)
+	if !authCtx.HasScopeOfDomain(tenant.Domain, readScopes...) {
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusForbidden, "You don't have the right to access role with the specified domain", nil, nil)
+		return
+	}
+
 	pageRequest, err := helper.NewPageRequestFromRequest(r)
 	if err != nil {
 		fLog.Errorf("helper.NewPageRequestFromRequest got %s", err.Error())
@@ -246,7 +265,7 @@ func ListAllRole(w http.ResponseWriter, r *http.Request) {
 	roles, page, err := RoleRepo.ListRoles(r.Context(), tenant, pageRequest)
 	if err != nil {
 		fLog.Errorf("RoleRepo.ListRoles got %s", err.Error())
-		helper.WriteHTTPResponse(r.Context(), w, http.StatusInternalServerError, err.Error(), nil, nil)
+		helper.WriteHTTPResponse(r.Context(), w, listErrorStatus(err), err.Error(), nil, nil)
 		return
 	}
 	ret := make(map[string]interface{})
@@ -298,7 +317,7 @@ func CreateRole(w http.ResponseWriter, r *http.Request) {
 	}
 
 	authCtx := iauthctx.(*hansipcontext.AuthenticationContext)
-	if !authCtx.IsAdminOfDomain(req.RoleDomain) {
+	if !canAssignRole(authCtx, req.RoleName, req.RoleDomain) {
 		helper.WriteHTTPResponse(r.Context(), w, http.StatusForbidden, "You don't have the right to create role with the specified domain", nil, nil)
 		return
 	}
@@ -309,11 +328,12 @@ func CreateRole(w http.ResponseWriter, r *http.Request) {
 		helper.WriteHTTPResponse(r.Context(), w, http.StatusBadRequest, err.Error(), nil, nil)
 		return
 	}
+	auditRole(r, "role.create", role, nil, role)
 	helper.WriteHTTPResponse(r.Context(), w, http.StatusOK, "Success creating role", nil, role)
 	return
 }
 
-// UpdateRole serving request to update role detail
+// UpdateRole serving request to update role detail, entirely with PUT or partially with PATCH merge patch
 func UpdateRole(w http.ResponseWriter, r *http.Request) {
 	fLog := groupMgmtLog.WithField("func", "UpdateRole").WithField("RequestID", r.Context().Value(constants.RequestID)).WithField("path", r.URL.Path).WithField("method", r.Method)
 
@@ -327,33 +347,41 @@ func UpdateRole(w http.ResponseWriter, r *http.Request) {
 	if err != nil {
 		panic(err)
 	}
-	req := &CreateRoleRequest{}
-	body, err := ioutil.ReadAll(r.Body)
+	role, err := RoleRepo.GetRoleByRecID(r.Context(), params["roleRecId"])
 	if err != nil {
-		fLog.Errorf("ioutil.ReadAll got %s", err.Error())
-		helper.WriteHTTPResponse(r.Context(), w, http.StatusInternalServerError, err.Error(), nil, nil)
+		fLog.Errorf("GroupRepo.GetGroupByRecID got %s", err.Error())
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusNotFound, err.Error(), nil, nil)
 		return
 	}
-	err = json.Unmarshal(body, req)
+
+	req := &CreateRoleRequest{}
+	current := &CreateRoleRequest{
+		RoleName:    role.RoleName,
+		RoleDomain:  role.RoleDomain,
+		Description: role.Description,
+	}
+	status, err := readUpdateRequest(r, req, current)
 	if err != nil {
-		fLog.Errorf("json.Unmarshal got %s", err.Error())
-		helper.WriteHTTPResponse(r.Context(), w, http.StatusBadRequest, err.Error(), nil, nil)
+		fLog.Errorf("readUpdateRequest got %s", err.Error())
+		helper.WriteHTTPResponse(r.Context(), w, status, err.Error(), nil, nil)
 		return
 	}
-
-	role, err := RoleRepo.GetRoleByRecID(r.Context(), params["roleRecId"])
-	if err != nil {
-		fLog.Errorf("GroupRepo.GetGroupByRecID got %s", err.Error())
-		helper.WriteHTTPResponse(r.Context(), w, http.StatusNotFound, err.Error(), nil, nil)
+	if err := validateRoleRequest(req); err != nil {
+		fLog.Errorf("validateRoleRequest got %s", err.Error())
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusBadRequest, err.Error(), nil, nil)
 		return
 	}
 
 	authCtx := iauthctx.(*hansipcontext.AuthenticationContext)
-	if !(authCtx.IsAdminOfDomain(role.RoleDomain) && authCtx.IsAdminOfDomain(req.RoleDomain)) {
+	if !(canAssignRole(authCtx, role.RoleName, role.RoleDomain) && canAssignRole(authCtx, req.RoleName, req.RoleDomain)) {
 		helper.WriteHTTPResponse(r.Context(), w, http.StatusForbidden, fmt.Sprintf("forbidden. you are not admin of %s and %s domain", role.RoleDomain, req.RoleDomain), nil, nil)
 		return
 	}
+	if !checkIfMatch(w, r, role.RecID, role.Version) {
+		return
+	}
 
+	before := *role
 	role.RoleName = req.RoleName
 	role.RoleDomain = req.RoleDomain
 	role.Description = req.Description
@@ -368,10 +396,11 @@ func UpdateRole(w http.ResponseWriter, r *http.Request) {
 	err = RoleRepo.UpdateRole(r.Context(), role)
 	if err != nil {
 		fLog.Errorf("RoleRepo.SaveOrUpdateRole got %s", err.Error())
-		helper.WriteHTTPResponse(r.Context(), w, http.StatusInternalServerError, err.Error(), nil, nil)
+		helper.WriteHTTPResponse(r.Context(), w, updateErrorStatus(err), err.Error(), nil, nil)
 		return
 	}
-	helper.WriteHTTPResponse(r.Context(), w, http.StatusOK, "Role updated", nil, role)
+	auditRole(r, "role.update", role, &before, role)
+	helper.WriteHTTPResponse(r.Context(), w, http.StatusOK, "Role updated", etagHeader(role.RecID, role.Version), role)
 }
 
 // GetRoleDetail serving request to get role detail
@@ -396,12 +425,12 @@ func GetRoleDetail(w http.ResponseWriter, r *http.Request) {
 	}
 
 	authCtx := iauthctx.(*hansipcontext.AuthenticationContext)
-	if !authCtx.IsAdminOfDomain(role.RoleDomain) {
+	if !authCtx.HasScopeOfDomain(role.RoleDomain, readScopes...) {
 		helper.WriteHTTPResponse(r.Context(), w, http.StatusForbidden, "You don't have the right to create role with the specified domain", nil, nil)
 		return
 	}
 
-	helper.WriteHTTPResponse(r.Context(), w, http.StatusOK, "Role fetched", nil, role)
+	helper.WriteHTTPResponse(r.Context(), w, http.StatusOK, "Role fetched", etagHeader(role.RecID, role.Version), role)
 }
 
 // DeleteRole serving request to delete a role
@@ -426,12 +455,18 @@ func DeleteRole(w http.ResponseWriter, r *http.Request) {
 	}
 
 	authCtx := iauthctx.(*hansipcontext.AuthenticationContext)
-	if !authCtx.IsAdminOfDomain(role.RoleDomain) {
+	if !canAssignRole(authCtx, role.RoleName, role.RoleDomain) {
 		helper.WriteHTTPResponse(r.Context(), w, http.StatusForbidden, "You don't have the right to create role with the specified domain", nil, nil)
 		return
 	}
+	if !checkIfMatch(w, r, role.RecID, role.Version) {
+		return
+	}
 
+	users := roleUsers(r.Context(), role)
 	RoleRepo.DeleteRole(r.Context(), role)
+	auditRole(r, "role.delete", role, role, nil)
+	publishRoleUsersChanged(r.Context(), users, nil)
 	helper.WriteHTTPResponse(r.Context(), w, http.StatusOK, "Role deleted", nil, nil)
 }
 
@@ -457,7 +492,7 @@ func ListRoleUser(w http.ResponseWriter, r *http.Request) {
 	}
 
 	authCtx := iauthctx.(*hansipcontext.AuthenticationContext)
-	if !authCtx.IsAdminOfDomain(role.RoleDomain) {
+	if !authCtx.HasScopeOfDomain(role.RoleDomain, readScopes...) {
 		helper.WriteHTTPResponse(r.Context(), w, http.StatusForbidden, "You don't have the right to create role with the specified domain", nil, nil)
 		return
 	}
@@ -471,6 +506,8 @@ func ListRoleUser(w http.ResponseWriter, r *http.Request) {
 	users, page, err := UserRoleRepo.ListUserRoleByRole(r.Context(), role, pageRequest)
 	if err != nil {
 		fLog.Errorf("UserRoleRepo.ListUserRoleByRole got %s", err.Error())
+		helper.WriteHTTPResponse(r.Context(), w, listErrorStatus(err), err.Error(), nil, nil)
+		return
 	}
 	susers := make([]*SimpleUser, len(users))
 	for k, v := range users {
@@ -509,7 +546,7 @@ func CreateRoleUser(w http.ResponseWriter, r *http.Request) {
 	}
 
 	authCtx := iauthctx.(*hansipcontext.AuthenticationContext)
-	if !authCtx.IsAdminOfDomain(role.RoleDomain) {
+	if !canAssignRole(authCtx, role.RoleName, role.RoleDomain) {
 		helper.WriteHTTPResponse(r.Context(), w, http.StatusForbidden, "You don't have the right to create role with the specified domain", nil, nil)
 		return
 	}
@@ -527,6 +564,8 @@ func CreateRoleUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	RevocationRepo.Revoke(r.Context(), user.Email)
+	auditRole(r, "role.user.add", role, nil, auditLink("user", user.Email))
+	events.Publish(r.Context(), &events.RoleGranted{User: user, Role: role})
 	helper.WriteHTTPResponse(r.Context(), w, http.StatusOK, "User-Role created", nil, nil)
 }
 
@@ -552,7 +591,7 @@ func DeleteRoleUser(w http.ResponseWriter, r *http.Request) {
 	}
 
 	authCtx := iauthctx.(*hansipcontext.AuthenticationContext)
-	if !authCtx.IsAdminOfDomain(role.RoleDomain) {
+	if !canAssignRole(authCtx, role.RoleName, role.RoleDomain) {
 		helper.WriteHTTPResponse(r.Context(), w, http.StatusForbidden, "You don't have the right to create role with the specified domain", nil, nil)
 		return
 	}
@@ -576,6 +615,8 @@ func DeleteRoleUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	RevocationRepo.Revoke(r.Context(), user.Email)
+	auditRole(r, "role.user.remove", role, auditLink("user", user.Email), nil)
+	events.Publish(r.Context(), &events.RoleRevoked{User: user, Role: role})
 	helper.WriteHTTPResponse(r.Context(), w, http.StatusOK, "User-Role deleted", nil, nil)
 }
 
@@ -601,7 +642,7 @@ func ListRoleGroup(w http.ResponseWriter, r *http.Request) {
 	}
 
 	authCtx := iauthctx.(*hansipcontext.AuthenticationContext)
-	if !authCtx.IsAdminOfDomain(role.RoleDomain) {
+	if !authCtx.HasScopeOfDomain(role.RoleDomain, readScopes...) {
 		helper.WriteHTTPResponse(r.Context(), w, http.StatusForbidden, "You don't have the right to access role with the specified domain", nil, nil)
 		return
 	}
@@ -613,6 +654,11 @@ func ListRoleGroup(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	groups, page, err := GroupRoleRepo.ListGroupRoleByRole(r.Context(), role, pageRequest)
+	if err != nil {
+		fLog.Errorf("GroupRoleRepo.ListGroupRoleByRole got %s", err.Error())
+		helper.WriteHTTPResponse(r.Context(), w, listErrorStatus(err), err.Error(), nil, nil)
+		return
+	}
 	sgroups := make([]*SimpleGroup, len(groups))
 	for k, v := range groups {
 		sgroups[k] = &SimpleGroup{
@@ -648,7 +694,7 @@ func CreateRoleGroup(w http.ResponseWriter, r *http.Request) {
 	}
 
 	authCtx := iauthctx.(*hansipcontext.AuthenticationContext)
-	if !authCtx.IsAdminOfDomain(role.RoleDomain) {
+	if !canAssignRole(authCtx, role.RoleName, role.RoleDomain) {
 		helper.WriteHTTPResponse(r.Context(), w, http.StatusForbidden, "You don't have the right to manage role with the specified domain", nil, nil)
 		return
 	}
@@ -671,6 +717,7 @@ func CreateRoleGroup(w http.ResponseWriter, r *http.Request) {
 		helper.WriteHTTPResponse(r.Context(), w, http.StatusBadRequest, err.Error(), nil, nil)
 		return
 	}
+	auditRole(r, "role.group.add", role, nil, auditLink("group", fmt.Sprintf("%s@%s", group.GroupName, group.GroupDomain)))
 	helper.WriteHTTPResponse(r.Context(), w, http.StatusOK, "Group-Role created", nil, nil)
 }
 
@@ -696,7 +743,7 @@ func DeleteRoleGroup(w http.ResponseWriter, r *http.Request) {
 	}
 
 	authCtx := iauthctx.(*hansipcontext.AuthenticationContext)
-	if !authCtx.IsAdminOfDomain(role.RoleDomain) {
+	if !canAssignRole(authCtx, role.RoleName, role.RoleDomain) {
 		helper.WriteHTTPResponse(r.Context(), w, http.StatusForbidden, "You don't have the right to create role with the specified domain", nil, nil)
 		return
 	}
@@ -719,5 +766,6 @@ func DeleteRoleGroup(w http.ResponseWriter, r *http.Request) {
 		helper.WriteHTTPResponse(r.Context(), w, http.StatusNotFound, err.Error(), nil, nil)
 		return
 	}
+	auditRole(r, "role.group.remove", role, auditLink("group", fmt.Sprintf("%s@%s", group.GroupName, group.GroupDomain)), nil)
 	helper.WriteHTTPResponse(r.Context(), w, http.StatusOK, "User-Group deleted", nil, nil)
 }
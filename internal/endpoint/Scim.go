@@ -0,0 +1,1475 @@
+package endpoint
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/hyperjumptech/hansip/internal/config"
+	"github.com/hyperjumptech/hansip/internal/connector"
+	"github.com/hyperjumptech/hansip/internal/constants"
+	"github.com/hyperjumptech/hansip/internal/events"
+	"github.com/hyperjumptech/hansip/internal/hansipcontext"
+	"github.com/hyperjumptech/hansip/pkg/helper"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// ScimUserSchema is the SCIM core user schema URN
+	ScimUserSchema = "urn:ietf:params:scim:schemas:core:2.0:User"
+	// ScimGroupSchema is the SCIM core group schema URN
+	ScimGroupSchema = "urn:ietf:params:scim:schemas:core:2.0:Group"
+	// ScimListResponseSchema is the SCIM list response message URN
+	ScimListResponseSchema = "urn:ietf:params:scim:api:messages:2.0:ListResponse"
+	// ScimPatchOpSchema is the SCIM patch operation message URN
+	ScimPatchOpSchema = "urn:ietf:params:scim:api:messages:2.0:PatchOp"
+	// ScimErrorSchema is the SCIM error message URN
+	ScimErrorSchema = "urn:ietf:params:scim:api:messages:2.0:Error"
+
+	scimContentType = "application/scim+json"
+	scimMaxResults  = 200
+)
+
+var (
+	scimLog    = log.WithField("go", "Scim")
+	scimPrefix = config.Get("scim.path.prefix")
+)
+
+// ScimMeta is the meta attribute of SCIM resources
+type ScimMeta struct {
+	ResourceType string `json:"resourceType"`
+	Location     string `json:"location,omitempty"`
+}
+
+// ScimMultiValue is a SCIM multi valued attribute entry, such as emails, groups and members
+type ScimMultiValue struct {
+	Value   string `json:"value"`
+	Display string `json:"display,omitempty"`
+	Type    string `json:"type,omitempty"`
+	Primary bool   `json:"primary,omitempty"`
+	Ref     string `json:"$ref,omitempty"`
+}
+
+// ScimUser is the SCIM representation of a user
+type ScimUser struct {
+	Schemas  []string          `json:"schemas"`
+	ID       string            `json:"id"`
+	UserName string            `json:"userName"`
+	Active   bool              `json:"active"`
+	Emails   []*ScimMultiValue `json:"emails"`
+	Groups   []*ScimMultiValue `json:"groups,omitempty"`
+	Meta     *ScimMeta         `json:"meta"`
+}
+
+// ScimGroup is the SCIM representation of a group
+type ScimGroup struct {
+	Schemas     []string          `json:"schemas"`
+	ID          string            `json:"id"`
+	DisplayName string            `json:"displayName"`
+	Members     []*ScimMultiValue `json:"members,omitempty"`
+	Meta        *ScimMeta         `json:"meta"`
+}
+
+// ScimListResponse is the SCIM response for listing resources
+type ScimListResponse struct {
+	Schemas      []string      `json:"schemas"`
+	TotalResults int           `json:"totalResults"`
+	StartIndex   int           `json:"startIndex"`
+	ItemsPerPage int           `json:"itemsPerPage"`
+	Resources    []interface{} `json:"Resources"`
+}
+
+// ScimError is the SCIM error response, it is also used as error within SCIM processing
+type ScimError struct {
+	Schemas  []string `json:"schemas"`
+	Status   string   `json:"status"`
+	ScimType string   `json:"scimType,omitempty"`
+	Detail   string   `json:"detail"`
+}
+
+func (err *ScimError) Error() string {
+	return err.Detail
+}
+
+// NewScimError creates new SCIM error
+func NewScimError(status int, scimType, detail string) *ScimError {
+	return &ScimError{
+		Schemas:  []string{ScimErrorSchema},
+		Status:   strconv.Itoa(status),
+		ScimType: scimType,
+		Detail:   detail,
+	}
+}
+
+// ScimPatchRequest is the body of SCIM PATCH request
+type ScimPatchRequest struct {
+	Schemas    []string              `json:"schemas"`
+	Operations []*ScimPatchOperation `json:"Operations"`
+}
+
+// ScimPatchOperation is a single operation within SCIM PATCH request
+type ScimPatchOperation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	Value json.RawMessage `json:"value"`
+}
+
+// scimUserRequest is the body of SCIM user create and replace request
+type scimUserRequest struct {
+	UserName string            `json:"userName"`
+	Active   *bool             `json:"active"`
+	Password string            `json:"password"`
+	Emails   []*ScimMultiValue `json:"emails"`
+}
+
+// scimGroupRequest is the body of SCIM group create and replace request
+type scimGroupRequest struct {
+	DisplayName string            `json:"displayName"`
+	Members     []*ScimMultiValue `json:"members"`
+}
+
+// scimUserState is the modifiable state of a user
+type scimUserState struct {
+	UserName string `json:"userName"`
+	Active   bool   `json:"active"`
+}
+
+// scimGroupState is the modifiable state of a group
+type scimGroupState struct {
+	DisplayName string   `json:"displayName"`
+	Members     []string `json:"members"`
+}
+
+func writeScimResponse(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", scimContentType)
+	w.WriteHeader(status)
+	if body != nil {
+		json.NewEncoder(w).Encode(body)
+	}
+}
+
+func writeScimError(w http.ResponseWriter, err error) {
+	scimErr, ok := err.(*ScimError)
+	if !ok {
+		scimErr = NewScimError(http.StatusInternalServerError, "", err.Error())
+	}
+	status, _ := strconv.Atoi(scimErr.Status)
+	writeScimResponse(w, status, scimErr)
+}
+
+func scimBaseURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return fmt.Sprintf("%s://%s%s", scheme, r.Host, scimPrefix)
+}
+
+// scimTenant resolves the tenant of the SCIM request from the admin domains in the token.
+// The token must be an admin of exactly one tenant, or of the hansip domain only.
+func scimTenant(r *http.Request) (*connector.Tenant, error) {
+	iauthctx := r.Context().Value(constants.HansipAuthentication)
+	if iauthctx == nil {
+		return nil, NewScimError(http.StatusUnauthorized, "", "You are not authorized to access this resource")
+	}
+	authCtx := iauthctx.(*hansipcontext.AuthenticationContext)
+	hansipDomain := config.Get("hansip.domain")
+	domains := make([]string, 0)
+	for _, domain := range authCtx.AdminOfDomains() {
+		if domain != hansipDomain && domain != "*" {
+			domains = append(domains, domain)
+		}
+	}
+	if len(domains) == 0 && authCtx.IsAdminOfDomain(hansipDomain) {
+		domains = append(domains, hansipDomain)
+	}
+	if len(domains) != 1 {
+		return nil, NewScimError(http.StatusForbidden, "", "SCIM token must be an admin of exactly one tenant")
+	}
+	tenant, err := TenantRepo.GetTenantByDomain(r.Context(), domains[0])
+	if err != nil {
+		return nil, NewScimError(http.StatusForbidden, "", fmt.Sprintf("tenant %s not found", domains[0]))
+	}
+	return tenant, nil
+}
+
+// scimListParameters returns the filter, start index and count of a SCIM list request
+func scimListParameters(r *http.Request) (ScimFilter, int, int, error) {
+	query := r.URL.Query()
+	var filter ScimFilter
+	if f := query.Get("filter"); len(f) > 0 {
+		var err error
+		filter, err = ParseScimFilter(f)
+		if err != nil {
+			return nil, 0, 0, NewScimError(http.StatusBadRequest, "invalidFilter", err.Error())
+		}
+	}
+	startIndex := 1
+	if s := query.Get("startIndex"); len(s) > 0 {
+		i, err := strconv.Atoi(s)
+		if err != nil {
+			return nil, 0, 0, NewScimError(http.StatusBadRequest, "invalidValue", "invalid startIndex")
+		}
+		if i > 1 {
+			startIndex = i
+		}
+	}
+	count := scimMaxResults
+	if s := query.Get("count"); len(s) > 0 {
+		i, err := strconv.Atoi(s)
+		if err != nil {
+			return nil, 0, 0, NewScimError(http.StatusBadRequest, "invalidValue", "invalid count")
+		}
+		if i < 0 {
+			i = 0
+		}
+		if i < count {
+			count = i
+		}
+	}
+	return filter, startIndex, count, nil
+}
+
+// scimExcluded checks if an attribute is excluded by the excludedAttributes query parameter
+func scimExcluded(r *http.Request, attribute string) bool {
+	for _, attr := range strings.Split(r.URL.Query().Get("excludedAttributes"), ",") {
+		if strings.EqualFold(strings.TrimSpace(attr), attribute) {
+			return true
+		}
+	}
+	return false
+}
+
+func scimToMap(resource interface{}) map[string]interface{} {
+	ret := make(map[string]interface{})
+	byt, err := json.Marshal(resource)
+	if err != nil {
+		return ret
+	}
+	json.Unmarshal(byt, &ret)
+	return ret
+}
+
+func scimUserResource(r *http.Request, tenant *connector.Tenant, user *connector.User, withGroups bool) (*ScimUser, error) {
+	ret := newScimUser(r, user)
+	if !withGroups {
+		return ret, nil
+	}
+	groups, err := UserGroupRepo.ListUserGroupByUsers(r.Context(), []*connector.User{user}, tenant.Domain)
+	if err != nil {
+		return nil, err
+	}
+	ret.Groups = scimGroupRefs(r, groups[user.RecID])
+	return ret, nil
+}
+
+// newScimUser creates the user resource without its groups
+func newScimUser(r *http.Request, user *connector.User) *ScimUser {
+	return &ScimUser{
+		Schemas:  []string{ScimUserSchema},
+		ID:       user.RecID,
+		UserName: user.Email,
+		Active:   user.Enabled,
+		Emails: []*ScimMultiValue{
+			{Value: user.Email, Type: "work", Primary: true},
+		},
+		Meta: &ScimMeta{
+			ResourceType: "User",
+			Location:     fmt.Sprintf("%s/Users/%s", scimBaseURL(r), user.RecID),
+		},
+	}
+}
+
+// scimGroupRefs creates the groups attribute of a user resource
+func scimGroupRefs(r *http.Request, groups []*connector.Group) []*ScimMultiValue {
+	ret := make([]*ScimMultiValue, len(groups))
+	for i, group := range groups {
+		ret[i] = &ScimMultiValue{
+			Value:   group.RecID,
+			Display: group.GroupName,
+			Ref:     fmt.Sprintf("%s/Groups/%s", scimBaseURL(r), group.RecID),
+		}
+	}
+	return ret
+}
+
+// scimWindow walks the pages of count items holding the window from startIndex of count items, at most two of them.
+// fetch lists the items of a page request and take receives the range of the fetched items that are in the window.
+// It returns the total items as counted by the last page fetched.
+func scimWindow(startIndex, count int, fetch func(request *helper.PageRequest) (int, *helper.Page, error), take func(from, to int)) (int, error) {
+	size := count
+	if size == 0 {
+		// still fetch a page to know the total
+		size = 1
+	}
+	offset := startIndex - 1
+	first := uint(offset/size + 1)
+	taken := 0
+	total := 0
+	for no := first; no <= first+1; no++ {
+		fetched, page, err := fetch(&helper.PageRequest{
+			No:       no,
+			PageSize: uint(size),
+			Sort:     "ASC",
+		})
+		if err != nil {
+			return 0, err
+		}
+		total = int(page.TotalItems)
+		if page.No != no {
+			// startIndex is beyond the last item
+			break
+		}
+		from := 0
+		if no == first {
+			from = offset % size
+			if from >= fetched {
+				break
+			}
+		}
+		to := fetched
+		if to-from > count-taken {
+			to = from + count - taken
+		}
+		take(from, to)
+		taken += to - from
+		if taken >= count || page.IsLast {
+			break
+		}
+	}
+	return total, nil
+}
+
+// scimTenantUsers returns the window of the tenant users from startIndex of count users, filtered and paginated by the database,
+// along with the total users matching the filters. The window spans at most two pages of count users.
+func scimTenantUsers(ctx context.Context, tenant *connector.Tenant, filters []*helper.Filter, startIndex, count int) ([]*connector.User, int, error) {
+	ret := make([]*connector.User, 0, count)
+	var users []*connector.User
+	total, err := scimWindow(startIndex, count, func(request *helper.PageRequest) (int, *helper.Page, error) {
+		request.Filters = filters
+		list, page, err := UserTenantRepo.ListUserTenantByDomains(ctx, []string{tenant.Domain}, request)
+		users = list
+		return len(list), page, err
+	}, func(from, to int) {
+		ret = append(ret, users[from:to]...)
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	return ret, total, nil
+}
+
+// scimTenantGroups returns the window of the tenant groups from startIndex of count groups, filtered and paginated by the database,
+// along with the total groups matching the filters. The window spans at most two pages of count groups.
+func scimTenantGroups(ctx context.Context, tenant *connector.Tenant, filters []*helper.Filter, startIndex, count int) ([]*connector.Group, int, error) {
+	ret := make([]*connector.Group, 0, count)
+	var groups []*connector.Group
+	total, err := scimWindow(startIndex, count, func(request *helper.PageRequest) (int, *helper.Page, error) {
+		request.Filters = filters
+		list, page, err := GroupRepo.ListGroups(ctx, tenant, request)
+		groups = list
+		return len(list), page, err
+	}, func(from, to int) {
+		ret = append(ret, groups[from:to]...)
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	return ret, total, nil
+}
+
+func scimGroupMembers(ctx context.Context, group *connector.Group) ([]*connector.User, error) {
+	members := make([]*connector.User, 0)
+	err := allPages(func(request *helper.PageRequest) (int, *helper.Page, error) {
+		users, page, err := UserGroupRepo.ListUserGroupByGroup(ctx, group, request)
+		members = append(members, users...)
+		return len(users), page, err
+	})
+	return members, err
+}
+
+func scimGroupResource(r *http.Request, group *connector.Group, withMembers bool) (*ScimGroup, error) {
+	ret := &ScimGroup{
+		Schemas:     []string{ScimGroupSchema},
+		ID:          group.RecID,
+		DisplayName: group.GroupName,
+		Meta: &ScimMeta{
+			ResourceType: "Group",
+			Location:     fmt.Sprintf("%s/Groups/%s", scimBaseURL(r), group.RecID),
+		},
+	}
+	if !withMembers {
+		return ret, nil
+	}
+	members, err := scimGroupMembers(r.Context(), group)
+	if err != nil {
+		return nil, err
+	}
+	ret.Members = make([]*ScimMultiValue, len(members))
+	for i, user := range members {
+		ret.Members[i] = &ScimMultiValue{
+			Value:   user.RecID,
+			Display: user.Email,
+			Ref:     fmt.Sprintf("%s/Users/%s", scimBaseURL(r), user.RecID),
+		}
+	}
+	return ret, nil
+}
+
+// scimTenantUser returns the user only if it is a member of the tenant
+func scimTenantUser(ctx context.Context, tenant *connector.Tenant, recID string) (*connector.User, error) {
+	user, err := UserRepo.GetUserByRecID(ctx, recID)
+	if err != nil || user == nil {
+		return nil, NewScimError(http.StatusNotFound, "", fmt.Sprintf("User %s not found", recID))
+	}
+	ut, err := UserTenantRepo.GetUserTenant(ctx, user, tenant)
+	if err != nil || ut == nil {
+		return nil, NewScimError(http.StatusNotFound, "", fmt.Sprintf("User %s not found", recID))
+	}
+	return user, nil
+}
+
+// scimManagedUser returns the user only if it is a member of the tenant and the token may manage it,
+// the same as updating the user through the management api. A SCIM token must not take over a user
+// holding a privileged role out of its tenant, such as the hansip admin.
+func scimManagedUser(r *http.Request, tenant *connector.Tenant, recID string) (*connector.User, error) {
+	user, err := scimTenantUser(r.Context(), tenant, recID)
+	if err != nil {
+		return nil, err
+	}
+	authCtx := r.Context().Value(constants.HansipAuthentication).(*hansipcontext.AuthenticationContext)
+	if !canManageUser(r.Context(), authCtx, user) {
+		return nil, NewScimError(http.StatusForbidden, "", fmt.Sprintf("You don't have the right to manage user %s", recID))
+	}
+	return user, nil
+}
+
+// scimTenantGroup returns the group only if it belongs to the tenant domain
+func scimTenantGroup(ctx context.Context, tenant *connector.Tenant, recID string) (*connector.Group, error) {
+	group, err := GroupRepo.GetGroupByRecID(ctx, recID)
+	if err != nil || group == nil || group.GroupDomain != tenant.Domain {
+		return nil, NewScimError(http.StatusNotFound, "", fmt.Sprintf("Group %s not found", recID))
+	}
+	return group, nil
+}
+
+func scimPage(resources []interface{}, startIndex, count int) *ScimListResponse {
+	ret := &ScimListResponse{
+		Schemas:      []string{ScimListResponseSchema},
+		TotalResults: len(resources),
+		StartIndex:   startIndex,
+		Resources:    make([]interface{}, 0),
+	}
+	if startIndex-1 < len(resources) {
+		end := startIndex - 1 + count
+		if end > len(resources) {
+			end = len(resources)
+		}
+		ret.Resources = resources[startIndex-1 : end]
+	}
+	ret.ItemsPerPage = len(ret.Resources)
+	return ret
+}
+
+func readScimBody(r *http.Request, target interface{}) error {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return err
+	}
+	err = json.Unmarshal(body, target)
+	if err != nil {
+		return NewScimError(http.StatusBadRequest, "invalidSyntax", err.Error())
+	}
+	return nil
+}
+
+// scimBool reads boolean value, some identity providers send it as string
+func scimBool(value interface{}) (bool, error) {
+	switch v := value.(type) {
+	case bool:
+		return v, nil
+	case string:
+		return strconv.ParseBool(v)
+	}
+	return false, fmt.Errorf("expecting boolean value")
+}
+
+// scimEmail reads email value of emails attribute, either a string or array of multi values
+func scimEmail(value interface{}) (string, error) {
+	switch v := value.(type) {
+	case string:
+		return v, nil
+	case []interface{}:
+		email := ""
+		for _, item := range v {
+			m, ok := item.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			val, _ := m["value"].(string)
+			if primary, _ := m["primary"].(bool); primary || len(email) == 0 {
+				email = val
+			}
+		}
+		if len(email) > 0 {
+			return email, nil
+		}
+	}
+	return "", fmt.Errorf("expecting email value")
+}
+
+// scimMemberIDs reads member ids from members attribute value
+func scimMemberIDs(value interface{}) ([]string, error) {
+	items, ok := value.([]interface{})
+	if !ok {
+		if value == nil {
+			return []string{}, nil
+		}
+		items = []interface{}{value}
+	}
+	ret := make([]string, 0, len(items))
+	for _, item := range items {
+		m, ok := item.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("expecting member object")
+		}
+		id, ok := m["value"].(string)
+		if !ok || len(id) == 0 {
+			return nil, fmt.Errorf("expecting member value")
+		}
+		ret = append(ret, id)
+	}
+	return ret, nil
+}
+
+func decodePatchValue(op *ScimPatchOperation) (interface{}, error) {
+	if len(op.Value) == 0 {
+		return nil, nil
+	}
+	var value interface{}
+	err := json.Unmarshal(op.Value, &value)
+	if err != nil {
+		return nil, NewScimError(http.StatusBadRequest, "invalidValue", err.Error())
+	}
+	return value, nil
+}
+
+// applyScimUserPatch applies SCIM patch operations to the user state.
+// Attributes that are not stored by hansip are ignored.
+func applyScimUserPatch(state *scimUserState, ops []*ScimPatchOperation) error {
+	var apply func(op, path string, value interface{}) error
+	apply = func(op, path string, value interface{}) error {
+		attr := strings.ToLower(path)
+		if strings.HasPrefix(attr, "urn:") {
+			attr = scimAttributePath(attr)[0]
+		}
+		switch {
+		case len(attr) == 0:
+			m, ok := value.(map[string]interface{})
+			if !ok {
+				return NewScimError(http.StatusBadRequest, "invalidValue", "expecting object value when path is not specified")
+			}
+			for k, v := range m {
+				if err := apply(op, k, v); err != nil {
+					return err
+				}
+			}
+		case attr == "active":
+			if op == "remove" {
+				return NewScimError(http.StatusBadRequest, "mutability", "active can not be removed")
+			}
+			b, err := scimBool(value)
+			if err != nil {
+				return NewScimError(http.StatusBadRequest, "invalidValue", err.Error())
+			}
+			state.Active = b
+		case attr == "username", strings.HasPrefix(attr, "emails"):
+			if op == "remove" {
+				return NewScimError(http.StatusBadRequest, "mutability", fmt.Sprintf("%s can not be removed", path))
+			}
+			email, err := scimEmail(value)
+			if err != nil {
+				return NewScimError(http.StatusBadRequest, "invalidValue", err.Error())
+			}
+			state.UserName = email
+		}
+		return nil
+	}
+	for _, operation := range ops {
+		op := strings.ToLower(operation.Op)
+		if op != "add" && op != "replace" && op != "remove" {
+			return NewScimError(http.StatusBadRequest, "invalidSyntax", fmt.Sprintf("unknown patch operation %s", operation.Op))
+		}
+		value, err := decodePatchValue(operation)
+		if err != nil {
+			return err
+		}
+		if err := apply(op, operation.Path, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// applyScimGroupPatch applies SCIM patch operations to the group state.
+func applyScimGroupPatch(state *scimGroupState, ops []*ScimPatchOperation) error {
+	addMembers := func(ids []string) {
+		for _, id := range ids {
+			if !helper.StringArrayContainString(state.Members, id) {
+				state.Members = append(state.Members, id)
+			}
+		}
+	}
+	removeMembers := func(match func(id string) bool) {
+		members := make([]string, 0, len(state.Members))
+		for _, id := range state.Members {
+			if !match(id) {
+				members = append(members, id)
+			}
+		}
+		state.Members = members
+	}
+	var apply func(op, path string, value interface{}) error
+	apply = func(op, path string, value interface{}) error {
+		attr := strings.ToLower(path)
+		if strings.HasPrefix(attr, "urn:") {
+			attr = scimAttributePath(attr)[0]
+		}
+		switch {
+		case len(attr) == 0:
+			m, ok := value.(map[string]interface{})
+			if !ok {
+				return NewScimError(http.StatusBadRequest, "invalidValue", "expecting object value when path is not specified")
+			}
+			for k, v := range m {
+				if err := apply(op, k, v); err != nil {
+					return err
+				}
+			}
+		case attr == "displayname":
+			if op == "remove" {
+				return NewScimError(http.StatusBadRequest, "mutability", "displayName can not be removed")
+			}
+			name, ok := value.(string)
+			if !ok || len(name) == 0 {
+				return NewScimError(http.StatusBadRequest, "invalidValue", "expecting displayName value")
+			}
+			state.DisplayName = name
+		case attr == "members":
+			ids, err := scimMemberIDs(value)
+			if err != nil {
+				return NewScimError(http.StatusBadRequest, "invalidValue", err.Error())
+			}
+			switch op {
+			case "add":
+				addMembers(ids)
+			case "replace":
+				state.Members = make([]string, 0)
+				addMembers(ids)
+			case "remove":
+				if value == nil {
+					state.Members = make([]string, 0)
+				} else {
+					removeMembers(func(id string) bool { return helper.StringArrayContainString(ids, id) })
+				}
+			}
+		case strings.HasPrefix(attr, "members["):
+			end := strings.LastIndex(path, "]")
+			if end < 0 {
+				return NewScimError(http.StatusBadRequest, "invalidPath", fmt.Sprintf("invalid path %s", path))
+			}
+			filter, err := ParseScimFilter(path[len("members["):end])
+			if err != nil {
+				return NewScimError(http.StatusBadRequest, "invalidFilter", err.Error())
+			}
+			if op != "remove" {
+				return NewScimError(http.StatusBadRequest, "invalidPath", fmt.Sprintf("%s is only supported for remove", path))
+			}
+			removeMembers(func(id string) bool { return filter.Match(map[string]interface{}{"value": id}) })
+		default:
+			return NewScimError(http.StatusBadRequest, "invalidPath", fmt.Sprintf("unsupported path %s", path))
+		}
+		return nil
+	}
+	for _, operation := range ops {
+		op := strings.ToLower(operation.Op)
+		if op != "add" && op != "replace" && op != "remove" {
+			return NewScimError(http.StatusBadRequest, "invalidSyntax", fmt.Sprintf("unknown patch operation %s", operation.Op))
+		}
+		value, err := decodePatchValue(operation)
+		if err != nil {
+			return err
+		}
+		if err := apply(op, operation.Path, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// saveScimUser stores the user state into the user
+func saveScimUser(ctx context.Context, user *connector.User, state *scimUserState) error {
+	if len(state.UserName) == 0 {
+		return NewScimError(http.StatusBadRequest, "invalidValue", "userName is required")
+	}
+	if err := validateEmail(state.UserName); err != nil {
+		return NewScimError(http.StatusBadRequest, "invalidValue", err.Error())
+	}
+	if !strings.EqualFold(state.UserName, user.Email) {
+		if existing, err := UserRepo.GetUserByEmail(ctx, state.UserName); err == nil && existing != nil {
+			return NewScimError(http.StatusConflict, "uniqueness", fmt.Sprintf("userName %s already exist", state.UserName))
+		}
+	}
+	revoke := user.Enabled && !state.Active
+	user.Email = state.UserName
+	user.Enabled = state.Active
+	err := UserRepo.UpdateUser(ctx, user)
+	if err != nil {
+		return err
+	}
+	if revoke {
+		RevocationRepo.Revoke(ctx, user.Email)
+	}
+	return nil
+}
+
+// saveScimGroup stores the group state into the group and synchronize its members
+func saveScimGroup(ctx context.Context, tenant *connector.Tenant, group *connector.Group, state *scimGroupState) error {
+	if len(state.DisplayName) == 0 {
+		return NewScimError(http.StatusBadRequest, "invalidValue", "displayName is required")
+	}
+	if state.DisplayName != group.GroupName {
+		if existing, err := GroupRepo.GetGroupByName(ctx, state.DisplayName, tenant.Domain); err == nil && existing != nil {
+			return NewScimError(http.StatusConflict, "uniqueness", fmt.Sprintf("displayName %s already exist", state.DisplayName))
+		}
+		group.GroupName = state.DisplayName
+		err := GroupRepo.UpdateGroup(ctx, group)
+		if err != nil {
+			return err
+		}
+	}
+	current, err := scimGroupMembers(ctx, group)
+	if err != nil {
+		return err
+	}
+	currentIDs := make([]string, len(current))
+	for i, user := range current {
+		currentIDs[i] = user.RecID
+		if helper.StringArrayContainString(state.Members, user.RecID) {
+			continue
+		}
+		ug, err := UserGroupRepo.GetUserGroup(ctx, user, group)
+		if err != nil || ug == nil {
+			continue
+		}
+		err = UserGroupRepo.DeleteUserGroup(ctx, ug)
+		if err != nil {
+			return err
+		}
+		RevocationRepo.Revoke(ctx, user.Email)
+	}
+	for _, id := range state.Members {
+		if helper.StringArrayContainString(currentIDs, id) {
+			continue
+		}
+		user, err := scimTenantUser(ctx, tenant, id)
+		if err != nil {
+			return NewScimError(http.StatusBadRequest, "invalidValue", fmt.Sprintf("member %s is not a user of this tenant", id))
+		}
+		_, err = UserGroupRepo.CreateUserGroup(ctx, user, group)
+		if err != nil {
+			return err
+		}
+		RevocationRepo.Revoke(ctx, user.Email)
+	}
+	return nil
+}
+
+// scimGroupAuditState returns the current state of the group to record in the audit log,
+// nil if there is no audit log or the members can not be listed.
+func scimGroupAuditState(ctx context.Context, group *connector.Group) *scimGroupState {
+	if AuditRepo == nil {
+		return nil
+	}
+	members, err := scimGroupMembers(ctx, group)
+	if err != nil {
+		return nil
+	}
+	state := &scimGroupState{DisplayName: group.GroupName, Members: make([]string, len(members))}
+	for i, user := range members {
+		state.Members[i] = user.RecID
+	}
+	return state
+}
+
+// ScimServiceProviderConfig serving SCIM service provider configuration
+func ScimServiceProviderConfig(w http.ResponseWriter, r *http.Request) {
+	supported := func(b bool) map[string]interface{} {
+		return map[string]interface{}{"supported": b}
+	}
+	writeScimResponse(w, http.StatusOK, map[string]interface{}{
+		"schemas":          []string{"urn:ietf:params:scim:schemas:core:2.0:ServiceProviderConfig"},
+		"documentationUri": "https://github.com/hyperjumptech/hansip",
+		"patch":            supported(true),
+		"bulk": map[string]interface{}{
+			"supported":      false,
+			"maxOperations":  0,
+			"maxPayloadSize": 0,
+		},
+		"filter": map[string]interface{}{
+			"supported":  true,
+			"maxResults": scimMaxResults,
+		},
+		"changePassword": supported(false),
+		"sort":           supported(false),
+		"etag":           supported(false),
+		"authenticationSchemes": []map[string]interface{}{
+			{
+				"type":        "oauthbearertoken",
+				"name":        "OAuth Bearer Token",
+				"description": "Authentication using hansip access token of a tenant admin",
+				"primary":     true,
+			},
+		},
+		"meta": &ScimMeta{
+			ResourceType: "ServiceProviderConfig",
+			Location:     fmt.Sprintf("%s/ServiceProviderConfig", scimBaseURL(r)),
+		},
+	})
+}
+
+func scimAttribute(name, typ string, multiValued, required bool, mutability, uniqueness string, subAttributes ...map[string]interface{}) map[string]interface{} {
+	ret := map[string]interface{}{
+		"name":        name,
+		"type":        typ,
+		"multiValued": multiValued,
+		"required":    required,
+		"caseExact":   false,
+		"mutability":  mutability,
+		"returned":    "default",
+		"uniqueness":  uniqueness,
+	}
+	if len(subAttributes) > 0 {
+		ret["subAttributes"] = subAttributes
+	}
+	return ret
+}
+
+func scimSchemas(r *http.Request) []interface{} {
+	return []interface{}{
+		map[string]interface{}{
+			"schemas":     []string{"urn:ietf:params:scim:schemas:core:2.0:Schema"},
+			"id":          ScimUserSchema,
+			"name":        "User",
+			"description": "User Account",
+			"attributes": []interface{}{
+				scimAttribute("userName", "string", false, true, "readWrite", "server"),
+				scimAttribute("active", "boolean", false, false, "readWrite", "none"),
+				scimAttribute("password", "string", false, false, "writeOnly", "none"),
+				scimAttribute("emails", "complex", true, false, "readWrite", "none",
+					scimAttribute("value", "string", false, false, "readWrite", "none"),
+					scimAttribute("type", "string", false, false, "readWrite", "none"),
+					scimAttribute("primary", "boolean", false, false, "readWrite", "none")),
+				scimAttribute("groups", "complex", true, false, "readOnly", "none",
+					scimAttribute("value", "string", false, false, "readOnly", "none"),
+					scimAttribute("$ref", "reference", false, false, "readOnly", "none"),
+					scimAttribute("display", "string", false, false, "readOnly", "none")),
+			},
+			"meta": &ScimMeta{
+				ResourceType: "Schema",
+				Location:     fmt.Sprintf("%s/Schemas/%s", scimBaseURL(r), ScimUserSchema),
+			},
+		},
+		map[string]interface{}{
+			"schemas":     []string{"urn:ietf:params:scim:schemas:core:2.0:Schema"},
+			"id":          ScimGroupSchema,
+			"name":        "Group",
+			"description": "Group",
+			"attributes": []interface{}{
+				scimAttribute("displayName", "string", false, true, "readWrite", "server"),
+				scimAttribute("members", "complex", true, false, "readWrite", "none",
+					scimAttribute("value", "string", false, false, "immutable", "none"),
+					scimAttribute("$ref", "reference", false, false, "immutable", "none"),
+					scimAttribute("display", "string", false, false, "readOnly", "none")),
+			},
+			"meta": &ScimMeta{
+				ResourceType: "Schema",
+				Location:     fmt.Sprintf("%s/Schemas/%s", scimBaseURL(r), ScimGroupSchema),
+			},
+		},
+	}
+}
+
+// ScimSchemas serving SCIM schemas of the supported resources
+func ScimSchemas(w http.ResponseWriter, r *http.Request) {
+	schemas := scimSchemas(r)
+	writeScimResponse(w, http.StatusOK, scimPage(schemas, 1, len(schemas)))
+}
+
+// ScimSchema serving a single SCIM schema
+func ScimSchema(w http.ResponseWriter, r *http.Request) {
+	params, err := helper.ParsePathParams(fmt.Sprintf("%s/Schemas/{schemaId}", scimPrefix), r.URL.Path)
+	if err != nil {
+		panic(err)
+	}
+	for _, schema := range scimSchemas(r) {
+		if schema.(map[string]interface{})["id"] == params["schemaId"] {
+			writeScimResponse(w, http.StatusOK, schema)
+			return
+		}
+	}
+	writeScimError(w, NewScimError(http.StatusNotFound, "", fmt.Sprintf("Schema %s not found", params["schemaId"])))
+}
+
+// ScimResourceTypes serving SCIM resource types
+func ScimResourceTypes(w http.ResponseWriter, r *http.Request) {
+	resourceType := func(name, endpoint, schema string) interface{} {
+		return map[string]interface{}{
+			"schemas":  []string{"urn:ietf:params:scim:schemas:core:2.0:ResourceType"},
+			"id":       name,
+			"name":     name,
+			"endpoint": endpoint,
+			"schema":   schema,
+			"meta": &ScimMeta{
+				ResourceType: "ResourceType",
+				Location:     fmt.Sprintf("%s/ResourceTypes/%s", scimBaseURL(r), name),
+			},
+		}
+	}
+	types := []interface{}{
+		resourceType("User", "/Users", ScimUserSchema),
+		resourceType("Group", "/Groups", ScimGroupSchema),
+	}
+	writeScimResponse(w, http.StatusOK, scimPage(types, 1, len(types)))
+}
+
+// ScimListUsers serving SCIM user listing of the tenant
+func ScimListUsers(w http.ResponseWriter, r *http.Request) {
+	fLog := scimLog.WithField("func", "ScimListUsers").WithField("RequestID", r.Context().Value(constants.RequestID)).WithField("path", r.URL.Path).WithField("method", r.Method)
+	tenant, err := scimTenant(r)
+	if err != nil {
+		writeScimError(w, err)
+		return
+	}
+	filter, startIndex, count, err := scimListParameters(r)
+	if err != nil {
+		writeScimError(w, err)
+		return
+	}
+	filters, err := scimUserListFilters(filter)
+	if err != nil {
+		writeScimError(w, NewScimError(http.StatusBadRequest, "invalidFilter", err.Error()))
+		return
+	}
+	users, total, err := scimTenantUsers(r.Context(), tenant, filters, startIndex, count)
+	if err != nil {
+		fLog.Errorf("UserTenantRepo.ListUserTenantByDomains got %s", err.Error())
+		writeScimError(w, err)
+		return
+	}
+	var groups map[string][]*connector.Group
+	withGroups := !scimExcluded(r, "groups")
+	if withGroups {
+		groups, err = UserGroupRepo.ListUserGroupByUsers(r.Context(), users, tenant.Domain)
+		if err != nil {
+			fLog.Errorf("UserGroupRepo.ListUserGroupByUsers got %s", err.Error())
+			writeScimError(w, err)
+			return
+		}
+	}
+	ret := &ScimListResponse{
+		Schemas:      []string{ScimListResponseSchema},
+		TotalResults: total,
+		StartIndex:   startIndex,
+		ItemsPerPage: len(users),
+		Resources:    make([]interface{}, len(users)),
+	}
+	for i, user := range users {
+		resource := newScimUser(r, user)
+		if withGroups {
+			resource.Groups = scimGroupRefs(r, groups[user.RecID])
+		}
+		ret.Resources[i] = resource
+	}
+	writeScimResponse(w, http.StatusOK, ret)
+}
+
+// ScimGetUser serving SCIM user fetch
+func ScimGetUser(w http.ResponseWriter, r *http.Request) {
+	tenant, err := scimTenant(r)
+	if err != nil {
+		writeScimError(w, err)
+		return
+	}
+	params, err := helper.ParsePathParams(fmt.Sprintf("%s/Users/{userRecId}", scimPrefix), r.URL.Path)
+	if err != nil {
+		panic(err)
+	}
+	user, err := scimTenantUser(r.Context(), tenant, params["userRecId"])
+	if err != nil {
+		writeScimError(w, err)
+		return
+	}
+	resource, err := scimUserResource(r, tenant, user, !scimExcluded(r, "groups"))
+	if err != nil {
+		writeScimError(w, err)
+		return
+	}
+	writeScimResponse(w, http.StatusOK, resource)
+}
+
+// ScimCreateUser serving SCIM user provisioning. If password is not provided, activation email is sent to the user.
+func ScimCreateUser(w http.ResponseWriter, r *http.Request) {
+	fLog := scimLog.WithField("func", "ScimCreateUser").WithField("RequestID", r.Context().Value(constants.RequestID)).WithField("path", r.URL.Path).WithField("method", r.Method)
+	tenant, err := scimTenant(r)
+	if err != nil {
+		writeScimError(w, err)
+		return
+	}
+	req := &scimUserRequest{}
+	if err := readScimBody(r, req); err != nil {
+		writeScimError(w, err)
+		return
+	}
+	if len(req.UserName) == 0 && len(req.Emails) > 0 {
+		req.UserName = req.Emails[0].Value
+	}
+	if len(req.UserName) == 0 {
+		writeScimError(w, NewScimError(http.StatusBadRequest, "invalidValue", "userName is required"))
+		return
+	}
+	if err := validateEmail(req.UserName); err != nil {
+		writeScimError(w, NewScimError(http.StatusBadRequest, "invalidValue", err.Error()))
+		return
+	}
+	if existing, err := UserRepo.GetUserByEmail(r.Context(), req.UserName); err == nil && existing != nil {
+		writeScimError(w, NewScimError(http.StatusConflict, "uniqueness", fmt.Sprintf("userName %s already exist", req.UserName)))
+		return
+	}
+	settings := tenantSettings(r.Context(), tenant)
+	passphrase := req.Password
+	if len(passphrase) > 0 {
+		if ok, msg := validatePassphrase(settings, passphrase); !ok {
+			writeScimError(w, NewScimError(http.StatusBadRequest, "invalidValue", fmt.Sprintf("Invalid password. %s", msg)))
+			return
+		}
+	} else {
+		// user sets its own passphrase upon activation, until then it is a secret no one knows.
+		var err error
+		passphrase, err = helper.MakeSecretString(32)
+		if err != nil {
+			fLog.Errorf("helper.MakeSecretString got %s", err.Error())
+			writeScimError(w, err)
+			return
+		}
+	}
+	user, err := UserRepo.CreateUserRecord(r.Context(), req.UserName, passphrase)
+	if err != nil {
+		fLog.Errorf("UserRepo.CreateUserRecord got %s", err.Error())
+		writeScimError(w, err)
+		return
+	}
+	if req.Active != nil && *req.Active {
+		user.Enabled = true
+		err = UserRepo.UpdateUser(r.Context(), user)
+		if err != nil {
+			fLog.Errorf("UserRepo.UpdateUser got %s", err.Error())
+			writeScimError(w, err)
+			return
+		}
+	}
+	_, err = UserTenantRepo.CreateUserTenant(r.Context(), user, tenant)
+	if err != nil {
+		fLog.Errorf("UserTenantRepo.CreateUserTenant got %s", err.Error())
+		writeScimError(w, err)
+		return
+	}
+	resource, err := scimUserResource(r, tenant, user, true)
+	if err != nil {
+		writeScimError(w, err)
+		return
+	}
+	auditUser(r, "user.create", user, nil, &scimUserState{UserName: user.Email, Active: user.Enabled})
+	events.Publish(r.Context(), &events.UserCreated{User: user, Tenant: tenant, Source: events.SourceScim, Verify: len(req.Password) == 0, Settings: settings})
+	w.Header().Set("Location", resource.Meta.Location)
+	writeScimResponse(w, http.StatusCreated, resource)
+}
+
+// ScimReplaceUser serving SCIM user replacement
+func ScimReplaceUser(w http.ResponseWriter, r *http.Request) {
+	tenant, err := scimTenant(r)
+	if err != nil {
+		writeScimError(w, err)
+		return
+	}
+	params, err := helper.ParsePathParams(fmt.Sprintf("%s/Users/{userRecId}", scimPrefix), r.URL.Path)
+	if err != nil {
+		panic(err)
+	}
+	user, err := scimManagedUser(r, tenant, params["userRecId"])
+	if err != nil {
+		writeScimError(w, err)
+		return
+	}
+	req := &scimUserRequest{}
+	if err := readScimBody(r, req); err != nil {
+		writeScimError(w, err)
+		return
+	}
+	state := &scimUserState{UserName: req.UserName, Active: req.Active == nil || *req.Active}
+	if len(state.UserName) == 0 && len(req.Emails) > 0 {
+		state.UserName = req.Emails[0].Value
+	}
+	before := &scimUserState{UserName: user.Email, Active: user.Enabled}
+	if err := saveScimUser(r.Context(), user, state); err != nil {
+		writeScimError(w, err)
+		return
+	}
+	auditUser(r, "user.update", user, before, state)
+	if !before.Active && user.Enabled {
+		events.Publish(r.Context(), &events.UserActivated{User: user})
+	}
+	resource, err := scimUserResource(r, tenant, user, true)
+	if err != nil {
+		writeScimError(w, err)
+		return
+	}
+	writeScimResponse(w, http.StatusOK, resource)
+}
+
+// ScimPatchUser serving SCIM user patch
+func ScimPatchUser(w http.ResponseWriter, r *http.Request) {
+	tenant, err := scimTenant(r)
+	if err != nil {
+		writeScimError(w, err)
+		return
+	}
+	params, err := helper.ParsePathParams(fmt.Sprintf("%s/Users/{userRecId}", scimPrefix), r.URL.Path)
+	if err != nil {
+		panic(err)
+	}
+	user, err := scimManagedUser(r, tenant, params["userRecId"])
+	if err != nil {
+		writeScimError(w, err)
+		return
+	}
+	req := &ScimPatchRequest{}
+	if err := readScimBody(r, req); err != nil {
+		writeScimError(w, err)
+		return
+	}
+	before := &scimUserState{UserName: user.Email, Active: user.Enabled}
+	state := &scimUserState{UserName: user.Email, Active: user.Enabled}
+	if err := applyScimUserPatch(state, req.Operations); err != nil {
+		writeScimError(w, err)
+		return
+	}
+	if err := saveScimUser(r.Context(), user, state); err != nil {
+		writeScimError(w, err)
+		return
+	}
+	auditUser(r, "user.update", user, before, state)
+	if !before.Active && user.Enabled {
+		events.Publish(r.Context(), &events.UserActivated{User: user})
+	}
+	resource, err := scimUserResource(r, tenant, user, true)
+	if err != nil {
+		writeScimError(w, err)
+		return
+	}
+	writeScimResponse(w, http.StatusOK, resource)
+}
+
+// ScimDeleteUser serving SCIM user deprovisioning
+func ScimDeleteUser(w http.ResponseWriter, r *http.Request) {
+	fLog := scimLog.WithField("func", "ScimDeleteUser").WithField("RequestID", r.Context().Value(constants.RequestID)).WithField("path", r.URL.Path).WithField("method", r.Method)
+	tenant, err := scimTenant(r)
+	if err != nil {
+		writeScimError(w, err)
+		return
+	}
+	params, err := helper.ParsePathParams(fmt.Sprintf("%s/Users/{userRecId}", scimPrefix), r.URL.Path)
+	if err != nil {
+		panic(err)
+	}
+	user, err := scimManagedUser(r, tenant, params["userRecId"])
+	if err != nil {
+		writeScimError(w, err)
+		return
+	}
+	memberOf, err := listUserTenants(r.Context(), user)
+	if err != nil {
+		fLog.Errorf("UserTenantRepo.ListUserTenantByUser got %s", err.Error())
+		writeScimError(w, err)
+		return
+	}
+	if len(memberOf) > 1 {
+		// the user still belongs to other tenants, only its membership of this tenant is deprovisioned
+		ut, err := UserTenantRepo.GetUserTenant(r.Context(), user, tenant)
+		if err == nil {
+			err = UserTenantRepo.DeleteUserTenant(r.Context(), ut)
+		}
+		if err != nil {
+			fLog.Errorf("UserTenantRepo.DeleteUserTenant got %s", err.Error())
+			writeScimError(w, err)
+			return
+		}
+		RevocationRepo.Revoke(r.Context(), user.Email)
+		audit(r, &connector.AuditEvent{
+			Event:        "user.tenant.remove",
+			TargetType:   AuditTargetUser,
+			Target:       user.RecID,
+			TenantDomain: tenant.Domain,
+		}, auditLink("tenant", tenant.Domain), nil)
+		writeScimResponse(w, http.StatusNoContent, nil)
+		return
+	}
+	tenants := deletedUserTenants(r.Context(), user)
+	err = UserRepo.DeleteUser(r.Context(), user)
+	if err != nil {
+		fLog.Errorf("UserRepo.DeleteUser got %s", err.Error())
+		writeScimError(w, err)
+		return
+	}
+	RevocationRepo.Revoke(r.Context(), user.Email)
+	audit(r, &connector.AuditEvent{
+		Event:        "user.delete",
+		TargetType:   AuditTargetUser,
+		Target:       user.RecID,
+		TenantDomain: tenant.Domain,
+	}, &scimUserState{UserName: user.Email, Active: user.Enabled}, nil)
+	events.Publish(r.Context(), &events.UserDeleted{User: user, Tenants: tenants})
+	writeScimResponse(w, http.StatusNoContent, nil)
+}
+
+// ScimListGroups serving SCIM group listing of the tenant
+func ScimListGroups(w http.ResponseWriter, r *http.Request) {
+	fLog := scimLog.WithField("func", "ScimListGroups").WithField("RequestID", r.Context().Value(constants.RequestID)).WithField("path", r.URL.Path).WithField("method", r.Method)
+	tenant, err := scimTenant(r)
+	if err != nil {
+		writeScimError(w, err)
+		return
+	}
+	filter, startIndex, count, err := scimListParameters(r)
+	if err != nil {
+		writeScimError(w, err)
+		return
+	}
+	filters, err := scimGroupListFilters(filter)
+	if err != nil {
+		writeScimError(w, NewScimError(http.StatusBadRequest, "invalidFilter", err.Error()))
+		return
+	}
+	groups, total, err := scimTenantGroups(r.Context(), tenant, filters, startIndex, count)
+	if err != nil {
+		fLog.Errorf("GroupRepo.ListGroups got %s", err.Error())
+		writeScimError(w, err)
+		return
+	}
+	withMembers := !scimExcluded(r, "members")
+	ret := &ScimListResponse{
+		Schemas:      []string{ScimListResponseSchema},
+		TotalResults: total,
+		StartIndex:   startIndex,
+		ItemsPerPage: len(groups),
+		Resources:    make([]interface{}, len(groups)),
+	}
+	for i, group := range groups {
+		resource, err := scimGroupResource(r, group, withMembers)
+		if err != nil {
+			fLog.Errorf("scimGroupResource got %s", err.Error())
+			writeScimError(w, err)
+			return
+		}
+		ret.Resources[i] = resource
+	}
+	writeScimResponse(w, http.StatusOK, ret)
+}
+
+// ScimGetGroup serving SCIM group fetch
+func ScimGetGroup(w http.ResponseWriter, r *http.Request) {
+	tenant, err := scimTenant(r)
+	if err != nil {
+		writeScimError(w, err)
+		return
+	}
+	params, err := helper.ParsePathParams(fmt.Sprintf("%s/Groups/{groupRecId}", scimPrefix), r.URL.Path)
+	if err != nil {
+		panic(err)
+	}
+	group, err := scimTenantGroup(r.Context(), tenant, params["groupRecId"])
+	if err != nil {
+		writeScimError(w, err)
+		return
+	}
+	resource, err := scimGroupResource(r, group, !scimExcluded(r, "members"))
+	if err != nil {
+		writeScimError(w, err)
+		return
+	}
+	writeScimResponse(w, http.StatusOK, resource)
+}
+
+// ScimCreateGroup serving SCIM group provisioning
+func ScimCreateGroup(w http.ResponseWriter, r *http.Request) {
+	fLog := scimLog.WithField("func", "ScimCreateGroup").WithField("RequestID", r.Context().Value(constants.RequestID)).WithField("path", r.URL.Path).WithField("method", r.Method)
+	tenant, err := scimTenant(r)
+	if err != nil {
+		writeScimError(w, err)
+		return
+	}
+	req := &scimGroupRequest{}
+	if err := readScimBody(r, req); err != nil {
+		writeScimError(w, err)
+		return
+	}
+	if len(req.DisplayName) == 0 {
+		writeScimError(w, NewScimError(http.StatusBadRequest, "invalidValue", "displayName is required"))
+		return
+	}
+	if existing, err := GroupRepo.GetGroupByName(r.Context(), req.DisplayName, tenant.Domain); err == nil && existing != nil {
+		writeScimError(w, NewScimError(http.StatusConflict, "uniqueness", fmt.Sprintf("displayName %s already exist", req.DisplayName)))
+		return
+	}
+	state := &scimGroupState{DisplayName: req.DisplayName, Members: make([]string, 0, len(req.Members))}
+	for _, member := range req.Members {
+		state.Members = append(state.Members, member.Value)
+	}
+	group, err := GroupRepo.CreateGroup(r.Context(), req.DisplayName, tenant.Domain, "")
+	if err != nil {
+		fLog.Errorf("GroupRepo.CreateGroup got %s", err.Error())
+		writeScimError(w, err)
+		return
+	}
+	if err := saveScimGroup(r.Context(), tenant, group, state); err != nil {
+		writeScimError(w, err)
+		return
+	}
+	resource, err := scimGroupResource(r, group, true)
+	if err != nil {
+		writeScimError(w, err)
+		return
+	}
+	auditGroup(r, "group.create", group, nil, state)
+	w.Header().Set("Location", resource.Meta.Location)
+	writeScimResponse(w, http.StatusCreated, resource)
+}
+
+// ScimReplaceGroup serving SCIM group replacement
+func ScimReplaceGroup(w http.ResponseWriter, r *http.Request) {
+	tenant, err := scimTenant(r)
+	if err != nil {
+		writeScimError(w, err)
+		return
+	}
+	params, err := helper.ParsePathParams(fmt.Sprintf("%s/Groups/{groupRecId}", scimPrefix), r.URL.Path)
+	if err != nil {
+		panic(err)
+	}
+	group, err := scimTenantGroup(r.Context(), tenant, params["groupRecId"])
+	if err != nil {
+		writeScimError(w, err)
+		return
+	}
+	req := &scimGroupRequest{}
+	if err := readScimBody(r, req); err != nil {
+		writeScimError(w, err)
+		return
+	}
+	state := &scimGroupState{DisplayName: req.DisplayName, Members: make([]string, 0, len(req.Members))}
+	for _, member := range req.Members {
+		state.Members = append(state.Members, member.Value)
+	}
+	before := scimGroupAuditState(r.Context(), group)
+	if err := saveScimGroup(r.Context(), tenant, group, state); err != nil {
+		writeScimError(w, err)
+		return
+	}
+	auditGroup(r, "group.update", group, before, state)
+	resource, err := scimGroupResource(r, group, true)
+	if err != nil {
+		writeScimError(w, err)
+		return
+	}
+	writeScimResponse(w, http.StatusOK, resource)
+}
+
+// ScimPatchGroup serving SCIM group patch
+func ScimPatchGroup(w http.ResponseWriter, r *http.Request) {
+	tenant, err := scimTenant(r)
+	if err != nil {
+		writeScimError(w, err)
+		return
+	}
+	params, err := helper.ParsePathParams(fmt.Sprintf("%s/Groups/{groupRecId}", scimPrefix), r.URL.Path)
+	if err != nil {
+		panic(err)
+	}
+	group, err := scimTenantGroup(r.Context(), tenant, params["groupRecId"])
+	if err != nil {
+		writeScimError(w, err)
+		return
+	}
+	req := &ScimPatchRequest{}
+	if err := readScimBody(r, req); err != nil {
+		writeScimError(w, err)
+		return
+	}
+	members, err := scimGroupMembers(r.Context(), group)
+	if err != nil {
+		writeScimError(w, err)
+		return
+	}
+	state := &scimGroupState{DisplayName: group.GroupName, Members: make([]string, len(members))}
+	for i, user := range members {
+		state.Members[i] = user.RecID
+	}
+	before := &scimGroupState{DisplayName: state.DisplayName, Members: append([]string{}, state.Members...)}
+	if err := applyScimGroupPatch(state, req.Operations); err != nil {
+		writeScimError(w, err)
+		return
+	}
+	if err := saveScimGroup(r.Context(), tenant, group, state); err != nil {
+		writeScimError(w, err)
+		return
+	}
+	auditGroup(r, "group.update", group, before, state)
+	resource, err := scimGroupResource(r, group, !scimExcluded(r, "members"))
+	if err != nil {
+		writeScimError(w, err)
+		return
+	}
+	writeScimResponse(w, http.StatusOK, resource)
+}
+
+// ScimDeleteGroup serving SCIM group deletion
+func ScimDeleteGroup(w http.ResponseWriter, r *http.Request) {
+	fLog := scimLog.WithField("func", "ScimDeleteGroup").WithField("RequestID", r.Context().Value(constants.RequestID)).WithField("path", r.URL.Path).WithField("method", r.Method)
+	tenant, err := scimTenant(r)
+	if err != nil {
+		writeScimError(w, err)
+		return
+	}
+	params, err := helper.ParsePathParams(fmt.Sprintf("%s/Groups/{groupRecId}", scimPrefix), r.URL.Path)
+	if err != nil {
+		panic(err)
+	}
+	group, err := scimTenantGroup(r.Context(), tenant, params["groupRecId"])
+	if err != nil {
+		writeScimError(w, err)
+		return
+	}
+	before := scimGroupAuditState(r.Context(), group)
+	err = GroupRepo.DeleteGroup(r.Context(), group)
+	if err != nil {
+		fLog.Errorf("GroupRepo.DeleteGroup got %s", err.Error())
+		writeScimError(w, err)
+		return
+	}
+	auditGroup(r, "group.delete", group, before, nil)
+	writeScimResponse(w, http.StatusNoContent, nil)
+}
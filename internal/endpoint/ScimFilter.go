@@ -0,0 +1,477 @@
+package endpoint
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/hyperjumptech/hansip/pkg/helper"
+)
+
+// ScimFilter is a parsed SCIM filter expression as specified in RFC 7644 section 3.4.2.2
+type ScimFilter interface {
+	// Match evaluates the filter against a resource, in form of its decoded json.
+	Match(resource map[string]interface{}) bool
+}
+
+// ParseScimFilter parses a SCIM filter expression, eg. `userName eq "john@doe.com" and active eq true`
+func ParseScimFilter(filter string) (ScimFilter, error) {
+	tokens, err := tokenizeScimFilter(filter)
+	if err != nil {
+		return nil, err
+	}
+	p := &scimFilterParser{tokens: tokens}
+	f, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if !p.eof() {
+		return nil, fmt.Errorf("unexpected %s in filter", p.peek().text)
+	}
+	return f, nil
+}
+
+type scimTokenKind int
+
+const (
+	scimTokenWord scimTokenKind = iota
+	scimTokenString
+	scimTokenOpenParen
+	scimTokenCloseParen
+	scimTokenOpenBracket
+	scimTokenCloseBracket
+)
+
+type scimToken struct {
+	kind scimTokenKind
+	text string
+}
+
+func tokenizeScimFilter(filter string) ([]*scimToken, error) {
+	tokens := make([]*scimToken, 0)
+	runes := []rune(filter)
+	for i := 0; i < len(runes); {
+		c := runes[i]
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c == '(':
+			tokens = append(tokens, &scimToken{scimTokenOpenParen, "("})
+			i++
+		case c == ')':
+			tokens = append(tokens, &scimToken{scimTokenCloseParen, ")"})
+			i++
+		case c == '[':
+			tokens = append(tokens, &scimToken{scimTokenOpenBracket, "["})
+			i++
+		case c == ']':
+			tokens = append(tokens, &scimToken{scimTokenCloseBracket, "]"})
+			i++
+		case c == '"':
+			// find the closing quote, honoring escaped characters.
+			j := i + 1
+			for ; j < len(runes) && runes[j] != '"'; j++ {
+				if runes[j] == '\\' {
+					j++
+				}
+			}
+			if j >= len(runes) {
+				return nil, fmt.Errorf("unterminated string in filter")
+			}
+			s, err := strconv.Unquote(string(runes[i : j+1]))
+			if err != nil {
+				return nil, fmt.Errorf("invalid string %s in filter", string(runes[i:j+1]))
+			}
+			tokens = append(tokens, &scimToken{scimTokenString, s})
+			i = j + 1
+		default:
+			j := i
+			for ; j < len(runes) && !unicode.IsSpace(runes[j]) && !strings.ContainsRune("()[]\"", runes[j]); j++ {
+			}
+			tokens = append(tokens, &scimToken{scimTokenWord, string(runes[i:j])})
+			i = j
+		}
+	}
+	return tokens, nil
+}
+
+type scimFilterParser struct {
+	tokens []*scimToken
+	pos    int
+}
+
+func (p *scimFilterParser) eof() bool {
+	return p.pos >= len(p.tokens)
+}
+
+func (p *scimFilterParser) peek() *scimToken {
+	if p.eof() {
+		return &scimToken{scimTokenWord, ""}
+	}
+	return p.tokens[p.pos]
+}
+
+func (p *scimFilterParser) next() *scimToken {
+	t := p.peek()
+	p.pos++
+	return t
+}
+
+func (p *scimFilterParser) isKeyword(keyword string) bool {
+	t := p.peek()
+	return !p.eof() && t.kind == scimTokenWord && strings.EqualFold(t.text, keyword)
+}
+
+func (p *scimFilterParser) parseOr() (ScimFilter, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.isKeyword("or") {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &scimLogicalFilter{and: false, left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *scimFilterParser) parseAnd() (ScimFilter, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.isKeyword("and") {
+		p.next()
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &scimLogicalFilter{and: true, left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *scimFilterParser) parseUnary() (ScimFilter, error) {
+	if p.isKeyword("not") {
+		p.next()
+		if p.next().kind != scimTokenOpenParen {
+			return nil, fmt.Errorf("expecting ( after not")
+		}
+		f, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.next().kind != scimTokenCloseParen {
+			return nil, fmt.Errorf("expecting )")
+		}
+		return &scimNotFilter{filter: f}, nil
+	}
+	if p.peek().kind == scimTokenOpenParen {
+		p.next()
+		f, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.next().kind != scimTokenCloseParen {
+			return nil, fmt.Errorf("expecting )")
+		}
+		return f, nil
+	}
+	return p.parseAttribute()
+}
+
+func (p *scimFilterParser) parseAttribute() (ScimFilter, error) {
+	attr := p.next()
+	if attr.kind != scimTokenWord || len(attr.text) == 0 {
+		return nil, fmt.Errorf("expecting attribute name but %s", attr.text)
+	}
+	path := scimAttributePath(attr.text)
+	if p.peek().kind == scimTokenOpenBracket {
+		p.next()
+		f, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.next().kind != scimTokenCloseBracket {
+			return nil, fmt.Errorf("expecting ]")
+		}
+		return &scimValuePathFilter{path: path, filter: f}, nil
+	}
+	op := p.next()
+	if op.kind != scimTokenWord {
+		return nil, fmt.Errorf("expecting operator after %s", attr.text)
+	}
+	operator := strings.ToLower(op.text)
+	if operator == "pr" {
+		return &scimCompareFilter{path: path, operator: operator}, nil
+	}
+	switch operator {
+	case "eq", "ne", "co", "sw", "ew", "gt", "ge", "lt", "le":
+	default:
+		return nil, fmt.Errorf("unknown operator %s", op.text)
+	}
+	if p.eof() {
+		return nil, fmt.Errorf("expecting value after %s %s", attr.text, op.text)
+	}
+	val := p.next()
+	var value interface{}
+	switch {
+	case val.kind == scimTokenString:
+		value = val.text
+	case val.kind != scimTokenWord:
+		return nil, fmt.Errorf("expecting value but %s", val.text)
+	case strings.EqualFold(val.text, "true"):
+		value = true
+	case strings.EqualFold(val.text, "false"):
+		value = false
+	case strings.EqualFold(val.text, "null"):
+		value = nil
+	default:
+		num, err := strconv.ParseFloat(val.text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value %s", val.text)
+		}
+		value = num
+	}
+	return &scimCompareFilter{path: path, operator: operator, value: value}, nil
+}
+
+// scimAttributePath splits an attribute path into its lower cased components, removing the schema URN prefix if any.
+func scimAttributePath(attr string) []string {
+	if strings.HasPrefix(strings.ToLower(attr), "urn:") {
+		if idx := strings.LastIndex(attr, ":"); idx > 0 {
+			attr = attr[idx+1:]
+		}
+	}
+	return strings.Split(strings.ToLower(attr), ".")
+}
+
+// scimAttributeValues returns all values of the attribute path within the resource.
+// multi valued attributes are flattened.
+func scimAttributeValues(resource map[string]interface{}, path []string) []interface{} {
+	var current interface{} = resource
+	values := []interface{}{current}
+	for _, name := range path {
+		nextValues := make([]interface{}, 0)
+		for _, v := range values {
+			m, ok := v.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			for k, child := range m {
+				if strings.ToLower(k) != name {
+					continue
+				}
+				if arr, ok := child.([]interface{}); ok {
+					nextValues = append(nextValues, arr...)
+				} else if child != nil {
+					nextValues = append(nextValues, child)
+				}
+			}
+		}
+		values = nextValues
+	}
+	return values
+}
+
+type scimLogicalFilter struct {
+	and         bool
+	left, right ScimFilter
+}
+
+func (f *scimLogicalFilter) Match(resource map[string]interface{}) bool {
+	if f.and {
+		return f.left.Match(resource) && f.right.Match(resource)
+	}
+	return f.left.Match(resource) || f.right.Match(resource)
+}
+
+type scimNotFilter struct {
+	filter ScimFilter
+}
+
+func (f *scimNotFilter) Match(resource map[string]interface{}) bool {
+	return !f.filter.Match(resource)
+}
+
+type scimValuePathFilter struct {
+	path   []string
+	filter ScimFilter
+}
+
+func (f *scimValuePathFilter) Match(resource map[string]interface{}) bool {
+	for _, v := range scimAttributeValues(resource, f.path) {
+		if m, ok := v.(map[string]interface{}); ok && f.filter.Match(m) {
+			return true
+		}
+	}
+	return false
+}
+
+type scimCompareFilter struct {
+	path     []string
+	operator string
+	value    interface{}
+}
+
+func (f *scimCompareFilter) Match(resource map[string]interface{}) bool {
+	values := scimAttributeValues(resource, f.path)
+	if f.operator == "pr" {
+		for _, v := range values {
+			if s, ok := v.(string); !ok || len(s) > 0 {
+				return true
+			}
+		}
+		return false
+	}
+	if f.value == nil {
+		switch f.operator {
+		case "eq":
+			return len(values) == 0
+		case "ne":
+			return len(values) > 0
+		}
+		return false
+	}
+	if f.operator == "ne" {
+		for _, v := range values {
+			if scimCompare(v, "eq", f.value) {
+				return false
+			}
+		}
+		return true
+	}
+	for _, v := range values {
+		if scimCompare(v, f.operator, f.value) {
+			return true
+		}
+	}
+	return false
+}
+
+func scimCompare(attrValue interface{}, operator string, value interface{}) bool {
+	switch expect := value.(type) {
+	case string:
+		actual, ok := attrValue.(string)
+		if !ok {
+			return false
+		}
+		actual, expect = strings.ToLower(actual), strings.ToLower(expect)
+		switch operator {
+		case "eq":
+			return actual == expect
+		case "co":
+			return strings.Contains(actual, expect)
+		case "sw":
+			return strings.HasPrefix(actual, expect)
+		case "ew":
+			return strings.HasSuffix(actual, expect)
+		case "gt":
+			return actual > expect
+		case "ge":
+			return actual >= expect
+		case "lt":
+			return actual < expect
+		case "le":
+			return actual <= expect
+		}
+	case bool:
+		actual, ok := attrValue.(bool)
+		return ok && operator == "eq" && actual == expect
+	case float64:
+		actual, ok := attrValue.(float64)
+		if !ok {
+			return false
+		}
+		switch operator {
+		case "eq":
+			return actual == expect
+		case "gt":
+			return actual > expect
+		case "ge":
+			return actual >= expect
+		case "lt":
+			return actual < expect
+		case "le":
+			return actual <= expect
+		}
+	}
+	return false
+}
+
+// scimListField is the listing filter field of a resource attribute, holding either strings or booleans
+type scimListField struct {
+	field   string
+	boolean bool
+}
+
+// scimUserListFields maps the user attributes a user listing can be filtered by to the listing filter fields
+var scimUserListFields = map[string]*scimListField{
+	"username":     {field: "email"},
+	"emails":       {field: "email"},
+	"emails.value": {field: "email"},
+	"active":       {field: "enabled", boolean: true},
+}
+
+// scimGroupListFields maps the group attributes a group listing can be filtered by to the listing filter fields
+var scimGroupListFields = map[string]*scimListField{
+	"displayname": {field: "group_name"},
+}
+
+// scimUserListFilters translates a user filter into listing filters, so the users are filtered by the database.
+// Only comparisons of userName, emails and active joined with and can be translated.
+func scimUserListFilters(filter ScimFilter) ([]*helper.Filter, error) {
+	return scimListFilters(filter, scimUserListFields, "user")
+}
+
+// scimGroupListFilters translates a group filter into listing filters, so the groups are filtered by the database.
+// Only comparisons of displayName joined with and can be translated.
+func scimGroupListFilters(filter ScimFilter) ([]*helper.Filter, error) {
+	return scimListFilters(filter, scimGroupListFields, "group")
+}
+
+// scimListFilters translates the comparisons of the fields joined with and into listing filters
+func scimListFilters(filter ScimFilter, fields map[string]*scimListField, resource string) ([]*helper.Filter, error) {
+	switch f := filter.(type) {
+	case nil:
+		return nil, nil
+	case *scimLogicalFilter:
+		if !f.and {
+			return nil, fmt.Errorf("or is not supported in %s filter", resource)
+		}
+		left, err := scimListFilters(f.left, fields, resource)
+		if err != nil {
+			return nil, err
+		}
+		right, err := scimListFilters(f.right, fields, resource)
+		if err != nil {
+			return nil, err
+		}
+		return append(left, right...), nil
+	case *scimCompareFilter:
+		attribute := strings.Join(f.path, ".")
+		field, ok := fields[attribute]
+		if !ok {
+			return nil, fmt.Errorf("attribute %s is not supported in %s filter", attribute, resource)
+		}
+		switch value := f.value.(type) {
+		case string:
+			switch f.operator {
+			case "eq", "ne", "co", "sw", "gt", "ge", "lt", "le":
+				if !field.boolean {
+					return []*helper.Filter{{Field: field.field, Operator: f.operator, Value: value}}, nil
+				}
+			}
+		case bool:
+			if field.boolean && (f.operator == "eq" || f.operator == "ne") {
+				return []*helper.Filter{{Field: field.field, Operator: f.operator, Value: strconv.FormatBool(value)}}, nil
+			}
+		}
+		return nil, fmt.Errorf("operator %s is not supported for %s in %s filter", f.operator, attribute, resource)
+	}
+	return nil, fmt.Errorf("%s filter supports comparisons joined with and only", resource)
+}
@@ -0,0 +1,150 @@
+package endpoint
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestParseScimFilter(t *testing.T) {
+	resource := make(map[string]interface{})
+	err := json.Unmarshal([]byte(`{
+		"schemas": ["urn:ietf:params:scim:schemas:core:2.0:User"],
+		"id": "abc",
+		"userName": "John.Doe@acme.com",
+		"active": true,
+		"emails": [{"value": "john.doe@acme.com", "type": "work", "primary": true}],
+		"groups": [{"value": "g1", "display": "staff"}, {"value": "g2", "display": "finance"}],
+		"meta": {"resourceType": "User"}
+	}`), &resource)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testData := []struct {
+		filter string
+		expect bool
+	}{
+		{`userName eq "john.doe@acme.com"`, true},
+		{`USERNAME Eq "JOHN.DOE@ACME.COM"`, true},
+		{`urn:ietf:params:scim:schemas:core:2.0:User:userName eq "john.doe@acme.com"`, true},
+		{`userName eq "jane@acme.com"`, false},
+		{`userName ne "jane@acme.com"`, true},
+		{`userName sw "john"`, true},
+		{`userName ew "acme.com"`, true},
+		{`userName co "doe"`, true},
+		{`active eq true`, true},
+		{`active eq false`, false},
+		{`externalId pr`, false},
+		{`userName pr`, true},
+		{`externalId eq null`, true},
+		{`meta.resourceType eq "User"`, true},
+		{`emails.value eq "john.doe@acme.com"`, true},
+		{`emails[type eq "work" and value co "doe"]`, true},
+		{`emails[type eq "home"]`, false},
+		{`groups.display eq "finance"`, true},
+		{`userName eq "jane@acme.com" or active eq true`, true},
+		{`userName eq "jane@acme.com" and active eq true`, false},
+		{`not (userName eq "jane@acme.com") and (active eq true or id eq "x")`, true},
+	}
+	for _, td := range testData {
+		f, err := ParseScimFilter(td.filter)
+		if err != nil {
+			t.Errorf("ParseScimFilter(%s) got error %s", td.filter, err.Error())
+			continue
+		}
+		if f.Match(resource) != td.expect {
+			t.Errorf("filter %s expect %v", td.filter, td.expect)
+		}
+	}
+}
+
+func TestParseScimFilterError(t *testing.T) {
+	testData := []string{
+		``,
+		`userName`,
+		`userName xx "a"`,
+		`userName eq`,
+		`userName eq "unterminated`,
+		`(userName eq "a"`,
+		`emails[type eq "work"`,
+		`userName eq "a" and`,
+		`userName eq "a" "b"`,
+	}
+	for _, filter := range testData {
+		if _, err := ParseScimFilter(filter); err == nil {
+			t.Errorf("ParseScimFilter(%s) expect error", filter)
+		}
+	}
+}
+
+func TestScimUserListFilters(t *testing.T) {
+	testData := []struct {
+		filter string
+		expect string
+	}{
+		{`userName eq "john@acme.com"`, `email eq john@acme.com`},
+		{`emails.value co "acme" and active eq false`, `email co acme;enabled eq false`},
+		{`(emails sw "j" and userName ne "jane@acme.com") and active eq true`, `email sw j;email ne jane@acme.com;enabled eq true`},
+		{`userName eq "a" or userName eq "b"`, ``},
+		{`not (userName eq "a")`, ``},
+		{`userName ew "acme.com"`, ``},
+		{`userName pr`, ``},
+		{`emails[type eq "work"]`, ``},
+		{`groups.display eq "staff"`, ``},
+		{`active gt true`, ``},
+	}
+	for _, td := range testData {
+		parsed, err := ParseScimFilter(td.filter)
+		if err != nil {
+			t.Fatalf("ParseScimFilter(%s) got %s", td.filter, err.Error())
+		}
+		filters, err := scimUserListFilters(parsed)
+		if len(td.expect) == 0 {
+			if err == nil {
+				t.Errorf("filter %s expect not supported", td.filter)
+			}
+			continue
+		}
+		got := make([]string, len(filters))
+		for i, f := range filters {
+			got[i] = f.Field + " " + f.Operator + " " + f.Value
+		}
+		if err != nil || strings.Join(got, ";") != td.expect {
+			t.Errorf("filter %s expect %s but got %s, %v", td.filter, td.expect, strings.Join(got, ";"), err)
+		}
+	}
+}
+
+func TestScimGroupListFilters(t *testing.T) {
+	testData := []struct {
+		filter string
+		expect string
+	}{
+		{`displayName eq "staff"`, `group_name eq staff`},
+		{`displayName sw "dev" and displayName ne "devops"`, `group_name sw dev;group_name ne devops`},
+		{`displayName eq "a" or displayName eq "b"`, ``},
+		{`displayName eq true`, ``},
+		{`members.value eq "john"`, ``},
+		{`userName eq "john@acme.com"`, ``},
+	}
+	for _, td := range testData {
+		parsed, err := ParseScimFilter(td.filter)
+		if err != nil {
+			t.Fatalf("ParseScimFilter(%s) got %s", td.filter, err.Error())
+		}
+		filters, err := scimGroupListFilters(parsed)
+		if len(td.expect) == 0 {
+			if err == nil {
+				t.Errorf("filter %s expect not supported", td.filter)
+			}
+			continue
+		}
+		got := make([]string, len(filters))
+		for i, f := range filters {
+			got[i] = f.Field + " " + f.Operator + " " + f.Value
+		}
+		if err != nil || strings.Join(got, ";") != td.expect {
+			t.Errorf("filter %s expect %s but got %s, %v", td.filter, td.expect, strings.Join(got, ";"), err)
+		}
+	}
+}
@@ -0,0 +1,225 @@
+package endpoint
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/hyperjumptech/hansip/internal/connector"
+	"github.com/hyperjumptech/hansip/internal/constants"
+	"github.com/hyperjumptech/hansip/internal/hansipcontext"
+	"github.com/hyperjumptech/hansip/pkg/helper"
+)
+
+func scimPatchOperations(t *testing.T, body string) []*ScimPatchOperation {
+	req := &ScimPatchRequest{}
+	if err := json.Unmarshal([]byte(body), req); err != nil {
+		t.Fatal(err)
+	}
+	return req.Operations
+}
+
+func TestApplyScimUserPatch(t *testing.T) {
+	state := &scimUserState{UserName: "john@acme.com", Active: true}
+	ops := scimPatchOperations(t, `{"schemas":["urn:ietf:params:scim:api:messages:2.0:PatchOp"],"Operations":[
+		{"op":"Replace","path":"active","value":"False"},
+		{"op":"replace","value":{"userName":"john.doe@acme.com","name.givenName":"John"}}
+	]}`)
+	if err := applyScimUserPatch(state, ops); err != nil {
+		t.Fatal(err)
+	}
+	if state.Active || state.UserName != "john.doe@acme.com" {
+		t.Errorf("unexpected state %v", state)
+	}
+
+	ops = scimPatchOperations(t, `{"Operations":[{"op":"replace","path":"emails[type eq \"work\"].value","value":"jd@acme.com"}]}`)
+	if err := applyScimUserPatch(state, ops); err != nil {
+		t.Fatal(err)
+	}
+	if state.UserName != "jd@acme.com" {
+		t.Errorf("expect username to be changed by email but %s", state.UserName)
+	}
+
+	ops = scimPatchOperations(t, `{"Operations":[{"op":"remove","path":"active"}]}`)
+	err := applyScimUserPatch(state, ops)
+	if err == nil || err.(*ScimError).ScimType != "mutability" {
+		t.Errorf("expect mutability error but %v", err)
+	}
+	ops = scimPatchOperations(t, `{"Operations":[{"op":"move","path":"active","value":true}]}`)
+	if err := applyScimUserPatch(state, ops); err == nil {
+		t.Errorf("expect error on unknown operation")
+	}
+}
+
+func TestApplyScimGroupPatch(t *testing.T) {
+	state := &scimGroupState{DisplayName: "staff", Members: []string{"u1", "u2"}}
+	ops := scimPatchOperations(t, `{"Operations":[
+		{"op":"add","path":"members","value":[{"value":"u2"},{"value":"u3"}]},
+		{"op":"remove","path":"members[value eq \"u1\"]"},
+		{"op":"replace","path":"displayName","value":"employees"}
+	]}`)
+	if err := applyScimGroupPatch(state, ops); err != nil {
+		t.Fatal(err)
+	}
+	if state.DisplayName != "employees" || strings.Join(state.Members, ",") != "u2,u3" {
+		t.Errorf("unexpected state %v", state)
+	}
+
+	ops = scimPatchOperations(t, `{"Operations":[{"op":"remove","path":"members","value":[{"value":"u3"}]}]}`)
+	if err := applyScimGroupPatch(state, ops); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(state.Members, ",") != "u2" {
+		t.Errorf("unexpected members %v", state.Members)
+	}
+
+	ops = scimPatchOperations(t, `{"Operations":[{"op":"replace","value":{"members":[{"value":"u9"}]}}]}`)
+	if err := applyScimGroupPatch(state, ops); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(state.Members, ",") != "u9" {
+		t.Errorf("unexpected members %v", state.Members)
+	}
+
+	ops = scimPatchOperations(t, `{"Operations":[{"op":"remove","path":"members"}]}`)
+	if err := applyScimGroupPatch(state, ops); err != nil {
+		t.Fatal(err)
+	}
+	if len(state.Members) != 0 {
+		t.Errorf("expect all members removed but %v", state.Members)
+	}
+
+	ops = scimPatchOperations(t, `{"Operations":[{"op":"replace","path":"owner","value":"x"}]}`)
+	err := applyScimGroupPatch(state, ops)
+	if err == nil || err.(*ScimError).ScimType != "invalidPath" {
+		t.Errorf("expect invalidPath error but %v", err)
+	}
+}
+
+func TestScimPage(t *testing.T) {
+	resources := []interface{}{1, 2, 3, 4, 5}
+	page := scimPage(resources, 2, 2)
+	if page.TotalResults != 5 || page.ItemsPerPage != 2 || page.Resources[0] != 2 {
+		t.Errorf("unexpected page %v", page)
+	}
+	page = scimPage(resources, 10, 2)
+	if page.ItemsPerPage != 0 || len(page.Resources) != 0 {
+		t.Errorf("unexpected page %v", page)
+	}
+}
+
+// memoryTenantUsers pages the users it is given as the users of any domain
+type memoryTenantUsers struct {
+	connector.UserTenantRepository
+	users []*connector.User
+}
+
+func (m *memoryTenantUsers) ListUserTenantByDomains(ctx context.Context, domains []string, request *helper.PageRequest) ([]*connector.User, *helper.Page, error) {
+	page := helper.NewPage(request, uint(len(m.users)))
+	return m.users[page.OffsetStart:page.OffsetEnd], page, nil
+}
+
+func TestScimTenantUsers(t *testing.T) {
+	defer func() { UserTenantRepo = nil }()
+	users := make([]*connector.User, 0)
+	for i := 1; i <= 7; i++ {
+		users = append(users, &connector.User{RecID: fmt.Sprintf("u%d", i)})
+	}
+	UserTenantRepo = &memoryTenantUsers{users: users}
+	tenant := &connector.Tenant{Domain: "acme.com"}
+	ids := func(list []*connector.User) string {
+		ret := make([]string, len(list))
+		for i, u := range list {
+			ret[i] = u.RecID
+		}
+		return strings.Join(ret, ",")
+	}
+	for _, tc := range []struct {
+		startIndex, count int
+		expect            string
+	}{
+		{1, 3, "u1,u2,u3"},
+		{3, 3, "u3,u4,u5"},
+		{6, 3, "u6,u7"},
+		{7, 1, "u7"},
+		{8, 3, ""},
+		{20, 3, ""},
+		{2, 0, ""},
+		{1, 200, "u1,u2,u3,u4,u5,u6,u7"},
+	} {
+		list, total, err := scimTenantUsers(context.Background(), tenant, nil, tc.startIndex, tc.count)
+		if err != nil || total != 7 || ids(list) != tc.expect {
+			t.Errorf("startIndex %d count %d expect %s of 7 but got %s of %d, %v", tc.startIndex, tc.count, tc.expect, ids(list), total, err)
+		}
+	}
+}
+
+// memoryTenantGroups pages the groups it is given as the groups of any tenant
+type memoryTenantGroups struct {
+	connector.GroupRepository
+	groups []*connector.Group
+}
+
+func (m *memoryTenantGroups) ListGroups(ctx context.Context, tenant *connector.Tenant, request *helper.PageRequest) ([]*connector.Group, *helper.Page, error) {
+	page := helper.NewPage(request, uint(len(m.groups)))
+	return m.groups[page.OffsetStart:page.OffsetEnd], page, nil
+}
+
+func TestScimTenantGroups(t *testing.T) {
+	defer func() { GroupRepo = nil }()
+	groups := make([]*connector.Group, 0)
+	for i := 1; i <= 5; i++ {
+		groups = append(groups, &connector.Group{RecID: fmt.Sprintf("g%d", i)})
+	}
+	GroupRepo = &memoryTenantGroups{groups: groups}
+	tenant := &connector.Tenant{Domain: "acme.com"}
+	for _, tc := range []struct {
+		startIndex, count int
+		expect            string
+	}{
+		{1, 2, "g1,g2"},
+		{2, 2, "g2,g3"},
+		{4, 3, "g4,g5"},
+		{6, 2, ""},
+		{1, 0, ""},
+	} {
+		list, total, err := scimTenantGroups(context.Background(), tenant, nil, tc.startIndex, tc.count)
+		got := make([]string, len(list))
+		for i, group := range list {
+			got[i] = group.RecID
+		}
+		if err != nil || total != 5 || strings.Join(got, ",") != tc.expect {
+			t.Errorf("startIndex %d count %d expect %s of 5 but got %s of %d, %v", tc.startIndex, tc.count, tc.expect, strings.Join(got, ","), total, err)
+		}
+	}
+}
+
+func TestScimManagedUser(t *testing.T) {
+	defer func() { UserTenantRepo, UserRepo = nil, nil }()
+	acme := &connector.Tenant{RecID: "acme", Domain: "acme.com"}
+	UserTenantRepo = &memoryMembership{tenants: map[string][]*connector.Tenant{
+		"john": {acme},
+		"boss": {acme},
+	}}
+	UserRepo = &memoryDirectory{
+		users: map[string]*connector.User{"john": {RecID: "john"}, "boss": {RecID: "boss"}, "jane": {RecID: "jane"}},
+		roles: map[string][]*connector.Role{"boss": {{RoleName: "admin", RoleDomain: "hansip"}}},
+	}
+	authCtx := &hansipcontext.AuthenticationContext{Subject: "scim@acme.com", Audience: []string{"admin@acme.com"}}
+	r := httptest.NewRequest(http.MethodPut, "/scim/v2/Users/boss", nil)
+	r = r.WithContext(context.WithValue(r.Context(), constants.HansipAuthentication, authCtx))
+
+	if user, err := scimManagedUser(r, acme, "john"); err != nil || user.RecID != "john" {
+		t.Errorf("acme token should manage john but got %v", err)
+	}
+	if _, err := scimManagedUser(r, acme, "boss"); err == nil || err.(*ScimError).Status != "403" {
+		t.Errorf("acme token should not manage boss, the hansip admin, but got %v", err)
+	}
+	if _, err := scimManagedUser(r, acme, "jane"); err == nil || err.(*ScimError).Status != "404" {
+		t.Errorf("jane is not member of acme, expect not found but got %v", err)
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"strings"
 
 	"github.com/hyperjumptech/hansip/internal/config"
+	"github.com/hyperjumptech/hansip/internal/connector"
 	"github.com/hyperjumptech/hansip/internal/constants"
 	"github.com/hyperjumptech/hansip/internal/hansipcontext"
 	"github.com/hyperjumptech/hansip/pkg/helper"
@@ -28,7 +29,7 @@ func ListAllTenants(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	authCtx := iauthctx.(*hansipcontext.AuthenticationContext)
-	if !authCtx.IsAnAdmin() {
+	if !authCtx.HasAnyScope(readScopes...) {
 		fLog.Tracef("Missing right")
 		helper.WriteHTTPResponse(r.Context(), w, http.StatusForbidden, "You don't have the right to access this resource", nil, nil)
 		return
@@ -42,7 +43,7 @@ func ListAllTenants(w http.ResponseWriter, r *http.Request) {
 	tenants, page, err := TenantRepo.ListTenant(r.Context(), pageRequest)
 	if err != nil {
 		fLog.Errorf("TenantRepo.ListTenant got %s", err.Error())
-		helper.WriteHTTPResponse(r.Context(), w, http.StatusInternalServerError, err.Error(), nil, nil)
+		helper.WriteHTTPResponse(r.Context(), w, listErrorStatus(err), err.Error(), nil, nil)
 		return
 	}
 	ret := make(map[string]interface{})
@@ -96,6 +97,7 @@ func CreateNewTenant(w http.ResponseWriter, r *http.Request) {
 		helper.WriteHTTPResponse(r.Context(), w, http.StatusBadRequest, err.Error(), nil, nil)
 		return
 	}
+	auditTenant(r, "tenant.create", tenant, nil, tenant)
 	helper.WriteHTTPResponse(r.Context(), w, http.StatusOK, "Success creating tenant", nil, tenant)
 	return
 }
@@ -109,7 +111,7 @@ func GetTenantDetail(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	authCtx := iauthctx.(*hansipcontext.AuthenticationContext)
-	if !authCtx.IsAnAdmin() {
+	if !authCtx.HasAnyScope(readScopes...) {
 		helper.WriteHTTPResponse(r.Context(), w, http.StatusForbidden, "You don't have the right to access this resource", nil, nil)
 		return
 	}
@@ -124,10 +126,10 @@ func GetTenantDetail(w http.ResponseWriter, r *http.Request) {
 		helper.WriteHTTPResponse(r.Context(), w, http.StatusNotFound, err.Error(), nil, nil)
 		return
 	}
-	helper.WriteHTTPResponse(r.Context(), w, http.StatusOK, "Tenant retrieved", nil, tenant)
+	helper.WriteHTTPResponse(r.Context(), w, http.StatusOK, "Tenant retrieved", etagHeader(tenant.RecID, tenant.Version), tenant)
 }
 
-// UpdateTenantDetail serving request to update tenant detail
+// UpdateTenantDetail serving request to update tenant detail, entirely with PUT or partially with PATCH merge patch
 func UpdateTenantDetail(w http.ResponseWriter, r *http.Request) {
 	fLog := tenantMgmtLog.WithField("func", "UpdateTenantDetail").WithField("RequestID", r.Context().Value(constants.RequestID)).WithField("path", r.URL.Path).WithField("method", r.Method)
 	iauthctx := r.Context().Value(constants.HansipAuthentication)
@@ -146,26 +148,34 @@ func UpdateTenantDetail(w http.ResponseWriter, r *http.Request) {
 		panic(err)
 	}
 
-	req := &CreateTenantRequest{}
-	body, err := ioutil.ReadAll(r.Body)
+	tenant, err := TenantRepo.GetTenantByRecID(r.Context(), params["tenantRecId"])
 	if err != nil {
-		fLog.Errorf("ioutil.ReadAll got %s", err.Error())
-		helper.WriteHTTPResponse(r.Context(), w, http.StatusInternalServerError, err.Error(), nil, nil)
+		fLog.Errorf("GroupRepo.GetGroupByRecID got %s", err.Error())
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusNotFound, err.Error(), nil, nil)
 		return
 	}
-	err = json.Unmarshal(body, req)
+
+	req := &CreateTenantRequest{}
+	current := &CreateTenantRequest{
+		TenantName:   tenant.Name,
+		TenantDomain: tenant.Domain,
+		Description:  tenant.Description,
+	}
+	status, err := readUpdateRequest(r, req, current)
 	if err != nil {
-		fLog.Errorf("json.Unmarshal got %s", err.Error())
+		fLog.Errorf("readUpdateRequest got %s", err.Error())
+		helper.WriteHTTPResponse(r.Context(), w, status, err.Error(), nil, nil)
+		return
+	}
+	if err := validateTenantRequest(req); err != nil {
+		fLog.Errorf("validateTenantRequest got %s", err.Error())
 		helper.WriteHTTPResponse(r.Context(), w, http.StatusBadRequest, err.Error(), nil, nil)
 		return
 	}
-
-	tenant, err := TenantRepo.GetTenantByRecID(r.Context(), params["tenantRecId"])
-	if err != nil {
-		fLog.Errorf("GroupRepo.GetGroupByRecID got %s", err.Error())
-		helper.WriteHTTPResponse(r.Context(), w, http.StatusNotFound, err.Error(), nil, nil)
+	if !checkIfMatch(w, r, tenant.RecID, tenant.Version) {
 		return
 	}
+	before := *tenant
 	tenant.Name = req.TenantName
 	tenant.Domain = req.TenantDomain
 	tenant.Description = req.Description
@@ -180,11 +190,12 @@ func UpdateTenantDetail(w http.ResponseWriter, r *http.Request) {
 	err = TenantRepo.UpdateTenant(r.Context(), tenant)
 	if err != nil {
 		fLog.Errorf("TenantRepo.UpdateTenant got %s", err.Error())
-		helper.WriteHTTPResponse(r.Context(), w, http.StatusInternalServerError, err.Error(), nil, nil)
+		helper.WriteHTTPResponse(r.Context(), w, updateErrorStatus(err), err.Error(), nil, nil)
 		return
 	}
 
-	helper.WriteHTTPResponse(r.Context(), w, http.StatusOK, "Tenant updated", nil, tenant)
+	auditTenant(r, "tenant.update", tenant, &before, tenant)
+	helper.WriteHTTPResponse(r.Context(), w, http.StatusOK, "Tenant updated", etagHeader(tenant.RecID, tenant.Version), tenant)
 
 }
 
@@ -212,11 +223,48 @@ func DeleteTenant(w http.ResponseWriter, r *http.Request) {
 		helper.WriteHTTPResponse(r.Context(), w, http.StatusNotFound, err.Error(), nil, nil)
 		return
 	}
+	if !checkIfMatch(w, r, tenant.RecID, tenant.Version) {
+		return
+	}
 	err = TenantRepo.DeleteTenant(r.Context(), tenant)
 	if err != nil {
 		fLog.Errorf("TenantRepo.DeleteTenant got %s", err.Error())
 		helper.WriteHTTPResponse(r.Context(), w, http.StatusInternalServerError, err.Error(), nil, nil)
 		return
 	}
+	auditTenant(r, "tenant.delete", tenant, tenant, nil)
 	helper.WriteHTTPResponse(r.Context(), w, http.StatusOK, "Group deleted", nil, nil)
 }
+
+// adminTenant loads the tenant of the request path and makes sure the caller is its admin.
+// If it fails, it writes the error response and returns nil.
+func adminTenant(w http.ResponseWriter, r *http.Request, pathTemplate string) (*connector.Tenant, map[string]string) {
+	return scopedTenant(w, r, pathTemplate)
+}
+
+// scopedTenant loads the tenant of the request path and makes sure the caller is its admin or have one of the scopes on it.
+// If it fails, it writes the error response and returns nil.
+func scopedTenant(w http.ResponseWriter, r *http.Request, pathTemplate string, scopes ...string) (*connector.Tenant, map[string]string) {
+	fLog := tenantMgmtLog.WithField("func", "scopedTenant").WithField("RequestID", r.Context().Value(constants.RequestID)).WithField("path", r.URL.Path).WithField("method", r.Method)
+	iauthctx := r.Context().Value(constants.HansipAuthentication)
+	if iauthctx == nil {
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusUnauthorized, "You are not authorized to access this resource", nil, nil)
+		return nil, nil
+	}
+	params, err := helper.ParsePathParams(fmt.Sprintf("%s%s", apiPrefix, pathTemplate), r.URL.Path)
+	if err != nil {
+		panic(err)
+	}
+	tenant, err := TenantRepo.GetTenantByRecID(r.Context(), params["tenantRecId"])
+	if err != nil {
+		fLog.Errorf("TenantRepo.GetTenantByRecID got %s", err.Error())
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusNotFound, err.Error(), nil, nil)
+		return nil, nil
+	}
+	authCtx := iauthctx.(*hansipcontext.AuthenticationContext)
+	if !authCtx.HasScopeOfDomain(tenant.Domain, scopes...) {
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusForbidden, "You don't have the right to access tenant with the specified domain", nil, nil)
+		return nil, nil
+	}
+	return tenant, params
+}
@@ -0,0 +1,440 @@
+package endpoint
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/mail"
+	"strconv"
+	"text/template"
+	"unicode"
+
+	"github.com/hyperjumptech/hansip/internal/config"
+	"github.com/hyperjumptech/hansip/internal/connector"
+	"github.com/hyperjumptech/hansip/internal/constants"
+	"github.com/hyperjumptech/hansip/internal/hansipcontext"
+	"github.com/hyperjumptech/hansip/internal/mailer"
+	"github.com/hyperjumptech/hansip/internal/messenger"
+	"github.com/hyperjumptech/hansip/internal/passphrase"
+	"github.com/hyperjumptech/hansip/pkg/helper"
+	"github.com/hyperjumptech/jiffy"
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	tenantSettingLog = log.WithField("go", "TenantSettingManagement")
+
+	// TenantSettingKeys list of configuration keys that can be overridden by tenant, mapped to its validator.
+	// Security settings can only be overridden to be stricter than the configuration.
+	TenantSettingKeys = map[string]func(string) error{
+		"security.passphrase.minchars":         minIntSetting("security.passphrase.minchars"),
+		"security.passphrase.minwords":         minIntSetting("security.passphrase.minwords"),
+		"security.passphrase.mincharsinword":   minIntSetting("security.passphrase.mincharsinword"),
+		"security.lockout.failcount":           maxIntSetting("security.lockout.failcount"),
+		"token.access.duration":                maxDurationSetting("token.access.duration"),
+		"token.refresh.duration":               maxDurationSetting("token.refresh.duration"),
+		"invitation.expiry":                    maxDurationSetting("invitation.expiry"),
+		"mailer.from":                          validateAddressSetting,
+		"mailer.from.name":                     validateNameSetting,
+		"mailer.templates.emailveri.subject":   validateTemplateSetting,
+		"mailer.templates.emailveri.body":      validateTemplateSetting,
+		"mailer.templates.emailveri.text":      validateTemplateSetting,
+		"mailer.templates.passrecover.subject": validateTemplateSetting,
+		"mailer.templates.passrecover.body":    validateTemplateSetting,
+		"mailer.templates.passrecover.text":    validateTemplateSetting,
+		"mailer.templates.invitation.subject":  validateTemplateSetting,
+		"mailer.templates.invitation.body":     validateTemplateSetting,
+		"mailer.templates.invitation.text":     validateTemplateSetting,
+		"mailer.templates.emailotp.subject":    validateTemplateSetting,
+		"mailer.templates.emailotp.body":       validateTemplateSetting,
+		"mailer.templates.emailotp.text":       validateTemplateSetting,
+		"security.2fa.email.expiry":            maxDurationSetting("security.2fa.email.expiry"),
+		"security.2fa.email.resend":            minDurationSetting("security.2fa.email.resend"),
+		"security.2fa.email.maxattempts":       maxIntSetting("security.2fa.email.maxattempts"),
+		"messenger.templates.otp.text":         validateTemplateSetting,
+		"messenger.templates.security.text":    validateTemplateSetting,
+	}
+
+	// tenantSettingStricter maps the security settings to the comparison telling if a value is stricter than another,
+	// to combine the settings of the tenants of a user
+	tenantSettingStricter = map[string]func(value, than string) bool{
+		"security.passphrase.minchars":       higherIntSetting,
+		"security.passphrase.minwords":       higherIntSetting,
+		"security.passphrase.mincharsinword": higherIntSetting,
+		"security.lockout.failcount":         lowerIntSetting,
+		"token.access.duration":              shorterDurationSetting,
+		"token.refresh.duration":             shorterDurationSetting,
+		"invitation.expiry":                  shorterDurationSetting,
+		"security.2fa.email.expiry":          shorterDurationSetting,
+		"security.2fa.email.resend":          longerDurationSetting,
+		"security.2fa.email.maxattempts":     lowerIntSetting,
+	}
+)
+
+// tenantSettingValidator returns the validator of a setting the tenant can override.
+// Besides TenantSettingKeys, the email and message templates of every locale can be overridden,
+// eg. mailer.templates.invitation.id.body or messenger.templates.otp.id.text
+func tenantSettingValidator(key string) (func(string) error, bool) {
+	if validator, ok := TenantSettingKeys[key]; ok {
+		return validator, true
+	}
+	if mailer.IsLocalizedTemplateSetting(key) || messenger.IsLocalizedTemplateSetting(key) {
+		return validateTemplateSetting, true
+	}
+	return nil, false
+}
+
+func validateIntSetting(value string) error {
+	i, err := strconv.Atoi(value)
+	if err != nil {
+		return err
+	}
+	if i < 0 {
+		return fmt.Errorf("value must not be negative")
+	}
+	return nil
+}
+
+// minIntSetting returns the validator of an integer setting the tenant may raise but not lower below the configuration
+func minIntSetting(key string) func(string) error {
+	return func(value string) error {
+		if err := validateIntSetting(value); err != nil {
+			return err
+		}
+		if i, _ := strconv.Atoi(value); i < config.GetInt(key) {
+			return fmt.Errorf("value must not be less than %d", config.GetInt(key))
+		}
+		return nil
+	}
+}
+
+// maxIntSetting returns the validator of an integer setting the tenant may lower but not raise above the configuration
+func maxIntSetting(key string) func(string) error {
+	return func(value string) error {
+		if err := validateIntSetting(value); err != nil {
+			return err
+		}
+		if i, _ := strconv.Atoi(value); i > config.GetInt(key) {
+			return fmt.Errorf("value must not be more than %d", config.GetInt(key))
+		}
+		return nil
+	}
+}
+
+func validateDurationSetting(value string) error {
+	_, err := jiffy.DurationOf(value)
+	return err
+}
+
+// minDurationSetting returns the validator of a duration setting the tenant may lengthen but not shorten below the configuration
+func minDurationSetting(key string) func(string) error {
+	return func(value string) error {
+		d, err := jiffy.DurationOf(value)
+		if err != nil {
+			return err
+		}
+		if global, err := jiffy.DurationOf(config.Get(key)); err == nil && d < global {
+			return fmt.Errorf("value must not be shorter than %s", config.Get(key))
+		}
+		return nil
+	}
+}
+
+// maxDurationSetting returns the validator of a duration setting the tenant may shorten but not lengthen above the configuration
+func maxDurationSetting(key string) func(string) error {
+	return func(value string) error {
+		d, err := jiffy.DurationOf(value)
+		if err != nil {
+			return err
+		}
+		if d <= 0 {
+			return fmt.Errorf("value must be positive")
+		}
+		if global, err := jiffy.DurationOf(config.Get(key)); err == nil && d > global {
+			return fmt.Errorf("value must not be longer than %s", config.Get(key))
+		}
+		return nil
+	}
+}
+
+// validateAddressSetting validates a bare email address, without name, the name being set apart
+func validateAddressSetting(value string) error {
+	address, err := mail.ParseAddress(value)
+	if err != nil {
+		return err
+	}
+	if len(address.Name) > 0 || address.Address != value {
+		return fmt.Errorf("value must be an email address only")
+	}
+	return nil
+}
+
+// validateNameSetting validates a display name, it must not hold line breaks nor other control characters
+func validateNameSetting(value string) error {
+	for _, r := range value {
+		if unicode.IsControl(r) {
+			return fmt.Errorf("value must not contain control characters")
+		}
+	}
+	return nil
+}
+
+func higherIntSetting(value, than string) bool {
+	i, _ := strconv.Atoi(value)
+	j, _ := strconv.Atoi(than)
+	return i > j
+}
+
+func lowerIntSetting(value, than string) bool {
+	return higherIntSetting(than, value)
+}
+
+func longerDurationSetting(value, than string) bool {
+	d, _ := jiffy.DurationOf(value)
+	e, _ := jiffy.DurationOf(than)
+	return d > e
+}
+
+func shorterDurationSetting(value, than string) bool {
+	return longerDurationSetting(than, value)
+}
+
+func validateTemplateSetting(value string) error {
+	_, err := template.New("setting").Parse(value)
+	return err
+}
+
+// tenantSettings returns the settings of a tenant. if the settings can not be loaded, global configuration will be used.
+func tenantSettings(ctx context.Context, tenant *connector.Tenant) config.Settings {
+	if tenant == nil || TenantRepo == nil {
+		return config.Settings{}
+	}
+	settings, err := TenantRepo.GetTenantSettings(ctx, tenant)
+	if err != nil {
+		tenantSettingLog.WithField("func", "tenantSettings").WithField("RequestID", ctx.Value(constants.RequestID)).Errorf("TenantRepo.GetTenantSettings got %s", err.Error())
+		return config.Settings{}
+	}
+	// the configuration may have been tightened since the overrides were set, those looser than it are ignored
+	for key, value := range settings {
+		validator, ok := tenantSettingValidator(key)
+		if !ok {
+			continue
+		}
+		if err := validator(value); err != nil {
+			tenantSettingLog.WithField("func", "tenantSettings").WithField("RequestID", ctx.Value(constants.RequestID)).Warnf("tenant %s setting %s ignored, %s", tenant.Domain, key, err.Error())
+			delete(settings, key)
+		}
+	}
+	return config.Settings(settings)
+}
+
+// userSettings returns the settings of the tenants the user is member of. The security settings are the strictest
+// of all the tenants, the others, eg. the mail sender and templates, those of the first tenant by name like userTenant.
+// if the user is not a member of any tenant, global configuration will be used.
+func userSettings(ctx context.Context, user *connector.User) config.Settings {
+	settings := config.Settings{}
+	if user == nil || UserTenantRepo == nil {
+		return settings
+	}
+	tenants := make([]*connector.Tenant, 0)
+	err := allPages(func(request *helper.PageRequest) (int, *helper.Page, error) {
+		request.OrderBy = "TENANT_NAME"
+		page, p, err := UserTenantRepo.ListUserTenantByUser(ctx, user, request)
+		tenants = append(tenants, page...)
+		return len(page), p, err
+	})
+	if err != nil {
+		tenantSettingLog.WithField("func", "userSettings").WithField("RequestID", ctx.Value(constants.RequestID)).Errorf("UserTenantRepo.ListUserTenantByUser got %s", err.Error())
+		return settings
+	}
+	for i, tenant := range tenants {
+		for key, value := range tenantSettings(ctx, tenant) {
+			stricter, security := tenantSettingStricter[key]
+			current, set := settings[key]
+			if (!set && (i == 0 || security)) || (set && security && stricter(value, current)) {
+				settings[key] = value
+			}
+		}
+	}
+	return settings
+}
+
+// userTenant returns the first tenant, by name, the user belongs to, or nil if the user belongs to none
+func userTenant(ctx context.Context, user *connector.User) *connector.Tenant {
+	if user == nil || UserTenantRepo == nil {
+		return nil
+	}
+	tenants, _, err := UserTenantRepo.ListUserTenantByUser(ctx, user, &helper.PageRequest{
+		No:       1,
+		PageSize: 1,
+		OrderBy:  "TENANT_NAME",
+		Sort:     "ASC",
+	})
+	if err != nil {
+		tenantSettingLog.WithField("func", "userTenant").WithField("RequestID", ctx.Value(constants.RequestID)).Errorf("UserTenantRepo.ListUserTenantByUser got %s", err.Error())
+		return nil
+	}
+	if len(tenants) == 0 {
+		return nil
+	}
+	return tenants[0]
+}
+
+// validatePassphrase validates the passphrase against the passphrase rule in the settings.
+// it returns the explanation message if the passphrase is not valid.
+func validatePassphrase(settings config.Settings, pass string) (bool, string) {
+	minChars := settings.GetInt("security.passphrase.minchars")
+	minWords := settings.GetInt("security.passphrase.minwords")
+	minCharsInWord := settings.GetInt("security.passphrase.mincharsinword")
+	if passphrase.Validate(pass, minChars, minWords, minCharsInWord) {
+		return true, ""
+	}
+	return false, fmt.Sprintf("Passphrase must at least has %d characters and %d words and for each word have minimum %d characters", minChars, minWords, minCharsInWord)
+}
+
+// createTokenPair creates access and refresh token using token age from the settings, carrying the additional claims.
+func createTokenPair(settings config.Settings, subject string, audience []string, additional map[string]interface{}) (string, string, error) {
+	accessAge, err := jiffy.DurationOf(settings.Get("token.access.duration"))
+	if err != nil {
+		return "", "", err
+	}
+	refreshAge, err := jiffy.DurationOf(settings.Get("token.refresh.duration"))
+	if err != nil {
+		return "", "", err
+	}
+	return TokenFactory.CreateTokenPairWithAge(subject, audience, additional, accessAge, refreshAge)
+}
+
+// GetTenantSettings serving request to fetch tenant setting overrides
+func GetTenantSettings(w http.ResponseWriter, r *http.Request) {
+	fLog := tenantSettingLog.WithField("func", "GetTenantSettings").WithField("RequestID", r.Context().Value(constants.RequestID)).WithField("path", r.URL.Path).WithField("method", r.Method)
+	iauthctx := r.Context().Value(constants.HansipAuthentication)
+	if iauthctx == nil {
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusUnauthorized, "You are not authorized to access this resource", nil, nil)
+		return
+	}
+	params, err := helper.ParsePathParams(fmt.Sprintf("%s/management/tenant/{tenantRecId}/settings", apiPrefix), r.URL.Path)
+	if err != nil {
+		panic(err)
+	}
+	tenant, err := TenantRepo.GetTenantByRecID(r.Context(), params["tenantRecId"])
+	if err != nil {
+		fLog.Errorf("TenantRepo.GetTenantByRecID got %s", err.Error())
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusNotFound, err.Error(), nil, nil)
+		return
+	}
+	authCtx := iauthctx.(*hansipcontext.AuthenticationContext)
+	if !authCtx.IsAdminOfDomain(tenant.Domain) {
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusForbidden, "You don't have the right to access tenant with the specified domain", nil, nil)
+		return
+	}
+	settings, err := TenantRepo.GetTenantSettings(r.Context(), tenant)
+	if err != nil {
+		fLog.Errorf("TenantRepo.GetTenantSettings got %s", err.Error())
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusInternalServerError, err.Error(), nil, nil)
+		return
+	}
+	helper.WriteHTTPResponse(r.Context(), w, http.StatusOK, "Tenant settings retrieved", nil, settings)
+}
+
+// SetTenantSettings serving request to replace all tenant setting overrides, served in a transaction
+func SetTenantSettings(w http.ResponseWriter, r *http.Request) {
+	fLog := tenantSettingLog.WithField("func", "SetTenantSettings").WithField("RequestID", r.Context().Value(constants.RequestID)).WithField("path", r.URL.Path).WithField("method", r.Method)
+	iauthctx := r.Context().Value(constants.HansipAuthentication)
+	if iauthctx == nil {
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusUnauthorized, "You are not authorized to access this resource", nil, nil)
+		return
+	}
+	params, err := helper.ParsePathParams(fmt.Sprintf("%s/management/tenant/{tenantRecId}/settings", apiPrefix), r.URL.Path)
+	if err != nil {
+		panic(err)
+	}
+	tenant, err := TenantRepo.GetTenantByRecID(r.Context(), params["tenantRecId"])
+	if err != nil {
+		fLog.Errorf("TenantRepo.GetTenantByRecID got %s", err.Error())
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusNotFound, err.Error(), nil, nil)
+		return
+	}
+	authCtx := iauthctx.(*hansipcontext.AuthenticationContext)
+	if !authCtx.IsAdminOfDomain(tenant.Domain) {
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusForbidden, "You don't have the right to access tenant with the specified domain", nil, nil)
+		return
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		fLog.Errorf("ioutil.ReadAll got %s", err.Error())
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusInternalServerError, err.Error(), nil, nil)
+		return
+	}
+	settings := make(map[string]string)
+	err = json.Unmarshal(body, &settings)
+	if err != nil {
+		fLog.Errorf("json.Unmarshal got %s", err.Error())
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusBadRequest, err.Error(), nil, nil)
+		return
+	}
+	for key, value := range settings {
+		validator, ok := tenantSettingValidator(key)
+		if !ok {
+			helper.WriteHTTPResponse(r.Context(), w, http.StatusBadRequest, fmt.Sprintf("setting %s can not be overridden by tenant", key), nil, nil)
+			return
+		}
+		if err := validator(value); err != nil {
+			helper.WriteHTTPResponse(r.Context(), w, http.StatusBadRequest, fmt.Sprintf("invalid value for setting %s. got %s", key, err.Error()), nil, nil)
+			return
+		}
+	}
+	before, _ := TenantRepo.GetTenantSettings(r.Context(), tenant)
+	err = TenantRepo.DeleteTenantSettings(r.Context(), tenant)
+	if err != nil {
+		fLog.Errorf("TenantRepo.DeleteTenantSettings got %s", err.Error())
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusInternalServerError, err.Error(), nil, nil)
+		return
+	}
+	for key, value := range settings {
+		err = TenantRepo.SetTenantSetting(r.Context(), tenant, key, value)
+		if err != nil {
+			fLog.Errorf("TenantRepo.SetTenantSetting got %s", err.Error())
+			helper.WriteHTTPResponse(r.Context(), w, http.StatusInternalServerError, err.Error(), nil, nil)
+			return
+		}
+	}
+	auditTenant(r, "tenant.settings.set", tenant, before, settings)
+	helper.WriteHTTPResponse(r.Context(), w, http.StatusOK, "Tenant settings updated", nil, settings)
+}
+
+// DeleteTenantSettings serving request to remove all tenant setting overrides
+func DeleteTenantSettings(w http.ResponseWriter, r *http.Request) {
+	fLog := tenantSettingLog.WithField("func", "DeleteTenantSettings").WithField("RequestID", r.Context().Value(constants.RequestID)).WithField("path", r.URL.Path).WithField("method", r.Method)
+	iauthctx := r.Context().Value(constants.HansipAuthentication)
+	if iauthctx == nil {
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusUnauthorized, "You are not authorized to access this resource", nil, nil)
+		return
+	}
+	params, err := helper.ParsePathParams(fmt.Sprintf("%s/management/tenant/{tenantRecId}/settings", apiPrefix), r.URL.Path)
+	if err != nil {
+		panic(err)
+	}
+	tenant, err := TenantRepo.GetTenantByRecID(r.Context(), params["tenantRecId"])
+	if err != nil {
+		fLog.Errorf("TenantRepo.GetTenantByRecID got %s", err.Error())
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusNotFound, err.Error(), nil, nil)
+		return
+	}
+	authCtx := iauthctx.(*hansipcontext.AuthenticationContext)
+	if !authCtx.IsAdminOfDomain(tenant.Domain) {
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusForbidden, "You don't have the right to access tenant with the specified domain", nil, nil)
+		return
+	}
+	before, _ := TenantRepo.GetTenantSettings(r.Context(), tenant)
+	err = TenantRepo.DeleteTenantSettings(r.Context(), tenant)
+	if err != nil {
+		fLog.Errorf("TenantRepo.DeleteTenantSettings got %s", err.Error())
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusInternalServerError, err.Error(), nil, nil)
+		return
+	}
+	auditTenant(r, "tenant.settings.delete", tenant, before, nil)
+	helper.WriteHTTPResponse(r.Context(), w, http.StatusOK, "Tenant settings removed", nil, nil)
+}
@@ -0,0 +1,185 @@
+package endpoint
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/hyperjumptech/hansip/internal/config"
+	"github.com/hyperjumptech/hansip/internal/connector"
+	"github.com/hyperjumptech/hansip/internal/constants"
+	"github.com/hyperjumptech/hansip/internal/hansipcontext"
+)
+
+// memoryTenantSettings keeps the settings of a tenant in memory
+type memoryTenantSettings struct {
+	connector.TenantRepository
+	tenant   *connector.Tenant
+	settings map[string]string
+}
+
+func (m *memoryTenantSettings) GetTenantByRecID(ctx context.Context, recID string) (*connector.Tenant, error) {
+	if recID != m.tenant.RecID {
+		return nil, &connector.ErrDBNoResult{Message: "no tenant"}
+	}
+	return m.tenant, nil
+}
+
+func (m *memoryTenantSettings) GetTenantSettings(ctx context.Context, tenant *connector.Tenant) (map[string]string, error) {
+	ret := make(map[string]string)
+	for k, v := range m.settings {
+		ret[k] = v
+	}
+	return ret, nil
+}
+
+func (m *memoryTenantSettings) DeleteTenantSettings(ctx context.Context, tenant *connector.Tenant) error {
+	m.settings = make(map[string]string)
+	return nil
+}
+
+func (m *memoryTenantSettings) SetTenantSetting(ctx context.Context, tenant *connector.Tenant, key, value string) error {
+	m.settings[key] = value
+	return nil
+}
+
+func TestTenantSettingValidators(t *testing.T) {
+	testData := []struct {
+		key    string
+		value  string
+		expect bool
+	}{
+		{"security.passphrase.minchars", "12", true},
+		{"security.passphrase.minchars", "8", true},
+		{"security.passphrase.minchars", "0", false},
+		{"security.passphrase.minwords", "-1", false},
+		{"security.lockout.failcount", "1", true},
+		{"security.lockout.failcount", "1000", false},
+		{"security.lockout.failcount", "many", false},
+		{"token.access.duration", "1 minute", true},
+		{"token.access.duration", "30 days", false},
+		{"invitation.expiry", "0 seconds", false},
+		{"security.2fa.email.resend", "5 minutes", true},
+		{"security.2fa.email.resend", "1 second", false},
+		{"security.2fa.email.maxattempts", "3", true},
+		{"security.2fa.email.maxattempts", "50", false},
+		{"mailer.templates.invitation.body", "Join {{.TenantName}}", true},
+		{"mailer.templates.invitation.body", "Join {{.TenantName", false},
+		{"mailer.templates.invitation.id.body", "Bergabung", true},
+		{"mailer.from", "noreply@acme.com", true},
+		{"mailer.from", "not an address", false},
+		{"mailer.from", "Acme <noreply@acme.com>", false},
+		{"mailer.from", "noreply@acme.com\r\nBcc: all@acme.com", false},
+		{"mailer.from.name", "Acme Support", true},
+		{"mailer.from.name", "Acme\r\nBcc: all@acme.com", false},
+	}
+	for i, td := range testData {
+		validator, ok := tenantSettingValidator(td.key)
+		if !ok {
+			t.Fatalf("#%d %s should be overridable", i, td.key)
+		}
+		if err := validator(td.value); (err == nil) != td.expect {
+			t.Errorf("#%d %s = %s expect valid %v but got %v", i, td.key, td.value, td.expect, err)
+		}
+	}
+	if _, ok := tenantSettingValidator("db.mysql.password"); ok {
+		t.Errorf("db.mysql.password should not be overridable")
+	}
+}
+
+func TestTenantSettingsResolution(t *testing.T) {
+	defer func() { TenantRepo, UserTenantRepo = nil, nil }()
+	acme := &connector.Tenant{RecID: "acme", Domain: "acme.com"}
+	TenantRepo = &memoryTenantSettings{tenant: acme, settings: map[string]string{
+		"security.passphrase.minchars": "12",
+		"security.lockout.failcount":   "1000",
+	}}
+	UserTenantRepo = &memoryMembership{tenants: map[string][]*connector.Tenant{"john": {acme}}}
+
+	settings := userSettings(context.Background(), &connector.User{RecID: "john"})
+	if settings.GetInt("security.passphrase.minchars") != 12 {
+		t.Errorf("expect the stricter tenant passphrase rule but got %d", settings.GetInt("security.passphrase.minchars"))
+	}
+	if settings.GetInt("security.lockout.failcount") != config.GetInt("security.lockout.failcount") {
+		t.Errorf("a looser lockout should fall back to the configuration but got %d", settings.GetInt("security.lockout.failcount"))
+	}
+	if settings.Get("token.access.duration") != config.Get("token.access.duration") {
+		t.Errorf("settings not overridden should resolve from the configuration")
+	}
+	if len(userSettings(context.Background(), &connector.User{RecID: "jane"})) != 0 {
+		t.Errorf("a user of no tenant should get the configuration")
+	}
+}
+
+// memoryTenantsSettings keeps the settings of several tenants in memory, by tenant record id
+type memoryTenantsSettings struct {
+	connector.TenantRepository
+	settings map[string]map[string]string
+}
+
+func (m *memoryTenantsSettings) GetTenantSettings(ctx context.Context, tenant *connector.Tenant) (map[string]string, error) {
+	ret := make(map[string]string)
+	for k, v := range m.settings[tenant.RecID] {
+		ret[k] = v
+	}
+	return ret, nil
+}
+
+func TestUserSettingsOfTenants(t *testing.T) {
+	defer func() { TenantRepo, UserTenantRepo = nil, nil }()
+	acme := &connector.Tenant{RecID: "acme", Name: "Acme", Domain: "acme.com"}
+	bolt := &connector.Tenant{RecID: "bolt", Name: "Bolt", Domain: "bolt.com"}
+	TenantRepo = &memoryTenantsSettings{settings: map[string]map[string]string{
+		"acme": {
+			"security.passphrase.minchars": "12",
+			"security.lockout.failcount":   "1",
+			"mailer.from.name":             "Acme",
+		},
+		"bolt": {
+			"security.passphrase.minchars":   "16",
+			"security.lockout.failcount":     "2",
+			"security.2fa.email.resend":      "5 minutes",
+			"mailer.from.name":               "Bolt",
+			"mailer.templates.emailotp.body": "Bolt code {{.Code}}",
+		},
+	}}
+	UserTenantRepo = &memoryMembership{tenants: map[string][]*connector.Tenant{"john": {acme, bolt}}}
+
+	settings := userSettings(context.Background(), &connector.User{RecID: "john"})
+	if settings.GetInt("security.passphrase.minchars") != 16 || settings.GetInt("security.lockout.failcount") != 1 {
+		t.Errorf("expect the strictest rules of the tenants but got %v", settings)
+	}
+	if settings.Get("security.2fa.email.resend") != "5 minutes" {
+		t.Errorf("expect the longest resend delay but got %s", settings.Get("security.2fa.email.resend"))
+	}
+	if settings.Get("mailer.from.name") != "Acme" || settings.Get("mailer.templates.emailotp.body") != config.Get("mailer.templates.emailotp.body") {
+		t.Errorf("expect the mail settings of the first tenant only but got %v", settings)
+	}
+}
+
+func TestSetTenantSettings(t *testing.T) {
+	defer func() { TenantRepo = nil }()
+	acme := &connector.Tenant{RecID: "acme", Domain: "acme.com"}
+	repo := &memoryTenantSettings{tenant: acme, settings: map[string]string{"mailer.from": "noreply@acme.com"}}
+	TenantRepo = repo
+	authCtx := &hansipcontext.AuthenticationContext{Subject: "admin@acme.com", Audience: []string{"admin@acme.com"}}
+	put := func(body string) int {
+		r := httptest.NewRequest(http.MethodPut, fmt.Sprintf("%s/management/tenant/acme/settings", apiPrefix), strings.NewReader(body))
+		r = r.WithContext(context.WithValue(r.Context(), constants.HansipAuthentication, authCtx))
+		recorder := httptest.NewRecorder()
+		SetTenantSettings(recorder, r)
+		return recorder.Code
+	}
+	if code := put(`{"security.passphrase.minchars":"0"}`); code != http.StatusBadRequest || repo.settings["mailer.from"] != "noreply@acme.com" {
+		t.Errorf("a looser passphrase rule should be rejected leaving the settings, got %d %v", code, repo.settings)
+	}
+	if code := put(`{"db.type":"INMEMORY"}`); code != http.StatusBadRequest {
+		t.Errorf("a setting not overridable should be rejected, got %d", code)
+	}
+	if code := put(`{"security.passphrase.minchars":"16"}`); code != http.StatusOK || len(repo.settings) != 1 || repo.settings["security.passphrase.minchars"] != "16" {
+		t.Errorf("expect the settings replaced, got %d %v", code, repo.settings)
+	}
+}
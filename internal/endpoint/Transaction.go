@@ -0,0 +1,97 @@
+package endpoint
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+
+	"github.com/hyperjumptech/hansip/internal/constants"
+	"github.com/hyperjumptech/hansip/internal/outbox"
+	"github.com/hyperjumptech/hansip/pkg/helper"
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	transactionLog = log.WithField("go", "Transaction")
+)
+
+// inTransaction calls fn in a database transaction, committed if fn returns nil.
+// The repository calls, events and emails of fn are stored together or not at all.
+// Within the transaction of a transactional handler, only the changes of fn are rolled back if it fails.
+func inTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	if TxRepo == nil {
+		return fn(ctx)
+	}
+	return TxRepo.Transaction(ctx, fn)
+}
+
+// bufferedResponse holds the response of a transactional handler until the transaction is done
+type bufferedResponse struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (b *bufferedResponse) Header() http.Header {
+	return b.header
+}
+
+func (b *bufferedResponse) Write(p []byte) (int, error) {
+	if b.status == 0 {
+		b.status = http.StatusOK
+	}
+	return b.body.Write(p)
+}
+
+func (b *bufferedResponse) WriteHeader(status int) {
+	if b.status == 0 {
+		b.status = status
+	}
+}
+
+// errHandlerFailed rolls back the transaction of a handler responding an error status
+type errHandlerFailed struct {
+	status int
+}
+
+func (e *errHandlerFailed) Error() string {
+	return http.StatusText(e.status)
+}
+
+// transactional runs the handler in a database transaction, so the changes it makes and the emails and events
+// they cause are stored together. The transaction is committed if the handler responds a status below 400
+// and rolled back otherwise. The response is held until then, so a failed commit responds an error instead.
+func transactional(handler func(http.ResponseWriter, *http.Request)) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodOptions || TxRepo == nil {
+			handler(w, r)
+			return
+		}
+		response := &bufferedResponse{header: make(http.Header)}
+		err := TxRepo.Transaction(r.Context(), func(ctx context.Context) error {
+			handler(response, r.WithContext(ctx))
+			if response.status >= http.StatusBadRequest {
+				return &errHandlerFailed{status: response.status}
+			}
+			return nil
+		})
+		if _, failed := err.(*errHandlerFailed); err != nil && !failed {
+			transactionLog.WithField("func", "transactional").WithField("RequestID", r.Context().Value(constants.RequestID)).WithField("path", r.URL.Path).WithField("method", r.Method).Errorf("TxRepo.Transaction got %s", err.Error())
+			helper.WriteHTTPResponse(r.Context(), w, http.StatusInternalServerError, err.Error(), nil, nil)
+			return
+		}
+		if err == nil {
+			// messages queued in the transaction were not visible to the workers until now
+			outbox.Nudge()
+			nudgeWebhookDispatcher()
+		}
+		for key, values := range response.header {
+			w.Header()[key] = values
+		}
+		if response.status == 0 {
+			response.status = http.StatusOK
+		}
+		w.WriteHeader(response.status)
+		w.Write(response.body.Bytes())
+	}
+}
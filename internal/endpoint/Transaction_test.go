@@ -0,0 +1,70 @@
+package endpoint
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/hyperjumptech/hansip/internal/constants"
+	"github.com/hyperjumptech/hansip/pkg/helper"
+)
+
+// recordingTransactor records the outcome of the transactions it runs
+type recordingTransactor struct {
+	committed  int
+	rolledBack int
+	commitErr  error
+}
+
+func (tx *recordingTransactor) Transaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	err := fn(context.WithValue(ctx, constants.Transaction, tx))
+	if err != nil {
+		tx.rolledBack++
+		return err
+	}
+	if tx.commitErr != nil {
+		tx.rolledBack++
+		return tx.commitErr
+	}
+	tx.committed++
+	return nil
+}
+
+func TestTransactional(t *testing.T) {
+	defer func() { TxRepo = nil }()
+	handler := transactional(func(w http.ResponseWriter, r *http.Request) {
+		if r.Context().Value(constants.Transaction) == nil {
+			t.Errorf("expect the handler to run in the transaction")
+		}
+		status := http.StatusOK
+		if r.URL.Query().Get("fail") == "true" {
+			status = http.StatusBadRequest
+		}
+		helper.WriteHTTPResponse(r.Context(), w, status, "done", map[string]string{"ETag": `"a-1"`}, nil)
+	})
+
+	tx := &recordingTransactor{}
+	TxRepo = tx
+	recorder := httptest.NewRecorder()
+	handler(recorder, httptest.NewRequest(http.MethodPost, "/", nil))
+	if recorder.Code != http.StatusOK || tx.committed != 1 || recorder.Header().Get("ETag") != `"a-1"` {
+		t.Errorf("expect committed with the handler response, got %d %d %v", recorder.Code, tx.committed, recorder.Header())
+	}
+
+	recorder = httptest.NewRecorder()
+	handler(recorder, httptest.NewRequest(http.MethodPost, "/?fail=true", nil))
+	if recorder.Code != http.StatusBadRequest || tx.rolledBack != 1 {
+		t.Errorf("expect rolled back with the handler response, got %d %d", recorder.Code, tx.rolledBack)
+	}
+
+	tx = &recordingTransactor{commitErr: fmt.Errorf("deadlock")}
+	TxRepo = tx
+	recorder = httptest.NewRecorder()
+	recorder.Header().Set("Access-Control-Allow-Origin", "*")
+	handler(recorder, httptest.NewRequest(http.MethodPost, "/", nil))
+	if recorder.Code != http.StatusInternalServerError || recorder.Header().Get("ETag") != "" || recorder.Header().Get("Access-Control-Allow-Origin") != "*" {
+		t.Errorf("expect a failed commit to respond an error only, got %d %v", recorder.Code, recorder.Header())
+	}
+}
@@ -0,0 +1,559 @@
+package endpoint
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/hyperjumptech/hansip/internal/config"
+	"github.com/hyperjumptech/hansip/internal/connector"
+	"github.com/hyperjumptech/hansip/internal/constants"
+	"github.com/hyperjumptech/hansip/internal/events"
+	"github.com/hyperjumptech/hansip/internal/hansipcontext"
+	"github.com/hyperjumptech/hansip/pkg/helper"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// UserImportFormatCSV comma separated import/export format
+	UserImportFormatCSV = "csv"
+
+	// UserImportFormatJSON json array import/export format
+	UserImportFormatJSON = "json"
+
+	// userImportListSeparator separates multiple group or role names within a CSV cell
+	userImportListSeparator = ";"
+)
+
+var (
+	userImportLog = log.WithField("go", "UserImportExport")
+
+	// UserImportCSVHeader is the header of user import and export CSV
+	UserImportCSVHeader = []string{"email", "enabled", "groups", "roles"}
+)
+
+// UserImportRecord hold one user to import. Groups and roles are names in form of "name" or "name@domain".
+// Names without domain are resolved within the import tenant domain.
+type UserImportRecord struct {
+	Email   string   `json:"email"`
+	Enabled bool     `json:"enabled"`
+	Groups  []string `json:"groups"`
+	Roles   []string `json:"roles"`
+}
+
+// UserExportRecord hold one exported user
+type UserExportRecord struct {
+	RecID     string   `json:"rec_id"`
+	Email     string   `json:"email"`
+	Enabled   bool     `json:"enabled"`
+	Suspended bool     `json:"suspended"`
+	Groups    []string `json:"groups"`
+	Roles     []string `json:"roles"`
+}
+
+// UserImportRowResult hold the import result of a single row
+type UserImportRowResult struct {
+	Row    int      `json:"row"`
+	Email  string   `json:"email"`
+	RecID  string   `json:"rec_id,omitempty"`
+	Errors []string `json:"errors,omitempty"`
+}
+
+// UserImportReport hold the result of a user import
+type UserImportReport struct {
+	DryRun   bool                   `json:"dry_run"`
+	Total    int                    `json:"total"`
+	Imported int                    `json:"imported"`
+	Failed   int                    `json:"failed"`
+	Rows     []*UserImportRowResult `json:"rows"`
+}
+
+// ParseUserImport parses user import records from the reader in the specified format.
+func ParseUserImport(reader io.Reader, format string) ([]*UserImportRecord, error) {
+	switch strings.ToLower(format) {
+	case UserImportFormatCSV:
+		return ParseUserImportCSV(reader)
+	case UserImportFormatJSON:
+		return ParseUserImportJSON(reader)
+	}
+	return nil, fmt.Errorf("unsupported import format %s", format)
+}
+
+// ParseUserImportJSON parses user import records from a json array
+func ParseUserImportJSON(reader io.Reader) ([]*UserImportRecord, error) {
+	records := make([]*UserImportRecord, 0)
+	err := json.NewDecoder(reader).Decode(&records)
+	if err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+// ParseUserImportCSV parses user import records from CSV. The first line must be the header,
+// containing at least "email" column. Optional columns are "enabled", "groups" and "roles".
+// Multiple groups or roles within a cell are separated by semicolon.
+func ParseUserImportCSV(reader io.Reader) ([]*UserImportRecord, error) {
+	csvReader := csv.NewReader(reader)
+	csvReader.TrimLeadingSpace = true
+	header, err := csvReader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("can not read CSV header. got %s", err.Error())
+	}
+	columns := make(map[string]int)
+	for i, h := range header {
+		columns[strings.ToLower(strings.TrimSpace(h))] = i
+	}
+	if _, ok := columns["email"]; !ok {
+		return nil, fmt.Errorf("CSV header must contain email column")
+	}
+	cell := func(row []string, name string) string {
+		if idx, ok := columns[name]; ok && idx < len(row) {
+			return strings.TrimSpace(row[idx])
+		}
+		return ""
+	}
+	records := make([]*UserImportRecord, 0)
+	for {
+		row, err := csvReader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		rec := &UserImportRecord{
+			Email:  cell(row, "email"),
+			Groups: splitImportList(cell(row, "groups")),
+			Roles:  splitImportList(cell(row, "roles")),
+		}
+		if enabled := cell(row, "enabled"); len(enabled) > 0 {
+			rec.Enabled, err = strconv.ParseBool(enabled)
+			if err != nil {
+				return nil, fmt.Errorf("line %d, invalid enabled value %s", len(records)+2, enabled)
+			}
+		}
+		records = append(records, rec)
+	}
+	return records, nil
+}
+
+func splitImportList(cell string) []string {
+	ret := make([]string, 0)
+	for _, s := range strings.Split(cell, userImportListSeparator) {
+		if s = strings.TrimSpace(s); len(s) > 0 {
+			ret = append(ret, s)
+		}
+	}
+	return ret
+}
+
+// splitImportName splits "name@domain" into its name and domain. if domain is not specified, defaultDomain is used.
+func splitImportName(name, defaultDomain string) (string, string) {
+	if idx := strings.LastIndex(name, "@"); idx > 0 {
+		return name[:idx], name[idx+1:]
+	}
+	return name, defaultDomain
+}
+
+// ImportUsers validates and creates the users in the records as members of the tenant.
+// canJoin and canAssign check whether the importer may add the users to a group and give them a role.
+// If dryRun is true, nothing is created and only the validation report is returned.
+// Every row is created in its own transaction, and an activation email is sent for every user created.
+func ImportUsers(ctx context.Context, tenant *connector.Tenant, records []*UserImportRecord, dryRun bool, canJoin func(group *connector.Group) bool, canAssign func(role *connector.Role) bool) *UserImportReport {
+	fLog := userImportLog.WithField("func", "ImportUsers").WithField("RequestID", ctx.Value(constants.RequestID))
+	settings := tenantSettings(ctx, tenant)
+	report := &UserImportReport{
+		DryRun: dryRun,
+		Total:  len(records),
+		Rows:   make([]*UserImportRowResult, 0, len(records)),
+	}
+	seen := make(map[string]bool)
+	for i, rec := range records {
+		result := &UserImportRowResult{
+			Row:    i + 1,
+			Email:  rec.Email,
+			Errors: make([]string, 0),
+		}
+		report.Rows = append(report.Rows, result)
+
+		email := strings.TrimSpace(rec.Email)
+		if len(email) == 0 || !strings.Contains(email, "@") {
+			result.Errors = append(result.Errors, "invalid email")
+		} else if seen[strings.ToLower(email)] {
+			result.Errors = append(result.Errors, "duplicate email within the import")
+		} else if _, err := UserRepo.GetUserByEmail(ctx, email); err == nil {
+			result.Errors = append(result.Errors, "user already exist")
+		}
+		seen[strings.ToLower(email)] = true
+
+		groups := make([]*connector.Group, 0, len(rec.Groups))
+		for _, g := range rec.Groups {
+			name, domain := splitImportName(g, tenant.Domain)
+			group, err := GroupRepo.GetGroupByName(ctx, name, domain)
+			if err != nil {
+				result.Errors = append(result.Errors, fmt.Sprintf("group %s@%s not found", name, domain))
+				continue
+			}
+			if !canJoin(group) {
+				result.Errors = append(result.Errors, fmt.Sprintf("no right to add users to group %s@%s", name, domain))
+				continue
+			}
+			groups = append(groups, group)
+		}
+		roles := make([]*connector.Role, 0, len(rec.Roles))
+		for _, ro := range rec.Roles {
+			name, domain := splitImportName(ro, tenant.Domain)
+			role, err := RoleRepo.GetRoleByName(ctx, name, domain)
+			if err != nil {
+				result.Errors = append(result.Errors, fmt.Sprintf("role %s@%s not found", name, domain))
+				continue
+			}
+			if !canAssign(role) {
+				result.Errors = append(result.Errors, fmt.Sprintf("no right to assign role %s@%s", name, domain))
+				continue
+			}
+			roles = append(roles, role)
+		}
+
+		if len(result.Errors) > 0 {
+			report.Failed++
+			continue
+		}
+		if dryRun {
+			report.Imported++
+			continue
+		}
+
+		// imported user sets its own passphrase upon activation, until then it is a secret no one knows.
+		// the user and its memberships are stored together, a row failing half way stores nothing.
+		var user *connector.User
+		err := inTransaction(ctx, func(ctx context.Context) error {
+			passphrase, err := helper.MakeSecretString(32)
+			if err != nil {
+				return err
+			}
+			user, err = UserRepo.CreateUserRecord(ctx, email, passphrase)
+			if err != nil {
+				fLog.Errorf("UserRepo.CreateUserRecord got %s", err.Error())
+				return err
+			}
+			if rec.Enabled {
+				user.Enabled = true
+				err = UserRepo.UpdateUser(ctx, user)
+				if err != nil {
+					fLog.Errorf("UserRepo.UpdateUser got %s", err.Error())
+					return err
+				}
+			}
+			_, err = UserTenantRepo.CreateUserTenant(ctx, user, tenant)
+			if err != nil {
+				fLog.Errorf("UserTenantRepo.CreateUserTenant got %s", err.Error())
+				return err
+			}
+			for _, group := range groups {
+				_, err = UserGroupRepo.CreateUserGroup(ctx, user, group)
+				if err != nil {
+					fLog.Errorf("UserGroupRepo.CreateUserGroup got %s", err.Error())
+					return fmt.Errorf("can not join group %s@%s. got %s", group.GroupName, group.GroupDomain, err.Error())
+				}
+			}
+			for _, role := range roles {
+				_, err = UserRoleRepo.CreateUserRole(ctx, user, role)
+				if err != nil {
+					fLog.Errorf("UserRoleRepo.CreateUserRole got %s", err.Error())
+					return fmt.Errorf("can not assign role %s@%s. got %s", role.RoleName, role.RoleDomain, err.Error())
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			result.Errors = append(result.Errors, err.Error())
+			report.Failed++
+			continue
+		}
+		result.RecID = user.RecID
+		report.Imported++
+		events.Publish(ctx, &events.UserCreated{User: user, Tenant: tenant, Source: events.SourceImport, Verify: true, Settings: settings})
+	}
+	return report
+}
+
+// UserExportWriter writes exported users into a stream
+type UserExportWriter interface {
+	Write(record *UserExportRecord) error
+	Close() error
+}
+
+// NewUserExportWriter creates UserExportWriter of the specified format
+func NewUserExportWriter(w io.Writer, format string) (UserExportWriter, error) {
+	switch strings.ToLower(format) {
+	case UserImportFormatCSV:
+		cw := csv.NewWriter(w)
+		err := cw.Write(append(UserImportCSVHeader, "rec_id", "suspended"))
+		if err != nil {
+			return nil, err
+		}
+		return &csvUserExportWriter{writer: cw}, nil
+	case UserImportFormatJSON:
+		return &jsonUserExportWriter{writer: w}, nil
+	}
+	return nil, fmt.Errorf("unsupported export format %s", format)
+}
+
+type csvUserExportWriter struct {
+	writer *csv.Writer
+}
+
+func (cw *csvUserExportWriter) Write(record *UserExportRecord) error {
+	err := cw.writer.Write([]string{
+		record.Email,
+		strconv.FormatBool(record.Enabled),
+		strings.Join(record.Groups, userImportListSeparator),
+		strings.Join(record.Roles, userImportListSeparator),
+		record.RecID,
+		strconv.FormatBool(record.Suspended),
+	})
+	if err != nil {
+		return err
+	}
+	cw.writer.Flush()
+	return cw.writer.Error()
+}
+
+func (cw *csvUserExportWriter) Close() error {
+	cw.writer.Flush()
+	return cw.writer.Error()
+}
+
+type jsonUserExportWriter struct {
+	writer  io.Writer
+	counter int
+}
+
+func (jw *jsonUserExportWriter) Write(record *UserExportRecord) error {
+	prefix := ","
+	if jw.counter == 0 {
+		prefix = "["
+	}
+	byt, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(jw.writer, "%s\n%s", prefix, string(byt))
+	if err != nil {
+		return err
+	}
+	jw.counter++
+	return nil
+}
+
+func (jw *jsonUserExportWriter) Close() error {
+	if jw.counter == 0 {
+		_, err := io.WriteString(jw.writer, "[]\n")
+		return err
+	}
+	_, err := io.WriteString(jw.writer, "\n]\n")
+	return err
+}
+
+// ExportUsers streams all users into the export writer, page by page, together with their group and role names.
+// If domains is nil all users, groups and roles are exported, otherwise only users that are member of the tenant domains
+// and their groups and roles of these domains.
+func ExportUsers(ctx context.Context, domains []string, writer UserExportWriter) (int, error) {
+	pageNo := uint(1)
+	counter := 0
+	for {
+		pageRequest := &helper.PageRequest{
+			No:       pageNo,
+			PageSize: 100,
+			OrderBy:  "EMAIL",
+			Sort:     "ASC",
+		}
+		var users []*connector.User
+		var page *helper.Page
+		var err error
+		if domains == nil {
+			users, page, err = UserRepo.ListUser(ctx, pageRequest)
+		} else {
+			users, page, err = UserTenantRepo.ListUserTenantByDomains(ctx, domains, pageRequest)
+		}
+		if err != nil {
+			return counter, err
+		}
+		for _, user := range users {
+			record, err := userExportRecord(ctx, user, domains)
+			if err != nil {
+				return counter, err
+			}
+			err = writer.Write(record)
+			if err != nil {
+				return counter, err
+			}
+			counter++
+		}
+		if page.IsLast || len(users) == 0 {
+			break
+		}
+		pageNo++
+	}
+	return counter, writer.Close()
+}
+
+// userExportRecord returns the export of the user, with the groups and roles of the domains, or all of them if domains is nil
+func userExportRecord(ctx context.Context, user *connector.User, domains []string) (*UserExportRecord, error) {
+	inDomains := func(domain string) bool {
+		if domains == nil {
+			return true
+		}
+		for _, d := range domains {
+			if d == domain {
+				return true
+			}
+		}
+		return false
+	}
+	record := &UserExportRecord{
+		RecID:     user.RecID,
+		Email:     user.Email,
+		Enabled:   user.Enabled,
+		Suspended: user.Suspended,
+		Groups:    make([]string, 0),
+		Roles:     make([]string, 0),
+	}
+	groups, _, err := UserGroupRepo.ListUserGroupByUser(ctx, user, &helper.PageRequest{
+		No:       1,
+		PageSize: 1000,
+		OrderBy:  "GROUP_NAME",
+		Sort:     "ASC",
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, g := range groups {
+		if !inDomains(g.GroupDomain) {
+			continue
+		}
+		record.Groups = append(record.Groups, fmt.Sprintf("%s@%s", g.GroupName, g.GroupDomain))
+	}
+	roles, _, err := UserRoleRepo.ListUserRoleByUser(ctx, user, &helper.PageRequest{
+		No:       1,
+		PageSize: 1000,
+		OrderBy:  "ROLE_NAME",
+		Sort:     "ASC",
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range roles {
+		if !inDomains(r.RoleDomain) {
+			continue
+		}
+		record.Roles = append(record.Roles, fmt.Sprintf("%s@%s", r.RoleName, r.RoleDomain))
+	}
+	return record, nil
+}
+
+// importExportFormat returns the format from the "format" query parameter, or from the content type.
+func importExportFormat(r *http.Request, contentType string) string {
+	if format := r.URL.Query().Get("format"); len(format) > 0 {
+		return strings.ToLower(format)
+	}
+	if strings.Contains(strings.ToLower(contentType), "csv") {
+		return UserImportFormatCSV
+	}
+	return UserImportFormatJSON
+}
+
+// ImportUsersHandler serving request to bulk import users from CSV or JSON.
+// Query parameter "dry_run=true" only validates the rows, "tenant_domain" specifies the tenant of the imported users.
+func ImportUsersHandler(w http.ResponseWriter, r *http.Request) {
+	fLog := userImportLog.WithField("func", "ImportUsersHandler").WithField("RequestID", r.Context().Value(constants.RequestID)).WithField("path", r.URL.Path).WithField("method", r.Method)
+	iauthctx := r.Context().Value(constants.HansipAuthentication)
+	if iauthctx == nil {
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusUnauthorized, "You are not authorized to access this resource", nil, nil)
+		return
+	}
+	authCtx := iauthctx.(*hansipcontext.AuthenticationContext)
+	tenantDomain := r.URL.Query().Get("tenant_domain")
+	if len(tenantDomain) == 0 {
+		tenantDomain = config.Get("hansip.domain")
+	}
+	if !authCtx.HasScopeOfDomain(tenantDomain, hansipcontext.ScopeUserManager) {
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusForbidden, "You don't have the right to create user in the specified tenant", nil, nil)
+		return
+	}
+	tenant, err := TenantRepo.GetTenantByDomain(r.Context(), tenantDomain)
+	if err != nil {
+		fLog.Errorf("TenantRepo.GetTenantByDomain got %s", err.Error())
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusNotFound, err.Error(), nil, nil)
+		return
+	}
+	dryRun, _ := strconv.ParseBool(r.URL.Query().Get("dry_run"))
+	records, err := ParseUserImport(r.Body, importExportFormat(r, r.Header.Get("Content-Type")))
+	if err != nil {
+		fLog.Errorf("ParseUserImport got %s", err.Error())
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusBadRequest, err.Error(), nil, nil)
+		return
+	}
+	canJoin := func(group *connector.Group) bool {
+		return canJoinGroup(r.Context(), authCtx, group)
+	}
+	canAssign := func(role *connector.Role) bool {
+		return canAssignRole(authCtx, role.RoleName, role.RoleDomain)
+	}
+	report := ImportUsers(r.Context(), tenant, records, dryRun, canJoin, canAssign)
+	if dryRun {
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusOK, fmt.Sprintf("Dry run, %d of %d users can be imported", report.Imported, report.Total), nil, report)
+		return
+	}
+	audit(r, &connector.AuditEvent{
+		Event:        "user.import",
+		TargetType:   AuditTargetTenant,
+		Target:       tenant.RecID,
+		TenantDomain: tenant.Domain,
+	}, nil, map[string]interface{}{"total": report.Total, "imported": report.Imported})
+	helper.WriteHTTPResponse(r.Context(), w, http.StatusOK, fmt.Sprintf("%d of %d users imported", report.Imported, report.Total), nil, report)
+}
+
+// ExportUsersHandler serving request to stream all users, with their roles and groups, as CSV or JSON.
+func ExportUsersHandler(w http.ResponseWriter, r *http.Request) {
+	fLog := userImportLog.WithField("func", "ExportUsersHandler").WithField("RequestID", r.Context().Value(constants.RequestID)).WithField("path", r.URL.Path).WithField("method", r.Method)
+	iauthctx := r.Context().Value(constants.HansipAuthentication)
+	if iauthctx == nil {
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusUnauthorized, "You are not authorized to access this resource", nil, nil)
+		return
+	}
+	authCtx := iauthctx.(*hansipcontext.AuthenticationContext)
+	var domains []string
+	if !authCtx.HasScopeOfDomain(config.Get("hansip.domain"), hansipcontext.ScopeUserManager, hansipcontext.ScopeAuditor) {
+		domains = authCtx.ScopedDomains(hansipcontext.ScopeUserManager, hansipcontext.ScopeAuditor)
+	}
+	format := importExportFormat(r, r.Header.Get("Accept"))
+	switch format {
+	case UserImportFormatCSV:
+		w.Header().Set("Content-Type", "text/csv")
+	case UserImportFormatJSON:
+		w.Header().Set("Content-Type", "application/json")
+	default:
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusBadRequest, fmt.Sprintf("unsupported export format %s", format), nil, nil)
+		return
+	}
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"users.%s\"", format))
+	writer, err := NewUserExportWriter(w, format)
+	if err != nil {
+		fLog.Errorf("NewUserExportWriter got %s", err.Error())
+		return
+	}
+	count, err := ExportUsers(r.Context(), domains, writer)
+	if err != nil {
+		// header is already sent, nothing else we can do but logging.
+		fLog.Errorf("ExportUsers got %s after %d users", err.Error(), count)
+		return
+	}
+	fLog.Tracef("%d users exported", count)
+}
@@ -0,0 +1,282 @@
+package endpoint
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/hyperjumptech/hansip/internal/connector"
+	"github.com/hyperjumptech/hansip/internal/events"
+	"github.com/hyperjumptech/hansip/pkg/helper"
+)
+
+// importedUsers keeps the users created by an import in memory, by email
+type importedUsers struct {
+	connector.UserRepository
+	users map[string]*connector.User
+}
+
+func (m *importedUsers) GetUserByEmail(ctx context.Context, email string) (*connector.User, error) {
+	if user, ok := m.users[email]; ok {
+		return user, nil
+	}
+	return nil, &connector.ErrDBNoResult{Message: "no user"}
+}
+
+func (m *importedUsers) CreateUserRecord(ctx context.Context, email, passphrase string) (*connector.User, error) {
+	user := &connector.User{RecID: fmt.Sprintf("user-%d", len(m.users)+1), Email: email, HashedPassphrase: passphrase}
+	m.users[email] = user
+	return user, nil
+}
+
+func (m *importedUsers) UpdateUser(ctx context.Context, user *connector.User) error {
+	return nil
+}
+
+// namedGroups finds every group by its name
+type namedGroups struct {
+	connector.GroupRepository
+}
+
+func (m *namedGroups) GetGroupByName(ctx context.Context, groupName, groupDomain string) (*connector.Group, error) {
+	return &connector.Group{RecID: groupName, GroupName: groupName, GroupDomain: groupDomain}, nil
+}
+
+// namedRoles finds every role by its name
+type namedRoles struct {
+	connector.RoleRepository
+}
+
+func (m *namedRoles) GetRoleByName(ctx context.Context, roleName, roleDomain string) (*connector.Role, error) {
+	return &connector.Role{RecID: roleName, RoleName: roleName, RoleDomain: roleDomain}, nil
+}
+
+// memoryUserGroups keeps the groups of the users in memory
+type memoryUserGroups struct {
+	connector.UserGroupRepository
+	groups map[string][]*connector.Group
+}
+
+func (m *memoryUserGroups) CreateUserGroup(ctx context.Context, user *connector.User, group *connector.Group) (*connector.UserGroup, error) {
+	m.groups[user.RecID] = append(m.groups[user.RecID], group)
+	return &connector.UserGroup{}, nil
+}
+
+func (m *memoryUserGroups) ListUserGroupByUser(ctx context.Context, user *connector.User, request *helper.PageRequest) ([]*connector.Group, *helper.Page, error) {
+	return m.groups[user.RecID], helper.NewPage(request, uint(len(m.groups[user.RecID]))), nil
+}
+
+// memoryUserRoles keeps the roles of the users in memory, the role named broken can not be assigned
+type memoryUserRoles struct {
+	connector.UserRoleRepository
+	roles map[string][]*connector.Role
+}
+
+func (m *memoryUserRoles) CreateUserRole(ctx context.Context, user *connector.User, role *connector.Role) (*connector.UserRole, error) {
+	if role.RoleName == "broken" {
+		return nil, fmt.Errorf("duplicate key")
+	}
+	m.roles[user.RecID] = append(m.roles[user.RecID], role)
+	return &connector.UserRole{}, nil
+}
+
+func (m *memoryUserRoles) ListUserRoleByUser(ctx context.Context, user *connector.User, request *helper.PageRequest) ([]*connector.Role, *helper.Page, error) {
+	return m.roles[user.RecID], helper.NewPage(request, uint(len(m.roles[user.RecID]))), nil
+}
+
+func TestParseUserImportCSV(t *testing.T) {
+	csvText := `email, enabled, groups, roles
+john@doe.com,true,staff;finance@acme,user
+jane@doe.com,,,
+`
+	records, err := ParseUserImport(strings.NewReader(csvText), UserImportFormatCSV)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("expect 2 records but %d", len(records))
+	}
+	if records[0].Email != "john@doe.com" || !records[0].Enabled {
+		t.Errorf("unexpected first record %v", records[0])
+	}
+	if len(records[0].Groups) != 2 || records[0].Groups[1] != "finance@acme" {
+		t.Errorf("unexpected groups %v", records[0].Groups)
+	}
+	if len(records[0].Roles) != 1 || records[0].Roles[0] != "user" {
+		t.Errorf("unexpected roles %v", records[0].Roles)
+	}
+	if records[1].Enabled || len(records[1].Groups) != 0 || len(records[1].Roles) != 0 {
+		t.Errorf("unexpected second record %v", records[1])
+	}
+
+	_, err = ParseUserImport(strings.NewReader("name,enabled\njohn,true\n"), UserImportFormatCSV)
+	if err == nil {
+		t.Errorf("expect error on missing email column")
+	}
+	_, err = ParseUserImport(strings.NewReader("email,enabled\njohn@doe.com,maybe\n"), UserImportFormatCSV)
+	if err == nil {
+		t.Errorf("expect error on invalid enabled value")
+	}
+}
+
+func TestParseUserImportJSON(t *testing.T) {
+	jsonText := `[{"email":"john@doe.com","enabled":true,"groups":["staff"],"roles":["user@acme"]}]`
+	records, err := ParseUserImport(strings.NewReader(jsonText), UserImportFormatJSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 || records[0].Email != "john@doe.com" || records[0].Roles[0] != "user@acme" {
+		t.Errorf("unexpected records %v", records)
+	}
+	_, err = ParseUserImport(strings.NewReader(jsonText), "xml")
+	if err == nil {
+		t.Errorf("expect error on unsupported format")
+	}
+}
+
+func TestSplitImportName(t *testing.T) {
+	testData := []struct {
+		name   string
+		domain string
+		expect []string
+	}{
+		{"user", "acme", []string{"user", "acme"}},
+		{"user@hansip", "acme", []string{"user", "hansip"}},
+		{"@user", "acme", []string{"@user", "acme"}},
+	}
+	for _, td := range testData {
+		name, domain := splitImportName(td.name, td.domain)
+		if name != td.expect[0] || domain != td.expect[1] {
+			t.Errorf("splitImportName(%s, %s) expect %v but %s, %s", td.name, td.domain, td.expect, name, domain)
+		}
+	}
+}
+
+func TestUserExportWriter(t *testing.T) {
+	records := []*UserExportRecord{
+		{RecID: "1", Email: "john@doe.com", Enabled: true, Groups: []string{"staff@acme"}, Roles: []string{"user@acme", "admin@acme"}},
+		{RecID: "2", Email: "jane@doe.com", Groups: []string{}, Roles: []string{}},
+	}
+
+	buff := &bytes.Buffer{}
+	writer, err := NewUserExportWriter(buff, UserImportFormatJSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, rec := range records {
+		if err := writer.Write(rec); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	exported := make([]*UserExportRecord, 0)
+	if err := json.Unmarshal(buff.Bytes(), &exported); err != nil {
+		t.Fatalf("exported json is not valid. got %s", buff.String())
+	}
+	if len(exported) != 2 || exported[0].Roles[1] != "admin@acme" {
+		t.Errorf("unexpected exported json %s", buff.String())
+	}
+
+	buff = &bytes.Buffer{}
+	writer, err = NewUserExportWriter(buff, UserImportFormatCSV)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, rec := range records {
+		if err := writer.Write(rec); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	// exported CSV must be importable back.
+	imported, err := ParseUserImportCSV(buff)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(imported) != 2 || !imported[0].Enabled || len(imported[0].Roles) != 2 || imported[1].Enabled {
+		t.Errorf("unexpected reimported csv %v", imported)
+	}
+
+	buff = &bytes.Buffer{}
+	writer, _ = NewUserExportWriter(buff, UserImportFormatJSON)
+	writer.Close()
+	if strings.TrimSpace(buff.String()) != "[]" {
+		t.Errorf("expect empty json array but %s", buff.String())
+	}
+}
+
+func TestImportUsers(t *testing.T) {
+	defer func(bus *events.Bus) {
+		events.Default = bus
+		UserRepo, UserTenantRepo, GroupRepo, RoleRepo, UserGroupRepo, UserRoleRepo = nil, nil, nil, nil, nil, nil
+	}(events.Default)
+	users := &importedUsers{users: make(map[string]*connector.User)}
+	UserRepo = users
+	UserTenantRepo = &memoryMembership{tenants: make(map[string][]*connector.Tenant)}
+	GroupRepo = &namedGroups{}
+	RoleRepo = &namedRoles{}
+	UserGroupRepo = &memoryUserGroups{groups: make(map[string][]*connector.Group)}
+	UserRoleRepo = &memoryUserRoles{roles: make(map[string][]*connector.Role)}
+	created := make([]string, 0)
+	events.Default = events.NewBus()
+	events.Subscribe(events.TypeUserCreated, func(ctx context.Context, event events.Event) {
+		created = append(created, event.(*events.UserCreated).User.Email)
+	})
+
+	acme := &connector.Tenant{RecID: "acme", Domain: "acme.com"}
+	allowed := func(group *connector.Group) bool { return group.GroupDomain == "acme.com" }
+	assignable := func(role *connector.Role) bool { return role.RoleDomain == "acme.com" }
+	report := ImportUsers(context.Background(), acme, []*UserImportRecord{
+		{Email: "john@acme.com", Groups: []string{"staff"}, Roles: []string{"reader"}},
+		{Email: "jane@acme.com", Roles: []string{"broken"}},
+		{Email: "joe@acme.com", Groups: []string{"admins@other.com"}},
+	}, false, allowed, assignable)
+
+	if report.Imported != 1 || report.Failed != 2 {
+		t.Fatalf("expect 1 imported and 2 failed but got %+v", report)
+	}
+	if report.Rows[0].RecID == "" || report.Rows[1].RecID != "" || len(report.Rows[1].Errors) != 1 {
+		t.Errorf("expect only the first row created but got %+v %+v", report.Rows[0], report.Rows[1])
+	}
+	if len(report.Rows[2].Errors) != 1 || !strings.Contains(report.Rows[2].Errors[0], "no right") {
+		t.Errorf("expect a group of another tenant refused but got %v", report.Rows[2].Errors)
+	}
+	if len(created) != 1 || created[0] != "john@acme.com" {
+		t.Errorf("expect the creation of the imported user only published but got %v", created)
+	}
+	if passphrase := users.users["john@acme.com"].HashedPassphrase; len(passphrase) != 32 {
+		t.Errorf("expect a 32 characters secret placeholder passphrase but got %s", passphrase)
+	}
+}
+
+func TestUserExportRecordDomains(t *testing.T) {
+	defer func() { UserGroupRepo, UserRoleRepo = nil, nil }()
+	john := &connector.User{RecID: "john", Email: "john@acme.com"}
+	UserGroupRepo = &memoryUserGroups{groups: map[string][]*connector.Group{"john": {
+		{GroupName: "staff", GroupDomain: "acme.com"},
+		{GroupName: "board", GroupDomain: "other.com"},
+	}}}
+	UserRoleRepo = &memoryUserRoles{roles: map[string][]*connector.Role{"john": {
+		{RoleName: "reader", RoleDomain: "acme.com"},
+		{RoleName: "admin", RoleDomain: "other.com"},
+	}}}
+
+	record, err := userExportRecord(context.Background(), john, []string{"acme.com"})
+	if err != nil {
+		t.Fatalf("got %s", err.Error())
+	}
+	if len(record.Groups) != 1 || record.Groups[0] != "staff@acme.com" || len(record.Roles) != 1 || record.Roles[0] != "reader@acme.com" {
+		t.Errorf("expect the groups and roles of acme.com only but got %v %v", record.Groups, record.Roles)
+	}
+	record, err = userExportRecord(context.Background(), john, nil)
+	if err != nil || len(record.Groups) != 2 || len(record.Roles) != 2 {
+		t.Errorf("expect every group and role exported for the admin but got %v %v", record, err)
+	}
+}
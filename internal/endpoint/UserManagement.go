@@ -1,6 +1,7 @@
 package endpoint
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
@@ -10,9 +11,9 @@ import (
 	"github.com/hyperjumptech/hansip/internal/config"
 	"github.com/hyperjumptech/hansip/internal/connector"
 	"github.com/hyperjumptech/hansip/internal/constants"
+	"github.com/hyperjumptech/hansip/internal/events"
 	"github.com/hyperjumptech/hansip/internal/hansipcontext"
 	"github.com/hyperjumptech/hansip/internal/mailer"
-	"github.com/hyperjumptech/hansip/internal/passphrase"
 	"github.com/hyperjumptech/hansip/pkg/helper"
 	"github.com/hyperjumptech/hansip/pkg/totp"
 	log "github.com/sirupsen/logrus"
@@ -56,20 +57,26 @@ func SetUserRoles(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	authCtx := iauthctx.(*hansipcontext.AuthenticationContext)
+	if !canAssignUserRoles(r.Context(), authCtx, user) {
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusForbidden, "You don't have the right to remove roles the user currently have", nil, nil)
+		return
+	}
 	rolesToAdd := make([]*connector.Role, 0)
 	for _, roleID := range roleIds {
 		role, err := RoleRepo.GetRoleByRecID(r.Context(), roleID)
 		if err != nil {
 			fLog.Warnf("RoleRepo.GetRoleByRecID got %s, this role %s will not be added to user %s role", err.Error(), roleID, user.RecID)
+			continue
 		}
-		authCtx := iauthctx.(*hansipcontext.AuthenticationContext)
-		if !authCtx.IsAdminOfDomain(role.RoleDomain) {
+		if !canAssignRole(authCtx, role.RoleName, role.RoleDomain) {
 			helper.WriteHTTPResponse(r.Context(), w, http.StatusForbidden, "You don't have the right to access role with the specified domain", nil, nil)
 			return
 		}
 		rolesToAdd = append(rolesToAdd, role)
 	}
 
+	before := auditUserRoles(r.Context(), user)
 	err = UserRoleRepo.DeleteUserRoleByUser(r.Context(), user)
 	if err != nil {
 		fLog.Errorf("UserRoleRepo.DeleteUserRoleByUser got %s", err.Error())
@@ -86,6 +93,8 @@ func SetUserRoles(w http.ResponseWriter, r *http.Request) {
 			counter++
 		}
 	}
+	auditUser(r, "user.roles.set", user, before, auditUserRoles(r.Context(), user))
+	events.Publish(r.Context(), &events.UserRolesChanged{User: user})
 	RevocationRepo.Revoke(r.Context(), user.Email)
 	helper.WriteHTTPResponse(r.Context(), w, http.StatusOK, fmt.Sprintf("%d roles added into user", counter), nil, nil)
 }
@@ -93,6 +102,11 @@ func SetUserRoles(w http.ResponseWriter, r *http.Request) {
 // DeleteUserRoles removes
 func DeleteUserRoles(w http.ResponseWriter, r *http.Request) {
 	fLog := userMgmtLogger.WithField("func", "DeleteUserRoles").WithField("RequestID", r.Context().Value(constants.RequestID)).WithField("path", r.URL.Path).WithField("method", r.Method)
+	iauthctx := r.Context().Value(constants.HansipAuthentication)
+	if iauthctx == nil {
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusUnauthorized, "You are not authorized to access this resource", nil, nil)
+		return
+	}
 	params, err := helper.ParsePathParams(fmt.Sprintf("%s/management/user/{userRecId}/roles", apiPrefix), r.URL.Path)
 	if err != nil {
 		panic(err)
@@ -102,12 +116,19 @@ func DeleteUserRoles(w http.ResponseWriter, r *http.Request) {
 		helper.WriteHTTPResponse(r.Context(), w, http.StatusNotFound, fmt.Sprintf("User recID %s not found", params["userRecId"]), nil, nil)
 		return
 	}
+	if !canAssignUserRoles(r.Context(), iauthctx.(*hansipcontext.AuthenticationContext), user) {
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusForbidden, "You don't have the right to remove roles the user currently have", nil, nil)
+		return
+	}
+	before := auditUserRoles(r.Context(), user)
 	err = UserRoleRepo.DeleteUserRoleByUser(r.Context(), user)
 	if err != nil {
 		fLog.Errorf("UserRoleRepo.DeleteUserRoleByUser got %s", err.Error())
 		helper.WriteHTTPResponse(r.Context(), w, http.StatusInternalServerError, err.Error(), nil, nil)
 		return
 	}
+	auditUser(r, "user.roles.delete", user, before, auditUserRoles(r.Context(), user))
+	events.Publish(r.Context(), &events.UserRolesChanged{User: user})
 	RevocationRepo.Revoke(r.Context(), user.Email)
 	helper.WriteHTTPResponse(r.Context(), w, http.StatusOK, "successfuly removed all roles from user", nil, nil)
 }
@@ -115,6 +136,11 @@ func DeleteUserRoles(w http.ResponseWriter, r *http.Request) {
 // SetUserGroups assigns groups to a single user
 func SetUserGroups(w http.ResponseWriter, r *http.Request) {
 	fLog := userMgmtLogger.WithField("func", "SetUserGroups").WithField("RequestID", r.Context().Value(constants.RequestID)).WithField("path", r.URL.Path).WithField("method", r.Method)
+	iauthctx := r.Context().Value(constants.HansipAuthentication)
+	if iauthctx == nil {
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusUnauthorized, "You are not authorized to access this resource", nil, nil)
+		return
+	}
 	params, err := helper.ParsePathParams(fmt.Sprintf("%s/management/user/{userRecId}/groups", apiPrefix), r.URL.Path)
 	if err != nil {
 		panic(err)
@@ -138,6 +164,26 @@ func SetUserGroups(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	authCtx := iauthctx.(*hansipcontext.AuthenticationContext)
+	if !canJoinUserGroups(r.Context(), authCtx, user) {
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusForbidden, "You don't have the right to remove the user from groups the user currently joins", nil, nil)
+		return
+	}
+	groupsToJoin := make([]*connector.Group, 0)
+	for _, groupID := range groupIds {
+		group, err := GroupRepo.GetGroupByRecID(r.Context(), groupID)
+		if err != nil {
+			fLog.Warnf("GroupRepo.GetGroupByRecID got %s, this group %s will not be joined by user %s", err.Error(), groupID, user.RecID)
+			continue
+		}
+		if !canJoinGroup(r.Context(), authCtx, group) {
+			helper.WriteHTTPResponse(r.Context(), w, http.StatusForbidden, "You don't have the right to access group with the specified domain", nil, nil)
+			return
+		}
+		groupsToJoin = append(groupsToJoin, group)
+	}
+
+	before := auditUserGroups(r.Context(), user)
 	err = UserGroupRepo.DeleteUserGroupByUser(r.Context(), user)
 	if err != nil {
 		fLog.Errorf("UserGroupRepo.DeleteUserGroupByUser got %s", err.Error())
@@ -146,20 +192,16 @@ func SetUserGroups(w http.ResponseWriter, r *http.Request) {
 	}
 
 	counter := 0
-	for _, groupID := range groupIds {
-		group, err := GroupRepo.GetGroupByRecID(r.Context(), groupID)
+	for _, group := range groupsToJoin {
+		_, err := UserGroupRepo.CreateUserGroup(r.Context(), user, group)
 		if err != nil {
-			fLog.Warnf("GroupRepo.GetGroupByRecID got %s, this group %s will not be joined by user %s", err.Error(), groupID, user.RecID)
+			fLog.Warnf("UserGroupRepo.CreateUserGroup got %s, this group %s will not be joined by user %s", err.Error(), group.RecID, user.RecID)
 		} else {
-			_, err := UserGroupRepo.CreateUserGroup(r.Context(), user, group)
-			if err != nil {
-				fLog.Warnf("UserGroupRepo.CreateUserGroup got %s, this group %s will not be joined by user %s", err.Error(), groupID, user.RecID)
-			} else {
-				counter++
-			}
+			counter++
 		}
 	}
 
+	auditUser(r, "user.groups.set", user, before, auditUserGroups(r.Context(), user))
 	RevocationRepo.Revoke(r.Context(), user.Email)
 
 	helper.WriteHTTPResponse(r.Context(), w, http.StatusOK, fmt.Sprintf("%d groups joined by user", counter), nil, nil)
@@ -168,6 +210,11 @@ func SetUserGroups(w http.ResponseWriter, r *http.Request) {
 // DeleteUserGroups removes the user from groups
 func DeleteUserGroups(w http.ResponseWriter, r *http.Request) {
 	fLog := userMgmtLogger.WithField("func", "DeleteUserGroups").WithField("RequestID", r.Context().Value(constants.RequestID)).WithField("path", r.URL.Path).WithField("method", r.Method)
+	iauthctx := r.Context().Value(constants.HansipAuthentication)
+	if iauthctx == nil {
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusUnauthorized, "You are not authorized to access this resource", nil, nil)
+		return
+	}
 	params, err := helper.ParsePathParams(fmt.Sprintf("%s/management/user/{userRecId}/groups", apiPrefix), r.URL.Path)
 	if err != nil {
 		panic(err)
@@ -177,12 +224,18 @@ func DeleteUserGroups(w http.ResponseWriter, r *http.Request) {
 		helper.WriteHTTPResponse(r.Context(), w, http.StatusNotFound, fmt.Sprintf("User recID %s not found", params["userRecId"]), nil, nil)
 		return
 	}
+	if !canJoinUserGroups(r.Context(), iauthctx.(*hansipcontext.AuthenticationContext), user) {
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusForbidden, "You don't have the right to remove the user from groups the user currently joins", nil, nil)
+		return
+	}
+	before := auditUserGroups(r.Context(), user)
 	err = UserGroupRepo.DeleteUserGroupByUser(r.Context(), user)
 	if err != nil {
 		fLog.Errorf("UserGroupRepo.DeleteUserGroupByUser got %s", err.Error())
 		helper.WriteHTTPResponse(r.Context(), w, http.StatusInternalServerError, err.Error(), nil, nil)
 		return
 	}
+	auditUser(r, "user.groups.delete", user, before, auditUserGroups(r.Context(), user))
 	RevocationRepo.Revoke(r.Context(), user.Email)
 	helper.WriteHTTPResponse(r.Context(), w, http.StatusOK, "user successfuly leaves all groups", nil, nil)
 }
@@ -250,6 +303,8 @@ func ListAllUsers(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	authCtx := iauthctx.(*hansipcontext.AuthenticationContext)
+
 	fLog.Trace("Listing Users")
 	pageRequest, err := helper.NewPageRequestFromRequest(r)
 	if err != nil {
@@ -257,11 +312,22 @@ func ListAllUsers(w http.ResponseWriter, r *http.Request) {
 		helper.WriteHTTPResponse(r.Context(), w, http.StatusBadRequest, err.Error(), nil, nil)
 		return
 	}
-	users, page, err := UserRepo.ListUser(r.Context(), pageRequest)
-	if err != nil {
-		fLog.Errorf("UserRepo.ListUser got %s", err.Error())
-		helper.WriteHTTPResponse(r.Context(), w, http.StatusInternalServerError, err.Error(), nil, nil)
-		return
+	var users []*connector.User
+	var page *helper.Page
+	if authCtx.HasScopeOfDomain(config.Get("hansip.domain"), readScopes...) {
+		users, page, err = UserRepo.ListUser(r.Context(), pageRequest)
+		if err != nil {
+			fLog.Errorf("UserRepo.ListUser got %s", err.Error())
+			helper.WriteHTTPResponse(r.Context(), w, listErrorStatus(err), err.Error(), nil, nil)
+			return
+		}
+	} else {
+		users, page, err = UserTenantRepo.ListUserTenantByDomains(r.Context(), authCtx.ScopedDomains(readScopes...), pageRequest)
+		if err != nil {
+			fLog.Errorf("UserTenantRepo.ListUserTenantByDomains got %s", err.Error())
+			helper.WriteHTTPResponse(r.Context(), w, listErrorStatus(err), err.Error(), nil, nil)
+			return
+		}
 	}
 	susers := make([]*SimpleUser, len(users))
 	for i, v := range users {
@@ -280,8 +346,10 @@ func ListAllUsers(w http.ResponseWriter, r *http.Request) {
 
 // CreateNewUserRequest hold the data model for requesting to create new user.
 type CreateNewUserRequest struct {
-	Email      string `json:"email"`
-	Passphrase string `json:"passphrase"`
+	Email        string `json:"email"`
+	Passphrase   string `json:"passphrase"`
+	TenantDomain string `json:"tenant_domain"`
+	Locale       string `json:"locale"`
 }
 
 // CreateNewUserResponse hold the data model for responding CreateNewUser request
@@ -293,6 +361,7 @@ type CreateNewUserResponse struct {
 	LastSeen    time.Time `json:"last_seen"`
 	LastLogin   time.Time `json:"last_login"`
 	TotpEnabled bool      `json:"enabled_2fa"`
+	Locale      string    `json:"locale"`
 }
 
 // CreateNewUser handles request to create new user
@@ -319,11 +388,29 @@ func CreateNewUser(w http.ResponseWriter, r *http.Request) {
 		helper.WriteHTTPResponse(r.Context(), w, http.StatusBadRequest, err.Error(), nil, nil)
 		return
 	}
-	isValidPassphrase := passphrase.Validate(req.Passphrase, config.GetInt("security.passphrase.minchars"), config.GetInt("security.passphrase.minwords"), config.GetInt("security.passphrase.mincharsinword"))
+	if len(req.TenantDomain) == 0 {
+		req.TenantDomain = config.Get("hansip.domain")
+	}
+	authCtx := iauthctx.(*hansipcontext.AuthenticationContext)
+	if !authCtx.HasScopeOfDomain(req.TenantDomain, hansipcontext.ScopeUserManager) {
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusForbidden, "You don't have the right to create user in the specified tenant", nil, nil)
+		return
+	}
+	tenant, err := TenantRepo.GetTenantByDomain(r.Context(), req.TenantDomain)
+	if err != nil {
+		fLog.Errorf("TenantRepo.GetTenantByDomain got %s", err.Error())
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusNotFound, err.Error(), nil, nil)
+		return
+	}
+	settings := tenantSettings(r.Context(), tenant)
+	isValidPassphrase, invalidMsg := validatePassphrase(settings, req.Passphrase)
 	if !isValidPassphrase {
 		fLog.Errorf("Passphrase invalid")
-		invalidMsg := fmt.Sprintf("Invalid passphrase. Passphrase must at least has %d characters and %d words and for each word have minimum %d characters", config.GetInt("security.passphrase.minchars"), config.GetInt("security.passphrase.minwords"), config.GetInt("security.passphrase.mincharsinword"))
-		helper.WriteHTTPResponse(r.Context(), w, http.StatusBadRequest, "invalid passphrase", nil, invalidMsg)
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusBadRequest, "invalid passphrase", nil, fmt.Sprintf("Invalid passphrase. %s", invalidMsg))
+		return
+	}
+	if err := validateLocale(req.Locale); err != nil {
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusBadRequest, err.Error(), nil, nil)
 		return
 	}
 	user, err := UserRepo.CreateUserRecord(r.Context(), req.Email, req.Passphrase)
@@ -332,6 +419,29 @@ func CreateNewUser(w http.ResponseWriter, r *http.Request) {
 		helper.WriteHTTPResponse(r.Context(), w, http.StatusBadRequest, err.Error(), nil, nil)
 		return
 	}
+	if locale, ok := mailer.NormalizeLocale(req.Locale); ok {
+		user.Locale = locale
+		err = UserRepo.UpdateUser(r.Context(), user)
+		if err != nil {
+			fLog.Errorf("UserRepo.UpdateUser got %s", err.Error())
+			helper.WriteHTTPResponse(r.Context(), w, http.StatusInternalServerError, err.Error(), nil, nil)
+			return
+		}
+	}
+	_, err = UserTenantRepo.CreateUserTenant(r.Context(), user, tenant)
+	if err != nil {
+		fLog.Errorf("UserTenantRepo.CreateUserTenant got %s", err.Error())
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusInternalServerError, err.Error(), nil, nil)
+		return
+	}
+	user.TenantRecId = tenant.RecID
+	audit(r, &connector.AuditEvent{
+		Event:        "user.create",
+		TargetType:   AuditTargetUser,
+		Target:       user.RecID,
+		TenantDomain: tenant.Domain,
+	}, nil, user)
+	events.Publish(r.Context(), &events.UserCreated{User: user, Tenant: tenant, Source: events.SourceManagement, Verify: true, Settings: settings})
 	resp := &CreateNewUserResponse{
 		RecordID:    user.RecID,
 		Email:       user.Email,
@@ -340,18 +450,8 @@ func CreateNewUser(w http.ResponseWriter, r *http.Request) {
 		LastSeen:    user.LastSeen,
 		LastLogin:   user.LastLogin,
 		TotpEnabled: user.Enable2FactorAuth,
+		Locale:      user.Locale,
 	}
-	fLog.Warnf("Sending email")
-	mailer.Send(r.Context(), &mailer.Email{
-		From:     config.Get("mailer.from"),
-		FromName: config.Get("mailer.from.name"),
-		To:       []string{user.Email},
-		Cc:       nil,
-		Bcc:      nil,
-		Template: "EMAIL_VERIFY",
-		Data:     user,
-	})
-
 	helper.WriteHTTPResponse(r.Context(), w, http.StatusOK, "Success creating user", nil, resp)
 	return
 }
@@ -383,23 +483,29 @@ func ChangePassphrase(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	isValidPassphrase := passphrase.Validate(c.NewPassphrase, config.GetInt("security.passphrase.minchars"), config.GetInt("security.passphrase.minwords"), config.GetInt("security.passphrase.mincharsinword"))
-	if !isValidPassphrase {
-		fLog.Errorf("new passphrase invalid")
-		invalidMsg := fmt.Sprintf("Invalid new passphrase. Passphrase must at least has %d characters and %d words and for each word have minimum %d characters", config.GetInt("security.passphrase.minchars"), config.GetInt("security.passphrase.minwords"), config.GetInt("security.passphrase.mincharsinword"))
-		helper.WriteHTTPResponse(r.Context(), w, http.StatusBadRequest, "invalid new passphrase", nil, invalidMsg)
-		return
-	}
-
 	user, err := UserRepo.GetUserByRecID(r.Context(), params["userRecId"])
 	if err != nil {
 		fLog.Errorf("UserRepo.GetUserByRecID got %s", err.Error())
 		helper.WriteHTTPResponse(r.Context(), w, http.StatusNotFound, err.Error(), nil, nil)
 		return
 	}
+
+	isValidPassphrase, invalidMsg := validatePassphrase(userSettings(r.Context(), user), c.NewPassphrase)
+	if !isValidPassphrase {
+		fLog.Errorf("new passphrase invalid")
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusBadRequest, "invalid new passphrase", nil, fmt.Sprintf("Invalid new passphrase. %s", invalidMsg))
+		return
+	}
 	err = bcrypt.CompareHashAndPassword([]byte(user.HashedPassphrase), []byte(c.OldPassphrase))
 	if err != nil {
 		fLog.Errorf("bcrypt.CompareHashAndPassword got %s", err.Error())
+		audit(r, &connector.AuditEvent{
+			Event:        "user.passphrase.change",
+			Outcome:      AuditFailure,
+			TargetType:   AuditTargetUser,
+			Target:       user.RecID,
+			TenantDomain: userAuditDomain(r.Context(), user),
+		}, nil, nil)
 		helper.WriteHTTPResponse(r.Context(), w, http.StatusNotAcceptable, err.Error(), nil, nil)
 		return
 	}
@@ -409,6 +515,7 @@ func ChangePassphrase(w http.ResponseWriter, r *http.Request) {
 		helper.WriteHTTPResponse(r.Context(), w, http.StatusInternalServerError, err.Error(), nil, nil)
 		return
 	}
+	before := *user
 	user.HashedPassphrase = string(newHashed)
 	err = UserRepo.UpdateUser(r.Context(), user)
 	if err != nil {
@@ -416,6 +523,7 @@ func ChangePassphrase(w http.ResponseWriter, r *http.Request) {
 		helper.WriteHTTPResponse(r.Context(), w, http.StatusInternalServerError, err.Error(), nil, nil)
 		return
 	}
+	auditUser(r, "user.passphrase.change", user, &before, user)
 	helper.WriteHTTPResponse(r.Context(), w, http.StatusOK, "Password changed", nil, nil)
 }
 
@@ -507,13 +615,16 @@ func Activate2FA(w http.ResponseWriter, r *http.Request) {
 	resp := Activate2FAResponse{
 		Codes: codes,
 	}
+	before := *user
 	user.Enable2FactorAuth = true
+	user.Enable2FactorEmail = false
 	err = UserRepo.UpdateUser(r.Context(), user)
 	if err != nil {
 		fLog.Errorf("UserRepo.SaveOrUpdate got %s", err.Error())
 		helper.WriteHTTPResponse(r.Context(), w, http.StatusInternalServerError, err.Error(), nil, nil)
 		return
 	}
+	auditUser(r, "user.2fa.activate", user, &before, user)
 	helper.WriteHTTPResponse(r.Context(), w, http.StatusOK, "2FA Activated", nil, resp)
 }
 
@@ -614,21 +725,21 @@ func ActivateUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	isValidPassphrase := passphrase.Validate(c.NewPassphrase, config.GetInt("security.passphrase.minchars"), config.GetInt("security.passphrase.minwords"), config.GetInt("security.passphrase.mincharsinword"))
-	if !isValidPassphrase {
-		fLog.Errorf("New Passphrase invalid")
-		invalidMsg := fmt.Sprintf("Invalid passphrase. Passphrase must at least has %d characters and %d words and for each word have minimum %d characters", config.GetInt("security.passphrase.minchars"), config.GetInt("security.passphrase.minwords"), config.GetInt("security.passphrase.mincharsinword"))
-		helper.WriteHTTPResponse(r.Context(), w, http.StatusBadRequest, "invalid passphrase", nil, invalidMsg)
-		return
-	}
-
 	user, err := UserRepo.GetUserByEmail(r.Context(), c.Email)
 	if err != nil {
 		fLog.Errorf("UserRepo.GetUserByEmail got %s", err.Error())
 		helper.WriteHTTPResponse(r.Context(), w, http.StatusNotFound, err.Error(), nil, nil)
 		return
 	}
+
+	isValidPassphrase, invalidMsg := validatePassphrase(userSettings(r.Context(), user), c.NewPassphrase)
+	if !isValidPassphrase {
+		fLog.Errorf("New Passphrase invalid")
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusBadRequest, "invalid passphrase", nil, fmt.Sprintf("Invalid passphrase. %s", invalidMsg))
+		return
+	}
 	if user.ActivationCode == c.ActivationToken {
+		before := *user
 		user.Enabled = true
 		newHashed, err := bcrypt.GenerateFromPassword([]byte(c.NewPassphrase), 14)
 		if err != nil {
@@ -643,6 +754,14 @@ func ActivateUser(w http.ResponseWriter, r *http.Request) {
 			helper.WriteHTTPResponse(r.Context(), w, http.StatusInternalServerError, err.Error(), nil, nil)
 			return
 		}
+		audit(r, &connector.AuditEvent{
+			Event:        "user.activate",
+			Actor:        user.Email,
+			TargetType:   AuditTargetUser,
+			Target:       user.RecID,
+			TenantDomain: userAuditDomain(r.Context(), user),
+		}, &before, user)
+		publishUserStatusEvents(r.Context(), &before, user)
 		ret := make(map[string]interface{})
 		ret["rec_id"] = user.RecID
 		ret["email"] = user.Email
@@ -653,6 +772,7 @@ func ActivateUser(w http.ResponseWriter, r *http.Request) {
 		ret["enabled_2fa"] = user.Enable2FactorAuth
 		helper.WriteHTTPResponse(r.Context(), w, http.StatusOK, "User activated", nil, ret)
 	} else {
+		auditAuthentication(r, "user.activate", AuditFailure, user.Email, user)
 		helper.WriteHTTPResponse(r.Context(), w, http.StatusNotFound, "Activation token and email not match", nil, nil)
 	}
 }
@@ -660,6 +780,13 @@ func ActivateUser(w http.ResponseWriter, r *http.Request) {
 // GetUserDetail serve fetch user detail
 func GetUserDetail(w http.ResponseWriter, r *http.Request) {
 	fLog := userMgmtLogger.WithField("func", "GetUserDetail").WithField("RequestID", r.Context().Value(constants.RequestID)).WithField("path", r.URL.Path).WithField("method", r.Method)
+
+	iauthctx := r.Context().Value(constants.HansipAuthentication)
+	if iauthctx == nil {
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusUnauthorized, "You are not authorized to access this resource", nil, nil)
+		return
+	}
+
 	params, err := helper.ParsePathParams(fmt.Sprintf("%s/management/user/{userRecId}", apiPrefix), r.URL.Path)
 	if err != nil {
 		panic(err)
@@ -670,6 +797,10 @@ func GetUserDetail(w http.ResponseWriter, r *http.Request) {
 		helper.WriteHTTPResponse(r.Context(), w, http.StatusNotFound, err.Error(), nil, nil)
 		return
 	}
+	if !canReadUser(r.Context(), iauthctx.(*hansipcontext.AuthenticationContext), user) {
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusForbidden, "You don't have the right to access user in the specified tenant", nil, nil)
+		return
+	}
 	ret := make(map[string]interface{})
 	ret["rec_id"] = user.RecID
 	ret["email"] = user.Email
@@ -678,7 +809,8 @@ func GetUserDetail(w http.ResponseWriter, r *http.Request) {
 	ret["last_seen"] = user.LastSeen
 	ret["last_login"] = user.LastLogin
 	ret["enabled_2fa"] = user.Enable2FactorAuth
-	helper.WriteHTTPResponse(r.Context(), w, http.StatusOK, "User retrieved", nil, ret)
+	ret["locale"] = user.Locale
+	helper.WriteHTTPResponse(r.Context(), w, http.StatusOK, "User retrieved", etagHeader(user.RecID, user.Version), ret)
 }
 
 // UpdateUserRequest hold request data for requesting to update user information.
@@ -687,11 +819,19 @@ type UpdateUserRequest struct {
 	Enabled   bool   `json:"enabled"`
 	Suspended bool   `json:"suspended"`
 	Enable2FA bool   `json:"enabled_2fa"`
+	Locale    string `json:"locale"`
 }
 
-// UpdateUserDetail rest endpoint to update user detail
+// UpdateUserDetail rest endpoint to update user detail, entirely with PUT or partially with PATCH merge patch
 func UpdateUserDetail(w http.ResponseWriter, r *http.Request) {
-	fLog := userMgmtLogger.WithField("func", "GetUserDetail").WithField("RequestID", r.Context().Value(constants.RequestID)).WithField("path", r.URL.Path).WithField("method", r.Method)
+	fLog := userMgmtLogger.WithField("func", "UpdateUserDetail").WithField("RequestID", r.Context().Value(constants.RequestID)).WithField("path", r.URL.Path).WithField("method", r.Method)
+
+	iauthctx := r.Context().Value(constants.HansipAuthentication)
+	if iauthctx == nil {
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusUnauthorized, "You are not authorized to access this resource", nil, nil)
+		return
+	}
+
 	params, err := helper.ParsePathParams(fmt.Sprintf("%s/management/user/{userRecId}", apiPrefix), r.URL.Path)
 	if err != nil {
 		panic(err)
@@ -702,20 +842,35 @@ func UpdateUserDetail(w http.ResponseWriter, r *http.Request) {
 		helper.WriteHTTPResponse(r.Context(), w, http.StatusNotFound, err.Error(), nil, nil)
 		return
 	}
+	if !canManageUser(r.Context(), iauthctx.(*hansipcontext.AuthenticationContext), user) {
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusForbidden, "You don't have the right to access user in the specified tenant", nil, nil)
+		return
+	}
+	if !checkIfMatch(w, r, user.RecID, user.Version) {
+		return
+	}
 	req := &UpdateUserRequest{}
-	body, err := ioutil.ReadAll(r.Body)
+	current := &UpdateUserRequest{
+		Email:     user.Email,
+		Enabled:   user.Enabled,
+		Suspended: user.Suspended,
+		Enable2FA: user.Enable2FactorAuth,
+		Locale:    user.Locale,
+	}
+	status, err := readUpdateRequest(r, req, current)
 	if err != nil {
-		fLog.Errorf("ioutil.ReadAll got %s", err.Error())
-		helper.WriteHTTPResponse(r.Context(), w, http.StatusInternalServerError, err.Error(), nil, nil)
+		fLog.Errorf("readUpdateRequest got %s", err.Error())
+		helper.WriteHTTPResponse(r.Context(), w, status, err.Error(), nil, nil)
 		return
 	}
-	err = json.Unmarshal(body, req)
-	if err != nil {
-		fLog.Errorf("json.Unmarshal got %s", err.Error())
+	if err := validateUpdateUserRequest(req); err != nil {
+		fLog.Errorf("validateUpdateUserRequest got %s", err.Error())
 		helper.WriteHTTPResponse(r.Context(), w, http.StatusBadRequest, err.Error(), nil, nil)
 		return
 	}
 
+	before := *user
+
 	// if email is changed and enabled = false, send email
 	sendemail := false
 	if user.Email != req.Email && req.Enabled == false {
@@ -727,30 +882,30 @@ func UpdateUserDetail(w http.ResponseWriter, r *http.Request) {
 		user.UserTotpSecretKey = totp.MakeSecret().Base32()
 	}
 
+	if !req.Enable2FA {
+		user.Enable2FactorEmail = false
+	}
+
 	user.Email = req.Email
 	user.Enable2FactorAuth = req.Enable2FA
 	user.Enabled = req.Enabled
 	user.Suspended = req.Suspended
+	user.Locale, _ = mailer.NormalizeLocale(req.Locale)
 
 	err = UserRepo.UpdateUser(r.Context(), user)
 	if err != nil {
 		fLog.Errorf("UserRepo.SaveOrUpdate got %s", err.Error())
-		helper.WriteHTTPResponse(r.Context(), w, http.StatusInternalServerError, err.Error(), nil, nil)
+		helper.WriteHTTPResponse(r.Context(), w, updateErrorStatus(err), err.Error(), nil, nil)
 		return
 	}
 
-	if sendemail {
-		fLog.Warnf("Sending email")
-		mailer.Send(r.Context(), &mailer.Email{
-			From:     config.Get("mailer.from"),
-			FromName: config.Get("mailer.from.name"),
-			To:       []string{user.Email},
-			Cc:       nil,
-			Bcc:      nil,
-			Template: "EMAIL_VERIFY",
-			Data:     user,
-		})
+	auditUser(r, "user.update", user, &before, user)
+	if before.Email != user.Email {
+		tenant := userTenant(r.Context(), user)
+		settings := userSettings(r.Context(), user)
+		events.Publish(r.Context(), &events.UserEmailChanged{User: user, Previous: before.Email, Verify: sendemail, Tenant: tenant, Settings: settings})
 	}
+	publishUserStatusEvents(r.Context(), &before, user)
 
 	ret := make(map[string]interface{})
 	ret["rec_id"] = user.RecID
@@ -760,13 +915,21 @@ func UpdateUserDetail(w http.ResponseWriter, r *http.Request) {
 	ret["last_seen"] = user.LastSeen
 	ret["last_login"] = user.LastLogin
 	ret["enabled_2fa"] = user.Enable2FactorAuth
-	helper.WriteHTTPResponse(r.Context(), w, http.StatusOK, "User updated", nil, ret)
+	ret["locale"] = user.Locale
+	helper.WriteHTTPResponse(r.Context(), w, http.StatusOK, "User updated", etagHeader(user.RecID, user.Version), ret)
 
 }
 
 // DeleteUser serve user deletion
 func DeleteUser(w http.ResponseWriter, r *http.Request) {
 	fLog := userMgmtLogger.WithField("func", "DeleteUser").WithField("RequestID", r.Context().Value(constants.RequestID)).WithField("path", r.URL.Path).WithField("method", r.Method)
+
+	iauthctx := r.Context().Value(constants.HansipAuthentication)
+	if iauthctx == nil {
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusUnauthorized, "You are not authorized to access this resource", nil, nil)
+		return
+	}
+
 	params, err := helper.ParsePathParams(fmt.Sprintf("%s/management/user/{userRecId}", apiPrefix), r.URL.Path)
 	if err != nil {
 		panic(err)
@@ -777,7 +940,27 @@ func DeleteUser(w http.ResponseWriter, r *http.Request) {
 		helper.WriteHTTPResponse(r.Context(), w, http.StatusNotFound, err.Error(), nil, nil)
 		return
 	}
+	if !canManageUser(r.Context(), iauthctx.(*hansipcontext.AuthenticationContext), user) {
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusForbidden, "You don't have the right to access user in the specified tenant", nil, nil)
+		return
+	}
+	if isUserOutOfScope(r.Context(), iauthctx.(*hansipcontext.AuthenticationContext), user, hansipcontext.ScopeUserManager) {
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusConflict, "User is member of other tenants, remove it from your tenant instead", nil, nil)
+		return
+	}
+	if !checkIfMatch(w, r, user.RecID, user.Version) {
+		return
+	}
+	tenantDomain := userAuditDomain(r.Context(), user)
+	tenants := deletedUserTenants(r.Context(), user)
 	UserRepo.DeleteUser(r.Context(), user)
+	audit(r, &connector.AuditEvent{
+		Event:        "user.delete",
+		TargetType:   AuditTargetUser,
+		Target:       user.RecID,
+		TenantDomain: tenantDomain,
+	}, user, nil)
+	events.Publish(r.Context(), &events.UserDeleted{User: user, Tenants: tenants})
 	RevocationRepo.Revoke(r.Context(), user.Email)
 	helper.WriteHTTPResponse(r.Context(), w, http.StatusOK, "User deleted", nil, nil)
 }
@@ -792,6 +975,11 @@ type SimpleRole struct {
 // ListUserRole serve listing all role that directly owned by user
 func ListUserRole(w http.ResponseWriter, r *http.Request) {
 	fLog := userMgmtLogger.WithField("func", "ListUserRole").WithField("RequestID", r.Context().Value(constants.RequestID)).WithField("path", r.URL.Path).WithField("method", r.Method)
+	iauthctx := r.Context().Value(constants.HansipAuthentication)
+	if iauthctx == nil {
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusUnauthorized, "You are not authorized to access this resource", nil, nil)
+		return
+	}
 	params, err := helper.ParsePathParams(fmt.Sprintf("%s/management/user/{userRecId}/roles", apiPrefix), r.URL.Path)
 	if err != nil {
 		panic(err)
@@ -802,6 +990,10 @@ func ListUserRole(w http.ResponseWriter, r *http.Request) {
 		helper.WriteHTTPResponse(r.Context(), w, http.StatusNotFound, err.Error(), nil, nil)
 		return
 	}
+	if !canReadUser(r.Context(), iauthctx.(*hansipcontext.AuthenticationContext), user) {
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusForbidden, "You don't have the right to access user in the specified tenant", nil, nil)
+		return
+	}
 	pageRequest, err := helper.NewPageRequestFromRequest(r)
 	if err != nil {
 		fLog.Errorf("helper.NewPageRequestFromRequest got %s", err.Error())
@@ -811,6 +1003,8 @@ func ListUserRole(w http.ResponseWriter, r *http.Request) {
 	roles, page, err := UserRoleRepo.ListUserRoleByUser(r.Context(), user, pageRequest)
 	if err != nil {
 		fLog.Errorf("UserRoleRepo.ListUserRoleByUser got %s", err.Error())
+		helper.WriteHTTPResponse(r.Context(), w, listErrorStatus(err), err.Error(), nil, nil)
+		return
 	}
 	sroles := make([]*SimpleRole, len(roles))
 	for k, v := range roles {
@@ -829,6 +1023,11 @@ func ListUserRole(w http.ResponseWriter, r *http.Request) {
 // ListAllUserRole serve listing of all roles belong to user, both direct or indirect
 func ListAllUserRole(w http.ResponseWriter, r *http.Request) {
 	fLog := userMgmtLogger.WithField("func", "ListAllUserRole").WithField("RequestID", r.Context().Value(constants.RequestID)).WithField("path", r.URL.Path).WithField("method", r.Method)
+	iauthctx := r.Context().Value(constants.HansipAuthentication)
+	if iauthctx == nil {
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusUnauthorized, "You are not authorized to access this resource", nil, nil)
+		return
+	}
 	params, err := helper.ParsePathParams(fmt.Sprintf("%s/management/user/{userRecId}/all-roles", apiPrefix), r.URL.Path)
 	if err != nil {
 		panic(err)
@@ -839,6 +1038,10 @@ func ListAllUserRole(w http.ResponseWriter, r *http.Request) {
 		helper.WriteHTTPResponse(r.Context(), w, http.StatusNotFound, err.Error(), nil, nil)
 		return
 	}
+	if !canReadUser(r.Context(), iauthctx.(*hansipcontext.AuthenticationContext), user) {
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusForbidden, "You don't have the right to access user in the specified tenant", nil, nil)
+		return
+	}
 	pageRequest, err := helper.NewPageRequestFromRequest(r)
 	if err != nil {
 		fLog.Errorf("helper.NewPageRequestFromRequest got %s", err.Error())
@@ -848,6 +1051,8 @@ func ListAllUserRole(w http.ResponseWriter, r *http.Request) {
 	roles, page, err := UserRepo.ListAllUserRoles(r.Context(), user, pageRequest)
 	if err != nil {
 		fLog.Errorf("UserRepo.ListAllUserRoles got %s", err.Error())
+		helper.WriteHTTPResponse(r.Context(), w, listErrorStatus(err), err.Error(), nil, nil)
+		return
 	}
 	sroles := make([]*SimpleRole, len(roles))
 	for k, v := range roles {
@@ -885,7 +1090,7 @@ func CreateUserRole(w http.ResponseWriter, r *http.Request) {
 	}
 
 	authCtx := iauthctx.(*hansipcontext.AuthenticationContext)
-	if !authCtx.IsAdminOfDomain(role.RoleDomain) {
+	if !canAssignRole(authCtx, role.RoleName, role.RoleDomain) {
 		helper.WriteHTTPResponse(r.Context(), w, http.StatusForbidden, "You don't have the right to access role with the specified domain", nil, nil)
 		return
 	}
@@ -903,6 +1108,8 @@ func CreateUserRole(w http.ResponseWriter, r *http.Request) {
 		helper.WriteHTTPResponse(r.Context(), w, http.StatusBadRequest, err.Error(), nil, nil)
 		return
 	}
+	auditUser(r, "user.role.add", user, nil, auditLink("role", fmt.Sprintf("%s@%s", role.RoleName, role.RoleDomain)))
+	events.Publish(r.Context(), &events.RoleGranted{User: user, Role: role})
 	RevocationRepo.Revoke(r.Context(), user.Email)
 	helper.WriteHTTPResponse(r.Context(), w, http.StatusOK, "User-Role created", nil, nil)
 }
@@ -930,7 +1137,7 @@ func DeleteUserRole(w http.ResponseWriter, r *http.Request) {
 	}
 
 	authCtx := iauthctx.(*hansipcontext.AuthenticationContext)
-	if !authCtx.IsAdminOfDomain(role.RoleDomain) {
+	if !canAssignRole(authCtx, role.RoleName, role.RoleDomain) {
 		helper.WriteHTTPResponse(r.Context(), w, http.StatusForbidden, "You don't have the right to access role with the specified domain", nil, nil)
 		return
 	}
@@ -954,6 +1161,8 @@ func DeleteUserRole(w http.ResponseWriter, r *http.Request) {
 		helper.WriteHTTPResponse(r.Context(), w, http.StatusBadRequest, err.Error(), nil, nil)
 		return
 	}
+	auditUser(r, "user.role.remove", user, auditLink("role", fmt.Sprintf("%s@%s", role.RoleName, role.RoleDomain)), nil)
+	events.Publish(r.Context(), &events.RoleRevoked{User: user, Role: role})
 	RevocationRepo.Revoke(r.Context(), user.Email)
 	helper.WriteHTTPResponse(r.Context(), w, http.StatusOK, "User-Role deleted", nil, nil)
 }
@@ -978,6 +1187,10 @@ func ListUserGroup(w http.ResponseWriter, r *http.Request) {
 		helper.WriteHTTPResponse(r.Context(), w, http.StatusNotFound, err.Error(), nil, nil)
 		return
 	}
+	if !canReadUser(r.Context(), iauthctx.(*hansipcontext.AuthenticationContext), user) {
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusForbidden, "You don't have the right to access user in the specified tenant", nil, nil)
+		return
+	}
 	pageRequest, err := helper.NewPageRequestFromRequest(r)
 	if err != nil {
 		fLog.Errorf("helper.NewPageRequestFromRequest got %s", err.Error())
@@ -987,6 +1200,8 @@ func ListUserGroup(w http.ResponseWriter, r *http.Request) {
 	groups, page, err := UserGroupRepo.ListUserGroupByUser(r.Context(), user, pageRequest)
 	if err != nil {
 		fLog.Errorf("UserGroupRepo.ListUserGroupByUser got %s", err.Error())
+		helper.WriteHTTPResponse(r.Context(), w, listErrorStatus(err), err.Error(), nil, nil)
+		return
 	}
 	sgroups := make([]*SimpleGroup, len(groups))
 	for k, v := range groups {
@@ -1024,7 +1239,7 @@ func CreateUserGroup(w http.ResponseWriter, r *http.Request) {
 	}
 
 	authCtx := iauthctx.(*hansipcontext.AuthenticationContext)
-	if !authCtx.IsAdminOfDomain(group.GroupDomain) {
+	if !canJoinGroup(r.Context(), authCtx, group) {
 		helper.WriteHTTPResponse(r.Context(), w, http.StatusForbidden, "You don't have the right to access group with the specified domain", nil, nil)
 		return
 	}
@@ -1042,6 +1257,7 @@ func CreateUserGroup(w http.ResponseWriter, r *http.Request) {
 		helper.WriteHTTPResponse(r.Context(), w, http.StatusBadRequest, err.Error(), nil, nil)
 		return
 	}
+	auditUser(r, "user.group.add", user, nil, auditLink("group", fmt.Sprintf("%s@%s", group.GroupName, group.GroupDomain)))
 	RevocationRepo.Revoke(r.Context(), user.Email)
 	helper.WriteHTTPResponse(r.Context(), w, http.StatusOK, "User-Group created", nil, nil)
 }
@@ -1069,7 +1285,7 @@ func DeleteUserGroup(w http.ResponseWriter, r *http.Request) {
 	}
 
 	authCtx := iauthctx.(*hansipcontext.AuthenticationContext)
-	if !authCtx.IsAdminOfDomain(group.GroupDomain) {
+	if !canJoinGroup(r.Context(), authCtx, group) {
 		helper.WriteHTTPResponse(r.Context(), w, http.StatusForbidden, "You don't have the right to access group with the specified domain", nil, nil)
 		return
 	}
@@ -1093,7 +1309,224 @@ func DeleteUserGroup(w http.ResponseWriter, r *http.Request) {
 		helper.WriteHTTPResponse(r.Context(), w, http.StatusNotFound, err.Error(), nil, nil)
 		return
 	}
+	auditUser(r, "user.group.remove", user, auditLink("group", fmt.Sprintf("%s@%s", group.GroupName, group.GroupDomain)), nil)
 	RevocationRepo.Revoke(r.Context(), user.Email)
 	helper.WriteHTTPResponse(r.Context(), w, http.StatusOK, "User-Group deleted", nil, nil)
 
 }
+
+// canManageUser check if the authenticated admin is an admin or user manager of any tenant the user is member of.
+// A user holding privileged roles can only be managed by the admins of those roles domain.
+func canManageUser(ctx context.Context, authCtx *hansipcontext.AuthenticationContext, user *connector.User) bool {
+	if !isUserInScope(ctx, authCtx, user, hansipcontext.ScopeUserManager) {
+		return false
+	}
+	return !isPrivilegedUserOutOf(ctx, authCtx, user)
+}
+
+// canReadUser check if the authenticated user is an admin or have any delegated scope on any tenant the user is member of.
+func canReadUser(ctx context.Context, authCtx *hansipcontext.AuthenticationContext, user *connector.User) bool {
+	return isUserInScope(ctx, authCtx, user, readScopes...)
+}
+
+// isUserInScope check if the authenticated user is an admin or have one of the scopes on any tenant the user is member of.
+func isUserInScope(ctx context.Context, authCtx *hansipcontext.AuthenticationContext, user *connector.User, scopes ...string) bool {
+	if authCtx.HasScopeOfDomain(config.Get("hansip.domain"), scopes...) {
+		return true
+	}
+	tenants, err := listUserTenants(ctx, user)
+	if err != nil {
+		userMgmtLogger.WithField("func", "isUserInScope").WithField("RequestID", ctx.Value(constants.RequestID)).Errorf("UserTenantRepo.ListUserTenantByUser got %s", err.Error())
+		return false
+	}
+	for _, tenant := range tenants {
+		if authCtx.HasScopeOfDomain(tenant.Domain, scopes...) {
+			return true
+		}
+	}
+	return false
+}
+
+// isUserOutOfScope check if the user is member of a tenant the authenticated user has none of the scopes on.
+// Such user is shared with other tenants, so its account is not for the authenticated user alone to delete.
+func isUserOutOfScope(ctx context.Context, authCtx *hansipcontext.AuthenticationContext, user *connector.User, scopes ...string) bool {
+	if authCtx.HasScopeOfDomain(config.Get("hansip.domain"), scopes...) {
+		return false
+	}
+	tenants, err := listUserTenants(ctx, user)
+	if err != nil {
+		userMgmtLogger.WithField("func", "isUserOutOfScope").WithField("RequestID", ctx.Value(constants.RequestID)).Errorf("UserTenantRepo.ListUserTenantByUser got %s", err.Error())
+		return true
+	}
+	for _, tenant := range tenants {
+		if !authCtx.HasScopeOfDomain(tenant.Domain, scopes...) {
+			return true
+		}
+	}
+	return false
+}
+
+// listUserTenants returns every tenant the user is member of
+func listUserTenants(ctx context.Context, user *connector.User) ([]*connector.Tenant, error) {
+	tenants := make([]*connector.Tenant, 0)
+	err := allPages(func(request *helper.PageRequest) (int, *helper.Page, error) {
+		page, p, err := UserTenantRepo.ListUserTenantByUser(ctx, user, request)
+		tenants = append(tenants, page...)
+		return len(page), p, err
+	})
+	return tenants, err
+}
+
+// ListUserTenant serve listing of tenants the user is member of
+func ListUserTenant(w http.ResponseWriter, r *http.Request) {
+	fLog := userMgmtLogger.WithField("func", "ListUserTenant").WithField("RequestID", r.Context().Value(constants.RequestID)).WithField("path", r.URL.Path).WithField("method", r.Method)
+
+	iauthctx := r.Context().Value(constants.HansipAuthentication)
+	if iauthctx == nil {
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusUnauthorized, "You are not authorized to access this resource", nil, nil)
+		return
+	}
+
+	params, err := helper.ParsePathParams(fmt.Sprintf("%s/management/user/{userRecId}/tenants", apiPrefix), r.URL.Path)
+	if err != nil {
+		panic(err)
+	}
+	user, err := UserRepo.GetUserByRecID(r.Context(), params["userRecId"])
+	if err != nil {
+		fLog.Errorf("UserRepo.GetUserByRecID got %s", err.Error())
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusNotFound, err.Error(), nil, nil)
+		return
+	}
+	if !canReadUser(r.Context(), iauthctx.(*hansipcontext.AuthenticationContext), user) {
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusForbidden, "You don't have the right to access user in the specified tenant", nil, nil)
+		return
+	}
+	pageRequest, err := helper.NewPageRequestFromRequest(r)
+	if err != nil {
+		fLog.Errorf("helper.NewPageRequestFromRequest got %s", err.Error())
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusBadRequest, err.Error(), nil, nil)
+		return
+	}
+	tenants, page, err := UserTenantRepo.ListUserTenantByUser(r.Context(), user, pageRequest)
+	if err != nil {
+		fLog.Errorf("UserTenantRepo.ListUserTenantByUser got %s", err.Error())
+		helper.WriteHTTPResponse(r.Context(), w, listErrorStatus(err), err.Error(), nil, nil)
+		return
+	}
+	ret := make(map[string]interface{})
+	ret["tenants"] = tenants
+	ret["page"] = page
+	helper.WriteHTTPResponse(r.Context(), w, http.StatusOK, "List of tenants paginated", nil, ret)
+}
+
+// CreateUserTenant serve creation of user-tenant relation
+func CreateUserTenant(w http.ResponseWriter, r *http.Request) {
+	fLog := userMgmtLogger.WithField("func", "CreateUserTenant").WithField("RequestID", r.Context().Value(constants.RequestID)).WithField("path", r.URL.Path).WithField("method", r.Method)
+
+	iauthctx := r.Context().Value(constants.HansipAuthentication)
+	if iauthctx == nil {
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusUnauthorized, "You are not authorized to access this resource", nil, nil)
+		return
+	}
+
+	params, err := helper.ParsePathParams(fmt.Sprintf("%s/management/user/{userRecId}/tenant/{tenantRecId}", apiPrefix), r.URL.Path)
+	if err != nil {
+		panic(err)
+	}
+
+	tenant, err := TenantRepo.GetTenantByRecID(r.Context(), params["tenantRecId"])
+	if err != nil {
+		fLog.Errorf("TenantRepo.GetTenantByRecID got %s", err.Error())
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusNotFound, err.Error(), nil, nil)
+		return
+	}
+
+	authCtx := iauthctx.(*hansipcontext.AuthenticationContext)
+	if !authCtx.HasScopeOfDomain(tenant.Domain, hansipcontext.ScopeUserManager) {
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusForbidden, "You don't have the right to access tenant with the specified domain", nil, nil)
+		return
+	}
+
+	user, err := UserRepo.GetUserByRecID(r.Context(), params["userRecId"])
+	if err != nil {
+		fLog.Errorf("UserRepo.GetUserByRecID got %s", err.Error())
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusNotFound, err.Error(), nil, nil)
+		return
+	}
+	// only a user the caller already manages may join the tenant, else any tenant admin could take over users of other tenants
+	if !canManageUser(r.Context(), authCtx, user) {
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusForbidden, "You don't have the right to access user in the specified tenant", nil, nil)
+		return
+	}
+
+	_, err = UserTenantRepo.CreateUserTenant(r.Context(), user, tenant)
+	if err != nil {
+		fLog.Errorf("UserTenantRepo.CreateUserTenant got %s", err.Error())
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusBadRequest, err.Error(), nil, nil)
+		return
+	}
+	audit(r, &connector.AuditEvent{
+		Event:        "user.tenant.add",
+		TargetType:   AuditTargetUser,
+		Target:       user.RecID,
+		TenantDomain: tenant.Domain,
+	}, nil, auditLink("tenant", tenant.Domain))
+	helper.WriteHTTPResponse(r.Context(), w, http.StatusOK, "User-Tenant created", nil, nil)
+}
+
+// DeleteUserTenant serve deleting a user-tenant relation
+func DeleteUserTenant(w http.ResponseWriter, r *http.Request) {
+	fLog := userMgmtLogger.WithField("func", "DeleteUserTenant").WithField("RequestID", r.Context().Value(constants.RequestID)).WithField("path", r.URL.Path).WithField("method", r.Method)
+
+	iauthctx := r.Context().Value(constants.HansipAuthentication)
+	if iauthctx == nil {
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusUnauthorized, "You are not authorized to access this resource", nil, nil)
+		return
+	}
+
+	params, err := helper.ParsePathParams(fmt.Sprintf("%s/management/user/{userRecId}/tenant/{tenantRecId}", apiPrefix), r.URL.Path)
+	if err != nil {
+		panic(err)
+	}
+
+	tenant, err := TenantRepo.GetTenantByRecID(r.Context(), params["tenantRecId"])
+	if err != nil {
+		fLog.Errorf("TenantRepo.GetTenantByRecID got %s", err.Error())
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusNotFound, err.Error(), nil, nil)
+		return
+	}
+
+	authCtx := iauthctx.(*hansipcontext.AuthenticationContext)
+	if !authCtx.HasScopeOfDomain(tenant.Domain, hansipcontext.ScopeUserManager) {
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusForbidden, "You don't have the right to access tenant with the specified domain", nil, nil)
+		return
+	}
+
+	user, err := UserRepo.GetUserByRecID(r.Context(), params["userRecId"])
+	if err != nil {
+		fLog.Errorf("UserRepo.GetUserByRecID got %s", err.Error())
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusNotFound, err.Error(), nil, nil)
+		return
+	}
+
+	ut, err := UserTenantRepo.GetUserTenant(r.Context(), user, tenant)
+	if err != nil {
+		fLog.Errorf("UserTenantRepo.GetUserTenant got %s", err.Error())
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusNotFound, err.Error(), nil, nil)
+		return
+	}
+	err = UserTenantRepo.DeleteUserTenant(r.Context(), ut)
+	if err != nil {
+		fLog.Errorf("UserTenantRepo.DeleteUserTenant got %s", err.Error())
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusInternalServerError, err.Error(), nil, nil)
+		return
+	}
+	audit(r, &connector.AuditEvent{
+		Event:        "user.tenant.remove",
+		TargetType:   AuditTargetUser,
+		Target:       user.RecID,
+		TenantDomain: tenant.Domain,
+	}, auditLink("tenant", tenant.Domain), nil)
+	RevocationRepo.Revoke(r.Context(), user.Email)
+	helper.WriteHTTPResponse(r.Context(), w, http.StatusOK, "User-Tenant deleted", nil, nil)
+}
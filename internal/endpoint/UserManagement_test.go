@@ -1,9 +1,18 @@
 package endpoint
 
 import (
+	"context"
 	"encoding/json"
-	"golang.org/x/crypto/bcrypt"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"testing"
+
+	"github.com/hyperjumptech/hansip/internal/connector"
+	"github.com/hyperjumptech/hansip/internal/constants"
+	"github.com/hyperjumptech/hansip/internal/hansipcontext"
+	"github.com/hyperjumptech/hansip/pkg/helper"
+	"golang.org/x/crypto/bcrypt"
 )
 
 func TestArrayJsonParsing(t *testing.T) {
@@ -29,3 +38,131 @@ func TestGenPass(t *testing.T) {
 	}
 	t.Log(string(hash))
 }
+
+// memoryMembership keeps the tenants of the users in memory
+type memoryMembership struct {
+	connector.UserTenantRepository
+	tenants map[string][]*connector.Tenant
+}
+
+func (m *memoryMembership) ListUserTenantByUser(ctx context.Context, user *connector.User, request *helper.PageRequest) ([]*connector.Tenant, *helper.Page, error) {
+	all := m.tenants[user.RecID]
+	page := helper.NewPage(request, uint(len(all)))
+	from := int(page.OffsetStart)
+	to := int(page.OffsetEnd)
+	if from > len(all) {
+		from = len(all)
+	}
+	if to > len(all) {
+		to = len(all)
+	}
+	return all[from:to], page, nil
+}
+
+func (m *memoryMembership) CreateUserTenant(ctx context.Context, user *connector.User, tenant *connector.Tenant) (*connector.UserTenant, error) {
+	m.tenants[user.RecID] = append(m.tenants[user.RecID], tenant)
+	return &connector.UserTenant{UserRecID: user.RecID, TenantRecID: tenant.RecID}, nil
+}
+
+func (m *memoryMembership) GetUserTenant(ctx context.Context, user *connector.User, tenant *connector.Tenant) (*connector.UserTenant, error) {
+	for _, t := range m.tenants[user.RecID] {
+		if t.RecID == tenant.RecID {
+			return &connector.UserTenant{UserRecID: user.RecID, TenantRecID: tenant.RecID}, nil
+		}
+	}
+	return nil, &connector.ErrDBNoResult{Message: "no membership"}
+}
+
+// memoryDirectory finds the users and their roles it is given
+type memoryDirectory struct {
+	connector.UserRepository
+	users map[string]*connector.User
+	roles map[string][]*connector.Role
+}
+
+func (d *memoryDirectory) GetUserByRecID(ctx context.Context, recID string) (*connector.User, error) {
+	if user, ok := d.users[recID]; ok {
+		return user, nil
+	}
+	return nil, &connector.ErrDBNoResult{Message: "no user"}
+}
+
+func (d *memoryDirectory) ListAllUserRoles(ctx context.Context, user *connector.User, request *helper.PageRequest) ([]*connector.Role, *helper.Page, error) {
+	roles := d.roles[user.RecID]
+	return roles, helper.NewPage(request, uint(len(roles))), nil
+}
+
+// fixedTenants finds the tenants it is given by their record id
+type fixedTenants struct {
+	connector.TenantRepository
+	tenants map[string]*connector.Tenant
+}
+
+func (f *fixedTenants) GetTenantByRecID(ctx context.Context, recID string) (*connector.Tenant, error) {
+	if tenant, ok := f.tenants[recID]; ok {
+		return tenant, nil
+	}
+	return nil, &connector.ErrDBNoResult{Message: "no tenant"}
+}
+
+func TestUserScopeAcrossTenants(t *testing.T) {
+	defer func() { UserTenantRepo, UserRepo = nil, nil }()
+	acme := &connector.Tenant{RecID: "acme", Domain: "acme.com"}
+	many := make([]*connector.Tenant, 0)
+	for i := 0; i < 150; i++ {
+		many = append(many, &connector.Tenant{RecID: fmt.Sprintf("t%d", i), Domain: fmt.Sprintf("t%d.com", i)})
+	}
+	many = append(many, acme)
+	john := &connector.User{RecID: "john"}
+	jane := &connector.User{RecID: "jane"}
+	boss := &connector.User{RecID: "boss"}
+	UserTenantRepo = &memoryMembership{tenants: map[string][]*connector.Tenant{
+		"john": {acme},
+		"jane": many,
+		"boss": {acme},
+	}}
+	UserRepo = &memoryDirectory{roles: map[string][]*connector.Role{
+		"boss": {{RoleName: "admin", RoleDomain: "other.com"}},
+	}}
+	ctx := context.Background()
+	acmeAdmin := &hansipcontext.AuthenticationContext{Audience: []string{"admin@acme.com"}}
+	hansipAdmin := &hansipcontext.AuthenticationContext{Audience: []string{"admin@hansip"}}
+
+	if !canManageUser(ctx, acmeAdmin, john) || isUserOutOfScope(ctx, acmeAdmin, john, hansipcontext.ScopeUserManager) {
+		t.Errorf("acme admin should manage and delete john, member of acme only")
+	}
+	if !canManageUser(ctx, acmeAdmin, jane) {
+		t.Errorf("acme admin should manage jane, acme being past the first page of her tenants")
+	}
+	if !isUserOutOfScope(ctx, acmeAdmin, jane, hansipcontext.ScopeUserManager) {
+		t.Errorf("jane is member of other tenants, acme admin should not delete her")
+	}
+	if isUserOutOfScope(ctx, hansipAdmin, jane, hansipcontext.ScopeUserManager) {
+		t.Errorf("hansip admin manages every tenant")
+	}
+	if canManageUser(ctx, acmeAdmin, boss) {
+		t.Errorf("boss is admin of other.com, acme admin should not manage him")
+	}
+	if canManageUser(ctx, &hansipcontext.AuthenticationContext{Audience: []string{"admin@other.com"}}, &connector.User{RecID: "nobody"}) {
+		t.Errorf("a user of no tenant can only be managed by hansip admins")
+	}
+}
+
+func TestCreateUserTenantOfOtherTenantUser(t *testing.T) {
+	defer func() { UserTenantRepo, UserRepo, TenantRepo = nil, nil, nil }()
+	acme := &connector.Tenant{RecID: "acme", Domain: "acme.com"}
+	other := &connector.Tenant{RecID: "other", Domain: "other.com"}
+	membership := &memoryMembership{tenants: map[string][]*connector.Tenant{"john": {other}}}
+	UserTenantRepo = membership
+	UserRepo = &memoryDirectory{users: map[string]*connector.User{"john": {RecID: "john"}}}
+	TenantRepo = &fixedTenants{tenants: map[string]*connector.Tenant{"acme": acme, "other": other}}
+
+	authCtx := &hansipcontext.AuthenticationContext{Subject: "admin@acme.com", Audience: []string{"admin@acme.com"}}
+	r := httptest.NewRequest(http.MethodPut, fmt.Sprintf("%s/management/user/john/tenant/acme", apiPrefix), nil)
+	r = r.WithContext(context.WithValue(r.Context(), constants.HansipAuthentication, authCtx))
+	recorder := httptest.NewRecorder()
+	CreateUserTenant(recorder, r)
+	if recorder.Code != http.StatusForbidden || len(membership.tenants["john"]) != 1 {
+		t.Errorf("acme admin should not pull john of other.com into acme, got %d and tenants %v", recorder.Code, membership.tenants["john"])
+	}
+}
@@ -0,0 +1,856 @@
+package endpoint
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/hyperjumptech/hansip/internal/config"
+	"github.com/hyperjumptech/hansip/internal/connector"
+	"github.com/hyperjumptech/hansip/internal/constants"
+	"github.com/hyperjumptech/hansip/internal/events"
+	"github.com/hyperjumptech/hansip/internal/hansipcontext"
+	"github.com/hyperjumptech/hansip/pkg/helper"
+	"github.com/hyperjumptech/hansip/pkg/webauthn"
+	"github.com/hyperjumptech/jiffy"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	// webAuthnNameMaxLength is the longest name of a credential
+	webAuthnNameMaxLength = 64
+	// webAuthnDefaultName names the credentials registered without a name
+	webAuthnDefaultName = "Security key"
+)
+
+var (
+	webAuthnLog = log.WithField("go", "WebAuthn")
+
+	// errWebAuthnRejected the ceremony answer is not accepted, the challenge, the credential or the signature is not valid
+	errWebAuthnRejected = errors.New("security key not accepted")
+)
+
+// WebAuthnCreationOptions holds the options to give navigator.credentials.create
+type WebAuthnCreationOptions struct {
+	PublicKey *webauthn.CreationOptions `json:"publicKey"`
+}
+
+// WebAuthnRequestOptions holds the options to give navigator.credentials.get
+type WebAuthnRequestOptions struct {
+	PublicKey *webauthn.RequestOptions `json:"publicKey"`
+}
+
+// WebAuthnRegisterRequest model for registering the credential created by navigator.credentials.create
+type WebAuthnRegisterRequest struct {
+	Name       string                               `json:"name"`
+	Credential *webauthn.CredentialCreationResponse `json:"credential"`
+}
+
+// WebAuthnStepUpRequest model proving the authenticated user again before a credential is registered,
+// with the passphrase, a code of the second factor or the signature of a credential already registered
+type WebAuthnStepUpRequest struct {
+	Passphrase string                                `json:"passphrase,omitempty"`
+	Otp        string                                `json:"2FA_otp,omitempty"`
+	Credential *webauthn.CredentialAssertionResponse `json:"credential,omitempty"`
+}
+
+// WebAuthnRegisterResponse holds the credential registered, and the recovery codes if registering it activated 2FA
+type WebAuthnRegisterResponse struct {
+	Credential *connector.WebAuthnCredential `json:"credential"`
+	Codes      []string                      `json:"2FA_recovery_codes,omitempty"`
+}
+
+// WebAuthnCredentialRequest model for renaming a credential
+type WebAuthnCredentialRequest struct {
+	Name string `json:"name"`
+}
+
+// WebAuthn2FARequest model for completing a 2FA authentication with a security key
+type WebAuthn2FARequest struct {
+	Token      string                                `json:"2FA_token"`
+	Credential *webauthn.CredentialAssertionResponse `json:"credential,omitempty"`
+}
+
+// WebAuthnLoginRequest model for authenticating with a security key or a passkey, without passphrase.
+// The email is optional, without it the authenticator offers the discoverable credentials it holds.
+type WebAuthnLoginRequest struct {
+	Email      string                                `json:"email,omitempty"`
+	Credential *webauthn.CredentialAssertionResponse `json:"credential,omitempty"`
+}
+
+// webAuthnRelyingParty returns the relying party of the configuration
+func webAuthnRelyingParty() *webauthn.RelyingParty {
+	origins := make([]string, 0)
+	for _, origin := range strings.Split(config.Get("webauthn.rp.origins"), ",") {
+		if origin = strings.TrimSpace(origin); len(origin) > 0 {
+			origins = append(origins, origin)
+		}
+	}
+	return &webauthn.RelyingParty{
+		ID:      config.Get("webauthn.rp.id"),
+		Name:    config.Get("webauthn.rp.name"),
+		Origins: origins,
+	}
+}
+
+// webAuthnTimeout returns how long a ceremony may take, 2 minutes if the configuration is not valid
+func webAuthnTimeout() time.Duration {
+	d, err := jiffy.DurationOf(config.Get("webauthn.timeout"))
+	if err != nil || d <= 0 {
+		return 2 * time.Minute
+	}
+	return d
+}
+
+// webAuthnUserVerification returns the user verification of the registrations and of the second factor,
+// preferred if the configuration is not valid
+func webAuthnUserVerification() string {
+	switch uv := strings.ToLower(config.Get("webauthn.userverification")); uv {
+	case webauthn.UserVerificationRequired, webauthn.UserVerificationPreferred, webauthn.UserVerificationDiscouraged:
+		return uv
+	}
+	return webauthn.UserVerificationPreferred
+}
+
+// webAuthnName returns the name of a credential, trimmed, or an error if it is too long
+func webAuthnName(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if len(name) == 0 {
+		return webAuthnDefaultName, nil
+	}
+	if len(name) > webAuthnNameMaxLength {
+		return "", fmt.Errorf("name is longer than %d characters", webAuthnNameMaxLength)
+	}
+	return name, nil
+}
+
+// webAuthnDescriptors returns the descriptors of the credentials, to allow or exclude them
+func webAuthnDescriptors(creds []*connector.WebAuthnCredential) []webauthn.CredentialDescriptor {
+	descriptors := make([]webauthn.CredentialDescriptor, 0, len(creds))
+	for _, cred := range creds {
+		id, err := base64.RawURLEncoding.DecodeString(cred.CredentialID)
+		if err != nil {
+			continue
+		}
+		descriptors = append(descriptors, webauthn.CredentialDescriptor{Type: webauthn.CredentialType, ID: id, Transports: cred.Transports})
+	}
+	return descriptors
+}
+
+// newWebAuthnChallenge stores a new challenge of the ceremony, for the user if any
+func newWebAuthnChallenge(ctx context.Context, user *connector.User, ceremony string, now time.Time) (webauthn.URLEncodedBase64, error) {
+	challenge, err := webauthn.NewChallenge()
+	if err != nil {
+		return nil, err
+	}
+	session := &connector.WebAuthnSession{
+		Challenge: challenge.String(),
+		Ceremony:  ceremony,
+		ExpireAt:  now.Add(webAuthnTimeout()),
+	}
+	if user != nil {
+		session.UserRecID = user.RecID
+	}
+	if err := WebAuthnRepo.SaveWebAuthnSession(ctx, session); err != nil {
+		return nil, err
+	}
+	return challenge, nil
+}
+
+// consumeWebAuthnChallenge consumes the challenge the answer signed and returns its session.
+// A challenge unknown, already answered, expired or of another ceremony is rejected.
+func consumeWebAuthnChallenge(ctx context.Context, challenge, ceremony string, now time.Time) (*connector.WebAuthnSession, []byte, error) {
+	session, err := WebAuthnRepo.ConsumeWebAuthnSession(ctx, challenge)
+	if _, none := err.(*connector.ErrDBNoResult); none {
+		return nil, nil, fmt.Errorf("%w, unknown challenge", errWebAuthnRejected)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if session.Ceremony != ceremony || !now.Before(session.ExpireAt) {
+		return nil, nil, fmt.Errorf("%w, expired challenge", errWebAuthnRejected)
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(session.Challenge)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w, invalid challenge", errWebAuthnRejected)
+	}
+	return session, raw, nil
+}
+
+// verifyWebAuthnAssertion verifies the assertion answering a challenge of the ceremony and returns the credential
+// and its user, with the sign count and last use of the credential updated. The user is returned once the credential
+// is known, even if the assertion is rejected. An expected user, if any, must own the credential.
+func verifyWebAuthnAssertion(ctx context.Context, assertion *webauthn.CredentialAssertionResponse, ceremony string, expected *connector.User, requireUserVerification bool, now time.Time) (*connector.User, *connector.WebAuthnCredential, error) {
+	challenge, err := assertion.Challenge()
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w, %s", errWebAuthnRejected, err.Error())
+	}
+	session, rawChallenge, err := consumeWebAuthnChallenge(ctx, challenge, ceremony, now)
+	if err != nil {
+		return nil, nil, err
+	}
+	credentialID := assertion.RawID.String()
+	if len(assertion.RawID) == 0 {
+		credentialID = assertion.ID
+	}
+	cred, err := WebAuthnRepo.GetWebAuthnCredentialByCredentialID(ctx, credentialID)
+	if _, none := err.(*connector.ErrDBNoResult); none {
+		return nil, nil, fmt.Errorf("%w, unknown credential", errWebAuthnRejected)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	user, err := UserRepo.GetUserByRecID(ctx, cred.UserRecID)
+	if err != nil || user == nil {
+		return nil, nil, fmt.Errorf("%w, credential of no user", errWebAuthnRejected)
+	}
+	if expected != nil && expected.RecID != user.RecID {
+		return nil, nil, fmt.Errorf("%w, credential of another user", errWebAuthnRejected)
+	}
+	if len(session.UserRecID) > 0 && session.UserRecID != user.RecID {
+		return user, cred, fmt.Errorf("%w, challenge of another user", errWebAuthnRejected)
+	}
+	if len(assertion.Response.UserHandle) > 0 && string(assertion.Response.UserHandle) != user.RecID {
+		return user, cred, fmt.Errorf("%w, user handle of another user", errWebAuthnRejected)
+	}
+	count, err := webAuthnRelyingParty().VerifyAssertion(assertion, rawChallenge, cred.PublicKey, cred.SignCount, requireUserVerification)
+	if err != nil {
+		if errors.Is(err, webauthn.ErrSignCountRegression) {
+			webAuthnLog.WithField("func", "verifyWebAuthnAssertion").WithField("RequestID", ctx.Value(constants.RequestID)).Warnf("credential %s of user %s may be cloned, %s", cred.RecID, user.RecID, err.Error())
+		}
+		return user, cred, fmt.Errorf("%w, %s", errWebAuthnRejected, err.Error())
+	}
+	cred.SignCount = count
+	cred.LastUsed = now
+	if err := WebAuthnRepo.UpdateWebAuthnCredential(ctx, cred); err != nil {
+		return nil, nil, err
+	}
+	return user, cred, nil
+}
+
+// webAuthnErrorStatus returns the status responding the error of a ceremony, 401 if it is rejected
+func webAuthnErrorStatus(err error) int {
+	if errors.Is(err, errWebAuthnRejected) {
+		return http.StatusUnauthorized
+	}
+	return http.StatusInternalServerError
+}
+
+// userTokens creates the token pair of the authenticated user, the audience being the roles of the user
+func userTokens(ctx context.Context, settings config.Settings, user *connector.User) (*Response, error) {
+	userRoles, _, err := UserRepo.ListAllUserRoles(ctx, user, &helper.PageRequest{
+		No:       1,
+		PageSize: 1000,
+		OrderBy:  "ROLE_NAME",
+		Sort:     "ASC",
+	})
+	if err != nil {
+		return nil, err
+	}
+	roles := make([]string, len(userRoles))
+	for k, v := range userRoles {
+		role, err := RoleRepo.GetRoleByRecID(ctx, v.RecID)
+		if err == nil {
+			roles[k] = fmt.Sprintf("%s@%s", role.RoleName, role.RoleDomain)
+		}
+	}
+	access, refresh, err := createTokenPair(settings, user.Email, roles, userAttributeClaims(ctx, user))
+	if err != nil {
+		return nil, err
+	}
+	return &Response{
+		AccessToken:  access,
+		RefreshToken: refresh,
+	}, nil
+}
+
+// authenticatedUser returns the user of the authentication, responding an error if there is none
+func authenticatedUser(w http.ResponseWriter, r *http.Request, fLog *log.Entry) (*connector.User, bool) {
+	iauthctx := r.Context().Value(constants.HansipAuthentication)
+	if iauthctx == nil {
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusUnauthorized, "You are not authorized to access this resource", nil, nil)
+		return nil, false
+	}
+	authCtx := iauthctx.(*hansipcontext.AuthenticationContext)
+	user, err := UserRepo.GetUserByEmail(r.Context(), authCtx.Subject)
+	if err != nil || user == nil {
+		if err != nil {
+			fLog.Errorf("UserRepo.GetUserByEmail got %s", err.Error())
+		}
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusNotFound, fmt.Sprintf("subject not found : %s", authCtx.Subject), nil, nil)
+		return nil, false
+	}
+	return user, true
+}
+
+// readJSON reads the json body of the request into v, responding an error if it is malformed
+func readJSON(w http.ResponseWriter, r *http.Request, fLog *log.Entry, v interface{}) bool {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		fLog.Errorf("ioutil.ReadAll got %s", err.Error())
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusInternalServerError, err.Error(), nil, nil)
+		return false
+	}
+	if err := json.Unmarshal(body, v); err != nil {
+		fLog.Errorf("json.Unmarshal got %s", err.Error())
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusBadRequest, "Malformed json body", nil, nil)
+		return false
+	}
+	return true
+}
+
+// webAuthnStepUp check the proof of the step-up request: the signature of a challenge of BeginWebAuthnStepUp by a credential
+// of the user, a code of the second factor if the user activated 2FA, or the passphrase. It returns false if there is no proof.
+func webAuthnStepUp(ctx context.Context, user *connector.User, req *WebAuthnStepUpRequest, now time.Time) (bool, error) {
+	switch {
+	case req.Credential != nil:
+		requireUV := webAuthnUserVerification() == webauthn.UserVerificationRequired
+		_, _, err := verifyWebAuthnAssertion(ctx, req.Credential, connector.WebAuthnStepUp, user, requireUV, now)
+		if errors.Is(err, errWebAuthnRejected) {
+			return false, nil
+		}
+		return err == nil, err
+	case len(req.Otp) > 0 && user.Enable2FactorAuth:
+		valid, _, err := verify2FACode(ctx, user, req.Otp, now)
+		return valid, err
+	case len(req.Passphrase) > 0:
+		return bcrypt.CompareHashAndPassword([]byte(user.HashedPassphrase), []byte(req.Passphrase)) == nil, nil
+	}
+	return false, nil
+}
+
+// BeginWebAuthnStepUp serving request for the options to sign with a credential of the authenticated user,
+// the signature being the step-up of BeginWebAuthnRegistration
+func BeginWebAuthnStepUp(w http.ResponseWriter, r *http.Request) {
+	fLog := webAuthnLog.WithField("func", "BeginWebAuthnStepUp").WithField("RequestID", r.Context().Value(constants.RequestID)).WithField("path", r.URL.Path).WithField("method", r.Method)
+	user, ok := authenticatedUser(w, r, fLog)
+	if !ok {
+		return
+	}
+	creds, err := WebAuthnRepo.ListWebAuthnCredentials(r.Context(), user)
+	if err != nil {
+		fLog.Errorf("WebAuthnRepo.ListWebAuthnCredentials got %s", err.Error())
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusInternalServerError, err.Error(), nil, nil)
+		return
+	}
+	if len(creds) == 0 {
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusNotFound, "no security key registered", nil, nil)
+		return
+	}
+	challenge, err := newWebAuthnChallenge(r.Context(), user, connector.WebAuthnStepUp, time.Now())
+	if err != nil {
+		fLog.Errorf("newWebAuthnChallenge got %s", err.Error())
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusInternalServerError, err.Error(), nil, nil)
+		return
+	}
+	options := &webauthn.RequestOptions{
+		Challenge:        challenge,
+		Timeout:          int64(webAuthnTimeout() / time.Millisecond),
+		RPID:             webAuthnRelyingParty().ID,
+		AllowCredentials: webAuthnDescriptors(creds),
+		UserVerification: webAuthnUserVerification(),
+	}
+	helper.WriteHTTPResponse(r.Context(), w, http.StatusOK, "Sign with the security key", nil, &WebAuthnRequestOptions{PublicKey: options})
+}
+
+// BeginWebAuthnRegistration serving request for the options to create a credential for the authenticated user,
+// a security key or a passkey. The credentials the user has are excluded. An access token is not enough,
+// the user steps up with a WebAuthnStepUpRequest, a failed proof counting as a failed authentication.
+func BeginWebAuthnRegistration(w http.ResponseWriter, r *http.Request) {
+	fLog := webAuthnLog.WithField("func", "BeginWebAuthnRegistration").WithField("RequestID", r.Context().Value(constants.RequestID)).WithField("path", r.URL.Path).WithField("method", r.Method)
+	user, ok := authenticatedUser(w, r, fLog)
+	if !ok {
+		return
+	}
+	req := &WebAuthnStepUpRequest{}
+	if !readJSON(w, r, fLog, req) {
+		return
+	}
+	if req.Credential == nil && len(req.Otp) == 0 && len(req.Passphrase) == 0 {
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusUnauthorized, "passphrase, 2FA_otp or credential is required", nil, nil)
+		return
+	}
+	valid, err := webAuthnStepUp(r.Context(), user, req, time.Now())
+	if err != nil {
+		fLog.Errorf("webAuthnStepUp got %s", err.Error())
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusInternalServerError, err.Error(), nil, nil)
+		return
+	}
+	if !valid {
+		registerAuthenticationFailure(r, "auth.webauthn_stepup", userSettings(r.Context(), user), user)
+		if err := UserRepo.UpdateUser(r.Context(), user); err != nil {
+			fLog.Errorf("UserRepo.UpdateUser got %s", err.Error())
+		}
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusUnauthorized, "step-up not accepted", nil, nil)
+		return
+	}
+	creds, err := WebAuthnRepo.ListWebAuthnCredentials(r.Context(), user)
+	if err != nil {
+		fLog.Errorf("WebAuthnRepo.ListWebAuthnCredentials got %s", err.Error())
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusInternalServerError, err.Error(), nil, nil)
+		return
+	}
+	challenge, err := newWebAuthnChallenge(r.Context(), user, connector.WebAuthnRegistration, time.Now())
+	if err != nil {
+		fLog.Errorf("newWebAuthnChallenge got %s", err.Error())
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusInternalServerError, err.Error(), nil, nil)
+		return
+	}
+	rp := webAuthnRelyingParty()
+	options := &webauthn.CreationOptions{
+		RP: webauthn.RelyingPartyEntity{ID: rp.ID, Name: rp.Name},
+		// the user handle is the record id, not the email, it is kept by the authenticators
+		User:               webauthn.UserEntity{ID: []byte(user.RecID), Name: user.Email, DisplayName: user.Email},
+		Challenge:          challenge,
+		PubKeyCredParams:   webauthn.CredentialParameters(),
+		Timeout:            int64(webAuthnTimeout() / time.Millisecond),
+		ExcludeCredentials: webAuthnDescriptors(creds),
+		AuthenticatorSelection: &webauthn.AuthenticatorSelection{
+			ResidentKey:      "preferred",
+			UserVerification: webAuthnUserVerification(),
+		},
+		Attestation: "none",
+	}
+	helper.WriteHTTPResponse(r.Context(), w, http.StatusOK, "Create the credential", nil, &WebAuthnCreationOptions{PublicKey: options})
+}
+
+// FinishWebAuthnRegistration serving request to register the credential created with the options of BeginWebAuthnRegistration.
+// The challenge of the options is given only after the step-up and expires, so the step-up is recent.
+// Registering the first second factor of the user activates 2FA and responds the recovery codes, like Activate2FA.
+func FinishWebAuthnRegistration(w http.ResponseWriter, r *http.Request) {
+	fLog := webAuthnLog.WithField("func", "FinishWebAuthnRegistration").WithField("RequestID", r.Context().Value(constants.RequestID)).WithField("path", r.URL.Path).WithField("method", r.Method)
+	user, ok := authenticatedUser(w, r, fLog)
+	if !ok {
+		return
+	}
+	req := &WebAuthnRegisterRequest{}
+	if !readJSON(w, r, fLog, req) {
+		return
+	}
+	if req.Credential == nil {
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusBadRequest, "credential is required", nil, nil)
+		return
+	}
+	name, err := webAuthnName(req.Name)
+	if err != nil {
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusBadRequest, err.Error(), nil, nil)
+		return
+	}
+	challenge, err := req.Credential.Challenge()
+	if err != nil {
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusBadRequest, err.Error(), nil, nil)
+		return
+	}
+	session, rawChallenge, err := consumeWebAuthnChallenge(r.Context(), challenge, connector.WebAuthnRegistration, time.Now())
+	if err == nil && session.UserRecID != user.RecID {
+		err = fmt.Errorf("%w, challenge of another user", errWebAuthnRejected)
+	}
+	if err != nil {
+		fLog.Warnf("consumeWebAuthnChallenge got %s", err.Error())
+		helper.WriteHTTPResponse(r.Context(), w, webAuthnErrorStatus(err), err.Error(), nil, nil)
+		return
+	}
+	requireUV := webAuthnUserVerification() == webauthn.UserVerificationRequired
+	verified, err := webAuthnRelyingParty().VerifyRegistration(req.Credential, rawChallenge, requireUV)
+	if err != nil {
+		fLog.Warnf("VerifyRegistration got %s", err.Error())
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusBadRequest, fmt.Sprintf("credential not accepted, %s", err.Error()), nil, nil)
+		return
+	}
+	credentialID := webauthn.URLEncodedBase64(verified.ID).String()
+	_, err = WebAuthnRepo.GetWebAuthnCredentialByCredentialID(r.Context(), credentialID)
+	if err == nil {
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusConflict, "credential already registered", nil, nil)
+		return
+	}
+	if _, none := err.(*connector.ErrDBNoResult); !none {
+		fLog.Errorf("WebAuthnRepo.GetWebAuthnCredentialByCredentialID got %s", err.Error())
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusInternalServerError, err.Error(), nil, nil)
+		return
+	}
+	cred := &connector.WebAuthnCredential{
+		UserRecID:      user.RecID,
+		Name:           name,
+		CredentialID:   credentialID,
+		PublicKey:      verified.PublicKey,
+		Algorithm:      verified.Algorithm,
+		SignCount:      verified.SignCount,
+		AAGUID:         fmt.Sprintf("%x", verified.AAGUID),
+		Transports:     verified.Transports,
+		BackupEligible: verified.BackupEligible,
+	}
+	if err := WebAuthnRepo.CreateWebAuthnCredential(r.Context(), cred); err != nil {
+		fLog.Errorf("WebAuthnRepo.CreateWebAuthnCredential got %s", err.Error())
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusInternalServerError, err.Error(), nil, nil)
+		return
+	}
+	auditUser(r, "user.webauthn.register", user, nil, cred)
+	resp := &WebAuthnRegisterResponse{Credential: cred}
+	if !user.Enable2FactorAuth {
+		resp.Codes, err = UserRepo.RecreateTOTPRecoveryCodes(r.Context(), user)
+		if err != nil {
+			fLog.Errorf("UserRepo.RecreateTOTPRecoveryCodes got %s", err.Error())
+			helper.WriteHTTPResponse(r.Context(), w, http.StatusInternalServerError, err.Error(), nil, nil)
+			return
+		}
+		before := *user
+		user.Enable2FactorAuth = true
+		if err := UserRepo.UpdateUser(r.Context(), user); err != nil {
+			fLog.Errorf("UserRepo.UpdateUser got %s", err.Error())
+			helper.WriteHTTPResponse(r.Context(), w, http.StatusInternalServerError, err.Error(), nil, nil)
+			return
+		}
+		auditUser(r, "user.2fa.webauthn.activate", user, &before, user)
+	}
+	helper.WriteHTTPResponse(r.Context(), w, http.StatusOK, "Credential registered", nil, resp)
+}
+
+// ListWebAuthnCredentials serving request to list the credentials of the authenticated user
+func ListWebAuthnCredentials(w http.ResponseWriter, r *http.Request) {
+	fLog := webAuthnLog.WithField("func", "ListWebAuthnCredentials").WithField("RequestID", r.Context().Value(constants.RequestID)).WithField("path", r.URL.Path).WithField("method", r.Method)
+	user, ok := authenticatedUser(w, r, fLog)
+	if !ok {
+		return
+	}
+	writeWebAuthnCredentials(w, r, fLog, user)
+}
+
+// ListUserWebAuthnCredentials serving request to list the credentials of a user
+func ListUserWebAuthnCredentials(w http.ResponseWriter, r *http.Request) {
+	fLog := webAuthnLog.WithField("func", "ListUserWebAuthnCredentials").WithField("RequestID", r.Context().Value(constants.RequestID)).WithField("path", r.URL.Path).WithField("method", r.Method)
+	iauthctx := r.Context().Value(constants.HansipAuthentication)
+	if iauthctx == nil {
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusUnauthorized, "You are not authorized to access this resource", nil, nil)
+		return
+	}
+	params, err := helper.ParsePathParams(fmt.Sprintf("%s/management/user/{userRecId}/webauthn/credentials", apiPrefix), r.URL.Path)
+	if err != nil {
+		panic(err)
+	}
+	user, err := UserRepo.GetUserByRecID(r.Context(), params["userRecId"])
+	if err != nil {
+		fLog.Errorf("UserRepo.GetUserByRecID got %s", err.Error())
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusNotFound, err.Error(), nil, nil)
+		return
+	}
+	if !canReadUser(r.Context(), iauthctx.(*hansipcontext.AuthenticationContext), user) {
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusForbidden, "You don't have the right to access user in the specified tenant", nil, nil)
+		return
+	}
+	writeWebAuthnCredentials(w, r, fLog, user)
+}
+
+// writeWebAuthnCredentials responds the credentials of the user
+func writeWebAuthnCredentials(w http.ResponseWriter, r *http.Request, fLog *log.Entry, user *connector.User) {
+	creds, err := WebAuthnRepo.ListWebAuthnCredentials(r.Context(), user)
+	if err != nil {
+		fLog.Errorf("WebAuthnRepo.ListWebAuthnCredentials got %s", err.Error())
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusInternalServerError, err.Error(), nil, nil)
+		return
+	}
+	ret := make(map[string]interface{})
+	ret["credentials"] = creds
+	helper.WriteHTTPResponse(r.Context(), w, http.StatusOK, "List of credentials", nil, ret)
+}
+
+// userWebAuthnCredential returns the credential of the path owned by the user, responding 404 if the user has no such credential
+func userWebAuthnCredential(w http.ResponseWriter, r *http.Request, fLog *log.Entry, user *connector.User, recID string) (*connector.WebAuthnCredential, bool) {
+	cred, err := WebAuthnRepo.GetWebAuthnCredentialByRecID(r.Context(), recID)
+	if _, none := err.(*connector.ErrDBNoResult); none || (err == nil && cred.UserRecID != user.RecID) {
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusNotFound, "credential not found", nil, nil)
+		return nil, false
+	}
+	if err != nil {
+		fLog.Errorf("WebAuthnRepo.GetWebAuthnCredentialByRecID got %s", err.Error())
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusInternalServerError, err.Error(), nil, nil)
+		return nil, false
+	}
+	return cred, true
+}
+
+// RenameWebAuthnCredential serving request to rename a credential of the authenticated user
+func RenameWebAuthnCredential(w http.ResponseWriter, r *http.Request) {
+	fLog := webAuthnLog.WithField("func", "RenameWebAuthnCredential").WithField("RequestID", r.Context().Value(constants.RequestID)).WithField("path", r.URL.Path).WithField("method", r.Method)
+	user, ok := authenticatedUser(w, r, fLog)
+	if !ok {
+		return
+	}
+	params, err := helper.ParsePathParams(fmt.Sprintf("%s/management/user/webauthn/credential/{credentialRecId}", apiPrefix), r.URL.Path)
+	if err != nil {
+		panic(err)
+	}
+	cred, ok := userWebAuthnCredential(w, r, fLog, user, params["credentialRecId"])
+	if !ok {
+		return
+	}
+	req := &WebAuthnCredentialRequest{}
+	if !readJSON(w, r, fLog, req) {
+		return
+	}
+	name, err := webAuthnName(req.Name)
+	if err != nil {
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusBadRequest, err.Error(), nil, nil)
+		return
+	}
+	before := *cred
+	cred.Name = name
+	if err := WebAuthnRepo.UpdateWebAuthnCredential(r.Context(), cred); err != nil {
+		fLog.Errorf("WebAuthnRepo.UpdateWebAuthnCredential got %s", err.Error())
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusInternalServerError, err.Error(), nil, nil)
+		return
+	}
+	auditUser(r, "user.webauthn.rename", user, &before, cred)
+	helper.WriteHTTPResponse(r.Context(), w, http.StatusOK, "Credential renamed", nil, cred)
+}
+
+// DeleteWebAuthnCredential serving request to revoke a credential of the authenticated user
+func DeleteWebAuthnCredential(w http.ResponseWriter, r *http.Request) {
+	fLog := webAuthnLog.WithField("func", "DeleteWebAuthnCredential").WithField("RequestID", r.Context().Value(constants.RequestID)).WithField("path", r.URL.Path).WithField("method", r.Method)
+	user, ok := authenticatedUser(w, r, fLog)
+	if !ok {
+		return
+	}
+	params, err := helper.ParsePathParams(fmt.Sprintf("%s/management/user/webauthn/credential/{credentialRecId}", apiPrefix), r.URL.Path)
+	if err != nil {
+		panic(err)
+	}
+	revokeWebAuthnCredential(w, r, fLog, user, params["credentialRecId"])
+}
+
+// DeleteUserWebAuthnCredential serving request to revoke a credential of a user, eg. a lost security key
+func DeleteUserWebAuthnCredential(w http.ResponseWriter, r *http.Request) {
+	fLog := webAuthnLog.WithField("func", "DeleteUserWebAuthnCredential").WithField("RequestID", r.Context().Value(constants.RequestID)).WithField("path", r.URL.Path).WithField("method", r.Method)
+	iauthctx := r.Context().Value(constants.HansipAuthentication)
+	if iauthctx == nil {
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusUnauthorized, "You are not authorized to access this resource", nil, nil)
+		return
+	}
+	params, err := helper.ParsePathParams(fmt.Sprintf("%s/management/user/{userRecId}/webauthn/credential/{credentialRecId}", apiPrefix), r.URL.Path)
+	if err != nil {
+		panic(err)
+	}
+	user, err := UserRepo.GetUserByRecID(r.Context(), params["userRecId"])
+	if err != nil {
+		fLog.Errorf("UserRepo.GetUserByRecID got %s", err.Error())
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusNotFound, err.Error(), nil, nil)
+		return
+	}
+	if !canManageUser(r.Context(), iauthctx.(*hansipcontext.AuthenticationContext), user) {
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusForbidden, "You don't have the right to access user in the specified tenant", nil, nil)
+		return
+	}
+	revokeWebAuthnCredential(w, r, fLog, user, params["credentialRecId"])
+}
+
+// revokeWebAuthnCredential deletes the credential of the user, it can not authenticate anymore
+func revokeWebAuthnCredential(w http.ResponseWriter, r *http.Request, fLog *log.Entry, user *connector.User, recID string) {
+	cred, ok := userWebAuthnCredential(w, r, fLog, user, recID)
+	if !ok {
+		return
+	}
+	if err := WebAuthnRepo.DeleteWebAuthnCredential(r.Context(), cred); err != nil {
+		fLog.Errorf("WebAuthnRepo.DeleteWebAuthnCredential got %s", err.Error())
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusInternalServerError, err.Error(), nil, nil)
+		return
+	}
+	auditUser(r, "user.webauthn.revoke", user, cred, nil)
+	helper.WriteHTTPResponse(r.Context(), w, http.StatusOK, "Credential revoked", nil, nil)
+}
+
+// Begin2FAWebAuthn serving request for the options to sign the second factor of an authentication with a security key,
+// the user being the one of the 2FA_token responded by Authentication
+func Begin2FAWebAuthn(w http.ResponseWriter, r *http.Request) {
+	fLog := webAuthnLog.WithField("func", "Begin2FAWebAuthn").WithField("RequestID", r.Context().Value(constants.RequestID)).WithField("path", r.URL.Path).WithField("method", r.Method)
+	req := &WebAuthn2FARequest{}
+	if !readJSON(w, r, fLog, req) {
+		return
+	}
+	user, err := UserRepo.GetUserBy2FAToken(r.Context(), req.Token)
+	if len(req.Token) == 0 || err != nil || user == nil || !user.Enable2FactorAuth {
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusNotFound, "2FA token not found", nil, nil)
+		return
+	}
+	if !user.Enabled || user.Suspended {
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusForbidden, "account disabled or suspended", nil, nil)
+		return
+	}
+	creds, err := WebAuthnRepo.ListWebAuthnCredentials(r.Context(), user)
+	if err != nil {
+		fLog.Errorf("WebAuthnRepo.ListWebAuthnCredentials got %s", err.Error())
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusInternalServerError, err.Error(), nil, nil)
+		return
+	}
+	if len(creds) == 0 {
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusNotFound, "no security key registered", nil, nil)
+		return
+	}
+	challenge, err := newWebAuthnChallenge(r.Context(), user, connector.WebAuthnSecondFactor, time.Now())
+	if err != nil {
+		fLog.Errorf("newWebAuthnChallenge got %s", err.Error())
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusInternalServerError, err.Error(), nil, nil)
+		return
+	}
+	options := &webauthn.RequestOptions{
+		Challenge:        challenge,
+		Timeout:          int64(webAuthnTimeout() / time.Millisecond),
+		RPID:             webAuthnRelyingParty().ID,
+		AllowCredentials: webAuthnDescriptors(creds),
+		UserVerification: webAuthnUserVerification(),
+	}
+	helper.WriteHTTPResponse(r.Context(), w, http.StatusOK, "Sign with the security key", nil, &WebAuthnRequestOptions{PublicKey: options})
+}
+
+// Finish2FAWebAuthn validate the security key signature of Begin2FAWebAuthn and authenticate the user, like TwoFA does with an OTP
+func Finish2FAWebAuthn(w http.ResponseWriter, r *http.Request) {
+	fLog := webAuthnLog.WithField("func", "Finish2FAWebAuthn").WithField("RequestID", r.Context().Value(constants.RequestID)).WithField("path", r.URL.Path).WithField("method", r.Method)
+	req := &WebAuthn2FARequest{}
+	if !readJSON(w, r, fLog, req) {
+		return
+	}
+	if req.Credential == nil {
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusBadRequest, "credential is required", nil, nil)
+		return
+	}
+	user, err := UserRepo.GetUserBy2FAToken(r.Context(), req.Token)
+	if len(req.Token) == 0 || err != nil || user == nil || !user.Enable2FactorAuth {
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusNotFound, "2FA token not found", nil, nil)
+		return
+	}
+	settings := userSettings(r.Context(), user)
+	requireUV := webAuthnUserVerification() == webauthn.UserVerificationRequired
+	_, _, err = verifyWebAuthnAssertion(r.Context(), req.Credential, connector.WebAuthnSecondFactor, user, requireUV, time.Now())
+
+	defer UserRepo.UpdateUser(r.Context(), user)
+
+	if err != nil {
+		fLog.Warnf("verifyWebAuthnAssertion got %s", err.Error())
+		if webAuthnErrorStatus(err) == http.StatusUnauthorized {
+			registerAuthenticationFailure(r, "auth.2fa_webauthn", settings, user)
+		}
+		helper.WriteHTTPResponse(r.Context(), w, webAuthnErrorStatus(err), err.Error(), nil, nil)
+		return
+	}
+	if !user.Enabled || user.Suspended {
+		events.Publish(r.Context(), &events.LoginFailed{User: user, Email: user.Email, Method: "auth.2fa_webauthn", Outcome: events.LoginDenied})
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusForbidden, "account disabled or suspended", nil, nil)
+		return
+	}
+
+	// If the signature is valid, reset the user's FailCount
+	user.FailCount = 0
+
+	resp, err := userTokens(r.Context(), settings, user)
+	if err != nil {
+		fLog.Errorf("userTokens got %s", err.Error())
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusInternalServerError, err.Error(), nil, nil)
+		return
+	}
+	events.Publish(r.Context(), &events.LoginSucceeded{User: user, Email: user.Email, Method: "auth.2fa_webauthn"})
+	helper.WriteHTTPResponse(r.Context(), w, http.StatusOK, "Successful", nil, resp)
+}
+
+// BeginWebAuthnLogin serving request for the options to authenticate with a security key or a passkey, without passphrase.
+// With an email the credentials of the user are allowed, without the authenticator offers its discoverable credentials.
+// An unknown email gets options too, so the response does not tell which emails have an account.
+func BeginWebAuthnLogin(w http.ResponseWriter, r *http.Request) {
+	fLog := webAuthnLog.WithField("func", "BeginWebAuthnLogin").WithField("RequestID", r.Context().Value(constants.RequestID)).WithField("path", r.URL.Path).WithField("method", r.Method)
+	req := &WebAuthnLoginRequest{}
+	if !readJSON(w, r, fLog, req) {
+		return
+	}
+	var user *connector.User
+	var creds []*connector.WebAuthnCredential
+	if len(req.Email) > 0 {
+		found, err := UserRepo.GetUserByEmail(r.Context(), req.Email)
+		if err == nil && found != nil {
+			creds, err = WebAuthnRepo.ListWebAuthnCredentials(r.Context(), found)
+			if err != nil {
+				fLog.Errorf("WebAuthnRepo.ListWebAuthnCredentials got %s", err.Error())
+				helper.WriteHTTPResponse(r.Context(), w, http.StatusInternalServerError, err.Error(), nil, nil)
+				return
+			}
+			if len(creds) > 0 {
+				user = found
+			}
+		}
+	}
+	challenge, err := newWebAuthnChallenge(r.Context(), user, connector.WebAuthnLogin, time.Now())
+	if err != nil {
+		fLog.Errorf("newWebAuthnChallenge got %s", err.Error())
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusInternalServerError, err.Error(), nil, nil)
+		return
+	}
+	options := &webauthn.RequestOptions{
+		Challenge:        challenge,
+		Timeout:          int64(webAuthnTimeout() / time.Millisecond),
+		RPID:             webAuthnRelyingParty().ID,
+		AllowCredentials: webAuthnDescriptors(creds),
+		// without passphrase, the authenticator must verify the user to be a second factor of its own
+		UserVerification: webauthn.UserVerificationRequired,
+	}
+	helper.WriteHTTPResponse(r.Context(), w, http.StatusOK, "Sign with the security key", nil, &WebAuthnRequestOptions{PublicKey: options})
+}
+
+// FinishWebAuthnLogin validate the signature of BeginWebAuthnLogin and authenticate the user owning the credential.
+// The authenticator must have verified the user, so 2FA is not asked again.
+func FinishWebAuthnLogin(w http.ResponseWriter, r *http.Request) {
+	fLog := webAuthnLog.WithField("func", "FinishWebAuthnLogin").WithField("RequestID", r.Context().Value(constants.RequestID)).WithField("path", r.URL.Path).WithField("method", r.Method)
+	req := &WebAuthnLoginRequest{}
+	if !readJSON(w, r, fLog, req) {
+		return
+	}
+	if req.Credential == nil {
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusBadRequest, "credential is required", nil, nil)
+		return
+	}
+	user, _, err := verifyWebAuthnAssertion(r.Context(), req.Credential, connector.WebAuthnLogin, nil, true, time.Now())
+	if err != nil {
+		fLog.Warnf("verifyWebAuthnAssertion got %s", err.Error())
+		if webAuthnErrorStatus(err) == http.StatusUnauthorized {
+			if user != nil {
+				registerAuthenticationFailure(r, "auth.webauthn", userSettings(r.Context(), user), user)
+				UserRepo.UpdateUser(r.Context(), user)
+			} else {
+				events.Publish(r.Context(), &events.LoginFailed{Method: "auth.webauthn", Outcome: events.LoginFailure})
+			}
+		}
+		helper.WriteHTTPResponse(r.Context(), w, webAuthnErrorStatus(err), http.StatusText(webAuthnErrorStatus(err)), nil, nil)
+		return
+	}
+	settings := userSettings(r.Context(), user)
+	user.LastLogin = time.Unix(time.Now().Unix(), 0)
+
+	defer UserRepo.UpdateUser(r.Context(), user)
+
+	if !user.Enabled {
+		events.Publish(r.Context(), &events.LoginFailed{User: user, Email: user.Email, Method: "auth.webauthn", Outcome: events.LoginDenied})
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusForbidden, "account disabled", nil, nil)
+		return
+	}
+	if user.Suspended {
+		events.Publish(r.Context(), &events.LoginFailed{User: user, Email: user.Email, Method: "auth.webauthn", Outcome: events.LoginDenied})
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusForbidden, "account suspended", nil, nil)
+		return
+	}
+
+	// If the signature is valid, reset the user's FailCount
+	user.FailCount = 0
+
+	RevocationRepo.UnRevoke(r.Context(), user.Email)
+
+	resp, err := userTokens(r.Context(), settings, user)
+	if err != nil {
+		fLog.Errorf("userTokens got %s", err.Error())
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusInternalServerError, err.Error(), nil, nil)
+		return
+	}
+	events.Publish(r.Context(), &events.LoginSucceeded{User: user, Email: user.Email, Method: "auth.webauthn"})
+	helper.WriteHTTPResponse(r.Context(), w, http.StatusOK, "Successful", nil, resp)
+}
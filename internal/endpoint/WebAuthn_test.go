@@ -0,0 +1,227 @@
+package endpoint
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hyperjumptech/hansip/internal/config"
+	"github.com/hyperjumptech/hansip/internal/connector"
+	"github.com/hyperjumptech/hansip/pkg/webauthn"
+	"github.com/hyperjumptech/hansip/pkg/webauthn/webauthntest"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// memoryWebAuthnRepo keeps the sessions and credentials in memory
+type memoryWebAuthnRepo struct {
+	connector.WebAuthnRepository
+	sessions    map[string]*connector.WebAuthnSession
+	credentials map[string]*connector.WebAuthnCredential
+}
+
+func (r *memoryWebAuthnRepo) SaveWebAuthnSession(ctx context.Context, session *connector.WebAuthnSession) error {
+	r.sessions[session.Challenge] = session
+	return nil
+}
+
+func (r *memoryWebAuthnRepo) ConsumeWebAuthnSession(ctx context.Context, challenge string) (*connector.WebAuthnSession, error) {
+	session, ok := r.sessions[challenge]
+	if !ok {
+		return nil, &connector.ErrDBNoResult{Message: "no session"}
+	}
+	delete(r.sessions, challenge)
+	return session, nil
+}
+
+func (r *memoryWebAuthnRepo) GetWebAuthnCredentialByCredentialID(ctx context.Context, credentialID string) (*connector.WebAuthnCredential, error) {
+	if cred, ok := r.credentials[credentialID]; ok {
+		return cred, nil
+	}
+	return nil, &connector.ErrDBNoResult{Message: "no credential"}
+}
+
+func (r *memoryWebAuthnRepo) UpdateWebAuthnCredential(ctx context.Context, cred *connector.WebAuthnCredential) error {
+	r.credentials[cred.CredentialID] = cred
+	return nil
+}
+
+// fixedUserRepo finds the users it is given by their record id
+type fixedUserRepo struct {
+	connector.UserRepository
+	users map[string]*connector.User
+}
+
+func (r *fixedUserRepo) GetUserByRecID(ctx context.Context, recID string) (*connector.User, error) {
+	if user, ok := r.users[recID]; ok {
+		return user, nil
+	}
+	return nil, &connector.ErrDBNoResult{Message: "no user"}
+}
+
+func TestWebAuthnRelyingParty(t *testing.T) {
+	defer config.Set("webauthn.rp.origins", "http://localhost:3000")
+	config.Set("webauthn.rp.origins", "https://login.example.com, ,https://app.example.com")
+	rp := webAuthnRelyingParty()
+	if len(rp.Origins) != 2 || rp.Origins[0] != "https://login.example.com" || rp.Origins[1] != "https://app.example.com" {
+		t.Errorf("unexpected origins %v", rp.Origins)
+	}
+
+	defer config.Set("webauthn.userverification", "preferred")
+	config.Set("webauthn.userverification", "Required")
+	if uv := webAuthnUserVerification(); uv != webauthn.UserVerificationRequired {
+		t.Errorf("expect required but got %s", uv)
+	}
+	config.Set("webauthn.userverification", "always")
+	if uv := webAuthnUserVerification(); uv != webauthn.UserVerificationPreferred {
+		t.Errorf("expect preferred for an invalid value but got %s", uv)
+	}
+}
+
+func TestWebAuthnName(t *testing.T) {
+	if name, err := webAuthnName("  "); err != nil || name != webAuthnDefaultName {
+		t.Errorf("expect the default name but got %s, %v", name, err)
+	}
+	if name, err := webAuthnName(" Office key "); err != nil || name != "Office key" {
+		t.Errorf("expect the trimmed name but got %s, %v", name, err)
+	}
+	if _, err := webAuthnName(strings.Repeat("k", webAuthnNameMaxLength+1)); err == nil {
+		t.Errorf("a name too long should be rejected")
+	}
+}
+
+func TestVerifyWebAuthnAssertion(t *testing.T) {
+	defer func() { WebAuthnRepo, UserRepo = nil, nil }()
+	repo := &memoryWebAuthnRepo{sessions: make(map[string]*connector.WebAuthnSession), credentials: make(map[string]*connector.WebAuthnCredential)}
+	WebAuthnRepo = repo
+	john := &connector.User{RecID: "john", Email: "john@example.com"}
+	jane := &connector.User{RecID: "jane", Email: "jane@example.com"}
+	UserRepo = &fixedUserRepo{users: map[string]*connector.User{"john": john, "jane": jane}}
+	ctx := context.Background()
+	now := time.Now()
+
+	// registers a credential of john, as FinishWebAuthnRegistration does
+	rp := webAuthnRelyingParty()
+	authenticator := webauthntest.NewAuthenticator(rp.Origins[0])
+	creation := &webauthn.CreationOptions{
+		RP:               webauthn.RelyingPartyEntity{ID: rp.ID, Name: rp.Name},
+		User:             webauthn.UserEntity{ID: []byte(john.RecID), Name: john.Email},
+		Challenge:        []byte("challenge"),
+		PubKeyCredParams: webauthn.CredentialParameters(),
+	}
+	created, err := authenticator.Create(creation)
+	if err != nil {
+		t.Fatalf("Create got %s", err.Error())
+	}
+	verified, err := rp.VerifyRegistration(created, creation.Challenge, true)
+	if err != nil {
+		t.Fatalf("VerifyRegistration got %s", err.Error())
+	}
+	cred := &connector.WebAuthnCredential{RecID: "cred-1", UserRecID: john.RecID, CredentialID: created.ID, PublicKey: verified.PublicKey, Algorithm: verified.Algorithm}
+	repo.credentials[cred.CredentialID] = cred
+
+	sign := func(user *connector.User, ceremony string) *webauthn.CredentialAssertionResponse {
+		challenge, err := newWebAuthnChallenge(ctx, user, ceremony, now)
+		if err != nil {
+			t.Fatalf("newWebAuthnChallenge got %s", err.Error())
+		}
+		assertion, err := authenticator.Get(&webauthn.RequestOptions{Challenge: challenge, RPID: rp.ID})
+		if err != nil {
+			t.Fatalf("Get got %s", err.Error())
+		}
+		return assertion
+	}
+
+	assertion := sign(john, connector.WebAuthnSecondFactor)
+	user, _, err := verifyWebAuthnAssertion(ctx, assertion, connector.WebAuthnSecondFactor, john, false, now)
+	if err != nil || user != john {
+		t.Fatalf("expect john authenticated but got %v, %v", user, err)
+	}
+	if cred.SignCount != 1 || !cred.LastUsed.Equal(now) {
+		t.Errorf("expect the sign count and last use updated but got %+v", cred)
+	}
+	if _, _, err := verifyWebAuthnAssertion(ctx, assertion, connector.WebAuthnSecondFactor, john, false, now); !errors.Is(err, errWebAuthnRejected) {
+		t.Errorf("a challenge should be answered once, got %v", err)
+	}
+
+	assertion = sign(nil, connector.WebAuthnLogin)
+	if user, _, err := verifyWebAuthnAssertion(ctx, assertion, connector.WebAuthnLogin, nil, true, now); err != nil || user != john {
+		t.Errorf("expect john found by the credential but got %v, %v", user, err)
+	}
+
+	assertion = sign(jane, connector.WebAuthnSecondFactor)
+	if _, _, err := verifyWebAuthnAssertion(ctx, assertion, connector.WebAuthnSecondFactor, jane, false, now); !errors.Is(err, errWebAuthnRejected) {
+		t.Errorf("a credential of john should not authenticate jane, got %v", err)
+	}
+
+	assertion = sign(john, connector.WebAuthnLogin)
+	if _, _, err := verifyWebAuthnAssertion(ctx, assertion, connector.WebAuthnSecondFactor, john, false, now); !errors.Is(err, errWebAuthnRejected) {
+		t.Errorf("a challenge of another ceremony should be rejected, got %v", err)
+	}
+
+	assertion = sign(john, connector.WebAuthnSecondFactor)
+	if _, _, err := verifyWebAuthnAssertion(ctx, assertion, connector.WebAuthnSecondFactor, john, false, now.Add(webAuthnTimeout())); !errors.Is(err, errWebAuthnRejected) {
+		t.Errorf("an expired challenge should be rejected, got %v", err)
+	}
+
+	authenticator.UserVerification = false
+	assertion = sign(nil, connector.WebAuthnLogin)
+	if user, _, err := verifyWebAuthnAssertion(ctx, assertion, connector.WebAuthnLogin, nil, true, now); !errors.Is(err, errWebAuthnRejected) || user != john {
+		t.Errorf("a user not verified should be rejected, still knowing the user, got %v, %v", user, err)
+	}
+}
+
+func TestWebAuthnStepUp(t *testing.T) {
+	defer func() { WebAuthnRepo, UserRepo = nil, nil }()
+	repo := &memoryWebAuthnRepo{sessions: make(map[string]*connector.WebAuthnSession), credentials: make(map[string]*connector.WebAuthnCredential)}
+	WebAuthnRepo = repo
+	hashed, _ := bcrypt.GenerateFromPassword([]byte("correct horse"), bcrypt.MinCost)
+	john := &connector.User{RecID: "john", Email: "john@example.com", HashedPassphrase: string(hashed)}
+	UserRepo = &fixedUserRepo{users: map[string]*connector.User{"john": john}}
+	ctx := context.Background()
+	now := time.Now()
+
+	check := func(req *WebAuthnStepUpRequest, expect bool, reason string) {
+		valid, err := webAuthnStepUp(ctx, john, req, now)
+		if err != nil || valid != expect {
+			t.Errorf("%s, got %v, %v", reason, valid, err)
+		}
+	}
+	check(&WebAuthnStepUpRequest{}, false, "an access token alone should not step up")
+	check(&WebAuthnStepUpRequest{Passphrase: "wrong horse"}, false, "a wrong passphrase should be rejected")
+	check(&WebAuthnStepUpRequest{Passphrase: "correct horse"}, true, "the passphrase should step up")
+	check(&WebAuthnStepUpRequest{Otp: "123456", Passphrase: "wrong horse"}, false, "a code should not be checked for a user without 2FA")
+
+	rp := webAuthnRelyingParty()
+	authenticator := webauthntest.NewAuthenticator(rp.Origins[0])
+	creation := &webauthn.CreationOptions{
+		RP:               webauthn.RelyingPartyEntity{ID: rp.ID, Name: rp.Name},
+		User:             webauthn.UserEntity{ID: []byte(john.RecID), Name: john.Email},
+		Challenge:        []byte("challenge"),
+		PubKeyCredParams: webauthn.CredentialParameters(),
+	}
+	created, err := authenticator.Create(creation)
+	if err != nil {
+		t.Fatalf("Create got %s", err.Error())
+	}
+	verified, err := rp.VerifyRegistration(created, creation.Challenge, true)
+	if err != nil {
+		t.Fatalf("VerifyRegistration got %s", err.Error())
+	}
+	repo.credentials[created.ID] = &connector.WebAuthnCredential{RecID: "cred-1", UserRecID: john.RecID, CredentialID: created.ID, PublicKey: verified.PublicKey, Algorithm: verified.Algorithm}
+
+	sign := func(ceremony string) *webauthn.CredentialAssertionResponse {
+		challenge, err := newWebAuthnChallenge(ctx, john, ceremony, now)
+		if err != nil {
+			t.Fatalf("newWebAuthnChallenge got %s", err.Error())
+		}
+		assertion, err := authenticator.Get(&webauthn.RequestOptions{Challenge: challenge, RPID: rp.ID})
+		if err != nil {
+			t.Fatalf("Get got %s", err.Error())
+		}
+		return assertion
+	}
+	check(&WebAuthnStepUpRequest{Credential: sign(connector.WebAuthnStepUp)}, true, "a signature of a registered key should step up")
+	check(&WebAuthnStepUpRequest{Credential: sign(connector.WebAuthnLogin)}, false, "a signature of another ceremony should be rejected")
+}
@@ -0,0 +1,763 @@
+package endpoint
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/hyperjumptech/hansip/internal/config"
+	"github.com/hyperjumptech/hansip/internal/connector"
+	"github.com/hyperjumptech/hansip/internal/constants"
+	"github.com/hyperjumptech/hansip/internal/events"
+	"github.com/hyperjumptech/hansip/pkg/helper"
+	"github.com/hyperjumptech/jiffy"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// WebhookUserCreated is emitted when a user is created, by management, SCIM, invitation or import
+	WebhookUserCreated = "user.created"
+	// WebhookUserActivated is emitted when a user becomes enabled
+	WebhookUserActivated = "user.activated"
+	// WebhookUserSuspended is emitted when a user gets suspended, by management or lockout
+	WebhookUserSuspended = "user.suspended"
+	// WebhookUserDeleted is emitted when a user is deleted
+	WebhookUserDeleted = "user.deleted"
+	// WebhookUserRolesChanged is emitted when the roles directly assigned to a user change
+	WebhookUserRolesChanged = "user.roles_changed"
+
+	// AuditTargetWebhook audit events on webhook subscriptions
+	AuditTargetWebhook = "webhook"
+
+	// webhookBatch is the number of due deliveries fetched at once
+	webhookBatch = 50
+	// webhookMaxBackoff caps the delay between attempts
+	webhookMaxBackoff = 24 * time.Hour
+)
+
+var (
+	webhookLog = log.WithField("go", "Webhook")
+
+	webhookEventTypes = []string{WebhookUserCreated, WebhookUserActivated, WebhookUserSuspended, WebhookUserDeleted, WebhookUserRolesChanged}
+
+	// webhookNudge wakes the dispatcher up when deliveries are queued
+	webhookNudge = make(chan bool, 1)
+	// webhookStop stops StartWebhookDispatcher once closed
+	webhookStop = make(chan bool)
+
+	// errWebhookAddress the receiver resolves to an address webhooks may not be posted to
+	errWebhookAddress = errors.New("webhook receiver address is not allowed")
+
+	// webhookPrivateNetworks are not routed on the internet, besides loopback, link-local and multicast addresses
+	webhookPrivateNetworks = parseNetworks("0.0.0.0/8", "10.0.0.0/8", "100.64.0.0/10", "172.16.0.0/12", "192.0.0.0/24",
+		"192.168.0.0/16", "198.18.0.0/15", "240.0.0.0/4", "fc00::/7")
+)
+
+func parseNetworks(cidrs ...string) []*net.IPNet {
+	ret := make([]*net.IPNet, len(cidrs))
+	for i, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		ret[i] = network
+	}
+	return ret
+}
+
+// WebhookRequest hold model for creating or updating a webhook
+type WebhookRequest struct {
+	URL          string   `json:"url"`
+	Events       []string `json:"events"`
+	Enabled      *bool    `json:"enabled"`
+	Description  string   `json:"description"`
+	RotateSecret bool     `json:"rotate_secret"`
+}
+
+// WebhookPayload is the json body posted to webhooks
+type WebhookPayload struct {
+	ID     string       `json:"id"`
+	Type   string       `json:"type"`
+	Time   time.Time    `json:"time"`
+	Tenant string       `json:"tenant"`
+	Data   *WebhookUser `json:"data"`
+}
+
+// WebhookUser is the user an event is about
+type WebhookUser struct {
+	RecID     string   `json:"rec_id"`
+	Email     string   `json:"email"`
+	Enabled   bool     `json:"enabled"`
+	Suspended bool     `json:"suspended"`
+	Roles     []string `json:"roles,omitempty"`
+}
+
+// webhookBackoff returns the delay before the next attempt after the given number of failed attempts,
+// doubling from base and capped at webhookMaxBackoff
+func webhookBackoff(base time.Duration, attempts int) time.Duration {
+	delay := base
+	for i := 1; i < attempts; i++ {
+		delay *= 2
+		if delay >= webhookMaxBackoff {
+			return webhookMaxBackoff
+		}
+	}
+	return delay
+}
+
+// webhookSubscribed check if the webhook takes events of the type
+func webhookSubscribed(webhook *connector.Webhook, eventType string) bool {
+	if !webhook.Enabled {
+		return false
+	}
+	if len(webhook.Events) == 0 {
+		return true
+	}
+	for _, event := range webhook.Events {
+		if event == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// isPublicIP check if the address is routed on the internet, so a webhook can not reach the hansip host
+// or the internal network through it
+func isPublicIP(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsUnspecified() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() || ip.IsMulticast() {
+		return false
+	}
+	for _, network := range webhookPrivateNetworks {
+		if network.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// webhookDialControl refuses connecting to an address that is not public. It is checked on the resolved
+// address about to be connected, so a host name resolving to an internal address is refused as well.
+func webhookDialControl(network, address string, c syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); ip == nil || !isPublicIP(ip) {
+		return fmt.Errorf("%w, %s is not a public address", errWebhookAddress, host)
+	}
+	return nil
+}
+
+// webhookClient returns the client posting to the receivers. Unless allowPrivate, it only connects to public addresses.
+// Redirects are not followed, they could lead anywhere, and proxies are not used since they would connect instead.
+func webhookClient(timeout time.Duration, allowPrivate bool) *http.Client {
+	dialer := &net.Dialer{Timeout: timeout, KeepAlive: 30 * time.Second}
+	if !allowPrivate {
+		dialer.Control = webhookDialControl
+	}
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: timeout,
+			IdleConnTimeout:     90 * time.Second,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// validateWebhookRequest check the url is absolute http or https and the events are known types.
+// Unless webhook.allow.private, the url may not be localhost or a literal address that is not public.
+func validateWebhookRequest(req *WebhookRequest) error {
+	u, err := url.Parse(req.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || len(u.Host) == 0 {
+		return fmt.Errorf("url must be an absolute http or https url")
+	}
+	if !config.GetBoolean("webhook.allow.private") {
+		host := u.Hostname()
+		if ip := net.ParseIP(host); strings.EqualFold(host, "localhost") || (ip != nil && !isPublicIP(ip)) {
+			return fmt.Errorf("url must be of a public host, %s is not", host)
+		}
+	}
+	for _, event := range req.Events {
+		known := false
+		for _, eventType := range webhookEventTypes {
+			if event == eventType {
+				known = true
+				break
+			}
+		}
+		if !known {
+			return fmt.Errorf("unknown event type %s, supported types are %v", event, webhookEventTypes)
+		}
+	}
+	return nil
+}
+
+// subscribeWebhooks queues the user lifecycle events published on the bus to the subscribed webhooks
+func subscribeWebhooks(bus *events.Bus) {
+	bus.Subscribe(events.TypeUserCreated, func(ctx context.Context, event events.Event) {
+		e := event.(*events.UserCreated)
+		emitTenantsUserEvent(ctx, []*connector.Tenant{e.Tenant}, WebhookUserCreated, e.User)
+	})
+	bus.Subscribe(events.TypeUserDeleted, func(ctx context.Context, event events.Event) {
+		e := event.(*events.UserDeleted)
+		emitTenantsUserEvent(ctx, e.Tenants, WebhookUserDeleted, e.User)
+	})
+	webhookEvents := map[string]string{
+		events.TypeUserActivated:    WebhookUserActivated,
+		events.TypeUserSuspended:    WebhookUserSuspended,
+		events.TypeRoleGranted:      WebhookUserRolesChanged,
+		events.TypeRoleRevoked:      WebhookUserRolesChanged,
+		events.TypeUserRolesChanged: WebhookUserRolesChanged,
+	}
+	for eventType, webhookEvent := range webhookEvents {
+		webhookEvent := webhookEvent
+		bus.Subscribe(eventType, func(ctx context.Context, event events.Event) {
+			emitUserEvent(ctx, webhookEvent, event.(events.UserEvent).Subject())
+		})
+	}
+}
+
+// emitUserEvent queues the event about the user to the subscribed webhooks of every tenant the user is member of
+func emitUserEvent(ctx context.Context, eventType string, user *connector.User) {
+	if WebhookRepo == nil {
+		return
+	}
+	emitTenantsUserEvent(ctx, userTenants(ctx, user), eventType, user)
+}
+
+// emitTenantsUserEvent queues the event about the user to the subscribed webhooks of the tenants.
+// Every delivery of the event shares the event id. Failing to queue is logged, not returned,
+// so the request is served regardless.
+func emitTenantsUserEvent(ctx context.Context, tenants []*connector.Tenant, eventType string, user *connector.User) {
+	if WebhookRepo == nil || len(tenants) == 0 {
+		return
+	}
+	fLog := webhookLog.WithField("func", "emitTenantsUserEvent").WithField("RequestID", ctx.Value(constants.RequestID))
+	data := &WebhookUser{
+		RecID:     user.RecID,
+		Email:     user.Email,
+		Enabled:   user.Enabled,
+		Suspended: user.Suspended,
+	}
+	if eventType == WebhookUserRolesChanged {
+		data.Roles = make([]string, 0)
+		err := allPages(func(request *helper.PageRequest) (int, *helper.Page, error) {
+			roles, page, err := UserRoleRepo.ListUserRoleByUser(ctx, user, request)
+			data.Roles = append(data.Roles, roleNames(roles)...)
+			return len(roles), page, err
+		})
+		if err != nil {
+			fLog.Errorf("UserRoleRepo.ListUserRoleByUser got %s", err.Error())
+		}
+	}
+	eventID := helper.MakeRandomString(20, true, true, true, false)
+	now := time.Now()
+	queued := false
+	for _, tenant := range tenants {
+		webhooks, err := WebhookRepo.ListWebhooks(ctx, tenant)
+		if err != nil {
+			fLog.Errorf("WebhookRepo.ListWebhooks got %s", err.Error())
+			continue
+		}
+		payload, err := json.Marshal(&WebhookPayload{
+			ID:     eventID,
+			Type:   eventType,
+			Time:   now,
+			Tenant: tenant.Domain,
+			Data:   data,
+		})
+		if err != nil {
+			fLog.Errorf("json.Marshal got %s", err.Error())
+			continue
+		}
+		for _, webhook := range webhooks {
+			if !webhookSubscribed(webhook, eventType) {
+				continue
+			}
+			err := WebhookRepo.CreateWebhookDelivery(ctx, &connector.WebhookDelivery{
+				WebhookRecID:  webhook.RecID,
+				EventID:       eventID,
+				EventType:     eventType,
+				Payload:       string(payload),
+				Status:        connector.WebhookDeliveryPending,
+				NextAttemptAt: now,
+			})
+			if err != nil {
+				fLog.Errorf("WebhookRepo.CreateWebhookDelivery got %s", err.Error())
+				continue
+			}
+			queued = true
+		}
+	}
+	if queued {
+		nudgeWebhookDispatcher()
+	}
+}
+
+func nudgeWebhookDispatcher() {
+	select {
+	case webhookNudge <- true:
+	default:
+	}
+}
+
+// postWebhook posts the delivery payload signed with the webhook secret. It returns the response status,
+// 0 if there was no response, and an error unless the receiver responded with 2xx.
+func postWebhook(client *http.Client, webhook *connector.Webhook, delivery *connector.WebhookDelivery) (int, error) {
+	return connector.SignedPost(context.Background(), client, webhook.URL, "Hansip-Webhook", webhook.Secret, map[string]string{
+		"X-Hansip-Event":    delivery.EventType,
+		"X-Hansip-Event-Id": delivery.EventID,
+		"X-Hansip-Delivery": delivery.RecID,
+	}, []byte(delivery.Payload))
+}
+
+// webhookDispatcher attempts due deliveries. Each receiver is delivered to by one worker at a time, in order,
+// so a slow receiver only holds up its own deliveries.
+type webhookDispatcher struct {
+	client      *http.Client
+	maxAttempts int
+	backoff     time.Duration
+	// workers has a slot per receiver being delivered to
+	workers chan bool
+	mutex   sync.Mutex
+	// busy webhooks being delivered to, by rec id
+	busy map[string]bool
+	wait sync.WaitGroup
+}
+
+func newWebhookDispatcher() (*webhookDispatcher, error) {
+	timeout, err := jiffy.DurationOf(config.Get("webhook.timeout"))
+	if err != nil || timeout <= 0 {
+		return nil, fmt.Errorf("invalid webhook.timeout %s", config.Get("webhook.timeout"))
+	}
+	backoff, err := jiffy.DurationOf(config.Get("webhook.retry.backoff"))
+	if err != nil || backoff <= 0 {
+		return nil, fmt.Errorf("invalid webhook.retry.backoff %s", config.Get("webhook.retry.backoff"))
+	}
+	maxAttempts := config.GetInt("webhook.retry.max")
+	if maxAttempts < 1 {
+		maxAttempts = 1
+	}
+	workers := config.GetInt("webhook.workers")
+	if workers < 1 {
+		workers = 1
+	}
+	return &webhookDispatcher{
+		client:      webhookClient(timeout, config.GetBoolean("webhook.allow.private")),
+		maxAttempts: maxAttempts,
+		backoff:     backoff,
+		workers:     make(chan bool, workers),
+		busy:        make(map[string]bool),
+	}, nil
+}
+
+// dispatch hands the due deliveries of every receiver not being delivered to to a free worker, batch by batch.
+// The deliveries are claimed before so they are not attempted twice when several instances of hansip share the database.
+// It returns without waiting for the deliveries, a worker nudges the dispatcher once done.
+func (d *webhookDispatcher) dispatch(ctx context.Context) {
+	fLog := webhookLog.WithField("func", "webhookDispatcher.dispatch")
+	for {
+		deliveries, err := WebhookRepo.ListDueWebhookDeliveries(ctx, time.Now(), webhookBatch)
+		if err != nil {
+			fLog.Errorf("WebhookRepo.ListDueWebhookDeliveries got %s", err.Error())
+			return
+		}
+		order := make([]string, 0)
+		receivers := make(map[string][]*connector.WebhookDelivery)
+		for _, delivery := range deliveries {
+			if d.isBusy(delivery.WebhookRecID) {
+				continue
+			}
+			if _, ok := receivers[delivery.WebhookRecID]; !ok {
+				order = append(order, delivery.WebhookRecID)
+			}
+			receivers[delivery.WebhookRecID] = append(receivers[delivery.WebhookRecID], delivery)
+		}
+		claimed := 0
+		for _, webhookRecID := range order {
+			select {
+			case d.workers <- true:
+			default:
+				// every worker is busy
+				return
+			}
+			// the deliveries are attempted one after another, each may take the timeout
+			until := time.Now().Add(time.Duration(len(receivers[webhookRecID])+1)*d.client.Timeout + time.Minute)
+			queue := make([]*connector.WebhookDelivery, 0)
+			for _, delivery := range receivers[webhookRecID] {
+				ok, err := WebhookRepo.ClaimWebhookDelivery(ctx, delivery, until)
+				if err != nil {
+					fLog.Errorf("WebhookRepo.ClaimWebhookDelivery got %s", err.Error())
+					continue
+				}
+				if ok {
+					queue = append(queue, delivery)
+				}
+			}
+			if len(queue) == 0 {
+				<-d.workers
+				continue
+			}
+			claimed += len(queue)
+			d.setBusy(webhookRecID, true)
+			d.wait.Add(1)
+			go func(webhookRecID string, queue []*connector.WebhookDelivery) {
+				defer d.wait.Done()
+				for _, delivery := range queue {
+					d.attempt(ctx, delivery)
+				}
+				d.setBusy(webhookRecID, false)
+				<-d.workers
+				nudgeWebhookDispatcher()
+			}(webhookRecID, queue)
+		}
+		if len(deliveries) < webhookBatch || claimed == 0 {
+			return
+		}
+	}
+}
+
+func (d *webhookDispatcher) isBusy(webhookRecID string) bool {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	return d.busy[webhookRecID]
+}
+
+func (d *webhookDispatcher) setBusy(webhookRecID string, busy bool) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if busy {
+		d.busy[webhookRecID] = true
+	} else {
+		delete(d.busy, webhookRecID)
+	}
+}
+
+// attempt posts the delivery once and records the outcome, scheduling a retry or failing the delivery
+// once it ran out of attempts
+func (d *webhookDispatcher) attempt(ctx context.Context, delivery *connector.WebhookDelivery) {
+	fLog := webhookLog.WithField("func", "webhookDispatcher.attempt")
+	webhook, err := WebhookRepo.GetWebhookByRecID(ctx, delivery.WebhookRecID)
+	if err != nil {
+		fLog.Errorf("WebhookRepo.GetWebhookByRecID got %s", err.Error())
+		return
+	}
+	status, err := postWebhook(d.client, webhook, delivery)
+	delivery.Attempts++
+	delivery.ResponseStatus = status
+	if err == nil {
+		delivery.Status = connector.WebhookDeliveryDelivered
+		delivery.LastError = ""
+	} else {
+		delivery.LastError = err.Error()
+		if delivery.Attempts >= d.maxAttempts {
+			fLog.Warnf("Delivery %s of %s to %s failed after %d attempts, %s", delivery.RecID, delivery.EventType, webhook.URL, delivery.Attempts, err.Error())
+			delivery.Status = connector.WebhookDeliveryFailed
+		} else {
+			delivery.Status = connector.WebhookDeliveryPending
+			delivery.NextAttemptAt = time.Now().Add(webhookBackoff(d.backoff, delivery.Attempts))
+		}
+	}
+	if err := WebhookRepo.UpdateWebhookDelivery(ctx, delivery); err != nil {
+		fLog.Errorf("WebhookRepo.UpdateWebhookDelivery got %s", err.Error())
+	}
+}
+
+// StartWebhookDispatcher delivers due webhook deliveries every webhook.poll.interval, and right away when
+// events are queued, until StopWebhookDispatcher is called. It returns right away if the interval is 0.
+func StartWebhookDispatcher() {
+	fLog := webhookLog.WithField("func", "StartWebhookDispatcher")
+	interval, err := jiffy.DurationOf(config.Get("webhook.poll.interval"))
+	if err != nil || interval <= 0 {
+		fLog.Warnf("Webhook delivery is disabled, webhook.poll.interval is %s", config.Get("webhook.poll.interval"))
+		return
+	}
+	dispatcher, err := newWebhookDispatcher()
+	if err != nil {
+		fLog.Errorf("Webhook delivery is disabled, %s", err.Error())
+		return
+	}
+	fLog.Infof("Webhook delivery every %s", interval.String())
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			dispatcher.dispatch(context.Background())
+		case <-webhookNudge:
+			dispatcher.dispatch(context.Background())
+		case <-webhookStop:
+			dispatcher.wait.Wait()
+			fLog.Info("Webhook delivery stopped")
+			return
+		}
+	}
+}
+
+// StopWebhookDispatcher stops StartWebhookDispatcher
+func StopWebhookDispatcher() {
+	close(webhookStop)
+}
+
+// webhookView returns the webhook without its secret, unless withSecret
+func webhookView(webhook *connector.Webhook, withSecret bool) *connector.Webhook {
+	ret := *webhook
+	if !withSecret {
+		ret.Secret = ""
+	}
+	return &ret
+}
+
+// tenantWebhook loads the webhook of the tenant.
+// If it fails, it writes the error response and returns nil.
+func tenantWebhook(w http.ResponseWriter, r *http.Request, tenant *connector.Tenant, recID string) *connector.Webhook {
+	webhook, err := WebhookRepo.GetWebhookByRecID(r.Context(), recID)
+	if err != nil || webhook.TenantRecID != tenant.RecID {
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusNotFound, fmt.Sprintf("webhook %s not found in tenant %s", recID, tenant.Domain), nil, nil)
+		return nil
+	}
+	return webhook
+}
+
+// readWebhookRequest reads and validates the webhook definition in the request body.
+// If it fails, it writes the error response and returns nil.
+func readWebhookRequest(w http.ResponseWriter, r *http.Request) *WebhookRequest {
+	fLog := webhookLog.WithField("func", "readWebhookRequest").WithField("RequestID", r.Context().Value(constants.RequestID)).WithField("path", r.URL.Path).WithField("method", r.Method)
+	req := &WebhookRequest{}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		fLog.Errorf("ioutil.ReadAll got %s", err.Error())
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusInternalServerError, err.Error(), nil, nil)
+		return nil
+	}
+	err = json.Unmarshal(body, req)
+	if err != nil {
+		fLog.Errorf("json.Unmarshal got %s", err.Error())
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusBadRequest, err.Error(), nil, nil)
+		return nil
+	}
+	if err := validateWebhookRequest(req); err != nil {
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusBadRequest, err.Error(), nil, nil)
+		return nil
+	}
+	if req.Events == nil {
+		req.Events = make([]string, 0)
+	}
+	return req
+}
+
+func auditWebhook(r *http.Request, event string, tenant *connector.Tenant, webhook *connector.Webhook, before, after interface{}) {
+	audit(r, &connector.AuditEvent{
+		Event:        event,
+		TargetType:   AuditTargetWebhook,
+		Target:       webhook.RecID,
+		TenantDomain: tenant.Domain,
+	}, before, after)
+}
+
+// ListWebhooks serving request to list the webhooks of a tenant
+func ListWebhooks(w http.ResponseWriter, r *http.Request) {
+	fLog := webhookLog.WithField("func", "ListWebhooks").WithField("RequestID", r.Context().Value(constants.RequestID)).WithField("path", r.URL.Path).WithField("method", r.Method)
+	tenant, _ := adminTenant(w, r, "/management/tenant/{tenantRecId}/webhooks")
+	if tenant == nil {
+		return
+	}
+	webhooks, err := WebhookRepo.ListWebhooks(r.Context(), tenant)
+	if err != nil {
+		fLog.Errorf("WebhookRepo.ListWebhooks got %s", err.Error())
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusInternalServerError, err.Error(), nil, nil)
+		return
+	}
+	ret := make([]*connector.Webhook, len(webhooks))
+	for i, webhook := range webhooks {
+		ret[i] = webhookView(webhook, false)
+	}
+	helper.WriteHTTPResponse(r.Context(), w, http.StatusOK, "List of webhooks", nil, ret)
+}
+
+// CreateWebhook serving request to subscribe a webhook to the events of a tenant.
+// The signing secret is generated and only returned in this response.
+func CreateWebhook(w http.ResponseWriter, r *http.Request) {
+	fLog := webhookLog.WithField("func", "CreateWebhook").WithField("RequestID", r.Context().Value(constants.RequestID)).WithField("path", r.URL.Path).WithField("method", r.Method)
+	tenant, _ := adminTenant(w, r, "/management/tenant/{tenantRecId}/webhook")
+	if tenant == nil {
+		return
+	}
+	req := readWebhookRequest(w, r)
+	if req == nil {
+		return
+	}
+	secret, err := helper.MakeSecretString(32)
+	if err != nil {
+		fLog.Errorf("helper.MakeSecretString got %s", err.Error())
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusInternalServerError, err.Error(), nil, nil)
+		return
+	}
+	webhook := &connector.Webhook{
+		TenantRecID: tenant.RecID,
+		URL:         req.URL,
+		Secret:      secret,
+		Events:      req.Events,
+		Enabled:     req.Enabled == nil || *req.Enabled,
+		Description: req.Description,
+	}
+	err = WebhookRepo.CreateWebhook(r.Context(), webhook)
+	if err != nil {
+		fLog.Errorf("WebhookRepo.CreateWebhook got %s", err.Error())
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusInternalServerError, err.Error(), nil, nil)
+		return
+	}
+	auditWebhook(r, "webhook.create", tenant, webhook, nil, webhook)
+	helper.WriteHTTPResponse(r.Context(), w, http.StatusOK, "Success creating webhook", nil, webhookView(webhook, true))
+}
+
+// GetWebhook serving request to fetch a webhook of a tenant
+func GetWebhook(w http.ResponseWriter, r *http.Request) {
+	tenant, params := adminTenant(w, r, "/management/tenant/{tenantRecId}/webhook/{webhookRecId}")
+	if tenant == nil {
+		return
+	}
+	webhook := tenantWebhook(w, r, tenant, params["webhookRecId"])
+	if webhook == nil {
+		return
+	}
+	helper.WriteHTTPResponse(r.Context(), w, http.StatusOK, "Webhook retrieved", nil, webhookView(webhook, false))
+}
+
+// UpdateWebhook serving request to update a webhook of a tenant. The new secret is returned if it was rotated.
+func UpdateWebhook(w http.ResponseWriter, r *http.Request) {
+	fLog := webhookLog.WithField("func", "UpdateWebhook").WithField("RequestID", r.Context().Value(constants.RequestID)).WithField("path", r.URL.Path).WithField("method", r.Method)
+	tenant, params := adminTenant(w, r, "/management/tenant/{tenantRecId}/webhook/{webhookRecId}")
+	if tenant == nil {
+		return
+	}
+	webhook := tenantWebhook(w, r, tenant, params["webhookRecId"])
+	if webhook == nil {
+		return
+	}
+	req := readWebhookRequest(w, r)
+	if req == nil {
+		return
+	}
+	before := *webhook
+	webhook.URL = req.URL
+	webhook.Events = req.Events
+	webhook.Enabled = req.Enabled == nil || *req.Enabled
+	webhook.Description = req.Description
+	if req.RotateSecret {
+		secret, err := helper.MakeSecretString(32)
+		if err != nil {
+			fLog.Errorf("helper.MakeSecretString got %s", err.Error())
+			helper.WriteHTTPResponse(r.Context(), w, http.StatusInternalServerError, err.Error(), nil, nil)
+			return
+		}
+		webhook.Secret = secret
+	}
+	err := WebhookRepo.UpdateWebhook(r.Context(), webhook)
+	if err != nil {
+		fLog.Errorf("WebhookRepo.UpdateWebhook got %s", err.Error())
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusInternalServerError, err.Error(), nil, nil)
+		return
+	}
+	auditWebhook(r, "webhook.update", tenant, webhook, &before, webhook)
+	helper.WriteHTTPResponse(r.Context(), w, http.StatusOK, "Webhook updated", nil, webhookView(webhook, req.RotateSecret))
+}
+
+// DeleteWebhook serving request to delete a webhook of a tenant along with its deliveries
+func DeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	fLog := webhookLog.WithField("func", "DeleteWebhook").WithField("RequestID", r.Context().Value(constants.RequestID)).WithField("path", r.URL.Path).WithField("method", r.Method)
+	tenant, params := adminTenant(w, r, "/management/tenant/{tenantRecId}/webhook/{webhookRecId}")
+	if tenant == nil {
+		return
+	}
+	webhook := tenantWebhook(w, r, tenant, params["webhookRecId"])
+	if webhook == nil {
+		return
+	}
+	err := WebhookRepo.DeleteWebhook(r.Context(), webhook)
+	if err != nil {
+		fLog.Errorf("WebhookRepo.DeleteWebhook got %s", err.Error())
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusInternalServerError, err.Error(), nil, nil)
+		return
+	}
+	auditWebhook(r, "webhook.delete", tenant, webhook, webhook, nil)
+	helper.WriteHTTPResponse(r.Context(), w, http.StatusOK, "Webhook deleted", nil, nil)
+}
+
+// ListWebhookDeliveries serving request to list the deliveries of a webhook, the delivery log
+func ListWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	fLog := webhookLog.WithField("func", "ListWebhookDeliveries").WithField("RequestID", r.Context().Value(constants.RequestID)).WithField("path", r.URL.Path).WithField("method", r.Method)
+	tenant, params := adminTenant(w, r, "/management/tenant/{tenantRecId}/webhook/{webhookRecId}/deliveries")
+	if tenant == nil {
+		return
+	}
+	webhook := tenantWebhook(w, r, tenant, params["webhookRecId"])
+	if webhook == nil {
+		return
+	}
+	pageRequest, err := helper.NewPageRequestFromRequest(r)
+	if err != nil {
+		fLog.Errorf("helper.NewPageRequestFromRequest got %s", err.Error())
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusBadRequest, err.Error(), nil, nil)
+		return
+	}
+	deliveries, page, err := WebhookRepo.ListWebhookDeliveries(r.Context(), webhook, pageRequest)
+	if err != nil {
+		fLog.Errorf("WebhookRepo.ListWebhookDeliveries got %s", err.Error())
+		helper.WriteHTTPResponse(r.Context(), w, listErrorStatus(err), err.Error(), nil, nil)
+		return
+	}
+	ret := make(map[string]interface{})
+	ret["deliveries"] = deliveries
+	ret["page"] = page
+	helper.WriteHTTPResponse(r.Context(), w, http.StatusOK, "List of webhook deliveries paginated", nil, ret)
+}
+
+// RedeliverWebhook serving request to deliver the event of a past delivery again. A new delivery with the
+// same event id and payload is queued, so the receiver can tell it apart from a new event.
+func RedeliverWebhook(w http.ResponseWriter, r *http.Request) {
+	fLog := webhookLog.WithField("func", "RedeliverWebhook").WithField("RequestID", r.Context().Value(constants.RequestID)).WithField("path", r.URL.Path).WithField("method", r.Method)
+	tenant, params := adminTenant(w, r, "/management/tenant/{tenantRecId}/webhook/{webhookRecId}/delivery/{deliveryRecId}/redeliver")
+	if tenant == nil {
+		return
+	}
+	webhook := tenantWebhook(w, r, tenant, params["webhookRecId"])
+	if webhook == nil {
+		return
+	}
+	delivery, err := WebhookRepo.GetWebhookDeliveryByRecID(r.Context(), params["deliveryRecId"])
+	if err != nil || delivery.WebhookRecID != webhook.RecID {
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusNotFound, fmt.Sprintf("delivery %s not found in webhook %s", params["deliveryRecId"], webhook.RecID), nil, nil)
+		return
+	}
+	redelivery := &connector.WebhookDelivery{
+		WebhookRecID:  webhook.RecID,
+		EventID:       delivery.EventID,
+		EventType:     delivery.EventType,
+		Payload:       delivery.Payload,
+		Status:        connector.WebhookDeliveryPending,
+		NextAttemptAt: time.Now(),
+	}
+	err = WebhookRepo.CreateWebhookDelivery(r.Context(), redelivery)
+	if err != nil {
+		fLog.Errorf("WebhookRepo.CreateWebhookDelivery got %s", err.Error())
+		helper.WriteHTTPResponse(r.Context(), w, http.StatusInternalServerError, err.Error(), nil, nil)
+		return
+	}
+	nudgeWebhookDispatcher()
+	auditWebhook(r, "webhook.redeliver", tenant, webhook, nil, map[string]interface{}{"event_id": delivery.EventID, "delivery": redelivery.RecID})
+	helper.WriteHTTPResponse(r.Context(), w, http.StatusOK, "Redelivery queued", nil, redelivery)
+}
@@ -0,0 +1,265 @@
+package endpoint
+
+import (
+	"context"
+	"crypto/hmac"
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hyperjumptech/hansip/internal/connector"
+)
+
+func TestWebhookBackoff(t *testing.T) {
+	testData := []struct {
+		attempts int
+		expect   time.Duration
+	}{
+		{1, 30 * time.Second},
+		{2, time.Minute},
+		{3, 2 * time.Minute},
+		{8, 64 * time.Minute},
+		{20, webhookMaxBackoff},
+	}
+	for _, td := range testData {
+		if got := webhookBackoff(30*time.Second, td.attempts); got != td.expect {
+			t.Errorf("attempt %d expect %s but %s", td.attempts, td.expect, got)
+		}
+	}
+}
+
+func TestWebhookSubscribed(t *testing.T) {
+	all := &connector.Webhook{Enabled: true, Events: []string{}}
+	some := &connector.Webhook{Enabled: true, Events: []string{WebhookUserCreated, WebhookUserDeleted}}
+	disabled := &connector.Webhook{Enabled: false}
+	if !webhookSubscribed(all, WebhookUserRolesChanged) {
+		t.Errorf("expect webhook without events subscribed to every event")
+	}
+	if !webhookSubscribed(some, WebhookUserDeleted) || webhookSubscribed(some, WebhookUserSuspended) {
+		t.Errorf("expect webhook subscribed to its events only")
+	}
+	if webhookSubscribed(disabled, WebhookUserCreated) {
+		t.Errorf("expect disabled webhook not subscribed")
+	}
+}
+
+func TestValidateWebhookRequest(t *testing.T) {
+	testData := []struct {
+		req   *WebhookRequest
+		valid bool
+	}{
+		{&WebhookRequest{URL: "https://example.com/hook"}, true},
+		{&WebhookRequest{URL: "http://example.com:8080/hook", Events: []string{WebhookUserCreated, WebhookUserRolesChanged}}, true},
+		{&WebhookRequest{URL: "ftp://example.com/hook"}, false},
+		{&WebhookRequest{URL: "/hook"}, false},
+		{&WebhookRequest{URL: "https://example.com/hook", Events: []string{"user.renamed"}}, false},
+		{&WebhookRequest{URL: "http://localhost:8080/hook"}, false},
+		{&WebhookRequest{URL: "http://127.0.0.1/hook"}, false},
+		{&WebhookRequest{URL: "http://169.254.169.254/latest/meta-data"}, false},
+		{&WebhookRequest{URL: "http://[::1]:8080/hook"}, false},
+		{&WebhookRequest{URL: "https://93.184.216.34/hook"}, true},
+	}
+	for i, td := range testData {
+		if err := validateWebhookRequest(td.req); (err == nil) != td.valid {
+			t.Errorf("#%d expect valid %v but %v", i, td.valid, err)
+		}
+	}
+}
+
+func TestChangedUsers(t *testing.T) {
+	a, b, c := &connector.User{RecID: "a"}, &connector.User{RecID: "b"}, &connector.User{RecID: "c"}
+	changed := changedUsers([]*connector.User{a, b}, []*connector.User{b, c})
+	if len(changed) != 2 || changed[0] != a || changed[1] != c {
+		t.Errorf("expect a and c changed but %v", changed)
+	}
+	if changed = changedUsers([]*connector.User{a}, []*connector.User{a}); len(changed) != 0 {
+		t.Errorf("expect nothing changed but %v", changed)
+	}
+}
+
+func TestPostWebhook(t *testing.T) {
+	var header http.Header
+	var body []byte
+	status := http.StatusNoContent
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header
+		body, _ = ioutil.ReadAll(r.Body)
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	webhook := &connector.Webhook{URL: server.URL, Secret: "secret"}
+	delivery := &connector.WebhookDelivery{RecID: "d1", EventID: "e1", EventType: WebhookUserCreated, Payload: `{"id":"e1"}`}
+	got, err := postWebhook(server.Client(), webhook, delivery)
+	if err != nil || got != http.StatusNoContent {
+		t.Fatalf("expect delivered but %d %v", got, err)
+	}
+	if string(body) != delivery.Payload || header.Get("X-Hansip-Event") != WebhookUserCreated || header.Get("X-Hansip-Delivery") != "d1" {
+		t.Errorf("expect payload and headers posted but %s %v", body, header)
+	}
+	expect := "sha256=" + connector.PayloadSignature("secret", header.Get("X-Hansip-Timestamp"), body)
+	if !hmac.Equal([]byte(header.Get("X-Hansip-Signature")), []byte(expect)) {
+		t.Errorf("expect signature %s but %s", expect, header.Get("X-Hansip-Signature"))
+	}
+
+	status = http.StatusInternalServerError
+	if got, err = postWebhook(server.Client(), webhook, delivery); err == nil || got != http.StatusInternalServerError {
+		t.Errorf("expect failed delivery on 500 but %d %v", got, err)
+	}
+}
+
+func TestIsPublicIP(t *testing.T) {
+	testData := []struct {
+		ip     string
+		public bool
+	}{
+		{"93.184.216.34", true},
+		{"2606:2800:220:1:248:1893:25c8:1946", true},
+		{"127.0.0.1", false},
+		{"10.1.2.3", false},
+		{"172.20.0.1", false},
+		{"192.168.1.1", false},
+		{"100.64.0.1", false},
+		{"169.254.169.254", false},
+		{"0.0.0.0", false},
+		{"::1", false},
+		{"fe80::1", false},
+		{"fd00::1", false},
+		{"::ffff:10.0.0.1", false},
+		{"224.0.0.1", false},
+	}
+	for _, td := range testData {
+		if got := isPublicIP(net.ParseIP(td.ip)); got != td.public {
+			t.Errorf("%s expect public %v but %v", td.ip, td.public, got)
+		}
+	}
+}
+
+func TestWebhookClient(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/elsewhere", http.StatusFound)
+	}))
+	defer server.Close()
+	webhook := &connector.Webhook{URL: server.URL, Secret: "secret"}
+	delivery := &connector.WebhookDelivery{RecID: "d1", EventID: "e1", EventType: WebhookUserCreated, Payload: `{"id":"e1"}`}
+
+	if _, err := postWebhook(webhookClient(time.Second, false), webhook, delivery); !errors.Is(err, errWebhookAddress) {
+		t.Errorf("expect the loopback receiver refused but %v", err)
+	}
+	if got, err := postWebhook(webhookClient(time.Second, true), webhook, delivery); err == nil || got != http.StatusFound {
+		t.Errorf("expect the redirect not followed and the delivery failed but %d %v", got, err)
+	}
+}
+
+// memoryDeliveries keeps the webhooks and their deliveries in memory
+type memoryDeliveries struct {
+	connector.WebhookRepository
+	mutex      sync.Mutex
+	webhooks   map[string]*connector.Webhook
+	deliveries []*connector.WebhookDelivery
+}
+
+func (m *memoryDeliveries) ListDueWebhookDeliveries(ctx context.Context, due time.Time, limit int) ([]*connector.WebhookDelivery, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	ret := make([]*connector.WebhookDelivery, 0)
+	for _, delivery := range m.deliveries {
+		if delivery.Status == connector.WebhookDeliveryPending && !delivery.NextAttemptAt.After(due) && len(ret) < limit {
+			copied := *delivery
+			ret = append(ret, &copied)
+		}
+	}
+	return ret, nil
+}
+
+func (m *memoryDeliveries) ClaimWebhookDelivery(ctx context.Context, delivery *connector.WebhookDelivery, until time.Time) (bool, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	for _, stored := range m.deliveries {
+		if stored.RecID == delivery.RecID && stored.NextAttemptAt.Equal(delivery.NextAttemptAt) {
+			stored.NextAttemptAt = until
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (m *memoryDeliveries) GetWebhookByRecID(ctx context.Context, recID string) (*connector.Webhook, error) {
+	return m.webhooks[recID], nil
+}
+
+func (m *memoryDeliveries) UpdateWebhookDelivery(ctx context.Context, delivery *connector.WebhookDelivery) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	for i, stored := range m.deliveries {
+		if stored.RecID == delivery.RecID {
+			copied := *delivery
+			m.deliveries[i] = &copied
+		}
+	}
+	return nil
+}
+
+func (m *memoryDeliveries) status(recID string) string {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	for _, stored := range m.deliveries {
+		if stored.RecID == recID {
+			return stored.Status
+		}
+	}
+	return ""
+}
+
+func TestWebhookDispatcherSlowReceiver(t *testing.T) {
+	defer func() { WebhookRepo = nil }()
+	release := make(chan bool)
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer slow.Close()
+	defer close(release)
+	fast := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer fast.Close()
+	repo := &memoryDeliveries{
+		webhooks: map[string]*connector.Webhook{
+			"slow": {RecID: "slow", URL: slow.URL},
+			"fast": {RecID: "fast", URL: fast.URL},
+		},
+		deliveries: []*connector.WebhookDelivery{
+			{RecID: "s1", WebhookRecID: "slow", Status: connector.WebhookDeliveryPending},
+			{RecID: "s2", WebhookRecID: "slow", Status: connector.WebhookDeliveryPending},
+			{RecID: "f1", WebhookRecID: "fast", Status: connector.WebhookDeliveryPending},
+		},
+	}
+	WebhookRepo = repo
+	d := &webhookDispatcher{
+		client:      webhookClient(5*time.Second, true),
+		maxAttempts: 3,
+		backoff:     time.Minute,
+		workers:     make(chan bool, 2),
+		busy:        make(map[string]bool),
+	}
+	d.dispatch(context.Background())
+	deadline := time.Now().Add(3 * time.Second)
+	for repo.status("f1") != connector.WebhookDeliveryDelivered && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if repo.status("f1") != connector.WebhookDeliveryDelivered {
+		t.Errorf("expect the fast receiver delivered while the slow one hangs")
+	}
+	if !d.isBusy("slow") || repo.status("s2") != connector.WebhookDeliveryPending {
+		t.Errorf("expect the slow receiver still being delivered to, in order")
+	}
+	release <- true
+	release <- true
+	d.wait.Wait()
+	if repo.status("s1") != connector.WebhookDeliveryDelivered || repo.status("s2") != connector.WebhookDeliveryDelivered {
+		t.Errorf("expect the slow receiver delivered eventually but %s %s", repo.status("s1"), repo.status("s2"))
+	}
+}
@@ -0,0 +1,91 @@
+package events
+
+import (
+	"context"
+	"sync"
+
+	"github.com/hyperjumptech/hansip/internal/constants"
+	log "github.com/sirupsen/logrus"
+)
+
+// AllEvents subscribes a handler to every event type
+const AllEvents = "*"
+
+var (
+	busLogger = log.WithField("go", "EventBus")
+
+	// Default is the bus the handlers publish to and the side effects subscribe to
+	Default = NewBus()
+)
+
+// Event is published on the bus, its type tells the subscribers what happened
+type Event interface {
+	EventType() string
+}
+
+// Handler handles a published event
+type Handler func(ctx context.Context, event Event)
+
+// Bus is an in-process publish/subscribe event bus. Events are handed to the subscribers synchronously,
+// in the order they subscribed, so a subscriber sees the request context and the changes of earlier subscribers.
+type Bus struct {
+	mutex    sync.RWMutex
+	handlers map[string][]Handler
+}
+
+// NewBus creates a bus without subscribers
+func NewBus() *Bus {
+	return &Bus{handlers: make(map[string][]Handler)}
+}
+
+// Subscribe the handler to events of the type, or to every event if the type is AllEvents
+func (b *Bus) Subscribe(eventType string, handler Handler) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.handlers[eventType] = append(b.handlers[eventType], handler)
+}
+
+// Subscribed check if any handler takes events of the type, so publishers can skip preparing unwanted events
+func (b *Bus) Subscribed(eventType string) bool {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+	return len(b.handlers[eventType]) > 0 || len(b.handlers[AllEvents]) > 0
+}
+
+// Publish hands the event to every subscriber of its type then to the subscribers of all events.
+// A panicking subscriber is logged and does not keep the event from the others.
+// Subscribers may publish further events.
+func (b *Bus) Publish(ctx context.Context, event Event) {
+	b.mutex.RLock()
+	handlers := make([]Handler, 0, len(b.handlers[event.EventType()])+len(b.handlers[AllEvents]))
+	handlers = append(handlers, b.handlers[event.EventType()]...)
+	handlers = append(handlers, b.handlers[AllEvents]...)
+	b.mutex.RUnlock()
+	for _, handler := range handlers {
+		b.handle(ctx, handler, event)
+	}
+}
+
+func (b *Bus) handle(ctx context.Context, handler Handler, event Event) {
+	defer func() {
+		if r := recover(); r != nil {
+			busLogger.WithField("func", "Bus.Publish").WithField("RequestID", ctx.Value(constants.RequestID)).Errorf("subscriber of %s panicked, %v", event.EventType(), r)
+		}
+	}()
+	handler(ctx, event)
+}
+
+// Subscribe the handler to events of the type on the default bus
+func Subscribe(eventType string, handler Handler) {
+	Default.Subscribe(eventType, handler)
+}
+
+// Subscribed check if any handler of the default bus takes events of the type
+func Subscribed(eventType string) bool {
+	return Default.Subscribed(eventType)
+}
+
+// Publish the event on the default bus
+func Publish(ctx context.Context, event Event) {
+	Default.Publish(ctx, event)
+}
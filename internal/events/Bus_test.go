@@ -0,0 +1,72 @@
+package events
+
+import (
+	"context"
+	"testing"
+
+	"github.com/hyperjumptech/hansip/internal/connector"
+)
+
+func TestBusPublish(t *testing.T) {
+	bus := NewBus()
+	got := make([]string, 0)
+	bus.Subscribe(AllEvents, func(ctx context.Context, event Event) {
+		got = append(got, "all "+event.EventType())
+	})
+	bus.Subscribe(TypeUserCreated, func(ctx context.Context, event Event) {
+		got = append(got, "first "+event.EventType())
+	})
+	bus.Subscribe(TypeUserCreated, func(ctx context.Context, event Event) {
+		panic("boom")
+	})
+	bus.Subscribe(TypeUserCreated, func(ctx context.Context, event Event) {
+		got = append(got, "second "+event.EventType())
+		bus.Publish(ctx, &UserActivated{User: event.(UserEvent).Subject()})
+	})
+
+	bus.Publish(context.Background(), &UserCreated{User: &connector.User{RecID: "abc"}})
+
+	want := []string{"first user.created", "second user.created", "all user.activated", "all user.created"}
+	if len(got) != len(want) {
+		t.Fatalf("expect %v but %v", want, got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("expect %v but %v", want, got)
+			break
+		}
+	}
+}
+
+func TestBusSubscribed(t *testing.T) {
+	bus := NewBus()
+	if bus.Subscribed(TypeUserDeleted) {
+		t.Errorf("expect no subscriber")
+	}
+	bus.Subscribe(TypeUserCreated, func(ctx context.Context, event Event) {})
+	if !bus.Subscribed(TypeUserCreated) || bus.Subscribed(TypeUserDeleted) {
+		t.Errorf("expect only user.created subscribed")
+	}
+	bus.Subscribe(AllEvents, func(ctx context.Context, event Event) {})
+	if !bus.Subscribed(TypeUserDeleted) {
+		t.Errorf("expect every type subscribed")
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	bus := NewBus()
+	metrics := NewMetrics()
+	bus.Subscribe(AllEvents, metrics.Count)
+	bus.Publish(context.Background(), &LoginFailed{Email: "a@b.c"})
+	bus.Publish(context.Background(), &LoginFailed{Email: "a@b.c"})
+	bus.Publish(context.Background(), &LoginSucceeded{Email: "a@b.c"})
+
+	counts := metrics.Counts()
+	if counts[TypeLoginFailed] != 2 || counts[TypeLoginSucceeded] != 1 || len(counts) != 2 {
+		t.Errorf("unexpected counts %v", counts)
+	}
+	counts[TypeLoginFailed] = 10
+	if metrics.Counts()[TypeLoginFailed] != 2 {
+		t.Errorf("expect counts to be a copy")
+	}
+}
@@ -0,0 +1,228 @@
+package events
+
+import (
+	"github.com/hyperjumptech/hansip/internal/config"
+	"github.com/hyperjumptech/hansip/internal/connector"
+)
+
+// event types
+const (
+	// TypeUserCreated a user was created
+	TypeUserCreated = "user.created"
+	// TypeUserActivated a user became enabled
+	TypeUserActivated = "user.activated"
+	// TypeUserSuspended a user got suspended
+	TypeUserSuspended = "user.suspended"
+	// TypeUserDeleted a user was deleted
+	TypeUserDeleted = "user.deleted"
+	// TypeUserEmailChanged a user email was changed
+	TypeUserEmailChanged = "user.email_changed"
+	// TypeRoleGranted a role was directly assigned to a user
+	TypeRoleGranted = "role.granted"
+	// TypeRoleRevoked a role directly assigned to a user was taken away
+	TypeRoleRevoked = "role.revoked"
+	// TypeUserRolesChanged the roles directly assigned to a user were changed at once
+	TypeUserRolesChanged = "user.roles_changed"
+	// TypeLoginSucceeded an authentication attempt succeeded
+	TypeLoginSucceeded = "login.succeeded"
+	// TypeLoginFailed an authentication attempt failed or was denied
+	TypeLoginFailed = "login.failed"
+	// TypeLoginChallenged the passphrase of an authentication attempt was right but a second factor is needed
+	TypeLoginChallenged = "login.challenged"
+)
+
+// where users are created from
+const (
+	// SourceManagement the management API
+	SourceManagement = "management"
+	// SourceScim SCIM provisioning
+	SourceScim = "scim"
+	// SourceInvitation an accepted invitation
+	SourceInvitation = "invitation"
+	// SourceImport user import
+	SourceImport = "import"
+)
+
+// why users are suspended
+const (
+	// SuspendedByManagement a user manager suspended the user
+	SuspendedByManagement = "management"
+	// SuspendedByLockout the user failed to authenticate too many times
+	SuspendedByLockout = "lockout"
+)
+
+// outcomes of a failed login
+const (
+	// LoginFailure the credential was wrong, it counts toward the lockout
+	LoginFailure = "failure"
+	// LoginDenied the user may not log in, eg. disabled or suspended
+	LoginDenied = "denied"
+)
+
+// UserEvent is an event about a user
+type UserEvent interface {
+	Event
+	// Subject returns the user the event is about, nil if there is no such user
+	Subject() *connector.User
+}
+
+// UserCreated is published when a user is created
+type UserCreated struct {
+	User *connector.User `json:"-"`
+	// Tenant the user is created in
+	Tenant *connector.Tenant `json:"tenant"`
+	// Source where the user is created from
+	Source string `json:"source"`
+	// Verify the user must verify the email before the user is enabled
+	Verify bool `json:"verify"`
+	// Settings of the tenant, eg. for the email templates
+	Settings config.Settings `json:"-"`
+}
+
+// EventType returns user.created
+func (e *UserCreated) EventType() string { return TypeUserCreated }
+
+// Subject returns the created user
+func (e *UserCreated) Subject() *connector.User { return e.User }
+
+// UserActivated is published when a user becomes enabled
+type UserActivated struct {
+	User *connector.User `json:"-"`
+}
+
+// EventType returns user.activated
+func (e *UserActivated) EventType() string { return TypeUserActivated }
+
+// Subject returns the activated user
+func (e *UserActivated) Subject() *connector.User { return e.User }
+
+// UserSuspended is published when a user gets suspended
+type UserSuspended struct {
+	User *connector.User `json:"-"`
+	// Reason of the suspension, management or lockout
+	Reason string `json:"reason"`
+}
+
+// EventType returns user.suspended
+func (e *UserSuspended) EventType() string { return TypeUserSuspended }
+
+// Subject returns the suspended user
+func (e *UserSuspended) Subject() *connector.User { return e.User }
+
+// UserDeleted is published when a user is deleted
+type UserDeleted struct {
+	User *connector.User `json:"-"`
+	// Tenants the user was member of before it was deleted
+	Tenants []*connector.Tenant `json:"tenants"`
+}
+
+// EventType returns user.deleted
+func (e *UserDeleted) EventType() string { return TypeUserDeleted }
+
+// Subject returns the deleted user
+func (e *UserDeleted) Subject() *connector.User { return e.User }
+
+// UserEmailChanged is published when the email of a user is changed
+type UserEmailChanged struct {
+	User *connector.User `json:"-"`
+	// Previous email of the user
+	Previous string `json:"previous"`
+	// Verify the user must verify the new email before the user is enabled
+	Verify bool `json:"verify"`
+	// Tenant of the user, eg. for the email templates, nil if the user belongs to none
+	Tenant *connector.Tenant `json:"-"`
+	// Settings of the user tenant, eg. for the email templates
+	Settings config.Settings `json:"-"`
+}
+
+// EventType returns user.email_changed
+func (e *UserEmailChanged) EventType() string { return TypeUserEmailChanged }
+
+// Subject returns the user whose email changed
+func (e *UserEmailChanged) Subject() *connector.User { return e.User }
+
+// RoleGranted is published when a role is directly assigned to a user
+type RoleGranted struct {
+	User *connector.User `json:"-"`
+	Role *connector.Role `json:"role"`
+}
+
+// EventType returns role.granted
+func (e *RoleGranted) EventType() string { return TypeRoleGranted }
+
+// Subject returns the user given the role
+func (e *RoleGranted) Subject() *connector.User { return e.User }
+
+// RoleRevoked is published when a role directly assigned to a user is taken away
+type RoleRevoked struct {
+	User *connector.User `json:"-"`
+	Role *connector.Role `json:"role"`
+}
+
+// EventType returns role.revoked
+func (e *RoleRevoked) EventType() string { return TypeRoleRevoked }
+
+// Subject returns the user the role was taken from
+func (e *RoleRevoked) Subject() *connector.User { return e.User }
+
+// UserRolesChanged is published when the roles directly assigned to a user are replaced or removed at once
+type UserRolesChanged struct {
+	User *connector.User `json:"-"`
+}
+
+// EventType returns user.roles_changed
+func (e *UserRolesChanged) EventType() string { return TypeUserRolesChanged }
+
+// Subject returns the user whose roles changed
+func (e *UserRolesChanged) Subject() *connector.User { return e.User }
+
+// LoginSucceeded is published when an authentication attempt succeeds
+type LoginSucceeded struct {
+	User *connector.User `json:"-"`
+	// Email the attempt was made with
+	Email string `json:"email"`
+	// Method of the authentication, eg. auth.login, auth.2fa or auth.refresh
+	Method string `json:"method"`
+}
+
+// EventType returns login.succeeded
+func (e *LoginSucceeded) EventType() string { return TypeLoginSucceeded }
+
+// Subject returns the authenticated user, nil if the method does not load the user
+func (e *LoginSucceeded) Subject() *connector.User { return e.User }
+
+// LoginChallenged is published when the passphrase of an authentication attempt is right
+// but the user must still pass the second factor. The login is not complete yet.
+type LoginChallenged struct {
+	User *connector.User `json:"-"`
+	// Email the attempt was made with
+	Email string `json:"email"`
+	// Method of the authentication, eg. auth.2fa_challenge
+	Method string `json:"method"`
+}
+
+// EventType returns login.challenged
+func (e *LoginChallenged) EventType() string { return TypeLoginChallenged }
+
+// Subject returns the challenged user
+func (e *LoginChallenged) Subject() *connector.User { return e.User }
+
+// LoginFailed is published when an authentication attempt fails or is denied.
+// The publisher saves the user after publishing, so subscribers may update it, eg. to lock it out.
+type LoginFailed struct {
+	User *connector.User `json:"-"`
+	// Email the attempt was made with
+	Email string `json:"email"`
+	// Method of the authentication, eg. auth.login, auth.2fa or auth.refresh
+	Method string `json:"method"`
+	// Outcome of the attempt, failure or denied
+	Outcome string `json:"outcome"`
+	// Settings of the user tenant, eg. for the lockout threshold
+	Settings config.Settings `json:"-"`
+}
+
+// EventType returns login.failed
+func (e *LoginFailed) EventType() string { return TypeLoginFailed }
+
+// Subject returns the user the attempt claims to be, nil if there is no such user
+func (e *LoginFailed) Subject() *connector.User { return e.User }
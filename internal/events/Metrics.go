@@ -0,0 +1,40 @@
+package events
+
+import (
+	"context"
+	"sync"
+)
+
+var (
+	// DefaultMetrics counts the events published on the default bus once subscribed
+	DefaultMetrics = NewMetrics()
+)
+
+// Metrics counts published events by type
+type Metrics struct {
+	mutex  sync.Mutex
+	counts map[string]int64
+}
+
+// NewMetrics creates metrics without any count
+func NewMetrics() *Metrics {
+	return &Metrics{counts: make(map[string]int64)}
+}
+
+// Count is the subscriber counting the event, subscribe it to AllEvents
+func (m *Metrics) Count(ctx context.Context, event Event) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.counts[event.EventType()]++
+}
+
+// Counts returns a copy of the count of every event type published so far
+func (m *Metrics) Counts() map[string]int64 {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	ret := make(map[string]int64, len(m.counts))
+	for eventType, count := range m.counts {
+		ret[eventType] = count
+	}
+	return ret
+}
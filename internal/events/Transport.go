@@ -0,0 +1,133 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/hyperjumptech/hansip/internal/constants"
+	"github.com/hyperjumptech/hansip/internal/hansipcontext"
+	"github.com/hyperjumptech/hansip/internal/outbox"
+	"github.com/hyperjumptech/hansip/pkg/helper"
+)
+
+// OutboxKind is the kind of the outbox messages carrying event envelopes
+const OutboxKind = "event"
+
+// Transport carries events out of the process, eg. into a file or a message broker
+type Transport interface {
+	// Send the event envelope
+	Send(ctx context.Context, envelope *Envelope) error
+	// Close the transport, no more envelopes are sent afterward
+	Close() error
+}
+
+// EnvelopeUser is the user an event is about, without any credential
+type EnvelopeUser struct {
+	RecID     string `json:"rec_id"`
+	Email     string `json:"email"`
+	Enabled   bool   `json:"enabled"`
+	Suspended bool   `json:"suspended"`
+}
+
+// Envelope wraps an event with where and when it happened for transports
+type Envelope struct {
+	ID        string        `json:"id"`
+	Type      string        `json:"type"`
+	Time      time.Time     `json:"time"`
+	RequestID string        `json:"request_id,omitempty"`
+	Actor     string        `json:"actor,omitempty"`
+	User      *EnvelopeUser `json:"user,omitempty"`
+	// Data is the event, or its decoded json once the envelope went through the outbox
+	Data interface{} `json:"data"`
+}
+
+// NewEnvelope wraps the event published in the context
+func NewEnvelope(ctx context.Context, event Event) *Envelope {
+	envelope := &Envelope{
+		ID:   helper.MakeRandomString(20, true, true, true, false),
+		Type: event.EventType(),
+		Time: time.Now(),
+		Data: event,
+	}
+	if requestID, ok := ctx.Value(constants.RequestID).(string); ok {
+		envelope.RequestID = requestID
+	}
+	if authCtx, ok := ctx.Value(constants.HansipAuthentication).(*hansipcontext.AuthenticationContext); ok {
+		envelope.Actor = authCtx.Subject
+	}
+	if userEvent, ok := event.(UserEvent); ok && userEvent.Subject() != nil {
+		user := userEvent.Subject()
+		envelope.User = &EnvelopeUser{
+			RecID:     user.RecID,
+			Email:     user.Email,
+			Enabled:   user.Enabled,
+			Suspended: user.Suspended,
+		}
+	}
+	return envelope
+}
+
+// Forward returns a subscriber sending every event it gets through the transport.
+// Failing to send is logged, the publisher is not bothered.
+func Forward(transport Transport) Handler {
+	return func(ctx context.Context, event Event) {
+		if err := transport.Send(ctx, NewEnvelope(ctx, event)); err != nil {
+			busLogger.WithField("func", "Forward").WithField("RequestID", ctx.Value(constants.RequestID)).Errorf("transport.Send %s got %s", event.EventType(), err.Error())
+		}
+	}
+}
+
+// ForwardOutbox returns a subscriber storing the envelope of every event it gets into the outbox,
+// in the transaction of the publisher if any, and registers the outbox deliverer sending them through the transport.
+// Unlike Forward, the events survive a crash or a failing transport and are sent once the change causing them is committed.
+func ForwardOutbox(transport Transport) Handler {
+	outbox.Register(OutboxKind, func(ctx context.Context, payload string) error {
+		envelope := &Envelope{}
+		if err := json.Unmarshal([]byte(payload), envelope); err != nil {
+			return err
+		}
+		return transport.Send(ctx, envelope)
+	})
+	return func(ctx context.Context, event Event) {
+		if err := outbox.Enqueue(ctx, OutboxKind, NewEnvelope(ctx, event)); err != nil {
+			busLogger.WithField("func", "ForwardOutbox").WithField("RequestID", ctx.Value(constants.RequestID)).Errorf("outbox.Enqueue %s got %s", event.EventType(), err.Error())
+		}
+	}
+}
+
+// JSONLSink is a transport appending envelopes into a local file as JSON Lines, one envelope per line
+type JSONLSink struct {
+	mutex sync.Mutex
+	file  *os.File
+}
+
+// NewJSONLSink opens the file for appending, creating it if it does not exist
+func NewJSONLSink(path string) (*JSONLSink, error) {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return &JSONLSink{file: file}, nil
+}
+
+// Send appends the envelope as a line
+func (s *JSONLSink) Send(ctx context.Context, envelope *Envelope) error {
+	line, err := json.Marshal(envelope)
+	if err != nil {
+		return err
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	_, err = s.file.Write(append(line, '\n'))
+	return err
+}
+
+// Close the file
+func (s *JSONLSink) Close() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.file.Close()
+}
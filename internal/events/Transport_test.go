@@ -0,0 +1,73 @@
+package events
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hyperjumptech/hansip/internal/connector"
+	"github.com/hyperjumptech/hansip/internal/constants"
+)
+
+func TestJSONLSink(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hansip-events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "events.jsonl")
+
+	sink, err := NewJSONLSink(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bus := NewBus()
+	bus.Subscribe(AllEvents, Forward(sink))
+
+	user := &connector.User{RecID: "abc", Email: "john@example.com", HashedPassphrase: "secret-hash", UserTotpSecretKey: "totp-key", Enabled: true}
+	ctx := context.WithValue(context.Background(), constants.RequestID, "req-1")
+	bus.Publish(ctx, &UserSuspended{User: user, Reason: SuspendedByLockout})
+	bus.Publish(ctx, &LoginFailed{Email: "nobody@example.com", Method: "auth.login", Outcome: LoginFailure})
+	if err := sink.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	lines := make([]string, 0)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	if len(lines) != 2 {
+		t.Fatalf("expect 2 lines but %d", len(lines))
+	}
+	if strings.Contains(lines[0], "secret-hash") || strings.Contains(lines[0], "totp-key") {
+		t.Errorf("envelope leaks credentials %s", lines[0])
+	}
+
+	envelope := make(map[string]interface{})
+	if err := json.Unmarshal([]byte(lines[0]), &envelope); err != nil {
+		t.Fatal(err)
+	}
+	if envelope["type"] != TypeUserSuspended || envelope["request_id"] != "req-1" || envelope["id"] == "" {
+		t.Errorf("unexpected envelope %s", lines[0])
+	}
+	if envelope["user"].(map[string]interface{})["rec_id"] != "abc" {
+		t.Errorf("expect the user in the envelope %s", lines[0])
+	}
+	if envelope["data"].(map[string]interface{})["reason"] != SuspendedByLockout {
+		t.Errorf("expect the event in the envelope data %s", lines[0])
+	}
+	if strings.Contains(lines[1], `"user"`) {
+		t.Errorf("expect no user for a failed login of an unknown email %s", lines[1])
+	}
+}
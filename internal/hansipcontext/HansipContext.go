@@ -36,3 +36,76 @@ func (c *AuthenticationContext) IsAnAdmin() bool {
 	}
 	return false
 }
+
+// AdminOfDomains returns all domains where the user have an admin account
+func (c *AuthenticationContext) AdminOfDomains() []string {
+	lookFor := fmt.Sprintf("%s@", config.Get("hansip.admin"))
+	ret := make([]string, 0)
+	for _, aud := range c.Audience {
+		if strings.HasPrefix(aud, lookFor) {
+			ret = append(ret, aud[len(lookFor):])
+		}
+	}
+	return ret
+}
+
+const (
+	// ScopeUserManager delegates managing users of a tenant, such as creating, enabling, unlocking or resetting 2FA
+	ScopeUserManager = "user-manager"
+	// ScopeGroupManager delegates managing groups of a tenant and their members
+	ScopeGroupManager = "group-manager"
+	// ScopeRoleManager delegates managing roles of a tenant and assigning them to users and groups
+	ScopeRoleManager = "role-manager"
+	// ScopeAuditor delegates read only access to the management records of a tenant
+	ScopeAuditor = "auditor"
+)
+
+// Scopes lists all built in delegated management scopes
+var Scopes = []string{ScopeUserManager, ScopeGroupManager, ScopeRoleManager, ScopeAuditor}
+
+// IsScope returns true if the name is one of the built in delegated management scopes
+func IsScope(name string) bool {
+	for _, scope := range Scopes {
+		if scope == name {
+			return true
+		}
+	}
+	return false
+}
+
+// HasScopeOfDomain validate if the user is an admin of the domain or have been delegated one of the scopes on the domain.
+// A scope delegated on the hansip domain applies to every domain, the same as the hansip admin.
+func (c *AuthenticationContext) HasScopeOfDomain(domain string, scopes ...string) bool {
+	if c.IsAdminOfDomain(domain) {
+		return true
+	}
+	for _, scope := range scopes {
+		lookFor := fmt.Sprintf("%s@%s", scope, domain)
+		hansipScope := fmt.Sprintf("%s@%s", scope, config.Get("hansip.domain"))
+		for _, aud := range c.Audience {
+			if aud == lookFor || aud == hansipScope {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// HasAnyScope validate if the user is an admin or have been delegated one of the scopes on any domain
+func (c *AuthenticationContext) HasAnyScope(scopes ...string) bool {
+	return len(c.ScopedDomains(scopes...)) > 0
+}
+
+// ScopedDomains returns all domains where the user have an admin account or one of the scopes
+func (c *AuthenticationContext) ScopedDomains(scopes ...string) []string {
+	ret := c.AdminOfDomains()
+	for _, scope := range scopes {
+		lookFor := fmt.Sprintf("%s@", scope)
+		for _, aud := range c.Audience {
+			if strings.HasPrefix(aud, lookFor) {
+				ret = append(ret, aud[len(lookFor):])
+			}
+		}
+	}
+	return ret
+}
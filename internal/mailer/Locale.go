@@ -0,0 +1,96 @@
+package mailer
+
+import (
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var (
+	// localePattern matches a normalized locale, a language optionally followed by subtags, eg. id or en-us
+	localePattern = regexp.MustCompile(`^[a-z]{2,3}(-[a-z0-9]{2,8})*$`)
+)
+
+// NormalizeLocale returns the locale in lower case with hyphens, eg. en_US becomes en-us.
+// It returns false if the locale is not a language tag.
+func NormalizeLocale(locale string) (string, bool) {
+	normalized := strings.ToLower(strings.ReplaceAll(strings.TrimSpace(locale), "_", "-"))
+	if !localePattern.MatchString(normalized) {
+		return "", false
+	}
+	return normalized, true
+}
+
+// LocaleChain returns the locales to look for a template of, from the locale itself to its language, eg. en-us then en
+func LocaleChain(locale string) []string {
+	chain := make([]string, 0)
+	for len(locale) > 0 {
+		chain = append(chain, locale)
+		i := strings.LastIndex(locale, "-")
+		if i < 0 {
+			break
+		}
+		locale = locale[:i]
+	}
+	return chain
+}
+
+// AcceptedLocales returns the normalized locales of an Accept-Language header, the preferred first.
+// The wildcard and the languages refused with q=0 are left out.
+func AcceptedLocales(header string) []string {
+	type accepted struct {
+		locale  string
+		quality float64
+	}
+	locales := make([]*accepted, 0)
+	for _, part := range strings.Split(header, ",") {
+		fields := strings.Split(part, ";")
+		locale, ok := NormalizeLocale(fields[0])
+		if !ok {
+			continue
+		}
+		quality := 1.0
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				q, err := strconv.ParseFloat(param[2:], 64)
+				if err != nil {
+					q = 0
+				}
+				quality = q
+			}
+		}
+		if quality <= 0 {
+			continue
+		}
+		locales = append(locales, &accepted{locale: locale, quality: quality})
+	}
+	sort.SliceStable(locales, func(i, j int) bool {
+		return locales[i].quality > locales[j].quality
+	})
+	ret := make([]string, len(locales))
+	for i, a := range locales {
+		ret[i] = a.locale
+	}
+	return ret
+}
+
+// IsLocalizedTemplateSetting check if the setting key is the subject, body or text template of an email in a locale,
+// eg. mailer.templates.invitation.id.subject
+func IsLocalizedTemplateSetting(key string) bool {
+	for _, prefix := range templateConfigKeys {
+		if !strings.HasPrefix(key, prefix+".") {
+			continue
+		}
+		rest := key[len(prefix)+1:]
+		for _, part := range templateParts {
+			if strings.HasSuffix(rest, "."+part) {
+				locale := strings.TrimSuffix(rest, "."+part)
+				normalized, ok := NormalizeLocale(locale)
+				return ok && normalized == locale
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,63 @@
+package mailer
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNormalizeLocale(t *testing.T) {
+	testData := []struct {
+		locale string
+		expect string
+		valid  bool
+	}{
+		{"id", "id", true},
+		{"en-US", "en-us", true},
+		{" en_US ", "en-us", true},
+		{"zh-Hant-TW", "zh-hant-tw", true},
+		{"", "", false},
+		{"*", "", false},
+		{"english", "", false},
+		{"en-", "", false},
+	}
+	for _, td := range testData {
+		got, ok := NormalizeLocale(td.locale)
+		if got != td.expect || ok != td.valid {
+			t.Errorf("%q expect %q %v but %q %v", td.locale, td.expect, td.valid, got, ok)
+		}
+	}
+	if chain := LocaleChain("zh-hant-tw"); !reflect.DeepEqual(chain, []string{"zh-hant-tw", "zh-hant", "zh"}) {
+		t.Errorf("unexpected chain %v", chain)
+	}
+}
+
+func TestAcceptedLocales(t *testing.T) {
+	testData := []struct {
+		header string
+		expect []string
+	}{
+		{"", []string{}},
+		{"id", []string{"id"}},
+		{"en;q=0.8, id-ID, *;q=0.1", []string{"id-id", "en"}},
+		{"fr;q=0, en-GB;q=0.9, en;q=0.9", []string{"en-gb", "en"}},
+		{"en;q=abc, id;q=0.5", []string{"id"}},
+	}
+	for _, td := range testData {
+		if got := AcceptedLocales(td.header); !reflect.DeepEqual(got, td.expect) {
+			t.Errorf("%q expect %v but %v", td.header, td.expect, got)
+		}
+	}
+}
+
+func TestIsLocalizedTemplateSetting(t *testing.T) {
+	for _, key := range []string{"mailer.templates.invitation.id.subject", "mailer.templates.emailveri.en-us.body"} {
+		if !IsLocalizedTemplateSetting(key) {
+			t.Errorf("expect %s to be a localized template setting", key)
+		}
+	}
+	for _, key := range []string{"mailer.templates.invitation.subject", "mailer.templates.invitation.en-US.body", "mailer.templates.unknown.id.body", "mailer.from.id.subject"} {
+		if IsLocalizedTemplateSetting(key) {
+			t.Errorf("expect %s not to be a localized template setting", key)
+		}
+	}
+}
@@ -2,35 +2,41 @@ package mailer
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
 	"github.com/hyperjumptech/hansip/internal/config"
 	"github.com/hyperjumptech/hansip/internal/connector"
 	"github.com/hyperjumptech/hansip/internal/constants"
+	"github.com/hyperjumptech/hansip/internal/events"
+	"github.com/hyperjumptech/hansip/internal/outbox"
 	log "github.com/sirupsen/logrus"
 	"io/ioutil"
 	"net/url"
+	"sort"
 	"strings"
 	"text/template"
 )
 
+const (
+	// OutboxKind is the kind of the outbox messages carrying emails
+	OutboxKind = "email"
+)
+
 var (
 	mailerLogger = log.WithField("go", "Mailer")
 
-	// MailerChannel mailer channel to receive new mail to send.
-	MailerChannel chan *Email
-
-	// KillChannel a bolean channel to detect mailer server shutdown
-	KillChannel chan bool
-
 	// Sender the connector used in this mailer
 	Sender connector.EmailSender
 
 	// Templates maps list of email template to use
 	Templates map[string]*EmailTemplates
+
+	// TemplateRepo the templates of tenants are loaded from, the configured templates are used if it is nil
+	TemplateRepo connector.EmailTemplateRepository
 )
 
 // Email contains data structure of a new email
 type Email struct {
-	context  context.Context
 	From     string
 	FromName string
 	To       []string
@@ -38,6 +44,33 @@ type Email struct {
 	Bcc      []string
 	Template string
 	Data     interface{}
+	// Settings overrides the template defined in global configuration, eg. tenant settings
+	Settings config.Settings
+	// Tenant whose stored template is used if it has one
+	Tenant *connector.Tenant
+	// Locale of the recipient, eg. id or en-US. If empty, the Accept-Language of the request is used
+	Locale string
+}
+
+// Message is a rendered email waiting in the outbox to be sent
+type Message struct {
+	From     string   `json:"from"`
+	FromName string   `json:"from_name"`
+	To       []string `json:"to"`
+	Cc       []string `json:"cc,omitempty"`
+	Bcc      []string `json:"bcc,omitempty"`
+	Subject  string   `json:"subject"`
+	Body     string   `json:"body"`
+	// Text is the plain text alternative of the html body, empty if the email has none
+	Text string `json:"text,omitempty"`
+}
+
+// templateConfigKeys maps template name to its configuration key prefix
+var templateConfigKeys = map[string]string{
+	"EMAIL_VERIFY":        "mailer.templates.emailveri",
+	"PASSPHRASE_RECOVERY": "mailer.templates.passrecover",
+	"INVITATION":          "mailer.templates.invitation",
+	"EMAIL_OTP":           "mailer.templates.emailotp",
 }
 
 // TemplateLoader will load from specified resourceURI.
@@ -60,99 +93,334 @@ func TemplateLoader(resourceURI string) (string, error) {
 type EmailTemplates struct {
 	SubjectTemplate *template.Template
 	BodyTemplate    *template.Template
+	// TextTemplate renders the plain text alternative of the html body, nil if the email has none
+	TextTemplate *template.Template
+	// Subject, Body and Text are the texts the templates are parsed from
+	Subject string
+	Body    string
+	Text    string
+	// Locales maps a normalized locale, eg. id or en-us, to its variant of the templates
+	Locales map[string]*EmailTemplates
 }
 
-func parseTemplate(name, text string) *template.Template {
-	tmpl, err := template.New(name).Parse(text)
+// Execute the subject, body and text templates with the data. The text is empty if the email has no text template.
+func (t *EmailTemplates) Execute(data interface{}) (string, string, string, error) {
+	subjectWriter := &strings.Builder{}
+	err := t.SubjectTemplate.Execute(subjectWriter, data)
+	if err != nil {
+		return "", "", "", fmt.Errorf("subject template got %s", err.Error())
+	}
+	bodyWriter := &strings.Builder{}
+	err = t.BodyTemplate.Execute(bodyWriter, data)
 	if err != nil {
-		panic(err)
+		return "", "", "", fmt.Errorf("body template got %s", err.Error())
 	}
-	return tmpl
+	textWriter := &strings.Builder{}
+	if t.TextTemplate != nil {
+		err = t.TextTemplate.Execute(textWriter, data)
+		if err != nil {
+			return "", "", "", fmt.Errorf("text template got %s", err.Error())
+		}
+	}
+	return subjectWriter.String(), bodyWriter.String(), textWriter.String(), nil
+}
+
+// setText parses and sets one of the subject, body or text templates
+func (t *EmailTemplates) setText(key, part, text string) error {
+	var tmpl *template.Template
+	if part != "text" || len(text) > 0 {
+		parsed, err := template.New(key + "." + part).Parse(text)
+		if err != nil {
+			return fmt.Errorf("invalid %s template, %s", part, err.Error())
+		}
+		tmpl = parsed
+	}
+	switch part {
+	case "subject":
+		t.SubjectTemplate, t.Subject = tmpl, text
+	case "body":
+		t.BodyTemplate, t.Body = tmpl, text
+	default:
+		t.TextTemplate, t.Text = tmpl, text
+	}
+	return nil
+}
+
+// templateParts are the templates of an email, suffixing their configuration keys
+var templateParts = []string{"subject", "body", "text"}
+
+// ParseTemplates parses the subject, body and text templates of the email of the key. The text template may be empty.
+func ParseTemplates(key, subject, body, text string) (*EmailTemplates, error) {
+	t := &EmailTemplates{}
+	for i, part := range []string{subject, body, text} {
+		if err := t.setText(key, templateParts[i], part); err != nil {
+			return nil, err
+		}
+	}
+	return t, nil
+}
+
+// TemplateKeys returns the keys of the emails hansip sends, sorted
+func TemplateKeys() []string {
+	keys := make([]string, 0, len(templateConfigKeys))
+	for key := range templateConfigKeys {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// IsTemplateKey check if hansip sends emails of the key
+func IsTemplateKey(key string) bool {
+	_, ok := templateConfigKeys[key]
+	return ok
+}
+
+// ConfiguredTemplates returns the subject, body and text template texts used when the tenant has no template of the key,
+// the ones in the settings if any, otherwise the ones configured globally
+func ConfiguredTemplates(key string, settings config.Settings) (string, string, string) {
+	templates, ok := Templates[key]
+	if !ok {
+		return "", "", ""
+	}
+	texts := []string{templates.Subject, templates.Body, templates.Text}
+	if prefix, ok := templateConfigKeys[key]; ok && settings != nil {
+		for i, part := range templateParts {
+			if text, ok := settings[prefix+"."+part]; ok && len(text) > 0 {
+				texts[i] = text
+			}
+		}
+	}
+	return texts[0], texts[1], texts[2]
+}
+
+// loadTemplates loads the subject, body and text templates of the configuration key prefix, eg. mailer.templates.invitation
+func loadTemplates(key, prefix string) (*EmailTemplates, error) {
+	texts := make([]string, len(templateParts))
+	for i, part := range templateParts {
+		text, err := TemplateLoader(config.Get(prefix + "." + part))
+		if err != nil {
+			return nil, err
+		}
+		texts[i] = text
+	}
+	return ParseTemplates(key, texts[0], texts[1], texts[2])
+}
+
+// loadLocalizedTemplates loads the variants of the templates of the key in the locales of mailer.templates.locales.
+// A locale missing the subject, body or text template uses the default one.
+func loadLocalizedTemplates(key, prefix string, templates *EmailTemplates) error {
+	templates.Locales = make(map[string]*EmailTemplates)
+	for _, locale := range strings.Split(config.Get("mailer.templates.locales"), ",") {
+		if len(strings.TrimSpace(locale)) == 0 {
+			continue
+		}
+		normalized, ok := NormalizeLocale(locale)
+		if !ok {
+			return fmt.Errorf("invalid locale %s in mailer.templates.locales", locale)
+		}
+		variant := &EmailTemplates{
+			SubjectTemplate: templates.SubjectTemplate,
+			BodyTemplate:    templates.BodyTemplate,
+			TextTemplate:    templates.TextTemplate,
+			Subject:         templates.Subject,
+			Body:            templates.Body,
+			Text:            templates.Text,
+		}
+		configured := false
+		for _, part := range templateParts {
+			text, err := TemplateLoader(config.Get(prefix + "." + normalized + "." + part))
+			if err != nil {
+				return err
+			}
+			if len(text) == 0 {
+				continue
+			}
+			if err := variant.setText(key, part, text); err != nil {
+				return err
+			}
+			configured = true
+		}
+		if configured {
+			templates.Locales[normalized] = variant
+		}
+	}
+	return nil
 }
 
 func init() {
-	MailerChannel = make(chan *Email)
-	KillChannel = make(chan bool)
+	outbox.Register(OutboxKind, deliver)
 	Templates = make(map[string]*EmailTemplates)
 
-	emailVeriSubTempl, err := TemplateLoader(config.Get("mailer.templates.emailveri.subject"))
-	if err != nil {
-		panic(err.Error())
+	for key, prefix := range templateConfigKeys {
+		templates, err := loadTemplates(key, prefix)
+		if err != nil {
+			panic(err.Error())
+		}
+		if err := loadLocalizedTemplates(key, prefix, templates); err != nil {
+			panic(err.Error())
+		}
+		Templates[key] = templates
 	}
-	emailVeriBodTempl, err := TemplateLoader(config.Get("mailer.templates.emailveri.body"))
+}
+
+// Render executes the subject and body templates of the mail
+func Render(ctx context.Context, mail *Email) (*Message, error) {
+	templates, ok := resolveTemplates(ctx, mail)
+	if !ok {
+		return nil, fmt.Errorf("mail template not recognized %s", mail.Template)
+	}
+	subject, body, text, err := templates.Execute(mail.Data)
 	if err != nil {
-		panic(err.Error())
+		return nil, err
 	}
+	return &Message{
+		From:     mail.From,
+		FromName: mail.FromName,
+		To:       mail.To,
+		Cc:       mail.Cc,
+		Bcc:      mail.Bcc,
+		Subject:  subject,
+		Body:     body,
+		Text:     text,
+	}, nil
+}
 
-	emailPassRecSubTempl, err := TemplateLoader(config.Get("mailer.templates.passrecover.subject"))
+// Send renders the mail and stores it into the outbox, in the transaction of the context if any.
+// The outbox workers send it in the background, retrying if the Sender fails.
+func Send(ctx context.Context, mail *Email) error {
+	fLog := mailerLogger.WithField("func", "Send").WithField("RequestID", ctx.Value(constants.RequestID))
+	message, err := Render(ctx, mail)
 	if err != nil {
-		panic(err.Error())
+		fLog.Errorf("not sent, %s", err.Error())
+		return err
 	}
-
-	emailPassRecBodTempl, err := TemplateLoader(config.Get("mailer.templates.passrecover.body"))
+	err = outbox.Enqueue(ctx, OutboxKind, message)
 	if err != nil {
-		panic(err.Error())
-	}
-
-	Templates["EMAIL_VERIFY"] = &EmailTemplates{
-		SubjectTemplate: parseTemplate("verifySubject", emailVeriSubTempl),
-		BodyTemplate:    parseTemplate("verifyBody", emailVeriBodTempl),
-	}
-	Templates["PASSPHRASE_RECOVERY"] = &EmailTemplates{
-		SubjectTemplate: parseTemplate("passRecoverSubject", emailPassRecSubTempl),
-		BodyTemplate:    parseTemplate("passRecoverBody", emailPassRecBodTempl),
-	}
-
-}
-
-// Start will start this mailer server
-func Start() {
-	mailerLogger.Info("Mailer starting")
-	running := true
-	for running {
-		select {
-		case mail := <-MailerChannel:
-			fLog := mailerLogger.WithField("RequestID", mail.context.Value(constants.RequestID))
-			if Sender == nil {
-				fLog.Errorf("not sent because mail Sender is nil")
-			} else {
-				if templates, ok := Templates[mail.Template]; ok {
-					subjectWriter := &strings.Builder{}
-					err := templates.SubjectTemplate.Execute(subjectWriter, mail.Data)
-					if err != nil {
-						fLog.Errorf("templates.SubjectTemplate.Execute got %s", err.Error())
-					}
-					bodyWriter := &strings.Builder{}
-					err = templates.BodyTemplate.Execute(bodyWriter, mail.Data)
-					if err != nil {
-						fLog.Errorf("templates.BodyTemplate.Execute got %s", err.Error())
-					}
-					err = Sender.SendEmail(mail.context, mail.To, mail.Cc, mail.Bcc, mail.From, mail.FromName, subjectWriter.String(), bodyWriter.String())
-					if err != nil {
-						fLog.Errorf("Sender.SendEmail got %s", err.Error())
-					}
-					fLog.Tracef("email sent to %s", mail.To)
-				} else {
-					fLog.Errorf("not sent because mail template not recognized %s", mail.Template)
-				}
+		fLog.Errorf("outbox.Enqueue got %s", err.Error())
+		return err
+	}
+	fLog.Tracef("email to %s queued", mail.To)
+	return nil
+}
+
+// deliver sends an email of the outbox
+func deliver(ctx context.Context, payload string) error {
+	if Sender == nil {
+		return fmt.Errorf("mail Sender is nil")
+	}
+	message := &Message{}
+	if err := json.Unmarshal([]byte(payload), message); err != nil {
+		return err
+	}
+	return Sender.SendEmail(ctx, message.To, message.Cc, message.Bcc, message.From, message.FromName, message.Subject, message.Body, message.Text)
+}
+
+// resolveTemplates returns the templates for the mail, the latest version of the template of the mail tenant if it has one.
+// Otherwise the variant of the locale selected for the mail is used, if the mail settings override its subject or body
+// template, the overriding template is used instead of the configured one.
+func resolveTemplates(ctx context.Context, mail *Email) (*EmailTemplates, bool) {
+	templates, ok := Templates[mail.Template]
+	if !ok {
+		return nil, false
+	}
+	if mail.Tenant != nil && TemplateRepo != nil {
+		fLog := mailerLogger.WithField("func", "resolveTemplates").WithField("RequestID", ctx.Value(constants.RequestID))
+		tmpl, err := TemplateRepo.GetEmailTemplate(ctx, mail.Tenant, mail.Template)
+		if err == nil {
+			stored, err := ParseTemplates(mail.Template, tmpl.Subject, tmpl.Body, tmpl.TextBody)
+			if err == nil {
+				return stored, true
 			}
-		case stop := <-KillChannel:
-			if stop {
-				running = false
-				break
+			fLog.Errorf("template %s version %d of tenant %s got %s, using default template", mail.Template, tmpl.Version, mail.Tenant.Domain, err.Error())
+		} else if _, none := err.(*connector.ErrDBNoResult); !none {
+			fLog.Errorf("TemplateRepo.GetEmailTemplate got %s, using default template", err.Error())
+		}
+	}
+	prefix := templateConfigKeys[mail.Template]
+	locale := selectLocale(templates, prefix, mail.Settings, mailLocales(ctx, mail))
+	if variant, ok := templates.Locales[locale]; ok {
+		templates = variant
+	}
+	if mail.Settings == nil {
+		return templates, true
+	}
+	if len(locale) > 0 {
+		prefix = prefix + "." + locale
+	}
+	ret := &EmailTemplates{
+		SubjectTemplate: templates.SubjectTemplate,
+		BodyTemplate:    templates.BodyTemplate,
+		TextTemplate:    templates.TextTemplate,
+		Subject:         templates.Subject,
+		Body:            templates.Body,
+		Text:            templates.Text,
+	}
+	for _, part := range templateParts {
+		if text, ok := mail.Settings[prefix+"."+part]; ok && len(text) > 0 {
+			if err := ret.setText(mail.Template, part, text); err != nil {
+				mailerLogger.Errorf("%s.%s got %s, using default template", prefix, part, err.Error())
 			}
 		}
 	}
-	mailerLogger.Info("Mailer stopped")
+	return ret, true
 }
 
-// Send will add an email to the channel for sending.
-func Send(context context.Context, mail *Email) {
-	mail.context = context
-	MailerChannel <- mail
+// mailLocales returns the locales the mail may be written in, the preferred first.
+// The locale of the recipient if known, otherwise the languages accepted by the caller of the request.
+func mailLocales(ctx context.Context, mail *Email) []string {
+	if locale, ok := NormalizeLocale(mail.Locale); ok {
+		return []string{locale}
+	}
+	if acceptLanguage, ok := ctx.Value(constants.AcceptLanguage).(string); ok {
+		return AcceptedLocales(acceptLanguage)
+	}
+	return nil
+}
+
+// selectLocale returns the first locale having a variant of the templates, in the configuration or in the settings.
+// Every locale falls back to its language, eg. id-id to id. It returns empty if none has, the default templates are used.
+func selectLocale(templates *EmailTemplates, prefix string, settings config.Settings, locales []string) string {
+	for _, locale := range locales {
+		for _, candidate := range LocaleChain(locale) {
+			if _, ok := templates.Locales[candidate]; ok {
+				return candidate
+			}
+			for _, part := range templateParts {
+				if len(settings[prefix+"."+candidate+"."+part]) > 0 {
+					return candidate
+				}
+			}
+		}
+	}
+	return ""
+}
+
+// SubscribeEvents makes the mailer send the verification email of users created or changing email
+// without being verified yet
+func SubscribeEvents(bus *events.Bus) {
+	bus.Subscribe(events.TypeUserCreated, func(ctx context.Context, event events.Event) {
+		if e := event.(*events.UserCreated); e.Verify {
+			sendVerification(ctx, e.User, e.Tenant, e.Settings)
+		}
+	})
+	bus.Subscribe(events.TypeUserEmailChanged, func(ctx context.Context, event events.Event) {
+		if e := event.(*events.UserEmailChanged); e.Verify {
+			sendVerification(ctx, e.User, e.Tenant, e.Settings)
+		}
+	})
 }
 
-// Stop stop the channel
-func Stop() {
-	KillChannel <- true
+func sendVerification(ctx context.Context, user *connector.User, tenant *connector.Tenant, settings config.Settings) {
+	mailerLogger.WithField("RequestID", ctx.Value(constants.RequestID)).Warnf("Sending email")
+	Send(ctx, &Email{
+		From:     settings.Get("mailer.from"),
+		FromName: settings.Get("mailer.from.name"),
+		To:       []string{user.Email},
+		Template: "EMAIL_VERIFY",
+		Data:     user,
+		Settings: settings,
+		Tenant:   tenant,
+		Locale:   user.Locale,
+	})
 }
@@ -0,0 +1,172 @@
+package mailer
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/hyperjumptech/hansip/internal/config"
+	"github.com/hyperjumptech/hansip/internal/connector"
+	"github.com/hyperjumptech/hansip/internal/constants"
+)
+
+type recordingSender struct {
+	to      []string
+	subject string
+	body    string
+	text    string
+}
+
+func (s *recordingSender) SendEmail(ctx context.Context, to, cc, bcc []string, from, fromName, subject, htmlBody, textBody string) error {
+	s.to, s.subject, s.body, s.text = to, subject, htmlBody, textBody
+	return nil
+}
+
+func TestRenderAndDeliver(t *testing.T) {
+	mail := &Email{
+		From:     "hansip@aaa.com",
+		To:       []string{"john@example.com"},
+		Template: "INVITATION",
+		Data:     map[string]string{"TenantName": "Acme"},
+		Settings: config.Settings{"mailer.templates.invitation.body": "Join {{.TenantName}}"},
+	}
+	message, err := Render(context.Background(), mail)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if message.Subject != "You are invited to join Acme" || message.Body != "Join Acme" {
+		t.Errorf("unexpected rendering %+v", message)
+	}
+
+	if _, err := Render(context.Background(), &Email{Template: "UNKNOWN"}); err == nil {
+		t.Errorf("expect unknown template to fail")
+	}
+
+	payload, _ := json.Marshal(message)
+	sender := &recordingSender{}
+	Sender = sender
+	defer func() { Sender = nil }()
+	if err := deliver(context.Background(), string(payload)); err != nil {
+		t.Fatal(err)
+	}
+	if sender.to[0] != "john@example.com" || sender.subject != message.Subject || sender.body != message.Body || sender.text != message.Text || len(sender.text) == 0 {
+		t.Errorf("unexpected email sent %+v", sender)
+	}
+}
+
+type fixedTemplateRepo struct {
+	connector.EmailTemplateRepository
+	templates map[string]*connector.EmailTemplate
+}
+
+func (r *fixedTemplateRepo) GetEmailTemplate(ctx context.Context, tenant *connector.Tenant, key string) (*connector.EmailTemplate, error) {
+	if tmpl, ok := r.templates[tenant.RecID+"/"+key]; ok {
+		return tmpl, nil
+	}
+	return nil, &connector.ErrDBNoResult{Message: "no template"}
+}
+
+func TestRenderTenantTemplate(t *testing.T) {
+	TemplateRepo = &fixedTemplateRepo{templates: map[string]*connector.EmailTemplate{
+		"acme/INVITATION":   {TemplateKey: "INVITATION", Version: 2, Subject: "Welcome to {{.TenantName}}", Body: "Stored body"},
+		"broken/INVITATION": {TemplateKey: "INVITATION", Version: 1, Subject: "{{.TenantName", Body: "Broken"},
+	}}
+	defer func() { TemplateRepo = nil }()
+	mail := &Email{
+		Template: "INVITATION",
+		Data:     map[string]string{"TenantName": "Acme"},
+		Settings: config.Settings{"mailer.templates.invitation.body": "Join {{.TenantName}}"},
+		Tenant:   &connector.Tenant{RecID: "acme"},
+	}
+	message, err := Render(context.Background(), mail)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if message.Subject != "Welcome to Acme" || message.Body != "Stored body" {
+		t.Errorf("expect the tenant template, got %+v", message)
+	}
+
+	for _, tenant := range []string{"other", "broken"} {
+		mail.Tenant = &connector.Tenant{RecID: tenant}
+		message, err = Render(context.Background(), mail)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if message.Subject != "You are invited to join Acme" || message.Body != "Join Acme" {
+			t.Errorf("tenant %s expect the default template, got %+v", tenant, message)
+		}
+	}
+}
+
+func TestParseTemplates(t *testing.T) {
+	if _, err := ParseTemplates("EMAIL_VERIFY", "Hi {{.Email}", "Body", ""); err == nil {
+		t.Errorf("expect invalid subject template to fail")
+	}
+	if _, err := ParseTemplates("EMAIL_VERIFY", "Hi", "{{if .Email}}", ""); err == nil {
+		t.Errorf("expect invalid body template to fail")
+	}
+	if _, err := ParseTemplates("EMAIL_VERIFY", "Hi", "Body", "{{.Email"); err == nil {
+		t.Errorf("expect invalid text template to fail")
+	}
+	templates, err := ParseTemplates("EMAIL_VERIFY", "Hi {{.Email}}", "Code {{.ActivationCode}}", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	user := &connector.User{Email: "jane@example.com", ActivationCode: "ABC"}
+	subject, body, text, err := templates.Execute(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if subject != "Hi jane@example.com" || body != "Code ABC" || text != "" {
+		t.Errorf("unexpected rendering %s / %s / %s", subject, body, text)
+	}
+	templates, err = ParseTemplates("EMAIL_VERIFY", "Hi", "<b>{{.ActivationCode}}</b>", "Code: {{.ActivationCode}}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, body, text, _ = templates.Execute(user); body != "<b>ABC</b>" || text != "Code: ABC" {
+		t.Errorf("unexpected rendering %s / %s", body, text)
+	}
+	subject, body, text = ConfiguredTemplates("INVITATION", config.Settings{"mailer.templates.invitation.subject": "Custom", "mailer.templates.invitation.text": "Join"})
+	if subject != "Custom" || body != Templates["INVITATION"].Body || text != "Join" {
+		t.Errorf("unexpected configured templates %s / %s / %s", subject, body, text)
+	}
+	if !IsTemplateKey("PASSPHRASE_RECOVERY") || IsTemplateKey("UNKNOWN") {
+		t.Errorf("unexpected template keys %v", TemplateKeys())
+	}
+}
+
+func TestRenderLocalized(t *testing.T) {
+	user := &connector.User{Email: "budi@example.com", RecoveryCode: "ABC"}
+	english := Templates["PASSPHRASE_RECOVERY"].Subject
+	indonesian := Templates["PASSPHRASE_RECOVERY"].Locales["id"].Subject
+	if english == indonesian {
+		t.Fatalf("expect the default id variant to differ from the english one")
+	}
+	withLanguage := context.WithValue(context.Background(), constants.AcceptLanguage, "fr-FR, id;q=0.8, en;q=0.5")
+	testData := []struct {
+		ctx      context.Context
+		locale   string
+		settings config.Settings
+		expect   string
+	}{
+		{context.Background(), "", nil, english},
+		{context.Background(), "id", nil, indonesian},
+		{context.Background(), "id-ID", nil, indonesian},
+		{context.Background(), "fr", nil, english},
+		{withLanguage, "", nil, indonesian},
+		{withLanguage, "en", nil, english},
+		{withLanguage, "", config.Settings{"mailer.templates.passrecover.fr.subject": "Récupération"}, "Récupération"},
+		{context.Background(), "id", config.Settings{"mailer.templates.passrecover.subject": "Recovery"}, indonesian},
+		{context.Background(), "", config.Settings{"mailer.templates.passrecover.subject": "Recovery"}, "Recovery"},
+	}
+	for i, td := range testData {
+		message, err := Render(td.ctx, &Email{Template: "PASSPHRASE_RECOVERY", Data: user, Locale: td.locale, Settings: td.settings})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if message.Subject != td.expect {
+			t.Errorf("#%d expect subject %q but %q", i, td.expect, message.Subject)
+		}
+	}
+}
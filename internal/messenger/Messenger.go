@@ -0,0 +1,250 @@
+package messenger
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/hyperjumptech/hansip/internal/config"
+	"github.com/hyperjumptech/hansip/internal/connector"
+	"github.com/hyperjumptech/hansip/internal/constants"
+	"github.com/hyperjumptech/hansip/internal/mailer"
+	"github.com/hyperjumptech/hansip/internal/outbox"
+	log "github.com/sirupsen/logrus"
+	"sort"
+	"strings"
+	"text/template"
+)
+
+const (
+	// OutboxKind is the kind of the outbox messages carrying SMS and chat messages
+	OutboxKind = "message"
+)
+
+var (
+	messengerLogger = log.WithField("go", "Messenger")
+
+	// Sender the connector used in this messenger
+	Sender connector.MessageSender
+
+	// Templates maps list of message template to use
+	Templates map[string]*MessageTemplates
+)
+
+// Message contains data structure of a new SMS or chat message
+type Message struct {
+	// Channel is connector.MessageChannelSMS or connector.MessageChannelChat
+	Channel  string
+	To       string
+	Template string
+	Data     interface{}
+	// Settings overrides the template defined in global configuration, eg. tenant settings
+	Settings config.Settings
+	// Locale of the recipient, eg. id or en-US. If empty, the Accept-Language of the request is used
+	Locale string
+}
+
+// Outgoing is a rendered message waiting in the outbox to be sent
+type Outgoing struct {
+	Channel string `json:"channel"`
+	To      string `json:"to"`
+	Text    string `json:"text"`
+}
+
+// templateConfigKeys maps template name to its configuration key prefix
+var templateConfigKeys = map[string]string{
+	"OTP":                   "messenger.templates.otp",
+	"SECURITY_NOTIFICATION": "messenger.templates.security",
+}
+
+// MessageTemplates data structure for a message template
+type MessageTemplates struct {
+	TextTemplate *template.Template
+	// Text is the text the template is parsed from
+	Text string
+	// Locales maps a normalized locale, eg. id or en-us, to its variant of the template
+	Locales map[string]*MessageTemplates
+}
+
+// Execute the text template with the data
+func (t *MessageTemplates) Execute(data interface{}) (string, error) {
+	textWriter := &strings.Builder{}
+	if err := t.TextTemplate.Execute(textWriter, data); err != nil {
+		return "", fmt.Errorf("text template got %s", err.Error())
+	}
+	return textWriter.String(), nil
+}
+
+// ParseTemplate parses the text template of the message of the key
+func ParseTemplate(key, text string) (*MessageTemplates, error) {
+	tmpl, err := template.New(key + ".text").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid text template, %s", err.Error())
+	}
+	return &MessageTemplates{TextTemplate: tmpl, Text: text}, nil
+}
+
+// TemplateKeys returns the keys of the messages hansip sends, sorted
+func TemplateKeys() []string {
+	keys := make([]string, 0, len(templateConfigKeys))
+	for key := range templateConfigKeys {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// IsLocalizedTemplateSetting check if the setting key is the text template of a message in a locale,
+// eg. messenger.templates.otp.id.text
+func IsLocalizedTemplateSetting(key string) bool {
+	for _, prefix := range templateConfigKeys {
+		if !strings.HasPrefix(key, prefix+".") || !strings.HasSuffix(key, ".text") {
+			continue
+		}
+		locale := strings.TrimSuffix(key[len(prefix)+1:], ".text")
+		normalized, ok := mailer.NormalizeLocale(locale)
+		return ok && normalized == locale
+	}
+	return false
+}
+
+// loadTemplates loads the text template of the configuration key prefix, eg. messenger.templates.otp,
+// and its variants in the locales of messenger.templates.locales
+func loadTemplates(key, prefix string) (*MessageTemplates, error) {
+	text, err := mailer.TemplateLoader(config.Get(prefix + ".text"))
+	if err != nil {
+		return nil, err
+	}
+	templates, err := ParseTemplate(key, text)
+	if err != nil {
+		return nil, err
+	}
+	templates.Locales = make(map[string]*MessageTemplates)
+	for _, locale := range strings.Split(config.Get("messenger.templates.locales"), ",") {
+		if len(strings.TrimSpace(locale)) == 0 {
+			continue
+		}
+		normalized, ok := mailer.NormalizeLocale(locale)
+		if !ok {
+			return nil, fmt.Errorf("invalid locale %s in messenger.templates.locales", locale)
+		}
+		text, err := mailer.TemplateLoader(config.Get(prefix + "." + normalized + ".text"))
+		if err != nil {
+			return nil, err
+		}
+		if len(text) == 0 {
+			continue
+		}
+		variant, err := ParseTemplate(key, text)
+		if err != nil {
+			return nil, err
+		}
+		templates.Locales[normalized] = variant
+	}
+	return templates, nil
+}
+
+func init() {
+	outbox.Register(OutboxKind, deliver)
+	Templates = make(map[string]*MessageTemplates)
+
+	for key, prefix := range templateConfigKeys {
+		templates, err := loadTemplates(key, prefix)
+		if err != nil {
+			panic(err.Error())
+		}
+		Templates[key] = templates
+	}
+}
+
+// Render executes the text template of the message
+func Render(ctx context.Context, message *Message) (*Outgoing, error) {
+	templates, ok := resolveTemplates(ctx, message)
+	if !ok {
+		return nil, fmt.Errorf("message template not recognized %s", message.Template)
+	}
+	text, err := templates.Execute(message.Data)
+	if err != nil {
+		return nil, err
+	}
+	return &Outgoing{
+		Channel: message.Channel,
+		To:      message.To,
+		Text:    text,
+	}, nil
+}
+
+// Send renders the message and stores it into the outbox, in the transaction of the context if any.
+// The outbox workers send it in the background, retrying if the Sender fails.
+func Send(ctx context.Context, message *Message) error {
+	fLog := messengerLogger.WithField("func", "Send").WithField("RequestID", ctx.Value(constants.RequestID))
+	outgoing, err := Render(ctx, message)
+	if err != nil {
+		fLog.Errorf("not sent, %s", err.Error())
+		return err
+	}
+	err = outbox.Enqueue(ctx, OutboxKind, outgoing)
+	if err != nil {
+		fLog.Errorf("outbox.Enqueue got %s", err.Error())
+		return err
+	}
+	fLog.Tracef("%s message to %s queued", message.Channel, message.To)
+	return nil
+}
+
+// deliver sends a message of the outbox
+func deliver(ctx context.Context, payload string) error {
+	if Sender == nil {
+		return fmt.Errorf("message Sender is nil")
+	}
+	outgoing := &Outgoing{}
+	if err := json.Unmarshal([]byte(payload), outgoing); err != nil {
+		return err
+	}
+	return Sender.SendMessage(ctx, outgoing.Channel, outgoing.To, outgoing.Text)
+}
+
+// resolveTemplates returns the template for the message, the variant of the first locale of the message having one,
+// in the configuration or in the settings. The template in the settings is used instead of the configured one.
+func resolveTemplates(ctx context.Context, message *Message) (*MessageTemplates, bool) {
+	templates, ok := Templates[message.Template]
+	if !ok {
+		return nil, false
+	}
+	prefix := templateConfigKeys[message.Template]
+	for _, locale := range messageLocales(ctx, message) {
+		for _, candidate := range mailer.LocaleChain(locale) {
+			if text := message.Settings[prefix+"."+candidate+".text"]; len(text) > 0 {
+				return settingTemplate(message.Template, prefix+"."+candidate+".text", text, templates), true
+			}
+			if variant, ok := templates.Locales[candidate]; ok {
+				return variant, true
+			}
+		}
+	}
+	if text := message.Settings[prefix+".text"]; len(text) > 0 {
+		return settingTemplate(message.Template, prefix+".text", text, templates), true
+	}
+	return templates, true
+}
+
+// settingTemplate parses the template overridden in the settings, the fallback is used if it is invalid
+func settingTemplate(key, setting, text string, fallback *MessageTemplates) *MessageTemplates {
+	templates, err := ParseTemplate(key, text)
+	if err != nil {
+		messengerLogger.Errorf("%s got %s, using default template", setting, err.Error())
+		return fallback
+	}
+	return templates
+}
+
+// messageLocales returns the locales the message may be written in, the preferred first.
+// The locale of the recipient if known, otherwise the languages accepted by the caller of the request.
+func messageLocales(ctx context.Context, message *Message) []string {
+	if locale, ok := mailer.NormalizeLocale(message.Locale); ok {
+		return []string{locale}
+	}
+	if acceptLanguage, ok := ctx.Value(constants.AcceptLanguage).(string); ok {
+		return mailer.AcceptedLocales(acceptLanguage)
+	}
+	return nil
+}
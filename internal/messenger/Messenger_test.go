@@ -0,0 +1,93 @@
+package messenger
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/hyperjumptech/hansip/internal/config"
+	"github.com/hyperjumptech/hansip/internal/connector"
+	"github.com/hyperjumptech/hansip/internal/constants"
+)
+
+func TestRenderAndDeliver(t *testing.T) {
+	message := &Message{
+		Channel:  connector.MessageChannelSMS,
+		To:       "+6281234567890",
+		Template: "OTP",
+		Data:     map[string]interface{}{"Code": "123456", "Minutes": 5},
+	}
+	outgoing, err := Render(context.Background(), message)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(outgoing.Text, "123456") || !strings.Contains(outgoing.Text, "5 minutes") {
+		t.Errorf("unexpected rendering %+v", outgoing)
+	}
+
+	if _, err := Render(context.Background(), &Message{Template: "UNKNOWN"}); err == nil {
+		t.Errorf("expect unknown template to fail")
+	}
+
+	payload, _ := json.Marshal(outgoing)
+	sender := &connector.DummyMessageSender{}
+	Sender = sender
+	defer func() { Sender = nil }()
+	if err := deliver(context.Background(), string(payload)); err != nil {
+		t.Fatal(err)
+	}
+	if last := sender.LastSentMessage(); last.Channel != connector.MessageChannelSMS || last.To != "+6281234567890" || last.Text != outgoing.Text {
+		t.Errorf("unexpected message sent %+v", last)
+	}
+}
+
+func TestRenderLocalized(t *testing.T) {
+	data := map[string]interface{}{"Code": "123456", "Minutes": 5}
+	outgoing, err := Render(context.Background(), &Message{Template: "OTP", Data: data, Locale: "id-ID"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(outgoing.Text, "Kode verifikasi") {
+		t.Errorf("expected the indonesian template but %s", outgoing.Text)
+	}
+
+	ctx := context.WithValue(context.Background(), constants.AcceptLanguage, "fr-CH, id;q=0.8")
+	outgoing, _ = Render(ctx, &Message{Template: "OTP", Data: data})
+	if !strings.HasPrefix(outgoing.Text, "Kode verifikasi") {
+		t.Errorf("expected the accepted language template but %s", outgoing.Text)
+	}
+
+	settings := config.Settings{
+		"messenger.templates.otp.text":    "Code {{.Code}}",
+		"messenger.templates.otp.fr.text": "Code de vérification {{.Code}}",
+	}
+	outgoing, _ = Render(context.Background(), &Message{Template: "OTP", Data: data, Settings: settings, Locale: "fr-CA"})
+	if outgoing.Text != "Code de vérification 123456" {
+		t.Errorf("expected the template of the settings locale but %s", outgoing.Text)
+	}
+	outgoing, _ = Render(context.Background(), &Message{Template: "OTP", Data: data, Settings: settings, Locale: "en"})
+	if outgoing.Text != "Code 123456" {
+		t.Errorf("expected the template of the settings but %s", outgoing.Text)
+	}
+	settings["messenger.templates.otp.text"] = "Code {{.Code"
+	outgoing, _ = Render(context.Background(), &Message{Template: "OTP", Data: data, Settings: settings})
+	if !strings.HasPrefix(outgoing.Text, "Your Hansip verification code") {
+		t.Errorf("expected the invalid setting to be ignored but %s", outgoing.Text)
+	}
+}
+
+func TestIsLocalizedTemplateSetting(t *testing.T) {
+	for key, expected := range map[string]bool{
+		"messenger.templates.otp.id.text":         true,
+		"messenger.templates.security.en-gb.text": true,
+		"messenger.templates.otp.text":            false,
+		"messenger.templates.otp.EN.text":         false,
+		"messenger.templates.otp.id.subject":      false,
+		"mailer.templates.invitation.id.text":     false,
+	} {
+		if IsLocalizedTemplateSetting(key) != expected {
+			t.Errorf("%s expected %v", key, expected)
+		}
+	}
+}
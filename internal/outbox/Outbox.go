@@ -0,0 +1,276 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/hyperjumptech/hansip/internal/config"
+	"github.com/hyperjumptech/hansip/internal/connector"
+	"github.com/hyperjumptech/hansip/internal/constants"
+	"github.com/hyperjumptech/jiffy"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// maxBackoff caps the delay between two attempts
+	maxBackoff = 24 * time.Hour
+)
+
+var (
+	outboxLogger = log.WithField("go", "Outbox")
+
+	// Repo the outbox messages are stored in
+	Repo connector.OutboxRepository
+
+	deliverersMutex sync.RWMutex
+	deliverers      = make(map[string]Deliverer)
+
+	nudge   = make(chan bool, 1)
+	stop    = make(chan bool)
+	stopped = make(chan bool)
+	running int32
+)
+
+// Deliverer delivers the payload of an outbox message of its kind, an error makes the message retried later
+type Deliverer func(ctx context.Context, payload string) error
+
+// Register the deliverer of the messages of the kind, eg. email or event
+func Register(kind string, deliverer Deliverer) {
+	deliverersMutex.Lock()
+	defer deliverersMutex.Unlock()
+	deliverers[kind] = deliverer
+}
+
+func delivererOf(kind string) (Deliverer, bool) {
+	deliverersMutex.RLock()
+	defer deliverersMutex.RUnlock()
+	deliverer, ok := deliverers[kind]
+	return deliverer, ok
+}
+
+// Enqueue stores the payload as json into the outbox to be delivered by the workers.
+// The message is stored in the transaction of the context if any, so it is only delivered if the change causing it is committed.
+func Enqueue(ctx context.Context, kind string, payload interface{}) error {
+	if Repo == nil {
+		return fmt.Errorf("outbox repository is not initialized")
+	}
+	b, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	message := &connector.OutboxMessage{
+		Kind:          kind,
+		Payload:       string(b),
+		Status:        connector.OutboxPending,
+		NextAttemptAt: time.Now(),
+	}
+	if requestID, ok := ctx.Value(constants.RequestID).(string); ok {
+		message.RequestID = requestID
+	}
+	if err := Repo.CreateOutboxMessage(ctx, message); err != nil {
+		return err
+	}
+	Nudge()
+	return nil
+}
+
+// Retry makes a dead or pending message due now with all its attempts again
+func Retry(ctx context.Context, message *connector.OutboxMessage) error {
+	message.Status = connector.OutboxPending
+	message.Attempts = 0
+	message.NextAttemptAt = time.Now()
+	if err := Repo.UpdateOutboxMessage(ctx, message); err != nil {
+		return err
+	}
+	Nudge()
+	return nil
+}
+
+// Nudge makes the workers look for due messages without waiting for the next poll
+func Nudge() {
+	select {
+	case nudge <- true:
+	default:
+	}
+}
+
+// Backoff returns the delay before the next attempt, base doubled for every attempt made after the first one
+func Backoff(base time.Duration, attempts int) time.Duration {
+	delay := base
+	for i := 1; i < attempts; i++ {
+		delay *= 2
+		if delay >= maxBackoff {
+			return maxBackoff
+		}
+	}
+	return delay
+}
+
+// pool of workers delivering the due messages
+type pool struct {
+	workers     int
+	maxAttempts int
+	backoff     time.Duration
+	timeout     time.Duration
+	jobs        chan *connector.OutboxMessage
+	wait        sync.WaitGroup
+}
+
+func newPool() (*pool, error) {
+	timeout, err := jiffy.DurationOf(config.Get("outbox.timeout"))
+	if err != nil || timeout <= 0 {
+		return nil, fmt.Errorf("invalid outbox.timeout %s", config.Get("outbox.timeout"))
+	}
+	backoff, err := jiffy.DurationOf(config.Get("outbox.retry.backoff"))
+	if err != nil || backoff <= 0 {
+		return nil, fmt.Errorf("invalid outbox.retry.backoff %s", config.Get("outbox.retry.backoff"))
+	}
+	workers := config.GetInt("outbox.workers")
+	if workers < 1 {
+		workers = 1
+	}
+	maxAttempts := config.GetInt("outbox.retry.max")
+	if maxAttempts < 1 {
+		maxAttempts = 1
+	}
+	return &pool{
+		workers:     workers,
+		maxAttempts: maxAttempts,
+		backoff:     backoff,
+		timeout:     timeout,
+	}, nil
+}
+
+// start the workers, they run until the jobs channel is closed
+func (p *pool) start() {
+	p.jobs = make(chan *connector.OutboxMessage)
+	for i := 0; i < p.workers; i++ {
+		go func() {
+			for message := range p.jobs {
+				p.deliver(message)
+				p.wait.Done()
+			}
+		}()
+	}
+}
+
+// poll hands every due message to the workers, batch by batch, waiting for a batch to be delivered before the next one.
+// A message is claimed before it is handed over so it is not delivered twice when several instances of hansip share the database.
+func (p *pool) poll(ctx context.Context) {
+	fLog := outboxLogger.WithField("func", "pool.poll")
+	batch := p.workers * 10
+	for {
+		messages, err := Repo.ListDueOutboxMessages(ctx, time.Now(), batch)
+		if err != nil {
+			fLog.Errorf("Repo.ListDueOutboxMessages got %s", err.Error())
+			return
+		}
+		claimed := 0
+		for _, message := range messages {
+			ok, err := Repo.ClaimOutboxMessage(ctx, message, time.Now().Add(2*p.timeout+time.Minute))
+			if err != nil {
+				fLog.Errorf("Repo.ClaimOutboxMessage got %s", err.Error())
+				continue
+			}
+			if !ok {
+				continue
+			}
+			claimed++
+			p.wait.Add(1)
+			p.jobs <- message
+		}
+		p.wait.Wait()
+		if len(messages) < batch || claimed == 0 {
+			return
+		}
+	}
+}
+
+// deliver attempts the message once and records the outcome, scheduling a retry or dead-lettering the message
+// once it ran out of attempts
+func (p *pool) deliver(message *connector.OutboxMessage) {
+	fLog := outboxLogger.WithField("func", "pool.deliver").WithField("RequestID", message.RequestID)
+	ctx, cancel := context.WithTimeout(context.WithValue(context.Background(), constants.RequestID, message.RequestID), p.timeout)
+	defer cancel()
+	err := attempt(ctx, message)
+	message.Attempts++
+	if err == nil {
+		message.Status = connector.OutboxSent
+		message.LastError = ""
+	} else {
+		message.LastError = err.Error()
+		if message.Attempts >= p.maxAttempts {
+			fLog.Warnf("Outbox %s message %s is dead after %d attempts, %s", message.Kind, message.RecID, message.Attempts, err.Error())
+			message.Status = connector.OutboxDead
+		} else {
+			fLog.Warnf("Outbox %s message %s attempt %d failed, %s", message.Kind, message.RecID, message.Attempts, err.Error())
+			message.Status = connector.OutboxPending
+			message.NextAttemptAt = time.Now().Add(Backoff(p.backoff, message.Attempts))
+		}
+	}
+	if err := Repo.UpdateOutboxMessage(context.Background(), message); err != nil {
+		fLog.Errorf("Repo.UpdateOutboxMessage got %s", err.Error())
+	}
+}
+
+// attempt hands the payload to the deliverer of the message kind, a panicking deliverer fails the attempt
+func attempt(ctx context.Context, message *connector.OutboxMessage) (err error) {
+	deliverer, ok := delivererOf(message.Kind)
+	if !ok {
+		return fmt.Errorf("no deliverer for %s messages", message.Kind)
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("deliverer panicked, %v", r)
+		}
+	}()
+	return deliverer(ctx, message.Payload)
+}
+
+// Start delivers the outbox messages until Stop is called
+func Start() {
+	fLog := outboxLogger.WithField("func", "Start")
+	if !atomic.CompareAndSwapInt32(&running, 0, 1) {
+		fLog.Warnf("Outbox delivery is already running")
+		return
+	}
+	defer close(stopped)
+	interval, err := jiffy.DurationOf(config.Get("outbox.poll.interval"))
+	if err != nil || interval <= 0 {
+		fLog.Warnf("Outbox delivery is disabled, outbox.poll.interval is %s", config.Get("outbox.poll.interval"))
+		return
+	}
+	p, err := newPool()
+	if err != nil {
+		fLog.Errorf("Outbox delivery is disabled, %s", err.Error())
+		return
+	}
+	p.start()
+	defer close(p.jobs)
+	fLog.Infof("Outbox delivery every %s by %d workers", interval.String(), p.workers)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			p.poll(context.Background())
+		case <-nudge:
+			p.poll(context.Background())
+		case <-stop:
+			fLog.Info("Outbox delivery stopped")
+			return
+		}
+	}
+}
+
+// Stop stops Start, waiting for the messages being delivered
+func Stop() {
+	close(stop)
+	if atomic.LoadInt32(&running) == 1 {
+		<-stopped
+	}
+}
@@ -0,0 +1,157 @@
+package outbox
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hyperjumptech/hansip/internal/connector"
+	"github.com/hyperjumptech/hansip/internal/constants"
+	"github.com/hyperjumptech/hansip/pkg/helper"
+)
+
+// memoryRepo keeps the outbox messages in memory
+type memoryRepo struct {
+	mutex    sync.Mutex
+	messages []*connector.OutboxMessage
+}
+
+func (m *memoryRepo) CreateOutboxMessage(ctx context.Context, message *connector.OutboxMessage) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	message.RecID = fmt.Sprintf("msg%d", len(m.messages))
+	message.CreatedAt = time.Now()
+	m.messages = append(m.messages, message)
+	return nil
+}
+
+func (m *memoryRepo) GetOutboxMessageByRecID(ctx context.Context, recID string) (*connector.OutboxMessage, error) {
+	for _, message := range m.messages {
+		if message.RecID == recID {
+			return message, nil
+		}
+	}
+	return nil, connector.ErrNotFound
+}
+
+func (m *memoryRepo) ListOutboxMessages(ctx context.Context, request *helper.PageRequest) ([]*connector.OutboxMessage, *helper.Page, error) {
+	return m.messages, &helper.Page{IsLast: true}, nil
+}
+
+func (m *memoryRepo) ListDueOutboxMessages(ctx context.Context, due time.Time, limit int) ([]*connector.OutboxMessage, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	ret := make([]*connector.OutboxMessage, 0)
+	for _, message := range m.messages {
+		if message.Status == connector.OutboxPending && !message.NextAttemptAt.After(due) && len(ret) < limit {
+			copied := *message
+			ret = append(ret, &copied)
+		}
+	}
+	return ret, nil
+}
+
+func (m *memoryRepo) ClaimOutboxMessage(ctx context.Context, message *connector.OutboxMessage, until time.Time) (bool, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	for _, stored := range m.messages {
+		if stored.RecID == message.RecID && stored.Status == connector.OutboxPending && stored.NextAttemptAt.Equal(message.NextAttemptAt) {
+			stored.NextAttemptAt = until
+			message.NextAttemptAt = until
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (m *memoryRepo) UpdateOutboxMessage(ctx context.Context, message *connector.OutboxMessage) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	for i, stored := range m.messages {
+		if stored.RecID == message.RecID {
+			copied := *message
+			m.messages[i] = &copied
+		}
+	}
+	return nil
+}
+
+func TestBackoff(t *testing.T) {
+	base := 30 * time.Second
+	if Backoff(base, 1) != base || Backoff(base, 3) != 4*base {
+		t.Errorf("unexpected backoff %s %s", Backoff(base, 1), Backoff(base, 3))
+	}
+	if Backoff(base, 40) != maxBackoff {
+		t.Errorf("expect backoff capped at %s but %s", maxBackoff, Backoff(base, 40))
+	}
+}
+
+func TestOutboxDelivery(t *testing.T) {
+	repo := &memoryRepo{}
+	Repo = repo
+	defer func() { Repo = nil }()
+
+	delivered := make([]string, 0)
+	var mutex sync.Mutex
+	Register("test", func(ctx context.Context, payload string) error {
+		if ctx.Value(constants.RequestID) != "req-1" {
+			t.Errorf("expect the request id of the message in the context")
+		}
+		if payload == `"fail"` {
+			return fmt.Errorf("refused")
+		}
+		mutex.Lock()
+		defer mutex.Unlock()
+		delivered = append(delivered, payload)
+		return nil
+	})
+
+	ctx := context.WithValue(context.Background(), constants.RequestID, "req-1")
+	for _, payload := range []string{"a", "b", "fail"} {
+		if err := Enqueue(ctx, "test", payload); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := Enqueue(ctx, "unknown", "c"); err != nil {
+		t.Fatal(err)
+	}
+
+	p := &pool{workers: 2, maxAttempts: 2, backoff: time.Hour, timeout: time.Second}
+	p.start()
+	defer close(p.jobs)
+	p.poll(context.Background())
+
+	if len(delivered) != 2 {
+		t.Errorf("expect 2 delivered but %v", delivered)
+	}
+	failed, _ := repo.GetOutboxMessageByRecID(ctx, "msg2")
+	if failed.Status != connector.OutboxPending || failed.Attempts != 1 || failed.LastError != "refused" {
+		t.Errorf("expect a retry scheduled but %+v", failed)
+	}
+	if failed.NextAttemptAt.Before(time.Now().Add(59 * time.Minute)) {
+		t.Errorf("expect the retry after the backoff but %s", failed.NextAttemptAt)
+	}
+	unknown, _ := repo.GetOutboxMessageByRecID(ctx, "msg3")
+	if unknown.Status != connector.OutboxPending || unknown.LastError != "no deliverer for unknown messages" {
+		t.Errorf("expect a message without deliverer to be retried but %+v", unknown)
+	}
+
+	// the second failure kills the message
+	failed.NextAttemptAt = time.Now()
+	repo.UpdateOutboxMessage(ctx, failed)
+	p.poll(context.Background())
+	failed, _ = repo.GetOutboxMessageByRecID(ctx, "msg2")
+	if failed.Status != connector.OutboxDead || failed.Attempts != 2 {
+		t.Errorf("expect a dead message but %+v", failed)
+	}
+
+	if err := Retry(ctx, failed); err != nil {
+		t.Fatal(err)
+	}
+	failed, _ = repo.GetOutboxMessageByRecID(ctx, "msg2")
+	if failed.Status != connector.OutboxPending || failed.Attempts != 0 {
+		t.Errorf("expect a retried message pending again but %+v", failed)
+	}
+}
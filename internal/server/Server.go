@@ -7,8 +7,11 @@ import (
 	"github.com/hyperjumptech/hansip/internal/config"
 	"github.com/hyperjumptech/hansip/internal/connector"
 	"github.com/hyperjumptech/hansip/internal/endpoint"
+	"github.com/hyperjumptech/hansip/internal/events"
 	"github.com/hyperjumptech/hansip/internal/gzip"
 	"github.com/hyperjumptech/hansip/internal/mailer"
+	"github.com/hyperjumptech/hansip/internal/messenger"
+	"github.com/hyperjumptech/hansip/internal/outbox"
 	"github.com/hyperjumptech/hansip/pkg/helper"
 	"github.com/hyperjumptech/jiffy"
 	"github.com/rs/cors"
@@ -17,6 +20,7 @@ import (
 	"os"
 	"os/signal"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -26,6 +30,9 @@ var (
 
 	// TokenFactory will handle token creation and validation
 	TokenFactory helper.TokenFactory
+
+	eventBusOnce sync.Once
+	eventSink    events.Transport
 )
 
 // GetJwtTokenFactory return an instance of JWT TokenFactory.
@@ -49,6 +56,110 @@ func GetJwtTokenFactory() helper.TokenFactory {
 	return tokenFactory
 }
 
+// InitializeRepositories initializes the database and mailer connector used by the endpoints
+func InitializeRepositories() {
+	if config.Get("db.type") == "MYSQL" {
+		log.Warnf("Using MYSQL")
+		endpoint.UserRepo = connector.GetMySQLDBInstance()
+		endpoint.GroupRepo = connector.GetMySQLDBInstance()
+		endpoint.RoleRepo = connector.GetMySQLDBInstance()
+		endpoint.UserGroupRepo = connector.GetMySQLDBInstance()
+		endpoint.UserRoleRepo = connector.GetMySQLDBInstance()
+		endpoint.UserTenantRepo = connector.GetMySQLDBInstance()
+		endpoint.GroupRoleRepo = connector.GetMySQLDBInstance()
+		endpoint.TenantRepo = connector.GetMySQLDBInstance()
+		endpoint.RevocationRepo = connector.GetMySQLDBInstance()
+		endpoint.AttributeRepo = connector.GetMySQLDBInstance()
+		endpoint.InvitationRepo = connector.GetMySQLDBInstance()
+		endpoint.AuditRepo = connector.GetMySQLDBInstance()
+		endpoint.WebhookRepo = connector.GetMySQLDBInstance()
+		endpoint.OutboxRepo = connector.GetMySQLDBInstance()
+		endpoint.TxRepo = connector.GetMySQLDBInstance()
+		endpoint.EmailTemplateRepo = connector.GetMySQLDBInstance()
+		endpoint.EmailOTPRepo = connector.GetMySQLDBInstance()
+		endpoint.WebAuthnRepo = connector.GetMySQLDBInstance()
+		outbox.Repo = connector.GetMySQLDBInstance()
+		mailer.TemplateRepo = connector.GetMySQLDBInstance()
+	} else {
+		panic(fmt.Sprintf("unknown database type %s. Correct your configuration 'db.type' or env-var 'AAA_DB_TYPE'. allowed values are INMEMORY or MYSQL", config.Get("db.type")))
+	}
+
+	if config.Get("mailer.type") == "DUMMY" {
+		endpoint.EmailSender = &connector.DummyMailSender{}
+	} else if config.Get("mailer.type") == "SENDMAIL" {
+		timeout, err := jiffy.DurationOf(config.Get("mailer.sendmail.timeout"))
+		if err != nil {
+			panic(fmt.Sprintf("invalid mailer.sendmail.timeout %s", config.Get("mailer.sendmail.timeout")))
+		}
+		idleTimeout, err := jiffy.DurationOf(config.Get("mailer.sendmail.pool.idle"))
+		if err != nil {
+			panic(fmt.Sprintf("invalid mailer.sendmail.pool.idle %s", config.Get("mailer.sendmail.pool.idle")))
+		}
+		endpoint.EmailSender = &connector.SendMailSender{
+			Host:          config.Get("mailer.sendmail.host"),
+			Port:          config.GetInt("mailer.sendmail.port"),
+			User:          config.Get("mailer.sendmail.user"),
+			Password:      config.Get("mailer.sendmail.password"),
+			Auth:          config.Get("mailer.sendmail.auth"),
+			TLS:           config.Get("mailer.sendmail.tls"),
+			CAFile:        config.Get("mailer.sendmail.tls.ca"),
+			TLSSkipVerify: config.GetBoolean("mailer.sendmail.tls.skipverify"),
+			HeloName:      config.Get("mailer.sendmail.helo"),
+			Timeout:       timeout,
+			PoolSize:      config.GetInt("mailer.sendmail.pool.size"),
+			IdleTimeout:   idleTimeout,
+		}
+	} else if config.Get("mailer.type") == "SENDGRID" {
+		endpoint.EmailSender = &connector.SendGridSender{
+			Token: config.Get("mailer.sendgrid.token"),
+		}
+	} else {
+		panic(fmt.Sprintf("unknown mailer type %s. Correct your configuration 'mailer.type' or env-var 'AAA_MAILER_TYPE'. allowed values are DUMMY, SENDMAIL or SENDGRID", config.Get("mailer.type")))
+	}
+	mailer.Sender = endpoint.EmailSender
+
+	if config.Get("messenger.type") == "DUMMY" {
+		messenger.Sender = &connector.DummyMessageSender{}
+	} else if config.Get("messenger.type") == "WEBHOOK" {
+		timeout, err := jiffy.DurationOf(config.Get("messenger.webhook.timeout"))
+		if err != nil {
+			panic(fmt.Sprintf("invalid messenger.webhook.timeout %s", config.Get("messenger.webhook.timeout")))
+		}
+		messenger.Sender = &connector.WebhookMessageSender{
+			URL:    config.Get("messenger.webhook.url"),
+			Secret: config.Get("messenger.webhook.secret"),
+			Client: &http.Client{Timeout: timeout},
+		}
+	} else {
+		panic(fmt.Sprintf("unknown messenger type %s. Correct your configuration 'messenger.type' or env-var 'AAA_MESSENGER_TYPE'. allowed values are DUMMY or WEBHOOK", config.Get("messenger.type")))
+	}
+
+	InitializeEventBus()
+}
+
+// InitializeEventBus subscribes the audit log, lockout, webhooks, mailer, metrics and the configured
+// event sink to the default event bus, only once
+func InitializeEventBus() {
+	eventBusOnce.Do(func() {
+		endpoint.SubscribeEvents(events.Default)
+		mailer.SubscribeEvents(events.Default)
+		events.Subscribe(events.AllEvents, events.DefaultMetrics.Count)
+
+		switch config.Get("events.sink.type") {
+		case "NONE":
+		case "JSONL":
+			sink, err := events.NewJSONLSink(config.Get("events.sink.jsonl.path"))
+			if err != nil {
+				panic(fmt.Sprintf("can not open event sink %s. got %s", config.Get("events.sink.jsonl.path"), err.Error()))
+			}
+			eventSink = sink
+			events.Subscribe(events.AllEvents, events.ForwardOutbox(sink))
+		default:
+			panic(fmt.Sprintf("unknown event sink type %s. Correct your configuration 'events.sink.type' or env-var 'AAA_EVENTS_SINK_TYPE'. allowed values are NONE or JSONL", config.Get("events.sink.type")))
+		}
+	})
+}
+
 // InitializeRouter initializes Gorilla Mux and all handler, including Database and Mailer connector
 func InitializeRouter() {
 	log.Info("Initializing server")
@@ -79,43 +190,19 @@ func InitializeRouter() {
 		Router.Use(gzipFilter.DoFilter)
 	}
 
-	Router.Use(endpoint.ClientIPResolverMiddleware, endpoint.TransactionIDMiddleware, endpoint.JwtMiddleware)
+	Router.Use(endpoint.ClientIPResolverMiddleware, endpoint.TransactionIDMiddleware, endpoint.AcceptLanguageMiddleware, endpoint.JwtMiddleware)
 
-	if config.Get("db.type") == "MYSQL" {
-		log.Warnf("Using MYSQL")
-		endpoint.UserRepo = connector.GetMySQLDBInstance()
-		endpoint.GroupRepo = connector.GetMySQLDBInstance()
-		endpoint.RoleRepo = connector.GetMySQLDBInstance()
-		endpoint.UserGroupRepo = connector.GetMySQLDBInstance()
-		endpoint.UserRoleRepo = connector.GetMySQLDBInstance()
-		endpoint.GroupRoleRepo = connector.GetMySQLDBInstance()
-		endpoint.TenantRepo = connector.GetMySQLDBInstance()
-		endpoint.RevocationRepo = connector.GetMySQLDBInstance()
-	} else {
-		panic(fmt.Sprintf("unknown database type %s. Correct your configuration 'db.type' or env-var 'AAA_DB_TYPE'. allowed values are INMEMORY or MYSQL", config.Get("db.type")))
-	}
-
-	if config.Get("mailer.type") == "DUMMY" {
-		endpoint.EmailSender = &connector.DummyMailSender{}
-	} else if config.Get("mailer.type") == "SENDMAIL" {
-		endpoint.EmailSender = &connector.SendMailSender{
-			Host:     config.Get("mailer.sendmail.host"),
-			Port:     config.GetInt("mailer.sendmail.port"),
-			User:     config.Get("mailer.sendmail.user"),
-			Password: config.Get("mailer.sendmail.password"),
-		}
-	} else if config.Get("mailer.type") == "SENDGRID" {
-		endpoint.EmailSender = &connector.SendGridSender{
-			Token: config.Get("mailer.sendgrid.token"),
-		}
-	} else {
-		panic(fmt.Sprintf("unknown mailer type %s. Correct your configuration 'mailer.type' or env-var 'AAA_MAILER_TYPE'. allowed values are DUMMY, SENDMAIL or SENDGRID", config.Get("mailer.type")))
-	}
-	mailer.Sender = endpoint.EmailSender
+	InitializeRepositories()
 
 	TokenFactory = GetJwtTokenFactory()
 	endpoint.TokenFactory = TokenFactory
 	endpoint.TokenFactory = TokenFactory
+
+	err := SetupAdmin(context.Background())
+	if err != nil {
+		panic(fmt.Sprintf("built in admin setup failed. got %s", err.Error()))
+	}
+
 	endpoint.InitializeRouter(Router)
 	Walk()
 }
@@ -149,7 +236,9 @@ func Start() {
 	startTime := time.Now()
 
 	InitializeRouter()
-	go mailer.Start()
+	go outbox.Start()
+	go endpoint.StartAuditCheckpoints()
+	go endpoint.StartWebhookDispatcher()
 
 	var wait time.Duration
 
@@ -198,7 +287,15 @@ func Start() {
 	// Block until we receive our signal.
 	<-c
 
-	mailer.Stop()
+	outbox.Stop()
+	if sender, ok := endpoint.EmailSender.(*connector.SendMailSender); ok {
+		sender.Close()
+	}
+	endpoint.StopAuditCheckpoints()
+	endpoint.StopWebhookDispatcher()
+	if eventSink != nil {
+		eventSink.Close()
+	}
 
 	// Create a deadline to wait for.
 	ctx, cancel := context.WithTimeout(context.Background(), wait)
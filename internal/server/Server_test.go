@@ -8,7 +8,7 @@ import (
 	"github.com/hyperjumptech/hansip/internal/config"
 	"github.com/hyperjumptech/hansip/internal/connector"
 	"github.com/hyperjumptech/hansip/internal/endpoint"
-	"github.com/hyperjumptech/hansip/internal/mailer"
+	"github.com/hyperjumptech/hansip/internal/outbox"
 	"github.com/sirupsen/logrus"
 	"net/http"
 	"net/http/httptest"
@@ -42,18 +42,20 @@ func TestAll(t *testing.T) {
 	if testing.Short() {
 		t.Log("Testing in short mode. Using in-memory database")
 		config.SetConfig("setup.admin.enable", "true")
+		config.SetConfig("server.devmode", "true")
 		config.SetConfig("db.type", "INMEMORY")
 		config.SetConfig("mailer.type", "DUMMY")
 	} else {
 		t.Log("Testing in normal mode. Using local mysql database")
 		config.SetConfig("setup.admin.enable", "true")
+		config.SetConfig("server.devmode", "true")
 		config.SetConfig("db.type", "MYSQL")
 		config.SetConfig("mailer.type", "DUMMY")
 	}
 
 	InitializeRouter()
-	go mailer.Start()
-	defer mailer.Stop()
+	go outbox.Start()
+	defer outbox.Stop()
 
 	dbUtil = connector.GetMySQLDBInstance()
 
@@ -67,6 +69,11 @@ func TestAll(t *testing.T) {
 		t.Error(err)
 		t.FailNow()
 	}
+	err = SetupAdmin(context.Background())
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
 
 	HealthCheckTesting(t)
 	_, refreshToken := DummyAdminLoginTesting(t)
@@ -0,0 +1,111 @@
+package server
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/hyperjumptech/hansip/internal/config"
+	"github.com/hyperjumptech/hansip/internal/endpoint"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// DefaultSetupAdminPassphrase is the built in admin passphrase documented in the README.
+	// It is only allowed when server.devmode is enabled.
+	DefaultSetupAdminPassphrase = "this must be change in the production"
+)
+
+var (
+	setupLog = log.WithField("go", "SetupAdmin")
+)
+
+// CheckSetupAdminPassphrase make sure the built in admin passphrase is not the default one, unless running in dev mode.
+func CheckSetupAdminPassphrase(passphrase string, devMode bool) error {
+	if len(passphrase) == 0 {
+		return fmt.Errorf("setup.admin.passphrase is empty. configure 'setup.admin.passphrase' or env-var 'AAA_SETUP_ADMIN_PASSPHRASE'")
+	}
+	if passphrase == DefaultSetupAdminPassphrase && !devMode {
+		return fmt.Errorf("refusing to create built in admin with the default passphrase outside dev mode. configure 'setup.admin.passphrase' or env-var 'AAA_SETUP_ADMIN_PASSPHRASE', or enable 'server.devmode'")
+	}
+	return nil
+}
+
+// SetupAdmin creates the hansip tenant, the admin role and the built in admin user if they are not yet exist.
+// It does nothing if setup.admin.enable is false. Calling it multiple times is safe.
+func SetupAdmin(ctx context.Context) error {
+	fLog := setupLog.WithField("func", "SetupAdmin")
+	if !config.GetBoolean("setup.admin.enable") {
+		fLog.Debugf("Built in admin setup is disabled")
+		return nil
+	}
+
+	email := config.Get("setup.admin.email")
+	passphrase := config.Get("setup.admin.passphrase")
+	err := CheckSetupAdminPassphrase(passphrase, config.GetBoolean("server.devmode"))
+	if err != nil {
+		return err
+	}
+	if passphrase == DefaultSetupAdminPassphrase {
+		fLog.Warnf("Built in admin %s is using the default passphrase. This is only allowed in dev mode", email)
+	}
+
+	hansipDomain := config.Get("hansip.domain")
+	hansipAdmin := config.Get("hansip.admin")
+
+	tenant, err := endpoint.TenantRepo.GetTenantByDomain(ctx, hansipDomain)
+	if err != nil {
+		fLog.Infof("Creating built-in tenant %s", hansipDomain)
+		tenant, err = endpoint.TenantRepo.CreateTenantRecord(ctx, "Hansip System", hansipDomain, "Hansip built in tenant")
+		if err != nil {
+			fLog.Errorf("TenantRepo.CreateTenantRecord got %s", err.Error())
+			return err
+		}
+	}
+
+	role, err := endpoint.RoleRepo.GetRoleByName(ctx, hansipAdmin, hansipDomain)
+	if err != nil {
+		fLog.Infof("Creating built-in role %s@%s", hansipAdmin, hansipDomain)
+		role, err = endpoint.RoleRepo.CreateRole(ctx, hansipAdmin, hansipDomain, "Hansip admin role")
+		if err != nil {
+			fLog.Errorf("RoleRepo.CreateRole got %s", err.Error())
+			return err
+		}
+	}
+
+	user, err := endpoint.UserRepo.GetUserByEmail(ctx, email)
+	if err != nil {
+		fLog.Infof("Creating built-in admin %s", email)
+		user, err = endpoint.UserRepo.CreateUserRecord(ctx, email, passphrase)
+		if err != nil {
+			fLog.Errorf("UserRepo.CreateUserRecord got %s", err.Error())
+			return err
+		}
+		user.Enabled = true
+		err = endpoint.UserRepo.UpdateUser(ctx, user)
+		if err != nil {
+			fLog.Errorf("UserRepo.UpdateUser got %s", err.Error())
+			return err
+		}
+	}
+
+	ur, err := endpoint.UserRoleRepo.GetUserRole(ctx, user, role)
+	if err != nil || ur == nil {
+		fLog.Infof("Adding built-in admin %s to role %s@%s", email, hansipAdmin, hansipDomain)
+		_, err = endpoint.UserRoleRepo.CreateUserRole(ctx, user, role)
+		if err != nil {
+			fLog.Errorf("UserRoleRepo.CreateUserRole got %s", err.Error())
+			return err
+		}
+	}
+
+	ut, err := endpoint.UserTenantRepo.GetUserTenant(ctx, user, tenant)
+	if err != nil || ut == nil {
+		fLog.Infof("Adding built-in admin %s to tenant %s", email, hansipDomain)
+		_, err = endpoint.UserTenantRepo.CreateUserTenant(ctx, user, tenant)
+		if err != nil {
+			fLog.Errorf("UserTenantRepo.CreateUserTenant got %s", err.Error())
+			return err
+		}
+	}
+	return nil
+}
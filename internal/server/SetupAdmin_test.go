@@ -0,0 +1,25 @@
+package server
+
+import "testing"
+
+func TestCheckSetupAdminPassphrase(t *testing.T) {
+	testData := []struct {
+		passphrase string
+		devMode    bool
+		valid      bool
+	}{
+		{DefaultSetupAdminPassphrase, true, true},
+		{DefaultSetupAdminPassphrase, false, false},
+		{"a much better production passphrase", false, true},
+		{"", true, false},
+	}
+	for _, td := range testData {
+		err := CheckSetupAdminPassphrase(td.passphrase, td.devMode)
+		if td.valid && err != nil {
+			t.Errorf("passphrase \"%s\" devmode %v should be accepted but got %s", td.passphrase, td.devMode, err.Error())
+		}
+		if !td.valid && err == nil {
+			t.Errorf("passphrase \"%s\" devmode %v should be refused", td.passphrase, td.devMode)
+		}
+	}
+}
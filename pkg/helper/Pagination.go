@@ -1,10 +1,58 @@
 package helper
 
 import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
 )
 
+const (
+	// FilterEqual matches field that equals to the value
+	FilterEqual = "eq"
+	// FilterNotEqual matches field that not equals to the value
+	FilterNotEqual = "ne"
+	// FilterPrefix matches field that starts with the value
+	FilterPrefix = "sw"
+	// FilterContains matches field that contains the value
+	FilterContains = "co"
+	// FilterGreaterThan matches field that is greater than the value
+	FilterGreaterThan = "gt"
+	// FilterGreaterOrEqual matches field that is greater than or equal to the value
+	FilterGreaterOrEqual = "ge"
+	// FilterLessThan matches field that is less than the value
+	FilterLessThan = "lt"
+	// FilterLessOrEqual matches field that is less than or equal to the value
+	FilterLessOrEqual = "le"
+)
+
+var (
+	filterOperators = []string{FilterEqual, FilterNotEqual, FilterPrefix, FilterContains, FilterGreaterThan, FilterGreaterOrEqual, FilterLessThan, FilterLessOrEqual}
+)
+
+// Filter is a single condition of a list query. Multiple filters are combined with AND.
+type Filter struct {
+	Field    string `json:"field"`
+	Operator string `json:"operator"`
+	Value    string `json:"value"`
+}
+
+// ParseFilter parses a filter expression in form of "field:operator:value", eg. "email:co:john" or "last_login:ge:2020-01-01".
+// If the operator is omitted, as in "suspended:true", equality is assumed.
+func ParseFilter(expression string) (*Filter, error) {
+	parts := strings.SplitN(expression, ":", 3)
+	if len(parts) < 2 || len(strings.TrimSpace(parts[0])) == 0 {
+		return nil, fmt.Errorf("invalid filter %s, expecting field:operator:value", expression)
+	}
+	field := strings.ToLower(strings.TrimSpace(parts[0]))
+	if len(parts) == 3 && StringArrayContainString(filterOperators, strings.ToLower(parts[1])) {
+		return &Filter{Field: field, Operator: strings.ToLower(parts[1]), Value: parts[2]}, nil
+	}
+	return &Filter{Field: field, Operator: FilterEqual, Value: strings.Join(parts[1:], ":")}, nil
+}
+
 // NewPageRequestFromRequest create new page request information based on the http request query
 func NewPageRequestFromRequest(r *http.Request) (*PageRequest, error) {
 	no := 1
@@ -34,7 +82,28 @@ func NewPageRequestFromRequest(r *http.Request) (*PageRequest, error) {
 	}
 
 	if len(queries.Get("sort")) > 0 {
-		sorting = queries.Get("sort")
+		sorting = strings.ToUpper(queries.Get("sort"))
+		if sorting != "ASC" && sorting != "DESC" {
+			return nil, fmt.Errorf("invalid sort %s, expecting ASC or DESC", queries.Get("sort"))
+		}
+	}
+
+	withTotal := false
+	if len(queries.Get("with_total")) > 0 {
+		wt, err := strconv.ParseBool(queries.Get("with_total"))
+		if err != nil {
+			return nil, err
+		}
+		withTotal = wt
+	}
+
+	filters := make([]*Filter, 0)
+	for _, expression := range queries["filter"] {
+		filter, err := ParseFilter(expression)
+		if err != nil {
+			return nil, err
+		}
+		filters = append(filters, filter)
 	}
 
 	ret := &PageRequest{
@@ -42,10 +111,61 @@ func NewPageRequestFromRequest(r *http.Request) (*PageRequest, error) {
 		PageSize: uint(size),
 		OrderBy:  order,
 		Sort:     sorting,
+		Filters:  filters,
+	}
+	// presence of cursor parameter, even empty for the first page, switch the listing into keyset pagination.
+	if _, ok := queries["cursor"]; ok {
+		ret.UseCursor = true
+		ret.Cursor = queries.Get("cursor")
+		ret.WithTotal = withTotal
 	}
 	return ret, nil
 }
 
+// NewCursorPage create a new page structure for keyset paginated listing.
+// The number of items, cursors and the next/prev flags are filled after the items are fetched.
+func NewCursorPage(pageRequest *PageRequest, totalItems uint) *Page {
+	return &Page{
+		Sort:       pageRequest.Sort,
+		PageSize:   pageRequest.PageSize,
+		OrderBy:    pageRequest.OrderBy,
+		TotalItems: totalItems,
+	}
+}
+
+// Cursor is a position within a keyset paginated listing. Client only sees it as an opaque string.
+type Cursor struct {
+	// OrderBy the column the listing is ordered by
+	OrderBy string `json:"o"`
+	// Sort ASC or DESC
+	Sort string `json:"s"`
+	// Value of the ordered column at the position
+	Value string `json:"v"`
+	// RecID of the item at the position, to break ties of equal values
+	RecID string `json:"i"`
+	// Backward true if the listing should go toward the previous items
+	Backward bool `json:"b,omitempty"`
+}
+
+// Encode the cursor into an opaque url safe string
+func (c *Cursor) Encode() string {
+	bytes, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(bytes)
+}
+
+// DecodeCursor decodes cursor string produced by Cursor.Encode
+func DecodeCursor(cursor string) (*Cursor, error) {
+	bytes, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+	c := &Cursor{}
+	if err := json.Unmarshal(bytes, c); err != nil || len(c.OrderBy) == 0 || len(c.RecID) == 0 {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+	return c, nil
+}
+
 // NewPage create a new page structure based on page request and total number of items.
 func NewPage(pageRequest *PageRequest, totalItems uint) *Page {
 	page := &Page{
@@ -133,12 +253,22 @@ type Page struct {
 	OffsetStart uint   `json:"-"`
 	OffsetEnd   uint   `json:"-"`
 	Sort        string `json:"sort"`
+	NextCursor  string `json:"next_cursor,omitempty"`
+	PrevCursor  string `json:"prev_cursor,omitempty"`
 }
 
 // PageRequest define a list query specification in paginated fashion.
 type PageRequest struct {
-	No       uint   `json:"no"`
-	PageSize uint   `json:"page_size"`
-	OrderBy  string `json:"order_by"`
-	Sort     string `json:"sort"`
+	No       uint      `json:"no"`
+	PageSize uint      `json:"page_size"`
+	OrderBy  string    `json:"order_by"`
+	Sort     string    `json:"sort"`
+	Filters  []*Filter `json:"filters"`
+
+	// UseCursor switch to keyset pagination, No is ignored and Cursor is used instead.
+	UseCursor bool `json:"use_cursor"`
+	// Cursor where the listing continue, empty for the first page
+	Cursor string `json:"cursor"`
+	// WithTotal count the total items in keyset pagination, which is skipped by default
+	WithTotal bool `json:"with_total"`
 }
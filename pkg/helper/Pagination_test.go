@@ -229,6 +229,85 @@ func TestNewPageRequestFromRequest(t *testing.T) {
 	}
 }
 
+func TestNewPageRequestFromRequestFilter(t *testing.T) {
+	req := httptest.NewRequest("GET", "/?filter=email:co:example.com&filter=enabled:true&filter=last_login:ge:2020-01-01&sort=desc", nil)
+	preq, err := NewPageRequestFromRequest(req)
+	if err != nil {
+		t.Fatalf("error got %s", err.Error())
+	}
+	if preq.Sort != "DESC" {
+		t.Errorf("expect sort DESC but %s", preq.Sort)
+	}
+	if len(preq.Filters) != 3 {
+		t.Fatalf("expect 3 filters but %d", len(preq.Filters))
+	}
+	expects := []*Filter{
+		{Field: "email", Operator: FilterContains, Value: "example.com"},
+		{Field: "enabled", Operator: FilterEqual, Value: "true"},
+		{Field: "last_login", Operator: FilterGreaterOrEqual, Value: "2020-01-01"},
+	}
+	for i, expect := range expects {
+		if *preq.Filters[i] != *expect {
+			t.Errorf("filter %d expect %v but %v", i, expect, preq.Filters[i])
+		}
+	}
+
+	req = httptest.NewRequest("GET", "/?sort=RANDOM", nil)
+	if _, err = NewPageRequestFromRequest(req); err == nil {
+		t.Errorf("expect invalid sort to be rejected")
+	}
+	req = httptest.NewRequest("GET", "/?filter=email", nil)
+	if _, err = NewPageRequestFromRequest(req); err == nil {
+		t.Errorf("expect filter without value to be rejected")
+	}
+}
+
+func TestNewPageRequestFromRequestCursor(t *testing.T) {
+	preq, err := NewPageRequestFromRequest(httptest.NewRequest("GET", "/?page_size=5", nil))
+	if err != nil {
+		t.Fatalf("error got %s", err.Error())
+	}
+	if preq.UseCursor {
+		t.Errorf("expect page number listing without cursor")
+	}
+	preq, err = NewPageRequestFromRequest(httptest.NewRequest("GET", "/?cursor=&with_total=true", nil))
+	if err != nil {
+		t.Fatalf("error got %s", err.Error())
+	}
+	if !preq.UseCursor || len(preq.Cursor) > 0 || !preq.WithTotal {
+		t.Errorf("expect first cursor page with total but %v", preq)
+	}
+
+	cursor := &Cursor{OrderBy: "EMAIL", Sort: "DESC", Value: "a@b.c", RecID: "abc", Backward: true}
+	decoded, err := DecodeCursor(cursor.Encode())
+	if err != nil {
+		t.Fatalf("error got %s", err.Error())
+	}
+	if *decoded != *cursor {
+		t.Errorf("expect %v but %v", cursor, decoded)
+	}
+	if _, err := DecodeCursor("!!"); err == nil {
+		t.Errorf("expect invalid cursor to be rejected")
+	}
+}
+
+func TestParseFilter(t *testing.T) {
+	filter, err := ParseFilter("last_seen:2020-01-01 10:00:00")
+	if err != nil {
+		t.Fatalf("error got %s", err.Error())
+	}
+	if filter.Operator != FilterEqual || filter.Value != "2020-01-01 10:00:00" {
+		t.Errorf("expect equality with the whole value but %v", filter)
+	}
+	filter, err = ParseFilter("Email:SW:john")
+	if err != nil {
+		t.Fatalf("error got %s", err.Error())
+	}
+	if filter.Field != "email" || filter.Operator != FilterPrefix || filter.Value != "john" {
+		t.Errorf("unexpected filter %v", filter)
+	}
+}
+
 func TestNewPage(t *testing.T) {
 	for idx, testPage := range pages {
 		pr := &PageRequest{
@@ -2,6 +2,8 @@ package helper
 
 import (
 	"bytes"
+	crand "crypto/rand"
+	"math/big"
 	"math/rand"
 	"time"
 )
@@ -38,3 +40,19 @@ func MakeRandomString(length int, upperAlphas, lowerAlphas, numbers, space bool)
 	}
 	return string(buff.Bytes())
 }
+
+// MakeSecretString produces a string of upper, lower alphabets and numbers picked by a cryptographically secure
+// random generator, to be used for secrets such as tokens. MakeRandomString is predictable and must not be used for them.
+func MakeSecretString(length int) (string, error) {
+	bpool := []byte(upper + lower + number)
+	max := big.NewInt(int64(len(bpool)))
+	buff := bytes.Buffer{}
+	for buff.Len() < length {
+		n, err := crand.Int(crand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		buff.WriteByte(bpool[n.Int64()])
+	}
+	return string(buff.Bytes()), nil
+}
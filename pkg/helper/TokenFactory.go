@@ -25,6 +25,7 @@ type HansipToken struct {
 // TokenFactory defines a token factory function to implement
 type TokenFactory interface {
 	CreateTokenPair(subject string, audience []string, additional map[string]interface{}) (string, string, error)
+	CreateTokenPairWithAge(subject string, audience []string, additional map[string]interface{}, accessTokenAge, refreshTokenAge time.Duration) (string, string, error)
 	ReadToken(token string) (*HansipToken, error)
 	RefreshToken(refreshToken string) (string, error)
 }
@@ -55,6 +56,12 @@ type DefaultTokenFactory struct {
 
 // CreateTokenPair create new Access and Refresh token pair
 func (tf *DefaultTokenFactory) CreateTokenPair(subject string, audience []string, additional map[string]interface{}) (string, string, error) {
+	return tf.CreateTokenPairWithAge(subject, audience, additional, tf.AccessTokenDuration, tf.RefreshTokenDuration)
+}
+
+// CreateTokenPairWithAge create new Access and Refresh token pair with specific token age.
+// The access token age is kept in the refresh token so refreshed access token will have the same age.
+func (tf *DefaultTokenFactory) CreateTokenPairWithAge(subject string, audience []string, additional map[string]interface{}, accessTokenAge, refreshTokenAge time.Duration) (string, string, error) {
 	tf.mutex.Lock()
 	defer tf.mutex.Unlock()
 	accessAdditional := make(map[string]interface{})
@@ -67,12 +74,15 @@ func (tf *DefaultTokenFactory) CreateTokenPair(subject string, audience []string
 	}
 	accessAdditional["type"] = "access"
 	refreshAdditional["type"] = "refresh"
+	if accessTokenAge != tf.AccessTokenDuration {
+		refreshAdditional["access_age"] = int64(accessTokenAge / time.Second)
+	}
 
-	access, err := CreateJWTStringToken(tf.SignKey, tf.SignMethod, tf.Issuer, subject, audience, time.Now(), time.Now(), time.Now().Add(tf.AccessTokenDuration), accessAdditional)
+	access, err := CreateJWTStringToken(tf.SignKey, tf.SignMethod, tf.Issuer, subject, audience, time.Now(), time.Now(), time.Now().Add(accessTokenAge), accessAdditional)
 	if err != nil {
 		return "", "", err
 	}
-	refresh, err := CreateJWTStringToken(tf.SignKey, tf.SignMethod, tf.Issuer, subject, audience, time.Now(), time.Now(), time.Now().Add(tf.RefreshTokenDuration), refreshAdditional)
+	refresh, err := CreateJWTStringToken(tf.SignKey, tf.SignMethod, tf.Issuer, subject, audience, time.Now(), time.Now(), time.Now().Add(refreshTokenAge), refreshAdditional)
 	if err != nil {
 		return "", "", err
 	}
@@ -117,7 +127,14 @@ func (tf *DefaultTokenFactory) RefreshToken(refreshToken string) (string, error)
 		return "", fmt.Errorf("unknown token type")
 	}
 	hToken.Additional["type"] = "access"
-	access, err := CreateJWTStringToken(tf.SignKey, tf.SignMethod, tf.Issuer, hToken.Subject, hToken.Audiences, hToken.IssuedAt, hToken.NotBefore, time.Now().Add(tf.AccessTokenDuration), hToken.Additional)
+	accessTokenAge := tf.AccessTokenDuration
+	if age, ok := hToken.Additional["access_age"]; ok {
+		if f, ok := age.(float64); ok {
+			accessTokenAge = time.Duration(f) * time.Second
+		}
+		delete(hToken.Additional, "access_age")
+	}
+	access, err := CreateJWTStringToken(tf.SignKey, tf.SignMethod, tf.Issuer, hToken.Subject, hToken.Audiences, hToken.IssuedAt, hToken.NotBefore, time.Now().Add(accessTokenAge), hToken.Additional)
 	if err != nil {
 		return "", err
 	}
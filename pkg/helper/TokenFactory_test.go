@@ -63,3 +63,32 @@ func TestReadJWTStringToken(t *testing.T) {
 		t.Errorf("expect type %s but %s", additional["type"], add["type"])
 	}
 }
+
+func TestCreateTokenPairWithAge(t *testing.T) {
+	tf := NewTokenFactory(signKey, signMethod, issuer, 5*time.Minute, time.Hour)
+	access, refresh, err := tf.CreateTokenPairWithAge(subject, audience, nil, 2*time.Minute, time.Hour)
+	if err != nil {
+		t.Fatalf("got %s", err)
+	}
+	ht, err := tf.ReadToken(access)
+	if err != nil {
+		t.Fatalf("got %s", err)
+	}
+	if ht.Expire.After(time.Now().Add(3 * time.Minute)) {
+		t.Errorf("expect access token to expire in 2 minutes but %s", ht.Expire)
+	}
+	refreshed, err := tf.RefreshToken(refresh)
+	if err != nil {
+		t.Fatalf("got %s", err)
+	}
+	ht, err = tf.ReadToken(refreshed)
+	if err != nil {
+		t.Fatalf("got %s", err)
+	}
+	if ht.Expire.After(time.Now().Add(3 * time.Minute)) {
+		t.Errorf("expect refreshed access token to expire in 2 minutes but %s", ht.Expire)
+	}
+	if _, ok := ht.Additional["access_age"]; ok {
+		t.Errorf("refreshed access token should not carry access_age")
+	}
+}
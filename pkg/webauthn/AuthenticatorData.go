@@ -0,0 +1,96 @@
+package webauthn
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+const (
+	// FlagUserPresent the user touched the authenticator
+	FlagUserPresent byte = 0x01
+	// FlagUserVerified the authenticator verified the user, eg. with a PIN or a fingerprint
+	FlagUserVerified byte = 0x04
+	// FlagBackupEligible the credential may be synced to other devices, eg. a passkey
+	FlagBackupEligible byte = 0x08
+	// FlagBackupState the credential is synced to other devices
+	FlagBackupState byte = 0x10
+	// FlagAttestedCredentialData the authenticator data holds the credential created
+	FlagAttestedCredentialData byte = 0x40
+	// FlagExtensionData the authenticator data holds extension outputs
+	FlagExtensionData byte = 0x80
+
+	// minAuthenticatorDataLength is the length of the RP ID hash, flags and sign count
+	minAuthenticatorDataLength = 37
+)
+
+var (
+	// ErrInvalidAuthenticatorData the authenticator data is malformed
+	ErrInvalidAuthenticatorData = errors.New("invalid authenticator data")
+)
+
+// AuthenticatorData is the data an authenticator signs, https://www.w3.org/TR/webauthn-2/#sctn-authenticator-data
+type AuthenticatorData struct {
+	RPIDHash  []byte
+	Flags     byte
+	SignCount uint32
+	// AAGUID, CredentialID and CredentialPublicKey are set when the credential is created
+	AAGUID       []byte
+	CredentialID []byte
+	// CredentialPublicKey is the COSE_Key of the credential
+	CredentialPublicKey []byte
+	// Extensions is the CBOR of the extension outputs, if any
+	Extensions []byte
+}
+
+// Has check if the flag is set
+func (d *AuthenticatorData) Has(flag byte) bool {
+	return d.Flags&flag == flag
+}
+
+// ParseAuthenticatorData parses the authenticator data of a registration or an assertion
+func ParseAuthenticatorData(raw []byte) (*AuthenticatorData, error) {
+	if len(raw) < minAuthenticatorDataLength {
+		return nil, fmt.Errorf("%w, %d bytes only", ErrInvalidAuthenticatorData, len(raw))
+	}
+	data := &AuthenticatorData{
+		RPIDHash:  raw[:32],
+		Flags:     raw[32],
+		SignCount: binary.BigEndian.Uint32(raw[33:37]),
+	}
+	rest := raw[minAuthenticatorDataLength:]
+	if data.Has(FlagAttestedCredentialData) {
+		if len(rest) < 18 {
+			return nil, fmt.Errorf("%w, truncated attested credential data", ErrInvalidAuthenticatorData)
+		}
+		data.AAGUID = rest[:16]
+		length := int(binary.BigEndian.Uint16(rest[16:18]))
+		rest = rest[18:]
+		if length == 0 || length > 1023 || length > len(rest) {
+			return nil, fmt.Errorf("%w, credential id of %d bytes", ErrInvalidAuthenticatorData, length)
+		}
+		data.CredentialID = rest[:length]
+		rest = rest[length:]
+		_, after, err := decodeCBOR(rest)
+		if err != nil {
+			return nil, fmt.Errorf("%w, credential public key got %s", ErrInvalidAuthenticatorData, err.Error())
+		}
+		data.CredentialPublicKey = rest[:len(rest)-len(after)]
+		rest = after
+	}
+	if data.Has(FlagExtensionData) {
+		_, after, err := decodeCBOR(rest)
+		if err != nil {
+			return nil, fmt.Errorf("%w, extensions got %s", ErrInvalidAuthenticatorData, err.Error())
+		}
+		data.Extensions = rest[:len(rest)-len(after)]
+		rest = after
+	}
+	if len(rest) > 0 {
+		return nil, fmt.Errorf("%w, %d trailing bytes", ErrInvalidAuthenticatorData, len(rest))
+	}
+	if data.Has(FlagBackupState) && !data.Has(FlagBackupEligible) {
+		return nil, fmt.Errorf("%w, backed up credential not eligible for backup", ErrInvalidAuthenticatorData)
+	}
+	return data, nil
+}
@@ -0,0 +1,165 @@
+package webauthn
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+const (
+	// cborMaxDepth limits the nesting of the items decoded, authenticators never nest deeper
+	cborMaxDepth = 16
+)
+
+var (
+	// ErrCBOR the data is not the CBOR this package decodes
+	ErrCBOR = errors.New("invalid CBOR")
+)
+
+// decodeCBOR decodes the first CBOR item of the data and returns it with the bytes following it.
+// It decodes the subset authenticators use, definite lengths only: integers as int64, byte strings as []byte,
+// text strings as string, arrays as []interface{}, maps as map[interface{}]interface{} keyed by int64 or string,
+// booleans and null. Tags are skipped.
+func decodeCBOR(data []byte) (interface{}, []byte, error) {
+	return decodeCBORItem(data, 0)
+}
+
+// cborHead reads the major type and the argument of the item head, returning the bytes following it
+func cborHead(data []byte) (byte, uint64, []byte, error) {
+	if len(data) == 0 {
+		return 0, 0, nil, fmt.Errorf("%w, unexpected end of data", ErrCBOR)
+	}
+	major := data[0] >> 5
+	info := data[0] & 0x1f
+	data = data[1:]
+	switch {
+	case info < 24:
+		return major, uint64(info), data, nil
+	case info == 24:
+		if len(data) < 1 {
+			return 0, 0, nil, fmt.Errorf("%w, unexpected end of data", ErrCBOR)
+		}
+		return major, uint64(data[0]), data[1:], nil
+	case info == 25:
+		if len(data) < 2 {
+			return 0, 0, nil, fmt.Errorf("%w, unexpected end of data", ErrCBOR)
+		}
+		return major, uint64(binary.BigEndian.Uint16(data)), data[2:], nil
+	case info == 26:
+		if len(data) < 4 {
+			return 0, 0, nil, fmt.Errorf("%w, unexpected end of data", ErrCBOR)
+		}
+		return major, uint64(binary.BigEndian.Uint32(data)), data[4:], nil
+	case info == 27:
+		if len(data) < 8 {
+			return 0, 0, nil, fmt.Errorf("%w, unexpected end of data", ErrCBOR)
+		}
+		return major, binary.BigEndian.Uint64(data), data[8:], nil
+	}
+	return 0, 0, nil, fmt.Errorf("%w, indefinite or reserved length %d", ErrCBOR, info)
+}
+
+func decodeCBORItem(data []byte, depth int) (interface{}, []byte, error) {
+	if depth > cborMaxDepth {
+		return nil, nil, fmt.Errorf("%w, nested too deep", ErrCBOR)
+	}
+	if len(data) > 0 && data[0]>>5 == 7 {
+		// simple values and floats have their own head
+		switch data[0] {
+		case 0xf4:
+			return false, data[1:], nil
+		case 0xf5:
+			return true, data[1:], nil
+		case 0xf6, 0xf7:
+			return nil, data[1:], nil
+		}
+		return nil, nil, fmt.Errorf("%w, unsupported simple value 0x%x", ErrCBOR, data[0])
+	}
+	major, arg, rest, err := cborHead(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	switch major {
+	case 0:
+		if arg > math.MaxInt64 {
+			return nil, nil, fmt.Errorf("%w, integer overflow", ErrCBOR)
+		}
+		return int64(arg), rest, nil
+	case 1:
+		if arg > math.MaxInt64 {
+			return nil, nil, fmt.Errorf("%w, integer overflow", ErrCBOR)
+		}
+		return -1 - int64(arg), rest, nil
+	case 2, 3:
+		if arg > uint64(len(rest)) {
+			return nil, nil, fmt.Errorf("%w, string longer than the data", ErrCBOR)
+		}
+		if major == 3 {
+			return string(rest[:arg]), rest[arg:], nil
+		}
+		b := make([]byte, arg)
+		copy(b, rest[:arg])
+		return b, rest[arg:], nil
+	case 4:
+		// every item takes at least a byte
+		if arg > uint64(len(rest)) {
+			return nil, nil, fmt.Errorf("%w, array longer than the data", ErrCBOR)
+		}
+		items := make([]interface{}, 0, arg)
+		for i := uint64(0); i < arg; i++ {
+			var item interface{}
+			item, rest, err = decodeCBORItem(rest, depth+1)
+			if err != nil {
+				return nil, nil, err
+			}
+			items = append(items, item)
+		}
+		return items, rest, nil
+	case 5:
+		if arg > uint64(len(rest))/2 {
+			return nil, nil, fmt.Errorf("%w, map longer than the data", ErrCBOR)
+		}
+		m := make(map[interface{}]interface{}, arg)
+		for i := uint64(0); i < arg; i++ {
+			var key, value interface{}
+			key, rest, err = decodeCBORItem(rest, depth+1)
+			if err != nil {
+				return nil, nil, err
+			}
+			switch key.(type) {
+			case int64, string:
+			default:
+				return nil, nil, fmt.Errorf("%w, map key of type %T", ErrCBOR, key)
+			}
+			if _, duplicate := m[key]; duplicate {
+				return nil, nil, fmt.Errorf("%w, duplicate map key %v", ErrCBOR, key)
+			}
+			value, rest, err = decodeCBORItem(rest, depth+1)
+			if err != nil {
+				return nil, nil, err
+			}
+			m[key] = value
+		}
+		return m, rest, nil
+	case 6:
+		return decodeCBORItem(rest, depth+1)
+	}
+	return nil, nil, fmt.Errorf("%w, unsupported major type %d", ErrCBOR, major)
+}
+
+// cborMapOf decodes data being exactly one CBOR map
+func cborMapOf(data []byte) (map[interface{}]interface{}, error) {
+	item, rest, err := decodeCBOR(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) > 0 {
+		return nil, fmt.Errorf("%w, %d bytes after the item", ErrCBOR, len(rest))
+	}
+	m, ok := item.(map[interface{}]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%w, expect a map but got %T", ErrCBOR, item)
+	}
+	return m, nil
+}
@@ -0,0 +1,81 @@
+package webauthn
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestDecodeCBOR(t *testing.T) {
+	// {"fmt": "none", 1: -7, "a": [h'0102', true, null]}
+	data := []byte{0xa3, 0x63, 'f', 'm', 't', 0x64, 'n', 'o', 'n', 'e', 0x01, 0x26, 0x61, 'a', 0x83, 0x42, 0x01, 0x02, 0xf5, 0xf6, 0xff}
+	item, rest, err := decodeCBOR(data)
+	if err != nil {
+		t.Fatalf("got %s", err.Error())
+	}
+	if !bytes.Equal(rest, []byte{0xff}) {
+		t.Errorf("expect the byte after the item left but got %x", rest)
+	}
+	m, ok := item.(map[interface{}]interface{})
+	if !ok {
+		t.Fatalf("expect a map but got %T", item)
+	}
+	if m["fmt"] != "none" {
+		t.Errorf("expect fmt none but got %v", m["fmt"])
+	}
+	if m[int64(1)] != int64(-7) {
+		t.Errorf("expect 1 to be -7 but got %v", m[int64(1)])
+	}
+	array, ok := m["a"].([]interface{})
+	if !ok || len(array) != 3 {
+		t.Fatalf("expect an array of 3 but got %v", m["a"])
+	}
+	if !bytes.Equal(array[0].([]byte), []byte{1, 2}) || array[1] != true || array[2] != nil {
+		t.Errorf("unexpected array %v", array)
+	}
+}
+
+func TestDecodeCBORLongHeads(t *testing.T) {
+	// 500 as a 2 bytes argument, -1000 as a negative integer
+	item, _, err := decodeCBOR([]byte{0x19, 0x01, 0xf4})
+	if err != nil || item != int64(500) {
+		t.Errorf("expect 500 but got %v, %v", item, err)
+	}
+	item, _, err = decodeCBOR([]byte{0x39, 0x03, 0xe7})
+	if err != nil || item != int64(-1000) {
+		t.Errorf("expect -1000 but got %v, %v", item, err)
+	}
+}
+
+func TestDecodeCBORInvalid(t *testing.T) {
+	invalid := map[string][]byte{
+		"empty":            {},
+		"truncated string": {0x45, 0x01},
+		"huge array":       {0x9a, 0xff, 0xff, 0xff, 0xff},
+		"indefinite":       {0x9f, 0x01, 0xff},
+		"byte key":         {0xa1, 0x41, 0x01, 0x01},
+		"duplicate key":    {0xa2, 0x01, 0x01, 0x01, 0x02},
+		"float":            {0xf9, 0x3c, 0x00},
+	}
+	for name, data := range invalid {
+		if _, _, err := decodeCBOR(data); !errors.Is(err, ErrCBOR) {
+			t.Errorf("%s should be invalid but got %v", name, err)
+		}
+	}
+	nested := bytes.Repeat([]byte{0x81}, cborMaxDepth+2)
+	if _, _, err := decodeCBOR(append(nested, 0x01)); !errors.Is(err, ErrCBOR) {
+		t.Errorf("deep nesting should be invalid but got %v", err)
+	}
+}
+
+func TestCBORMapOf(t *testing.T) {
+	if _, err := cborMapOf([]byte{0xa0, 0x00}); err == nil {
+		t.Errorf("trailing bytes should be rejected")
+	}
+	if _, err := cborMapOf([]byte{0x80}); err == nil {
+		t.Errorf("an array is not a map")
+	}
+	if m, err := cborMapOf([]byte{0xa0}); err != nil || len(m) != 0 {
+		t.Errorf("expect an empty map but got %v, %v", m, err)
+	}
+}
@@ -0,0 +1,142 @@
+package webauthn
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+const (
+	// AlgES256 ECDSA with P-256 and SHA-256
+	AlgES256 int64 = -7
+	// AlgEdDSA EdDSA with Ed25519
+	AlgEdDSA int64 = -8
+	// AlgRS256 RSASSA-PKCS1-v1_5 with SHA-256
+	AlgRS256 int64 = -257
+
+	coseKty    int64 = 1
+	coseAlg    int64 = 3
+	coseCrv    int64 = -1
+	coseX      int64 = -2
+	coseY      int64 = -3
+	coseRSAN   int64 = -1
+	coseRSAE   int64 = -2
+	coseKtyOKP int64 = 1
+	coseKtyEC2 int64 = 2
+	coseKtyRSA int64 = 3
+	coseP256   int64 = 1
+	coseEd     int64 = 6
+)
+
+var (
+	// ErrUnsupportedAlgorithm the credential key is not of an algorithm this package verifies
+	ErrUnsupportedAlgorithm = errors.New("unsupported credential algorithm")
+	// ErrInvalidSignature the signature does not verify with the credential key
+	ErrInvalidSignature = errors.New("invalid signature")
+
+	// SupportedAlgorithms are the COSE algorithms of the credentials this package verifies, the preferred first
+	SupportedAlgorithms = []int64{AlgES256, AlgEdDSA, AlgRS256}
+)
+
+// PublicKey is a credential public key and the algorithm it signs with
+type PublicKey struct {
+	Algorithm int64
+	Key       crypto.PublicKey
+}
+
+// coseInt returns the integer of the key in the COSE map
+func coseInt(m map[interface{}]interface{}, key int64) (int64, bool) {
+	v, ok := m[key].(int64)
+	return v, ok
+}
+
+// coseBytes returns the byte string of the key in the COSE map
+func coseBytes(m map[interface{}]interface{}, key int64) ([]byte, bool) {
+	v, ok := m[key].([]byte)
+	return v, ok
+}
+
+// ParsePublicKey parses a COSE_Key of the supported algorithms, the encoding credential public keys are stored in
+func ParsePublicKey(cose []byte) (*PublicKey, error) {
+	m, err := cborMapOf(cose)
+	if err != nil {
+		return nil, err
+	}
+	kty, ok := coseInt(m, coseKty)
+	if !ok {
+		return nil, fmt.Errorf("%w, missing key type", ErrUnsupportedAlgorithm)
+	}
+	alg, ok := coseInt(m, coseAlg)
+	if !ok {
+		return nil, fmt.Errorf("%w, missing algorithm", ErrUnsupportedAlgorithm)
+	}
+	switch {
+	case alg == AlgES256 && kty == coseKtyEC2:
+		crv, _ := coseInt(m, coseCrv)
+		x, okX := coseBytes(m, coseX)
+		y, okY := coseBytes(m, coseY)
+		if crv != coseP256 || !okX || !okY || len(x) != 32 || len(y) != 32 {
+			return nil, fmt.Errorf("%w, invalid P-256 key", ErrUnsupportedAlgorithm)
+		}
+		key := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !key.Curve.IsOnCurve(key.X, key.Y) {
+			return nil, fmt.Errorf("%w, point not on P-256", ErrUnsupportedAlgorithm)
+		}
+		return &PublicKey{Algorithm: alg, Key: key}, nil
+	case alg == AlgEdDSA && kty == coseKtyOKP:
+		crv, _ := coseInt(m, coseCrv)
+		x, ok := coseBytes(m, coseX)
+		if crv != coseEd || !ok || len(x) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("%w, invalid Ed25519 key", ErrUnsupportedAlgorithm)
+		}
+		return &PublicKey{Algorithm: alg, Key: ed25519.PublicKey(x)}, nil
+	case alg == AlgRS256 && kty == coseKtyRSA:
+		n, okN := coseBytes(m, coseRSAN)
+		e, okE := coseBytes(m, coseRSAE)
+		if !okN || !okE || len(e) == 0 || len(e) > 4 || len(n) < 256 {
+			return nil, fmt.Errorf("%w, invalid RSA key", ErrUnsupportedAlgorithm)
+		}
+		exponent := int(new(big.Int).SetBytes(e).Int64())
+		return &PublicKey{Algorithm: alg, Key: &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: exponent}}, nil
+	}
+	return nil, fmt.Errorf("%w, algorithm %d of key type %d", ErrUnsupportedAlgorithm, alg, kty)
+}
+
+// Verify checks the signature of the data with the key
+func (k *PublicKey) Verify(data, signature []byte) error {
+	switch key := k.Key.(type) {
+	case *ecdsa.PublicKey:
+		if k.Algorithm != AlgES256 {
+			break
+		}
+		digest := sha256.Sum256(data)
+		if !ecdsa.VerifyASN1(key, digest[:], signature) {
+			return ErrInvalidSignature
+		}
+		return nil
+	case ed25519.PublicKey:
+		if k.Algorithm != AlgEdDSA {
+			break
+		}
+		if !ed25519.Verify(key, data, signature) {
+			return ErrInvalidSignature
+		}
+		return nil
+	case *rsa.PublicKey:
+		if k.Algorithm != AlgRS256 {
+			break
+		}
+		digest := sha256.Sum256(data)
+		if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature); err != nil {
+			return ErrInvalidSignature
+		}
+		return nil
+	}
+	return fmt.Errorf("%w, algorithm %d with key %T", ErrUnsupportedAlgorithm, k.Algorithm, k.Key)
+}
@@ -0,0 +1,480 @@
+package webauthn
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	// CredentialType is the type of every WebAuthn credential
+	CredentialType = "public-key"
+
+	// UserVerificationRequired the authenticator must verify the user, eg. with a PIN or a fingerprint
+	UserVerificationRequired = "required"
+	// UserVerificationPreferred the authenticator verifies the user if it can
+	UserVerificationPreferred = "preferred"
+	// UserVerificationDiscouraged the authenticator should not verify the user
+	UserVerificationDiscouraged = "discouraged"
+
+	// ceremonyCreate and ceremonyGet are the client data types of registrations and assertions
+	ceremonyCreate = "webauthn.create"
+	ceremonyGet    = "webauthn.get"
+
+	// challengeLength is the number of random bytes of a challenge
+	challengeLength = 32
+)
+
+var (
+	// ErrInvalidClientData the client data is malformed or of another ceremony
+	ErrInvalidClientData = errors.New("invalid client data")
+	// ErrChallengeMismatch the client signed another challenge
+	ErrChallengeMismatch = errors.New("challenge mismatch")
+	// ErrOriginMismatch the ceremony ran on an origin not allowed
+	ErrOriginMismatch = errors.New("origin not allowed")
+	// ErrRPIDMismatch the credential is scoped to another relying party
+	ErrRPIDMismatch = errors.New("relying party id mismatch")
+	// ErrUserNotPresent the user did not touch the authenticator
+	ErrUserNotPresent = errors.New("user not present")
+	// ErrUserNotVerified the authenticator did not verify the user while it is required
+	ErrUserNotVerified = errors.New("user not verified")
+	// ErrInvalidAttestation the attestation is malformed or does not verify
+	ErrInvalidAttestation = errors.New("invalid attestation")
+	// ErrUnsupportedAttestation the attestation is of a format this package does not verify
+	ErrUnsupportedAttestation = errors.New("unsupported attestation format")
+	// ErrSignCountRegression the sign count did not increase, the authenticator may have been cloned
+	ErrSignCountRegression = errors.New("sign count did not increase")
+
+	// oidFIDOGenCeAAGUID is the certificate extension holding the AAGUID of the authenticator model
+	oidFIDOGenCeAAGUID = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 45724, 1, 1, 4}
+)
+
+// URLEncodedBase64 is binary data encoded in JSON as unpadded base64url, as the browsers do
+type URLEncodedBase64 []byte
+
+// MarshalJSON encodes the data as unpadded base64url
+func (b URLEncodedBase64) MarshalJSON() ([]byte, error) {
+	return json.Marshal(base64.RawURLEncoding.EncodeToString(b))
+}
+
+// UnmarshalJSON decodes base64url, padded or not
+func (b *URLEncodedBase64) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	decoded, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+	if err != nil {
+		return err
+	}
+	*b = decoded
+	return nil
+}
+
+// String returns the unpadded base64url of the data
+func (b URLEncodedBase64) String() string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// NewChallenge returns a random challenge for a ceremony
+func NewChallenge() (URLEncodedBase64, error) {
+	challenge := make([]byte, challengeLength)
+	if _, err := rand.Read(challenge); err != nil {
+		return nil, err
+	}
+	return challenge, nil
+}
+
+// RelyingPartyEntity is the relying party in the creation options
+type RelyingPartyEntity struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// UserEntity is the user the credential is created for
+type UserEntity struct {
+	ID          URLEncodedBase64 `json:"id"`
+	Name        string           `json:"name"`
+	DisplayName string           `json:"displayName"`
+}
+
+// CredentialParameter is a credential algorithm the relying party accepts
+type CredentialParameter struct {
+	Type      string `json:"type"`
+	Algorithm int64  `json:"alg"`
+}
+
+// CredentialDescriptor identifies a credential to exclude from a registration or to allow in an assertion
+type CredentialDescriptor struct {
+	Type       string           `json:"type"`
+	ID         URLEncodedBase64 `json:"id"`
+	Transports []string         `json:"transports,omitempty"`
+}
+
+// AuthenticatorSelection tells the authenticators the relying party wants
+type AuthenticatorSelection struct {
+	ResidentKey        string `json:"residentKey,omitempty"`
+	RequireResidentKey bool   `json:"requireResidentKey"`
+	UserVerification   string `json:"userVerification,omitempty"`
+}
+
+// CreationOptions are the options of navigator.credentials.create, the publicKey member
+type CreationOptions struct {
+	RP                     RelyingPartyEntity      `json:"rp"`
+	User                   UserEntity              `json:"user"`
+	Challenge              URLEncodedBase64        `json:"challenge"`
+	PubKeyCredParams       []CredentialParameter   `json:"pubKeyCredParams"`
+	Timeout                int64                   `json:"timeout,omitempty"`
+	ExcludeCredentials     []CredentialDescriptor  `json:"excludeCredentials,omitempty"`
+	AuthenticatorSelection *AuthenticatorSelection `json:"authenticatorSelection,omitempty"`
+	Attestation            string                  `json:"attestation,omitempty"`
+}
+
+// RequestOptions are the options of navigator.credentials.get, the publicKey member
+type RequestOptions struct {
+	Challenge        URLEncodedBase64       `json:"challenge"`
+	Timeout          int64                  `json:"timeout,omitempty"`
+	RPID             string                 `json:"rpId"`
+	AllowCredentials []CredentialDescriptor `json:"allowCredentials,omitempty"`
+	UserVerification string                 `json:"userVerification,omitempty"`
+}
+
+// AttestationResponse is the response of the authenticator to a registration
+type AttestationResponse struct {
+	ClientDataJSON    URLEncodedBase64 `json:"clientDataJSON"`
+	AttestationObject URLEncodedBase64 `json:"attestationObject"`
+	Transports        []string         `json:"transports,omitempty"`
+}
+
+// CredentialCreationResponse is the credential created by navigator.credentials.create, encoded in JSON
+type CredentialCreationResponse struct {
+	ID       string              `json:"id"`
+	RawID    URLEncodedBase64    `json:"rawId"`
+	Type     string              `json:"type"`
+	Response AttestationResponse `json:"response"`
+}
+
+// AssertionResponse is the response of the authenticator to an assertion
+type AssertionResponse struct {
+	ClientDataJSON    URLEncodedBase64 `json:"clientDataJSON"`
+	AuthenticatorData URLEncodedBase64 `json:"authenticatorData"`
+	Signature         URLEncodedBase64 `json:"signature"`
+	UserHandle        URLEncodedBase64 `json:"userHandle,omitempty"`
+}
+
+// CredentialAssertionResponse is the assertion returned by navigator.credentials.get, encoded in JSON
+type CredentialAssertionResponse struct {
+	ID       string            `json:"id"`
+	RawID    URLEncodedBase64  `json:"rawId"`
+	Type     string            `json:"type"`
+	Response AssertionResponse `json:"response"`
+}
+
+// ClientData is the data the browser collects for the authenticator to sign
+type ClientData struct {
+	Type        string `json:"type"`
+	Challenge   string `json:"challenge"`
+	Origin      string `json:"origin"`
+	CrossOrigin bool   `json:"crossOrigin,omitempty"`
+}
+
+// ParseClientData parses the client data JSON of a response
+func ParseClientData(clientDataJSON []byte) (*ClientData, error) {
+	clientData := &ClientData{}
+	if err := json.Unmarshal(clientDataJSON, clientData); err != nil {
+		return nil, fmt.Errorf("%w, %s", ErrInvalidClientData, err.Error())
+	}
+	return clientData, nil
+}
+
+// Challenge returns the challenge the registration answers, to find the ceremony it belongs to
+func (c *CredentialCreationResponse) Challenge() (string, error) {
+	clientData, err := ParseClientData(c.Response.ClientDataJSON)
+	if err != nil {
+		return "", err
+	}
+	return clientData.Challenge, nil
+}
+
+// Challenge returns the challenge the assertion answers, to find the ceremony it belongs to
+func (c *CredentialAssertionResponse) Challenge() (string, error) {
+	clientData, err := ParseClientData(c.Response.ClientDataJSON)
+	if err != nil {
+		return "", err
+	}
+	return clientData.Challenge, nil
+}
+
+// Credential is a credential registered, to be stored for the assertions of the user
+type Credential struct {
+	ID []byte
+	// PublicKey is the COSE_Key of the credential
+	PublicKey         []byte
+	Algorithm         int64
+	SignCount         uint32
+	AAGUID            []byte
+	Transports        []string
+	AttestationFormat string
+	UserVerified      bool
+	BackupEligible    bool
+}
+
+// RelyingParty verifies the ceremonies of the credentials scoped to its ID
+type RelyingParty struct {
+	// ID is the domain the credentials are scoped to, eg. example.com
+	ID   string
+	Name string
+	// Origins are the origins the ceremonies may run on, eg. https://login.example.com
+	Origins []string
+}
+
+// CredentialParameters returns the algorithms accepted for new credentials, the preferred first
+func CredentialParameters() []CredentialParameter {
+	params := make([]CredentialParameter, len(SupportedAlgorithms))
+	for i, alg := range SupportedAlgorithms {
+		params[i] = CredentialParameter{Type: CredentialType, Algorithm: alg}
+	}
+	return params
+}
+
+// verifyClientData checks the client data is of the ceremony, answers the challenge and comes from an allowed origin
+func (rp *RelyingParty) verifyClientData(clientDataJSON []byte, ceremony string, challenge []byte) error {
+	clientData, err := ParseClientData(clientDataJSON)
+	if err != nil {
+		return err
+	}
+	if clientData.Type != ceremony {
+		return fmt.Errorf("%w, type %s instead of %s", ErrInvalidClientData, clientData.Type, ceremony)
+	}
+	signed, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(clientData.Challenge, "="))
+	if err != nil || len(challenge) == 0 || subtle.ConstantTimeCompare(signed, challenge) != 1 {
+		return ErrChallengeMismatch
+	}
+	if clientData.CrossOrigin {
+		return fmt.Errorf("%w, cross origin ceremony", ErrOriginMismatch)
+	}
+	for _, origin := range rp.Origins {
+		if clientData.Origin == origin {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w, %s", ErrOriginMismatch, clientData.Origin)
+}
+
+// verifyAuthenticatorData checks the data is scoped to the relying party and the user was present, and verified if required
+func (rp *RelyingParty) verifyAuthenticatorData(raw []byte, requireUserVerification bool) (*AuthenticatorData, error) {
+	data, err := ParseAuthenticatorData(raw)
+	if err != nil {
+		return nil, err
+	}
+	rpIDHash := sha256.Sum256([]byte(rp.ID))
+	if subtle.ConstantTimeCompare(data.RPIDHash, rpIDHash[:]) != 1 {
+		return nil, ErrRPIDMismatch
+	}
+	if !data.Has(FlagUserPresent) {
+		return nil, ErrUserNotPresent
+	}
+	if requireUserVerification && !data.Has(FlagUserVerified) {
+		return nil, ErrUserNotVerified
+	}
+	return data, nil
+}
+
+// VerifyRegistration verifies the credential created for the challenge and returns it to be stored.
+// The attestation formats none, packed and fido-u2f are verified, the attestation certificates are not
+// checked against the authenticator vendors, the credentials are trusted like attestation none.
+func (rp *RelyingParty) VerifyRegistration(response *CredentialCreationResponse, challenge []byte, requireUserVerification bool) (*Credential, error) {
+	if response.Type != CredentialType {
+		return nil, fmt.Errorf("%w, credential type %s", ErrInvalidClientData, response.Type)
+	}
+	if err := rp.verifyClientData(response.Response.ClientDataJSON, ceremonyCreate, challenge); err != nil {
+		return nil, err
+	}
+	object, err := cborMapOf(response.Response.AttestationObject)
+	if err != nil {
+		return nil, fmt.Errorf("%w, %s", ErrInvalidAttestation, err.Error())
+	}
+	format, _ := object["fmt"].(string)
+	statement, okStatement := object["attStmt"].(map[interface{}]interface{})
+	rawAuthData, okAuthData := object["authData"].([]byte)
+	if !okStatement || !okAuthData {
+		return nil, fmt.Errorf("%w, missing attStmt or authData", ErrInvalidAttestation)
+	}
+	data, err := rp.verifyAuthenticatorData(rawAuthData, requireUserVerification)
+	if err != nil {
+		return nil, err
+	}
+	if !data.Has(FlagAttestedCredentialData) {
+		return nil, fmt.Errorf("%w, no credential created", ErrInvalidAuthenticatorData)
+	}
+	if len(response.RawID) > 0 && !bytes.Equal(response.RawID, data.CredentialID) {
+		return nil, fmt.Errorf("%w, rawId is not the credential created", ErrInvalidAttestation)
+	}
+	key, err := ParsePublicKey(data.CredentialPublicKey)
+	if err != nil {
+		return nil, err
+	}
+	clientDataHash := sha256.Sum256(response.Response.ClientDataJSON)
+	if err := verifyAttestation(format, statement, rawAuthData, clientDataHash[:], data, key); err != nil {
+		return nil, err
+	}
+	return &Credential{
+		ID:                data.CredentialID,
+		PublicKey:         data.CredentialPublicKey,
+		Algorithm:         key.Algorithm,
+		SignCount:         data.SignCount,
+		AAGUID:            data.AAGUID,
+		Transports:        response.Response.Transports,
+		AttestationFormat: format,
+		UserVerified:      data.Has(FlagUserVerified),
+		BackupEligible:    data.Has(FlagBackupEligible),
+	}, nil
+}
+
+// verifyAttestation verifies the attestation statement of the format
+func verifyAttestation(format string, statement map[interface{}]interface{}, rawAuthData, clientDataHash []byte, data *AuthenticatorData, key *PublicKey) error {
+	switch format {
+	case "none":
+		if len(statement) != 0 {
+			return fmt.Errorf("%w, attestation none with a statement", ErrInvalidAttestation)
+		}
+		return nil
+	case "packed":
+		return verifyPackedAttestation(statement, append(append([]byte{}, rawAuthData...), clientDataHash...), data, key)
+	case "fido-u2f":
+		return verifyU2FAttestation(statement, clientDataHash, data, key)
+	}
+	return fmt.Errorf("%w, %s", ErrUnsupportedAttestation, format)
+}
+
+// attestationCertificate parses the first certificate of the x5c of the statement, nil if there is none
+func attestationCertificate(statement map[interface{}]interface{}) (*x509.Certificate, error) {
+	x5c, ok := statement["x5c"]
+	if !ok {
+		return nil, nil
+	}
+	chain, ok := x5c.([]interface{})
+	if !ok || len(chain) == 0 {
+		return nil, fmt.Errorf("%w, empty x5c", ErrInvalidAttestation)
+	}
+	der, ok := chain[0].([]byte)
+	if !ok {
+		return nil, fmt.Errorf("%w, x5c of %T", ErrInvalidAttestation, chain[0])
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, fmt.Errorf("%w, certificate got %s", ErrInvalidAttestation, err.Error())
+	}
+	return cert, nil
+}
+
+// verifyPackedAttestation verifies a packed attestation, signed by an attestation certificate or by the credential itself
+func verifyPackedAttestation(statement map[interface{}]interface{}, signed []byte, data *AuthenticatorData, key *PublicKey) error {
+	alg, okAlg := statement["alg"].(int64)
+	sig, okSig := statement["sig"].([]byte)
+	if !okAlg || !okSig {
+		return fmt.Errorf("%w, packed statement without alg or sig", ErrInvalidAttestation)
+	}
+	cert, err := attestationCertificate(statement)
+	if err != nil {
+		return err
+	}
+	if cert == nil {
+		// self attestation, signed by the credential
+		if alg != key.Algorithm {
+			return fmt.Errorf("%w, self attestation algorithm %d for a credential of %d", ErrInvalidAttestation, alg, key.Algorithm)
+		}
+		if err := key.Verify(signed, sig); err != nil {
+			return fmt.Errorf("%w, %s", ErrInvalidAttestation, err.Error())
+		}
+		return nil
+	}
+	if cert.IsCA {
+		return fmt.Errorf("%w, attestation certificate is a CA", ErrInvalidAttestation)
+	}
+	for _, ext := range cert.Extensions {
+		if !ext.Id.Equal(oidFIDOGenCeAAGUID) {
+			continue
+		}
+		var aaguid []byte
+		if _, err := asn1.Unmarshal(ext.Value, &aaguid); err != nil || !bytes.Equal(aaguid, data.AAGUID) {
+			return fmt.Errorf("%w, certificate AAGUID does not match", ErrInvalidAttestation)
+		}
+	}
+	certKey := &PublicKey{Algorithm: alg, Key: cert.PublicKey}
+	if err := certKey.Verify(signed, sig); err != nil {
+		return fmt.Errorf("%w, %s", ErrInvalidAttestation, err.Error())
+	}
+	return nil
+}
+
+// verifyU2FAttestation verifies the attestation of a FIDO U2F security key, https://www.w3.org/TR/webauthn-2/#sctn-fido-u2f-attestation
+func verifyU2FAttestation(statement map[interface{}]interface{}, clientDataHash []byte, data *AuthenticatorData, key *PublicKey) error {
+	sig, ok := statement["sig"].([]byte)
+	if !ok {
+		return fmt.Errorf("%w, fido-u2f statement without sig", ErrInvalidAttestation)
+	}
+	if chain, ok := statement["x5c"].([]interface{}); !ok || len(chain) != 1 {
+		return fmt.Errorf("%w, fido-u2f statement needs exactly one certificate", ErrInvalidAttestation)
+	}
+	cert, err := attestationCertificate(statement)
+	if err != nil {
+		return err
+	}
+	if key.Algorithm != AlgES256 {
+		return fmt.Errorf("%w, fido-u2f credential of algorithm %d", ErrInvalidAttestation, key.Algorithm)
+	}
+	m, _ := cborMapOf(data.CredentialPublicKey)
+	x, _ := coseBytes(m, coseX)
+	y, _ := coseBytes(m, coseY)
+	signed := make([]byte, 0, 1+32+32+len(data.CredentialID)+65)
+	signed = append(signed, 0x00)
+	signed = append(signed, data.RPIDHash...)
+	signed = append(signed, clientDataHash...)
+	signed = append(signed, data.CredentialID...)
+	signed = append(signed, 0x04)
+	signed = append(signed, x...)
+	signed = append(signed, y...)
+	certKey := &PublicKey{Algorithm: AlgES256, Key: cert.PublicKey}
+	if err := certKey.Verify(signed, sig); err != nil {
+		return fmt.Errorf("%w, %s", ErrInvalidAttestation, err.Error())
+	}
+	return nil
+}
+
+// VerifyAssertion verifies the assertion answering the challenge with the stored credential public key
+// and its sign count, and returns the new sign count to store. A sign count not increasing fails with
+// ErrSignCountRegression, unless the authenticator does not count, both counts being zero.
+func (rp *RelyingParty) VerifyAssertion(response *CredentialAssertionResponse, challenge []byte, publicKey []byte, signCount uint32, requireUserVerification bool) (uint32, error) {
+	if response.Type != CredentialType {
+		return 0, fmt.Errorf("%w, credential type %s", ErrInvalidClientData, response.Type)
+	}
+	if err := rp.verifyClientData(response.Response.ClientDataJSON, ceremonyGet, challenge); err != nil {
+		return 0, err
+	}
+	data, err := rp.verifyAuthenticatorData(response.Response.AuthenticatorData, requireUserVerification)
+	if err != nil {
+		return 0, err
+	}
+	key, err := ParsePublicKey(publicKey)
+	if err != nil {
+		return 0, err
+	}
+	clientDataHash := sha256.Sum256(response.Response.ClientDataJSON)
+	signed := append(append([]byte{}, response.Response.AuthenticatorData...), clientDataHash[:]...)
+	if err := key.Verify(signed, response.Response.Signature); err != nil {
+		return 0, err
+	}
+	if (data.SignCount != 0 || signCount != 0) && data.SignCount <= signCount {
+		return 0, fmt.Errorf("%w, %d after %d", ErrSignCountRegression, data.SignCount, signCount)
+	}
+	return data.SignCount, nil
+}
@@ -0,0 +1,283 @@
+package webauthn_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/hyperjumptech/hansip/pkg/webauthn"
+	"github.com/hyperjumptech/hansip/pkg/webauthn/webauthntest"
+)
+
+var (
+	rp = &webauthn.RelyingParty{
+		ID:      "example.com",
+		Name:    "Example",
+		Origins: []string{"https://login.example.com"},
+	}
+)
+
+func creationOptions(t *testing.T) *webauthn.CreationOptions {
+	challenge, err := webauthn.NewChallenge()
+	if err != nil {
+		t.Fatalf("got %s", err.Error())
+	}
+	return &webauthn.CreationOptions{
+		RP:               webauthn.RelyingPartyEntity{ID: rp.ID, Name: rp.Name},
+		User:             webauthn.UserEntity{ID: []byte("user-1"), Name: "john@example.com", DisplayName: "John"},
+		Challenge:        challenge,
+		PubKeyCredParams: webauthn.CredentialParameters(),
+	}
+}
+
+func requestOptions(t *testing.T, credentials ...*webauthn.Credential) *webauthn.RequestOptions {
+	challenge, err := webauthn.NewChallenge()
+	if err != nil {
+		t.Fatalf("got %s", err.Error())
+	}
+	options := &webauthn.RequestOptions{Challenge: challenge, RPID: rp.ID}
+	for _, cred := range credentials {
+		options.AllowCredentials = append(options.AllowCredentials, webauthn.CredentialDescriptor{Type: webauthn.CredentialType, ID: cred.ID})
+	}
+	return options
+}
+
+// register creates a credential with the authenticator and verifies it
+func register(t *testing.T, authenticator *webauthntest.Authenticator) *webauthn.Credential {
+	options := creationOptions(t)
+	response, err := authenticator.Create(options)
+	if err != nil {
+		t.Fatalf("Create got %s", err.Error())
+	}
+	cred, err := rp.VerifyRegistration(response, options.Challenge, true)
+	if err != nil {
+		t.Fatalf("VerifyRegistration got %s", err.Error())
+	}
+	return cred
+}
+
+func TestRegisterAndAssert(t *testing.T) {
+	for _, alg := range webauthn.SupportedAlgorithms {
+		for _, attestation := range []string{"none", "packed"} {
+			authenticator := webauthntest.NewAuthenticator("https://login.example.com")
+			authenticator.Algorithm = alg
+			authenticator.Attestation = attestation
+			cred := register(t, authenticator)
+			if cred.Algorithm != alg || cred.AttestationFormat != attestation || !cred.UserVerified {
+				t.Errorf("unexpected credential %+v", cred)
+			}
+
+			for i := uint32(1); i <= 2; i++ {
+				options := requestOptions(t, cred)
+				assertion, err := authenticator.Get(options)
+				if err != nil {
+					t.Fatalf("Get got %s", err.Error())
+				}
+				count, err := rp.VerifyAssertion(assertion, options.Challenge, cred.PublicKey, cred.SignCount, true)
+				if err != nil {
+					t.Fatalf("algorithm %d attestation %s, VerifyAssertion got %s", alg, attestation, err.Error())
+				}
+				if count != i {
+					t.Errorf("expect sign count %d but got %d", i, count)
+				}
+				cred.SignCount = count
+			}
+		}
+	}
+}
+
+func TestJSONRoundTrip(t *testing.T) {
+	authenticator := webauthntest.NewAuthenticator("https://login.example.com")
+	options := creationOptions(t)
+	response, err := authenticator.Create(options)
+	if err != nil {
+		t.Fatalf("Create got %s", err.Error())
+	}
+	data, err := json.Marshal(response)
+	if err != nil {
+		t.Fatalf("Marshal got %s", err.Error())
+	}
+	decoded := &webauthn.CredentialCreationResponse{}
+	if err := json.Unmarshal(data, decoded); err != nil {
+		t.Fatalf("Unmarshal got %s", err.Error())
+	}
+	challenge, err := decoded.Challenge()
+	if err != nil || challenge != options.Challenge.String() {
+		t.Errorf("expect challenge %s but got %s, %v", options.Challenge.String(), challenge, err)
+	}
+	if _, err := rp.VerifyRegistration(decoded, options.Challenge, true); err != nil {
+		t.Errorf("VerifyRegistration got %s", err.Error())
+	}
+}
+
+func TestRegistrationRejected(t *testing.T) {
+	authenticator := webauthntest.NewAuthenticator("https://login.example.com")
+	options := creationOptions(t)
+	response, err := authenticator.Create(options)
+	if err != nil {
+		t.Fatalf("Create got %s", err.Error())
+	}
+	other, _ := webauthn.NewChallenge()
+	if _, err := rp.VerifyRegistration(response, other, false); !errors.Is(err, webauthn.ErrChallengeMismatch) {
+		t.Errorf("expect challenge mismatch but got %v", err)
+	}
+	otherRP := &webauthn.RelyingParty{ID: "evil.com", Origins: rp.Origins}
+	if _, err := otherRP.VerifyRegistration(response, options.Challenge, false); !errors.Is(err, webauthn.ErrRPIDMismatch) {
+		t.Errorf("expect rp id mismatch but got %v", err)
+	}
+	otherOrigin := &webauthn.RelyingParty{ID: rp.ID, Origins: []string{"https://evil.com"}}
+	if _, err := otherOrigin.VerifyRegistration(response, options.Challenge, false); !errors.Is(err, webauthn.ErrOriginMismatch) {
+		t.Errorf("expect origin mismatch but got %v", err)
+	}
+
+	authenticator.UserVerification = false
+	options = creationOptions(t)
+	response, err = authenticator.Create(options)
+	if err != nil {
+		t.Fatalf("Create got %s", err.Error())
+	}
+	if _, err := rp.VerifyRegistration(response, options.Challenge, true); !errors.Is(err, webauthn.ErrUserNotVerified) {
+		t.Errorf("expect user not verified but got %v", err)
+	}
+	if _, err := rp.VerifyRegistration(response, options.Challenge, false); err != nil {
+		t.Errorf("user verification not required, got %s", err.Error())
+	}
+}
+
+func TestAssertionRejected(t *testing.T) {
+	authenticator := webauthntest.NewAuthenticator("https://login.example.com")
+	cred := register(t, authenticator)
+
+	options := requestOptions(t, cred)
+	assertion, err := authenticator.Get(options)
+	if err != nil {
+		t.Fatalf("Get got %s", err.Error())
+	}
+	tampered := *assertion
+	tampered.Response.Signature = append([]byte{}, assertion.Response.Signature...)
+	tampered.Response.Signature[len(tampered.Response.Signature)-1] ^= 0xff
+	if _, err := rp.VerifyAssertion(&tampered, options.Challenge, cred.PublicKey, 0, true); !errors.Is(err, webauthn.ErrInvalidSignature) {
+		t.Errorf("expect invalid signature but got %v", err)
+	}
+	other := register(t, webauthntest.NewAuthenticator("https://login.example.com"))
+	if _, err := rp.VerifyAssertion(assertion, options.Challenge, other.PublicKey, 0, true); !errors.Is(err, webauthn.ErrInvalidSignature) {
+		t.Errorf("expect invalid signature with another key but got %v", err)
+	}
+	if _, err := rp.VerifyAssertion(assertion, options.Challenge, cred.PublicKey, 5, true); !errors.Is(err, webauthn.ErrSignCountRegression) {
+		t.Errorf("expect sign count regression but got %v", err)
+	}
+	creation := creationOptions(t)
+	created, _ := authenticator.Create(creation)
+	created.Response.ClientDataJSON = assertion.Response.ClientDataJSON
+	if _, err := rp.VerifyRegistration(created, options.Challenge, true); !errors.Is(err, webauthn.ErrInvalidClientData) {
+		t.Errorf("an assertion can not register a credential, got %v", err)
+	}
+}
+
+func TestAssertionWithoutSignCount(t *testing.T) {
+	authenticator := webauthntest.NewAuthenticator("https://login.example.com")
+	authenticator.NoSignCount = true
+	cred := register(t, authenticator)
+	for i := 0; i < 2; i++ {
+		options := requestOptions(t)
+		assertion, err := authenticator.Get(options)
+		if err != nil {
+			t.Fatalf("Get got %s", err.Error())
+		}
+		if string(assertion.Response.UserHandle) != "user-1" {
+			t.Errorf("expect the user handle of a discoverable credential but got %s", assertion.Response.UserHandle)
+		}
+		count, err := rp.VerifyAssertion(assertion, options.Challenge, cred.PublicKey, cred.SignCount, true)
+		if err != nil || count != 0 {
+			t.Errorf("authenticators not counting should be accepted, got %d, %v", count, err)
+		}
+	}
+}
+
+func TestURLEncodedBase64(t *testing.T) {
+	var b webauthn.URLEncodedBase64
+	for _, encoded := range []string{`"-_8"`, `"-_8="`} {
+		if err := json.Unmarshal([]byte(encoded), &b); err != nil || len(b) != 2 || b[0] != 0xfb || b[1] != 0xff {
+			t.Errorf("%s decoded to %x, %v", encoded, []byte(b), err)
+		}
+	}
+	data, _ := json.Marshal(b)
+	if string(data) != `"-_8"` {
+		t.Errorf("expect unpadded base64url but got %s", data)
+	}
+}
+
+// attestationCertificate returns an attestation key and its certificate, stating the AAGUID if any
+func attestationCertificate(t *testing.T, aaguid []byte) (*ecdsa.PrivateKey, []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("got %s", err.Error())
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{Organization: []string{"Example Authenticators"}, OrganizationalUnit: []string{"Authenticator Attestation"}, CommonName: "Example Key"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	if aaguid != nil {
+		value, _ := asn1.Marshal(aaguid)
+		template.ExtraExtensions = append(template.ExtraExtensions, pkix.Extension{Id: asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 45724, 1, 1, 4}, Value: value})
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		t.Fatalf("got %s", err.Error())
+	}
+	return key, der
+}
+
+func TestCertificateAttestation(t *testing.T) {
+	aaguid := []byte("0123456789abcdef")
+	for _, format := range []string{"packed", "fido-u2f"} {
+		key, cert := attestationCertificate(t, aaguid)
+		authenticator := webauthntest.NewAuthenticator("https://login.example.com")
+		authenticator.Attestation = format
+		authenticator.AAGUID = aaguid
+		authenticator.AttestationKey = key
+		authenticator.AttestationCertificate = cert
+		cred := register(t, authenticator)
+		if cred.AttestationFormat != format || string(cred.AAGUID) != string(aaguid) {
+			t.Errorf("unexpected credential %+v", cred)
+		}
+
+		// signed by another key than the certificate one
+		other, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		authenticator.AttestationKey = other
+		options := creationOptions(t)
+		response, err := authenticator.Create(options)
+		if err != nil {
+			t.Fatalf("Create got %s", err.Error())
+		}
+		if _, err := rp.VerifyRegistration(response, options.Challenge, true); !errors.Is(err, webauthn.ErrInvalidAttestation) {
+			t.Errorf("%s signed by another key should be rejected, got %v", format, err)
+		}
+	}
+
+	// the certificate is of another authenticator model
+	key, cert := attestationCertificate(t, []byte("fedcba9876543210"))
+	authenticator := webauthntest.NewAuthenticator("https://login.example.com")
+	authenticator.Attestation = "packed"
+	authenticator.AAGUID = aaguid
+	authenticator.AttestationKey = key
+	authenticator.AttestationCertificate = cert
+	options := creationOptions(t)
+	response, err := authenticator.Create(options)
+	if err != nil {
+		t.Fatalf("Create got %s", err.Error())
+	}
+	if _, err := rp.VerifyRegistration(response, options.Challenge, true); !errors.Is(err, webauthn.ErrInvalidAttestation) {
+		t.Errorf("certificate of another AAGUID should be rejected, got %v", err)
+	}
+}
@@ -0,0 +1,297 @@
+// Package webauthntest provides a software authenticator, to test WebAuthn ceremonies without a security key.
+package webauthntest
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math/big"
+
+	"github.com/hyperjumptech/hansip/pkg/webauthn"
+)
+
+// credential is a credential kept by the authenticator
+type credential struct {
+	id         []byte
+	rpID       string
+	userHandle []byte
+	algorithm  int64
+	signer     crypto.Signer
+	signCount  uint32
+}
+
+// Authenticator is a software authenticator. It creates credentials and signs assertions like a security key
+// or a platform authenticator would, as configured by its fields.
+type Authenticator struct {
+	// Origin is the origin the browser reports, eg. https://login.example.com
+	Origin string
+	// Algorithm of the credentials created, webauthn.AlgES256 if zero
+	Algorithm int64
+	// AAGUID of the authenticator model, zeros if nil
+	AAGUID []byte
+	// Attestation format of the registrations, "none", "packed" or "fido-u2f", "none" if empty.
+	// Packed attestations are self attestations unless AttestationCertificate is set.
+	Attestation string
+	// AttestationKey, an ECDSA P-256 key, signs the packed and fido-u2f attestations of the AttestationCertificate, in DER
+	AttestationKey         crypto.Signer
+	AttestationCertificate []byte
+	// UserVerification sets the user verified flag, as if the user entered a PIN
+	UserVerification bool
+	// NoSignCount keeps the sign count at zero, like the authenticators that do not count
+	NoSignCount bool
+
+	credentials []*credential
+}
+
+// NewAuthenticator returns an authenticator of ES256 credentials, verifying the user, used from the origin
+func NewAuthenticator(origin string) *Authenticator {
+	return &Authenticator{Origin: origin, UserVerification: true}
+}
+
+// newSigner generates the key pair of a new credential
+func (a *Authenticator) newSigner(algorithm int64) (crypto.Signer, error) {
+	switch algorithm {
+	case webauthn.AlgES256:
+		return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case webauthn.AlgEdDSA:
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		return key, err
+	case webauthn.AlgRS256:
+		return rsa.GenerateKey(rand.Reader, 2048)
+	}
+	return nil, fmt.Errorf("algorithm %d not supported by the authenticator", algorithm)
+}
+
+// sign signs the data with the credential key, as its algorithm does
+func sign(signer crypto.Signer, algorithm int64, data []byte) ([]byte, error) {
+	if algorithm == webauthn.AlgEdDSA {
+		return signer.Sign(rand.Reader, data, crypto.Hash(0))
+	}
+	digest := sha256.Sum256(data)
+	return signer.Sign(rand.Reader, digest[:], crypto.SHA256)
+}
+
+// coseKey encodes the public key of the signer as a COSE_Key
+func coseKey(signer crypto.Signer, algorithm int64) []byte {
+	switch key := signer.Public().(type) {
+	case *ecdsa.PublicKey:
+		return Marshal(Map{
+			{int64(1), int64(2)},
+			{int64(3), algorithm},
+			{int64(-1), int64(1)},
+			{int64(-2), padded(key.X, 32)},
+			{int64(-3), padded(key.Y, 32)},
+		})
+	case ed25519.PublicKey:
+		return Marshal(Map{
+			{int64(1), int64(1)},
+			{int64(3), algorithm},
+			{int64(-1), int64(6)},
+			{int64(-2), []byte(key)},
+		})
+	case *rsa.PublicKey:
+		return Marshal(Map{
+			{int64(1), int64(3)},
+			{int64(3), algorithm},
+			{int64(-1), key.N.Bytes()},
+			{int64(-2), big.NewInt(int64(key.E)).Bytes()},
+		})
+	}
+	return nil
+}
+
+// padded returns the big endian bytes of the integer, left padded to the size
+func padded(i *big.Int, size int) []byte {
+	b := i.Bytes()
+	return append(make([]byte, size-len(b)), b...)
+}
+
+// clientData returns the client data JSON the browser would collect for the ceremony
+func (a *Authenticator) clientData(ceremony string, challenge []byte) []byte {
+	data, _ := json.Marshal(&webauthn.ClientData{
+		Type:      ceremony,
+		Challenge: base64.RawURLEncoding.EncodeToString(challenge),
+		Origin:    a.Origin,
+	})
+	return data
+}
+
+// flags returns the flags of the authenticator data
+func (a *Authenticator) flags() byte {
+	flags := webauthn.FlagUserPresent
+	if a.UserVerification {
+		flags |= webauthn.FlagUserVerified
+	}
+	return flags
+}
+
+// authenticatorData returns the authenticator data for the relying party, without attested credential data
+func authenticatorData(rpID string, flags byte, signCount uint32) []byte {
+	rpIDHash := sha256.Sum256([]byte(rpID))
+	data := append([]byte{}, rpIDHash[:]...)
+	data = append(data, flags)
+	count := make([]byte, 4)
+	binary.BigEndian.PutUint32(count, signCount)
+	return append(data, count...)
+}
+
+// Create creates a credential as navigator.credentials.create would with the options
+func (a *Authenticator) Create(options *webauthn.CreationOptions) (*webauthn.CredentialCreationResponse, error) {
+	for _, excluded := range options.ExcludeCredentials {
+		if a.find(options.RP.ID, excluded.ID) != nil {
+			return nil, fmt.Errorf("authenticator already holds an excluded credential")
+		}
+	}
+	algorithm := a.Algorithm
+	if algorithm == 0 {
+		algorithm = webauthn.AlgES256
+	}
+	signer, err := a.newSigner(algorithm)
+	if err != nil {
+		return nil, err
+	}
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+	cred := &credential{
+		id:         id,
+		rpID:       options.RP.ID,
+		userHandle: options.User.ID,
+		algorithm:  algorithm,
+		signer:     signer,
+	}
+	aaguid := a.AAGUID
+	if aaguid == nil {
+		aaguid = make([]byte, 16)
+	}
+	authData := authenticatorData(cred.rpID, a.flags()|webauthn.FlagAttestedCredentialData, 0)
+	authData = append(authData, aaguid...)
+	authData = append(authData, byte(len(id)>>8), byte(len(id)))
+	authData = append(authData, id...)
+	authData = append(authData, coseKey(signer, algorithm)...)
+
+	clientData := a.clientData("webauthn.create", options.Challenge)
+	format := a.Attestation
+	if len(format) == 0 {
+		format = "none"
+	}
+	statement, err := a.statement(format, authData, clientData, cred, signer)
+	if err != nil {
+		return nil, err
+	}
+	a.credentials = append(a.credentials, cred)
+	return &webauthn.CredentialCreationResponse{
+		ID:    base64.RawURLEncoding.EncodeToString(id),
+		RawID: id,
+		Type:  webauthn.CredentialType,
+		Response: webauthn.AttestationResponse{
+			ClientDataJSON:    clientData,
+			AttestationObject: Marshal(Map{{"fmt", format}, {"attStmt", statement}, {"authData", authData}}),
+			Transports:        []string{"usb"},
+		},
+	}, nil
+}
+
+// statement returns the attestation statement of the format for the credential created
+func (a *Authenticator) statement(format string, authData, clientData []byte, cred *credential, signer crypto.Signer) (Map, error) {
+	clientDataHash := sha256.Sum256(clientData)
+	switch format {
+	case "none":
+		return Map{}, nil
+	case "packed":
+		signed := append(append([]byte{}, authData...), clientDataHash[:]...)
+		if a.AttestationKey == nil {
+			sig, err := sign(signer, cred.algorithm, signed)
+			if err != nil {
+				return nil, err
+			}
+			return Map{{"alg", cred.algorithm}, {"sig", sig}}, nil
+		}
+		sig, err := sign(a.AttestationKey, webauthn.AlgES256, signed)
+		if err != nil {
+			return nil, err
+		}
+		return Map{{"alg", webauthn.AlgES256}, {"sig", sig}, {"x5c", []interface{}{a.AttestationCertificate}}}, nil
+	case "fido-u2f":
+		key, ok := signer.Public().(*ecdsa.PublicKey)
+		if !ok || a.AttestationKey == nil {
+			return nil, fmt.Errorf("fido-u2f attestation needs an ES256 credential and an attestation key")
+		}
+		rpIDHash := sha256.Sum256([]byte(cred.rpID))
+		signed := append([]byte{0x00}, rpIDHash[:]...)
+		signed = append(signed, clientDataHash[:]...)
+		signed = append(signed, cred.id...)
+		signed = append(signed, 0x04)
+		signed = append(signed, padded(key.X, 32)...)
+		signed = append(signed, padded(key.Y, 32)...)
+		sig, err := sign(a.AttestationKey, webauthn.AlgES256, signed)
+		if err != nil {
+			return nil, err
+		}
+		return Map{{"sig", sig}, {"x5c", []interface{}{a.AttestationCertificate}}}, nil
+	}
+	return nil, fmt.Errorf("attestation %s not supported by the authenticator", format)
+}
+
+// find returns the credential of the relying party with the id, nil if the authenticator does not hold it
+func (a *Authenticator) find(rpID string, id []byte) *credential {
+	for _, cred := range a.credentials {
+		if cred.rpID == rpID && bytes.Equal(cred.id, id) {
+			return cred
+		}
+	}
+	return nil
+}
+
+// Get signs an assertion as navigator.credentials.get would with the options, with the first credential allowed,
+// or the first credential of the relying party if the options allow any discoverable credential
+func (a *Authenticator) Get(options *webauthn.RequestOptions) (*webauthn.CredentialAssertionResponse, error) {
+	var cred *credential
+	if len(options.AllowCredentials) == 0 {
+		for _, c := range a.credentials {
+			if c.rpID == options.RPID {
+				cred = c
+				break
+			}
+		}
+	}
+	for _, allowed := range options.AllowCredentials {
+		if cred = a.find(options.RPID, allowed.ID); cred != nil {
+			break
+		}
+	}
+	if cred == nil {
+		return nil, fmt.Errorf("authenticator holds no credential allowed")
+	}
+	if !a.NoSignCount {
+		cred.signCount++
+	}
+	authData := authenticatorData(cred.rpID, a.flags(), cred.signCount)
+	clientData := a.clientData("webauthn.get", options.Challenge)
+	clientDataHash := sha256.Sum256(clientData)
+	sig, err := sign(cred.signer, cred.algorithm, append(append([]byte{}, authData...), clientDataHash[:]...))
+	if err != nil {
+		return nil, err
+	}
+	return &webauthn.CredentialAssertionResponse{
+		ID:    base64.RawURLEncoding.EncodeToString(cred.id),
+		RawID: cred.id,
+		Type:  webauthn.CredentialType,
+		Response: webauthn.AssertionResponse{
+			ClientDataJSON:    clientData,
+			AuthenticatorData: authData,
+			Signature:         sig,
+			UserHandle:        cred.userHandle,
+		},
+	}, nil
+}
@@ -0,0 +1,72 @@
+package webauthntest
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// Pair is an entry of a CBOR map
+type Pair struct {
+	Key   interface{}
+	Value interface{}
+}
+
+// Map is a CBOR map, encoded in the order of its entries
+type Map []Pair
+
+// Marshal encodes the value as CBOR. It encodes int64, []byte, string, []interface{}, Map and bool,
+// enough to build the attestation objects and the keys of the authenticator.
+func Marshal(value interface{}) []byte {
+	switch v := value.(type) {
+	case int64:
+		if v < 0 {
+			return head(1, uint64(-1-v))
+		}
+		return head(0, uint64(v))
+	case []byte:
+		return append(head(2, uint64(len(v))), v...)
+	case string:
+		return append(head(3, uint64(len(v))), v...)
+	case []interface{}:
+		data := head(4, uint64(len(v)))
+		for _, item := range v {
+			data = append(data, Marshal(item)...)
+		}
+		return data
+	case Map:
+		data := head(5, uint64(len(v)))
+		for _, pair := range v {
+			data = append(data, Marshal(pair.Key)...)
+			data = append(data, Marshal(pair.Value)...)
+		}
+		return data
+	case bool:
+		if v {
+			return []byte{0xf5}
+		}
+		return []byte{0xf4}
+	}
+	panic(fmt.Sprintf("webauthntest can not encode %T", value))
+}
+
+// head encodes the head of an item of the major type
+func head(major byte, arg uint64) []byte {
+	major <<= 5
+	switch {
+	case arg < 24:
+		return []byte{major | byte(arg)}
+	case arg <= 0xff:
+		return []byte{major | 24, byte(arg)}
+	case arg <= 0xffff:
+		b := []byte{major | 25, 0, 0}
+		binary.BigEndian.PutUint16(b[1:], uint16(arg))
+		return b
+	case arg <= 0xffffffff:
+		b := []byte{major | 26, 0, 0, 0, 0}
+		binary.BigEndian.PutUint32(b[1:], uint32(arg))
+		return b
+	}
+	b := []byte{major | 27, 0, 0, 0, 0, 0, 0, 0, 0}
+	binary.BigEndian.PutUint64(b[1:], arg)
+	return b
+}